@@ -0,0 +1,53 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// gotemplate renders the files of the template source as Go templates with the parameters, for the eunomia-gotemplate
+// template processor
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/KohlsTechnology/eunomia/pkg/gotemplate"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	templates := pflag.String("templates", os.Getenv("CLONED_TEMPLATE_GIT_DIR"), "directory of the templates")
+	parameters := pflag.String("parameters", os.Getenv("CLONED_PARAMETER_GIT_DIR"), "directory of the parameter files")
+	parameterFile := pflag.String("parameter-file", os.Getenv("PARAMETER_FILE"), "parameter file, relative to the parameters directory. All the .yaml and .yml files of the directory are merged when it isn't set")
+	output := pflag.String("output", os.Getenv("MANIFEST_DIR"), "directory of the rendered manifests")
+	pflag.Parse()
+
+	err := render(*templates, *parameters, *parameterFile, *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func render(templates, parameters, parameterFile, output string) error {
+	files, err := gotemplate.ParameterFiles(parameters, parameterFile)
+	if err != nil {
+		return err
+	}
+	values, err := gotemplate.LoadParameters(files...)
+	if err != nil {
+		return err
+	}
+	return gotemplate.Render(templates, output, values)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-eunomia is a kubectl plugin showing the state of the GitOpsConfigs and rendering them locally, installed by
+// copying it to the PATH:
+//
+//	kubectl eunomia history <name> [-n <namespace>]
+//	kubectl eunomia render --config <gitopsconfig.yaml> --repo <dir> [--parameters <dir>] [--set <key>=<value>]...
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis"
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/history"
+	"github.com/KohlsTechnology/eunomia/pkg/render"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+const usage = `Usage:
+  kubectl eunomia history <name> [-n <namespace>]
+  kubectl eunomia render --config <gitopsconfig.yaml> --repo <dir> [--parameters <dir>] [--set <key>=<value>]...`
+
+func main() {
+	namespace := pflag.StringP("namespace", "n", "", "namespace of the GitOpsConfig, the one of the current context by default")
+	configFile := pflag.String("config", "", "render: file of the GitOpsConfig rendered")
+	repo := pflag.String("repo", "", "render: working tree of the template repository, rendered instead of its clone")
+	parameters := pflag.String("parameters", "", "render: working tree of the parameter repository, the template repository by default")
+	branch := pflag.String("branch", "", "render: pushed branch, for the parameter files selected by the branch")
+	set := pflag.StringArray("set", nil, "render: parameter overriding the ones of the parameter file, as key=value, the dots of the key separating nested maps")
+	processor := pflag.String("processor", "", "render: template processor image, e.g. helm, inferred from the templateProcessorImage by default")
+	eunomiaDir := pflag.String("eunomia-dir", os.Getenv("EUNOMIA_DIR"), "render: checkout of eunomia, with the template processor scripts and the job template, the current directory by default")
+	// the flags of controller-runtime, e.g. --kubeconfig
+	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	pflag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	args := pflag.Args()
+	var err error
+	switch {
+	case len(args) == 2 && args[0] == "history":
+		err = printHistory(args[1], *namespace)
+	case len(args) == 1 && args[0] == "render" && *configFile != "" && *repo != "":
+		err = renderConfig(*configFile, *eunomiaDir, render.Options{
+			TemplateDir:  *repo,
+			ParameterDir: *parameters,
+			Branch:       *branch,
+			Set:          *set,
+			Processor:    *processor,
+		})
+	default:
+		pflag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// renderConfig prints the manifests rendered from the GitOpsConfig of configFile with the template processor scripts
+// and the job template of the eunomia checkout eunomiaDir, the scripts logging to stderr
+func renderConfig(configFile, eunomiaDir string, options render.Options) error {
+	config, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	options.Config = config
+	options.ProcessorsDir = filepath.Join(eunomiaDir, "template-processors")
+	templates := filepath.Join(eunomiaDir, "deploy", "helm", "operator", "eunomia-templates")
+	err = util.InitializeTemplates(filepath.Join(templates, "job.yaml"), filepath.Join(templates, "cronjob.yaml"))
+	if err != nil {
+		return err
+	}
+	return render.Render(os.Stdout, os.Stderr, options)
+}
+
+// printHistory prints the sync history of the GitOpsConfig called name in namespace, by default the namespace of the
+// current context
+func printHistory(name, namespace string) error {
+	if namespace == "" {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		if kubeconfig := flag.Lookup("kubeconfig"); kubeconfig != nil {
+			rules.ExplicitPath = kubeconfig.Value.String()
+		}
+		current, _, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).Namespace()
+		if err != nil {
+			return err
+		}
+		namespace = current
+	}
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+	s := runtime.NewScheme()
+	if err := apis.AddToScheme(s); err != nil {
+		return err
+	}
+	configs, err := client.New(cfg, client.Options{Scheme: s})
+	if err != nil {
+		return err
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err = configs.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance)
+	if err != nil {
+		return err
+	}
+	return history.Print(os.Stdout, name, instance.Status.History)
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// setLeaderElection makes the manager of options elect a leader among the replicas of the operator with the id
+// ConfigMap of namespace, the operator namespace when empty, looked up with operatorNamespace. Only the leader starts
+// the controllers and the runnables of the manager, e.g. the watch on jobs, the other replicas waiting to take over
+// when its lease expires. Leader election is skipped when the operator namespace is unknown, e.g. when the operator
+// runs outside of the cluster, and the reason is returned.
+func setLeaderElection(options *manager.Options, id, namespace string, operatorNamespace func() (string, error)) error {
+	if namespace == "" {
+		var err error
+		namespace, err = operatorNamespace()
+		if err != nil {
+			return err
+		}
+	}
+	options.LeaderElection = true
+	options.LeaderElectionID = id
+	options.LeaderElectionNamespace = namespace
+	return nil
+}
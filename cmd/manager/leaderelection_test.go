@@ -0,0 +1,66 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+func TestSetLeaderElection(t *testing.T) {
+	inCluster := func() (string, error) { return "eunomia-operator", nil }
+	outOfCluster := func() (string, error) { return "", errors.New("namespace not found for current environment") }
+	tests := []struct {
+		name              string
+		namespace         string
+		operatorNamespace func() (string, error)
+		expected          manager.Options
+		err               string
+	}{
+		{
+			name:              "operator namespace",
+			operatorNamespace: inCluster,
+			expected:          manager.Options{LeaderElection: true, LeaderElectionID: "eunomia-leader", LeaderElectionNamespace: "eunomia-operator"},
+		},
+		{
+			name:              "namespace",
+			namespace:         "eunomia-locks",
+			operatorNamespace: outOfCluster,
+			expected:          manager.Options{LeaderElection: true, LeaderElectionID: "eunomia-leader", LeaderElectionNamespace: "eunomia-locks"},
+		},
+		{
+			name:              "out of cluster",
+			operatorNamespace: outOfCluster,
+			err:               "namespace not found for current environment",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := manager.Options{}
+			err := setLeaderElection(&options, "eunomia-leader", tt.namespace, tt.operatorNamespace)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, options)
+		})
+	}
+}
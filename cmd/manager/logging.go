@@ -0,0 +1,47 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-logr/logr"
+	"github.com/operator-framework/operator-sdk/pkg/log/zap"
+)
+
+// logEncoders maps the log formats to the zap encoders writing them
+var logEncoders = map[string]string{
+	"json": "json",
+	"text": "console",
+}
+
+// newLogger returns the logger of the operator writing to w in format, json or text. The key/value pairs of the log
+// lines are fields of the JSON objects, the Kubernetes objects being reduced to their kind, namespace and name. An
+// empty format keeps the encoder of the zap flags, JSON unless --zap-devel is set.
+func newLogger(format string, w io.Writer) (logr.Logger, error) {
+	if format != "" {
+		encoder, ok := logEncoders[format]
+		if !ok {
+			return nil, fmt.Errorf("log format %q is not one of json, text", format)
+		}
+		if err := zap.FlagSet().Set("zap-encoder", encoder); err != nil {
+			return nil, err
+		}
+	}
+	return zap.LoggerTo(w), nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewLoggerJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := newLogger("json", buf)
+	assert.NoError(t, err)
+
+	job := &batchv1.Job{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{Name: "gitopsconfig-gitops-operator-abcde", Namespace: "gitops"},
+	}
+	logger.WithName("controller_gitopsconfig").Info("job finished", "job", job.Name, "attempt", 2, "newObj", job)
+	logger.Error(errors.New("not found"), "cannot find owner of job", "job", job.Name)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	info := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &info), lines[0])
+	assert.Equal(t, "info", info["level"])
+	assert.Equal(t, "controller_gitopsconfig", info["logger"])
+	assert.Equal(t, "job finished", info["msg"])
+	assert.Equal(t, "gitopsconfig-gitops-operator-abcde", info["job"])
+	assert.Equal(t, float64(2), info["attempt"])
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"namespace":  "gitops",
+		"name":       "gitopsconfig-gitops-operator-abcde",
+	}, info["newObj"])
+
+	failure := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &failure), lines[1])
+	assert.Equal(t, "error", failure["level"])
+	assert.Equal(t, "not found", failure["error"])
+	assert.Equal(t, "gitopsconfig-gitops-operator-abcde", failure["job"])
+}
+
+func TestNewLoggerText(t *testing.T) {
+	defer newLogger("json", &bytes.Buffer{})
+	buf := &bytes.Buffer{}
+	logger, err := newLogger("text", buf)
+	assert.NoError(t, err)
+
+	logger.Info("job finished", "job", "gitopsconfig-gitops-operator-abcde")
+	assert.Error(t, json.Unmarshal(buf.Bytes(), &map[string]interface{}{}))
+	assert.Contains(t, buf.String(), "job finished")
+	assert.Contains(t, buf.String(), `"job": "gitopsconfig-gitops-operator-abcde"`)
+}
+
+func TestNewLoggerUnknownFormat(t *testing.T) {
+	_, err := newLogger("xml", &bytes.Buffer{})
+	assert.EqualError(t, err, `log format "xml" is not one of json, text`)
+}
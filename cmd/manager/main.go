@@ -17,25 +17,33 @@ limitations under the License.
 package main
 
 import (
-	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/KohlsTechnology/eunomia/pkg/apis"
+	"github.com/KohlsTechnology/eunomia/pkg/attestation"
+	"github.com/KohlsTechnology/eunomia/pkg/audit"
 	"github.com/KohlsTechnology/eunomia/pkg/controller"
 	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
 	"github.com/KohlsTechnology/eunomia/pkg/handler"
+	"github.com/KohlsTechnology/eunomia/pkg/orphan"
+	"github.com/KohlsTechnology/eunomia/pkg/signature"
+	"github.com/KohlsTechnology/eunomia/pkg/tracing"
 	"github.com/KohlsTechnology/eunomia/pkg/util"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
-	"github.com/operator-framework/operator-sdk/pkg/leader"
 	"github.com/operator-framework/operator-sdk/pkg/log/zap"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
@@ -64,17 +72,79 @@ func main() {
 	// controller-runtime)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 
+	kubeAPIQPS := pflag.Float32("kube-api-qps", 0, "Requests per second to the API server, 0 keeps the client default")
+	kubeAPIBurst := pflag.Int("kube-api-burst", 0, "Requests allowed above kube-api-qps for short periods, 0 keeps the client default")
+	kubeAPITimeout := pflag.Duration("kube-api-timeout", 0, "Timeout of a single request to the API server, also used by the jobs applying resources, 0 means no timeout")
+	defaultImagePullPolicy := pflag.String("default-image-pull-policy", "", "Pull policy of the template processors of the GitOpsConfigs not setting one, empty means Always for the latest or untagged images and IfNotPresent for the others")
+	jobRequests := pflag.String("job-requests", "", "Comma separated requests of the template processors of the GitOpsConfigs not setting them in jobTemplate.resources, e.g. cpu=100m,memory=256Mi, empty requests nothing")
+	jobLimits := pflag.String("job-limits", "", "Comma separated limits of the template processors of the GitOpsConfigs not setting them in jobTemplate.resources, e.g. cpu=1,memory=1Gi, empty leaves them unbounded")
+	imageSignatureKey := pflag.String("image-signature-key", "", "Path of the cosign public key that must have signed the template processor images")
+	imageSignatureIdentity := pflag.String("image-signature-identity", "", "Certificate identity of the keyless cosign signatures of the template processor images")
+	imageSignatureIssuer := pflag.String("image-signature-issuer", "", "OIDC issuer of the certificates of the keyless cosign signatures of the template processor images")
+	attestationKey := pflag.String("attestation-key", "", "Path of the PEM ECDSA or Ed25519 private key signing the provenance attestation of every successful job, empty disables the attestations")
+	startupQuietWindow := pflag.Duration("startup-quiet-window", 0, "How long after the operator starts the events of the jobs that finished before it are not recorded again, 0 records them all")
+	dependencyWaitMaxDelay := pflag.Duration("dependency-wait-max-delay", 0, "Longest delay between the checks of the Secrets and ConfigMaps referenced by a GitOpsConfig that don't exist yet, its runs being deferred until they do, 0 starts the runs anyway")
+	resyncOnSecretChange := pflag.Bool("resync-on-secret-change", false, "Run the GitOpsConfigs with a Change or Webhook trigger again when the data of a Secret their jobs use changes, e.g. rotated git credentials, which caches all the Secrets the operator can read")
+	orphanSweepInterval := pflag.Duration("orphan-sweep-interval", 0, "How often the resources applied by Eunomia that no GitOpsConfig claims anymore are looked for and reported, 0 disables the sweep")
+	deleteOrphans := pflag.Bool("delete-orphans", false, "Delete the orphaned resources found by the sweep or the orphans command, instead of only reporting them")
+	remotePollInterval := pflag.Duration("remote-poll-interval", 0, "How often the commit the template source ref of every GitOpsConfig points to is looked up in its repository and recorded in status.availableCommit, 0 disables the lookups")
+	shutdownGracePeriod := pflag.Duration("shutdown-grace-period", 20*time.Second, "How long the operator waits, when it is terminated, for the changes of the Jobs already received from the watch, e.g. their completion, to be processed, 0 doesn't wait")
+	jobStuckTimeout := pflag.Duration("job-stuck-timeout", 10*time.Minute, "How long the pod of a job may be pending, e.g. unschedulable or pulling its image, before a JobStuck event is recorded and the Degraded condition of its GitOpsConfig is set, 0 disables the reports")
+	suspendConfigMap := pflag.String("suspend-configmap", "eunomia-suspend", "Name of the ConfigMap of the operator namespace acting as a kill switch: while it exists no job is created and all the cronjobs are suspended, empty disables the kill switch")
+	readOnly := pflag.Bool("read-only", false, "Make the jobs of all the GitOpsConfigs only render and diff their manifests, reporting the resources differing from git without modifying them")
+	jobWatchNamespaces := pflag.StringSlice("job-watch-namespaces", nil, "Comma separated namespaces whose Jobs are watched to report their completion, e.g. the namespaces of the GitOpsConfigs and their jobNamespaces, empty watches all the namespaces")
+	maxConcurrentJobs := pflag.Int("max-concurrent-jobs", 0, "Most active jobs of all the GitOpsConfigs, the runs above it being queued and started in order as the jobs complete, 0 disables the limit")
+	syncEventsMaxSubscribers := pflag.Int("sync-events-max-subscribers", 0, "Most clients streaming the sync events of the GitOpsConfigs from /syncevents of the webhook server at once, the others being answered with 503, 0 disables the stream")
+	jobEventWorkers := pflag.Int("job-event-workers", 1, "Workers reporting the changes of the watched Jobs in parallel, the changes of the Jobs of a GitOpsConfig being reported in order by the same worker")
+	eventRateLimit := pflag.Float64("event-rate-limit", 10, "Events per minute recorded on each GitOpsConfig, the events above it are dropped and periodically summarized, 0 disables the limit")
+	eventBurst := pflag.Int("event-burst", 25, "Events recorded at once on each GitOpsConfig, above event-rate-limit")
+	helmImage := pflag.String("helm-image", "quay.io/kohlstechnology/eunomia-helm:latest", "Template processor image of the GitOpsConfigs whose templateProcessorType is Helm and that don't set a templateProcessorImage")
+	jsonnetImage := pflag.String("jsonnet-image", "quay.io/kohlstechnology/eunomia-jsonnet:latest", "Template processor image of the GitOpsConfigs whose templateProcessorType is Jsonnet and that don't set a templateProcessorImage")
+	kustomizeImage := pflag.String("kustomize-image", "quay.io/kohlstechnology/eunomia-kustomize:latest", "Template processor image of the GitOpsConfigs whose templateProcessorType is Kustomize and that don't set a templateProcessorImage")
+	templateProcessorImage := pflag.String("template-processor-image", "quay.io/kohlstechnology/eunomia-base:latest", "Template processor image of the GitOpsConfigs that don't set a templateProcessorImage, when their templateProcessorType doesn't have an image of its own")
+	requirePinnedImages := pflag.Bool("require-pinned-images", false, "Reject the template processor images that aren't pinned to a digest or to a tag other than latest, including the default images of the operator")
+	ownershipConflictPolicy := pflag.String("ownership-conflict-policy", "Warn", "What the jobs do with the resources already applied by another GitOpsConfig: Warn applies them and reports the conflict, Refuse fails the run before applying them")
+	deniedResourceKinds := pflag.StringSlice("denied-resource-kinds", nil, "Comma separated kinds of resources, optionally qualified by their group, e.g. ClusterRoleBinding.rbac.authorization.k8s.io, that no GitOpsConfig may apply")
+	notificationSecret := pflag.String("notification-secret", "", "Name of the Secret of the operator namespace holding in its url key the webhook notified when a job fails, for the GitOpsConfigs that don't set their notification, empty disables it")
+	notificationFormat := pflag.String("notification-format", "Slack", "Format of the notifications sent to the webhook of notification-secret: Slack, Teams or Generic")
+	notificationLogsURL := pflag.String("notification-logs-url", "", "URL of the logs of the failed jobs linked from the notifications, where {namespace} and {job} are replaced by the namespace and the name of the job, empty tells the kubectl command reading them")
+	jobHistoryLimit := pflag.Int("job-history-limit", 3, "Most recent finished jobs of each GitOpsConfig kept when the operator deletes the jobs whose jobTemplate.ttlSecondsAfterFinished expired, in the clusters not supporting it")
+	gitHTTPProxy := pflag.String("git-http-proxy", os.Getenv("HTTP_PROXY"), "HTTP proxy the jobs clone the sources through when they don't set their own, defaults to the HTTP_PROXY of the operator")
+	gitHTTPSProxy := pflag.String("git-https-proxy", os.Getenv("HTTPS_PROXY"), "HTTPS proxy the jobs clone the sources through when they don't set their own, defaults to the HTTPS_PROXY of the operator")
+	gitNoProxy := pflag.String("git-no-proxy", os.Getenv("NO_PROXY"), "Comma separated hosts the jobs reach without git-http-proxy and git-https-proxy, the hosts of the cluster always being reached directly, defaults to the NO_PROXY of the operator")
+	webhookTLSCert := pflag.String("webhook-tls-cert", "", "Path of the PEM certificate served by the webhook server, reloaded when it changes, empty serves plain HTTP")
+	webhookTLSKey := pflag.String("webhook-tls-key", "", "Path of the PEM private key of the webhook-tls-cert certificate")
+	webhookRateLimit := pflag.Float64("webhook-rate-limit", 60, "Webhook calls per minute allowed to each sender, the GitOpsConfig of a /webhook/<namespace>/<name> path or the IP address of the caller, the calls above it being answered with 429, 0 disables the limit")
+	webhookBurst := pflag.Int("webhook-burst", 20, "Webhook calls allowed at once to each sender, above webhook-rate-limit")
+	webhookMaxPayloadSize := pflag.Int64("webhook-max-payload-size", 25<<20, "Largest webhook payload accepted in bytes, the larger ones being answered with 413, 0 accepts them all")
+	tracingEndpoint := pflag.String("tracing-endpoint", "", "Address, host:port, of the OpenCensus agent the traces of the webhook calls, reconciles and runs are exported to, e.g. the opencensus receiver of an OpenTelemetry Collector, empty disables tracing")
+	leaderElection := pflag.Bool("leader-election", os.Getenv("LEADER_ELECTION") != "false", "Elect a leader among the replicas of the operator, only the leader reconciling the GitOpsConfigs and watching their jobs, defaults to the LEADER_ELECTION of the operator, enabled unless it is false")
+	leaderElectionID := pflag.String("leader-election-id", "eunomia-leader", "Name of the ConfigMap holding the lease of the leader of the replicas of the operator")
+	leaderElectionNamespace := pflag.String("leader-election-namespace", "", "Namespace of the leader-election-id ConfigMap, empty means the operator namespace")
+	logFormat := pflag.String("log-format", os.Getenv("LOG_FORMAT"), "Format of the logs of the operator, json or text, defaults to the LOG_FORMAT of the operator, empty keeps the zap-encoder")
+
 	pflag.Parse()
 
 	// Use a zap logr.Logger implementation. If none of the zap
 	// flags are configured (or if the zap flag set is not being
-	// used), this defaults to a production zap logger.
+	// used), this defaults to a production zap logger. --log-format
+	// switches its encoder between JSON and plain text.
 	//
 	// The logger instantiated here can be changed to any logger
 	// implementing the logr.Logger interface. This logger will
 	// be propagated through the whole operator, generating
 	// uniform and structured logs.
-	logf.SetLogger(zap.Logger())
+	logger, err := newLogger(*logFormat, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logf.SetLogger(logger)
+
+	// the orphans command lists the orphaned resources and exits, instead of running the operator
+	if pflag.Arg(0) == "orphans" {
+		os.Exit(listOrphans(*deleteOrphans))
+	}
 
 	printVersion()
 
@@ -97,28 +167,131 @@ func main() {
 	}
 	util.InitializeTemplates(jt, cjt)
 	log.Info("Templates initialized correctly")
-
-	// Get a config to talk to the apiserver
-	cfg, err := config.GetConfig()
+	if err := util.SetDefaultImagePullPolicy(corev1.PullPolicy(*defaultImagePullPolicy)); err != nil {
+		log.Error(err, "Failed to set the default image pull policy")
+		os.Exit(1)
+	}
+	if err := util.SetDefaultJobResources(*jobRequests, *jobLimits); err != nil {
+		log.Error(err, "Failed to set the default job resources")
+		os.Exit(1)
+	}
+	if err := util.SetOwnershipConflictPolicy(*ownershipConflictPolicy); err != nil {
+		log.Error(err, "Failed to set the ownership conflict policy")
+		os.Exit(1)
+	}
+	util.SetJobProxy(util.Proxy{HTTPProxy: *gitHTTPProxy, HTTPSProxy: *gitHTTPSProxy, NOProxy: *gitNoProxy})
+	if *readOnly {
+		util.SetReadOnly(true)
+		log.Info("Running in read-only mode, the resources of the GitOpsConfigs won't be modified")
+	}
+	stopTracing, err := tracing.Start(*tracingEndpoint)
 	if err != nil {
-		log.Error(err, "")
+		log.Error(err, "Failed to start tracing")
 		os.Exit(1)
 	}
 
-	ctx := context.TODO()
+	gitopsconfig.SetStartupQuietWindow(*startupQuietWindow)
+	gitopsconfig.SetRemotePollInterval(*remotePollInterval)
+	gitopsconfig.SetJobStuckTimeout(*jobStuckTimeout)
+	gitopsconfig.SetShutdownGracePeriod(*shutdownGracePeriod)
+	gitopsconfig.SetNotificationLogsURL(*notificationLogsURL)
+	gitopsconfig.SetDependencyWaitMaxDelay(*dependencyWaitMaxDelay)
+	gitopsconfig.SetResyncOnSecretChange(*resyncOnSecretChange)
+	gitopsconfig.SetJobWatchNamespaces(*jobWatchNamespaces)
+	gitopsconfig.SetJobEventWorkers(*jobEventWorkers)
+	gitopsconfig.SetMaxConcurrentJobs(*maxConcurrentJobs)
+	gitopsconfig.SetMaxSyncEventSubscribers(*syncEventsMaxSubscribers)
+	gitopsconfig.SetJobHistoryLimit(*jobHistoryLimit)
+	gitopsconfig.SetHelmImage(*helmImage)
+	gitopsconfig.SetKustomizeImage(*kustomizeImage)
+	gitopsconfig.SetJsonnetImage(*jsonnetImage)
+	gitopsconfig.SetTemplateProcessorImage(*templateProcessorImage)
+	gitopsconfig.SetRequirePinnedImages(*requirePinnedImages)
+	util.SetDeniedResourceKinds(*deniedResourceKinds)
+	gitopsconfig.SetEventRateLimit(*eventRateLimit, *eventBurst)
+
+	// initialize the verification of the template processor images, if any
+	if *imageSignatureKey != "" || *imageSignatureIdentity != "" || *imageSignatureIssuer != "" {
+		verifier, err := signature.NewVerifier(signature.Options{
+			Key:      *imageSignatureKey,
+			Identity: *imageSignatureIdentity,
+			Issuer:   *imageSignatureIssuer,
+		})
+		if err != nil {
+			log.Error(err, "Failed to initialize the image signature verification")
+			os.Exit(1)
+		}
+		// the signatures are fetched from the registry, the results are kept for the next jobs
+		gitopsconfig.SetImageVerifier(signature.NewCachingVerifier(verifier, 10*time.Minute))
+		log.Info("Template processor images must be signed")
+	}
+
+	// initialize the signer of the provenance attestations, if any
+	if *attestationKey != "" {
+		signer, err := attestation.NewSigner(*attestationKey)
+		if err != nil {
+			log.Error(err, "Failed to initialize the attestation signer")
+			os.Exit(1)
+		}
+		gitopsconfig.SetAttestationSigner(signer)
+		log.Info("The provenance of the successful jobs is attested")
+	}
+
+	// initialize the audit sink, if any
+	if uri, found := os.LookupEnv("AUDIT_SINK_URI"); found && uri != "" {
+		sink, err := audit.NewSink(uri)
+		if err != nil {
+			log.Error(err, "Failed to initialize audit sink", "uri", uri)
+			os.Exit(1)
+		}
+		gitopsconfig.SetAuditSink(sink)
+		log.Info("Audit sink initialized correctly", "uri", uri)
+	}
+
+	// job profiles and the kill switch are looked up in the operator namespace, which is only known when running in the cluster
+	if ns, err := k8sutil.GetOperatorNamespace(); err == nil {
+		gitopsconfig.SetJobProfileNamespace(ns)
+		if *suspendConfigMap != "" {
+			gitopsconfig.SetSuspendConfigMap(types.NamespacedName{Namespace: ns, Name: *suspendConfigMap})
+		}
+		if err := gitopsconfig.SetDefaultNotification(types.NamespacedName{Namespace: ns, Name: *notificationSecret}, *notificationFormat); err != nil {
+			log.Error(err, "Failed to initialize the notifications")
+			os.Exit(1)
+		}
+	} else {
+		log.Info("Job profiles, the kill switch and the default notifications are disabled, the operator namespace is unknown", "error", err.Error())
+	}
 
-	// Become the leader before proceeding
-	err = leader.Become(ctx, "eunomia-lock")
+	// Get a config to talk to the apiserver
+	cfg, err := config.GetConfig()
 	if err != nil {
 		log.Error(err, "")
 		os.Exit(1)
 	}
+	util.InitializeClientSettings(util.ClientSettings{
+		QPS:     *kubeAPIQPS,
+		Burst:   *kubeAPIBurst,
+		Timeout: *kubeAPITimeout,
+	})
+	util.ConfigureClient(cfg)
 
-	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{
+	options := manager.Options{
 		Namespace:          namespace,
 		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
-	})
+	}
+	// only the leader creates the jobs and reports their completion, the other replicas wait to take over
+	if *leaderElection {
+		if err := setLeaderElection(&options, *leaderElectionID, *leaderElectionNamespace, k8sutil.GetOperatorNamespace); err != nil {
+			log.Info("Skipping leader election, the operator namespace is unknown", "error", err.Error())
+		} else {
+			log.Info("Leader election enabled", "namespace", options.LeaderElectionNamespace, "configmap", options.LeaderElectionID)
+		}
+	} else {
+		log.Info("Leader election disabled, only run a single replica of the operator")
+	}
+
+	// Create a new Cmd to provide shared dependencies and start components
+	mgr, err := manager.New(cfg, options)
 	if err != nil {
 		log.Error(err, "")
 		os.Exit(1)
@@ -138,6 +311,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Look for orphaned resources periodically, if enabled
+	if *orphanSweepInterval > 0 {
+		finder, err := orphan.NewFinder(mgr.GetConfig(), mgr.GetClient())
+		if err != nil {
+			log.Error(err, "Failed to initialize the sweep of orphaned resources")
+			os.Exit(1)
+		}
+		if err := mgr.Add(&orphan.Sweeper{Finder: finder, Interval: *orphanSweepInterval, Delete: *deleteOrphans}); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+	}
+
 	// Create Service object to expose the metrics port.
 	// commented because service is generated via a manifest at deploy time.
 	// _, err = metrics.ExposeMetricsPort(ctx, metricsPort)
@@ -148,12 +334,52 @@ func main() {
 	// Set up WebHook listener
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook/", func(w http.ResponseWriter, r *http.Request) {
-		handler.WebhookHandler(w, r, gitopsconfig.NewGitOpsReconciler(mgr))
+	// the bursts of misconfigured senders would each start jobs
+	webhookLimiter := handler.NewWebhookLimiter(*webhookRateLimit, *webhookBurst, *webhookMaxPayloadSize)
+	mux.HandleFunc("/webhook/", webhookLimiter.Limit(func(w http.ResponseWriter, r *http.Request) {
+		reconciler := gitopsconfig.NewGitOpsReconciler(mgr)
+		handler.WebhookHandler(w, r, &reconciler)
+	}))
+
+	// the GitOpsConfigs are defaulted and validated when they are applied, the admission webhooks need the server to serve TLS
+	admissionReader, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		log.Error(err, "Failed to create the client of the admission webhook")
+		os.Exit(1)
+	}
+	mux.HandleFunc(handler.AdmissionPath, func(w http.ResponseWriter, r *http.Request) {
+		handler.AdmissionHandler(w, r, admissionReader)
+	})
+	mux.HandleFunc(handler.DefaultingPath, handler.DefaultingHandler)
+	// the API server converts the GitOpsConfigs between the versions it serves with the conversion webhook, if enabled on the CRD
+	mux.HandleFunc(handler.ConversionPath, handler.ConversionHandler)
+	mux.HandleFunc(handler.HealthzPath, handler.HealthzHandler)
+	// the operator is ready once it can't miss the completion of a job anymore
+	mux.HandleFunc(handler.ReadyzPath, func(w http.ResponseWriter, r *http.Request) {
+		handler.ReadyzHandler(w, r, gitopsconfig.JobWatchSynced)
 	})
 
-	log.Info("Starting the Web Server")
-	go http.ListenAndServe(":8080", mux)
+	if *syncEventsMaxSubscribers > 0 {
+		// the sync events are the ones the job watch records, streaming them doesn't query the API server
+		mux.HandleFunc(handler.SyncEventsPath, func(w http.ResponseWriter, r *http.Request) {
+			handler.SyncEventsHandler(w, r, gitopsconfig.SubscribeSyncEvents)
+		})
+	}
+
+	server := &http.Server{Addr: ":8080", Handler: mux}
+	if *webhookTLSCert != "" || *webhookTLSKey != "" {
+		loader, err := handler.NewCertificateLoader(*webhookTLSCert, *webhookTLSKey)
+		if err != nil {
+			log.Error(err, "Failed to load the webhook certificate")
+			os.Exit(1)
+		}
+		server.TLSConfig = &tls.Config{GetCertificate: loader.GetCertificate}
+		log.Info("Starting the Web Server with TLS")
+		go server.ListenAndServeTLS("", "")
+	} else {
+		log.Info("Starting the Web Server")
+		go server.ListenAndServe()
+	}
 
 	log.Info("Starting the Cmd.")
 
@@ -162,4 +388,8 @@ func main() {
 		log.Error(err, "Manager exited non-zero")
 		os.Exit(1)
 	}
+	// the manager doesn't wait for its runnables, the completions of the jobs already received are still reported
+	log.Info("Draining the watch on jobs")
+	gitopsconfig.WaitForJobWatchDrained()
+	stopTracing()
 }
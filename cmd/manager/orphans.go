@@ -0,0 +1,74 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis"
+	"github.com/KohlsTechnology/eunomia/pkg/orphan"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// listOrphans prints the orphaned resources of the cluster, deleting them if
+// remove is set, and returns the exit code of the orphans command
+func listOrphans(remove bool) int {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Error(err, "")
+		return 1
+	}
+	s := runtime.NewScheme()
+	if err := apis.AddToScheme(s); err != nil {
+		log.Error(err, "")
+		return 1
+	}
+	configs, err := client.New(cfg, client.Options{Scheme: s})
+	if err != nil {
+		log.Error(err, "")
+		return 1
+	}
+	finder, err := orphan.NewFinder(cfg, configs)
+	if err != nil {
+		log.Error(err, "")
+		return 1
+	}
+	orphans, err := finder.Find()
+	if err != nil {
+		log.Error(err, "Failed to look for orphaned resources")
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "APIVERSION\tKIND\tNAMESPACE\tNAME\tREASON")
+	for _, orphan := range orphans {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", orphan.APIVersion, orphan.Kind, orphan.Namespace, orphan.Name, orphan.Reason)
+	}
+	w.Flush()
+
+	if remove && len(orphans) > 0 {
+		if err := finder.Delete(orphans); err != nil {
+			log.Error(err, "Failed to delete some orphaned resources")
+			return 1
+		}
+	}
+	return 0
+}
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -10,25 +11,310 @@ import (
 // GitConfig represents all the infomration necessary to
 type GitConfig struct {
 	//+kubebuilder:validation:Pattern=(^$|(((git|ssh|http(s)?)|(git@[\w\.]+))(:(//)?)([\w\.@\:/\-~]+)(\.git)(/)))?
-	URI        string `json:"uri,omitempty"`
-	Ref        string `json:"ref,omitempty"`
+	URI string `json:"uri,omitempty"`
+	Ref string `json:"ref,omitempty"`
+	// RefType tells what Ref is: a Branch, a Tag, or a SemVer range of tags, e.g. ">=1.4.0 <2.0.0", whose highest matching tag is deployed.
+	// SemVer is only valid for TemplateSource, with an http(s) URI. By default Ref is a branch, a tag or a commit, looked up like git clone
+	// +kubebuilder:validation:Enum=Branch,Tag,SemVer
+	RefType    string `json:"refType,omitempty"`
 	HTTPProxy  string `json:"httpProxy,omitempty"`
 	HTTPSProxy string `json:"httpsProxy,omitempty"`
 	NOProxy    string `json:"noProxy,omitempty"`
 	ContextDir string `json:"contextDir,omitempty"`
 	SecretRef  string `json:"secretRef,omitempty"`
+	// ContextDirs are directories of the repository rendered in order instead of ContextDir, and applied together by the same job, only valid for TemplateSource.
+	// A directory that fails to render fails the run before anything is applied, unless ContinueOnError is set
+	ContextDirs []string `json:"contextDirs,omitempty"`
+	// ContinueOnError applies the ContextDirs that rendered when others fail to render, instead of failing the run. The failed ones are reported in a
+	// ContextDirsFailed event and in the status, and the Prune ResourceDeletionMode doesn't delete any resource in such a run. Only valid with ContextDirs
+	ContinueOnError bool `json:"continueOnError,omitempty"`
+	// ExcludePatterns lists glob patterns of the files of ContextDir, or of each of ContextDirs, that aren't rendered, e.g. README files or CI
+	// configurations, only valid for TemplateSource. * and ? don't match a /, ** matches any number of directories, a pattern without a / matches
+	// a file or directory name at any depth, and a pattern matching a directory matches all its files
+	ExcludePatterns []string `json:"excludePatterns,omitempty"`
+	// IncludePatterns lists glob patterns of the files rendered, applied after ExcludePatterns: the files left that match none of them aren't
+	// rendered. All the files are rendered when it is empty. Only valid for TemplateSource
+	IncludePatterns []string `json:"includePatterns,omitempty"`
+	// ValuesFiles lists values files of the chart, relative to ContextDir or to each of ContextDirs, e.g. values-production.yaml, merged in order
+	// by helm, each one overriding the ones before it. The parameter file and the Set values of the Helm config override them all. A missing
+	// file fails the run. Only valid for TemplateSource, with the Helm templateProcessorType
+	ValuesFiles []string `json:"valuesFiles,omitempty"`
+	// ExternalSecretRef references git credentials kept in a cloud secret manager instead of a Kubernetes secret, it can't be used with SecretRef
+	ExternalSecretRef *ExternalSecretRef `json:"externalSecretRef,omitempty"`
+	// InsecureSkipTLSVerifyHosts lists the hosts, with their port if not 443, whose TLS certificate is not verified when cloning.
+	// When set, the certificates of all the other hosts are verified, even without SecretRef
+	InsecureSkipTLSVerifyHosts []string `json:"insecureSkipTLSVerifyHosts,omitempty"`
+	// Mirrors are read-only mirrors of URI, tried in order when URI can't be cloned because its host can't be reached.
+	// Authentication failures and missing repositories or refs don't fall back to the mirrors. They use the same proxies, and the same
+	// credentials unless MirrorSecretRefs gives them their own
+	Mirrors []string `json:"mirrors,omitempty"`
+	// MirrorSecretRefs references the secrets holding the git credentials of the Mirrors hosted where the ones of SecretRef or ExternalSecretRef
+	// aren't accepted, with the same keys as SecretRef
+	MirrorSecretRefs []MirrorSecretRef `json:"mirrorSecretRefs,omitempty"`
+	// FileName is the parameter file within ContextDir used by the template processor instead of its default one, only valid for ParameterSource.
+	// It is a Go template that can use the .Branch and .Repo of the push that triggered the run, e.g. params/{{ .Branch }}.yaml
+	FileName string `json:"fileName,omitempty"`
+	// KnownHosts lists the known_hosts lines of the SSH servers of URI and Mirrors, used with the ssh-privatekey of a SecretRef of type kubernetes.io/ssh-auth,
+	// in addition to the known_hosts key of the secret
+	KnownHosts []string `json:"knownHosts,omitempty"`
+	// InsecureIgnoreHostKey disables the verification of the SSH host keys, e.g. for an air-gapped internal git server. The host keys are verified by default
+	InsecureIgnoreHostKey bool `json:"insecureIgnoreHostKey,omitempty"`
+	// ValuesFrom lists ConfigMaps and Secrets, in the namespace of the jobs, and Vault secrets, whose values are merged into the parameter file, in order, only valid for ParameterSource
+	ValuesFrom []ValuesReference `json:"valuesFrom,omitempty"`
+	// ValuesPrecedence tells which values win when the parameter file and ValuesFrom set the same key, Git by default
+	// +kubebuilder:validation:Enum=Git,ValuesFrom
+	ValuesPrecedence string `json:"valuesPrecedence,omitempty"`
+	// CloneDepth is the number of commits of Ref fetched by the jobs, 1 by default for a shallow clone. 0 clones the whole history
+	// +kubebuilder:validation:Minimum=0
+	CloneDepth *int32 `json:"cloneDepth,omitempty"`
+	// SingleBranch fetches Ref alone, without the other branches and tags of the repository. Default is true
+	SingleBranch *bool `json:"singleBranch,omitempty"`
+}
+
+// MirrorSecretRef references the secret, in the namespace of the jobs, holding the git credentials of a mirror of a source
+type MirrorSecretRef struct {
+	// Mirror is the URI of the mirror, one of the Mirrors of the source
+	Mirror string `json:"mirror"`
+	// SecretRef is the name of the secret
+	SecretRef string `json:"secretRef"`
+}
+
+// ValuesReference references a ConfigMap, a Secret or a Vault secret holding parameter values. The keys of the ConfigMaps and
+// Secrets ending in .yaml or .yml hold YAML maps merged into the parameters, the other keys are parameters whose value is the content of the key
+type ValuesReference struct {
+	// Kind is the kind of the referenced object, ConfigMap, Secret or Vault
+	// +kubebuilder:validation:Enum=ConfigMap,Secret,Vault
+	Kind string `json:"kind"`
+	// Name is the name of the referenced ConfigMap or Secret
+	Name string `json:"name,omitempty"`
+	// Key is the only key of the object used, all its keys are used when empty
+	Key string `json:"key,omitempty"`
+	// Vault is the Vault secret read by the jobs when Kind is Vault
+	Vault *VaultValues `json:"vault,omitempty"`
+}
+
+// VaultValues references a secret of a HashiCorp Vault KV secrets engine, read by the jobs when they start, after logging in
+// with the Kubernetes auth method and the token of their service account. Its keys are parameters, its values are never stored in the cluster
+type VaultValues struct {
+	// Address is the URL of the Vault server, e.g. https://vault.example.com:8200
+	Address string `json:"address"`
+	// Role is the role of the Kubernetes auth method the jobs log in with
+	Role string `json:"role"`
+	// AuthMount is the path the Kubernetes auth method is enabled at. Default is kubernetes
+	AuthMount string `json:"authMount,omitempty"`
+	// Mount is the path the KV secrets engine is enabled at. Default is secret
+	Mount string `json:"mount,omitempty"`
+	// Path is the path of the secret in the KV secrets engine, e.g. my-app/prod
+	Path string `json:"path"`
+	// KVVersion is the version of the KV secrets engine, 1 or 2. Default is 2
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=2
+	KVVersion int `json:"kvVersion,omitempty"`
+}
+
+// ExternalSecretRef references a secret of a cloud secret manager, read by the job with the workload identity of its pod.
+// The secret is a JSON object mapping the names of the files of a git secret, e.g. .gitconfig or .git-credentials, to their content
+type ExternalSecretRef struct {
+	// Provider is the secret manager, AWS for AWS Secrets Manager or GCP for Google Secret Manager
+	// +kubebuilder:validation:Enum=AWS,GCP
+	Provider string `json:"provider"`
+	// Path is the name or ARN of the AWS secret, or the projects/<project>/secrets/<secret> name of the GCP secret, optionally followed by /versions/<version>
+	Path string `json:"path"`
+}
+
+// CABundleReference references the key of a ConfigMap or a Secret, in the namespace of the jobs, holding the PEM certificates of certificate
+// authorities
+type CABundleReference struct {
+	// Kind is the kind of the referenced object, ConfigMap or Secret
+	// +kubebuilder:validation:Enum=ConfigMap,Secret
+	Kind string `json:"kind"`
+	// Name is the name of the referenced ConfigMap or Secret
+	Name string `json:"name"`
+	// Key is the key of the object holding the certificates. Default is ca.crt
+	Key string `json:"key,omitempty"`
+}
+
+// TargetClusterReference references the key of a Secret, in the namespace of the jobs, holding the kubeconfig of a remote cluster
+type TargetClusterReference struct {
+	// SecretRef is the name of the Secret
+	SecretRef string `json:"secretRef"`
+	// Key is the key of the Secret holding the kubeconfig. Default is kubeconfig
+	Key string `json:"key,omitempty"`
+}
+
+// HelmConfig configures how the Helm template processor renders the chart of the TemplateSource, with helm template
+type HelmConfig struct {
+	// ReleaseName is the name of the release the chart is rendered for, .Release.Name in its templates. Default is the name of the GitOpsConfig
+	ReleaseName string `json:"releaseName,omitempty"`
+	// Namespace is the namespace the chart is rendered for, .Release.Namespace in its templates. Default is the namespace the resources are applied into
+	Namespace string `json:"namespace,omitempty"`
+	// Set lists key=value pairs passed to helm template with --set, overriding the values of the parameter file
+	Set []string `json:"set,omitempty"`
+}
+
+// KustomizeConfig configures how the Kustomize template processor builds the kustomization of the TemplateSource, with kustomize build
+type KustomizeConfig struct {
+	// Overlay is the directory of the kustomization built, relative to the ContextDir of the TemplateSource. Default is the ContextDir itself
+	Overlay string `json:"overlay,omitempty"`
+}
+
+// JsonnetConfig configures how the Jsonnet template processor evaluates the jsonnet program of the TemplateSource
+type JsonnetConfig struct {
+	// Entrypoint is the file evaluated, relative to the ContextDir of the TemplateSource. Default is main.jsonnet
+	Entrypoint string `json:"entrypoint,omitempty"`
+	// Variables is how the parameters are passed to the program, External for external variables read with std.extVar,
+	// TopLevel for top-level arguments of the function the entrypoint evaluates to. Default is External
+	// +kubebuilder:validation:Enum=External,TopLevel
+	Variables string `json:"variables,omitempty"`
 }
 
 // GitOpsTrigger represents a trigge, possible type values are change, periodic, webhook.
 // If token is used the object must be labeled with the following label: "gitops_config.eunomia.kohls.io/webhook_token: <token>"
 type GitOpsTrigger struct {
-	// Type supported types are Change, Periodic, Webhook
-	// +kubebuilder:validation:Enum=Change,Periodic,Webhook
+	// Type supported types are Change, Periodic, Time, Webhook. Time is the same as Periodic
+	// +kubebuilder:validation:Enum=Change,Periodic,Time,Webhook
 	Type string `json:"type,omitempty"`
-	// creon expression only valid with the Periodic type
+	// creon expression only valid with the Periodic and Time types
 	Cron string `json:"cron,omitempty"`
+	// Interval only valid with the Periodic and Time types, runs the configuration every interval instead of on a cron schedule. It must be a number of minutes dividing an hour, or of hours dividing a day, e.g. 15m or 6h
+	Interval *metav1.Duration `json:"interval,omitempty"`
 	// webhook secret only valid with webhook type
 	Secret string `json:"secret,omitempty"`
+	// SecretRef only valid with the Webhook type, references the key of a Secret, in the namespace of the GitOpsConfig, holding the webhook secret. It takes precedence over Secret
+	SecretRef *corev1.SecretKeySelector `json:"secretRef,omitempty"`
+	// AllowedAuthors only valid with the Webhook type, lists the GitHub logins and email addresses allowed to trigger a run by pushing. Pushes by anyone else are ignored. Empty allows everyone
+	AllowedAuthors []string `json:"allowedAuthors,omitempty"`
+	// PruneDeletedBranches only valid with the Webhook type, makes the deletion of a branch start a job deleting the resources applied for it, when the parameterSource fileName depends on the branch
+	PruneDeletedBranches bool `json:"pruneDeletedBranches,omitempty"`
+	// Generic only valid with the Webhook type, locates the pushed repository and ref in the payloads of the senders that aren't git providers. The calls to the path of the GitOpsConfig without a git provider header are read with it
+	Generic *GenericWebhook `json:"generic,omitempty"`
+}
+
+// GenericWebhook maps the fields of the JSON payloads in the generic webhook format to the push they notify. The paths are dot-separated field names and array indexes, e.g. build.sources.0.ref, with an optional leading $.
+type GenericWebhook struct {
+	// RepoPath is the path of the full name or URL of the pushed repository, repo by default
+	RepoPath string `json:"repoPath,omitempty"`
+	// RefPath is the path of the pushed ref, ref by default. A ref not starting with refs/ is taken as a branch name
+	RefPath string `json:"refPath,omitempty"`
+	// CommitPath is the path of the pushed commit, commit by default. The commit may be missing from the payloads
+	CommitPath string `json:"commitPath,omitempty"`
+}
+
+// MaintenanceWindow is a period of planned unavailability of the cluster
+type MaintenanceWindow struct {
+	Start metav1.Time `json:"start"`
+	End   metav1.Time `json:"end"`
+}
+
+// JobMetadata holds the metadata added to the jobs and cronjobs of a GitOpsConfig
+type JobMetadata struct {
+	// Labels are added to the jobs and cronjobs, except the labels set by Eunomia or the job controller
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the jobs and cronjobs, except the gitopsconfig.eunomia.kohls.io annotations
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NamespaceInventory is what the last successful job applied into a target namespace
+type NamespaceInventory struct {
+	Namespace string `json:"namespace"`
+	// Resources lists the applied resources, it may be truncated
+	Resources []string `json:"resources,omitempty"`
+	// ResourceCount is the number of applied resources
+	ResourceCount int `json:"resourceCount,omitempty"`
+}
+
+// ManagedResources summarizes the inventory of all the resources applied by the last successful job, which are listed in
+// a ConfigMap, one <apiVersion>/<kind> <namespace>/<name> per line, or <apiVersion>/<kind> <name> for the cluster-scoped ones
+type ManagedResources struct {
+	// Count is the number of applied resources
+	Count int `json:"count"`
+	// Hash is the SHA-256 hash of the sorted inventory, it changes whenever a resource is added or removed
+	Hash string `json:"hash"`
+	// ConfigMap is the ConfigMap of the namespace of the GitOpsConfig, owned by it, listing the resources in its resources key,
+	// or gzipped in its resources.gz binary key when the list is too large. Empty when the job couldn't write it
+	ConfigMap string `json:"configMap,omitempty"`
+}
+
+// TargetNamespaceResult is the result of the last job in one of its target namespaces
+type TargetNamespaceResult struct {
+	Namespace string `json:"namespace"`
+	// Result is Success when the resources were applied into the namespace, Failed otherwise
+	Result string `json:"result"`
+	// Job is the name of the job
+	Job string `json:"job"`
+}
+
+// DryRunResult is what a job run with DryRun would have changed
+type DryRunResult struct {
+	// Job is the name of the job
+	Job string `json:"job"`
+	// Time is when the job finished
+	Time metav1.Time `json:"time"`
+	// Commit is the hash of the template commit compared with the live resources
+	Commit string `json:"commit,omitempty"`
+	// Created is the number of resources that would have been created
+	Created int `json:"created"`
+	// Updated is the number of existing resources that would have been changed
+	Updated int `json:"updated"`
+	// Deleted is the number of resources that would have been deleted
+	Deleted int `json:"deleted"`
+}
+
+// SyncRecord is a finished sync of a GitOpsConfig
+type SyncRecord struct {
+	// Job is the name of the job
+	Job string `json:"job"`
+	// Time is when the sync finished, as seen by the operator
+	Time metav1.Time `json:"time"`
+	// Result is Success or Failed
+	Result string `json:"result"`
+	// Commit is the hash of the template commit applied by the sync, or the pushed commit it was started for, if known
+	Commit string `json:"commit,omitempty"`
+	// Duration is the time between the launch of the job and the end of the sync
+	Duration metav1.Duration `json:"duration,omitempty"`
+}
+
+// GitOpsConfigConditionType is the type of a condition of a GitOpsConfig
+type GitOpsConfigConditionType string
+
+const (
+	// ConditionSuspended is True while the operator-wide kill switch prevents the jobs of all the GitOpsConfigs from running, or while spec.suspend is set
+	ConditionSuspended GitOpsConfigConditionType = "Suspended"
+	// ConditionDegraded is True while the last job failed in a way that needs an action on the cluster, e.g. when the resources exceed a ResourceQuota, or while the pod of a job is stuck pending, e.g. unschedulable
+	ConditionDegraded GitOpsConfigConditionType = "Degraded"
+	// ConditionWaitingForDependency is True while a Secret or ConfigMap referenced by the GitOpsConfig doesn't exist, its runs are deferred until it does
+	ConditionWaitingForDependency GitOpsConfigConditionType = "WaitingForDependency"
+	// ConditionInvalidSecret is True while a Secret referenced by the GitOpsConfig can't be used to clone its sources, e.g. a kubernetes.io/ssh-auth Secret without ssh-privatekey
+	ConditionInvalidSecret GitOpsConfigConditionType = "InvalidSecret"
+	// ConditionMissingParameterValues is True while a ConfigMap or Secret of the valuesFrom of the parameter source, or its referenced key, doesn't exist
+	ConditionMissingParameterValues GitOpsConfigConditionType = "MissingParameterValues"
+	// ConditionSynced is True while the last finished job succeeded, False when it failed
+	ConditionSynced GitOpsConfigConditionType = "Synced"
+	// ConditionProgressing is True while a job of the GitOpsConfig is running, False once it finished
+	ConditionProgressing GitOpsConfigConditionType = "Progressing"
+	// ConditionCleanupFailed is True while the job deleting the resources of the GitOpsConfig being deleted failed, it is relaunched with a backoff
+	ConditionCleanupFailed GitOpsConfigConditionType = "CleanupFailed"
+	// ConditionQuarantined is True while the triggers of the GitOpsConfig don't start jobs after too many consecutive failed ones, until its spec changes, a sync is requested or a job succeeds
+	ConditionQuarantined GitOpsConfigConditionType = "Quarantined"
+	// ConditionTargetClusterUnreachable is True while the remote cluster of the TargetCluster can't be reached with its kubeconfig, its runs aren't started
+	ConditionTargetClusterUnreachable GitOpsConfigConditionType = "TargetClusterUnreachable"
+	// ConditionClusterUnavailable is True while the jobs of a GitOpsConfig with RetryClusterUnavailable can't reach the API server, they are relaunched with a backoff until a job succeeds or the retries are exhausted
+	ConditionClusterUnavailable GitOpsConfigConditionType = "ClusterUnavailable"
+)
+
+// GitOpsConfigCondition is an observation of the state of a GitOpsConfig
+// +k8s:openapi-gen=true
+type GitOpsConfigCondition struct {
+	// Type is the type of the condition
+	Type GitOpsConfigConditionType `json:"type"`
+	// Status is the status of the condition, one of True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+	// LastTransitionTime is the last time the status changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a CamelCase reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable description of the last transition
+	Message string `json:"message,omitempty"`
 }
 
 // GitOpsConfigSpec defines the desired state of GitOpsConfig
@@ -40,20 +326,223 @@ type GitOpsConfigSpec struct {
 
 	// TemplateSource is the location of the templated resources
 	TemplateSource GitConfig `json:"templateSource,omitempty"`
-	// ParameterSource is the location of the parameters, only contextDir is mandatory, if other filed are left blank they are assumed to be the same as ParameterSource
+	// ParameterSource is the location of the parameters, only contextDir is mandatory. A blank uri is assumed to be the same as TemplateSource, ref and secretRef are independent of TemplateSource and ref defaults to master
 	ParameterSource GitConfig `json:"parameterSource,omitempty"`
 	// Triggers is an array of triggers that will lanuch this configuration
 	Triggers []GitOpsTrigger `json:"triggers,omitempty"`
-	// ServiceAccountRef references to the service account under which the template engine job will run, it must exists in the namespace in which this CR is created
+	// ServiceAccountRef references to the service account under which the template engine job will run, it must exists in the namespace in which the jobs are created
 	ServiceAccountRef string `json:"serviceAccountRef,omitempty"`
+	// JobNamespace is the namespace where the jobs and the cronjob of the GitOpsConfig are created, with its service account and secrets. Default is the namespace of the GitOpsConfig. Another namespace must list the namespace of the GitOpsConfig in its gitopsconfig.eunomia.kohls.io/allowed-source-namespaces annotation
+	JobNamespace string `json:"jobNamespace,omitempty"`
 	// TemplateEngine, the gitops operator config map contains the list of available template engines, the value used here must exist in that list. Identity (i.e. no resource processing) is the default
 	TemplateProcessorImage string `json:"templateProcessorImage,omitempty"`
-	// ResourceHandlingMode represents how resource creation/update should be handled. Supported values are CreateOrMerge,CreateOrUpdate,Patch,None. Default is CreateOrMerge.
-	// +kubebuilder:validation:Enum=CreateOrMerge,CreateOrUpdate,Patch,None
+	// TemplateProcessorType is the kind of templates of the TemplateSource. Helm renders it as a Helm 3 chart, Kustomize builds it as a kustomization,
+	// Jsonnet evaluates it as a jsonnet program, with the Helm, Kustomize or Jsonnet image of the operator, set as TemplateProcessorImage when the
+	// GitOpsConfig is initialized if it is empty
+	// +kubebuilder:validation:Enum=Helm,Kustomize,Jsonnet
+	TemplateProcessorType string `json:"templateProcessorType,omitempty"`
+	// Helm configures how the chart of the TemplateSource is rendered by the Helm template processor
+	Helm *HelmConfig `json:"helm,omitempty"`
+	// Kustomize configures how the kustomization of the TemplateSource is built by the Kustomize template processor
+	Kustomize *KustomizeConfig `json:"kustomize,omitempty"`
+	// Jsonnet configures how the jsonnet program of the TemplateSource is evaluated by the Jsonnet template processor
+	Jsonnet *JsonnetConfig `json:"jsonnet,omitempty"`
+	// ImagePullPolicy is the pull policy of the template processor image. Default is the one of the operator, or Always for the latest or untagged images and IfNotPresent for the others
+	// +kubebuilder:validation:Enum=Always,IfNotPresent,Never
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// CABundle references the certificates of the certificate authorities the jobs trust in addition to the ones of the system, e.g. the private CA
+	// of an internal git server, when cloning the sources and reading parameter values over HTTPS. The TLS certificates of the git servers are then
+	// always verified, except for the insecureSkipTLSVerifyHosts of the sources
+	CABundle *CABundleReference `json:"caBundle,omitempty"`
+	// SourceMountPath is the absolute path of the volume of the template processor container where the sources are cloned, under templates and parameters, and the manifests rendered, under manifests. Default is /git
+	SourceMountPath string `json:"sourceMountPath,omitempty"`
+	// WorkingDir is the absolute working directory of the template processor container. Default is the one of the image
+	WorkingDir string `json:"workingDir,omitempty"`
+	// ResourceHandlingMode represents how resource creation/update should be handled. Supported values are CreateOrMerge,ServerSideApply,CreateOrUpdate,Patch,None. Default is CreateOrMerge.
+	// ServerSideApply applies the resources like CreateOrMerge, always with server-side apply
+	// +kubebuilder:validation:Enum=CreateOrMerge,ServerSideApply,CreateOrUpdate,Patch,None
 	ResourceHandlingMode string `json:"resourceHandlingMode,omitempty"`
-	// ResourceDeletionMode represents how resource deletion should be handled. Supported values are Retain,Delete,None. Default is Delete
-	// +kubebuilder:validation:Enum=Retain,Delete,None
+	// ResourceDeletionMode represents how resource deletion should be handled. Supported values are Retain,Delete,Prune,None. Default is Delete.
+	// Prune deletes the resources like Delete, and also the resources applied by the previous runs that the templates don't render anymore
+	// +kubebuilder:validation:Enum=Retain,Delete,Prune,None
 	ResourceDeletionMode string `json:"resourceDeletionMode,omitempty"`
+	// FieldValidation represents how unknown or duplicate fields in the manifests should be handled when they are applied. Supported values are Ignore,Warn,Strict. Default is Warn
+	// +kubebuilder:validation:Enum=Ignore,Warn,Strict
+	FieldValidation string `json:"fieldValidation,omitempty"`
+	// ServerSideApply applies the resources with server-side apply when ResourceHandlingMode is CreateOrMerge, like the ServerSideApply ResourceHandlingMode. The resources don't get the last-applied-configuration annotation, which can exceed the annotation size limit on large objects
+	ServerSideApply bool `json:"serverSideApply,omitempty"`
+	// ForceConflicts makes the apply take ownership of the fields managed by other tools or manual edits, instead of failing on conflicts. Conflicts only happen with server-side apply, i.e. with the ServerSideApply ResourceHandlingMode or the ServerSideApply field. This is dangerous, the resources concerned are listed in the status
+	ForceConflicts bool `json:"forceConflicts,omitempty"`
+	// AllowRecreate makes the resources whose apply fails because it changes immutable fields be deleted and created again when ResourceHandlingMode is CreateOrMerge or ServerSideApply. This is destructive, the resources concerned are listed in the status.
+	// Without it, only the resources with the gitopsconfig.eunomia.kohls.io/allow-recreate annotation set to "true" are recreated
+	AllowRecreate bool `json:"allowRecreate,omitempty"`
+	// ApplyBatchSize is the maximum number of objects applied at once when ResourceHandlingMode is CreateOrMerge or ServerSideApply. The batches are applied in the order of the manifests. Default is 0, applying all the objects at once
+	// +kubebuilder:validation:Minimum=0
+	ApplyBatchSize int32 `json:"applyBatchSize,omitempty"`
+	// SkipUnchanged makes the jobs apply only the objects whose rendered content changed since they were last applied. The hash of each object is stored in its gitopsconfig.eunomia.kohls.io/applied-hash annotation, the objects whose live annotation matches it being skipped. This reduces the load on the API server and the audit volume, but the changes made to the live objects by other tools aren't reverted until their manifests change
+	SkipUnchanged bool `json:"skipUnchanged,omitempty"`
+	// CRDGracePeriod is how long the jobs wait, once the CustomResourceDefinitions of the manifests are Established, before applying the other resources, when ResourceHandlingMode is CreateOrMerge or ServerSideApply. The CustomResourceDefinitions are always applied first. Default is 0, not waiting
+	CRDGracePeriod metav1.Duration `json:"crdGracePeriod,omitempty"`
+	// CRDApplyRetries is the number of times the apply of the resources is retried, CRDGracePeriod apart or 5s when unset, while it fails because the kinds of their CustomResourceDefinitions aren't served yet. Default is 0, not retrying
+	// +kubebuilder:validation:Minimum=0
+	CRDApplyRetries int32 `json:"crdApplyRetries,omitempty"`
+	// SyncWaveTimeout is how long the jobs wait for the resources of a sync wave to be ready, once applied, before applying the next wave, when ResourceHandlingMode is CreateOrMerge or ServerSideApply. The waves are set with the gitopsconfig.eunomia.kohls.io/sync-wave annotation of the resources. Default is 5m
+	SyncWaveTimeout *metav1.Duration `json:"syncWaveTimeout,omitempty"`
+	// QuotaPreflight makes the jobs check, before applying anything, that the rendered resources fit in the ResourceQuotas of the target namespaces. A job whose resources don't fit fails without applying any, and the Degraded condition is set with the QuotaExceeded reason
+	QuotaPreflight bool `json:"quotaPreflight,omitempty"`
+	// DryRun makes the jobs only render the manifests and compare them with the live resources, without modifying any. The changes a real run would make are summarized in status.lastDryRun and the diff is written in the logs of the job
+	DryRun bool `json:"dryRun,omitempty"`
+	// MinRunInterval is the minimum time between two runs started by the Change or Webhook triggers. Triggers received within this interval after a run, including the runs of the scheduled triggers, are coalesced into a single run at the end of the interval
+	MinRunInterval metav1.Duration `json:"minRunInterval,omitempty"`
+	// ConcurrencyPolicy is what a run started by the Change or Webhook triggers does while a job of this configuration is still active. Supported values are Allow,Forbid,Replace. Default is Allow, running the jobs concurrently. Forbid queues the run until the active jobs complete, Replace deletes them before starting the run. It is also the concurrencyPolicy of the CronJob of the Periodic trigger
+	// +kubebuilder:validation:Enum=Allow,Forbid,Replace
+	ConcurrencyPolicy string `json:"concurrencyPolicy,omitempty"`
+	// RetryableExitCodes lists the exit codes of the template processor that denote a transient failure. When set, failed jobs are retried only if they exited with one of these codes, otherwise they are retried regardless of the failure cause
+	RetryableExitCodes []int32 `json:"retryableExitCodes,omitempty"`
+	// JobProfile is the name of a ConfigMap in the operator namespace holding a partial JobSpec under the jobSpec key. It is the base of the jobs of this configuration, the settings of the configuration override it
+	JobProfile string `json:"jobProfile,omitempty"`
+	// RetryClusterUnavailable makes the jobs failing because the API server cannot be reached be reported as ClusterUnavailable instead of failed, and retried with their own backoff
+	RetryClusterUnavailable bool `json:"retryClusterUnavailable,omitempty"`
+	// MaintenanceWindows are the periods during which job failures are reported with Normal events instead of Warning ones, so that they don't raise alerts
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// PauseAfterFailures pauses the configuration after this number of consecutive failed jobs, once their retries are exhausted. A paused configuration runs no job until the gitopsconfig.eunomia.kohls.io/paused annotation is removed. Default is 0, never pausing
+	// +kubebuilder:validation:Minimum=0
+	PauseAfterFailures int32 `json:"pauseAfterFailures,omitempty"`
+	// QuarantineAfterFailures quarantines the configuration after this number of consecutive failed jobs, once their retries are exhausted. The triggers of a quarantined configuration start no job until its spec changes or a sync is requested with the gitopsconfig.eunomia.kohls.io/sync annotation, a successful job ending the quarantine. Default is 0, never quarantining
+	// +kubebuilder:validation:Minimum=0
+	QuarantineAfterFailures int32 `json:"quarantineAfterFailures,omitempty"`
+	// Suspend stops the configuration from running new jobs, whatever their trigger, until it is set back to false. The resources already deployed are left untouched and the running job is allowed to finish. Default is false
+	Suspend bool `json:"suspend,omitempty"`
+	// JobMetadata is the labels and annotations added to the jobs and cronjobs created for this configuration, e.g. for chargeback. They don't override the ones Eunomia relies on
+	JobMetadata JobMetadata `json:"jobMetadata,omitempty"`
+	// TargetNamespaces are the namespaces the resources are applied into, instead of the namespace of the configuration. The templates are rendered for each of them, with the namespace in the NAMESPACE parameter. The resources of the namespaces removed from the list are deleted
+	TargetNamespaces []string `json:"targetNamespaces,omitempty"`
+	// TargetNamespaceSelector selects the namespaces, by their labels, the resources are applied into, on top of the TargetNamespaces. The namespaces are looked up when a job or cronjob is created, a namespace starting or stopping to match triggers a new run, and the resources of the namespaces that don't match anymore are deleted like those removed from TargetNamespaces
+	TargetNamespaceSelector *metav1.LabelSelector `json:"targetNamespaceSelector,omitempty"`
+	// TargetCluster references the kubeconfig of the remote cluster the jobs apply the resources into, instead of the cluster they run in. The GitOpsConfig, its jobs, its status and its events stay in the local cluster. It can't be used with TargetNamespaceSelector, whose namespaces are looked up in the local cluster
+	TargetCluster *TargetClusterReference `json:"targetCluster,omitempty"`
+	// PrunePolicy is the order in which the resources are applied and the resources removed or renamed in the manifests, like the ones of the namespaces removed from TargetNamespaces, are deleted. Supported values are ApplyThenPrune,PruneThenApply. Default is ApplyThenPrune, PruneThenApply is needed when the new resources conflict with the old ones, e.g. on cluster-wide names or hosts
+	// +kubebuilder:validation:Enum=ApplyThenPrune,PruneThenApply
+	PrunePolicy string `json:"prunePolicy,omitempty"`
+	// PruneBlocklist are the kinds of resources never deleted by the jobs, e.g. PersistentVolumeClaim to keep their data, even when they aren't rendered anymore. A kind can be qualified by its group, e.g. StatefulSet.apps. The resources skipped are reported in a PruneSkipped event
+	PruneBlocklist []string `json:"pruneBlocklist,omitempty"`
+	// PruneAllowlist are the only kinds of resources deleted by the jobs when it is set, in the same format as PruneBlocklist, which takes precedence
+	PruneAllowlist []string `json:"pruneAllowlist,omitempty"`
+	// AllowedResourceKinds are the only kinds of resources the jobs apply when it is set, in the same format as PruneBlocklist. The rendered resources of the other kinds are neither applied nor deleted, and are reported in a ResourceSkipped event
+	AllowedResourceKinds []string `json:"allowedResourceKinds,omitempty"`
+	// DeniedResourceKinds are the kinds of resources the jobs never apply, in the same format as PruneBlocklist. It takes precedence over AllowedResourceKinds, the kinds denied by the operator being added to it
+	DeniedResourceKinds []string `json:"deniedResourceKinds,omitempty"`
+	// PruneClusterResources makes the Prune ResourceDeletionMode also delete the cluster-scoped resources, e.g. ClusterRoles, that the templates don't render anymore. Only the namespaced ones are deleted by default
+	PruneClusterResources bool `json:"pruneClusterResources,omitempty"`
+	// JobNameTemplate is the Go template of the names of the jobs, with the .Name of the configuration, the short .Commit hash of the pushed commit, empty for runs not triggered by a push, and the UTC .Timestamp of the job. A random suffix is always appended, the result being truncated to fit in 63 characters. Default is gitopsconfig-{{ .Name }}{{ with .Commit }}-{{ . }}{{ end }}
+	JobNameTemplate string `json:"jobNameTemplate,omitempty"`
+	// EmptyRenderPolicy is what a run does when the templates render no resource, e.g. because of a templating condition or an empty repository. Supported values are Fail,Ignore,Prune. Default is Fail, so that a broken render doesn't delete the resources. Ignore leaves the resources as they are, Prune deletes all the resources managed by the configuration
+	// +kubebuilder:validation:Enum=Fail,Ignore,Prune
+	EmptyRenderPolicy string `json:"emptyRenderPolicy,omitempty"`
+	// Canary applies the changes to a subset of the resources first, the other ones are only applied once the canary is healthy
+	Canary *Canary `json:"canary,omitempty"`
+	// JobTemplate bounds the jobs run for this configuration, including the ones of its cronjob, so that a hung template processor doesn't block the next runs
+	JobTemplate *JobTemplate `json:"jobTemplate,omitempty"`
+	// Notification is the webhook notified when a job of this configuration fails, e.g. a Slack channel. Default is the webhook configured on the operator, if any
+	Notification *Notification `json:"notification,omitempty"`
+	// Notifications tunes the events the job watch records on this configuration
+	Notifications *EventNotifications `json:"notifications,omitempty"`
+	// Hooks are the jobs run around the syncs of this configuration, e.g. to validate the applied resources
+	Hooks *GitOpsHooks `json:"hooks,omitempty"`
+}
+
+// GitOpsHooks are the jobs run by the operator around the syncs of a GitOpsConfig
+type GitOpsHooks struct {
+	// PostSync runs once the resources are applied. The sync is only reported successful, with the JobSuccessful event, once it succeeds; its failure fails the sync with a PostSyncFailed event
+	PostSync *HookJob `json:"postSync,omitempty"`
+}
+
+// HookJob is the container run by the job of a hook, in the job namespace with the service account of the GitOpsConfig.
+// It gets the name of the GitOpsConfig in GITOPSCONFIG, the name of the sync job in SYNC_JOB and the applied commit, if known, in COMMIT
+type HookJob struct {
+	// Image is the image of the container, e.g. quay.io/example/smoke-tests:v1
+	Image string `json:"image"`
+	// Command overrides the entrypoint of the image
+	Command []string `json:"command,omitempty"`
+	// Args are the arguments of the command
+	Args []string `json:"args,omitempty"`
+	// Env are the environment variables of the container, on top of the ones set by the operator
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// ActiveDeadlineSeconds is how long the hook may run before it fails. Default is 600
+	// +kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// BackoffLimit is the number of times the pod of the hook is retried before it fails. Default is 0
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+}
+
+// Notification is the webhook receiving a message when a job of a GitOpsConfig fails
+type Notification struct {
+	// SecretRef is the Secret of the namespace of the GitOpsConfig holding the URL of the webhook in its url key
+	SecretRef string `json:"secretRef"`
+	// Format is the format of the messages: Slack, Teams or Generic, the JSON of the failure. Default is Slack
+	// +kubebuilder:validation:Enum=Slack,Teams,Generic
+	Format string `json:"format,omitempty"`
+}
+
+// EventNotifications tunes the events recorded on a GitOpsConfig when its jobs start and finish
+type EventNotifications struct {
+	// Suppress lists the reasons of the events that aren't recorded, e.g. JobFailed for a configuration whose failures are expected. The status and the metrics are still updated. Default is to record them all
+	Suppress []string `json:"suppress,omitempty"`
+}
+
+// JobTemplate holds the settings applied to the jobs run for a GitOpsConfig
+type JobTemplate struct {
+	// ActiveDeadlineSeconds is how long a job may be active before its pods are terminated and it fails with the DeadlineExceeded reason. Default is no deadline
+	// +kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// BackoffLimit is the number of times the pod of a job is retried before the job fails. It is ignored when RetryableExitCodes or RetryClusterUnavailable are set, the operator relaunching the failed jobs itself. Default is 4
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// TTLSecondsAfterFinished is how long a finished job is kept before it is deleted with its pods. When the cluster doesn't support it, the operator deletes the expired jobs, keeping the most recent ones. Default is keeping the jobs
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// Labels are added to the jobs and cronjobs and to the pods of the jobs, e.g. for the cost allocation or the network policies, except the labels set by Eunomia or the job controller. The JobMetadata labels take precedence
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to the jobs and cronjobs and to the pods of the jobs, except the gitopsconfig.eunomia.kohls.io annotations. The JobMetadata annotations take precedence
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Resources are the requests and limits of the template processor container, which clones the sources, renders and applies the manifests. The requests and limits it doesn't set default to the ones of the operator. Default is no requests or limits
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector is copied into the pod spec of the jobs, e.g. to run them on the nodes reserved for the operators
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations are copied into the pod spec of the jobs, e.g. to tolerate the taints of the nodes reserved for the operators
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity is copied into the pod spec of the jobs
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// Retry makes the jobs retry the applies failing with transient errors instead of failing the run. Default is not retrying
+	Retry *ApplyRetry `json:"retry,omitempty"`
+	// Parallelism is the maximum number of pods of a job applying their shards at the same time. Default is 1
+	// +kubebuilder:validation:Minimum=1
+	Parallelism *int32 `json:"parallelism,omitempty"`
+	// Completions is the number of shards the resources are split into, by hashing their group, kind and name, each shard being applied by its own pod of the job. The job succeeds once all the shards are applied. Default is 1, a single pod applying all the resources
+	// +kubebuilder:validation:Minimum=1
+	Completions *int32 `json:"completions,omitempty"`
+}
+
+// ApplyRetry is how the jobs retry the applies of the resources failing with transient errors: the API server throttling the requests (429), a conflict with a concurrent update of a resource or a timeout.
+// The other errors, e.g. invalid manifests, fail the run without being retried
+type ApplyRetry struct {
+	// MaxRetries is the number of times a failed apply is retried before the job fails
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries int32 `json:"maxRetries"`
+	// BaseDelay is how long the jobs wait before the first retry, the delay doubling before each of the next ones. Default is 1s
+	BaseDelay *metav1.Duration `json:"baseDelay,omitempty"`
+}
+
+// Canary is the subset of the resources applied first by the jobs, and the health gate it must pass before the other resources are applied.
+// The canary is the resources matching Selector in the Namespaces, all the resources of the Namespaces without Selector
+type Canary struct {
+	// Namespaces are the TargetNamespaces applied first, all of them when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Selector selects the resources applied first by their labels, with equality requirements separated by commas, e.g. track=canary
+	Selector string `json:"selector,omitempty"`
+	// HealthTimeout is how long the Deployments, StatefulSets and DaemonSets of the canary have to be rolled out before the rollout is aborted. Default is 5m
+	HealthTimeout *metav1.Duration `json:"healthTimeout,omitempty"`
 }
 
 // GitOpsConfigStatus defines the observed state of GitOpsConfig
@@ -62,6 +551,70 @@ type GitOpsConfigStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book.kubebuilder.io/beyond_basics/generating_crd.html
+
+	// LastAppliedCommitMessage is the subject line of the template commit applied by the last successful job, truncated if too long
+	LastAppliedCommitMessage string `json:"lastAppliedCommitMessage,omitempty"`
+	// ForceAppliedResources lists the resources the last successful job took ownership of by forcing conflicts
+	ForceAppliedResources []string `json:"forceAppliedResources,omitempty"`
+	// LastAppliedCommit is the hash of the template commit applied by the last successful job
+	LastAppliedCommit string `json:"lastAppliedCommit,omitempty"`
+	// AvailableCommit is the commit the template source ref points to in the remote repository, as last polled by the
+	// operator. It differs from LastAppliedCommit while the applied resources are behind the repository
+	AvailableCommit string `json:"availableCommit,omitempty"`
+	// ResolvedRef is the tag the SemVer range of the template source resolved to for the last run
+	ResolvedRef string `json:"resolvedRef,omitempty"`
+	// LastAppliedParameterCommit is the hash of the parameter commit applied by the last successful job
+	LastAppliedParameterCommit string `json:"lastAppliedParameterCommit,omitempty"`
+	// InputsHash is the hash of the render inputs known to the operator: the spec fields that change the rendered
+	// manifests, the resolved parameter file and the last applied template and parameter commits
+	InputsHash string `json:"inputsHash,omitempty"`
+	// LastAppliedInputsHash is the InputsHash of the render inputs of the last successful job. When it equals
+	// InputsHash, running again would render the same manifests from the same commits
+	LastAppliedInputsHash string `json:"lastAppliedInputsHash,omitempty"`
+	// DriftedResources lists the resources found modified outside of git by the last successful job
+	DriftedResources []string `json:"driftedResources,omitempty"`
+	// RecreatedResources lists the resources the last successful job deleted and created again because of changes to immutable fields
+	RecreatedResources []string `json:"recreatedResources,omitempty"`
+	// WebhookSecretFingerprint identifies the secret of the Webhook trigger, it is a prefix of its SHA-256 hash
+	WebhookSecretFingerprint string `json:"webhookSecretFingerprint,omitempty"`
+	// ConsecutiveFailures is the number of jobs that failed since the last successful one, or since the configuration was resumed
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+	// QuarantinedGeneration is the generation of the spec of the configuration when it was quarantined, while the Quarantined condition is True. A newer generation ends the quarantine
+	QuarantinedGeneration int64 `json:"quarantinedGeneration,omitempty"`
+	// LastSyncRequest is the value of the gitopsconfig.eunomia.kohls.io/sync annotation the last requested run was started for
+	LastSyncRequest string `json:"lastSyncRequest,omitempty"`
+	// ParameterFile is the parameter file, resolved from ParameterSource.FileName, used by the last job applying the resources. Delete jobs use it too
+	ParameterFile string `json:"parameterFile,omitempty"`
+	// LastSyncDuration is the time the GitOpsConfig spent in the Progressing condition until its last finished job completed, successful or not, as seen by the operator
+	LastSyncDuration metav1.Duration `json:"lastSyncDuration,omitempty"`
+	// LastSyncTime is when the operator saw the last finished job complete, successfully or not
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastSyncResult is the result of the last finished job, Success or Failed
+	LastSyncResult string `json:"lastSyncResult,omitempty"`
+	// LastSyncJob is the name of the last finished job
+	LastSyncJob string `json:"lastSyncJob,omitempty"`
+	// LastSyncImageID is the template processor image the last finished job ran, resolved to its digest by the container runtime, e.g. quay.io/kohlstechnology/eunomia-base@sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2
+	LastSyncImageID string `json:"lastSyncImageID,omitempty"`
+	// LastErrorMessage is the tail of the logs of the failed pod of the last failed job, truncated to 2KiB, empty once a job succeeds or when the logs aren't available anymore
+	LastErrorMessage string `json:"lastErrorMessage,omitempty"`
+	// TemplateSourceMirror is the mirror the template source was cloned from by the last successful job, empty when it was cloned from its URI
+	TemplateSourceMirror string `json:"templateSourceMirror,omitempty"`
+	// ParameterSourceMirror is the mirror the parameter source was cloned from by the last successful job, empty when it was cloned from its URI
+	ParameterSourceMirror string `json:"parameterSourceMirror,omitempty"`
+	// FailedContextDirs are the ContextDirs of the TemplateSource that failed to render in the last successful job, with ContinueOnError
+	FailedContextDirs []string `json:"failedContextDirs,omitempty"`
+	// Inventory is what the last successful job applied into each of the TargetNamespaces
+	Inventory []NamespaceInventory `json:"inventory,omitempty"`
+	// ManagedResources summarizes the inventory of all the resources applied by the last successful job, kept by the dry runs
+	ManagedResources *ManagedResources `json:"managedResources,omitempty"`
+	// TargetNamespaces is the result of the last job that got to apply the resources in each of its target namespaces. A namespace failing doesn't stop the resources from being applied into the other ones
+	TargetNamespaces []TargetNamespaceResult `json:"targetNamespaces,omitempty"`
+	// LastDryRun summarizes what the last successful job run with DryRun would have changed
+	LastDryRun *DryRunResult `json:"lastDryRun,omitempty"`
+	// History lists the last finished syncs, the most recent first, up to 10
+	History []SyncRecord `json:"history,omitempty"`
+	// Conditions are the latest observations of the state of the configuration
+	Conditions []GitOpsConfigCondition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -69,6 +622,13 @@ type GitOpsConfigStatus struct {
 // GitOpsConfig is the Schema for the gitopsconfigs API
 // +k8s:openapi-gen=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Synced')].status",description="Whether the last finished job succeeded"
+// +kubebuilder:printcolumn:name="Progressing",type="string",JSONPath=".status.conditions[?(@.type=='Progressing')].status",description="Whether a job is running"
+// +kubebuilder:printcolumn:name="Suspended",type="boolean",JSONPath=".spec.suspend",description="Whether new jobs are suspended"
+// +kubebuilder:printcolumn:name="Quarantined",type="string",JSONPath=".status.conditions[?(@.type=='Quarantined')].status",description="Whether the triggers are ignored after consecutive failed jobs"
+// +kubebuilder:printcolumn:name="Failures",type="integer",JSONPath=".status.consecutiveFailures",description="The number of consecutive failed jobs",priority=1
+// +kubebuilder:printcolumn:name="Last Sync",type="date",JSONPath=".status.lastSyncTime",description="When the last job finished"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type GitOpsConfig struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -13,9 +13,10 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
-		"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfig":       schema_pkg_apis_eunomia_v1alpha1_GitOpsConfig(ref),
-		"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfigSpec":   schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref),
-		"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfigStatus": schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigStatus(ref),
+		"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfig":          schema_pkg_apis_eunomia_v1alpha1_GitOpsConfig(ref),
+		"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfigCondition": schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigCondition(ref),
+		"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfigSpec":      schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref),
+		"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfigStatus":    schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigStatus(ref),
 	}
 }
 
@@ -62,6 +63,55 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfig(ref common.ReferenceCallback)
 	}
 }
 
+func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigCondition(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "GitOpsConfigCondition is an observation of the state of a GitOpsConfig",
+				Properties: map[string]spec.Schema{
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Type is the type of the condition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Status is the status of the condition, one of True, False or Unknown",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastTransitionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastTransitionTime is the last time the status changed",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"reason": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Reason is a CamelCase reason for the last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message is a human readable description of the last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"type", "status"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
 func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -76,7 +126,7 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref common.ReferenceCallb
 					},
 					"parameterSource": {
 						SchemaProps: spec.SchemaProps{
-							Description: "ParameterSource is the location of the parameters, only contextDir is mandatory, if other filed are left blank they are assumed to be the same as ParameterSource",
+							Description: "ParameterSource is the location of the parameters, only contextDir is mandatory. A blank uri is assumed to be the same as TemplateSource, ref and secretRef are independent of TemplateSource and ref defaults to master",
 							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitConfig"),
 						},
 					},
@@ -95,7 +145,14 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref common.ReferenceCallb
 					},
 					"serviceAccountRef": {
 						SchemaProps: spec.SchemaProps{
-							Description: "ServiceAccountRef references to the service account under which the template engine job will run, it must exists in the namespace in which this CR is created",
+							Description: "ServiceAccountRef references to the service account under which the template engine job will run, it must exists in the namespace in which the jobs are created",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"jobNamespace": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JobNamespace is the namespace where the jobs and the cronjob of the GitOpsConfig are created, with its service account and secrets. Default is the namespace of the GitOpsConfig. Another namespace must list the namespace of the GitOpsConfig in its gitopsconfig.eunomia.kohls.io/allowed-source-namespaces annotation",
 							Type:        []string{"string"},
 							Format:      "",
 						},
@@ -107,25 +164,373 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigSpec(ref common.ReferenceCallb
 							Format:      "",
 						},
 					},
+					"templateProcessorType": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TemplateProcessorType is the kind of templates of the TemplateSource. Helm renders it as a Helm 3 chart, Kustomize builds it as a kustomization, Jsonnet evaluates it as a jsonnet program, with the Helm, Kustomize or Jsonnet image of the operator, set as TemplateProcessorImage when the GitOpsConfig is initialized if it is empty",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"helm": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Helm configures how the chart of the TemplateSource is rendered by the Helm template processor",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.HelmConfig"),
+						},
+					},
+					"kustomize": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kustomize configures how the kustomization of the TemplateSource is built by the Kustomize template processor",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.KustomizeConfig"),
+						},
+					},
+					"jsonnet": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Jsonnet configures how the jsonnet program of the TemplateSource is evaluated by the Jsonnet template processor",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.JsonnetConfig"),
+						},
+					},
+					"imagePullPolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ImagePullPolicy is the pull policy of the template processor image. Default is the one of the operator, or Always for the latest or untagged images and IfNotPresent for the others",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"caBundle": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CABundle references the certificates of the certificate authorities the jobs trust in addition to the ones of the system, e.g. the private CA of an internal git server, when cloning the sources and reading parameter values over HTTPS. The TLS certificates of the git servers are then always verified, except for the insecureSkipTLSVerifyHosts of the sources",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.CABundleReference"),
+						},
+					},
+					"sourceMountPath": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SourceMountPath is the absolute path of the volume of the template processor container where the sources are cloned, under templates and parameters, and the manifests rendered, under manifests. Default is /git",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"workingDir": {
+						SchemaProps: spec.SchemaProps{
+							Description: "WorkingDir is the absolute working directory of the template processor container. Default is the one of the image",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"resourceHandlingMode": {
 						SchemaProps: spec.SchemaProps{
-							Description: "ResourceHandlingMode represents how resource creation/update should be handled. Supported values are CreateOrMerge,CreateOrUpdate,Patch,None. Default is CreateOrMerge.",
+							Description: "ResourceHandlingMode represents how resource creation/update should be handled. Supported values are CreateOrMerge,ServerSideApply,CreateOrUpdate,Patch,None. Default is CreateOrMerge. ServerSideApply applies the resources like CreateOrMerge, always with server-side apply",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
 					"resourceDeletionMode": {
 						SchemaProps: spec.SchemaProps{
-							Description: "ResourceDeletionMode represents how resource deletion should be handled. Supported values are Retain,Delete,None. Default is Delete",
+							Description: "ResourceDeletionMode represents how resource deletion should be handled. Supported values are Retain,Delete,Prune,None. Default is Delete. Prune deletes the resources like Delete, and also the resources applied by the previous runs that the templates don't render anymore",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"fieldValidation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FieldValidation represents how unknown or duplicate fields in the manifests should be handled when they are applied. Supported values are Ignore,Warn,Strict. Default is Warn",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"serverSideApply": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServerSideApply applies the resources with server-side apply when ResourceHandlingMode is CreateOrMerge, like the ServerSideApply ResourceHandlingMode. The resources don't get the last-applied-configuration annotation, which can exceed the annotation size limit on large objects",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"forceConflicts": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ForceConflicts makes the apply take ownership of the fields managed by other tools or manual edits, instead of failing on conflicts. Conflicts only happen with server-side apply, i.e. with the ServerSideApply ResourceHandlingMode or the ServerSideApply field. This is dangerous, the resources concerned are listed in the status",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"allowRecreate": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AllowRecreate makes the resources whose apply fails because it changes immutable fields be deleted and created again when ResourceHandlingMode is CreateOrMerge or ServerSideApply. This is destructive, the resources concerned are listed in the status. Without it, only the resources with the gitopsconfig.eunomia.kohls.io/allow-recreate annotation set to \"true\" are recreated",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"applyBatchSize": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ApplyBatchSize is the maximum number of objects applied at once when ResourceHandlingMode is CreateOrMerge or ServerSideApply. The batches are applied in the order of the manifests. Default is 0, applying all the objects at once",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"skipUnchanged": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SkipUnchanged makes the jobs apply only the objects whose rendered content changed since they were last applied. The hash of each object is stored in its gitopsconfig.eunomia.kohls.io/applied-hash annotation, the objects whose live annotation matches it being skipped. This reduces the load on the API server and the audit volume, but the changes made to the live objects by other tools aren't reverted until their manifests change",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"crdGracePeriod": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CRDGracePeriod is how long the jobs wait, once the CustomResourceDefinitions of the manifests are Established, before applying the other resources, when ResourceHandlingMode is CreateOrMerge or ServerSideApply. The CustomResourceDefinitions are always applied first. Default is 0, not waiting",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"crdApplyRetries": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CRDApplyRetries is the number of times the apply of the resources is retried, CRDGracePeriod apart or 5s when unset, while it fails because the kinds of their CustomResourceDefinitions aren't served yet. Default is 0, not retrying",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"syncWaveTimeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SyncWaveTimeout is how long the jobs wait for the resources of a sync wave to be ready, once applied, before applying the next wave, when ResourceHandlingMode is CreateOrMerge or ServerSideApply. The waves are set with the gitopsconfig.eunomia.kohls.io/sync-wave annotation of the resources. Default is 5m",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"quotaPreflight": {
+						SchemaProps: spec.SchemaProps{
+							Description: "QuotaPreflight makes the jobs check, before applying anything, that the rendered resources fit in the ResourceQuotas of the target namespaces. A job whose resources don't fit fails without applying any, and the Degraded condition is set with the QuotaExceeded reason",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"dryRun": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DryRun makes the jobs only render the manifests and compare them with the live resources, without modifying any. The changes a real run would make are summarized in status.lastDryRun and the diff is written in the logs of the job",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"minRunInterval": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MinRunInterval is the minimum time between two runs started by the Change or Webhook triggers. Triggers received within this interval after a run, including the runs of the scheduled triggers, are coalesced into a single run at the end of the interval",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"concurrencyPolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConcurrencyPolicy is what a run started by the Change or Webhook triggers does while a job of this configuration is still active. Supported values are Allow,Forbid,Replace. Default is Allow, running the jobs concurrently. Forbid queues the run until the active jobs complete, Replace deletes them before starting the run. It is also the concurrencyPolicy of the CronJob of the Periodic trigger",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"retryableExitCodes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RetryableExitCodes lists the exit codes of the template processor that denote a transient failure. When set, failed jobs are retried only if they exited with one of these codes, otherwise they are retried regardless of the failure cause",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"integer"},
+										Format: "int32",
+									},
+								},
+							},
+						},
+					},
+					"jobProfile": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JobProfile is the name of a ConfigMap in the operator namespace holding a partial JobSpec under the jobSpec key. It is the base of the jobs of this configuration, the settings of the configuration override it",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"retryClusterUnavailable": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RetryClusterUnavailable makes the jobs failing because the API server cannot be reached be reported as ClusterUnavailable instead of failed, and retried with their own backoff",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"maintenanceWindows": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MaintenanceWindows are the periods during which job failures are reported with Normal events instead of Warning ones, so that they don't raise alerts",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.MaintenanceWindow"),
+									},
+								},
+							},
+						},
+					},
+					"pauseAfterFailures": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PauseAfterFailures pauses the configuration after this number of consecutive failed jobs, once their retries are exhausted. A paused configuration runs no job until the gitopsconfig.eunomia.kohls.io/paused annotation is removed. Default is 0, never pausing",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"quarantineAfterFailures": {
+						SchemaProps: spec.SchemaProps{
+							Description: "QuarantineAfterFailures quarantines the configuration after this number of consecutive failed jobs, once their retries are exhausted. The triggers of a quarantined configuration start no job until its spec changes or a sync is requested with the gitopsconfig.eunomia.kohls.io/sync annotation, a successful job ending the quarantine. Default is 0, never quarantining",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"suspend": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Suspend stops the configuration from running new jobs, whatever their trigger, until it is set back to false. The resources already deployed are left untouched and the running job is allowed to finish. Default is false",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"jobMetadata": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JobMetadata is the labels and annotations added to the jobs and cronjobs created for this configuration, e.g. for chargeback. They don't override the ones Eunomia relies on",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.JobMetadata"),
+						},
+					},
+					"targetNamespaces": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TargetNamespaces are the namespaces the resources are applied into, instead of the namespace of the configuration. The templates are rendered for each of them, with the namespace in the NAMESPACE parameter. The resources of the namespaces removed from the list are deleted",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"targetNamespaceSelector": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TargetNamespaceSelector selects the namespaces, by their labels, the resources are applied into, on top of the TargetNamespaces. The namespaces are looked up when a job or cronjob is created, a namespace starting or stopping to match triggers a new run, and the resources of the namespaces that don't match anymore are deleted like those removed from TargetNamespaces",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"),
+						},
+					},
+					"targetCluster": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TargetCluster references the kubeconfig of the remote cluster the jobs apply the resources into, instead of the cluster they run in. The GitOpsConfig, its jobs, its status and its events stay in the local cluster. It can't be used with TargetNamespaceSelector, whose namespaces are looked up in the local cluster",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.TargetClusterReference"),
+						},
+					},
+					"prunePolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PrunePolicy is the order in which the resources are applied and the resources removed or renamed in the manifests, like the ones of the namespaces removed from TargetNamespaces, are deleted. Supported values are ApplyThenPrune,PruneThenApply. Default is ApplyThenPrune, PruneThenApply is needed when the new resources conflict with the old ones, e.g. on cluster-wide names or hosts",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"pruneBlocklist": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PruneBlocklist are the kinds of resources never deleted by the jobs, e.g. PersistentVolumeClaim to keep their data, even when they aren't rendered anymore. A kind can be qualified by its group, e.g. StatefulSet.apps. The resources skipped are reported in a PruneSkipped event",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"pruneAllowlist": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PruneAllowlist are the only kinds of resources deleted by the jobs when it is set, in the same format as PruneBlocklist, which takes precedence",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"allowedResourceKinds": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AllowedResourceKinds are the only kinds of resources the jobs apply when it is set, in the same format as PruneBlocklist. The rendered resources of the other kinds are neither applied nor deleted, and are reported in a ResourceSkipped event",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"deniedResourceKinds": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DeniedResourceKinds are the kinds of resources the jobs never apply, in the same format as PruneBlocklist. It takes precedence over AllowedResourceKinds, the kinds denied by the operator being added to it",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"pruneClusterResources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PruneClusterResources makes the Prune ResourceDeletionMode also delete the cluster-scoped resources, e.g. ClusterRoles, that the templates don't render anymore. Only the namespaced ones are deleted by default",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"jobNameTemplate": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JobNameTemplate is the Go template of the names of the jobs, with the .Name of the configuration, the short .Commit hash of the pushed commit, empty for runs not triggered by a push, and the UTC .Timestamp of the job. A random suffix is always appended, the result being truncated to fit in 63 characters. Default is gitopsconfig-{{ .Name }}{{ with .Commit }}-{{ . }}{{ end }}",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"emptyRenderPolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "EmptyRenderPolicy is what a run does when the templates render no resource, e.g. because of a templating condition or an empty repository. Supported values are Fail,Ignore,Prune. Default is Fail, so that a broken render doesn't delete the resources. Ignore leaves the resources as they are, Prune deletes all the resources managed by the configuration",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
+					"canary": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Canary applies the changes to a subset of the resources first, the other ones are only applied once the canary is healthy",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.Canary"),
+						},
+					},
+					"jobTemplate": {
+						SchemaProps: spec.SchemaProps{
+							Description: "JobTemplate bounds the jobs run for this configuration, including the ones of its cronjob, so that a hung template processor doesn't block the next runs",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.JobTemplate"),
+						},
+					},
+					"notification": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Notification is the webhook notified when a job of this configuration fails, e.g. a Slack channel. Default is the webhook configured on the operator, if any",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.Notification"),
+						},
+					},
+					"notifications": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Notifications tunes the events the job watch records on this configuration",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.EventNotifications"),
+						},
+					},
+					"hooks": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Hooks are the jobs run around the syncs of this configuration, e.g. to validate the applied resources",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsHooks"),
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitConfig", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsTrigger"},
+			"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.CABundleReference", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.Canary", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.EventNotifications", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitConfig", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsHooks", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsTrigger", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.HelmConfig", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.JobMetadata", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.JobTemplate", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.JsonnetConfig", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.KustomizeConfig", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.MaintenanceWindow", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.Notification", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.TargetClusterReference", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration", "k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"},
 	}
 }
 
@@ -134,9 +539,269 @@ func schema_pkg_apis_eunomia_v1alpha1_GitOpsConfigStatus(ref common.ReferenceCal
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
 				Description: "GitOpsConfigStatus defines the observed state of GitOpsConfig",
-				Properties:  map[string]spec.Schema{},
+				Properties: map[string]spec.Schema{
+					"lastAppliedCommitMessage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastAppliedCommitMessage is the subject line of the template commit applied by the last successful job, truncated if too long",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"forceAppliedResources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ForceAppliedResources lists the resources the last successful job took ownership of by forcing conflicts",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"lastAppliedCommit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastAppliedCommit is the hash of the template commit applied by the last successful job",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"availableCommit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AvailableCommit is the commit the template source ref points to in the remote repository, as last polled by the operator. It differs from LastAppliedCommit while the applied resources are behind the repository",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"resolvedRef": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ResolvedRef is the tag the SemVer range of the template source resolved to for the last run",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastAppliedParameterCommit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastAppliedParameterCommit is the hash of the parameter commit applied by the last successful job",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"inputsHash": {
+						SchemaProps: spec.SchemaProps{
+							Description: "InputsHash is the hash of the render inputs known to the operator: the spec fields that change the rendered manifests, the resolved parameter file and the last applied template and parameter commits",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastAppliedInputsHash": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastAppliedInputsHash is the InputsHash of the render inputs of the last successful job. When it equals InputsHash, running again would render the same manifests from the same commits",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"driftedResources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DriftedResources lists the resources found modified outside of git by the last successful job",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"recreatedResources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RecreatedResources lists the resources the last successful job deleted and created again because of changes to immutable fields",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"webhookSecretFingerprint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "WebhookSecretFingerprint identifies the secret of the Webhook trigger, it is a prefix of its SHA-256 hash",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"consecutiveFailures": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ConsecutiveFailures is the number of jobs that failed since the last successful one, or since the configuration was resumed",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"quarantinedGeneration": {
+						SchemaProps: spec.SchemaProps{
+							Description: "QuarantinedGeneration is the generation of the spec of the configuration when it was quarantined, while the Quarantined condition is True. A newer generation ends the quarantine",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"lastSyncRequest": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastSyncRequest is the value of the gitopsconfig.eunomia.kohls.io/sync annotation the last requested run was started for",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"parameterFile": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ParameterFile is the parameter file, resolved from ParameterSource.FileName, used by the last job applying the resources. Delete jobs use it too",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastSyncDuration": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastSyncDuration is the time the GitOpsConfig spent in the Progressing condition until its last finished job completed, successful or not, as seen by the operator",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"lastSyncTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastSyncTime is when the operator saw the last finished job complete, successfully or not",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"lastSyncResult": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastSyncResult is the result of the last finished job, Success or Failed",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastSyncJob": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastSyncJob is the name of the last finished job",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastSyncImageID": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastSyncImageID is the template processor image the last finished job ran, resolved to its digest by the container runtime, e.g. quay.io/kohlstechnology/eunomia-base@sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"lastErrorMessage": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastErrorMessage is the tail of the logs of the failed pod of the last failed job, truncated to 2KiB, empty once a job succeeds or when the logs aren't available anymore",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"templateSourceMirror": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TemplateSourceMirror is the mirror the template source was cloned from by the last successful job, empty when it was cloned from its URI",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"parameterSourceMirror": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ParameterSourceMirror is the mirror the parameter source was cloned from by the last successful job, empty when it was cloned from its URI",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"failedContextDirs": {
+						SchemaProps: spec.SchemaProps{
+							Description: "FailedContextDirs are the ContextDirs of the TemplateSource that failed to render in the last successful job, with ContinueOnError",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"inventory": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Inventory is what the last successful job applied into each of the TargetNamespaces",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.NamespaceInventory"),
+									},
+								},
+							},
+						},
+					},
+					"managedResources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ManagedResources summarizes the inventory of all the resources applied by the last successful job, kept by the dry runs",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.ManagedResources"),
+						},
+					},
+					"targetNamespaces": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TargetNamespaces is the result of the last job that got to apply the resources in each of its target namespaces. A namespace failing doesn't stop the resources from being applied into the other ones",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.TargetNamespaceResult"),
+									},
+								},
+							},
+						},
+					},
+					"lastDryRun": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastDryRun summarizes what the last successful job run with DryRun would have changed",
+							Ref:         ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.DryRunResult"),
+						},
+					},
+					"history": {
+						SchemaProps: spec.SchemaProps{
+							Description: "History lists the last finished syncs, the most recent first, up to 10",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.SyncRecord"),
+									},
+								},
+							},
+						},
+					},
+					"conditions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Conditions are the latest observations of the state of the configuration",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfigCondition"),
+									},
+								},
+							},
+						},
+					},
+				},
 			},
 		},
-		Dependencies: []string{},
+		Dependencies: []string{
+			"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.DryRunResult", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.GitOpsConfigCondition", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.ManagedResources", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.NamespaceInventory", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.SyncRecord", "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1.TargetNamespaceResult", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
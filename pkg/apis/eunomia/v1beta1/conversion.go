@@ -0,0 +1,96 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// TimeTriggersAnnotation lists the indexes of the triggers of a v1alpha1 GitOpsConfig whose type was Time, so that
+// they get it back when it is converted back to v1alpha1
+const TimeTriggersAnnotation = "eunomia.kohls.io/v1alpha1-time-triggers"
+
+// ConvertFrom sets dst to the v1beta1 version of src. The spec and status have the same fields in both versions,
+// except the Time triggers, which are Periodic ones in v1beta1.
+func (dst *GitOpsConfig) ConvertFrom(src *v1alpha1.GitOpsConfig) error {
+	dst.Spec, dst.Status = GitOpsConfigSpec{}, GitOpsConfigStatus{}
+	if err := convert(src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convert(src.Status, &dst.Status); err != nil {
+		return err
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.SetGroupVersionKind(SchemeGroupVersion.WithKind("GitOpsConfig"))
+	timeTriggers := []string{}
+	for i, trigger := range src.Spec.Triggers {
+		if trigger.Type == "Time" {
+			dst.Spec.Triggers[i].Type = TriggerPeriodic
+			timeTriggers = append(timeTriggers, strconv.Itoa(i))
+		}
+	}
+	if len(timeTriggers) > 0 {
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[TimeTriggersAnnotation] = strings.Join(timeTriggers, ",")
+	}
+	return nil
+}
+
+// ConvertTo sets dst to the v1alpha1 version of src, the Periodic triggers that were Time ones getting their type back
+func (src *GitOpsConfig) ConvertTo(dst *v1alpha1.GitOpsConfig) error {
+	dst.Spec, dst.Status = v1alpha1.GitOpsConfigSpec{}, v1alpha1.GitOpsConfigStatus{}
+	if err := convert(src.Spec, &dst.Spec); err != nil {
+		return err
+	}
+	if err := convert(src.Status, &dst.Status); err != nil {
+		return err
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.SetGroupVersionKind(v1alpha1.SchemeGroupVersion.WithKind("GitOpsConfig"))
+	timeTriggers, found := dst.Annotations[TimeTriggersAnnotation]
+	if !found {
+		return nil
+	}
+	delete(dst.Annotations, TimeTriggersAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	for _, index := range strings.Split(timeTriggers, ",") {
+		i, err := strconv.Atoi(index)
+		// the triggers edited since may not be there anymore, or not be Periodic ones
+		if err != nil || i < 0 || i >= len(dst.Spec.Triggers) || dst.Spec.Triggers[i].Type != string(TriggerPeriodic) {
+			continue
+		}
+		dst.Spec.Triggers[i].Type = "Time"
+	}
+	return nil
+}
+
+// convert sets out to the fields of in, their JSON being the same in both versions
+func convert(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
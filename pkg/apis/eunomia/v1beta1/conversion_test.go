@@ -0,0 +1,141 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	fuzz "github.com/google/gofuzz"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/diff"
+)
+
+// fuzzIterations is how many random GitOpsConfigs are converted back and forth
+const fuzzIterations = 200
+
+// conversionFuzzerFuncs restrict the random values to the ones that survive the JSON of the API server: times are
+// to the second, and the trigger types are the supported ones
+func conversionFuzzerFuncs(codecs runtimeserializer.CodecFactory) []interface{} {
+	return []interface{}{
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1000*365*24*60*60), 0)
+		},
+		func(trigger *v1alpha1.GitOpsTrigger, c fuzz.Continue) {
+			c.FuzzNoCustom(trigger)
+			trigger.Type = []string{"Change", "Periodic", "Time", "Webhook"}[c.Intn(4)]
+		},
+		func(trigger *GitOpsTrigger, c fuzz.Continue) {
+			c.FuzzNoCustom(trigger)
+			trigger.Type = []TriggerType{TriggerChange, TriggerPeriodic, TriggerWebhook}[c.Intn(3)]
+		},
+	}
+}
+
+func newConversionFuzzer(t *testing.T) *fuzz.Fuzzer {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, v1alpha1.SchemeBuilder.AddToScheme(scheme))
+	assert.NoError(t, SchemeBuilder.AddToScheme(scheme))
+	seed := time.Now().UnixNano()
+	t.Logf("fuzzing with the seed %d", seed)
+	return fuzzer.FuzzerFor(fuzzer.MergeFuzzerFuncs(metafuzzer.Funcs, conversionFuzzerFuncs), rand.NewSource(seed), runtimeserializer.NewCodecFactory(scheme))
+}
+
+func TestRoundTripFromV1alpha1(t *testing.T) {
+	f := newConversionFuzzer(t)
+	for i := 0; i < fuzzIterations; i++ {
+		original := &v1alpha1.GitOpsConfig{}
+		f.Fuzz(original)
+		original.SetGroupVersionKind(v1alpha1.SchemeGroupVersion.WithKind("GitOpsConfig"))
+
+		converted := &GitOpsConfig{}
+		if !assert.NoError(t, converted.ConvertFrom(original.DeepCopy())) {
+			return
+		}
+		for _, trigger := range converted.Spec.Triggers {
+			assert.NotEqual(t, TriggerType("Time"), trigger.Type)
+		}
+		roundTripped := &v1alpha1.GitOpsConfig{}
+		if !assert.NoError(t, converted.ConvertTo(roundTripped)) {
+			return
+		}
+		if !apiequality.Semantic.DeepEqual(original, roundTripped) {
+			t.Fatalf("v1alpha1 -> v1beta1 -> v1alpha1 lost data: %s", diff.ObjectReflectDiff(original, roundTripped))
+		}
+	}
+}
+
+func TestRoundTripFromV1beta1(t *testing.T) {
+	f := newConversionFuzzer(t)
+	for i := 0; i < fuzzIterations; i++ {
+		original := &GitOpsConfig{}
+		f.Fuzz(original)
+		original.SetGroupVersionKind(SchemeGroupVersion.WithKind("GitOpsConfig"))
+
+		converted := &v1alpha1.GitOpsConfig{}
+		if !assert.NoError(t, original.DeepCopy().ConvertTo(converted)) {
+			return
+		}
+		roundTripped := &GitOpsConfig{}
+		if !assert.NoError(t, roundTripped.ConvertFrom(converted)) {
+			return
+		}
+		if !apiequality.Semantic.DeepEqual(original, roundTripped) {
+			t.Fatalf("v1beta1 -> v1alpha1 -> v1beta1 lost data: %s", diff.ObjectReflectDiff(original, roundTripped))
+		}
+	}
+}
+
+func TestConvertTimeTriggers(t *testing.T) {
+	original := &v1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "gitops"},
+		Spec: v1alpha1.GitOpsConfigSpec{Triggers: []v1alpha1.GitOpsTrigger{
+			{Type: "Change"},
+			{Type: "Time", Cron: "0 * * * *"},
+			{Type: "Periodic", Cron: "30 * * * *"},
+		}},
+	}
+	converted := &GitOpsConfig{}
+	assert.NoError(t, converted.ConvertFrom(original))
+	assert.Equal(t, "eunomia.kohls.io/v1beta1", converted.APIVersion)
+	assert.Equal(t, []GitOpsTrigger{
+		{Type: TriggerChange},
+		{Type: TriggerPeriodic, Cron: "0 * * * *"},
+		{Type: TriggerPeriodic, Cron: "30 * * * *"},
+	}, converted.Spec.Triggers)
+	assert.Equal(t, map[string]string{TimeTriggersAnnotation: "1"}, converted.Annotations)
+
+	roundTripped := &v1alpha1.GitOpsConfig{}
+	assert.NoError(t, converted.ConvertTo(roundTripped))
+	assert.Equal(t, "eunomia.kohls.io/v1alpha1", roundTripped.APIVersion)
+	assert.Equal(t, original.Spec.Triggers, roundTripped.Spec.Triggers)
+	assert.Empty(t, roundTripped.Annotations)
+
+	// a trigger changed in v1beta1 since doesn't become a Time one
+	converted.Spec.Triggers[1].Type = TriggerWebhook
+	roundTripped = &v1alpha1.GitOpsConfig{}
+	assert.NoError(t, converted.ConvertTo(roundTripped))
+	assert.Equal(t, "Webhook", roundTripped.Spec.Triggers[1].Type)
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	// StatementType is the in-toto statement type of the attestations
+	StatementType = "https://in-toto.io/Statement/v0.1"
+	// PredicateType is the type of the provenance predicate of the attestations
+	PredicateType = "https://slsa.dev/provenance/v0.2"
+	// PayloadType is the DSSE payload type of the signed statements
+	PayloadType = "application/vnd.in-toto+json"
+	// BuildType identifies a run of a GitOpsConfig
+	BuildType = "https://github.com/KohlsTechnology/eunomia/GitOpsConfig@v1"
+)
+
+// Statement is the in-toto statement attesting what a successful run of a GitOpsConfig applied
+type Statement struct {
+	Type          string     `json:"_type"`
+	Subject       []Subject  `json:"subject"`
+	PredicateType string     `json:"predicateType"`
+	Predicate     Provenance `json:"predicate"`
+}
+
+// Subject is an artifact of the attested run, the applied template commit or the inventory of the applied resources
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is the SLSA provenance predicate of a run
+type Provenance struct {
+	// Builder identifies the operator that launched the run
+	Builder Builder `json:"builder"`
+	// BuildType is always BuildType
+	BuildType string `json:"buildType"`
+	// Invocation is the GitOpsConfig and the job of the run
+	Invocation Invocation `json:"invocation"`
+	// Metadata holds when the run finished
+	Metadata Metadata `json:"metadata"`
+	// Materials are the template and parameter sources
+	Materials []Material `json:"materials,omitempty"`
+}
+
+// Builder identifies the operator that launched a run
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// Invocation describes the run
+type Invocation struct {
+	// Namespace of the GitOpsConfig
+	Namespace string `json:"namespace"`
+	// Config is the name of the GitOpsConfig
+	Config string `json:"config"`
+	// Job is the name of the job that applied the resources
+	Job string `json:"job"`
+	// Inventory summarizes the inventory of all the applied resources, nil when it isn't known
+	Inventory *Inventory `json:"inventory,omitempty"`
+}
+
+// Inventory summarizes the resources applied by the run, listed in a ConfigMap of the namespace of the GitOpsConfig
+type Inventory struct {
+	// ConfigMap is the name of the ConfigMap listing the resources, empty when the job couldn't write it
+	ConfigMap string `json:"configMap,omitempty"`
+	// Count is the number of applied resources
+	Count int `json:"count"`
+	// Hash is the SHA-256 hash of the list of the resources
+	Hash string `json:"hash"`
+}
+
+// Metadata holds when the run finished
+type Metadata struct {
+	FinishedOn time.Time `json:"buildFinishedOn"`
+}
+
+// Material is a git source of a run
+type Material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// Envelope is a DSSE envelope holding a signed statement
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is a signature of the payload of an envelope
+type Signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// Signer signs statements with a private key
+type Signer struct {
+	key   crypto.Signer
+	keyID string
+}
+
+// NewSigner returns a signer using the ECDSA or Ed25519 private key of the PEM file at path
+func NewSigner(path string) (*Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s holds a %s, not an unencrypted private key", path, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s holds an unsupported private key", path)
+	}
+	switch signer.(type) {
+	case *ecdsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported private key, only ECDSA and Ed25519 keys can sign attestations", path)
+	}
+	keyID, err := KeyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{key: signer, keyID: keyID}, nil
+}
+
+// KeyID returns the identifier of a public key, the hex SHA-256 of its DER encoding
+func KeyID(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(der)), nil
+}
+
+// Sign returns the DSSE envelope of statement signed by the key of s
+func (s *Signer) Sign(statement Statement) (Envelope, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return Envelope{}, err
+	}
+	sig, err := sign(s.key, pae(PayloadType, payload))
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{{KeyID: s.keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// Verify checks that envelope is signed by key, returning its statement
+func Verify(envelope Envelope, key crypto.PublicKey) (Statement, error) {
+	statement := Statement{}
+	if envelope.PayloadType != PayloadType {
+		return statement, fmt.Errorf("unexpected payload type %q", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return statement, err
+	}
+	message := pae(envelope.PayloadType, payload)
+	verified := false
+	for _, signature := range envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(signature.Sig)
+		if err == nil && verify(key, message, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return statement, errors.New("the attestation isn't signed by the key")
+	}
+	err = json.Unmarshal(payload, &statement)
+	return statement, err
+}
+
+// pae is the DSSE pre-authentication encoding of payload, the message actually signed
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+func sign(key crypto.Signer, message []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, message, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(message)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func verify(key crypto.PublicKey, message, sig []byte) bool {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, message, sig)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	}
+	return false
+}
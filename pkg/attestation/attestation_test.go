@@ -0,0 +1,140 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var statement = Statement{
+	Type:          StatementType,
+	Subject:       []Subject{{Name: "https://github.com/KohlsTechnology/eunomia", Digest: map[string]string{"sha1": "0123456789abcdef0123456789abcdef01234567"}}},
+	PredicateType: PredicateType,
+	Predicate: Provenance{
+		Builder:    Builder{ID: "https://github.com/KohlsTechnology/eunomia@v0.0.1"},
+		BuildType:  BuildType,
+		Invocation: Invocation{Namespace: "gitops", Config: "gitops-operator", Job: "gitopsconfig-gitops-operator-abcde"},
+		Metadata:   Metadata{FinishedOn: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)},
+	},
+}
+
+// writeKey writes key in a PEM file of dir, returning its path
+func writeKey(t *testing.T, dir, blockType string, der []byte) string {
+	path := filepath.Join(dir, "key.pem")
+	err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSignAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attestation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	assert.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		blockType string
+		der       []byte
+		public    crypto.PublicKey
+	}{
+		{"ecdsa", "EC PRIVATE KEY", ecDER, &ecKey.PublicKey},
+		{"ed25519", "PRIVATE KEY", edDER, edPublic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewSigner(writeKey(t, dir, tt.blockType, tt.der))
+			if !assert.NoError(t, err) {
+				return
+			}
+			envelope, err := signer.Sign(statement)
+			assert.NoError(t, err)
+			keyID, err := KeyID(tt.public)
+			assert.NoError(t, err)
+			if assert.Len(t, envelope.Signatures, 1) {
+				assert.Equal(t, keyID, envelope.Signatures[0].KeyID)
+			}
+
+			verified, err := Verify(envelope, tt.public)
+			assert.NoError(t, err)
+			assert.Equal(t, statement, verified)
+
+			// a payload changed after the signature doesn't verify
+			tampered := envelope
+			tampered.Payload = base64.StdEncoding.EncodeToString([]byte(`{"_type":"https://in-toto.io/Statement/v0.1"}`))
+			_, err = Verify(tampered, tt.public)
+			assert.Error(t, err)
+		})
+	}
+
+	// a different key doesn't verify the attestation
+	signer, err := NewSigner(writeKey(t, dir, "EC PRIVATE KEY", ecDER))
+	assert.NoError(t, err)
+	envelope, err := signer.Sign(statement)
+	assert.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, err = Verify(envelope, &otherKey.PublicKey)
+	assert.Error(t, err)
+	_, err = Verify(envelope, edPublic)
+	assert.Error(t, err)
+}
+
+func TestNewSignerInvalidKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attestation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewSigner(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+	_, err = NewSigner(writeKey(t, dir, "PUBLIC KEY", []byte("public")))
+	assert.Error(t, err)
+	_, err = NewSigner(writeKey(t, dir, "ENCRYPTED PRIVATE KEY", []byte("encrypted")))
+	assert.Error(t, err)
+	path := filepath.Join(dir, "plain.txt")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not a key"), 0600))
+	_, err = NewSigner(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is the audit trail entry written for every completed GitOpsConfig run
+type Record struct {
+	// Time at which the run completed
+	Time time.Time `json:"time"`
+	// Namespace of the GitOpsConfig
+	Namespace string `json:"namespace"`
+	// Config is the name of the GitOpsConfig
+	Config string `json:"config"`
+	// Job is the name of the job that processed the templates
+	Job string `json:"job"`
+	// Action is the job action, either create or delete
+	Action string `json:"action"`
+	// TemplateSource is the git URI of the templates
+	TemplateSource string `json:"templateSource"`
+	// Ref is the git ref of the templates configured on the GitOpsConfig
+	Ref string `json:"ref"`
+	// Commit is the hash of the applied template commit, empty when the job applied nothing
+	Commit string `json:"commit"`
+	// Resources lists the resources applied by the job, e.g. team-a/deployment/web, it may be truncated
+	Resources []string `json:"resources,omitempty"`
+	// Changed tells whether the job changed any resource, nil if it isn't known
+	Changed *bool `json:"changed,omitempty"`
+	// Result is either Succeeded or Failed
+	Result string `json:"result"`
+	// Actor is the service account that applied the resources
+	Actor string `json:"actor"`
+}
+
+// Sink is the destination of audit records
+type Sink interface {
+	Write(record Record) error
+}
+
+// NewSink returns the sink for the given URI. http and https URIs are POSTed
+// to, file URIs are appended to as JSON lines.
+func NewSink(uri string) (Sink, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &HTTPSink{URL: uri, Client: &http.Client{Timeout: 30 * time.Second}}, nil
+	case "file":
+		return &FileSink{Path: u.Path}, nil
+	}
+	return nil, fmt.Errorf("unsupported audit sink scheme %q", u.Scheme)
+}
+
+// HTTPSink POSTs every record as JSON to URL
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// Write sends record to the endpoint, any non 2xx response is an error
+func (s *HTTPSink) Write(record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit sink %s responded with %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// FileSink appends every record as a JSON line to the file at Path,
+// typically on a persistent volume
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Write appends record to the file, creating it if needed
+func (s *FileSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WriteWithRetry writes record to sink, retrying up to attempts times with a
+// doubling delay. The last error is returned if all attempts failed.
+func WriteWithRetry(sink Sink, record Record, attempts int, delay time.Duration) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		err = sink.Write(record)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var record = Record{
+	Namespace: "gitops",
+	Config:    "gitops-operator",
+	Job:       "gitopsconfig-gitops-operator-abcde",
+	Action:    "create",
+	Commit:    "master",
+	Result:    "Succeeded",
+	Actor:     "mysvcaccount",
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec Record
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&rec))
+		received = append(received, rec)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Write(record))
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, record.Config, received[0].Config)
+		assert.Equal(t, record.Result, received[0].Result)
+	}
+}
+
+func TestHTTPSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL)
+	assert.NoError(t, err)
+	assert.Error(t, sink.Write(record))
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewSink("file://" + path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Write(record))
+	assert.NoError(t, sink.Write(record))
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 2)
+}
+
+func TestNewSinkUnsupported(t *testing.T) {
+	_, err := NewSink("ftp://example.com/audit")
+	assert.Error(t, err)
+}
+
+type flakySink struct {
+	failures int
+	writes   int
+}
+
+func (s *flakySink) Write(record Record) error {
+	s.writes++
+	if s.writes <= s.failures {
+		return errors.New("sink unavailable")
+	}
+	return nil
+}
+
+func TestWriteWithRetry(t *testing.T) {
+	sink := &flakySink{failures: 2}
+	assert.NoError(t, WriteWithRetry(sink, record, 3, 0))
+	assert.Equal(t, 3, sink.writes)
+
+	sink = &flakySink{failures: 5}
+	assert.Error(t, WriteWithRetry(sink, record, 3, 0))
+	assert.Equal(t, 3, sink.writes)
+}
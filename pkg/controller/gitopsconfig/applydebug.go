@@ -0,0 +1,70 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"regexp"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// applyDebugAnnotation set to true makes the jobs of a GitOpsConfig report the result of the apply of every object,
+// each one being recorded as an event. The job templates pass it to the template processor as APPLY_DEBUG.
+const applyDebugAnnotation string = "gitopsconfig.eunomia.kohls.io/debug-apply"
+
+// appliedPattern matches the lines printed by the template processor of a failed job, before its phase, for every applied object
+var appliedPattern = regexp.MustCompile(`(?m)^eunomia-applied: (.+?)\s*$`)
+
+// isApplyDebug returns true if job was created in debug mode, reporting the result of the apply of every object
+func isApplyDebug(job *batchv1.Job) bool {
+	for _, container := range job.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == "APPLY_DEBUG" {
+				return env.Value == "true"
+			}
+		}
+	}
+	return false
+}
+
+// failedApplyResults returns the results of the apply of every object printed in the termination message of a failed job
+func failedApplyResults(message string) []string {
+	results := []string{}
+	for _, match := range appliedPattern.FindAllStringSubmatch(message, -1) {
+		results = append(results, match[1])
+	}
+	return results
+}
+
+// recordApplyResults records an event for the result of the apply of every object by job, e.g.
+// deployment.apps/web created. The results are only recorded for the jobs created in debug mode.
+func (j *jobCompletionEmitter) recordApplyResults(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, results []string) {
+	if !isApplyDebug(job) {
+		return
+	}
+	for _, result := range results {
+		object, outcome := result, "unknown"
+		if i := strings.LastIndex(result, " "); i > 0 {
+			object, outcome = result[:i], result[i+1:]
+		}
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name, "object": object},
+			"Normal", "ObjectApplied", "Job %s: %s %s", job.Name, object, outcome)
+	}
+}
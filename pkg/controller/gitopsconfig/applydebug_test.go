@@ -0,0 +1,134 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// drainEvents returns the events recorded so far
+func drainEvents(recorder *record.FakeRecorder) []string {
+	events := []string{}
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// objectAppliedEvents returns the ObjectApplied events among events
+func objectAppliedEvents(events []string) []string {
+	applied := []string{}
+	for _, event := range events {
+		if strings.HasPrefix(event, "Normal ObjectApplied") {
+			applied = append(applied, event)
+		}
+	}
+	return applied
+}
+
+func TestApplyDebugEvents(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	success := `{"commitMessage":"Scale the frontend","applied":["deployment.apps/frontend updated","service/frontend unchanged","configmap/frontend created"]}`
+	failure := "Error from server (Forbidden): error when creating \"service.yaml\": services \"backend\" is forbidden\n" +
+		"eunomia-applied: deployment.apps/backend created\n" +
+		"eunomia-applied: services/backend error\n" +
+		"eunomia-phase: Apply\n"
+	tests := []struct {
+		name    string
+		debug   string
+		message string
+		status  batchv1.JobStatus
+		want    []string
+	}{
+		{"success in debug mode", "true", success, batchv1.JobStatus{Succeeded: 1}, []string{
+			"deployment.apps/frontend updated",
+			"service/frontend unchanged",
+			"configmap/frontend created",
+		}},
+		{"failure in debug mode", "true", failure, batchv1.JobStatus{Failed: 1}, []string{
+			"deployment.apps/backend created",
+			"services/backend error",
+		}},
+		{"success", "", success, batchv1.JobStatus{Succeeded: 1}, []string{}},
+		{"failure", "", failure, batchv1.JobStatus{Failed: 1}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(tt.message))
+			recorder := record.NewFakeRecorder(20)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			job := newOwnedJob(tt.status)
+			job.Spec.Template.Spec.Containers = []corev1.Container{{
+				Name: "template-processor",
+				Env:  []corev1.EnvVar{{Name: "APPLY_DEBUG", Value: tt.debug}},
+			}}
+
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), job)
+			events := objectAppliedEvents(drainEvents(recorder))
+			if assert.Len(t, events, len(tt.want)) {
+				for i, result := range tt.want {
+					assert.Contains(t, events[i], result)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDebugTemplate(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		debug       bool
+	}{
+		{"debug", map[string]string{applyDebugAnnotation: "true"}, true},
+		{"disabled", map[string]string{applyDebugAnnotation: "false"}, false},
+		{"normal", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Annotations = tt.annotations
+			cl := fake.NewFakeClient(instance)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+			_, err := r.createJob("create", instance, 0, "", "", "")
+			assert.NoError(t, err)
+			jobs := &batchv1.JobList{}
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+			if assert.Len(t, jobs.Items, 1) {
+				assert.Equal(t, tt.debug, isApplyDebug(&jobs.Items[0]))
+			}
+		})
+	}
+}
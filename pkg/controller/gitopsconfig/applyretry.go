@@ -0,0 +1,38 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// validateApplyRetry verifies the retries of the applies failing with transient errors, set in the jobTemplate of spec
+func validateApplyRetry(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.JobTemplate == nil || spec.JobTemplate.Retry == nil {
+		return nil
+	}
+	retry := spec.JobTemplate.Retry
+	if retry.MaxRetries < 0 {
+		return fmt.Errorf("jobTemplate retry maxRetries %d must not be negative", retry.MaxRetries)
+	}
+	if retry.BaseDelay != nil && retry.BaseDelay.Duration <= 0 {
+		return fmt.Errorf("jobTemplate retry baseDelay %s must be positive", retry.BaseDelay.Duration)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateApplyRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry *gitopsv1alpha1.ApplyRetry
+		err   string
+	}{
+		{"unset", nil, ""},
+		{"retries", &gitopsv1alpha1.ApplyRetry{MaxRetries: 3, BaseDelay: &metav1.Duration{Duration: 2 * time.Second}}, ""},
+		{"negative retries", &gitopsv1alpha1.ApplyRetry{MaxRetries: -1}, "jobTemplate retry maxRetries -1 must not be negative"},
+		{"zero delay", &gitopsv1alpha1.ApplyRetry{MaxRetries: 3, BaseDelay: &metav1.Duration{}}, "jobTemplate retry baseDelay 0s must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := gitopsv1alpha1.GitOpsConfigSpec{JobTemplate: &gitopsv1alpha1.JobTemplate{Retry: tt.retry}}
+			err := validateApplyRetry(spec)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApplyRetryReachesJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.JobTemplate = &gitopsv1alpha1.JobTemplate{Retry: &gitopsv1alpha1.ApplyRetry{
+		MaxRetries: 5,
+		BaseDelay:  &metav1.Duration{Duration: 500 * time.Millisecond},
+	}}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs.Items, 1) {
+		env := jobs.Items[0].Spec.Template.Spec.Containers[0].Env
+		assert.Contains(t, env, corev1.EnvVar{Name: "APPLY_RETRIES", Value: "5"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "APPLY_RETRY_DELAY", Value: "0.5"})
+	}
+}
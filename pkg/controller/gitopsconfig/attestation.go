@@ -0,0 +1,161 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/attestation"
+	"github.com/KohlsTechnology/eunomia/version"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// attestationKey is the key of the attestation ConfigMap holding the signed envelope
+const attestationKey = "attestation.json"
+
+// attestationSigner signs the provenance of every successful job, nil disables the attestations
+var attestationSigner *attestation.Signer
+
+// SetAttestationSigner configures the signer of the provenance attestations of the successful jobs
+func SetAttestationSigner(signer *attestation.Signer) {
+	attestationSigner = signer
+}
+
+// attestationConfigMapName returns the name of the ConfigMap holding the latest attestation of instance
+func attestationConfigMapName(instance *gitopsv1alpha1.GitOpsConfig) string {
+	return "gitopsconfig-" + instance.GetName() + "-attestation"
+}
+
+// provenance returns the statement attesting that job applied the commit of report for instance, finished at now
+func provenance(instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, report jobReport, now time.Time) attestation.Statement {
+	subjects := []attestation.Subject{{
+		Name:   instance.Spec.TemplateSource.URI,
+		Digest: map[string]string{"sha1": report.Commit},
+	}}
+	// the inventory lists all the applied resources, unlike the one of the report, which is cut to fit in it
+	var inventory *attestation.Inventory
+	if managed := report.ManagedResources; managed != nil {
+		inventory = &attestation.Inventory{ConfigMap: managed.ConfigMap, Count: managed.Count, Hash: managed.Hash}
+		if managed.ConfigMap != "" && managed.Hash != "" {
+			subjects = append(subjects, attestation.Subject{
+				Name:   instance.GetNamespace() + "/" + managed.ConfigMap,
+				Digest: map[string]string{"sha256": managed.Hash},
+			})
+		}
+	}
+	materials := []attestation.Material{{
+		URI:    instance.Spec.TemplateSource.URI,
+		Digest: map[string]string{"sha1": report.Commit},
+	}}
+	// template processors that don't report the commit of the parameters only give their ref
+	if parameters := instance.Spec.ParameterSource; parameters.URI != "" {
+		material := attestation.Material{URI: parameters.URI}
+		if report.ParameterCommit != "" {
+			material.Digest = map[string]string{"sha1": report.ParameterCommit}
+		} else if parameters.Ref != "" {
+			material.URI += "@" + parameters.Ref
+		}
+		materials = append(materials, material)
+	}
+	return attestation.Statement{
+		Type:          attestation.StatementType,
+		Subject:       subjects,
+		PredicateType: attestation.PredicateType,
+		Predicate: attestation.Provenance{
+			Builder:   attestation.Builder{ID: "https://github.com/KohlsTechnology/eunomia@v" + version.Version},
+			BuildType: attestation.BuildType,
+			Invocation: attestation.Invocation{
+				Namespace: instance.GetNamespace(),
+				Config:    instance.GetName(),
+				Job:       job.GetName(),
+				Inventory: inventory,
+			},
+			Metadata:  attestation.Metadata{FinishedOn: now.UTC().Truncate(time.Second)},
+			Materials: materials,
+		},
+	}
+}
+
+// recordAttestation signs the provenance of the successful job and stores it
+// in a ConfigMap owned by the GitOpsConfig, replacing the previous attestation.
+// A failure is reported as an event on the GitOpsConfig.
+func (j *jobCompletionEmitter) recordAttestation(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, report jobReport) {
+	if attestationSigner == nil {
+		return
+	}
+	if report.Commit == "" {
+		log.Info("Not attesting job without an applied commit", "job", job.GetName())
+		return
+	}
+	err := j.writeAttestation(owner, job, report)
+	if err != nil {
+		log.Error(err, "unable to record the attestation", "job", job.GetName())
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.GetName()},
+			"Warning", "AttestationFailed", "Unable to record the attestation of job %s: %v", job.GetName(), err)
+	}
+}
+
+func (j *jobCompletionEmitter) writeAttestation(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, report jobReport) error {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		return err
+	}
+	envelope, err := attestationSigner.Sign(provenance(instance, job, report, time.Now()))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	// read from the API server like the notification secrets, instead of caching all the ConfigMaps of the cluster
+	reader := j.secretReader
+	if reader == nil {
+		reader = j.client
+	}
+	configMap := &corev1.ConfigMap{}
+	err = reader.Get(context.TODO(), types.NamespacedName{Name: attestationConfigMapName(instance), Namespace: instance.GetNamespace()}, configMap)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	configMap.ObjectMeta = metav1.ObjectMeta{
+		Name:            attestationConfigMapName(instance),
+		Namespace:       instance.GetNamespace(),
+		ResourceVersion: configMap.GetResourceVersion(),
+		Annotations:     map[string]string{commitAnnotation: report.Commit},
+	}
+	configMap.Data = map[string]string{attestationKey: string(data)}
+	err = controllerutil.SetControllerReference(instance, configMap, j.scheme)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return j.client.Update(context.TODO(), configMap)
+	}
+	return j.client.Create(context.TODO(), configMap)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/attestation"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAttestation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attestation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	keyPath := filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	signer, err := attestation.NewSigner(keyPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	SetAttestationSigner(signer)
+	defer SetAttestationSigner(nil)
+
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.UID = "1234"
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	parameterCommit := "89abcdef0123456789abcdef0123456789abcdef"
+	hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	instance.Spec.ParameterSource = gitopsv1alpha1.GitConfig{URI: "https://github.com/KohlsTechnology/eunomia-parameters.git", Ref: "master"}
+	// the inventory of the report is cut, the attestation only relies on the inventory ConfigMap
+	message := `{"commit":"` + commit + `","parameterCommit":"` + parameterCommit + `","commitMessage":"Scale the frontend",` +
+		`"inventory":[{"namespace":"frontend","resources":["deployment/frontend"],"resourceCount":25}],` +
+		`"managedResources":{"count":25,"hash":"` + hash + `","configMap":"gitopsconfig-gitops-operator-inventory"}}`
+	cl := fake.NewFakeClient(instance, newTerminatedPod(message))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	job := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+	job.OwnerReferences[0].UID = instance.UID
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), job)
+	assert.Contains(t, <-recorder.Events, "Normal JobSuccessful")
+
+	configMap := &corev1.ConfigMap{}
+	err = cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator-attestation", Namespace: namespace}, configMap)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, commit, configMap.Annotations[commitAnnotation])
+	if assert.Len(t, configMap.OwnerReferences, 1) {
+		assert.Equal(t, instance.UID, configMap.OwnerReferences[0].UID)
+	}
+	envelope := attestation.Envelope{}
+	assert.NoError(t, json.Unmarshal([]byte(configMap.Data[attestationKey]), &envelope))
+
+	// the attestation verifies against the key and describes the run
+	statement, err := attestation.Verify(envelope, &key.PublicKey)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, attestation.StatementType, statement.Type)
+	assert.Equal(t, attestation.PredicateType, statement.PredicateType)
+	if assert.Len(t, statement.Subject, 2) {
+		assert.Equal(t, instance.Spec.TemplateSource.URI, statement.Subject[0].Name)
+		assert.Equal(t, map[string]string{"sha1": commit}, statement.Subject[0].Digest)
+		assert.Equal(t, namespace+"/gitopsconfig-gitops-operator-inventory", statement.Subject[1].Name)
+		assert.Equal(t, map[string]string{"sha256": hash}, statement.Subject[1].Digest)
+	}
+	if assert.Len(t, statement.Predicate.Materials, 2) {
+		assert.Equal(t, map[string]string{"sha1": commit}, statement.Predicate.Materials[0].Digest)
+		assert.Equal(t, "https://github.com/KohlsTechnology/eunomia-parameters.git", statement.Predicate.Materials[1].URI)
+		assert.Equal(t, map[string]string{"sha1": parameterCommit}, statement.Predicate.Materials[1].Digest)
+	}
+	invocation := statement.Predicate.Invocation
+	assert.Equal(t, namespace, invocation.Namespace)
+	assert.Equal(t, name, invocation.Config)
+	assert.Equal(t, job.GetName(), invocation.Job)
+	assert.Equal(t, &attestation.Inventory{ConfigMap: "gitopsconfig-gitops-operator-inventory", Count: 25, Hash: hash}, invocation.Inventory)
+	assert.Contains(t, statement.Predicate.Builder.ID, "https://github.com/KohlsTechnology/eunomia@v")
+	assert.False(t, statement.Predicate.Metadata.FinishedOn.IsZero())
+
+	// another key doesn't verify it
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, err = attestation.Verify(envelope, &other.PublicKey)
+	assert.Error(t, err)
+}
+
+func TestAttestationDisabled(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	message := `{"commit":"0123456789abcdef0123456789abcdef01234567"}`
+	cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(message))
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+	configMap := &corev1.ConfigMap{}
+	err := cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator-attestation", Namespace: namespace}, configMap)
+	assert.Error(t, err)
+}
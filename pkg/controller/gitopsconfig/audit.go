@@ -0,0 +1,91 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/audit"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// auditAttempts is how many times writing an audit record is tried before giving up
+const auditAttempts int = 5
+
+// auditRetryDelay is the delay before the first retry of a failed audit write, doubled at every further attempt
+var auditRetryDelay = time.Second
+
+// auditSink receives a record for every completed job, nil disables auditing
+var auditSink audit.Sink
+
+// SetAuditSink configures the sink receiving the audit trail of every completed job
+func SetAuditSink(sink audit.Sink) {
+	auditSink = sink
+}
+
+// recordAudit writes the audit record of the completed job to the configured
+// sink in the background, with the commit and the resources applied according
+// to report. A failure is reported as an event on the GitOpsConfig.
+func (j *jobCompletionEmitter) recordAudit(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, result string, report jobReport) {
+	if j.audit == nil {
+		return
+	}
+	record := audit.Record{
+		Time:      time.Now(),
+		Namespace: owner.GetNamespace(),
+		Config:    owner.GetName(),
+		Job:       job.GetName(),
+		Action:    job.GetLabels()["action"],
+		Commit:    report.Commit,
+		Resources: auditResources(report.Inventory),
+		Changed:   report.Changed,
+		Result:    result,
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		// the GitOpsConfig may already be gone after a delete job, the record is still written
+		log.Info("unable to lookup the GitOpsConfig for the audit record", "job", job.GetName(), "error", err.Error())
+	} else {
+		record.TemplateSource = instance.Spec.TemplateSource.URI
+		record.Ref = instance.Spec.TemplateSource.Ref
+		record.Actor = instance.Spec.ServiceAccountRef
+	}
+	go func() {
+		err := audit.WriteWithRetry(j.audit, record, auditAttempts, auditRetryDelay)
+		if err != nil {
+			log.Error(err, "unable to write audit record", "job", job.GetName())
+			j.recorder.AnnotatedEventf(owner,
+				map[string]string{"job": job.GetName()},
+				"Warning", "AuditFailed", "Unable to write audit record for job %s: %v", job.GetName(), err)
+		}
+	}()
+}
+
+// auditResources lists the resources of inventory, each prefixed with its namespace, e.g. team-a/deployment/web
+func auditResources(inventory []gitopsv1alpha1.NamespaceInventory) []string {
+	var resources []string
+	for _, namespace := range inventory {
+		for _, resource := range namespace.Resources {
+			resources = append(resources, namespace.Namespace+"/"+resource)
+		}
+	}
+	return resources
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// teardownBranch starts a job deleting the resources that instance applied for the
+// branch deleted by trigger, rendering them with the parameter file of that branch
+func (r *ReconcileGitOpsConfig) teardownBranch(instance *gitopsv1alpha1.GitOpsConfig, trigger *TriggerContext) (reconcile.Result, error) {
+	parameterFile, err := resolveParameterFile(instance, trigger)
+	if err != nil {
+		log.Error(err, "unable to resolve the parameter file of the deleted branch, not creating job", "instance", instance.GetName(), "branch", trigger.Branch)
+		r.recorder.Eventf(instance, "Warning", "ParameterFileUnresolved", "Teardown of branch %s not started: %s", trigger.Branch, err)
+		return reconcile.Result{}, nil
+	}
+	log.Info("Branch deleted, creating job deleting its resources", "instance", instance.GetName(), "branch", trigger.Branch)
+	_, err = r.createJob("delete", instance, 0, parameterFile, "", "")
+	if err != nil {
+		// the retry must tear down the branch again, not apply it
+		SetTriggerContext(types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}, *trigger)
+		return reconcile.Result{}, err
+	}
+	r.recorder.Eventf(instance, "Normal", "BranchTeardown", "Branch %s was deleted, deleting the resources applied with %s", trigger.Branch, parameterFile)
+	return reconcile.Result{}, nil
+}
+
+// isDeletionJob returns true if job is deleting the resources of instance, which is being deleted.
+// The delete jobs started before, e.g. to tear down a deleted branch, don't delete all its resources.
+func isDeletionJob(instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) bool {
+	if !isOwner(instance, job) || job.GetLabels()["action"] != "delete" {
+		return false
+	}
+	return job.CreationTimestamp.IsZero() || instance.DeletionTimestamp == nil || !job.CreationTimestamp.Before(instance.DeletionTimestamp)
+}
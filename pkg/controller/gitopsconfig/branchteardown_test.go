@@ -0,0 +1,91 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestBranchTeardown(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook", PruneDeletedBranches: true}}
+	instance.Spec.ParameterSource.FileName = "params/{{ .Branch }}.yaml"
+	instance.Status.ParameterFile = "params/master.yaml"
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	SetTriggerContext(nsn, TriggerContext{Branch: "feature-x", Repo: "KohlsTechnology/eunomia", Deleted: true})
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "Normal BranchTeardown")
+
+	// the resources of the branch are deleted, rendered with its parameter file
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		job := jobs.Items[0]
+		assert.Equal(t, "delete", job.Labels["action"])
+		assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "PARAMETER_FILE", Value: "params/feature-x.yaml"})
+		assert.Equal(t, "params/feature-x.yaml", job.Annotations[parameterFileAnnotation])
+	}
+	// the deletion of the GitOpsConfig keeps using the parameter file of its last run
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.Equal(t, "params/master.yaml", updated.Status.ParameterFile)
+	assert.Nil(t, takeTriggerContext(nsn))
+}
+
+func TestIsDeletionJob(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.UID = "1234"
+	deleted := metav1.NewTime(time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC))
+	instance.DeletionTimestamp = &deleted
+	newDeleteJob := func(created time.Time) *batchv1.Job {
+		job := newOwnedJob(batchv1.JobStatus{})
+		job.Labels["action"] = "delete"
+		job.OwnerReferences[0].UID = instance.UID
+		job.CreationTimestamp = metav1.NewTime(created)
+		return job
+	}
+
+	assert.True(t, isDeletionJob(instance, newDeleteJob(deleted.Add(time.Second))))
+	assert.True(t, isDeletionJob(instance, newDeleteJob(deleted.Time)))
+	// the teardown of a deleted branch doesn't delete the resources of the GitOpsConfig
+	assert.False(t, isDeletionJob(instance, newDeleteJob(deleted.Add(-time.Hour))))
+	create := newDeleteJob(deleted.Add(time.Second))
+	create.Labels["action"] = "create"
+	assert.False(t, isDeletionJob(instance, create))
+}
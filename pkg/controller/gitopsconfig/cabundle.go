@@ -0,0 +1,83 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// validateCABundle verifies the reference to the ConfigMap or Secret holding the certificates the jobs trust
+func validateCABundle(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	bundle := spec.CABundle
+	if bundle == nil {
+		return nil
+	}
+	if bundle.Kind != "ConfigMap" && bundle.Kind != "Secret" {
+		return fmt.Errorf("caBundle kind %q is not one of ConfigMap, Secret", bundle.Kind)
+	}
+	if errs := validation.IsDNS1123Subdomain(bundle.Name); len(errs) > 0 {
+		return fmt.Errorf("caBundle name %q is not a valid %s name: %s", bundle.Name, bundle.Kind, strings.Join(errs, ", "))
+	}
+	if bundle.Key == "" {
+		return nil
+	}
+	if errs := validation.IsConfigMapKey(bundle.Key); len(errs) > 0 {
+		return fmt.Errorf("caBundle key %q is not a valid %s key: %s", bundle.Key, bundle.Kind, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// missingCABundle returns the kind and name of the ConfigMap or Secret of the CA bundle of instance, or of its key,
+// if it doesn't exist in namespace, an empty string otherwise
+func missingCABundle(reader client.Reader, namespace string, instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	bundle := instance.Spec.CABundle
+	if bundle == nil {
+		return "", nil
+	}
+	key := types.NamespacedName{Name: bundle.Name, Namespace: namespace}
+	found := false
+	if bundle.Kind == "Secret" {
+		secret := &corev1.Secret{}
+		missing, err := isMissing(reader, key, secret)
+		if missing || err != nil {
+			return "Secret " + bundle.Name, err
+		}
+		_, found = secret.Data[util.GetCABundleKey(*instance)]
+	} else {
+		configMap := &corev1.ConfigMap{}
+		missing, err := isMissing(reader, key, configMap)
+		if missing || err != nil {
+			return "ConfigMap " + bundle.Name, err
+		}
+		_, found = configMap.Data[util.GetCABundleKey(*instance)]
+		if !found {
+			_, found = configMap.BinaryData[util.GetCABundleKey(*instance)]
+		}
+	}
+	if !found {
+		return fmt.Sprintf("Key %s of %s %s", util.GetCABundleKey(*instance), bundle.Kind, bundle.Name), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateCABundle(t *testing.T) {
+	tests := []struct {
+		name   string
+		bundle *gitopsv1alpha1.CABundleReference
+		errMsg string
+	}{
+		{"none", nil, ""},
+		{"configmap", &gitopsv1alpha1.CABundleReference{Kind: "ConfigMap", Name: "internal-ca"}, ""},
+		{"secret key", &gitopsv1alpha1.CABundleReference{Kind: "Secret", Name: "internal-ca", Key: "bundle.pem"}, ""},
+		{"kind", &gitopsv1alpha1.CABundleReference{Kind: "Vault", Name: "internal-ca"}, `caBundle kind "Vault" is not one of ConfigMap, Secret`},
+		{"name", &gitopsv1alpha1.CABundleReference{Kind: "Secret", Name: "Internal_CA"}, `caBundle name "Internal_CA" is not a valid Secret name`},
+		{"key", &gitopsv1alpha1.CABundleReference{Kind: "ConfigMap", Name: "internal-ca", Key: "certs/ca.crt"}, `caBundle key "certs/ca.crt" is not a valid ConfigMap key`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCABundle(gitopsv1alpha1.GitOpsConfigSpec{CABundle: tt.bundle})
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestMissingCABundle(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource.SecretRef = ""
+	instance.Spec.ParameterSource.SecretRef = ""
+	instance.Spec.CABundle = &gitopsv1alpha1.CABundleReference{Kind: "ConfigMap", Name: "internal-ca"}
+	cl := fake.NewFakeClient()
+	r := &ReconcileGitOpsConfig{client: cl, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(10)}
+
+	missing, err := r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Equal(t, "ConfigMap internal-ca", missing)
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "internal-ca", Namespace: namespace}, Data: map[string]string{"bundle.pem": "-----BEGIN CERTIFICATE-----"}}
+	assert.NoError(t, cl.Create(context.TODO(), configMap))
+	missing, err = r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Equal(t, "Key ca.crt of ConfigMap internal-ca", missing)
+
+	instance.Spec.CABundle.Key = "bundle.pem"
+	missing, err = r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
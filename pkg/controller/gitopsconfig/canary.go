@@ -0,0 +1,52 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"errors"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// validateCanary verifies the canary set by spec. Its namespaces must be target namespaces, unless they are selected
+// by the targetNamespaceSelector, and its selector is matched by the jobs with jq, which only supports equality
+// requirements.
+func validateCanary(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	canary := spec.Canary
+	if canary == nil {
+		return nil
+	}
+	if len(canary.Namespaces) == 0 && canary.Selector == "" {
+		return errors.New("canary must set namespaces or a selector")
+	}
+	for _, namespace := range canary.Namespaces {
+		if spec.TargetNamespaceSelector == nil && !containsString(spec.TargetNamespaces, namespace) {
+			return fmt.Errorf("canary namespace %q is not one of the targetNamespaces", namespace)
+		}
+	}
+	if canary.Selector != "" {
+		if _, err := labels.ConvertSelectorToLabelsMap(canary.Selector); err != nil {
+			return fmt.Errorf("canary selector %q is not a list of label=value requirements: %s", canary.Selector, err)
+		}
+	}
+	if canary.HealthTimeout != nil && canary.HealthTimeout.Duration <= 0 {
+		return fmt.Errorf("canary healthTimeout %s must be positive", canary.HealthTimeout.Duration)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateCanary(t *testing.T) {
+	spec := gitopsv1alpha1.GitOpsConfigSpec{TargetNamespaces: []string{"tenant-a", "tenant-b"}}
+	assert.NoError(t, validateCanary(spec))
+
+	tests := []struct {
+		name   string
+		canary gitopsv1alpha1.Canary
+		valid  bool
+	}{
+		{"namespace", gitopsv1alpha1.Canary{Namespaces: []string{"tenant-a"}}, true},
+		{"selector", gitopsv1alpha1.Canary{Selector: "track=canary,tier=web"}, true},
+		{"health timeout", gitopsv1alpha1.Canary{Selector: "track=canary", HealthTimeout: &metav1.Duration{Duration: time.Minute}}, true},
+		{"empty", gitopsv1alpha1.Canary{}, false},
+		{"not a target namespace", gitopsv1alpha1.Canary{Namespaces: []string{"tenant-c"}}, false},
+		{"set based selector", gitopsv1alpha1.Canary{Selector: "track in (canary)"}, false},
+		{"negative health timeout", gitopsv1alpha1.Canary{Selector: "track=canary", HealthTimeout: &metav1.Duration{Duration: -time.Minute}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canary := tt.canary
+			spec.Canary = &canary
+			if tt.valid {
+				assert.NoError(t, validateCanary(spec))
+			} else {
+				assert.Error(t, validateCanary(spec))
+			}
+		})
+	}
+}
+
+func TestCanaryReachesJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.TargetNamespaces = []string{"tenant-a", "tenant-b"}
+	instance.Spec.Canary = &gitopsv1alpha1.Canary{
+		Namespaces:    []string{"tenant-a"},
+		Selector:      "track=canary",
+		HealthTimeout: &metav1.Duration{Duration: 90 * time.Second},
+	}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createJob("create", instance, 0, "", "", "")
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		env := jobs.Items[0].Spec.Template.Spec.Containers[0].Env
+		assert.Contains(t, env, corev1.EnvVar{Name: "CANARY_NAMESPACES", Value: "tenant-a"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "CANARY_SELECTOR", Value: "track=canary"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "CANARY_HEALTH_TIMEOUT", Value: "90"})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pausedAnnotation is set on the GitOpsConfigs that must not run any job, removing it resumes them
+const pausedAnnotation string = "gitopsconfig.eunomia.kohls.io/paused"
+
+// isPaused returns true if the jobs of instance must not run
+func isPaused(instance *gitopsv1alpha1.GitOpsConfig) bool {
+	_, ok := instance.GetAnnotations()[pausedAnnotation]
+	return ok
+}
+
+// isQuarantined returns true if the triggers of instance must not start jobs
+func isQuarantined(instance *gitopsv1alpha1.GitOpsConfig) bool {
+	return isConditionTrue(&instance.Status, gitopsv1alpha1.ConditionQuarantined)
+}
+
+// recordJobFailure counts a failed job of owner, once its retries are
+// exhausted, and pauses or quarantines owner when it reaches its
+// pauseAfterFailures or quarantineAfterFailures. The status is stored
+// before the paused annotation, the update of the metadata returns the
+// status stored by the API server.
+func (j *jobCompletionEmitter) recordJobFailure(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the failed job", "job", job.GetName())
+		return
+	}
+	failures := instance.Status.ConsecutiveFailures + 1
+	instance.Status.ConsecutiveFailures = failures
+	pause := instance.Spec.PauseAfterFailures > 0 && failures >= instance.Spec.PauseAfterFailures && !isPaused(instance)
+	quarantine := instance.Spec.QuarantineAfterFailures > 0 && failures >= instance.Spec.QuarantineAfterFailures && !isQuarantined(instance)
+	if quarantine {
+		instance.Status.QuarantinedGeneration = instance.GetGeneration()
+		setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionQuarantined,
+			Status:  corev1.ConditionTrue,
+			Reason:  "ConsecutiveFailures",
+			Message: fmt.Sprintf("The triggers don't start jobs after %d consecutive failed jobs, until the spec changes or a sync is requested", failures),
+		})
+	}
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+		return
+	}
+	if quarantine {
+		// the status updates don't reconcile the GitOpsConfig, its cronjob is suspended right away
+		err = suspendCronJobs(j.client, instance, true)
+		if err != nil {
+			log.Error(err, "unable to suspend the cronjob of the quarantined GitOpsConfig", "instance", instance.GetName())
+		}
+		log.Info("Quarantining GitOpsConfig after consecutive failures", "instance", instance.GetName(), "failures", failures)
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Warning", "Quarantined", "Quarantined after %d consecutive failed jobs, the last one being %s. The triggers don't start jobs until the spec changes or the %s annotation requests a sync", failures, job.Name, syncAnnotation)
+	}
+	if pause {
+		if instance.ObjectMeta.Annotations == nil {
+			instance.ObjectMeta.Annotations = map[string]string{}
+		}
+		instance.ObjectMeta.Annotations[pausedAnnotation] = "true"
+		err = j.client.Update(context.TODO(), instance)
+		if err != nil {
+			log.Error(err, "unable to pause the GitOpsConfig", "instance", instance.GetName())
+			return
+		}
+		log.Info("Pausing GitOpsConfig after consecutive failures", "instance", instance.GetName(), "failures", failures)
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Warning", "Paused", "Paused after %d consecutive failed jobs, the last one being %s. Remove the %s annotation to resume", failures, job.Name, pausedAnnotation)
+	}
+}
+
+// resetJobFailures clears the count of consecutive failed jobs of owner after a successful job
+func (j *jobCompletionEmitter) resetJobFailures(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the job", "job", job.GetName())
+		return
+	}
+	quarantined := isQuarantined(instance)
+	if instance.Status.ConsecutiveFailures == 0 && !quarantined {
+		return
+	}
+	instance.Status.ConsecutiveFailures = 0
+	if quarantined {
+		// e.g. the job that was running when the GitOpsConfig was quarantined
+		liftQuarantine(j.client, instance, "JobSucceeded", fmt.Sprintf("Job %s finished successfully", job.Name))
+	}
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+		return
+	}
+	if quarantined {
+		log.Info("Lifting the quarantine of GitOpsConfig", "instance", instance.GetName(), "job", job.Name)
+		j.recorder.Eventf(owner, "Normal", "QuarantineLifted", "Quarantine lifted, job %s finished successfully", job.Name)
+	}
+}
+
+// resumeIfReset clears the count of consecutive failed jobs of instance when
+// it was paused by too many failures and the paused annotation was removed
+func (r *ReconcileGitOpsConfig) resumeIfReset(instance *gitopsv1alpha1.GitOpsConfig) error {
+	if isPaused(instance) || instance.Spec.PauseAfterFailures == 0 || instance.Status.ConsecutiveFailures < instance.Spec.PauseAfterFailures {
+		return nil
+	}
+	instance.Status.ConsecutiveFailures = 0
+	err := r.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to reset the consecutive failures of the GitOpsConfig", "instance", instance.GetName())
+		return err
+	}
+	log.Info("Resuming GitOpsConfig", "instance", instance.GetName())
+	r.recorder.Eventf(instance, "Normal", "Resumed", "Resumed after the %s annotation was removed", pausedAnnotation)
+	return nil
+}
+
+// liftQuarantineIfReset ends the quarantine of instance once its spec changed,
+// or a sync is requested, so that the reconcile starts a new run
+func (r *ReconcileGitOpsConfig) liftQuarantineIfReset(instance *gitopsv1alpha1.GitOpsConfig) error {
+	if !isQuarantined(instance) {
+		return nil
+	}
+	var reason, message string
+	switch {
+	case instance.GetGeneration() != instance.Status.QuarantinedGeneration:
+		reason, message = "SpecChanged", "the spec changed"
+	case isSyncRequested(instance):
+		reason, message = "SyncRequested", "a sync was requested"
+	default:
+		return nil
+	}
+	liftQuarantine(r.client, instance, reason, "The triggers start jobs again, "+message)
+	err := r.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to lift the quarantine of the GitOpsConfig", "instance", instance.GetName())
+		return err
+	}
+	log.Info("Lifting the quarantine of GitOpsConfig", "instance", instance.GetName(), "reason", reason)
+	r.recorder.Eventf(instance, "Normal", "QuarantineLifted", "Quarantine lifted, %s", message)
+	return nil
+}
+
+// liftQuarantine clears the Quarantined condition of instance, with reason and
+// message, and resumes its cronjob unless it is paused or suspended. It doesn't
+// reset the consecutive failures: after a spec change or a sync request, the next
+// failed job quarantines instance again. The status of instance is updated by the
+// caller.
+func liftQuarantine(c client.Client, instance *gitopsv1alpha1.GitOpsConfig, reason, message string) {
+	instance.Status.QuarantinedGeneration = 0
+	setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionQuarantined,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+	err := suspendCronJobs(c, instance, isPaused(instance) || isSuspended() || instance.Spec.Suspend)
+	if err != nil {
+		log.Error(err, "unable to resume the cronjob of the GitOpsConfig", "instance", instance.GetName())
+	}
+}
@@ -0,0 +1,388 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newOwnedJob(status batchv1.JobStatus) *batchv1.Job {
+	controller := true
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "gitopsconfig-gitops-operator-abcde",
+			Namespace: namespace,
+			Labels:    map[string]string{"action": "create"},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "eunomia.kohls.io/v1alpha1",
+					Kind:       "GitOpsConfig",
+					Name:       name,
+					Controller: &controller,
+				},
+			},
+		},
+		Status: status,
+	}
+}
+
+func TestPauseAfterFailures(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.PauseAfterFailures = 3
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	req := reconcile.Request{NamespacedName: nsn}
+	fail := func() {
+		emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+		assert.Contains(t, <-recorder.Events, "Warning JobFailed")
+	}
+	countJobs := func() int {
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		return len(jobs.Items)
+	}
+
+	// the breaker stays closed below the threshold
+	fail()
+	fail()
+	current := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.Equal(t, int32(2), current.Status.ConsecutiveFailures)
+	assert.False(t, isPaused(current))
+	assert.Empty(t, recorder.Events)
+
+	// and opens at the threshold
+	fail()
+	assert.Contains(t, <-recorder.Events, "Warning Paused")
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.Equal(t, int32(3), current.Status.ConsecutiveFailures)
+	assert.True(t, isPaused(current))
+
+	// a paused config doesn't run, however many times it is triggered
+	for i := 0; i < 2; i++ {
+		_, err := r.Reconcile(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, countJobs())
+	}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.True(t, isPaused(current))
+	assert.Empty(t, recorder.Events)
+
+	// removing the annotation resumes it
+	delete(current.Annotations, pausedAnnotation)
+	assert.NoError(t, cl.Update(context.TODO(), current))
+	_, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "Normal Resumed")
+	assert.Equal(t, 1, countJobs())
+	resumed := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, resumed))
+	assert.Equal(t, int32(0), resumed.Status.ConsecutiveFailures)
+}
+
+func TestPauseAfterFailuresReset(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name               string
+		pauseAfterFailures int32
+		failures           int
+		succeed            bool
+		paused             bool
+		consecutive        int32
+	}{
+		{"disabled", 0, 5, false, false, 5},
+		{"success resets the count", 2, 1, true, false, 0},
+		{"opens at the threshold", 2, 2, false, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Spec.PauseAfterFailures = tt.pauseAfterFailures
+			cl := fake.NewFakeClient(instance)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(20)}
+			for i := 0; i < tt.failures; i++ {
+				emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+			}
+			if tt.succeed {
+				emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+			}
+
+			current := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, current))
+			assert.Equal(t, tt.paused, isPaused(current))
+			assert.Equal(t, tt.consecutive, current.Status.ConsecutiveFailures)
+		})
+	}
+}
+
+func TestPausedCronJobSuspended(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true", pausedAnnotation: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createCronJob(instance)
+	assert.NoError(t, err)
+
+	cronjob := &batchv1beta1.CronJob{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator", Namespace: namespace}, cronjob))
+	if assert.NotNil(t, cronjob.Spec.Suspend) {
+		assert.True(t, *cronjob.Spec.Suspend)
+	}
+}
+
+func TestQuarantineAfterFailures(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.QuarantineAfterFailures = 2
+	instance.Generation = 1
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	req := reconcile.Request{NamespacedName: nsn}
+	fail := func() {
+		emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+		assert.Contains(t, <-recorder.Events, "Warning JobFailed")
+	}
+	countJobs := func() int {
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		return len(jobs.Items)
+	}
+
+	fail()
+	current := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.Equal(t, int32(1), current.Status.ConsecutiveFailures)
+	assert.False(t, isQuarantined(current))
+	assert.Empty(t, recorder.Events)
+
+	// the threshold quarantines the config, not pausing it
+	fail()
+	assert.Contains(t, <-recorder.Events, "Warning Quarantined")
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.True(t, isQuarantined(current))
+	assert.False(t, isPaused(current))
+	assert.Equal(t, int64(1), current.Status.QuarantinedGeneration)
+
+	// the triggers don't start jobs
+	for i := 0; i < 2; i++ {
+		_, err := r.Reconcile(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, countJobs())
+	}
+	assert.Empty(t, recorder.Events)
+
+	// a new spec lifts the quarantine and runs
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	current.Generation = 2
+	assert.NoError(t, cl.Update(context.TODO(), current))
+	_, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "Normal QuarantineLifted Quarantine lifted, the spec changed", <-recorder.Events)
+	assert.Equal(t, 1, countJobs())
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.False(t, isQuarantined(current))
+	assert.Equal(t, "SpecChanged", getCondition(&current.Status, gitopsv1alpha1.ConditionQuarantined).Reason)
+
+	// the failures are still counted, the next one quarantines it again
+	fail()
+	assert.Contains(t, <-recorder.Events, "Warning Quarantined")
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.True(t, isQuarantined(current))
+	assert.Equal(t, int64(2), current.Status.QuarantinedGeneration)
+}
+
+func TestQuarantineLifted(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name        string
+		update      func(instance *gitopsv1alpha1.GitOpsConfig)
+		succeed     bool
+		quarantined bool
+		consecutive int32
+		event       string
+	}{
+		{"kept", func(instance *gitopsv1alpha1.GitOpsConfig) {}, false, true, 2, ""},
+		{"sync requested", func(instance *gitopsv1alpha1.GitOpsConfig) {
+			instance.Annotations[syncAnnotation] = "2019-10-15T12:00:00Z"
+		}, false, false, 2, "Normal QuarantineLifted Quarantine lifted, a sync was requested"},
+		{"sync already done", func(instance *gitopsv1alpha1.GitOpsConfig) {
+			instance.Annotations[syncAnnotation] = "2019-10-15T12:00:00Z"
+			instance.Status.LastSyncRequest = "2019-10-15T12:00:00Z"
+		}, false, true, 2, ""},
+		{"job succeeded", func(instance *gitopsv1alpha1.GitOpsConfig) {}, true, false, 0, "Normal QuarantineLifted Quarantine lifted, job gitopsconfig-gitops-operator-abcde finished successfully"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Annotations = map[string]string{initLabel: "true"}
+			instance.Spec.QuarantineAfterFailures = 2
+			instance.Status.ConsecutiveFailures = 2
+			setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{Type: gitopsv1alpha1.ConditionQuarantined, Status: corev1.ConditionTrue})
+			tt.update(instance)
+			cl := fake.NewFakeClient(instance)
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+			if tt.succeed {
+				emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+				emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+			} else {
+				_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+				assert.NoError(t, err)
+			}
+
+			current := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, current))
+			assert.Equal(t, tt.quarantined, isQuarantined(current))
+			assert.Equal(t, tt.consecutive, current.Status.ConsecutiveFailures)
+			events := drainEvents(recorder)
+			if tt.event == "" {
+				for _, event := range events {
+					assert.NotContains(t, event, "QuarantineLifted")
+				}
+			} else {
+				assert.Contains(t, events, tt.event)
+			}
+		})
+	}
+}
+
+func TestQuarantinedCronJobSuspended(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+	instance.Spec.QuarantineAfterFailures = 1
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	suspended := func() bool {
+		cronjob := &batchv1beta1.CronJob{}
+		assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator", Namespace: namespace}, cronjob))
+		return cronjob.Spec.Suspend != nil && *cronjob.Spec.Suspend
+	}
+	_, err := r.createCronJob(instance)
+	assert.NoError(t, err)
+	assert.False(t, suspended())
+
+	// the cronjob is suspended as soon as the config is quarantined, and stays suspended when updated
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	assert.True(t, suspended())
+	current := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, current))
+	_, err = r.createCronJob(current)
+	assert.NoError(t, err)
+	assert.True(t, suspended())
+
+	// and resumed with the first successful job
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	assert.False(t, suspended())
+}
+
+// statusSubresourceClient ignores the status on the updates of the GitOpsConfigs, and returns the stored
+// object, as the API server does for the resources with a status subresource
+type statusSubresourceClient struct {
+	client.Client
+}
+
+func (c statusSubresourceClient) Update(ctx context.Context, obj runtime.Object) error {
+	instance, ok := obj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return c.Client.Update(ctx, obj)
+	}
+	stored := &gitopsv1alpha1.GitOpsConfig{}
+	err := c.Client.Get(ctx, types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}, stored)
+	if err != nil {
+		return err
+	}
+	instance.Status = stored.Status
+	err = c.Client.Update(ctx, instance)
+	if err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}, instance)
+}
+
+func TestPauseAfterFailuresStatusSubresource(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.PauseAfterFailures = 2
+	instance.Spec.QuarantineAfterFailures = 2
+	cl := statusSubresourceClient{Client: fake.NewFakeClient(instance)}
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	fail := func() {
+		emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+		assert.Contains(t, <-recorder.Events, "Warning JobFailed")
+	}
+
+	fail()
+	assert.Empty(t, recorder.Events)
+
+	// the count of the failure that pauses the config is stored, and quarantines it at the same threshold
+	fail()
+	assert.Contains(t, <-recorder.Events, "Warning Quarantined")
+	assert.Contains(t, <-recorder.Events, "Warning Paused")
+	current := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.True(t, isPaused(current))
+	assert.True(t, isQuarantined(current))
+	assert.Equal(t, int32(2), current.Status.ConsecutiveFailures)
+
+	// and the next failures keep counting from it
+	fail()
+	assert.NoError(t, cl.Get(context.TODO(), nsn, current))
+	assert.Equal(t, int32(3), current.Status.ConsecutiveFailures)
+}
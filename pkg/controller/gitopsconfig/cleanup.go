@@ -0,0 +1,95 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// cleanupPollInterval is how often the delete job of a GitOpsConfig being deleted is checked for completion
+	cleanupPollInterval = time.Minute
+	// maxCleanupBackoff caps the delay before a failed delete job is relaunched
+	maxCleanupBackoff = 30 * time.Minute
+)
+
+// cleanupBackoff returns how long to wait after the failures-th failed delete job before launching the next one: a
+// minute after the first failure, doubling with each one up to maxCleanupBackoff
+func cleanupBackoff(failures int) time.Duration {
+	backoff := time.Minute
+	for i := 1; i < failures && backoff < maxCleanupBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxCleanupBackoff {
+		return maxCleanupBackoff
+	}
+	return backoff
+}
+
+// lastFailedJob returns the failed job of jobs that finished last, nil if none failed
+func lastFailedJob(jobs []batchv1.Job) (*batchv1.Job, time.Time) {
+	var last *batchv1.Job
+	var lastTime time.Time
+	for i := range jobs {
+		job := &jobs[i]
+		if !isJobFailed(job) {
+			continue
+		}
+		at, _ := jobFinishTime(job)
+		if last == nil || at.After(lastTime) {
+			last, lastTime = job, at
+		}
+	}
+	return last, lastTime
+}
+
+// retryCleanup relaunches the delete job of instance once the backoff following its last failed delete job elapsed.
+// The failure is reported in the CleanupFailed condition and a CleanupFailed event, the finalizer is kept so that the
+// resources aren't left behind.
+func (r *ReconcileGitOpsConfig) retryCleanup(instance *gitopsv1alpha1.GitOpsConfig, failed []batchv1.Job, now time.Time) (reconcile.Result, error) {
+	job, finished := lastFailedJob(failed)
+	backoff := cleanupBackoff(len(failed))
+	changed := setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionCleanupFailed,
+		Status:  corev1.ConditionTrue,
+		Reason:  "DeleteJobFailed",
+		Message: fmt.Sprintf("Delete job %s failed after %d attempts", job.GetName(), len(failed)),
+	})
+	if changed {
+		if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return reconcile.Result{}, err
+		}
+		r.recorder.Eventf(instance, "Warning", "CleanupFailed", "Delete job %s failed, relaunching it in %s", job.GetName(), backoff)
+	}
+	if wait := finished.Add(backoff).Sub(now); wait > 0 {
+		return reconcile.Result{Requeue: true, RequeueAfter: wait}, nil
+	}
+	log.Info("Relaunching the delete job for instance", "instance", instance.GetName(), "failures", len(failed))
+	if _, err := r.CreateJob("delete", instance); err != nil {
+		log.Error(err, "unable to create deletion job")
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{Requeue: true, RequeueAfter: cleanupPollInterval}, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// listDeleteJobs returns the delete jobs of the job namespace
+func listDeleteJobs(t *testing.T, cl client.Client) []batchv1.Job {
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	deleteJobs := []batchv1.Job{}
+	for _, job := range jobs.Items {
+		if job.Labels["action"] == "delete" {
+			deleteJobs = append(deleteJobs, job)
+		}
+	}
+	return deleteJobs
+}
+
+// finishJob sets the status of job to a success or a failure that happened at finished
+func finishJob(t *testing.T, cl client.Client, job batchv1.Job, succeeded bool, finished time.Time) {
+	at := metav1.NewTime(finished)
+	if succeeded {
+		job.Status = batchv1.JobStatus{Succeeded: 1, CompletionTime: &at}
+	} else {
+		job.Status = batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: at},
+		}}
+	}
+	assert.NoError(t, cl.Update(context.TODO(), &job))
+}
+
+func TestCleanupOnDeletion(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.ResourceDeletionMode = "Delete"
+	instance.Finalizers = []string{kubeGitopsFinalizer}
+	cl := fake.NewFakeClient(instance, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+	// the resources are synced
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Empty(t, listDeleteJobs(t, cl))
+
+	// the GitOpsConfig is deleted, a delete job is launched
+	deleted := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, deleted))
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+	assert.NoError(t, cl.Update(context.TODO(), deleted))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	jobs := listDeleteJobs(t, cl)
+	if !assert.Len(t, jobs, 1) {
+		return
+	}
+
+	// the delete job fails, the failure is reported and the finalizer kept until the backoff elapsed
+	finishJob(t, cl, jobs[0], false, time.Now())
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.True(t, result.RequeueAfter > 0 && result.RequeueAfter <= time.Minute)
+	assert.Len(t, listDeleteJobs(t, cl), 1)
+	assert.Contains(t, <-recorder.Events, "Warning CleanupFailed Delete job "+jobs[0].GetName()+" failed, relaunching it in 1m0s")
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.True(t, isConditionTrue(&updated.Status, gitopsv1alpha1.ConditionCleanupFailed))
+	assert.Contains(t, updated.Finalizers, kubeGitopsFinalizer)
+
+	// once the backoff elapsed, the delete job is relaunched
+	finishJob(t, cl, jobs[0], false, time.Now().Add(-2*time.Minute))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	jobs = listDeleteJobs(t, cl)
+	if !assert.Len(t, jobs, 2) {
+		return
+	}
+
+	// the relaunched delete job deletes the resources, the finalizer is removed
+	for _, job := range jobs {
+		if !isJobFinished(&job) {
+			finishJob(t, cl, job, true, time.Now())
+		}
+	}
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	updated = &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.NotContains(t, updated.Finalizers, kubeGitopsFinalizer)
+}
+
+func TestCleanupRetain(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.ResourceDeletionMode = "Retain"
+	instance.Finalizers = []string{kubeGitopsFinalizer}
+	now := metav1.Now()
+	instance.DeletionTimestamp = &now
+	cl := fake.NewFakeClient(instance, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	// the resources are kept, no delete job is launched
+	assert.Empty(t, listDeleteJobs(t, cl))
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.NotContains(t, updated.Finalizers, kubeGitopsFinalizer)
+}
+
+func TestCleanupBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		backoff  time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 30 * time.Minute},
+		{50, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.backoff, cleanupBackoff(tt.failures), "failures: %d", tt.failures)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxClusterUnavailableRetries is the number of times a job failing because the API server is unreachable is relaunched
+const maxClusterUnavailableRetries int = 10
+
+// clusterUnavailableBaseDelay is the delay before the first retry of a job
+// that couldn't reach the API server, doubled at every further attempt
+const clusterUnavailableBaseDelay = 30 * time.Second
+
+// clusterUnavailableMaxDelay caps the delay between retries of jobs that couldn't reach the API server
+const clusterUnavailableMaxDelay = 10 * time.Minute
+
+// the reasons of the ClusterUnavailable condition
+const (
+	// reasonRetrying is the reason while the job that couldn't reach the API server is relaunched
+	reasonRetrying = "Retrying"
+	// reasonRetriesExhausted is the reason once the job isn't relaunched anymore
+	reasonRetriesExhausted = "RetriesExhausted"
+)
+
+// clusterUnavailableErrors are the kubectl and Go network errors telling that the API server could not be reached
+var clusterUnavailableErrors = []string{
+	"Unable to connect to the server",
+	"connection refused",
+	"connection reset by peer",
+	"no route to host",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"net/http: request canceled while waiting for connection",
+	"the server is currently unable to handle the request",
+}
+
+// isClusterUnavailable returns true if the termination message of a failed
+// job, which holds the tail of its logs, shows the API server was unreachable
+func isClusterUnavailable(message string) bool {
+	for _, e := range clusterUnavailableErrors {
+		if strings.Contains(message, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterUnavailableBackoff returns how long to wait before relaunching a job
+// that couldn't reach the API server, after attempt
+func clusterUnavailableBackoff(attempt int) time.Duration {
+	delay := clusterUnavailableBaseDelay
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= clusterUnavailableMaxDelay {
+			return clusterUnavailableMaxDelay
+		}
+	}
+	return delay
+}
+
+// inMaintenanceWindow returns true if now is within one of the maintenance windows of instance
+func inMaintenanceWindow(instance *gitopsv1alpha1.GitOpsConfig, now time.Time) bool {
+	for _, window := range instance.Spec.MaintenanceWindows {
+		if !now.Before(window.Start.Time) && now.Before(window.End.Time) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordClusterUnavailable sets the ClusterUnavailable condition of the GitOpsConfig owning job, which couldn't reach
+// the API server after attempt and is relaunched in delay, or isn't relaunched anymore if retrying is false
+func (j *jobCompletionEmitter) recordClusterUnavailable(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, attempt int, retrying bool, delay time.Duration) {
+	condition := gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionClusterUnavailable,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonRetrying,
+		Message: fmt.Sprintf("Job %s could not reach the API server, retrying in %s (attempt %d of %d)", job.GetName(), delay, attempt+2, maxClusterUnavailableRetries+1),
+	}
+	if !retrying {
+		condition.Reason = reasonRetriesExhausted
+		condition.Message = fmt.Sprintf("Job %s could not reach the API server, giving up after %d attempts", job.GetName(), attempt+1)
+	}
+	j.setOwnerCondition(owner, condition)
+}
+
+// clearClusterUnavailable resets the ClusterUnavailable condition of the GitOpsConfig owning job, which succeeded
+func (j *jobCompletionEmitter) clearClusterUnavailable(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) {
+	j.setOwnerCondition(owner, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionClusterUnavailable,
+		Status:  corev1.ConditionFalse,
+		Reason:  reasonApplied,
+		Message: fmt.Sprintf("Job %s succeeded", job.GetName()),
+	})
+}
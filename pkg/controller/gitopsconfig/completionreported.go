@@ -0,0 +1,94 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"sync"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// completionReportedAnnotation is set on the jobs whose completion was reported, so that it isn't reported again
+// when the job is seen finishing once more, e.g. by the informer of a restarted operator
+const completionReportedAnnotation string = "gitopsconfig.eunomia.kohls.io/completion-reported"
+
+// isCompletionReported returns true if the completion of job was already reported
+func isCompletionReported(job *batchv1.Job) bool {
+	_, ok := job.GetAnnotations()[completionReportedAnnotation]
+	return ok
+}
+
+// markCompletionReported sets the completionReportedAnnotation on job. A job already deleted, e.g. by its retry,
+// is ignored.
+func (j *jobCompletionEmitter) markCompletionReported(job *batchv1.Job) {
+	current := &batchv1.Job{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: job.GetName(), Namespace: job.GetNamespace()}, current)
+	if errors.IsNotFound(err) {
+		return
+	}
+	if err != nil {
+		log.Error(err, "unable to lookup the finished job", "job", job.GetName())
+		return
+	}
+	if isCompletionReported(current) {
+		return
+	}
+	if current.ObjectMeta.Annotations == nil {
+		current.ObjectMeta.Annotations = map[string]string{}
+	}
+	current.ObjectMeta.Annotations[completionReportedAnnotation] = "true"
+	err = j.client.Update(context.TODO(), current)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "unable to mark the completion of the job as reported", "job", job.GetName())
+	}
+}
+
+// reportedJobs holds the UIDs of the jobs whose completion was reported by the
+// operator, so that a job isn't reported twice while its annotation isn't set
+// yet, whichever worker processes its events
+type reportedJobs struct {
+	mutex sync.Mutex
+	uids  map[types.UID]bool
+}
+
+// claim records that the completion of the job with uid is being reported, returning false if it already was.
+// The jobs without a UID are always claimed.
+func (r *reportedJobs) claim(uid types.UID) bool {
+	if uid == "" {
+		return true
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.uids[uid] {
+		return false
+	}
+	if r.uids == nil {
+		r.uids = map[types.UID]bool{}
+	}
+	r.uids[uid] = true
+	return true
+}
+
+// forget removes the job with uid, once it is deleted
+func (r *reportedJobs) forget(uid types.UID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.uids, uid)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCompletionReportedOnce(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	now := time.Now()
+	tests := []struct {
+		name   string
+		status batchv1.JobStatus
+		event  string
+	}{
+		{"success", succeededAt(now), "Normal JobSuccessful"},
+		{"failure", failedAt(now), "Warning JobFailed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newOwnedJob(tt.status)
+			cl := fake.NewFakeClient(gitops.DeepCopy(), job.DeepCopy())
+			recorder := record.NewFakeRecorder(20)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			countEvents := func() int {
+				count := 0
+				for _, event := range drainEvents(recorder) {
+					if strings.HasPrefix(event, tt.event) {
+						count++
+					}
+				}
+				return count
+			}
+
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), job)
+			assert.Equal(t, 1, countEvents())
+
+			reported := &batchv1.Job{}
+			err := cl.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, reported)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, "true", reported.Annotations[completionReportedAnnotation])
+
+			// the informer of a restarted operator replays the same finished job
+			emitter.OnAdd(reported)
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), reported)
+			assert.Equal(t, 0, countEvents())
+		})
+	}
+}
+
+func TestMarkCompletionReportedDeletedJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	// a job deleted before its completion is marked isn't recreated
+	emitter.markCompletionReported(newOwnedJob(succeededAt(time.Now())))
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Empty(t, jobs.Items)
+}
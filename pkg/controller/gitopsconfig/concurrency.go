@@ -0,0 +1,124 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// activeJobPollInterval is how often a run queued behind an active job checks whether the job completed
+const activeJobPollInterval = 15 * time.Second
+
+// queuedRuns records the active job each GitOpsConfig has a run queued behind, so that the queuing is reported
+// once per active job
+var queuedRuns = struct {
+	sync.Mutex
+	jobs map[types.NamespacedName]string
+}{jobs: map[types.NamespacedName]string{}}
+
+// activeJobs returns the jobs of instance that are still running, including the ones started by its CronJob
+func (r *ReconcileGitOpsConfig) activeJobs(instance *gitopsv1alpha1.GitOpsConfig) ([]batchv1.Job, error) {
+	return listActiveJobs(r.client, instance)
+}
+
+// listActiveJobs returns the jobs of instance that are still running, listed with kubeclient
+func listActiveJobs(kubeclient client.Client, instance *gitopsv1alpha1.GitOpsConfig) ([]batchv1.Job, error) {
+	jobList := &batchv1.JobList{}
+	err := kubeclient.List(context.TODO(), &client.ListOptions{Namespace: util.JobNamespace(*instance)}, jobList)
+	if err != nil {
+		log.Error(err, "unable to list jobs")
+		return nil, err
+	}
+	active := []batchv1.Job{}
+	for _, job := range jobList.Items {
+		if isJobFinished(&job) || job.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if isOwner(instance, &job) || isCronJobRun(instance, &job) {
+			active = append(active, job)
+		}
+	}
+	return active, nil
+}
+
+// isCronJobRun returns true if job was started by the CronJob of the scheduled trigger of instance
+func isCronJobRun(instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) bool {
+	ref := metav1.GetControllerOf(job)
+	return ref != nil && ref.Kind == "CronJob" && ref.Name == util.CronJobName(*instance)
+}
+
+// applyConcurrencyPolicy returns how long the next run of instance must wait for its active jobs to complete, with
+// the Forbid policy. With the Replace policy the active jobs are deleted instead, with the Allow policy they are
+// left running.
+func (r *ReconcileGitOpsConfig) applyConcurrencyPolicy(instance *gitopsv1alpha1.GitOpsConfig) (time.Duration, error) {
+	key := types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}
+	policy := instance.Spec.ConcurrencyPolicy
+	if policy == "" || policy == "Allow" {
+		return 0, nil
+	}
+	active, err := r.activeJobs(instance)
+	if err != nil {
+		return 0, err
+	}
+	if len(active) == 0 {
+		queuedRuns.Lock()
+		delete(queuedRuns.jobs, key)
+		queuedRuns.Unlock()
+		return 0, nil
+	}
+	if policy == "Replace" {
+		for i := range active {
+			job := &active[i]
+			err = r.client.Delete(context.TODO(), job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if err != nil && !errors.IsNotFound(err) {
+				log.Error(err, "unable to delete the active job", "job", job.GetName())
+				return 0, err
+			}
+			r.recorder.Eventf(instance, "Normal", "JobReplaced", "Job %s deleted, replaced by a new run", job.GetName())
+		}
+		return 0, nil
+	}
+	job := active[0]
+	// a job whose pod can't start never completes, the run queued behind it is reported blocked
+	pod, reason, err := stuckJobPod(r.client, &job, time.Now())
+	if err != nil {
+		log.Error(err, "unable to check whether the active job is stuck", "job", job.GetName())
+		return 0, err
+	}
+	if pod != nil {
+		log.Info("Active job is stuck, the queued run waits for it", "job", job.GetName(), "pod", pod.GetName(), "reason", reason)
+		return activeJobPollInterval, recordJobStuck(r.client, r.recorder, instance, &job, pod, reason)
+	}
+	queuedRuns.Lock()
+	reported := queuedRuns.jobs[key] == job.GetName()
+	queuedRuns.jobs[key] = job.GetName()
+	queuedRuns.Unlock()
+	if !reported {
+		r.recorder.Eventf(instance, "Normal", "RunQueued", "Run queued until job %s completes", job.GetName())
+	}
+	return activeJobPollInterval, nil
+}
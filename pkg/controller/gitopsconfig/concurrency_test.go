@@ -0,0 +1,141 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newCronJobRun returns an active job started by the CronJob of gitops
+func newCronJobRun() *batchv1.Job {
+	controller := true
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "gitopsconfig-gitops-operator-1234",
+			Namespace: namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: "gitopsconfig-" + name, Controller: &controller},
+			},
+		},
+		Status: batchv1.JobStatus{Active: 1},
+	}
+}
+
+func TestConcurrencyPolicy(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	tests := []struct {
+		name     string
+		policy   string
+		active   *batchv1.Job
+		jobs     int
+		requeued bool
+		event    string
+	}{
+		{"allow", "", newOwnedJob(batchv1.JobStatus{Active: 1}), 2, false, ""},
+		{"forbid", "Forbid", newOwnedJob(batchv1.JobStatus{Active: 1}), 1, true, "Normal RunQueued Run queued until job gitopsconfig-gitops-operator-abcde completes"},
+		{"forbid with an active run of the cronjob", "Forbid", newCronJobRun(), 1, true, "Normal RunQueued Run queued until job gitopsconfig-gitops-operator-1234 completes"},
+		{"forbid without active job", "Forbid", newOwnedJob(succeededAt(metav1.Now().Time)), 2, false, ""},
+		{"replace", "Replace", newOwnedJob(batchv1.JobStatus{Active: 1}), 1, false, "Normal JobReplaced Job gitopsconfig-gitops-operator-abcde deleted, replaced by a new run"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Annotations = map[string]string{initLabel: "true"}
+			instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook"}}
+			instance.Spec.ConcurrencyPolicy = tt.policy
+			cl := fake.NewFakeClient(instance, tt.active)
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+			nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+			result, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.requeued, result.RequeueAfter > 0)
+			jobs := &batchv1.JobList{}
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+			assert.Len(t, jobs.Items, tt.jobs)
+			if tt.policy == "Replace" {
+				for _, job := range jobs.Items {
+					assert.NotEqual(t, tt.active.Name, job.Name, "the active job is deleted")
+				}
+			}
+			events := []string{}
+			for _, event := range drainEvents(recorder) {
+				if strings.HasPrefix(event, "Normal RunQueued") || strings.HasPrefix(event, "Normal JobReplaced") {
+					events = append(events, event)
+				}
+			}
+			if tt.event == "" {
+				assert.Empty(t, events)
+			} else {
+				assert.Equal(t, []string{tt.event}, events)
+			}
+			if !tt.requeued {
+				return
+			}
+
+			// the queued run is only reported once
+			_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+			assert.NoError(t, err)
+			for _, event := range drainEvents(recorder) {
+				assert.False(t, strings.HasPrefix(event, "Normal RunQueued"), "unexpected event %q", event)
+			}
+
+			// the queued run starts once the active job completes
+			tt.active.Status = succeededAt(metav1.Now().Time)
+			assert.NoError(t, cl.Update(context.TODO(), tt.active))
+			result, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+			assert.NoError(t, err)
+			assert.Zero(t, result.RequeueAfter)
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+			assert.Len(t, jobs.Items, 2)
+		})
+	}
+}
+
+func TestCronJobConcurrencyPolicy(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+	instance.Spec.ConcurrencyPolicy = "Forbid"
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createCronJob(instance)
+	assert.NoError(t, err)
+	cronjob := &batchv1beta1.CronJob{}
+	err = cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-" + name, Namespace: namespace}, cronjob)
+	if assert.NoError(t, err) {
+		assert.Equal(t, batchv1beta1.ForbidConcurrent, cronjob.Spec.ConcurrencyPolicy)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// getCondition returns the condition of status with the given type, or nil if it isn't set
+func getCondition(status *gitopsv1alpha1.GitOpsConfigStatus, conditionType gitopsv1alpha1.GitOpsConfigConditionType) *gitopsv1alpha1.GitOpsConfigCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// isConditionTrue returns true if the condition of status with the given type is set and True
+func isConditionTrue(status *gitopsv1alpha1.GitOpsConfigStatus, conditionType gitopsv1alpha1.GitOpsConfigConditionType) bool {
+	condition := getCondition(status, conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// setCondition sets condition in status, returning false if it was already set with the same
+// status, reason and message. The transition time only changes along with the status.
+func setCondition(status *gitopsv1alpha1.GitOpsConfigStatus, condition gitopsv1alpha1.GitOpsConfigCondition) bool {
+	existing := getCondition(status, condition.Type)
+	if existing == nil {
+		condition.LastTransitionTime = metav1.Now()
+		status.Conditions = append(status.Conditions, condition)
+		return true
+	}
+	if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return false
+	}
+	if existing.Status != condition.Status {
+		existing.LastTransitionTime = metav1.Now()
+	}
+	existing.Status = condition.Status
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	return true
+}
+
+// setOwnerCondition stores condition in the status of owner. The configurations where it was never True don't get
+// the condition.
+func (j *jobCompletionEmitter) setOwnerCondition(owner *gitopsv1alpha1.GitOpsConfig, condition gitopsv1alpha1.GitOpsConfigCondition) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig", "instance", owner.GetName())
+		return
+	}
+	if condition.Status != corev1.ConditionTrue && getCondition(&instance.Status, condition.Type) == nil {
+		return
+	}
+	if !setCondition(&instance.Status, condition) {
+		return
+	}
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+	}
+}
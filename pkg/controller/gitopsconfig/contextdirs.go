@@ -0,0 +1,86 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// validateContextDirs verifies that only the template source lists contextDirs, instead of a contextDir, and that
+// they are distinct directories of the repository. The jobs get them as a space-separated list.
+func validateContextDirs(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if len(spec.ParameterSource.ContextDirs) > 0 || spec.ParameterSource.ContinueOnError {
+		return errors.New("parameter source contextDirs and continueOnError are only valid for the template source")
+	}
+	source := spec.TemplateSource
+	if len(source.ContextDirs) == 0 {
+		if source.ContinueOnError {
+			return errors.New("template source continueOnError is only valid with contextDirs")
+		}
+		return nil
+	}
+	if source.ContextDir != "" {
+		return errors.New("template source can't have both a contextDir and contextDirs")
+	}
+	if spec.Kustomize != nil && spec.Kustomize.Overlay != "" {
+		return errors.New("kustomize overlay can't be used with the template source contextDirs")
+	}
+	seen := map[string]bool{}
+	for _, dir := range source.ContextDirs {
+		clean := path.Clean(dir)
+		if dir == "" || strings.ContainsAny(dir, " \t\n") || path.IsAbs(dir) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("template source contextDirs %q is not a directory of the repository", dir)
+		}
+		if seen[clean] {
+			return fmt.Errorf("template source contextDirs %q is listed more than once", dir)
+		}
+		seen[clean] = true
+	}
+	return nil
+}
+
+// validateFilePatterns verifies that only the template source has includePatterns and excludePatterns, which the jobs
+// get as space-separated lists
+func validateFilePatterns(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if len(spec.ParameterSource.IncludePatterns) > 0 || len(spec.ParameterSource.ExcludePatterns) > 0 {
+		return errors.New("parameter source includePatterns and excludePatterns are only valid for the template source")
+	}
+	if err := validatePatterns("excludePatterns", spec.TemplateSource.ExcludePatterns); err != nil {
+		return err
+	}
+	return validatePatterns("includePatterns", spec.TemplateSource.IncludePatterns)
+}
+
+func validatePatterns(field string, patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.Trim(pattern, "/") == "" || strings.ContainsAny(pattern, " \t\n") {
+			return fmt.Errorf("template source %s %q is not a glob pattern of the files of the repository", field, pattern)
+		}
+	}
+	return nil
+}
+
+// describeFailedContextDirs summarizes the render of the contextDirs of the job of report
+func describeFailedContextDirs(report jobReport) string {
+	applied := report.ContextDirCount - len(report.FailedContextDirs)
+	return fmt.Sprintf("applied %d of %d template directories, %s failed to render", applied, report.ContextDirCount, strings.Join(report.FailedContextDirs, ", "))
+}
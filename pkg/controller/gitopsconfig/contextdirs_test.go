@@ -0,0 +1,134 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateContextDirs(t *testing.T) {
+	dirs := func(dirs ...string) gitopsv1alpha1.GitOpsConfigSpec {
+		return gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{ContextDirs: dirs}}
+	}
+	tests := []struct {
+		name   string
+		spec   gitopsv1alpha1.GitOpsConfigSpec
+		errMsg string
+	}{
+		{"none", gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{ContextDir: "."}}, ""},
+		{"dirs", dirs("apps/frontend", "apps/backend/", "./monitoring"), ""},
+		{"continue on error", gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{
+			ContextDirs: []string{"apps/frontend"}, ContinueOnError: true}}, ""},
+		{"continue on error without dirs", gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{ContinueOnError: true}},
+			"template source continueOnError is only valid with contextDirs"},
+		{"parameter source", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{ContextDirs: []string{"params"}}},
+			"parameter source contextDirs and continueOnError are only valid for the template source"},
+		{"contextDir and contextDirs", gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{
+			ContextDir: "apps", ContextDirs: []string{"apps/frontend"}}}, "template source can't have both a contextDir and contextDirs"},
+		{"empty", dirs("apps/frontend", ""), `template source contextDirs "" is not a directory of the repository`},
+		{"absolute", dirs("/apps"), `template source contextDirs "/apps" is not a directory of the repository`},
+		{"parent", dirs("apps/../../secrets"), `template source contextDirs "apps/../../secrets" is not a directory of the repository`},
+		{"whitespace", dirs("apps/front end"), `template source contextDirs "apps/front end" is not a directory of the repository`},
+		{"duplicate", dirs("apps/frontend", "apps/frontend/"), `template source contextDirs "apps/frontend/" is listed more than once`},
+		{"kustomize overlay", gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource: gitopsv1alpha1.GitConfig{ContextDirs: []string{"apps/frontend"}},
+			Kustomize:      &gitopsv1alpha1.KustomizeConfig{Overlay: "overlays/prod"},
+		}, "kustomize overlay can't be used with the template source contextDirs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateContextDirs(tt.spec)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestValidateFilePatterns(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   gitopsv1alpha1.GitOpsConfigSpec
+		errMsg string
+	}{
+		{"none", gitopsv1alpha1.GitOpsConfigSpec{}, ""},
+		{"patterns", gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{
+			ExcludePatterns: []string{"*.md", ".github/"}, IncludePatterns: []string{"deploy/**/*.yaml"}}}, ""},
+		{"parameter source", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{ExcludePatterns: []string{"*.md"}}},
+			"parameter source includePatterns and excludePatterns are only valid for the template source"},
+		{"empty", gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{ExcludePatterns: []string{"/"}}},
+			`template source excludePatterns "/" is not a glob pattern of the files of the repository`},
+		{"whitespace", gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{IncludePatterns: []string{"my app/*"}}},
+			`template source includePatterns "my app/*" is not a glob pattern of the files of the repository`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFilePatterns(tt.spec)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestDefaultSourcesContextDirs(t *testing.T) {
+	spec := gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{ContextDirs: []string{"apps/frontend"}}}
+	defaultSources(&spec)
+	assert.Empty(t, spec.TemplateSource.ContextDir, "the contextDirs replace the contextDir")
+	assert.Equal(t, ".", spec.ParameterSource.ContextDir)
+}
+
+func TestJobCompletionEmitterFailedContextDirs(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource.ContextDir = ""
+	instance.Spec.TemplateSource.ContextDirs = []string{"apps/frontend", "apps/backend", "monitoring"}
+	instance.Spec.TemplateSource.ContinueOnError = true
+	cl := fake.NewFakeClient(instance,
+		newTerminatedPod(`{"commitMessage":"Add the backend","commit":"7d3c9f1","failedContextDirs":["apps/backend"],"contextDirCount":3}`))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	failed := []string{}
+	for _, event := range drainEvents(recorder) {
+		if strings.HasPrefix(event, "Warning ContextDirsFailed") {
+			failed = append(failed, event)
+		}
+	}
+	if assert.Len(t, failed, 1) {
+		assert.Contains(t, failed[0], "gitopsconfig-gitops-operator-abcde applied 2 of 3 template directories, apps/backend failed to render")
+	}
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+	assert.Equal(t, []string{"apps/backend"}, updated.Status.FailedContextDirs)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// templateProcessorImage is the template processor image of the GitOpsConfigs that neither set one nor a
+// templateProcessorType
+var templateProcessorImage = "quay.io/kohlstechnology/eunomia-base:latest"
+
+// SetTemplateProcessorImage configures the template processor image set on the GitOpsConfigs that don't set
+// templateProcessorImage, when their templateProcessorType doesn't have an image of its own
+func SetTemplateProcessorImage(image string) {
+	templateProcessorImage = image
+}
+
+// defaultTemplateProcessor applies the defaults of the templateProcessorType of instance, e.g. its image, and sets
+// the template processor image of the operator when it still doesn't set one
+func defaultTemplateProcessor(instance *gitopsv1alpha1.GitOpsConfig) {
+	defaultHelm(instance)
+	defaultKustomize(instance)
+	defaultJsonnet(instance)
+	if instance.Spec.TemplateProcessorImage == "" {
+		instance.Spec.TemplateProcessorImage = templateProcessorImage
+	}
+}
+
+// DefaultGitOpsConfig sets the fields of instance left empty when it is applied: its template processor image, the
+// CreateOrMerge resourceHandlingMode, the Retain resourceDeletionMode, so that deleting it doesn't delete its
+// resources unless asked, and a service account named after it. The fields set are never changed.
+func DefaultGitOpsConfig(instance *gitopsv1alpha1.GitOpsConfig) {
+	defaultTemplateProcessor(instance)
+	if instance.Spec.ResourceHandlingMode == "" {
+		instance.Spec.ResourceHandlingMode = "CreateOrMerge"
+	}
+	if instance.Spec.ResourceDeletionMode == "" {
+		instance.Spec.ResourceDeletionMode = "Retain"
+	}
+	if instance.Spec.ServiceAccountRef == "" && instance.GetName() != "" {
+		instance.Spec.ServiceAccountRef = instance.GetName()
+	}
+}
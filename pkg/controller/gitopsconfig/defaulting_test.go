@@ -0,0 +1,105 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDefaultGitOpsConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		spec gitopsv1alpha1.GitOpsConfigSpec
+		want gitopsv1alpha1.GitOpsConfigSpec
+	}{
+		{
+			name: "empty",
+			spec: gitopsv1alpha1.GitOpsConfigSpec{},
+			want: gitopsv1alpha1.GitOpsConfigSpec{
+				TemplateProcessorImage: templateProcessorImage,
+				ResourceHandlingMode:   "CreateOrMerge",
+				ResourceDeletionMode:   "Retain",
+				ServiceAccountRef:      "web",
+			},
+		},
+		{
+			name: "set",
+			spec: gitopsv1alpha1.GitOpsConfigSpec{
+				TemplateProcessorImage: "example.com/processor:v1",
+				ResourceHandlingMode:   "Patch",
+				ResourceDeletionMode:   "Delete",
+				ServiceAccountRef:      "deployer",
+			},
+			want: gitopsv1alpha1.GitOpsConfigSpec{
+				TemplateProcessorImage: "example.com/processor:v1",
+				ResourceHandlingMode:   "Patch",
+				ResourceDeletionMode:   "Delete",
+				ServiceAccountRef:      "deployer",
+			},
+		},
+		{
+			name: "partially set",
+			spec: gitopsv1alpha1.GitOpsConfigSpec{
+				ResourceHandlingMode: "None",
+				ServiceAccountRef:    "default",
+			},
+			want: gitopsv1alpha1.GitOpsConfigSpec{
+				TemplateProcessorImage: templateProcessorImage,
+				ResourceHandlingMode:   "None",
+				ResourceDeletionMode:   "Retain",
+				ServiceAccountRef:      "default",
+			},
+		},
+		{
+			name: "helm",
+			spec: gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorType: "Helm"},
+			want: gitopsv1alpha1.GitOpsConfigSpec{
+				TemplateProcessorType:  "Helm",
+				TemplateProcessorImage: helmImage,
+				Helm:                   &gitopsv1alpha1.HelmConfig{ReleaseName: "web"},
+				ResourceHandlingMode:   "CreateOrMerge",
+				ResourceDeletionMode:   "Retain",
+				ServiceAccountRef:      "web",
+			},
+		},
+		{
+			name: "kustomize",
+			spec: gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorType: "Kustomize", ResourceDeletionMode: "Prune"},
+			want: gitopsv1alpha1.GitOpsConfigSpec{
+				TemplateProcessorType:  "Kustomize",
+				TemplateProcessorImage: kustomizeImage,
+				ResourceHandlingMode:   "CreateOrMerge",
+				ResourceDeletionMode:   "Prune",
+				ServiceAccountRef:      "web",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := &gitopsv1alpha1.GitOpsConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+				Spec:       tt.spec,
+			}
+			DefaultGitOpsConfig(instance)
+			assert.Equal(t, tt.want, instance.Spec)
+		})
+	}
+}
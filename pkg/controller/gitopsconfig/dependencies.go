@@ -0,0 +1,141 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// dependencyWaitMinDelay is the delay before the first check of a missing dependency
+const dependencyWaitMinDelay = 5 * time.Second
+
+// dependencyWaitMaxDelay caps the delay between the checks of a missing dependency, zero disables the wait
+var dependencyWaitMaxDelay time.Duration
+
+// SetDependencyWaitMaxDelay configures the longest delay between the checks of the Secrets and ConfigMaps
+// referenced by a GitOpsConfig that don't exist yet. Zero starts the jobs anyway, and they fail.
+func SetDependencyWaitMaxDelay(delay time.Duration) {
+	dependencyWaitMaxDelay = delay
+}
+
+// missingDependency returns the kind and name of the first Secret or ConfigMap referenced by instance
+// that doesn't exist, or an empty string if they all exist
+func (r *ReconcileGitOpsConfig) missingDependency(instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	// the secrets are read directly from the API server like the job profiles, instead of caching all the Secrets of the cluster
+	for _, secret := range sourceSecretRefs(instance) {
+		// the secrets are mounted by the jobs, from their namespace
+		key := types.NamespacedName{Name: secret, Namespace: util.JobNamespace(*instance)}
+		missing, err := isMissing(r.jobProfileReader(), key, &corev1.Secret{})
+		if missing || err != nil {
+			return "Secret " + secret, err
+		}
+	}
+	if missing, err := missingValues(r.jobProfileReader(), util.JobNamespace(*instance), instance); missing != "" || err != nil {
+		return missing, err
+	}
+	if missing, err := missingCABundle(r.jobProfileReader(), util.JobNamespace(*instance), instance); missing != "" || err != nil {
+		return missing, err
+	}
+	if missing, err := missingTargetCluster(r.jobProfileReader(), util.JobNamespace(*instance), instance); missing != "" || err != nil {
+		return missing, err
+	}
+	if instance.Spec.JobProfile != "" && jobProfileNamespace != "" {
+		profile := types.NamespacedName{Name: instance.Spec.JobProfile, Namespace: jobProfileNamespace}
+		missing, err := isMissing(r.jobProfileReader(), profile, &corev1.ConfigMap{})
+		if missing || err != nil {
+			return "ConfigMap " + profile.String(), err
+		}
+	}
+	return "", nil
+}
+
+func isMissing(reader client.Reader, key types.NamespacedName, obj runtime.Object) (bool, error) {
+	err := reader.Get(context.TODO(), key, obj)
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// waitForDependencies returns how long the runs of instance must be deferred because one of
+// the Secrets or ConfigMaps it references doesn't exist yet, zero once they all exist.
+// The WaitingForDependency condition of instance tracks the wait.
+func (r *ReconcileGitOpsConfig) waitForDependencies(instance *gitopsv1alpha1.GitOpsConfig) (time.Duration, error) {
+	if dependencyWaitMaxDelay <= 0 {
+		return 0, nil
+	}
+	missing, err := r.missingDependency(instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the dependencies of the GitOpsConfig", "instance", instance.GetName())
+		return 0, err
+	}
+	if missing == "" {
+		if !isConditionTrue(&instance.Status, gitopsv1alpha1.ConditionWaitingForDependency) {
+			return 0, nil
+		}
+		setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionWaitingForDependency,
+			Status:  corev1.ConditionFalse,
+			Reason:  "DependenciesFound",
+			Message: "All the referenced Secrets and ConfigMaps exist",
+		})
+		if err = r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return 0, err
+		}
+		r.recorder.Event(instance, "Normal", "DependenciesFound", "All the referenced Secrets and ConfigMaps exist, resuming")
+		return 0, nil
+	}
+	changed := setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionWaitingForDependency,
+		Status:  corev1.ConditionTrue,
+		Reason:  "DependencyNotFound",
+		Message: fmt.Sprintf("%s doesn't exist", missing),
+	})
+	if changed {
+		if err = r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return 0, err
+		}
+		r.recorder.Eventf(instance, "Normal", "WaitingForDependency", "Runs deferred until %s exists", missing)
+	}
+	since := getCondition(&instance.Status, gitopsv1alpha1.ConditionWaitingForDependency).LastTransitionTime.Time
+	return dependencyWaitDelay(since, time.Now()), nil
+}
+
+// dependencyWaitDelay returns the delay before checking again a dependency missing since the given time.
+// Waiting as long as the dependency has been missing doubles the delay at every check, up to dependencyWaitMaxDelay.
+func dependencyWaitDelay(since, now time.Time) time.Duration {
+	delay := now.Sub(since)
+	if delay < dependencyWaitMinDelay {
+		delay = dependencyWaitMinDelay
+	}
+	if delay > dependencyWaitMaxDelay {
+		delay = dependencyWaitMaxDelay
+	}
+	return delay
+}
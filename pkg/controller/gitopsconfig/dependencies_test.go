@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestWaitForDependencies(t *testing.T) {
+	SetDependencyWaitMaxDelay(time.Minute)
+	defer SetDependencyWaitMaxDelay(0)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.TemplateSource.SecretRef = "git-creds"
+	instance.Spec.ParameterSource.SecretRef = ""
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+	// the secret doesn't exist yet, the run is deferred
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Equal(t, dependencyWaitMinDelay, result.RequeueAfter)
+	assert.Contains(t, <-recorder.Events, "Normal WaitingForDependency")
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Empty(t, jobs.Items)
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	condition := getCondition(&updated.Status, gitopsv1alpha1.ConditionWaitingForDependency)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, "Secret git-creds doesn't exist", condition.Message)
+	}
+
+	// once it is created, the run proceeds
+	assert.NoError(t, cl.Create(context.TODO(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-creds", Namespace: namespace}}))
+	result, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	assert.Contains(t, <-recorder.Events, "Normal DependenciesFound")
+	jobs = &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Len(t, jobs.Items, 1)
+	updated = &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.False(t, isConditionTrue(&updated.Status, gitopsv1alpha1.ConditionWaitingForDependency))
+}
+
+func TestWaitForDependenciesDisabled(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.TemplateSource.SecretRef = "git-creds"
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+	assert.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Len(t, jobs.Items, 1)
+}
+
+func TestMissingJobProfile(t *testing.T) {
+	SetJobProfileNamespace("eunomia-operator")
+	defer SetJobProfileNamespace("")
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource.SecretRef = ""
+	instance.Spec.ParameterSource.SecretRef = ""
+	instance.Spec.JobProfile = "large"
+	cl := fake.NewFakeClient()
+	r := &ReconcileGitOpsConfig{client: cl, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(10)}
+
+	missing, err := r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Equal(t, "ConfigMap eunomia-operator/large", missing)
+
+	assert.NoError(t, cl.Create(context.TODO(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "large", Namespace: "eunomia-operator"}}))
+	missing, err = r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestDependencyWaitDelay(t *testing.T) {
+	SetDependencyWaitMaxDelay(5 * time.Minute)
+	defer SetDependencyWaitMaxDelay(0)
+	now := time.Now()
+	tests := []struct {
+		name    string
+		missing time.Duration
+		want    time.Duration
+	}{
+		{"just missing", 0, dependencyWaitMinDelay},
+		{"missing for a while", 40 * time.Second, 40 * time.Second},
+		{"missing for long", time.Hour, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, dependencyWaitDelay(now.Add(-tt.missing), now))
+		})
+	}
+}
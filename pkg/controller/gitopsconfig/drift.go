@@ -0,0 +1,43 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"sort"
+)
+
+// isNewDrift returns true if drifted holds resources and differs from the
+// previously reported drift. A persistent drift of the same resources is only
+// reported once.
+func isNewDrift(previous, drifted []string) bool {
+	if len(drifted) == 0 {
+		return false
+	}
+	if len(previous) != len(drifted) {
+		return true
+	}
+	a := append([]string(nil), previous...)
+	b := append([]string(nil), drifted...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// dryRunAnnotation marks the jobs of the GitOpsConfigs with dryRun, which compare the manifests with the live
+// resources without modifying them
+const dryRunAnnotation string = "gitopsconfig.eunomia.kohls.io/dry-run"
+
+// dryRunSummary is what a dry run job reports it would have changed
+type dryRunSummary struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// isDryRunJob returns true if job was created for a GitOpsConfig with dryRun
+func isDryRunJob(job *batchv1.Job) bool {
+	return job.GetAnnotations()[dryRunAnnotation] == "true"
+}
+
+// onDryRunJobSucceeded records in the status of owner what its dry run job would have changed. Nothing was
+// changed, so the applied commit, the inventory and the drift are left untouched, and no event implying a change
+// is recorded.
+func (j *jobCompletionEmitter) onDryRunJobSucceeded(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, now time.Time) {
+	recordJobCompletion(owner, job, "success")
+	terminated, err := getJobTerminatedState(j.client, job)
+	if err != nil {
+		log.Error(err, "unable to lookup the pods of the job", "job", job.GetName())
+	}
+	report := jobReport{}
+	if terminated != nil {
+		report = parseJobReport(terminated.Message)
+	}
+	summary := dryRunSummary{}
+	if report.DryRun != nil {
+		summary = *report.DryRun
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err = j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the job", "job", job.GetName())
+	} else {
+		instance.Status.LastDryRun = &gitopsv1alpha1.DryRunResult{
+			Job:     job.GetName(),
+			Time:    metav1.NewTime(now),
+			Commit:  report.Commit,
+			Created: summary.Created,
+			Updated: summary.Updated,
+			Deleted: summary.Deleted,
+		}
+		err = j.client.Status().Update(context.TODO(), instance)
+		if err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+		}
+	}
+	message := fmt.Sprintf("Dry run %s would create %d, update %d and delete %d resources",
+		describeJob(job), summary.Created, summary.Updated, summary.Deleted)
+	j.recorder.AnnotatedEventf(owner,
+		map[string]string{"job": job.Name},
+		"Normal", "DryRunCompleted", "Dry run %s would create %d, update %d and delete %d resources",
+		describeJob(job), summary.Created, summary.Updated, summary.Deleted)
+	publishSyncEvent(owner, job.Name, "Normal", "DryRunCompleted", message)
+	j.resetJobFailures(owner, job)
+	j.recordAudit(owner, job, "Succeeded", jobReport{})
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDryRunJobs(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	for _, dryRun := range []bool{true, false} {
+		expected := corev1.EnvVar{Name: "DRY_RUN", Value: "false"}
+		if dryRun {
+			expected.Value = "true"
+		}
+		instance := gitops.DeepCopy()
+		instance.Spec.DryRun = dryRun
+		cl := fake.NewFakeClient(instance)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+		for _, action := range []string{"create", "delete"} {
+			_, err := r.CreateJob(action, instance)
+			assert.NoError(t, err)
+		}
+		_, err := r.createCronJob(instance)
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		if assert.Len(t, jobs.Items, 2) {
+			for _, job := range jobs.Items {
+				assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, expected)
+				assert.Equal(t, dryRun, isDryRunJob(&job))
+			}
+		}
+		cronjobs := &batchv1beta1.CronJobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, cronjobs))
+		if assert.Len(t, cronjobs.Items, 1) {
+			assert.Contains(t, cronjobs.Items[0].Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env, expected)
+			assert.Equal(t, dryRun, isDryRunJob(&batchv1.Job{ObjectMeta: cronjobs.Items[0].Spec.JobTemplate.ObjectMeta}))
+		}
+	}
+}
+
+func TestDryRunJobReport(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Status.LastAppliedCommit = "abc"
+	instance.Status.DriftedResources = []string{"apps.v1.Deployment.gitops.frontend"}
+	report := `{"commitMessage":"Scale the frontend","commit":"def","drifted":["apps.v1.Deployment.gitops.backend"],"driftedCount":1,` +
+		`"pruned":[],"dryRun":{"created":2,"updated":1,"deleted":3}}`
+	cl := fake.NewFakeClient(instance, newTerminatedPod(report))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	job := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+	job.Annotations = map[string]string{dryRunAnnotation: "true"}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), job)
+
+	// only the summary is reported, no event implies a change
+	event := <-recorder.Events
+	assert.Contains(t, event, "Normal DryRunCompleted Dry run")
+	assert.Contains(t, event, "gitopsconfig-gitops-operator-abcde")
+	assert.Contains(t, event, "would create")
+	assert.Empty(t, recorder.Events)
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+	if assert.NotNil(t, updated.Status.LastDryRun) {
+		assert.Equal(t, "gitopsconfig-gitops-operator-abcde", updated.Status.LastDryRun.Job)
+		assert.Equal(t, "def", updated.Status.LastDryRun.Commit)
+		assert.Equal(t, 2, updated.Status.LastDryRun.Created)
+		assert.Equal(t, 1, updated.Status.LastDryRun.Updated)
+		assert.Equal(t, 3, updated.Status.LastDryRun.Deleted)
+		assert.False(t, updated.Status.LastDryRun.Time.IsZero())
+	}
+	// nothing was applied
+	assert.Equal(t, "abc", updated.Status.LastAppliedCommit)
+	assert.Equal(t, []string{"apps.v1.Deployment.gitops.frontend"}, updated.Status.DriftedResources)
+	assert.Nil(t, updated.Status.LastSyncTime)
+	assert.Nil(t, getCondition(&updated.Status, gitopsv1alpha1.ConditionSynced))
+	if condition := getCondition(&updated.Status, gitopsv1alpha1.ConditionProgressing); assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	}
+}
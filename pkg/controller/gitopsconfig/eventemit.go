@@ -0,0 +1,156 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"sync"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+var (
+	checkedRecorderOnce sync.Once
+	checkedRecorder     record.EventRecorder
+)
+
+// newCheckedRecorder returns a recorder of the events of the controller reporting the events the API server fails to
+// record, instead of only leaving them to the logs of client-go. It falls back to the recorder of mgr without a
+// clientset.
+func newCheckedRecorder(mgr manager.Manager) record.EventRecorder {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		log.Error(err, "unable to create the clientset recording the events, the events failing to record won't be reported")
+		return mgr.GetRecorder(controllerName)
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&checkedEventSink{
+		sink:   &typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")},
+		reader: mgr.GetClient(),
+	})
+	return broadcaster.NewRecorder(mgr.GetScheme(), corev1.EventSource{Component: controllerName})
+}
+
+// eventRecordTries is the number of times the broadcaster of client-go tries to record an event while it can't reach
+// the API server, its maxTriesPerEvent
+const eventRecordTries = 12
+
+// checkedEventSink records the events with sink, logging the ones it fails to record and counting them in
+// eunomia_event_emit_failures_total so that the lost events, e.g. the completion of a job, can be alerted on. The
+// events of the GitOpsConfigs deleted in the meantime are expected to fail, they are only logged at the debug level.
+type checkedEventSink struct {
+	sink record.EventSink
+	// reader reads the GitOpsConfigs the events failing to record are about
+	reader client.Reader
+
+	mu sync.Mutex
+	// tries counts the failed tries of the events the broadcaster retries, by event
+	tries map[*corev1.Event]int
+}
+
+var _ record.EventSink = &checkedEventSink{}
+
+// Create creates the event, reporting it if it fails for good
+func (s *checkedEventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	created, err := s.sink.Create(event)
+	s.recordTry(event, err)
+	return created, err
+}
+
+// Update updates the event, reporting it if it fails for good
+func (s *checkedEventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	updated, err := s.sink.Update(event)
+	s.recordTry(event, err)
+	return updated, err
+}
+
+// Patch patches the event, reporting it if it fails for good. The events not found are created instead by the
+// broadcaster, in the same try.
+func (s *checkedEventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	patched, err := s.sink.Patch(event, data)
+	if !errors.IsNotFound(err) {
+		s.recordTry(event, err)
+	}
+	return patched, err
+}
+
+// recordTry reports the event once the broadcaster gives up on it: when the API server rejects it or the request can't
+// be built, which aren't retried, or on the last try when the API server can't be reached, the broadcaster trying to
+// record the same event again until then
+func (s *checkedEventSink) recordTry(event *corev1.Event, err error) {
+	s.mu.Lock()
+	final := err != nil
+	switch err.(type) {
+	case nil, *errors.StatusError, *rest.RequestConstructionError:
+	default:
+		if s.tries == nil {
+			s.tries = map[*corev1.Event]int{}
+		}
+		s.tries[event]++
+		final = s.tries[event] >= eventRecordTries
+	}
+	if err == nil || final {
+		delete(s.tries, event)
+	}
+	s.mu.Unlock()
+	if final {
+		s.reportFailure(event, err)
+	}
+}
+
+// reportFailure logs the event that failed to record with err and counts it, unless the GitOpsConfig it is about was
+// deleted. The events already recorded, which the broadcaster tries to create again, aren't lost.
+func (s *checkedEventSink) reportFailure(event *corev1.Event, err error) {
+	if errors.IsAlreadyExists(err) {
+		return
+	}
+	object := event.InvolvedObject
+	if s.isObjectDeleted(object) {
+		log.V(1).Info("Dropping the event of a deleted object", "kind", object.Kind, "namespace", object.Namespace,
+			"name", object.Name, "reason", event.Reason, "error", err.Error())
+		return
+	}
+	log.Error(err, "unable to record the event", "kind", object.Kind, "namespace", object.Namespace, "name", object.Name,
+		"type", event.Type, "reason", event.Reason, "message", event.Message)
+	eventEmitFailures.WithLabelValues(object.Namespace, object.Name, event.Reason).Inc()
+}
+
+// isObjectDeleted returns true if object is a GitOpsConfig that was deleted, is being deleted or was replaced by a
+// GitOpsConfig of the same name
+func (s *checkedEventSink) isObjectDeleted(object corev1.ObjectReference) bool {
+	if object.Kind != "GitOpsConfig" {
+		return false
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := s.reader.Get(context.TODO(), types.NamespacedName{Name: object.Name, Namespace: object.Namespace}, instance)
+	if errors.IsNotFound(err) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	return instance.DeletionTimestamp != nil || (object.UID != "" && object.UID != instance.UID)
+}
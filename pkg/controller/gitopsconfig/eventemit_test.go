@@ -0,0 +1,191 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// failingEventSink is an event sink failing every request with err, counting them
+type failingEventSink struct {
+	err   error
+	calls int
+}
+
+func (s *failingEventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	s.calls++
+	return event, s.err
+}
+
+func (s *failingEventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	s.calls++
+	return event, s.err
+}
+
+func (s *failingEventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	s.calls++
+	return event, s.err
+}
+
+func TestCheckedEventSink(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	deleting := gitops.DeepCopy()
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	events := schema.GroupResource{Resource: "events"}
+	timeout := apierrors.NewServerTimeout(events, "create", 1)
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		uid      string
+		err      error
+		patch    bool
+		failures float64
+	}{
+		{"recorded", []runtime.Object{gitops.DeepCopy()}, "", nil, false, 0},
+		{"transient failure", []runtime.Object{gitops.DeepCopy()}, "", timeout, false, 1},
+		// the broadcaster retries the event, it is only reported on the last try
+		{"connection failure", []runtime.Object{gitops.DeepCopy()}, "", errors.New("connection refused"), false, 0},
+		{"failed patch", []runtime.Object{gitops.DeepCopy()}, "", timeout, true, 1},
+		{"deleted owner", nil, "", apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, namespace), false, 0},
+		{"owner being deleted", []runtime.Object{deleting}, "", apierrors.NewForbidden(events, "", errors.New("namespace is being terminated")), false, 0},
+		{"replaced owner", []runtime.Object{gitops.DeepCopy()}, "old-uid", timeout, false, 0},
+		{"already recorded", []runtime.Object{gitops.DeepCopy()}, "", apierrors.NewAlreadyExists(events, "gitops-operator.1"), false, 0},
+		// the broadcaster creates the events it fails to patch because they expired
+		{"expired event", []runtime.Object{gitops.DeepCopy()}, "", apierrors.NewNotFound(events, "gitops-operator.1"), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &checkedEventSink{sink: &failingEventSink{err: tt.err}, reader: fake.NewFakeClient(tt.objects...)}
+			event := &corev1.Event{
+				InvolvedObject: corev1.ObjectReference{Kind: "GitOpsConfig", Namespace: namespace, Name: name, UID: types.UID(tt.uid)},
+				Type:           "Normal",
+				Reason:         "JobSuccessful",
+				Message:        "Job finished successfully",
+			}
+			failures := testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobSuccessful"))
+
+			var err error
+			if tt.patch {
+				_, err = sink.Patch(event, []byte("{}"))
+			} else {
+				_, err = sink.Create(event)
+			}
+			// the broadcaster still sees the error, to retry the transient ones
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, failures+tt.failures, testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobSuccessful")))
+		})
+	}
+}
+
+func TestCheckedEventSinkLastTry(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	sink := &checkedEventSink{sink: &failingEventSink{err: errors.New("connection refused")}, reader: fake.NewFakeClient(gitops.DeepCopy())}
+	event := &corev1.Event{
+		InvolvedObject: corev1.ObjectReference{Kind: "GitOpsConfig", Namespace: namespace, Name: name},
+		Type:           "Warning",
+		Reason:         "JobFailed",
+		Message:        "Job failed",
+	}
+	failures := testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobFailed"))
+
+	for try := 1; try < eventRecordTries; try++ {
+		sink.Create(event)
+	}
+	assert.Equal(t, failures, testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobFailed")))
+	sink.Create(event)
+	assert.Equal(t, failures+1, testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobFailed")))
+	assert.Empty(t, sink.tries)
+}
+
+// flakyEventSink is an event sink failing the first failures requests with err, then sending the events it records
+// to created
+type flakyEventSink struct {
+	failingEventSink
+	failures int
+	created  chan *corev1.Event
+}
+
+func (s *flakyEventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	if _, err := s.failingEventSink.Create(event); s.calls <= s.failures {
+		return nil, err
+	}
+	s.created <- event
+	return event, nil
+}
+
+func TestCheckedRecorderRetriedEvents(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	flaky := &flakyEventSink{failingEventSink: failingEventSink{err: errors.New("connection refused")}, failures: 1, created: make(chan *corev1.Event, 1)}
+	sink := &checkedEventSink{sink: flaky, reader: fake.NewFakeClient(instance)}
+	broadcaster := record.NewBroadcasterForTests(time.Millisecond)
+	watcher := broadcaster.StartRecordingToSink(sink)
+	defer watcher.Stop()
+	recorder := broadcaster.NewRecorder(s, corev1.EventSource{Component: controllerName})
+	failures := testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobSuccessful"))
+
+	recorder.Event(instance, "Normal", "JobSuccessful", "Job finished successfully")
+	select {
+	case event := <-flaky.created:
+		assert.Equal(t, "JobSuccessful", event.Reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event wasn't recorded")
+	}
+	// the event recorded on its second try isn't lost
+	assert.Equal(t, 2, flaky.calls)
+	assert.Equal(t, failures, testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobSuccessful")))
+	sink.mu.Lock()
+	assert.Empty(t, sink.tries)
+	sink.mu.Unlock()
+}
+
+func TestCheckedRecorderCountsLostEvents(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	failing := &failingEventSink{err: apierrors.NewBadRequest("invalid event")}
+	broadcaster := record.NewBroadcaster()
+	watcher := broadcaster.StartRecordingToSink(&checkedEventSink{sink: failing, reader: fake.NewFakeClient(instance)})
+	defer watcher.Stop()
+	recorder := broadcaster.NewRecorder(s, corev1.EventSource{Component: controllerName})
+	failures := testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobFailed"))
+
+	recorder.AnnotatedEventf(instance, map[string]string{"job": "gitopsconfig-gitops-operator-abcde"}, "Warning", "JobFailed", "Job failed")
+	// the events are recorded asynchronously
+	for i := 0; i < 100 && testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobFailed")) == failures; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, failures+1, testutil.ToFloat64(eventEmitFailures.WithLabelValues(namespace, name, "JobFailed")))
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// eventSummaryInterval is how often the events suppressed by the rate limit are summarized
+const eventSummaryInterval = time.Minute
+
+var (
+	// eventRateLimit is the number of events per minute allowed for each object, zero disables the limit
+	eventRateLimit float64
+	// eventBurst is the number of events allowed at once for each object, above eventRateLimit
+	eventBurst int
+
+	limitedRecorderOnce sync.Once
+	limitedRecorder     *eventLimiter
+)
+
+// SetEventRateLimit limits the events recorded on each GitOpsConfig to perMinute,
+// with bursts of up to burst events. The events above the limit are dropped and
+// periodically summarized in an EventsSuppressed event. Zero disables the limit.
+func SetEventRateLimit(perMinute float64, burst int) {
+	eventRateLimit = perMinute
+	eventBurst = burst
+}
+
+// eventRecorder returns the event recorder of the controller, shared by all its
+// components so that the limit applies to all the events of a GitOpsConfig
+func eventRecorder(mgr manager.Manager) record.EventRecorder {
+	checkedRecorderOnce.Do(func() {
+		checkedRecorder = newCheckedRecorder(mgr)
+	})
+	if eventRateLimit <= 0 || eventBurst <= 0 {
+		return checkedRecorder
+	}
+	limitedRecorderOnce.Do(func() {
+		limitedRecorder = newEventLimiter(checkedRecorder, eventRateLimit, eventBurst, clock.RealClock{})
+	})
+	return limitedRecorder
+}
+
+// eventLimiter is an event recorder with a token bucket per involved object.
+// The events finding the bucket of their object empty are dropped, and counted
+// in an EventsSuppressed event on the object at the next summary.
+type eventLimiter struct {
+	recorder record.EventRecorder
+	qps      float32
+	burst    int
+	clock    clock.Clock
+
+	mutex   sync.Mutex
+	objects map[string]*objectEvents
+}
+
+// objectEvents tracks the events recorded on an object
+type objectEvents struct {
+	limiter flowcontrol.RateLimiter
+	// lastAccepted is when the last event was recorded
+	lastAccepted time.Time
+	// object is the involved object of the last suppressed event
+	object runtime.Object
+	// suppressed is the number of events dropped since the last summary
+	suppressed int
+	// warning is true if one of the suppressed events is a warning
+	warning bool
+	// lastReason and lastMessage describe the last suppressed event
+	lastReason  string
+	lastMessage string
+}
+
+var (
+	_ record.EventRecorder = &eventLimiter{}
+	_ manager.Runnable     = &eventLimiter{}
+)
+
+func newEventLimiter(recorder record.EventRecorder, perMinute float64, burst int, clock clock.Clock) *eventLimiter {
+	return &eventLimiter{
+		recorder: recorder,
+		qps:      float32(perMinute / 60),
+		burst:    burst,
+		clock:    clock,
+		objects:  map[string]*objectEvents{},
+	}
+}
+
+// Event records the event, if the limit of object allows it
+func (l *eventLimiter) Event(object runtime.Object, eventtype, reason, message string) {
+	if l.allow(object, eventtype, reason, message) {
+		l.recorder.Event(object, eventtype, reason, message)
+	}
+}
+
+// Eventf records the event, if the limit of object allows it
+func (l *eventLimiter) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if l.allow(object, eventtype, reason, fmt.Sprintf(messageFmt, args...)) {
+		l.recorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// PastEventf records the event, if the limit of object allows it
+func (l *eventLimiter) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	if l.allow(object, eventtype, reason, fmt.Sprintf(messageFmt, args...)) {
+		l.recorder.PastEventf(object, timestamp, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// AnnotatedEventf records the event, if the limit of object allows it
+func (l *eventLimiter) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if l.allow(object, eventtype, reason, fmt.Sprintf(messageFmt, args...)) {
+		l.recorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// allow takes a token from the bucket of object, returning false if it is
+// empty, in which case the event is counted as suppressed
+func (l *eventLimiter) allow(object runtime.Object, eventtype, reason, message string) bool {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return true
+	}
+	key := fmt.Sprintf("%T/%s/%s", object, accessor.GetNamespace(), accessor.GetName())
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	events, ok := l.objects[key]
+	if !ok {
+		events = &objectEvents{limiter: flowcontrol.NewTokenBucketRateLimiterWithClock(l.qps, l.burst, l.clock)}
+		l.objects[key] = events
+	}
+	if events.limiter.TryAccept() {
+		events.lastAccepted = l.clock.Now()
+		return true
+	}
+	events.object = object.DeepCopyObject()
+	events.suppressed++
+	events.warning = events.warning || eventtype == corev1.EventTypeWarning
+	events.lastReason = reason
+	events.lastMessage = message
+	return false
+}
+
+// summarize records an EventsSuppressed event on every object whose events
+// were suppressed since the last summary. The objects whose bucket is full
+// again are forgotten.
+func (l *eventLimiter) summarize() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	refill := time.Duration(float64(l.burst) / float64(l.qps) * float64(time.Second))
+	for key, events := range l.objects {
+		if events.suppressed == 0 {
+			if l.clock.Since(events.lastAccepted) > refill {
+				delete(l.objects, key)
+			}
+			continue
+		}
+		eventtype := corev1.EventTypeNormal
+		if events.warning {
+			eventtype = corev1.EventTypeWarning
+		}
+		l.recorder.Eventf(events.object, eventtype, "EventsSuppressed",
+			"%d events suppressed by the rate limit, the last one: %s: %s", events.suppressed, events.lastReason, events.lastMessage)
+		events.object = nil
+		events.suppressed = 0
+		events.warning = false
+	}
+}
+
+// Start summarizes the suppressed events every eventSummaryInterval, until stopCh is closed
+func (l *eventLimiter) Start(stopCh <-chan struct{}) error {
+	ticker := time.NewTicker(eventSummaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			l.summarize()
+			return nil
+		case <-ticker.C:
+			l.summarize()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEventLimiter(t *testing.T) {
+	recorder := record.NewFakeRecorder(20)
+	fakeClock := clock.NewFakeClock(time.Now())
+	// 3 events at once, then one per minute
+	limiter := newEventLimiter(recorder, 1, 3, fakeClock)
+	other := gitops.DeepCopy()
+	other.Name = "other"
+
+	for i := 1; i <= 5; i++ {
+		limiter.Eventf(gitops, "Warning", "JobFailed", "Job failed: job-%d", i)
+	}
+	limiter.Eventf(other, "Normal", "JobSuccessful", "Job finished successfully: job-1")
+	assert.Equal(t, []string{
+		"Warning JobFailed Job failed: job-1",
+		"Warning JobFailed Job failed: job-2",
+		"Warning JobFailed Job failed: job-3",
+		// the other configs have their own limit
+		"Normal JobSuccessful Job finished successfully: job-1",
+	}, drainEvents(recorder))
+
+	limiter.summarize()
+	assert.Equal(t, []string{
+		"Warning EventsSuppressed 2 events suppressed by the rate limit, the last one: JobFailed: Job failed: job-5",
+	}, drainEvents(recorder))
+	limiter.summarize()
+	assert.Empty(t, drainEvents(recorder), "the suppressed events are summarized once")
+
+	// the bucket is refilled at the rate
+	fakeClock.Step(time.Minute)
+	limiter.Event(gitops, "Normal", "JobSuccessful", "Job finished successfully: job-6")
+	limiter.Event(gitops, "Normal", "JobSuccessful", "Job finished successfully: job-7")
+	assert.Equal(t, []string{"Normal JobSuccessful Job finished successfully: job-6"}, drainEvents(recorder))
+	limiter.summarize()
+	assert.Equal(t, []string{
+		"Normal EventsSuppressed 1 events suppressed by the rate limit, the last one: JobSuccessful: Job finished successfully: job-7",
+	}, drainEvents(recorder))
+
+	// the objects whose bucket is full again are forgotten
+	fakeClock.Step(5 * time.Minute)
+	limiter.summarize()
+	assert.Empty(t, limiter.objects)
+}
+
+func TestEventLimiterAnnotatedEvents(t *testing.T) {
+	recorder := record.NewFakeRecorder(20)
+	limiter := newEventLimiter(recorder, 1, 1, clock.NewFakeClock(time.Now()))
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	instance.Namespace = namespace
+	instance.Name = name
+
+	limiter.AnnotatedEventf(instance, map[string]string{"job": "job-1"}, "Normal", "JobStarted", "Job %s started", "job-1")
+	limiter.AnnotatedEventf(instance, map[string]string{"job": "job-2"}, "Normal", "JobStarted", "Job %s started", "job-2")
+	assert.Len(t, drainEvents(recorder), 1)
+	limiter.summarize()
+	assert.Equal(t, []string{
+		"Normal EventsSuppressed 1 events suppressed by the rate limit, the last one: JobStarted: Job job-2 started",
+	}, drainEvents(recorder))
+}
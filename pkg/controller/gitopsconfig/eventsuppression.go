@@ -0,0 +1,101 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// validateEventNotifications verifies the reasons of the suppressed events
+func validateEventNotifications(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.Notifications == nil {
+		return nil
+	}
+	for _, reason := range spec.Notifications.Suppress {
+		if reason == "" {
+			return fmt.Errorf("notifications suppress cannot contain an empty reason")
+		}
+	}
+	return nil
+}
+
+// suppressingRecorder is the event recorder of the job watch. It drops the events recorded on a GitOpsConfig whose
+// reason it suppresses in its notifications, the GitOpsConfig being read with reader since the job watch only knows
+// the name of the owner of a job.
+type suppressingRecorder struct {
+	recorder record.EventRecorder
+	reader   client.Reader
+}
+
+var _ record.EventRecorder = &suppressingRecorder{}
+
+// Event records the event, unless object suppresses its reason
+func (s *suppressingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if !s.suppressed(object, reason) {
+		s.recorder.Event(object, eventtype, reason, message)
+	}
+}
+
+// Eventf records the event, unless object suppresses its reason
+func (s *suppressingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if !s.suppressed(object, reason) {
+		s.recorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// PastEventf records the event, unless object suppresses its reason
+func (s *suppressingRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	if !s.suppressed(object, reason) {
+		s.recorder.PastEventf(object, timestamp, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// AnnotatedEventf records the event, unless object suppresses its reason
+func (s *suppressingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if !s.suppressed(object, reason) {
+		s.recorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	}
+}
+
+// suppressed returns true if object is a GitOpsConfig suppressing the events of reason. The events are recorded when
+// it can't be read.
+func (s *suppressingRecorder) suppressed(object runtime.Object, reason string) bool {
+	owner, ok := object.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return false
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := s.reader.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil || instance.Spec.Notifications == nil {
+		return false
+	}
+	for _, suppressed := range instance.Spec.Notifications.Suppress {
+		if suppressed == reason {
+			log.Info("Not recording suppressed event", "instance", owner.GetName(), "reason", reason)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateEventNotifications(t *testing.T) {
+	assert.NoError(t, validateEventNotifications(gitopsv1alpha1.GitOpsConfigSpec{}))
+	assert.NoError(t, validateEventNotifications(gitopsv1alpha1.GitOpsConfigSpec{Notifications: &gitopsv1alpha1.EventNotifications{Suppress: []string{"JobFailed"}}}))
+	assert.EqualError(t, validateEventNotifications(gitopsv1alpha1.GitOpsConfigSpec{Notifications: &gitopsv1alpha1.EventNotifications{Suppress: []string{"JobFailed", ""}}}),
+		"notifications suppress cannot contain an empty reason")
+}
+
+func TestSuppressedEvents(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.Notifications = &gitopsv1alpha1.EventNotifications{Suppress: []string{"JobFailed"}}
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: &suppressingRecorder{recorder: recorder, reader: cl}}
+	failures := testutil.ToFloat64(jobCompletions.WithLabelValues(namespace, name, "failure"))
+
+	// the other events still fire
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{}), newOwnedJob(batchv1.JobStatus{Active: 1}))
+	assert.Contains(t, <-recorder.Events, "Normal JobStarted")
+
+	// the suppressed ones don't, while the status and the metrics are updated
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	for _, event := range drainEvents(recorder) {
+		assert.NotContains(t, event, "JobFailed")
+	}
+	current := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, current))
+	assert.Equal(t, int32(1), current.Status.ConsecutiveFailures)
+	assert.Equal(t, failures+1, testutil.ToFloat64(jobCompletions.WithLabelValues(namespace, name, "failure")))
+
+	// the GitOpsConfigs that don't suppress them get them
+	current.Spec.Notifications = nil
+	assert.NoError(t, cl.Update(context.TODO(), current))
+	emitter.reported = reportedJobs{}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	assert.Contains(t, <-recorder.Events, "Warning JobFailed")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// forbiddenPattern matches the lines printed by the template processor of a failed job, before its phase, for every
+// request the API server denied, e.g.
+// eunomia-forbidden: User "system:serviceaccount:gitops:eunomia-runner" cannot get resource "deployments" in API group "apps" in the namespace "team-a"
+var forbiddenPattern = regexp.MustCompile(`(?m)^eunomia-forbidden: User "([^"]+)" cannot (\S+) resource "([^"]+)"(?: in API group "([^"]*)")?(?: in the namespace "([^"]+)")?`)
+
+// deniedRequest is a request the API server denied to the service account of a job
+type deniedRequest struct {
+	user      string
+	verb      string
+	resource  string
+	group     string
+	namespace string
+}
+
+// String describes the denied request, e.g. get deployments.apps in the namespace team-a
+func (d deniedRequest) String() string {
+	resource := d.resource
+	if d.group != "" {
+		resource += "." + d.group
+	}
+	if d.namespace == "" {
+		return fmt.Sprintf("%s %s at the cluster scope", d.verb, resource)
+	}
+	return fmt.Sprintf("%s %s in the namespace %s", d.verb, resource, d.namespace)
+}
+
+// deniedRequests returns the requests the API server denied to a failed job, printed in its termination message
+func deniedRequests(message string) []deniedRequest {
+	denied := []deniedRequest{}
+	for _, match := range forbiddenPattern.FindAllStringSubmatch(message, -1) {
+		denied = append(denied, deniedRequest{user: match[1], verb: match[2], resource: match[3], group: match[4], namespace: match[5]})
+	}
+	return denied
+}
+
+// describeUser returns the service account user is, e.g. the service account gitops/eunomia-runner for
+// system:serviceaccount:gitops:eunomia-runner, or user itself
+func describeUser(user string) string {
+	parts := strings.Split(user, ":")
+	if len(parts) == 4 && parts[0] == "system" && parts[1] == "serviceaccount" {
+		return fmt.Sprintf("the service account %s/%s", parts[2], parts[3])
+	}
+	return user
+}
+
+// recordForbidden reports the requests the service account of job wasn't allowed to make, found in the termination
+// message of the failed job, with a Forbidden event each, and sets the Degraded condition of the GitOpsConfig owning
+// it, so that the missing permissions are told apart from the other failures
+func (j *jobCompletionEmitter) recordForbidden(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, eventType string, message string) {
+	denied := deniedRequests(message)
+	if len(denied) == 0 {
+		return
+	}
+	descriptions := []string{}
+	for _, request := range denied {
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			eventType, reasonForbidden, "Job %s failed, %s is not allowed to %s", job.Name, describeUser(request.user), request.String())
+		descriptions = append(descriptions, request.String())
+	}
+	j.setOwnerCondition(owner, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:   gitopsv1alpha1.ConditionDegraded,
+		Status: corev1.ConditionTrue,
+		Reason: reasonForbidden,
+		Message: fmt.Sprintf("Job %s failed, %s is not allowed to %s", job.Name, describeUser(denied[0].user),
+			strings.Join(descriptions, "; ")),
+	})
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// forbiddenMessage is the termination message of a job whose service account can neither read the deployments of
+// team-a nor list the namespaces
+const forbiddenMessage = `from server for: "web.yaml": deployments.apps "web" is forbidden: User "system:serviceaccount:gitops:eunomia-runner" cannot get resource "deployments" in API group "apps" in the namespace "team-a"
+eunomia-forbidden: User "system:serviceaccount:gitops:eunomia-runner" cannot get resource "deployments" in API group "apps" in the namespace "team-a"
+eunomia-forbidden: User "system:serviceaccount:gitops:eunomia-runner" cannot list resource "namespaces" in API group "" at the cluster scope
+eunomia-phase: Apply
+`
+
+func TestDeniedRequests(t *testing.T) {
+	denied := deniedRequests(forbiddenMessage)
+	if assert.Len(t, denied, 2) {
+		assert.Equal(t, "system:serviceaccount:gitops:eunomia-runner", denied[0].user)
+		assert.Equal(t, "get deployments.apps in the namespace team-a", denied[0].String())
+		assert.Equal(t, "list namespaces at the cluster scope", denied[1].String())
+	}
+	assert.Empty(t, deniedRequests("error: unable to recognize \"web.yaml\"\neunomia-phase: Apply\n"))
+}
+
+func TestDescribeUser(t *testing.T) {
+	assert.Equal(t, "the service account gitops/eunomia-runner", describeUser("system:serviceaccount:gitops:eunomia-runner"))
+	assert.Equal(t, "jane@example.com", describeUser("jane@example.com"))
+}
+
+func TestForbidden(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(forbiddenMessage))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	assert.Contains(t, <-recorder.Events, "Warning JobFailed")
+	assert.Contains(t, <-recorder.Events, "Warning ApplyFailed")
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning Forbidden")
+	assert.Contains(t, event, "the service account gitops/eunomia-runner")
+	assert.Contains(t, event, "get deployments.apps in the namespace team-a")
+	assert.Contains(t, <-recorder.Events, "Warning Forbidden")
+
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+	degraded := getCondition(&instance.Status, gitopsv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, degraded) {
+		assert.Equal(t, corev1.ConditionTrue, degraded.Status)
+		assert.Equal(t, "Forbidden", degraded.Reason)
+		assert.Equal(t, "Job gitopsconfig-gitops-operator-abcde failed, the service account gitops/eunomia-runner is not allowed to "+
+			"get deployments.apps in the namespace team-a; list namespaces at the cluster scope", degraded.Message)
+	}
+}
+
+func TestNotForbidden(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod("eunomia-phase: Apply\n"))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	close(recorder.Events)
+	for event := range recorder.Events {
+		assert.NotContains(t, event, "Forbidden")
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+	assert.Nil(t, getCondition(&instance.Status, gitopsv1alpha1.ConditionDegraded))
+}
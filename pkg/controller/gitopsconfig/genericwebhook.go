@@ -0,0 +1,53 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// validateGenericWebhook verifies the paths of the generic webhook mapping of the triggers of spec, which is only
+// read for the Webhook trigger
+func validateGenericWebhook(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	for _, trigger := range spec.Triggers {
+		if trigger.Generic == nil {
+			continue
+		}
+		if trigger.Type != "Webhook" {
+			return fmt.Errorf("generic is only valid with the Webhook trigger, not the %s trigger", trigger.Type)
+		}
+		paths := []struct{ field, path string }{
+			{"repoPath", trigger.Generic.RepoPath},
+			{"refPath", trigger.Generic.RefPath},
+			{"commitPath", trigger.Generic.CommitPath},
+		}
+		for _, p := range paths {
+			if p.path == "" {
+				continue
+			}
+			for _, segment := range strings.Split(strings.TrimPrefix(p.path, "$."), ".") {
+				if segment == "" {
+					return fmt.Errorf("generic %s %q has an empty segment", p.field, p.path)
+				}
+			}
+		}
+	}
+	return nil
+}
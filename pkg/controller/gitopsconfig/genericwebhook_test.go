@@ -0,0 +1,49 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGenericWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger gitopsv1alpha1.GitOpsTrigger
+		valid   bool
+	}{
+		{name: "without mapping", trigger: gitopsv1alpha1.GitOpsTrigger{Type: "Webhook"}, valid: true},
+		{name: "default mapping", trigger: gitopsv1alpha1.GitOpsTrigger{Type: "Webhook", Generic: &gitopsv1alpha1.GenericWebhook{}}, valid: true},
+		{name: "nested paths", trigger: gitopsv1alpha1.GitOpsTrigger{Type: "Webhook", Generic: &gitopsv1alpha1.GenericWebhook{RepoPath: "$.build.repo", RefPath: "build.refs.0"}}, valid: true},
+		{name: "empty segment", trigger: gitopsv1alpha1.GitOpsTrigger{Type: "Webhook", Generic: &gitopsv1alpha1.GenericWebhook{RefPath: "build..ref"}}},
+		{name: "trailing dot", trigger: gitopsv1alpha1.GitOpsTrigger{Type: "Webhook", Generic: &gitopsv1alpha1.GenericWebhook{CommitPath: "commit."}}},
+		{name: "periodic trigger", trigger: gitopsv1alpha1.GitOpsTrigger{Type: "Periodic", Cron: "0 * * * *", Generic: &gitopsv1alpha1.GenericWebhook{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGenericWebhook(gitopsv1alpha1.GitOpsConfigSpec{Triggers: []gitopsv1alpha1.GitOpsTrigger{tt.trigger}})
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -18,7 +18,9 @@ package gitopsconfig
 
 import (
 	"context"
-	goerrors "errors"
+	"fmt"
+	"reflect"
+	"strconv"
 
 	"k8s.io/apimachinery/pkg/labels"
 
@@ -34,12 +36,15 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -49,6 +54,11 @@ var log = logf.Log.WithName("controller_gitopsconfig")
 
 const initLabel string = "gitopsconfig.eunomia.kohls.io/initialized"
 const kubeGitopsFinalizer string = "eunomia-finalizer"
+const controllerName string = "gitopsconfig-controller"
+const cronJobCreatedAnnotation string = "gitopsconfig.eunomia.kohls.io/cronjob-created"
+
+// operatorAnnotations are set and cleared on the GitOpsConfigs by the operator itself, their changes don't trigger new runs
+var operatorAnnotations = []string{cronJobCreatedAnnotation}
 
 // PushEvents channel on which we get the github webhook push events
 var PushEvents = make(chan event.GenericEvent)
@@ -66,24 +76,44 @@ func Add(mgr manager.Manager) error {
 
 // NewGitOpsReconciler creates a new git ops reconciler
 func NewGitOpsReconciler(mgr manager.Manager) ReconcileGitOpsConfig {
-	return ReconcileGitOpsConfig{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	return ReconcileGitOpsConfig{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: eventRecorder(mgr)}
 }
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileGitOpsConfig{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+	r := &ReconcileGitOpsConfig{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: eventRecorder(mgr)}
+	// job profiles are read directly from the API server, instead of caching all the ConfigMaps of the cluster
+	reader, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		log.Error(err, "unable to create the client reading job profiles, using the cached client")
+	} else {
+		r.profileReader = reader
+	}
+	return r
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	// Create a new controller
-	c, err := controller.New("gitopsconfig-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
 	if err != nil {
 		return err
 	}
 
 	// Watch for changes to primary resource GitOpsConfig
-	err = c.Watch(&source.Kind{Type: &gitopsv1alpha1.GitOpsConfig{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(&source.Kind{Type: &gitopsv1alpha1.GitOpsConfig{}}, &handler.EnqueueRequestForObject{}, predicate.Funcs{
+		// status updates, and the removal of the override of the resource handling mode once
+		// a run is started, are made by the operator itself and must not trigger new runs
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !isStatusOnlyUpdate(e.ObjectOld, e.ObjectNew) && !isRunHandlingModeCleared(e.ObjectOld, e.ObjectNew)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The GitOpsConfigs are counted by state as their status conditions change
+	err = c.Watch(&source.Kind{Type: &gitopsv1alpha1.GitOpsConfig{}}, recordConfigStates())
 	if err != nil {
 		return err
 	}
@@ -95,6 +125,133 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	if err != nil {
 		return err
 	}
+
+	// The runs queued by the maximum concurrent jobs are started as the jobs complete
+	err = c.Watch(
+		&source.Channel{Source: jobSlotEvents},
+		&handler.EnqueueRequestForObject{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Watch for the deletion of the CronJobs of periodic triggers, so that they are recreated if deleted out of band
+	err = c.Watch(&source.Kind{Type: &batchv1beta1.CronJob{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &gitopsv1alpha1.GitOpsConfig{},
+	}, deletesOnly)
+	if err != nil {
+		return err
+	}
+	// the CronJobs created in the jobNamespace of a GitOpsConfig name it in their annotations
+	err = c.Watch(&source.Kind{Type: &batchv1beta1.CronJob{}}, enqueueAnnotatedOwner, deletesOnly)
+	if err != nil {
+		return err
+	}
+	// the GitOpsConfigs with a targetNamespaceSelector run again when the namespaces they select change
+	err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, enqueueSelectingConfigs(mgr.GetClient()))
+	if err != nil {
+		return err
+	}
+	// the GitOpsConfigs run again when the Secrets their jobs use change, e.g. rotated credentials
+	if resyncOnSecretChange {
+		err = mgr.GetFieldIndexer().IndexField(&gitopsv1alpha1.GitOpsConfig{}, secretRefsIndex, indexSecretRefs)
+		if err != nil {
+			return err
+		}
+		err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, enqueueReferencingConfigs(mgr.GetClient()))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Watch for changes to Jobs, to report on their completion
+	emitter := &jobCompletionEmitter{
+		client: mgr.GetClient(),
+		scheme: mgr.GetScheme(),
+		// the GitOpsConfigs may suppress some of the events of their jobs
+		recorder: &suppressingRecorder{recorder: eventRecorder(mgr), reader: mgr.GetClient()},
+		audit:    auditSink,
+	}
+	// the notification secrets are read directly from the API server, instead of caching all the Secrets of the cluster
+	secretReader, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		log.Error(err, "unable to create the client reading notification secrets, using the cached client")
+	} else {
+		emitter.secretReader = secretReader
+		// the intermediate controllers of the jobs are read from the API server too, they may be of any kind
+		emitter.ownerReader = secretReader
+	}
+	// the logs of the failed pods are read with a clientset, the client can't read the log subresource
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		log.Error(err, "unable to create the clientset reading the logs of the failed jobs, they won't be reported")
+	} else {
+		emitter.clientset = clientset
+	}
+	var jobHandler cache.ResourceEventHandler = emitter
+	if jobEventWorkers > 1 {
+		// the jobs of unrelated GitOpsConfigs are reported in parallel
+		dispatcher := newJobEventDispatcher(emitter, jobEventWorkers)
+		err = mgr.Add(dispatcher)
+		if err != nil {
+			return err
+		}
+		jobHandler = dispatcher
+	}
+	watchdog, err := newJobWatchdog(mgr.GetConfig(), jobHandler)
+	if err != nil {
+		return err
+	}
+	// The watchdog restarts the watch on Jobs if it stops delivering events
+	err = mgr.Add(watchdog)
+	if err != nil {
+		return err
+	}
+	runningWatchdog = watchdog
+	// The events suppressed by the rate limit are summarized periodically
+	if limiter, ok := eventRecorder(mgr).(*eventLimiter); ok {
+		err = mgr.Add(limiter)
+		if err != nil {
+			return err
+		}
+	}
+	if jobStuckTimeout > 0 {
+		// the jobs whose pod can't start neither succeed nor fail, they are reported stuck
+		err = mgr.Add(&stuckJobChecker{client: mgr.GetClient(), recorder: eventRecorder(mgr)})
+		if err != nil {
+			return err
+		}
+	}
+	if suspendConfigMap.Name != "" {
+		// the kill switch is read directly from the API server, like the job profiles
+		reader, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+		if err != nil {
+			return err
+		}
+		err = mgr.Add(&suspendWatcher{client: mgr.GetClient(), reader: reader, recorder: eventRecorder(mgr)})
+		if err != nil {
+			return err
+		}
+	}
+	// the semver ranges are resolved again, for the scheduled runs to deploy the new matching tags
+	if reconciler, ok := r.(*ReconcileGitOpsConfig); ok {
+		err = mgr.Add(&semVerPoller{reconciler: reconciler})
+		if err != nil {
+			return err
+		}
+	}
+	if remotePollInterval > 0 {
+		// the git credentials are read directly from the API server, like the job profiles
+		reader, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+		if err != nil {
+			return err
+		}
+		err = mgr.Add(&remoteHeadPoller{client: mgr.GetClient(), reader: reader})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 
 }
@@ -105,8 +262,11 @@ var _ reconcile.Reconciler = &ReconcileGitOpsConfig{}
 type ReconcileGitOpsConfig struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	// profileReader reads the job profiles and the referenced secrets from the API server, the client is used if nil
+	profileReader client.Reader
 }
 
 // Reconcile reads that state of the cluster for a GitOpsConfig object and makes changes based on the state read
@@ -124,6 +284,8 @@ func (r *ReconcileGitOpsConfig) Reconcile(request reconcile.Request) (reconcile.
 
 	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
 	reqLogger.Info("Reconciling GitOpsConfig")
+	span := startReconcileSpan(request.NamespacedName)
+	defer span.End()
 
 	// Fetch the GitOpsConfig instance
 	instance := &gitopsv1alpha1.GitOpsConfig{}
@@ -131,9 +293,9 @@ func (r *ReconcileGitOpsConfig) Reconcile(request reconcile.Request) (reconcile.
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Owned objects are automatically garbage collected, not the cronjobs of other namespaces.
 			// Return and don't requeue
-			return reconcile.Result{}, nil
+			return reconcile.Result{}, r.deleteStaleCronJobs(request.NamespacedName, types.NamespacedName{})
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
@@ -142,6 +304,10 @@ func (r *ReconcileGitOpsConfig) Reconcile(request reconcile.Request) (reconcile.
 
 	//object is being deleted
 	if !instance.ObjectMeta.DeletionTimestamp.IsZero() {
+		// the cronjob of another namespace mustn't start runs while the resources are deleted
+		if err = r.deleteStaleCronJobs(request.NamespacedName, types.NamespacedName{}); err != nil {
+			return reconcile.Result{}, err
+		}
 		return r.manageDeletion(instance)
 	}
 
@@ -152,25 +318,173 @@ func (r *ReconcileGitOpsConfig) Reconcile(request reconcile.Request) (reconcile.
 
 	reqLogger.Info("Instance is initialized", "instance", instance.GetName())
 
-	if ContainsTrigger(instance, "Periodic") {
-		reqLogger.Info("Instance has a periodic trigger, creating/updating cronjob", "instance", instance.GetName())
+	err = r.recordWebhookSecretFingerprint(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	err = r.recordInputsHash(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	err = r.resumeIfReset(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.liftQuarantineIfReset(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	wait, err := r.waitForDependencies(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if wait > 0 {
+		// the jobs would fail without their credentials or profile, the triggers are kept for when they exist
+		reqLogger.Info("Instance references a missing Secret or ConfigMap, deferring", "instance", instance.GetName(), "delay", wait)
+		return reconcile.Result{RequeueAfter: wait}, nil
+	}
+
+	// the failed reconcile is retried until the Secrets are fixed, they are only watched with resyncOnSecretChange
+	err = r.validateSecrets(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.validateParameterValues(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.checkTargetCluster(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// the cronjob left in a previous jobNamespace isn't garbage collected
+	err = r.deleteStaleCronJobs(request.NamespacedName, types.NamespacedName{Name: util.CronJobName(*instance), Namespace: util.JobNamespace(*instance)})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if hasScheduledTrigger(instance) {
+		reqLogger.Info("Instance has a scheduled trigger, creating/updating cronjob", "instance", instance.GetName())
 		_, err = r.createCronJob(instance)
 		if err != nil {
 			reqLogger.Error(err, "error creating the cronjob, continuing...")
 		}
+	} else if err = r.clearCronJobCreated(instance); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if suspendErr := recordSuspended(r.client, r.recorder, instance, isSuspended()); suspendErr != nil {
+		return reconcile.Result{}, suspendErr
+	}
+	if isSuspended() {
+		reqLogger.Info("Kill switch is engaged, not creating job", "instance", instance.GetName())
+		return reconcile.Result{}, err
+	}
+	if instance.Spec.Suspend {
+		reqLogger.Info("Instance is suspended, not creating job", "instance", instance.GetName())
+		return reconcile.Result{}, err
 	}
 
-	if ContainsTrigger(instance, "Change") || ContainsTrigger(instance, "Webhook") {
+	if isPaused(instance) {
+		reqLogger.Info("Instance is paused, not creating job", "instance", instance.GetName())
+		return reconcile.Result{}, err
+	}
+	if isQuarantined(instance) {
+		// the pushes received meanwhile aren't deployed once the quarantine ends, the next run deploys the latest commit
+		takeTriggerContext(request.NamespacedName)
+		reqLogger.Info("Instance is quarantined, not creating job", "instance", instance.GetName())
+		return reconcile.Result{}, err
+	}
+
+	if isSyncRequested(instance) {
+		// the requested run replaces the one of the change trigger, a single job is created
+		wait, err = r.syncOnRequest(instance)
+		if wait > 0 {
+			reqLogger.Info("Instance has an active job, queuing the requested job", "instance", instance.GetName(), "delay", wait)
+			return reconcile.Result{RequeueAfter: wait}, err
+		}
+	} else if ContainsTrigger(instance, "Change") || ContainsTrigger(instance, "Webhook") {
+		wait, err = r.minRunIntervalRemaining(instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if wait > 0 {
+			// coalesce the triggers received within the interval into a single run at its end
+			reqLogger.Info("Instance ran less than minRunInterval ago, deferring job", "instance", instance.GetName(), "delay", wait)
+			r.deferRun(instance, wait)
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
+		wait, err = r.applyConcurrencyPolicy(instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if wait > 0 {
+			// the triggers received meanwhile are coalesced into a single run once the active jobs complete
+			reqLogger.Info("Instance has an active job, queuing job", "instance", instance.GetName(), "delay", wait)
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
+		wait = r.waitForJobSlot(instance)
+		if wait > 0 {
+			// the run starts once enough jobs of all the GitOpsConfigs complete, the triggers are kept meanwhile
+			reqLogger.Info("Maximum concurrent jobs reached, queuing job", "instance", instance.GetName())
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
+		trigger := takeTriggerContext(request.NamespacedName)
+		if trigger != nil && trigger.Deleted && DependsOnBranch(instance) {
+			return r.teardownBranch(instance, trigger)
+		}
+		parameterFile, resolveErr := resolveParameterFile(instance, trigger)
+		if resolveErr != nil {
+			// retrying can't help, the context of the trigger is gone
+			reqLogger.Error(resolveErr, "unable to resolve the parameter file, not creating job")
+			r.recorder.Eventf(instance, "Warning", "ParameterFileUnresolved", "Run not started: %s", resolveErr)
+			recordChangeTrigger(instance, trigger, true)
+			return reconcile.Result{}, nil
+		}
+		pushedRef, refErr := resolvePushedRef(instance, trigger)
+		if refErr != nil {
+			reqLogger.Error(refErr, "unable to resolve the ref to deploy, not creating job")
+			r.recorder.Eventf(instance, "Warning", "RefUnresolved", "Run not started: %s", refErr)
+			recordChangeTrigger(instance, trigger, true)
+			return reconcile.Result{}, nil
+		}
+		if _, modeErr := getRunHandlingMode(instance); modeErr != nil {
+			reqLogger.Error(modeErr, "invalid resource handling mode override, not creating job")
+			r.recorder.Eventf(instance, "Warning", "InvalidResourceHandlingMode", "Run not started: %s", modeErr)
+			recordChangeTrigger(instance, trigger, true)
+			return reconcile.Result{}, r.clearRunHandlingMode(instance)
+		}
 		reqLogger.Info("Instance has a change or Webhook trigger, creating job", "instance", instance.GetName())
-		_, err = r.CreateJob("create", instance)
+		commit := ""
+		triggerType := "Change"
+		if trigger != nil {
+			commit = trigger.Commit
+			triggerType = "Webhook"
+		}
+		_, err = r.createJob("create", withTraceParent(withTrigger(instance, triggerType), span), 0, parameterFile, pushedRef, commit)
 		if err != nil {
 			reqLogger.Error(err, "error creating the job, continuing...")
+			releaseJobSlot(instance)
+		} else {
+			r.recordCoalescedTriggers(instance)
+			recordChangeTrigger(instance, trigger, false)
+			if err = r.clearRunHandlingMode(instance); err == nil {
+				err = r.recordParameterFile(instance, parameterFile)
+			}
 		}
 	}
 
 	return reconcile.Result{}, err
 }
 
+// GetRecorder returns the recorder of the events on the GitOpsConfig
+func (r *ReconcileGitOpsConfig) GetRecorder() record.EventRecorder {
+	return r.recorder
+}
+
 // ContainsTrigger returns true if the passed instance contains the given trigger
 func ContainsTrigger(instance *gitopsv1alpha1.GitOpsConfig, triggeType string) bool {
 	for _, trigger := range instance.Spec.Triggers {
@@ -181,19 +495,174 @@ func ContainsTrigger(instance *gitopsv1alpha1.GitOpsConfig, triggeType string) b
 	return false
 }
 
-// CreateJob creates a new gitops job for the passed instance
+// minRunIntervalRemaining returns how long to wait before a new job of instance can
+// be started according to its minRunInterval, based on its most recent create job,
+// including the runs of its scheduled triggers.
+func (r *ReconcileGitOpsConfig) minRunIntervalRemaining(instance *gitopsv1alpha1.GitOpsConfig) (time.Duration, error) {
+	if instance.Spec.MinRunInterval.Duration <= 0 {
+		return 0, nil
+	}
+	jobList := &batchv1.JobList{}
+	err := r.client.List(context.TODO(), &client.ListOptions{Namespace: util.JobNamespace(*instance)}, jobList)
+	if err != nil {
+		log.Error(err, "unable to list jobs")
+		return 0, err
+	}
+	var lastRun time.Time
+	for _, job := range jobList.Items {
+		if !(isOwner(instance, &job) && job.GetLabels()["action"] == "create") && !isCronJobRun(instance, &job) {
+			continue
+		}
+		if job.CreationTimestamp.Time.After(lastRun) {
+			lastRun = job.CreationTimestamp.Time
+		}
+	}
+	if lastRun.IsZero() {
+		return 0, nil
+	}
+	return time.Until(lastRun.Add(instance.Spec.MinRunInterval.Duration)), nil
+}
+
+// CreateJob creates a new gitops job for the passed instance, with the parameter file of its last run
 func (r *ReconcileGitOpsConfig) CreateJob(jobtype string, instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error) {
+	parameterFile := instance.Status.ParameterFile
+	if parameterFile == "" {
+		var err error
+		parameterFile, err = resolveParameterFile(instance, nil)
+		if err != nil {
+			log.Error(err, "unable to resolve the parameter file", "instance", instance.GetName())
+			return reconcile.Result{}, err
+		}
+	}
+	return r.createJob(jobtype, instance, 0, parameterFile, "", "")
+}
+
+// createJob creates a new gitops job for the passed instance, attempt is the number of retries that preceded it,
+// parameterFile the resolved fileName of its parameter source, ref the pushed ref deployed by the sources whose ref
+// is a pattern and commit the pushed commit that triggered it, if known
+func (r *ReconcileGitOpsConfig) createJob(jobtype string, instance *gitopsv1alpha1.GitOpsConfig, attempt int, parameterFile string, ref string, commit string) (reconcile.Result, error) {
 	//TODO add logic to ignore if another job was created sooner than x (5 minutes?) time and it is still running.
+	if isSuspended() {
+		log.Info("Kill switch is engaged, not creating job", "instance", instance.GetName(), "action", jobtype)
+		return reconcile.Result{}, errSuspended
+	}
+	if instance.Spec.Suspend {
+		log.Info("Instance is suspended, not creating job", "instance", instance.GetName(), "action", jobtype)
+		return reconcile.Result{}, errConfigSuspended
+	}
+	err := r.checkJobNamespaceAccess(instance, "jobs")
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	image, err := r.verifyImageSignature(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.verifyPinnedImage(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	run, err := withRunHandlingMode(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	run = withPushedRef(run, ref)
+	run, err = r.withSemVerTag(run, jobtype)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// the namespaces selected by the targetNamespaceSelector only change what the job is given, not the inputs hash
+	target, err := r.withTargetNamespaces(run, jobtype)
+	if err == errNoTargetNamespaces && jobtype != "delete" {
+		log.Info("No target namespace, not creating job", "instance", instance.GetName(), "action", jobtype)
+		r.recorder.Event(instance, "Warning", "NoTargetNamespaces", "No job was created, the targetNamespaceSelector matches no namespace")
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if image != target.Spec.TemplateProcessorImage {
+		// the GitOpsConfig keeps its image, only the job runs the verified digest
+		target = target.DeepCopy()
+		target.Spec.TemplateProcessorImage = image
+	}
+	traceParent, parentSpanID := newRunSpan(instance)
 	mergedata := util.JobMergeData{
-		Config: *instance,
-		Action: jobtype,
+		Config:        *target,
+		Action:        jobtype,
+		ParameterFile: parameterFile,
+		Commit:        commit,
+		TraceParent:   traceParent,
 	}
 	job, err := util.CreateJob(mergedata)
 	if err != nil {
 		log.Error(err, "unable to create job manifest from merge data", "mergedata", mergedata)
 		return reconcile.Result{}, err
 	}
-	err = controllerutil.SetControllerReference(instance, &job, r.scheme)
+	err = r.applyJobProfile(instance, &job.Spec)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if attempt > 0 {
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		job.Annotations[jobAttemptAnnotation] = strconv.Itoa(attempt)
+	}
+	if parameterFile != "" {
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		// retries of the job use the same parameter file
+		job.Annotations[parameterFileAnnotation] = parameterFile
+	}
+	if ref != "" {
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		// retries of the job deploy the same ref
+		job.Annotations[refAnnotation] = ref
+	}
+	if commit != "" {
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		// retries of the job are named after the same commit
+		job.Annotations[commitAnnotation] = commit
+	}
+	if trigger := instance.GetAnnotations()[triggerAnnotation]; trigger != "" {
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		// retries of the job are reported as started by the same trigger
+		job.Annotations[triggerAnnotation] = trigger
+	}
+	if run != instance {
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		// retries of the job use the same resource handling mode
+		job.Annotations[runHandlingModeAnnotation] = run.Spec.ResourceHandlingMode
+	}
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	// combined with the commits reported by the job once it succeeds
+	job.Annotations[inputsHashAnnotation] = specInputsHash(run, parameterFile)
+	if instance.Spec.DryRun {
+		// the job reports what it would change instead of changing it
+		job.Annotations[dryRunAnnotation] = "true"
+	}
+	if traceParent != "" {
+		// the span of the run is exported once the job completes
+		job.Annotations[traceParentAnnotation] = traceParent
+		if parentSpanID != "" {
+			job.Annotations[parentSpanAnnotation] = parentSpanID
+		}
+	}
+	applyJobMetadata(instance, &job.ObjectMeta)
+	applyPodMetadata(instance, &job.Spec.Template.ObjectMeta)
+	err = setJobOwner(instance, &job, r.scheme)
 	if err != nil {
 		log.Error(err, "unable to the owner for job", "job", job)
 		return reconcile.Result{}, err
@@ -205,22 +674,87 @@ func (r *ReconcileGitOpsConfig) CreateJob(jobtype string, instance *gitopsv1alph
 		log.Error(err, "unable to create the job", "job", job)
 		return reconcile.Result{}, err
 	}
-	return reconcile.Result{}, nil
+	return reconcile.Result{}, r.recordResolvedRef(instance, run)
 }
 
 func (r *ReconcileGitOpsConfig) createCronJob(instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error) {
+	err := r.checkJobNamespaceAccess(instance, "cronjobs")
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// the jobs of the cronjob run the digest verified when it is created or updated
+	image, err := r.verifyImageSignature(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	err = r.verifyPinnedImage(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// periodic runs aren't triggered by a push, the fileName cannot depend on it
+	parameterFile, err := resolveParameterFile(instance, nil)
+	if err != nil {
+		log.Error(err, "unable to resolve the parameter file of the cronjob", "instance", instance.GetName())
+		return reconcile.Result{}, err
+	}
+	// the cronjob is updated with the new tags matching a semver range, see semVerPoller
+	run, err := r.withSemVerTag(instance, "create")
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	target, err := r.withTargetNamespaces(run, "create")
+	if err == errNoTargetNamespaces {
+		log.Info("No target namespace, not creating cronjob", "instance", instance.GetName())
+		r.recorder.Event(instance, "Warning", "NoTargetNamespaces", "The cronjob wasn't created or updated, the targetNamespaceSelector matches no namespace")
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if image != target.Spec.TemplateProcessorImage {
+		// the GitOpsConfig keeps its image, only the job runs the verified digest
+		target = target.DeepCopy()
+		target.Spec.TemplateProcessorImage = image
+	}
 	mergedata := util.JobMergeData{
-		Config: *instance,
-		Action: "create",
+		Config:        *target,
+		Action:        "create",
+		ParameterFile: parameterFile,
 	}
 
 	var update bool
 
+	err = r.recordParameterFile(instance, parameterFile)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
 	cronjob, err := util.CreateCronJob(mergedata)
 	if err != nil {
 		log.Error(err, "unable to create cronjob manifest from merge data", "mergedata", mergedata)
 		return reconcile.Result{}, err
 	}
+	err = r.applyJobProfile(instance, &cronjob.Spec.JobTemplate.Spec)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	applyJobMetadata(instance, &cronjob.ObjectMeta)
+	// the jobs started by the cronjob get the metadata too
+	applyJobMetadata(instance, &cronjob.Spec.JobTemplate.ObjectMeta)
+	applyPodMetadata(instance, &cronjob.Spec.JobTemplate.Spec.Template.ObjectMeta)
+	if cronjob.Spec.JobTemplate.Annotations == nil {
+		cronjob.Spec.JobTemplate.Annotations = map[string]string{}
+	}
+	cronjob.Spec.JobTemplate.Annotations[inputsHashAnnotation] = specInputsHash(run, parameterFile)
+	if trigger := util.ScheduleTrigger(*instance); trigger != nil {
+		cronjob.Spec.JobTemplate.Annotations[triggerAnnotation] = trigger.Type
+	}
+	if instance.Spec.DryRun {
+		cronjob.Spec.JobTemplate.Annotations[dryRunAnnotation] = "true"
+	}
+	// the cronjob of a paused, quarantined or suspended instance is kept, but doesn't start jobs
+	paused := isPaused(instance) || isQuarantined(instance) || isSuspended() || instance.Spec.Suspend
+	cronjob.Spec.Suspend = &paused
 
 	pCronjob := batchv1beta1.CronJob{}
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: cronjob.GetName(), Namespace: cronjob.GetNamespace()}, &pCronjob)
@@ -234,12 +768,23 @@ func (r *ReconcileGitOpsConfig) createCronJob(instance *gitopsv1alpha1.GitOpsCon
 	} else {
 		update = true
 	}
+	if update && cronjob.GetNamespace() != instance.GetNamespace() && !isAnnotatedOwner(instance, &pCronjob) {
+		r.recorder.Eventf(instance, "Warning", "CronJobConflict", "CronJob %s of namespace %s belongs to another GitOpsConfig", cronjob.GetName(), cronjob.GetNamespace())
+		return reconcile.Result{}, fmt.Errorf("cronjob %s of namespace %s belongs to another GitOpsConfig", cronjob.GetName(), cronjob.GetNamespace())
+	}
 
-	err = controllerutil.SetControllerReference(instance, &cronjob, r.scheme)
+	err = setJobOwner(instance, &cronjob, r.scheme)
 	if err != nil {
 		log.Error(err, "unable to the owner for cronjob", "cronjob", cronjob)
 		return reconcile.Result{}, err
 	}
+	if cronjob.GetNamespace() != instance.GetNamespace() {
+		// the jobs of the cronjob name their GitOpsConfig like the cronjob, the cronjob name doesn't tell it
+		err = setJobOwner(instance, &cronjob.Spec.JobTemplate, r.scheme)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
 	log.Info("Creating/updating CronJob", "cronjob.Namespace", cronjob.Namespace, "cronjob.Name", cronjob.Name)
 	if update {
 		err = r.client.Update(context.TODO(), &cronjob)
@@ -251,9 +796,46 @@ func (r *ReconcileGitOpsConfig) createCronJob(instance *gitopsv1alpha1.GitOpsCon
 		log.Error(err, "unable to create/update the cronjob", "cronjob", cronjob)
 		return reconcile.Result{}, err
 	}
+	err = r.recordResolvedRef(instance, run)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if update {
+		return reconcile.Result{}, nil
+	}
+
+	// A missing cronjob for an instance that already had one was deleted out of band
+	if _, ok := instance.GetAnnotations()[cronJobCreatedAnnotation]; ok {
+		log.Info("Recreated missing CronJob", "cronjob.Namespace", cronjob.Namespace, "cronjob.Name", cronjob.Name)
+		r.recorder.Eventf(instance, "Normal", "CronJobRecreated", "Recreated missing CronJob %s with schedule %s", cronjob.Name, cronjob.Spec.Schedule)
+		return reconcile.Result{}, nil
+	}
+	if instance.ObjectMeta.Annotations == nil {
+		instance.ObjectMeta.Annotations = map[string]string{}
+	}
+	instance.ObjectMeta.Annotations[cronJobCreatedAnnotation] = "true"
+	err = r.client.Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to mark the cronjob as created", "instance", instance.GetName())
+		return reconcile.Result{}, err
+	}
 	return reconcile.Result{}, nil
 }
 
+// clearCronJobCreated forgets that the cronjob of instance was created once its scheduled trigger is removed, so that
+// the cronjob of a trigger added again isn't reported as recreated
+func (r *ReconcileGitOpsConfig) clearCronJobCreated(instance *gitopsv1alpha1.GitOpsConfig) error {
+	if _, ok := instance.GetAnnotations()[cronJobCreatedAnnotation]; !ok {
+		return nil
+	}
+	delete(instance.Annotations, cronJobCreatedAnnotation)
+	err := r.client.Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to clear the cronjob created annotation", "instance", instance.GetName())
+	}
+	return err
+}
+
 // GetAllGitOpsConfig retrieves all the gitops config in the cluster
 func (r *ReconcileGitOpsConfig) GetAllGitOpsConfig() (gitopsv1alpha1.GitOpsConfigList, error) {
 	instanceList := &gitopsv1alpha1.GitOpsConfigList{}
@@ -267,40 +849,35 @@ func (r *ReconcileGitOpsConfig) GetAllGitOpsConfig() (gitopsv1alpha1.GitOpsConfi
 
 func (r *ReconcileGitOpsConfig) initializeGitOpsConfig(instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error) {
 	// verify mandatory field exist and set defaults
-	if instance.Spec.TemplateSource.URI == "" {
-		//TODO set wrong status
-		return reconcile.Result{}, goerrors.New("template source URI cannot be empty")
+	defaultSources(&instance.Spec)
+	if err := validateSpec(instance.Spec); err != nil {
+		return reconcile.Result{}, err
 	}
 
-	if instance.Spec.TemplateSource.Ref == "" {
-		instance.Spec.TemplateSource.Ref = "master"
+	if instance.Spec.ServiceAccountRef == "" {
+		instance.Spec.ServiceAccountRef = "default"
 	}
 
-	if instance.Spec.TemplateSource.ContextDir == "" {
-		instance.Spec.TemplateSource.ContextDir = "."
-	}
+	defaultTemplateProcessor(instance)
 
-	if instance.Spec.ParameterSource.URI == "" {
-		instance.Spec.ParameterSource.URI = instance.Spec.TemplateSource.URI
-	}
-	if instance.Spec.ParameterSource.Ref == "" {
-		instance.Spec.ParameterSource.Ref = "master"
+	if instance.Spec.ResourceHandlingMode == "" {
+		instance.Spec.ResourceHandlingMode = "CreateOrMerge"
 	}
 
-	if instance.Spec.ParameterSource.ContextDir == "" {
-		instance.Spec.ParameterSource.ContextDir = "."
+	if instance.Spec.ResourceDeletionMode == "" {
+		instance.Spec.ResourceDeletionMode = "Delete"
 	}
 
-	if instance.Spec.ServiceAccountRef == "" {
-		instance.Spec.ServiceAccountRef = "default"
+	if instance.Spec.FieldValidation == "" {
+		instance.Spec.FieldValidation = "Warn"
 	}
 
-	if instance.Spec.ResourceHandlingMode == "" {
-		instance.Spec.ResourceHandlingMode = "CreateOrMerge"
+	if instance.Spec.PrunePolicy == "" {
+		instance.Spec.PrunePolicy = "ApplyThenPrune"
 	}
 
-	if instance.Spec.ResourceDeletionMode == "" {
-		instance.Spec.ResourceDeletionMode = "Delete"
+	if instance.Spec.EmptyRenderPolicy == "" {
+		instance.Spec.EmptyRenderPolicy = "Fail"
 	}
 
 	instance.ObjectMeta.Annotations[initLabel] = "true"
@@ -338,81 +915,135 @@ func removeString(slice []string, s string) (result []string) {
 
 func (r *ReconcileGitOpsConfig) manageDeletion(instance *gitopsv1alpha1.GitOpsConfig) (reconcile.Result, error) {
 	log.Info("Instance is being deleted", "instance", instance.GetName())
-	if containsString(instance.ObjectMeta.Finalizers, kubeGitopsFinalizer) {
-		// we need to lookup the delete job and if it doesn't exist we launch it, then we see if it is completed successfully if yes we remove the finalizers, if no we return.
-		jobList := &batchv1.JobList{}
-		selector, err := labels.Parse("action=delete")
-		if err != nil {
-			log.Error(err, "unable to parse label selector 'action=delete' ")
-			return reconcile.Result{}, err
-		}
-		// looking up all delete jobs
-		err = r.client.List(context.TODO(), &client.ListOptions{
-			Namespace:     instance.GetNamespace(),
-			LabelSelector: selector,
-		}, jobList)
-		if err != nil {
-			log.Error(err, "unable to list jobs ")
-			return reconcile.Result{}, err
+	if !containsString(instance.ObjectMeta.Finalizers, kubeGitopsFinalizer) {
+		return reconcile.Result{}, nil
+	}
+	if instance.Spec.ResourceDeletionMode == "Retain" {
+		// switched to Retain after the finalizer was added, the resources are kept
+		return reconcile.Result{}, r.removeFinalizer(instance)
+	}
+	// we need to lookup the delete jobs and if none exists we launch one, then we see if one completed successfully if yes we remove the finalizers, if no we return.
+	jobList := &batchv1.JobList{}
+	selector, err := labels.Parse("action=delete")
+	if err != nil {
+		log.Error(err, "unable to parse label selector 'action=delete' ")
+		return reconcile.Result{}, err
+	}
+	// looking up all delete jobs
+	err = r.client.List(context.TODO(), &client.ListOptions{
+		Namespace:     util.JobNamespace(*instance),
+		LabelSelector: selector,
+	}, jobList)
+	if err != nil {
+		log.Error(err, "unable to list jobs ")
+		return reconcile.Result{}, err
+	}
+	applicableJobList := []batchv1.Job{}
+	//filtering by those that were created by this gitopsconfig once it was deleted
+	for _, job := range jobList.Items {
+		if isDeletionJob(instance, &job) {
+			applicableJobList = append(applicableJobList, job)
 		}
-		applicableJobList := []batchv1.Job{}
-		//filtering by those that are might have been created by this gitopsconfig
-		// TODO better filter by owner reference
-		for _, job := range jobList.Items {
-			if isOwner(instance, &job) && job.GetLabels()["action"] == "delete" {
-				applicableJobList = append(applicableJobList, job)
-			}
+	}
+	for i := range applicableJobList {
+		if isJobSucceeded(&applicableJobList[i]) {
+			return reconcile.Result{}, r.removeFinalizer(instance)
 		}
-		if len(applicableJobList) == 0 {
-			// to avoid a deadlock situation let's check that the namespace in which we are is not being deleted
-			ns := &corev1.Namespace{}
-			err := r.client.Get(context.TODO(), types.NamespacedName{
-				Name: instance.GetNamespace(),
-			}, ns)
-			if err != nil {
-				log.Error(err, "unable to lookup instance's namespace")
-				return reconcile.Result{}, err
-			}
-			if !ns.ObjectMeta.DeletionTimestamp.IsZero() {
-				//namespace is being deleted
-				// the best we can do in this situation is to let the instance be deleted and hope that this instance was creating objects only in this namespace
-				instance.ObjectMeta.Finalizers = removeString(instance.ObjectMeta.Finalizers, kubeGitopsFinalizer)
-				if err := r.client.Update(context.TODO(), instance); err != nil {
-					log.Error(err, "unable to create update instace to remove finalizers")
-					return reconcile.Result{}, err
-				}
-				return reconcile.Result{}, nil
-			}
-			log.Info("Launching delete job for instance", "instance", instance.GetName())
-			_, err = r.CreateJob("delete", instance)
-			if err != nil {
-				log.Error(err, "unable to create deletion job")
-				return reconcile.Result{}, err
-			}
-			//we return because we need to wait for the job to stop
+	}
+	for i := range applicableJobList {
+		if !isJobFinished(&applicableJobList[i]) {
+			//we wait for the running job to stop
 			return reconcile.Result{
 				Requeue:      true,
-				RequeueAfter: time.Minute,
+				RequeueAfter: cleanupPollInterval,
 			}, nil
 		}
-		//There should be only one pending job
-		job := applicableJobList[0]
-		if job.Status.Succeeded > 0 {
-			instance.ObjectMeta.Finalizers = removeString(instance.ObjectMeta.Finalizers, kubeGitopsFinalizer)
-			if err := r.client.Update(context.TODO(), instance); err != nil {
-				log.Error(err, "unable to create update instace to remove finalizers")
-				return reconcile.Result{}, err
-			}
-			return reconcile.Result{}, nil
-		}
-		//if it's not succeeded we wait for 1 minute
-		//TODO add logic to stop at a certain point ... or not ...
-		return reconcile.Result{
-			Requeue:      true,
-			RequeueAfter: time.Minute,
-		}, nil
 	}
-	return reconcile.Result{}, nil
+	if len(applicableJobList) > 0 {
+		// all the delete jobs failed
+		return r.retryCleanup(instance, applicableJobList, time.Now())
+	}
+	// to avoid a deadlock situation let's check that the namespace in which we are is not being deleted
+	ns := &corev1.Namespace{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{
+		Name: instance.GetNamespace(),
+	}, ns)
+	if err != nil {
+		log.Error(err, "unable to lookup instance's namespace")
+		return reconcile.Result{}, err
+	}
+	if !ns.ObjectMeta.DeletionTimestamp.IsZero() {
+		//namespace is being deleted
+		// the best we can do in this situation is to let the instance be deleted and hope that this instance was creating objects only in this namespace
+		return reconcile.Result{}, r.removeFinalizer(instance)
+	}
+	log.Info("Launching delete job for instance", "instance", instance.GetName())
+	_, err = r.CreateJob("delete", instance)
+	if err != nil {
+		log.Error(err, "unable to create deletion job")
+		return reconcile.Result{}, err
+	}
+	//we return because we need to wait for the job to stop
+	return reconcile.Result{
+		Requeue:      true,
+		RequeueAfter: cleanupPollInterval,
+	}, nil
+}
+
+// removeFinalizer removes the finalizer of instance, letting its deletion complete
+func (r *ReconcileGitOpsConfig) removeFinalizer(instance *gitopsv1alpha1.GitOpsConfig) error {
+	instance.ObjectMeta.Finalizers = removeString(instance.ObjectMeta.Finalizers, kubeGitopsFinalizer)
+	if err := r.client.Update(context.TODO(), instance); err != nil {
+		log.Error(err, "unable to create update instace to remove finalizers")
+		return err
+	}
+	return nil
+}
+
+// deletesOnly passes the deletions only, e.g. the status of a cronjob changes on every scheduled run and must not
+// trigger new runs of its GitOpsConfig
+var deletesOnly = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return false
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return false
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
+
+// isStatusOnlyUpdate returns true if the only differences between the old and new GitOpsConfig are in their status,
+// or in the operatorAnnotations
+func isStatusOnlyUpdate(oldObj, newObj runtime.Object) bool {
+	oldInstance, ok := oldObj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return false
+	}
+	newInstance, ok := newObj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return false
+	}
+	oldInstance = oldInstance.DeepCopy()
+	newInstance = newInstance.DeepCopy()
+	oldInstance.Status = gitopsv1alpha1.GitOpsConfigStatus{}
+	newInstance.Status = gitopsv1alpha1.GitOpsConfigStatus{}
+	oldInstance.ResourceVersion = ""
+	newInstance.ResourceVersion = ""
+	removeOperatorAnnotations(oldInstance)
+	removeOperatorAnnotations(newInstance)
+	return reflect.DeepEqual(oldInstance, newInstance)
+}
+
+// removeOperatorAnnotations removes the operatorAnnotations from instance, leaving nil annotations if none is left
+func removeOperatorAnnotations(instance *gitopsv1alpha1.GitOpsConfig) {
+	for _, annotation := range operatorAnnotations {
+		delete(instance.Annotations, annotation)
+	}
+	if len(instance.Annotations) == 0 {
+		instance.Annotations = nil
+	}
 }
 
 func isOwner(owner, owned metav1.Object) bool {
@@ -425,5 +1056,5 @@ func isOwner(owner, owned metav1.Object) bool {
 			return true
 		}
 	}
-	return false
+	return isAnnotatedOwner(owner, owned)
 }
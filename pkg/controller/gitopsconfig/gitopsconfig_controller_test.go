@@ -19,7 +19,9 @@ package gitopsconfig
 import (
 	"context"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
 	test "github.com/KohlsTechnology/eunomia/test"
@@ -33,8 +35,10 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -84,7 +88,7 @@ func TestMain(m *testing.M) {
 				},
 			},
 			ServiceAccountRef:      "mysvcaccount",
-			ResourceDeletionMode:   "Cascade",
+			ResourceDeletionMode:   "Delete",
 			TemplateProcessorImage: "myimage",
 			ResourceHandlingMode:   "CreateOrMerge",
 		},
@@ -149,7 +153,7 @@ func TestCRDInitialization(t *testing.T) {
 	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
 	// Initialize fake client
 	cl := fake.NewFakeClient(objs...)
-	r := &ReconcileGitOpsConfig{client: cl, scheme: s}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
 
 	nsn := types.NamespacedName{
 		Name:      name,
@@ -188,7 +192,7 @@ func TestPeriodicTrigger(t *testing.T) {
 	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
 	// Initialize fake client
 	cl := fake.NewFakeClient(objs...)
-	r := &ReconcileGitOpsConfig{client: cl, scheme: s}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
 
 	nsn := types.NamespacedName{
 		Name:      name,
@@ -233,7 +237,7 @@ func TestChangeTrigger(t *testing.T) {
 	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
 	// Initialize fake client
 	cl := fake.NewFakeClient(objs...)
-	r := &ReconcileGitOpsConfig{client: cl, scheme: s}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
 
 	nsn := types.NamespacedName{
 		Name:      name,
@@ -278,7 +282,7 @@ func TestWebhookTrigger(t *testing.T) {
 	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
 	// Initialize fake client
 	cl := fake.NewFakeClient(objs...)
-	r := &ReconcileGitOpsConfig{client: cl, scheme: s}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
 
 	nsn := types.NamespacedName{
 		Name:      name,
@@ -323,7 +327,7 @@ func TestDeleteRemovingFinalizer(t *testing.T) {
 	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
 	// Initialize fake client
 	cl := fake.NewFakeClient(objs...)
-	r := &ReconcileGitOpsConfig{client: cl, scheme: s}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
 
 	nsn := types.NamespacedName{
 		Name:      name,
@@ -394,7 +398,7 @@ func TestCreatingDeleteJob(t *testing.T) {
 	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
 	// Initialize fake client
 	cl := fake.NewFakeClient(objs...)
-	r := &ReconcileGitOpsConfig{client: cl, scheme: s}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
 
 	// Create a namespace
 	err := cl.Create(context.TODO(), ns)
@@ -476,7 +480,7 @@ func TestDeleteWhileNamespaceDeleting(t *testing.T) {
 	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
 	// Initialize fake client
 	cl := fake.NewFakeClient(objs...)
-	r := &ReconcileGitOpsConfig{client: cl, scheme: s}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
 
 	// Create a namespace
 	// Set deletion timestamp on the namespace
@@ -561,3 +565,810 @@ func findDeleteJob(cl client.Client) batch.Job {
 	}
 	return batch.Job{}
 }
+
+func TestFieldValidation(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	for _, level := range []string{"Ignore", "Warn", "Strict"} {
+		t.Run(level, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Spec.FieldValidation = level
+			cl := fake.NewFakeClient(instance)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+			_, err := r.CreateJob("create", instance)
+			assert.NoError(t, err)
+
+			jobs := &batchv1.JobList{}
+			err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+			assert.NoError(t, err)
+			if assert.Len(t, jobs.Items, 1) {
+				assert.Contains(t, jobs.Items[0].Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "FIELD_VALIDATION", Value: level})
+			}
+		})
+	}
+}
+
+func TestFieldValidationDefault(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{}
+	instance.Spec.FieldValidation = ""
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.initializeGitOpsConfig(instance)
+	assert.NoError(t, err)
+
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, crd)
+	assert.NoError(t, err)
+	assert.Equal(t, "Warn", crd.Spec.FieldValidation)
+}
+
+func TestPrunePolicy(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	for _, policy := range []string{"ApplyThenPrune", "PruneThenApply"} {
+		t.Run(policy, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Spec.PrunePolicy = policy
+			cl := fake.NewFakeClient(instance)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+			_, err := r.CreateJob("create", instance)
+			assert.NoError(t, err)
+
+			jobs := &batchv1.JobList{}
+			err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+			assert.NoError(t, err)
+			if assert.Len(t, jobs.Items, 1) {
+				assert.Contains(t, jobs.Items[0].Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "PRUNE_POLICY", Value: policy})
+			}
+		})
+	}
+}
+
+func TestPrunePolicyDefault(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{}
+	instance.Spec.PrunePolicy = ""
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.initializeGitOpsConfig(instance)
+	assert.NoError(t, err)
+
+	crd := &gitopsv1alpha1.GitOpsConfig{}
+	err = cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, crd)
+	assert.NoError(t, err)
+	assert.Equal(t, "ApplyThenPrune", crd.Spec.PrunePolicy)
+}
+
+func TestRecreateDeletedCronJob(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{"gitopsconfig.eunomia.kohls.io/initialized": "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{
+		{
+			Type: "Periodic",
+			Cron: "*/5 * * * *",
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	cronName := types.NamespacedName{Name: "gitopsconfig-gitops-operator", Namespace: namespace}
+
+	_, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	cron := &batchv1beta1.CronJob{}
+	assert.NoError(t, cl.Get(context.TODO(), cronName, cron))
+	// The first creation is not a recreation
+	assert.Empty(t, recorder.Events)
+
+	// Delete the cronjob out of band
+	assert.NoError(t, cl.Delete(context.TODO(), cron))
+
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	cron = &batchv1beta1.CronJob{}
+	assert.NoError(t, cl.Get(context.TODO(), cronName, cron))
+	assert.Equal(t, "*/5 * * * *", cron.Spec.Schedule)
+	if assert.Len(t, recorder.Events, 1) {
+		assert.Contains(t, <-recorder.Events, "Normal CronJobRecreated")
+	}
+
+	// removing the periodic trigger forgets the cronjob
+	instance = &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, instance))
+	instance.Spec.Triggers = nil
+	assert.NoError(t, cl.Update(context.TODO(), instance))
+	assert.NoError(t, cl.Delete(context.TODO(), cron))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	instance = &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, instance))
+	assert.NotContains(t, instance.GetAnnotations(), "gitopsconfig.eunomia.kohls.io/cronjob-created")
+
+	// the cronjob of a trigger added again is created, not recreated
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "*/10 * * * *"}}
+	assert.NoError(t, cl.Update(context.TODO(), instance))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	cron = &batchv1beta1.CronJob{}
+	assert.NoError(t, cl.Get(context.TODO(), cronName, cron))
+	assert.Equal(t, "*/10 * * * *", cron.Spec.Schedule)
+	for _, event := range drainEvents(recorder) {
+		assert.NotContains(t, event, "CronJobRecreated")
+	}
+}
+
+func TestFieldManagerPerConfig(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	first := gitops.DeepCopy()
+	first.Name = "gitops-first"
+	second := gitops.DeepCopy()
+	second.Name = "gitops-second"
+	cl := fake.NewFakeClient(first, second)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	managers := map[string]string{}
+	for _, instance := range []*gitopsv1alpha1.GitOpsConfig{first, second} {
+		_, err := r.CreateJob("create", instance)
+		assert.NoError(t, err)
+	}
+	jobs := &batchv1.JobList{}
+	err := cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	for _, job := range jobs.Items {
+		for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+			if env.Name == "FIELD_MANAGER" {
+				managers[job.OwnerReferences[0].Name] = env.Value
+			}
+		}
+	}
+	// Each config applies its fields under its own manager, so they don't conflict
+	assert.Equal(t, map[string]string{
+		"gitops-first":  "eunomia-gitops-first",
+		"gitops-second": "eunomia-gitops-second",
+	}, managers)
+}
+
+func TestMinRunInterval(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{"gitopsconfig.eunomia.kohls.io/initialized": "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{
+		{
+			Type: "Webhook",
+		},
+	}
+	instance.Spec.MinRunInterval = metav1.Duration{Duration: 10 * time.Minute}
+	controller := true
+	previousRun := func(age time.Duration) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "gitopsconfig-gitops-operator-previous",
+				Namespace:         namespace,
+				Labels:            map[string]string{"action": "create"},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: "eunomia.kohls.io/v1alpha1",
+						Kind:       "GitOpsConfig",
+						Name:       name,
+						Controller: &controller,
+					},
+				},
+			},
+		}
+	}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	t.Run("within the window", func(t *testing.T) {
+		cl := fake.NewFakeClient(instance, previousRun(4*time.Minute))
+		recorder := record.NewFakeRecorder(10)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+		// Several triggers within the window are all deferred to its end
+		for i := 0; i < 3; i++ {
+			result, err := r.Reconcile(req)
+			assert.NoError(t, err)
+			assert.True(t, result.RequeueAfter > 5*time.Minute && result.RequeueAfter <= 6*time.Minute, "unexpected delay %v", result.RequeueAfter)
+		}
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		assert.Len(t, jobs.Items, 1)
+		// the deferral is reported once
+		events := drainEvents(recorder)
+		if assert.Len(t, events, 1) {
+			assert.Contains(t, events[0], "Normal RunDeferred")
+		}
+	})
+
+	t.Run("after the window", func(t *testing.T) {
+		// the window of the previous run elapsed, the deferred triggers start a single run
+		cl := fake.NewFakeClient(instance, previousRun(11*time.Minute))
+		recorder := record.NewFakeRecorder(10)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+		result, err := r.Reconcile(req)
+		assert.NoError(t, err)
+		assert.Zero(t, result.RequeueAfter)
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		assert.Len(t, jobs.Items, 2)
+		assert.Contains(t, <-recorder.Events, "Normal TriggersCoalesced 3 triggers received within the minRunInterval 10m0s coalesced into a single run")
+
+		// a trigger that wasn't deferred isn't reported
+		cl = fake.NewFakeClient(instance, previousRun(11*time.Minute))
+		r = &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+		_, err = r.Reconcile(req)
+		assert.NoError(t, err)
+		assert.Empty(t, drainEvents(recorder))
+	})
+
+	t.Run("after a scheduled run", func(t *testing.T) {
+		scheduled := previousRun(4 * time.Minute)
+		scheduled.Labels = nil
+		scheduled.OwnerReferences = []metav1.OwnerReference{
+			{
+				APIVersion: "batch/v1beta1",
+				Kind:       "CronJob",
+				Name:       "gitopsconfig-" + name,
+				Controller: &controller,
+			},
+		}
+		cl := fake.NewFakeClient(instance, scheduled)
+		recorder := record.NewFakeRecorder(10)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+		result, err := r.Reconcile(req)
+		assert.NoError(t, err)
+		assert.True(t, result.RequeueAfter > 5*time.Minute && result.RequeueAfter <= 6*time.Minute, "unexpected delay %v", result.RequeueAfter)
+		assert.Contains(t, <-recorder.Events, "Normal RunDeferred")
+		deferredRuns.Lock()
+		delete(deferredRuns.triggers, req.NamespacedName)
+		deferredRuns.Unlock()
+	})
+}
+
+func TestIsStatusOnlyUpdate(t *testing.T) {
+	oldInstance := gitops.DeepCopy()
+	oldInstance.ResourceVersion = "1"
+	oldInstance.Annotations = nil
+
+	statusUpdate := oldInstance.DeepCopy()
+	statusUpdate.ResourceVersion = "2"
+	statusUpdate.Status.LastAppliedCommitMessage = "Fix the deployment"
+	assert.True(t, isStatusOnlyUpdate(oldInstance, statusUpdate))
+
+	specUpdate := oldInstance.DeepCopy()
+	specUpdate.ResourceVersion = "2"
+	specUpdate.Spec.TemplateSource.Ref = "develop"
+	assert.False(t, isStatusOnlyUpdate(oldInstance, specUpdate))
+
+	annotationUpdate := oldInstance.DeepCopy()
+	annotationUpdate.ResourceVersion = "2"
+	annotationUpdate.Annotations = map[string]string{"gitopsconfig.eunomia.kohls.io/initialized": "true"}
+	assert.False(t, isStatusOnlyUpdate(oldInstance, annotationUpdate))
+
+	// the annotations of the operator don't trigger new runs, whether they are set or cleared
+	cronJobCreated := oldInstance.DeepCopy()
+	cronJobCreated.ResourceVersion = "2"
+	cronJobCreated.Annotations = map[string]string{cronJobCreatedAnnotation: "true"}
+	assert.True(t, isStatusOnlyUpdate(oldInstance, cronJobCreated))
+	cronJobCleared := cronJobCreated.DeepCopy()
+	cronJobCleared.ResourceVersion = "3"
+	cronJobCleared.Annotations = map[string]string{}
+	assert.True(t, isStatusOnlyUpdate(cronJobCreated, cronJobCleared))
+}
+
+func TestDeletesOnly(t *testing.T) {
+	cronjob := &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "gitopsconfig-gitops-operator", Namespace: namespace}}
+	scheduled := cronjob.DeepCopy()
+	scheduled.Status.LastScheduleTime = &metav1.Time{Time: time.Now()}
+
+	assert.False(t, deletesOnly.Create(event.CreateEvent{Meta: cronjob, Object: cronjob}))
+	assert.False(t, deletesOnly.Update(event.UpdateEvent{MetaOld: cronjob, ObjectOld: cronjob, MetaNew: scheduled, ObjectNew: scheduled}))
+	assert.False(t, deletesOnly.Generic(event.GenericEvent{Meta: cronjob, Object: cronjob}))
+	assert.True(t, deletesOnly.Delete(event.DeleteEvent{Meta: cronjob, Object: cronjob}))
+}
+
+func TestServerSideApply(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	for _, serverSide := range []bool{false, true} {
+		instance := gitops.DeepCopy()
+		instance.Spec.ServerSideApply = serverSide
+		cl := fake.NewFakeClient(instance)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.CreateJob("create", instance)
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs.Items, 1) {
+			assert.Contains(t, jobs.Items[0].Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "SERVER_SIDE_APPLY", Value: strconv.FormatBool(serverSide)})
+		}
+	}
+}
+
+func TestForceConflicts(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	for _, force := range []bool{false, true} {
+		instance := gitops.DeepCopy()
+		instance.Spec.ServerSideApply = true
+		instance.Spec.ForceConflicts = force
+		cl := fake.NewFakeClient(instance)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.CreateJob("create", instance)
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs.Items, 1) {
+			assert.Contains(t, jobs.Items[0].Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "FORCE_CONFLICTS", Value: strconv.FormatBool(force)})
+		}
+	}
+}
+
+func TestServerSideApplyMode(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.ResourceHandlingMode = "ServerSideApply"
+	instance.Spec.ForceConflicts = true
+	assert.NoError(t, validateModes(instance.Spec))
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs.Items, 1) {
+		env := jobs.Items[0].Spec.Template.Spec.Containers[0].Env
+		assert.Contains(t, env, corev1.EnvVar{Name: "CREATE_MODE", Value: "ServerSideApply"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "FORCE_CONFLICTS", Value: "true"})
+	}
+}
+
+func TestIndependentParameterSource(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource.Ref = "v1.0.0"
+	instance.Spec.TemplateSource.SecretRef = "template-gitconfig"
+	instance.Spec.ParameterSource.Ref = "develop"
+	instance.Spec.ParameterSource.SecretRef = "parameter-gitconfig"
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs.Items, 1) {
+		env := jobs.Items[0].Spec.Template.Spec.Containers[0].Env
+		assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_GIT_REF", Value: "v1.0.0"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "PARAMETER_GIT_REF", Value: "develop"})
+		secrets := map[string]string{}
+		for _, volume := range jobs.Items[0].Spec.Template.Spec.Volumes {
+			if volume.Secret != nil {
+				secrets[volume.Name] = volume.Secret.SecretName
+			}
+		}
+		assert.Equal(t, map[string]string{"template-gitconfig": "template-gitconfig", "parameter-gitconfig": "parameter-gitconfig"}, secrets)
+	}
+}
+
+func TestMirrorSecrets(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource.SecretRef = "template-gitconfig"
+	instance.Spec.TemplateSource.Mirrors = []string{"https://mirror.internal/eunomia.git", "https://mirror2.internal/eunomia.git"}
+	instance.Spec.TemplateSource.MirrorSecretRefs = []gitopsv1alpha1.MirrorSecretRef{{Mirror: "https://mirror2.internal/eunomia.git", SecretRef: "mirror-gitconfig"}}
+	instance.Spec.ParameterSource.Ref = "develop"
+	instance.Spec.ParameterSource.SecretRef = ""
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs.Items, 1) {
+		spec := jobs.Items[0].Spec.Template.Spec
+		assert.Contains(t, spec.Containers[0].Env, corev1.EnvVar{Name: "TEMPLATE_GIT_MIRROR_GITCONFIGS", Value: "https://mirror2.internal/eunomia.git=/template-mirror-gitconfig/0"})
+		assert.Contains(t, spec.Containers[0].VolumeMounts, corev1.VolumeMount{Name: "template-mirror-gitconfig-0", MountPath: "/template-mirror-gitconfig/0"})
+		secrets := map[string]string{}
+		for _, volume := range spec.Volumes {
+			if volume.Secret != nil {
+				secrets[volume.Name] = volume.Secret.SecretName
+			}
+		}
+		assert.Equal(t, map[string]string{"template-gitconfig": "template-gitconfig", "template-mirror-gitconfig-0": "mirror-gitconfig"}, secrets)
+	}
+	assert.Equal(t, []string{"template-gitconfig", "mirror-gitconfig"}, sourceSecretRefs(instance))
+}
+
+func TestValidateGitConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config gitopsv1alpha1.GitConfig
+		valid  bool
+	}{
+		{"branch", gitopsv1alpha1.GitConfig{Ref: "master"}, true},
+		{"tag and secret", gitopsv1alpha1.GitConfig{Ref: "v1.0.0", SecretRef: "git-creds"}, true},
+		{"nested branch", gitopsv1alpha1.GitConfig{Ref: "release/2019.06"}, true},
+		{"empty ref", gitopsv1alpha1.GitConfig{}, false},
+		{"ref with space", gitopsv1alpha1.GitConfig{Ref: "my branch"}, false},
+		{"ref with range", gitopsv1alpha1.GitConfig{Ref: "master..develop"}, false},
+		{"ref as option", gitopsv1alpha1.GitConfig{Ref: "--upload-pack=touch"}, false},
+		{"invalid secret", gitopsv1alpha1.GitConfig{Ref: "master", SecretRef: "Git_Creds"}, false},
+		{"insecure hosts", gitopsv1alpha1.GitConfig{Ref: "master", InsecureSkipTLSVerifyHosts: []string{"git.internal", "git.internal:8443", "10.0.0.1"}}, true},
+		{"insecure url", gitopsv1alpha1.GitConfig{Ref: "master", InsecureSkipTLSVerifyHosts: []string{"https://git.internal/"}}, false},
+		{"insecure host with invalid port", gitopsv1alpha1.GitConfig{Ref: "master", InsecureSkipTLSVerifyHosts: []string{"git.internal:http"}}, false},
+		{"aws secret", gitopsv1alpha1.GitConfig{Ref: "master", ExternalSecretRef: &gitopsv1alpha1.ExternalSecretRef{Provider: "AWS", Path: "arn:aws:secretsmanager:us-east-1:123456789012:secret:git-creds"}}, true},
+		{"gcp secret", gitopsv1alpha1.GitConfig{Ref: "master", ExternalSecretRef: &gitopsv1alpha1.ExternalSecretRef{Provider: "GCP", Path: "projects/gitops/secrets/git-creds"}}, true},
+		{"gcp secret version", gitopsv1alpha1.GitConfig{Ref: "master", ExternalSecretRef: &gitopsv1alpha1.ExternalSecretRef{Provider: "GCP", Path: "projects/gitops/secrets/git-creds/versions/3"}}, true},
+		{"gcp secret without project", gitopsv1alpha1.GitConfig{Ref: "master", ExternalSecretRef: &gitopsv1alpha1.ExternalSecretRef{Provider: "GCP", Path: "git-creds"}}, false},
+		{"empty aws secret", gitopsv1alpha1.GitConfig{Ref: "master", ExternalSecretRef: &gitopsv1alpha1.ExternalSecretRef{Provider: "AWS"}}, false},
+		{"unknown provider", gitopsv1alpha1.GitConfig{Ref: "master", ExternalSecretRef: &gitopsv1alpha1.ExternalSecretRef{Provider: "Vault", Path: "git-creds"}}, false},
+		{"mirrors", gitopsv1alpha1.GitConfig{Ref: "master", Mirrors: []string{"https://mirror.internal/eunomia.git", "git@mirror2.internal:eunomia.git"}}, true},
+		{"mirror as option", gitopsv1alpha1.GitConfig{Ref: "master", Mirrors: []string{"--upload-pack=touch"}}, false},
+		{"empty mirror", gitopsv1alpha1.GitConfig{Ref: "master", Mirrors: []string{""}}, false},
+		{"mirror secret", gitopsv1alpha1.GitConfig{Ref: "master", Mirrors: []string{"https://mirror.internal/eunomia.git"},
+			MirrorSecretRefs: []gitopsv1alpha1.MirrorSecretRef{{Mirror: "https://mirror.internal/eunomia.git", SecretRef: "mirror-creds"}}}, true},
+		{"secret of an unknown mirror", gitopsv1alpha1.GitConfig{Ref: "master", Mirrors: []string{"https://mirror.internal/eunomia.git"},
+			MirrorSecretRefs: []gitopsv1alpha1.MirrorSecretRef{{Mirror: "https://mirror2.internal/eunomia.git", SecretRef: "mirror-creds"}}}, false},
+		{"invalid mirror secret", gitopsv1alpha1.GitConfig{Ref: "master", Mirrors: []string{"https://mirror.internal/eunomia.git"},
+			MirrorSecretRefs: []gitopsv1alpha1.MirrorSecretRef{{Mirror: "https://mirror.internal/eunomia.git", SecretRef: "Mirror_Creds"}}}, false},
+		{"both secrets", gitopsv1alpha1.GitConfig{Ref: "master", SecretRef: "git-creds", ExternalSecretRef: &gitopsv1alpha1.ExternalSecretRef{Provider: "AWS", Path: "git-creds"}}, false},
+		{"https uri", gitopsv1alpha1.GitConfig{URI: "https://github.com:443/KohlsTechnology/eunomia.git", Ref: "master"}, true},
+		{"ssh uri", gitopsv1alpha1.GitConfig{URI: "ssh://git@github.com/KohlsTechnology/eunomia.git", Ref: "master"}, true},
+		{"scp-like uri", gitopsv1alpha1.GitConfig{URI: "git@github.com:KohlsTechnology/eunomia.git", Ref: "master"}, true},
+		{"file uri", gitopsv1alpha1.GitConfig{URI: "file:///srv/git/eunomia.git", Ref: "master"}, true},
+		{"uri without scheme", gitopsv1alpha1.GitConfig{URI: "github.com/KohlsTechnology/eunomia", Ref: "master"}, false},
+		{"uri with typo'd scheme", gitopsv1alpha1.GitConfig{URI: "htps://github.com/KohlsTechnology/eunomia", Ref: "master"}, false},
+		{"uri without host", gitopsv1alpha1.GitConfig{URI: "https:///KohlsTechnology/eunomia", Ref: "master"}, false},
+		{"uri with space", gitopsv1alpha1.GitConfig{URI: "https://github.com/Kohls Technology/eunomia", Ref: "master"}, false},
+		{"uri as option", gitopsv1alpha1.GitConfig{URI: "--upload-pack=touch", Ref: "master"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGitConfig("parameter", tt.config)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "parameter source")
+			}
+		})
+	}
+}
+
+func TestInitializeInvalidParameterSource(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{}
+	instance.Spec.ParameterSource.Ref = "bad ref"
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.initializeGitOpsConfig(instance)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "parameter source ref")
+	}
+}
+
+func TestValidateSourcePaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  gitopsv1alpha1.GitOpsConfigSpec
+		valid bool
+	}{
+		{"defaults", gitopsv1alpha1.GitOpsConfigSpec{}, true},
+		{"absolute paths", gitopsv1alpha1.GitOpsConfigSpec{SourceMountPath: "/workspace/src", WorkingDir: "/workspace"}, true},
+		{"relative mount path", gitopsv1alpha1.GitOpsConfigSpec{SourceMountPath: "src"}, false},
+		{"root mount path", gitopsv1alpha1.GitOpsConfigSpec{SourceMountPath: "/"}, false},
+		{"relative working dir", gitopsv1alpha1.GitOpsConfigSpec{WorkingDir: "./workspace"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSourcePaths(tt.spec)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestInitializeRelativeSourceMountPath(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{}
+	instance.Spec.SourceMountPath = "workspace"
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.initializeGitOpsConfig(instance)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "sourceMountPath")
+	}
+}
+
+func TestAllowRecreate(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	for _, recreate := range []bool{false, true} {
+		instance := gitops.DeepCopy()
+		instance.Spec.AllowRecreate = recreate
+		cl := fake.NewFakeClient(instance)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.CreateJob("create", instance)
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs.Items, 1) {
+			assert.Contains(t, jobs.Items[0].Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "ALLOW_RECREATE", Value: strconv.FormatBool(recreate)})
+		}
+	}
+}
+
+func TestWebhookSecretFingerprint(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{"gitopsconfig.eunomia.kohls.io/initialized": "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook", Secret: "first-s3cr3t"}}
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}
+
+	_, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, instance))
+	first := instance.Status.WebhookSecretFingerprint
+	assert.NotEmpty(t, first)
+	assert.NotContains(t, first, "first-s3cr3t")
+
+	// reconciling again with the same secret keeps the fingerprint
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, instance))
+	assert.Equal(t, first, instance.Status.WebhookSecretFingerprint)
+
+	// rotating the secret changes the fingerprint
+	instance.Spec.Triggers[0].Secret = "second-s3cr3t"
+	assert.NoError(t, cl.Update(context.TODO(), instance))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, instance))
+	second := instance.Status.WebhookSecretFingerprint
+	assert.NotEmpty(t, second)
+	assert.NotEqual(t, first, second)
+	assert.NotContains(t, second, "second-s3cr3t")
+
+	// removing the secret clears the fingerprint
+	instance.Spec.Triggers[0].Secret = ""
+	assert.NoError(t, cl.Update(context.TODO(), instance))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	cleared := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), req.NamespacedName, cleared))
+	assert.Empty(t, cleared.Status.WebhookSecretFingerprint)
+}
+
+func TestGetWebhookSecret(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: namespace},
+		Data:       map[string][]byte{"token": []byte("s3cr3t")},
+	}
+	tests := []struct {
+		name    string
+		trigger gitopsv1alpha1.GitOpsTrigger
+		secret  string
+		err     bool
+	}{
+		{"none", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook"}, "", false},
+		{"inline", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook", Secret: "inline"}, "inline", false},
+		{"reference", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook", Secret: "inline", SecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"}, Key: "token"}}, "s3cr3t", false},
+		{"missing key", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook", SecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"}, Key: "other"}}, "", true},
+		{"missing secret", gitopsv1alpha1.GitOpsTrigger{Type: "Webhook", SecretRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "token"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Secret: "periodic"}, tt.trigger}
+			r := &ReconcileGitOpsConfig{client: fake.NewFakeClient(instance, secret.DeepCopy()), scheme: s}
+			value, err := r.GetWebhookSecret(instance)
+			assert.Equal(t, tt.err, err != nil, "%v", err)
+			assert.Equal(t, tt.secret, value)
+		})
+	}
+}
+
+func TestApplyBatchSize(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	for _, size := range []int32{0, 100} {
+		instance := gitops.DeepCopy()
+		instance.Spec.ApplyBatchSize = size
+		cl := fake.NewFakeClient(instance)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.CreateJob("create", instance)
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs.Items, 1) {
+			assert.Contains(t, jobs.Items[0].Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "APPLY_BATCH_SIZE", Value: strconv.Itoa(int(size))})
+		}
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	for _, skip := range []bool{false, true} {
+		instance := gitops.DeepCopy()
+		instance.Spec.SkipUnchanged = skip
+		cl := fake.NewFakeClient(instance)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.CreateJob("create", instance)
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs.Items, 1) {
+			assert.Contains(t, jobs.Items[0].Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "SKIP_UNCHANGED", Value: strconv.FormatBool(skip)})
+		}
+	}
+}
+
+func TestCRDGracePeriod(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		period  time.Duration
+		retries int32
+		want    string
+	}{
+		{0, 0, "0"},
+		{10 * time.Second, 3, "10"},
+		{1500 * time.Millisecond, 1, "1.5"},
+	}
+	for _, tt := range tests {
+		instance := gitops.DeepCopy()
+		instance.Spec.CRDGracePeriod = metav1.Duration{Duration: tt.period}
+		instance.Spec.CRDApplyRetries = tt.retries
+		cl := fake.NewFakeClient(instance)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.CreateJob("create", instance)
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs.Items, 1) {
+			env := jobs.Items[0].Spec.Template.Spec.Containers[0].Env
+			assert.Contains(t, env, corev1.EnvVar{Name: "CRD_GRACE_PERIOD", Value: tt.want})
+			assert.Contains(t, env, corev1.EnvVar{Name: "CRD_APPLY_RETRIES", Value: strconv.Itoa(int(tt.retries))})
+		}
+	}
+}
+
+func TestSyncWaveTimeout(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		timeout *metav1.Duration
+		want    string
+	}{
+		{nil, ""},
+		{&metav1.Duration{Duration: 90 * time.Second}, "90"},
+	}
+	for _, tt := range tests {
+		instance := gitops.DeepCopy()
+		instance.Spec.SyncWaveTimeout = tt.timeout
+		cl := fake.NewFakeClient(instance)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.CreateJob("create", instance)
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs.Items, 1) {
+			value := ""
+			for _, env := range jobs.Items[0].Spec.Template.Spec.Containers[0].Env {
+				if env.Name == "SYNC_WAVE_TIMEOUT" {
+					value = env.Value
+				}
+			}
+			assert.Equal(t, tt.want, value)
+		}
+	}
+
+	spec := gitops.Spec
+	spec.SyncWaveTimeout = &metav1.Duration{}
+	assert.EqualError(t, validateModes(spec), "syncWaveTimeout 0s must be positive")
+}
+
+func TestInsecureSkipTLSVerifyHosts(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource.InsecureSkipTLSVerifyHosts = []string{"git.internal", "mirror.internal:8443"}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs.Items, 1) {
+		env := jobs.Items[0].Spec.Template.Spec.Containers[0].Env
+		// verification is skipped for the allowlisted hosts of the template source only
+		assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_GIT_INSECURE_HOSTS", Value: "git.internal mirror.internal:8443"})
+		for _, e := range env {
+			assert.NotEqual(t, "PARAMETER_GIT_INSECURE_HOSTS", e.Name)
+		}
+	}
+}
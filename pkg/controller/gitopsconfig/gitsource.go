@@ -0,0 +1,179 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// gcpSecretPath matches the resource names of the Google Secret Manager secrets, with an optional version
+var gcpSecretPath = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+(/versions/[^/]+)?$`)
+
+// scpLikeURI matches the git repositories named like [user@]host:path, cloned over ssh
+var scpLikeURI = regexp.MustCompile(`^([^@/:\s]+@)?[^@/:\s]+:[^\s]+$`)
+
+// validateGitConfig verifies the uri, ref and secrets of the named git source
+func validateGitConfig(source string, config gitopsv1alpha1.GitConfig) error {
+	if config.URI != "" && !isValidGitURI(config.URI) {
+		return fmt.Errorf("%s source uri %q is not a git repository URI, e.g. https://github.com/org/repo.git or git@github.com:org/repo.git", source, config.URI)
+	}
+	switch config.RefType {
+	case "", "Branch", "Tag", "SemVer":
+	default:
+		return fmt.Errorf("%s source refType %q is not one of Branch, Tag, SemVer", source, config.RefType)
+	}
+	if isSemVerRef(config) {
+		if err := validateSemVerRef(source, config); err != nil {
+			return err
+		}
+	} else if IsRefPattern(config.Ref) {
+		if !isValidRefPattern(config.Ref) {
+			return fmt.Errorf("%s source ref %q is not a valid branch or tag pattern", source, config.Ref)
+		}
+	} else if !isValidGitRef(config.Ref) {
+		return fmt.Errorf("%s source ref %q is not a valid branch, tag or commit", source, config.Ref)
+	}
+	if config.CloneDepth != nil && *config.CloneDepth < 0 {
+		return fmt.Errorf("%s source cloneDepth %d is negative, 0 clones the whole history", source, *config.CloneDepth)
+	}
+	if config.SecretRef != "" {
+		if errs := validation.IsDNS1123Subdomain(config.SecretRef); len(errs) > 0 {
+			return fmt.Errorf("%s source secretRef %q is not a valid secret name: %s", source, config.SecretRef, strings.Join(errs, ", "))
+		}
+	}
+	if external := config.ExternalSecretRef; external != nil {
+		if config.SecretRef != "" {
+			return fmt.Errorf("%s source can't have both a secretRef and an externalSecretRef", source)
+		}
+		switch external.Provider {
+		case "AWS":
+			if external.Path == "" || strings.ContainsAny(external.Path, " \t\n") {
+				return fmt.Errorf("%s source externalSecretRef path %q is not a valid AWS secret name or ARN", source, external.Path)
+			}
+		case "GCP":
+			if !gcpSecretPath.MatchString(external.Path) {
+				return fmt.Errorf("%s source externalSecretRef path %q is not a projects/<project>/secrets/<secret> name", source, external.Path)
+			}
+		default:
+			return fmt.Errorf("%s source externalSecretRef provider %q is not one of AWS, GCP", source, external.Provider)
+		}
+	}
+	for _, mirror := range config.Mirrors {
+		if mirror == "" || strings.HasPrefix(mirror, "-") || strings.ContainsAny(mirror, " \t\n") {
+			return fmt.Errorf("%s source mirror %q is not a git repository URI", source, mirror)
+		}
+	}
+	for _, ref := range config.MirrorSecretRefs {
+		if !containsString(config.Mirrors, ref.Mirror) {
+			return fmt.Errorf("%s source mirrorSecretRefs mirror %q is not one of its mirrors", source, ref.Mirror)
+		}
+		if errs := validation.IsDNS1123Subdomain(ref.SecretRef); len(errs) > 0 {
+			return fmt.Errorf("%s source mirrorSecretRefs secretRef %q of mirror %q is not a valid secret name: %s", source, ref.SecretRef, ref.Mirror, strings.Join(errs, ", "))
+		}
+	}
+	for _, host := range config.InsecureSkipTLSVerifyHosts {
+		if !isValidHost(host) {
+			return fmt.Errorf("%s source insecureSkipTLSVerifyHosts entry %q is not a host name with an optional port", source, host)
+		}
+	}
+	return nil
+}
+
+// sourceSecretRefs returns the names of the secrets holding the git credentials of the sources of instance and of
+// their mirrors, mounted by its jobs
+func sourceSecretRefs(instance *gitopsv1alpha1.GitOpsConfig) []string {
+	secrets := []string{}
+	for _, source := range []gitopsv1alpha1.GitConfig{instance.Spec.TemplateSource, instance.Spec.ParameterSource} {
+		if source.SecretRef != "" {
+			secrets = append(secrets, source.SecretRef)
+		}
+		for _, ref := range source.MirrorSecretRefs {
+			secrets = append(secrets, ref.SecretRef)
+		}
+	}
+	return secrets
+}
+
+// validateSourcePaths verifies the paths of the template processor container set by spec
+func validateSourcePaths(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.SourceMountPath != "" && (!path.IsAbs(spec.SourceMountPath) || path.Clean(spec.SourceMountPath) == "/") {
+		return fmt.Errorf("sourceMountPath %q is not an absolute path below the root", spec.SourceMountPath)
+	}
+	if spec.WorkingDir != "" && !path.IsAbs(spec.WorkingDir) {
+		return fmt.Errorf("workingDir %q is not an absolute path", spec.WorkingDir)
+	}
+	return nil
+}
+
+// isValidGitURI returns true if uri is a http, https, ssh, git or file URL with a host, the file ones excepted, or a
+// [user@]host:path repository
+func isValidGitURI(uri string) bool {
+	if strings.HasPrefix(uri, "-") || strings.ContainsAny(uri, " \t\n") {
+		return false
+	}
+	if !strings.Contains(uri, "://") {
+		return scpLikeURI.MatchString(uri)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "file":
+		return u.Path != ""
+	case "http", "https", "ssh", "git":
+		return u.Hostname() != "" && isValidHost(u.Hostname())
+	}
+	return false
+}
+
+// isValidHost returns true if host is a host name or IP address, optionally followed by a port
+func isValidHost(host string) bool {
+	if name, port, err := net.SplitHostPort(host); err == nil {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return false
+		}
+		host = name
+	}
+	return net.ParseIP(host) != nil || len(validation.IsDNS1123Subdomain(host)) == 0
+}
+
+// isValidGitRef returns true if ref follows the rules of git check-ref-format
+// that matter when it is passed to git clone
+func isValidGitRef(ref string) bool {
+	if ref == "" || strings.HasPrefix(ref, "-") || strings.HasPrefix(ref, "/") ||
+		strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".") || strings.HasSuffix(ref, ".lock") ||
+		strings.Contains(ref, "..") || strings.Contains(ref, "@{") || strings.Contains(ref, "//") {
+		return false
+	}
+	for _, c := range ref {
+		if unicode.IsSpace(c) || unicode.IsControl(c) || strings.ContainsRune("~^:?*[\\", c) {
+			return false
+		}
+	}
+	return true
+}
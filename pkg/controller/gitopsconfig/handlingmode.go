@@ -0,0 +1,118 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// runHandlingModeAnnotation overrides the resourceHandlingMode of the next run of a GitOpsConfig,
+// the operator removes it once the job is created. Jobs carry it so that their retries use the same mode.
+const runHandlingModeAnnotation string = "gitopsconfig.eunomia.kohls.io/run-resource-handling-mode"
+
+// resourceHandlingModes are the supported values of resourceHandlingMode
+var resourceHandlingModes = []string{"CreateOrMerge", "ServerSideApply", "CreateOrUpdate", "Patch", "None"}
+
+// resourceDeletionModes are the supported values of resourceDeletionMode
+var resourceDeletionModes = []string{"Retain", "Delete", "Prune", "None"}
+
+// validateModes verifies the resourceHandlingMode and resourceDeletionMode of spec, empty meaning the default one,
+// and the syncWaveTimeout of the CreateOrMerge and ServerSideApply applies
+func validateModes(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.ResourceHandlingMode != "" && !containsString(resourceHandlingModes, spec.ResourceHandlingMode) {
+		return fmt.Errorf("resourceHandlingMode %q is not one of %s", spec.ResourceHandlingMode, strings.Join(resourceHandlingModes, ", "))
+	}
+	if spec.ResourceDeletionMode != "" && !containsString(resourceDeletionModes, spec.ResourceDeletionMode) {
+		return fmt.Errorf("resourceDeletionMode %q is not one of %s", spec.ResourceDeletionMode, strings.Join(resourceDeletionModes, ", "))
+	}
+	if spec.SyncWaveTimeout != nil && spec.SyncWaveTimeout.Duration <= 0 {
+		return fmt.Errorf("syncWaveTimeout %s must be positive", spec.SyncWaveTimeout.Duration)
+	}
+	return nil
+}
+
+// getRunHandlingMode returns the resourceHandlingMode requested for the next run of instance, if any.
+// It fails if the requested mode is not supported, or not allowed by the kinds denied by the operator.
+func getRunHandlingMode(instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	mode, ok := instance.GetAnnotations()[runHandlingModeAnnotation]
+	if !ok {
+		return "", nil
+	}
+	for _, supported := range resourceHandlingModes {
+		if mode != supported {
+			continue
+		}
+		if err := validateClusterDeniedKinds(mode, gitopsv1alpha1.GitOpsConfigSpec{}); err != nil {
+			return "", err
+		}
+		return mode, nil
+	}
+	return "", fmt.Errorf("%s %q is not one of %s", runHandlingModeAnnotation, mode, strings.Join(resourceHandlingModes, ", "))
+}
+
+// withRunHandlingMode returns instance with the resourceHandlingMode requested for its next run, if any.
+// instance itself is left unchanged, the override is never persisted in the spec.
+func withRunHandlingMode(instance *gitopsv1alpha1.GitOpsConfig) (*gitopsv1alpha1.GitOpsConfig, error) {
+	mode, err := getRunHandlingMode(instance)
+	if err != nil || mode == "" {
+		return instance, err
+	}
+	run := instance.DeepCopy()
+	run.Spec.ResourceHandlingMode = mode
+	return run, nil
+}
+
+// clearRunHandlingMode removes the resourceHandlingMode override of instance, after its run was started or rejected
+func (r *ReconcileGitOpsConfig) clearRunHandlingMode(instance *gitopsv1alpha1.GitOpsConfig) error {
+	if _, ok := instance.GetAnnotations()[runHandlingModeAnnotation]; !ok {
+		return nil
+	}
+	delete(instance.Annotations, runHandlingModeAnnotation)
+	err := r.client.Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to remove the resource handling mode override of the GitOpsConfig", "instance", instance.GetName())
+	}
+	return err
+}
+
+// isRunHandlingModeCleared returns true if the only change from oldObj to newObj,
+// besides the status, is the removal of the resourceHandlingMode override
+func isRunHandlingModeCleared(oldObj, newObj runtime.Object) bool {
+	oldInstance, ok := oldObj.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return false
+	}
+	if _, ok = oldInstance.GetAnnotations()[runHandlingModeAnnotation]; !ok {
+		return false
+	}
+	oldInstance = oldInstance.DeepCopy()
+	delete(oldInstance.Annotations, runHandlingModeAnnotation)
+	if len(oldInstance.Annotations) == 0 {
+		oldInstance.Annotations = nil
+	}
+	if newInstance, ok := newObj.(*gitopsv1alpha1.GitOpsConfig); ok && len(newInstance.GetAnnotations()) == 0 && newInstance.Annotations != nil {
+		newInstance = newInstance.DeepCopy()
+		newInstance.Annotations = nil
+		newObj = newInstance
+	}
+	return isStatusOnlyUpdate(oldInstance, newObj)
+}
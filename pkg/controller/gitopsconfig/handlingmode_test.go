@@ -0,0 +1,133 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// getCreateMode returns the resource handling mode passed to the template processor of job
+func getCreateMode(job *batchv1.Job) string {
+	for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+		if env.Name == "CREATE_MODE" {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+func TestRunHandlingModeOverride(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true", runHandlingModeAnnotation: "CreateOrUpdate"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.ResourceHandlingMode = "CreateOrMerge"
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+	// the override is honored by the next run
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		assert.Equal(t, "CreateOrUpdate", getCreateMode(&jobs.Items[0]))
+		assert.Equal(t, "CreateOrUpdate", jobs.Items[0].Annotations[runHandlingModeAnnotation])
+	}
+
+	// and not persisted
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.NotContains(t, updated.Annotations, runHandlingModeAnnotation)
+	assert.Equal(t, "CreateOrMerge", updated.Spec.ResourceHandlingMode)
+	assert.True(t, isRunHandlingModeCleared(instance, updated))
+
+	// the following runs use the mode of the spec
+	for _, job := range jobs.Items {
+		assert.NoError(t, cl.Delete(context.TODO(), &job))
+	}
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	jobs = &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		assert.Equal(t, "CreateOrMerge", getCreateMode(&jobs.Items[0]))
+		assert.NotContains(t, jobs.Items[0].Annotations, runHandlingModeAnnotation)
+	}
+}
+
+func TestRunHandlingModeOverrideInvalid(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true", runHandlingModeAnnotation: "Replace"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "Warning InvalidResourceHandlingMode")
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Empty(t, jobs.Items)
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.NotContains(t, updated.Annotations, runHandlingModeAnnotation)
+
+	// jobs created outside of the reconciliation reject it as well
+	_, err = r.CreateJob("create", instance)
+	assert.Error(t, err)
+}
+
+func TestIsRunHandlingModeCleared(t *testing.T) {
+	oldInstance := gitops.DeepCopy()
+	oldInstance.ResourceVersion = "1"
+	oldInstance.Annotations = map[string]string{runHandlingModeAnnotation: "Patch"}
+
+	cleared := oldInstance.DeepCopy()
+	cleared.ResourceVersion = "2"
+	cleared.Annotations = nil
+	assert.True(t, isRunHandlingModeCleared(oldInstance, cleared))
+
+	specUpdate := cleared.DeepCopy()
+	specUpdate.Spec.TemplateSource.Ref = "develop"
+	assert.False(t, isRunHandlingModeCleared(oldInstance, specUpdate))
+
+	changed := oldInstance.DeepCopy()
+	changed.ResourceVersion = "2"
+	changed.Annotations[runHandlingModeAnnotation] = "CreateOrUpdate"
+	assert.False(t, isRunHandlingModeCleared(oldInstance, changed))
+
+	// adding the override must trigger a run
+	assert.False(t, isRunHandlingModeCleared(cleared, oldInstance))
+}
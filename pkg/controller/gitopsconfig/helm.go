@@ -0,0 +1,110 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// maxHelmReleaseNameLength is the longest release name accepted by helm
+const maxHelmReleaseNameLength = 53
+
+// helmImage is the template processor image of the GitOpsConfigs whose templateProcessorType is Helm
+var helmImage = "quay.io/kohlstechnology/eunomia-helm:latest"
+
+// SetHelmImage configures the template processor image set on the GitOpsConfigs whose templateProcessorType is Helm,
+// when they don't set templateProcessorImage
+func SetHelmImage(image string) {
+	helmImage = image
+}
+
+// defaultHelm sets the template processor image of instance to the Helm image of the operator when it sets the Helm
+// templateProcessorType without an image, and names its release after it when it doesn't name it
+func defaultHelm(instance *gitopsv1alpha1.GitOpsConfig) {
+	if instance.Spec.TemplateProcessorType != "Helm" {
+		return
+	}
+	if instance.Spec.TemplateProcessorImage == "" {
+		instance.Spec.TemplateProcessorImage = helmImage
+	}
+	if instance.Spec.Helm == nil {
+		instance.Spec.Helm = &gitopsv1alpha1.HelmConfig{}
+	}
+	if instance.Spec.Helm.ReleaseName == "" {
+		instance.Spec.Helm.ReleaseName = instance.GetName()
+	}
+}
+
+// validateHelm verifies the release name and namespace of the chart, and that every value set is a key=value pair
+func validateHelm(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	switch spec.TemplateProcessorType {
+	case "", "Helm", "Kustomize", "Jsonnet":
+	default:
+		return fmt.Errorf("templateProcessorType %q is not one of Helm, Kustomize, Jsonnet", spec.TemplateProcessorType)
+	}
+	helm := spec.Helm
+	if helm == nil {
+		return nil
+	}
+	if helm.ReleaseName != "" {
+		if errs := validation.IsDNS1123Label(helm.ReleaseName); len(errs) > 0 {
+			return fmt.Errorf("helm releaseName %q is not a valid release name: %s", helm.ReleaseName, strings.Join(errs, ", "))
+		}
+		if len(helm.ReleaseName) > maxHelmReleaseNameLength {
+			return fmt.Errorf("helm releaseName %q is longer than %d characters", helm.ReleaseName, maxHelmReleaseNameLength)
+		}
+	}
+	if helm.Namespace != "" {
+		if errs := validation.IsDNS1123Label(helm.Namespace); len(errs) > 0 {
+			return fmt.Errorf("helm namespace %q is not a valid namespace name: %s", helm.Namespace, strings.Join(errs, ", "))
+		}
+	}
+	for _, value := range helm.Set {
+		if strings.HasPrefix(value, "=") || !strings.Contains(value, "=") || strings.Contains(value, "\n") {
+			return fmt.Errorf("helm set %q is not a key=value pair", value)
+		}
+	}
+	return nil
+}
+
+// validateValuesFiles verifies that only the template source of a Helm GitOpsConfig lists valuesFiles, and that they are
+// files of the chart. The jobs get them one per line.
+func validateValuesFiles(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if len(spec.ParameterSource.ValuesFiles) > 0 {
+		return errors.New("parameter source valuesFiles are only valid for the template source")
+	}
+	files := spec.TemplateSource.ValuesFiles
+	if len(files) == 0 {
+		return nil
+	}
+	if spec.TemplateProcessorType != "Helm" {
+		return errors.New("template source valuesFiles are only valid with the Helm templateProcessorType")
+	}
+	for _, file := range files {
+		clean := path.Clean(file)
+		if file == "" || strings.HasSuffix(file, "/") || strings.Contains(file, "\n") || path.IsAbs(file) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("template source valuesFiles %q is not a file of the chart", file)
+		}
+	}
+	return nil
+}
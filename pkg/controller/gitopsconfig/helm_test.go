@@ -0,0 +1,148 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestValidateHelm(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   gitopsv1alpha1.GitOpsConfigSpec
+		errMsg string
+	}{
+		{"none", gitopsv1alpha1.GitOpsConfigSpec{}, ""},
+		{"release", gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorType: "Helm", Helm: &gitopsv1alpha1.HelmConfig{
+			ReleaseName: "web", Namespace: "team-a", Set: []string{"image.tag=v1.2.0", "replicas=3", "labels.team="},
+		}}, ""},
+		{"type", gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorType: "Cue"}, `templateProcessorType "Cue" is not one of Helm, Kustomize, Jsonnet`},
+		{"release name", gitopsv1alpha1.GitOpsConfigSpec{Helm: &gitopsv1alpha1.HelmConfig{ReleaseName: "Web_1"}},
+			`helm releaseName "Web_1" is not a valid release name`},
+		{"release name length", gitopsv1alpha1.GitOpsConfigSpec{Helm: &gitopsv1alpha1.HelmConfig{ReleaseName: strings.Repeat("a", 54)}},
+			"is longer than 53 characters"},
+		{"namespace", gitopsv1alpha1.GitOpsConfigSpec{Helm: &gitopsv1alpha1.HelmConfig{Namespace: "team.a"}},
+			`helm namespace "team.a" is not a valid namespace name`},
+		{"set without value", gitopsv1alpha1.GitOpsConfigSpec{Helm: &gitopsv1alpha1.HelmConfig{Set: []string{"replicas"}}},
+			`helm set "replicas" is not a key=value pair`},
+		{"set without key", gitopsv1alpha1.GitOpsConfigSpec{Helm: &gitopsv1alpha1.HelmConfig{Set: []string{"=3"}}},
+			`helm set "=3" is not a key=value pair`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHelm(tt.spec)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestValidateValuesFiles(t *testing.T) {
+	helm := func(files ...string) gitopsv1alpha1.GitOpsConfigSpec {
+		return gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorType: "Helm", TemplateSource: gitopsv1alpha1.GitConfig{ValuesFiles: files}}
+	}
+	tests := []struct {
+		name   string
+		spec   gitopsv1alpha1.GitOpsConfigSpec
+		errMsg string
+	}{
+		{"none", gitopsv1alpha1.GitOpsConfigSpec{}, ""},
+		{"files", helm("values.yaml", "env/values-production.yaml", "./values-eu.yaml"), ""},
+		{"parameter source", gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorType: "Helm", ParameterSource: gitopsv1alpha1.GitConfig{ValuesFiles: []string{"values.yaml"}}},
+			"parameter source valuesFiles are only valid for the template source"},
+		{"not helm", gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorType: "Kustomize", TemplateSource: gitopsv1alpha1.GitConfig{ValuesFiles: []string{"values.yaml"}}},
+			"template source valuesFiles are only valid with the Helm templateProcessorType"},
+		{"empty", helm(""), `template source valuesFiles "" is not a file of the chart`},
+		{"absolute", helm("/etc/values.yaml"), `template source valuesFiles "/etc/values.yaml" is not a file of the chart`},
+		{"outside", helm("env/../../values.yaml"), `template source valuesFiles "env/../../values.yaml" is not a file of the chart`},
+		{"directory", helm("env/"), `template source valuesFiles "env/" is not a file of the chart`},
+		{"newline", helm("values.yaml\nvalues-qa.yaml"), "is not a file of the chart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateValuesFiles(tt.spec)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestDefaultHelm(t *testing.T) {
+	instance := gitops.DeepCopy()
+	defaultHelm(instance)
+	assert.Nil(t, instance.Spec.Helm, "only the Helm templateProcessorType is defaulted")
+	assert.Equal(t, gitops.Spec.TemplateProcessorImage, instance.Spec.TemplateProcessorImage)
+
+	instance.Spec.TemplateProcessorType = "Helm"
+	instance.Spec.TemplateProcessorImage = ""
+	defaultHelm(instance)
+	assert.Equal(t, helmImage, instance.Spec.TemplateProcessorImage)
+	assert.Equal(t, &gitopsv1alpha1.HelmConfig{ReleaseName: name}, instance.Spec.Helm)
+
+	instance.Spec.TemplateProcessorImage = "example.com/helm:v3"
+	instance.Spec.Helm = &gitopsv1alpha1.HelmConfig{ReleaseName: "web"}
+	defaultHelm(instance)
+	assert.Equal(t, "example.com/helm:v3", instance.Spec.TemplateProcessorImage)
+	assert.Equal(t, "web", instance.Spec.Helm.ReleaseName)
+}
+
+func TestHelmJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.TemplateSource.SecretRef = ""
+	instance.Spec.ParameterSource.SecretRef = ""
+	instance.Spec.TemplateProcessorType = "Helm"
+	instance.Spec.Helm = &gitopsv1alpha1.HelmConfig{ReleaseName: "web", Namespace: "team-a", Set: []string{"image.tag=v1.2.0", `motd="hello"`}}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	env := map[string]string{}
+	for _, e := range jobs.Items[0].Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, "web", env["HELM_RELEASE_NAME"])
+	assert.Equal(t, "team-a", env["HELM_RELEASE_NAMESPACE"])
+	assert.Equal(t, "image.tag=v1.2.0\nmotd=\"hello\"", env["HELM_SET"])
+}
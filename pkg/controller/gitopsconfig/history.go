@@ -0,0 +1,49 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// syncHistoryLimit is the number of syncs kept in the history of a GitOpsConfig, bounding the size of its status
+const syncHistoryLimit = 10
+
+// appendSyncHistory returns history with record as its most recent sync, keeping at most limit syncs. The sync of
+// the same job already in history, e.g. when its post-sync hook decides its result, is replaced.
+func appendSyncHistory(history []gitopsv1alpha1.SyncRecord, record gitopsv1alpha1.SyncRecord, limit int) []gitopsv1alpha1.SyncRecord {
+	updated := []gitopsv1alpha1.SyncRecord{record}
+	for _, previous := range history {
+		if len(updated) >= limit {
+			break
+		}
+		if previous.Job != record.Job {
+			updated = append(updated, previous)
+		}
+	}
+	return updated
+}
+
+// syncCommit returns the hash of the commit applied by the finished job, from its termination message, or the
+// commit pushed to the webhook it was started for
+func syncCommit(job *batchv1.Job, message string) string {
+	if commit := parseJobReport(message).Commit; commit != "" {
+		return commit
+	}
+	return job.GetAnnotations()[commitAnnotation]
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func syncRecords(jobs ...string) []gitopsv1alpha1.SyncRecord {
+	records := []gitopsv1alpha1.SyncRecord{}
+	for _, job := range jobs {
+		records = append(records, gitopsv1alpha1.SyncRecord{Job: job, Result: "Success"})
+	}
+	return records
+}
+
+func syncJobs(history []gitopsv1alpha1.SyncRecord) []string {
+	jobs := []string{}
+	for _, record := range history {
+		jobs = append(jobs, record.Job)
+	}
+	return jobs
+}
+
+func TestAppendSyncHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  []gitopsv1alpha1.SyncRecord
+		job      string
+		limit    int
+		expected []string
+	}{
+		{"empty", nil, "a", 3, []string{"a"}},
+		{"most recent first", syncRecords("b", "a"), "c", 3, []string{"c", "b", "a"}},
+		{"trimmed", syncRecords("c", "b", "a"), "d", 3, []string{"d", "c", "b"}},
+		{"already over the limit", syncRecords("e", "d", "c", "b", "a"), "f", 3, []string{"f", "e", "d"}},
+		{"same job replaced", syncRecords("b", "a"), "b", 3, []string{"b", "a"}},
+		{"older sync of the same job", syncRecords("c", "b", "a"), "b", 3, []string{"b", "c", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := appendSyncHistory(tt.history, gitopsv1alpha1.SyncRecord{Job: tt.job, Result: "Failed"}, tt.limit)
+			assert.Equal(t, tt.expected, syncJobs(history))
+			assert.Equal(t, "Failed", history[0].Result)
+		})
+	}
+}
+
+func TestSyncHistoryRecorded(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	for i := 0; i < syncHistoryLimit; i++ {
+		instance.Status.History = append(instance.Status.History, gitopsv1alpha1.SyncRecord{Job: fmt.Sprintf("older-%d", i), Result: "Success"})
+	}
+	cl := fake.NewFakeClient(instance, newTerminatedPod(`{"commit":"0123456789abcdef"}`))
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(50)}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+
+	result := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, result))
+	if assert.Len(t, result.Status.History, syncHistoryLimit) {
+		latest := result.Status.History[0]
+		assert.Equal(t, "gitopsconfig-gitops-operator-abcde", latest.Job)
+		assert.Equal(t, "Failed", latest.Result)
+		assert.Equal(t, "0123456789abcdef", latest.Commit)
+		assert.Equal(t, result.Status.LastSyncTime.Unix(), latest.Time.Unix())
+		assert.Equal(t, "older-0", result.Status.History[1].Job)
+		assert.Equal(t, fmt.Sprintf("older-%d", syncHistoryLimit-2), result.Status.History[syncHistoryLimit-1].Job)
+	}
+}
+
+func TestSyncHistoryDryRun(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(50)}
+	job := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+	job.Annotations = map[string]string{dryRunAnnotation: "true"}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), job)
+
+	// a dry run didn't sync anything
+	result := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, result))
+	assert.Empty(t, result.Status.History)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// requirePinnedImages rejects the template processor images that aren't pinned to a digest or to a tag other than
+// latest
+var requirePinnedImages bool
+
+// imageDigestPattern matches the digest an image is pinned to, e.g. @sha256:45b23dee...
+var imageDigestPattern = regexp.MustCompile(`@sha256:[a-f0-9]{64}$`)
+
+// SetRequirePinnedImages configures whether the template processor images must be pinned to a digest or to a tag
+// other than latest, so that the runs are reproducible
+func SetRequirePinnedImages(required bool) {
+	requirePinnedImages = required
+}
+
+// validateImage verifies the image a template processor runs, the image set by the operator when it is empty
+func validateImage(image string) error {
+	if strings.Contains(image, "@") && !imageDigestPattern.MatchString(image) {
+		return fmt.Errorf("templateProcessorImage %q is not pinned to a sha256 digest", image)
+	}
+	if requirePinnedImages && !util.IsPinnedImage(image) {
+		return fmt.Errorf("templateProcessorImage %q must be pinned to a digest or a tag other than latest", image)
+	}
+	return nil
+}
+
+// validateTemplateProcessorImage verifies the templateProcessorImage set by spec. An empty image is defaulted, and
+// verified, once the GitOpsConfig is initialized.
+func validateTemplateProcessorImage(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.TemplateProcessorImage == "" {
+		return nil
+	}
+	return validateImage(spec.TemplateProcessorImage)
+}
+
+// verifyPinnedImage returns an error, reported as an event on instance, if its template processor image, defaulted,
+// must be pinned and isn't
+func (r *ReconcileGitOpsConfig) verifyPinnedImage(instance *gitopsv1alpha1.GitOpsConfig) error {
+	image := instance.Spec.TemplateProcessorImage
+	err := validateImage(image)
+	if err != nil {
+		log.Error(err, "refusing to run an unpinned template processor image", "instance", instance.GetName(), "image", image)
+		r.recorder.Eventf(instance, "Warning", "ImageNotPinned", "Template processor image %s is not run: %v", image, err)
+		return err
+	}
+	return nil
+}
+
+// getJobImageID returns the image, resolved to its digest by the container runtime, the template processor of job
+// ran, e.g. quay.io/kohlstechnology/eunomia-base@sha256:45b23dee..., empty if it isn't known
+func getJobImageID(kubeclient client.Client, job *batchv1.Job) (string, error) {
+	podList := &corev1.PodList{}
+	err := kubeclient.List(context.TODO(), &client.ListOptions{
+		Namespace:     job.GetNamespace(),
+		LabelSelector: labels.SelectorFromSet(labels.Set{"job-name": job.GetName()}),
+	}, podList)
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range podList.Items {
+		if pod.GetLabels()["job-name"] != job.GetName() {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.ImageID != "" {
+				// the runtimes prefix the image with their scheme, e.g. docker-pullable://
+				imageID := status.ImageID
+				if i := strings.Index(imageID, "://"); i >= 0 {
+					imageID = imageID[i+3:]
+				}
+				return imageID, nil
+			}
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// pinnedImage is a template processor image pinned to a digest
+const pinnedImage = "quay.io/kohlstechnology/eunomia-base@sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2"
+
+func TestValidateImage(t *testing.T) {
+	defer SetRequirePinnedImages(false)
+	tests := []struct {
+		image    string
+		required bool
+		valid    bool
+	}{
+		{"quay.io/kohlstechnology/eunomia-base:latest", false, true},
+		{"quay.io/kohlstechnology/eunomia-base:latest", true, false},
+		{"quay.io/kohlstechnology/eunomia-base", true, false},
+		{"registry.local:5000/eunomia-base", true, false},
+		{"quay.io/kohlstechnology/eunomia-base:v0.1.0", true, true},
+		{pinnedImage, true, true},
+		{"quay.io/kohlstechnology/eunomia-base@sha256:45b23dee", false, false},
+		{"quay.io/kohlstechnology/eunomia-base@md5:45b23dee08af5e43a7fea6c4cf9c25cc", false, false},
+	}
+	for _, tt := range tests {
+		SetRequirePinnedImages(tt.required)
+		err := validateImage(tt.image)
+		assert.Equal(t, tt.valid, err == nil, "%s %v", tt.image, tt.required)
+	}
+}
+
+func TestPinnedImageRequired(t *testing.T) {
+	SetRequirePinnedImages(true)
+	defer SetRequirePinnedImages(false)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name  string
+		image string
+		runs  bool
+	}{
+		{"pinned", pinnedImage, true},
+		{"latest", "quay.io/kohlstechnology/eunomia-base:latest", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Spec.TemplateProcessorImage = tt.image
+			cl := fake.NewFakeClient(instance)
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+			_, err := r.CreateJob("create", instance)
+			jobs := &batchv1.JobList{}
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+			if tt.runs {
+				assert.NoError(t, err)
+				if assert.Len(t, jobs.Items, 1) {
+					assert.Equal(t, tt.image, jobs.Items[0].Spec.Template.Spec.Containers[0].Image)
+				}
+				return
+			}
+			assert.Error(t, err)
+			assert.Empty(t, jobs.Items)
+			assert.Contains(t, <-recorder.Events, "Warning ImageNotPinned")
+		})
+	}
+}
+
+func TestLastSyncImageID(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	pod := newTerminatedPod("")
+	pod.Status.ContainerStatuses[0].ImageID = "docker-pullable://" + pinnedImage
+	cl := fake.NewFakeClient(gitops.DeepCopy(), pod)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+	assert.Equal(t, pinnedImage, instance.Status.LastSyncImageID)
+}
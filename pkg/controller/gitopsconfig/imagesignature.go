@@ -0,0 +1,47 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/signature"
+)
+
+// imageVerifier checks the signature of the template processor images before their jobs are created, nil disables the verification
+var imageVerifier signature.Verifier
+
+// SetImageVerifier configures the verifier of the template processor images
+func SetImageVerifier(verifier signature.Verifier) {
+	imageVerifier = verifier
+}
+
+// verifyImageSignature returns the template processor image of instance to run, pinned to the digest whose
+// signature was verified so that a tag moved since isn't run, or an error, reported as an event on instance,
+// if it isn't signed by the trusted key or identity
+func (r *ReconcileGitOpsConfig) verifyImageSignature(instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	image := instance.Spec.TemplateProcessorImage
+	if imageVerifier == nil {
+		return image, nil
+	}
+	pinned, err := imageVerifier.Verify(image)
+	if err != nil {
+		log.Error(err, "refusing to run an unverified template processor image", "instance", instance.GetName(), "image", image)
+		r.recorder.Eventf(instance, "Warning", "ImageSignatureInvalid", "Template processor image %s is not run: %v", image, err)
+		return "", err
+	}
+	return pinned, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// mockVerifier trusts the images in signed, pinned to their digest
+type mockVerifier struct {
+	signed   map[string]string
+	verified []string
+}
+
+func (v *mockVerifier) Verify(image string) (string, error) {
+	v.verified = append(v.verified, image)
+	if v.signed[image] == "" {
+		return "", errors.New("no matching signatures")
+	}
+	return v.signed[image], nil
+}
+
+func TestImageSignature(t *testing.T) {
+	defer SetImageVerifier(nil)
+	pinned := "quay.io/kohlstechnology/eunomia-helm@sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2"
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name  string
+		image string
+		runs  bool
+	}{
+		{"signed", "quay.io/kohlstechnology/eunomia-helm:v0.0.3", true},
+		{"unsigned", "quay.io/attacker/eunomia-helm:v0.0.3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &mockVerifier{signed: map[string]string{"quay.io/kohlstechnology/eunomia-helm:v0.0.3": pinned}}
+			SetImageVerifier(verifier)
+			instance := gitops.DeepCopy()
+			instance.Spec.TemplateProcessorImage = tt.image
+			instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+			cl := fake.NewFakeClient(instance)
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+			_, jobErr := r.CreateJob("create", instance)
+			_, cronJobErr := r.createCronJob(instance)
+
+			assert.Equal(t, []string{tt.image, tt.image}, verifier.verified)
+			jobs := &batchv1.JobList{}
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+			cronjobs := &batchv1beta1.CronJobList{}
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, cronjobs))
+			if tt.runs {
+				assert.NoError(t, jobErr)
+				assert.NoError(t, cronJobErr)
+				assert.Len(t, jobs.Items, 1)
+				assert.Len(t, cronjobs.Items, 1)
+				assert.Empty(t, recorder.Events)
+				// the verified digest runs, even if the tag is moved since
+				assert.Equal(t, pinned, jobs.Items[0].Spec.Template.Spec.Containers[0].Image)
+				assert.Equal(t, pinned, cronjobs.Items[0].Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image)
+				current := &gitopsv1alpha1.GitOpsConfig{}
+				assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: instance.Name, Namespace: namespace}, current))
+				assert.Equal(t, tt.image, current.Spec.TemplateProcessorImage)
+				return
+			}
+			assert.Error(t, jobErr)
+			assert.Error(t, cronJobErr)
+			assert.Empty(t, jobs.Items)
+			assert.Empty(t, cronjobs.Items)
+			assert.Contains(t, <-recorder.Events, "Warning ImageSignatureInvalid")
+			assert.Contains(t, <-recorder.Events, "Warning ImageSignatureInvalid")
+		})
+	}
+}
+
+func TestImageSignatureDisabled(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+}
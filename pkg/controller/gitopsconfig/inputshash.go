@@ -0,0 +1,154 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// inputsHashAnnotation holds, on the jobs, the hash of the render inputs of their GitOpsConfig when they were
+// created, without the commits that are only known once the sources are cloned
+const inputsHashAnnotation string = "gitopsconfig.eunomia.kohls.io/inputs-hash"
+
+// sourceInputs are the fields of a source that select the cloned files. The credentials, proxies,
+// mirrors and TLS settings change how they are cloned, not what is cloned.
+type sourceInputs struct {
+	URI        string `json:"uri"`
+	Ref        string `json:"ref"`
+	ContextDir string `json:"contextDir"`
+	// ContextDirs and the patterns are omitted when unset, so that the hashes of the other GitOpsConfigs don't change
+	ContextDirs     []string `json:"contextDirs,omitempty"`
+	ExcludePatterns []string `json:"excludePatterns,omitempty"`
+	IncludePatterns []string `json:"includePatterns,omitempty"`
+	ValuesFiles     []string `json:"valuesFiles,omitempty"`
+}
+
+// renderInputs are the inputs of a run, known before it clones the sources, that change the manifests it renders and
+// how they are applied. Adding a field changes the hash of every GitOpsConfig, so they are all reported out of date once.
+type renderInputs struct {
+	TemplateSource         sourceInputs `json:"templateSource"`
+	ParameterSource        sourceInputs `json:"parameterSource"`
+	ParameterFile          string       `json:"parameterFile"`
+	TemplateProcessorImage string       `json:"templateProcessorImage"`
+	WorkingDir             string       `json:"workingDir"`
+	ResourceHandlingMode   string       `json:"resourceHandlingMode"`
+	FieldValidation        string       `json:"fieldValidation"`
+	ServerSideApply        bool         `json:"serverSideApply"`
+	ForceConflicts         bool         `json:"forceConflicts"`
+	AllowRecreate          bool         `json:"allowRecreate"`
+	TargetNamespaces       []string     `json:"targetNamespaces"`
+	PrunePolicy            string       `json:"prunePolicy"`
+	PruneBlocklist         []string     `json:"pruneBlocklist"`
+	PruneAllowlist         []string     `json:"pruneAllowlist"`
+	EmptyRenderPolicy      string       `json:"emptyRenderPolicy"`
+	// the fields below are omitted when unset, so that the hashes of the other GitOpsConfigs don't change
+	Helm                  *gitopsv1alpha1.HelmConfig      `json:"helm,omitempty"`
+	Kustomize             *gitopsv1alpha1.KustomizeConfig `json:"kustomize,omitempty"`
+	PruneRemoved          bool                            `json:"pruneRemoved,omitempty"`
+	PruneClusterResources bool                            `json:"pruneClusterResources,omitempty"`
+	AllowedResourceKinds  []string                        `json:"allowedResourceKinds,omitempty"`
+	DeniedResourceKinds   []string                        `json:"deniedResourceKinds,omitempty"`
+	Jsonnet               *gitopsv1alpha1.JsonnetConfig   `json:"jsonnet,omitempty"`
+}
+
+// hashOf returns the SHA-256 hash of the JSON encoding of v
+func hashOf(v interface{}) string {
+	// the encoding of the structs above can't fail, and their fields are always encoded in the same order
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// specInputsHash returns the hash of the render inputs of instance, run with parameterFile
+func specInputsHash(instance *gitopsv1alpha1.GitOpsConfig, parameterFile string) string {
+	spec := instance.Spec
+	parameter := spec.ParameterSource
+	if parameter.URI == "" {
+		parameter.URI = spec.TemplateSource.URI
+	}
+	return hashOf(renderInputs{
+		TemplateSource: sourceInputs{
+			URI:             spec.TemplateSource.URI,
+			Ref:             spec.TemplateSource.Ref,
+			ContextDir:      spec.TemplateSource.ContextDir,
+			ContextDirs:     spec.TemplateSource.ContextDirs,
+			ExcludePatterns: spec.TemplateSource.ExcludePatterns,
+			IncludePatterns: spec.TemplateSource.IncludePatterns,
+			ValuesFiles:     spec.TemplateSource.ValuesFiles,
+		},
+		ParameterSource:        sourceInputs{URI: parameter.URI, Ref: parameter.Ref, ContextDir: parameter.ContextDir},
+		ParameterFile:          parameterFile,
+		TemplateProcessorImage: spec.TemplateProcessorImage,
+		WorkingDir:             spec.WorkingDir,
+		ResourceHandlingMode:   spec.ResourceHandlingMode,
+		FieldValidation:        spec.FieldValidation,
+		ServerSideApply:        spec.ServerSideApply,
+		ForceConflicts:         spec.ForceConflicts,
+		AllowRecreate:          spec.AllowRecreate,
+		TargetNamespaces:       spec.TargetNamespaces,
+		PrunePolicy:            spec.PrunePolicy,
+		PruneBlocklist:         spec.PruneBlocklist,
+		PruneAllowlist:         spec.PruneAllowlist,
+		EmptyRenderPolicy:      spec.EmptyRenderPolicy,
+		Helm:                   spec.Helm,
+		Kustomize:              spec.Kustomize,
+		PruneRemoved:           spec.ResourceDeletionMode == "Prune",
+		PruneClusterResources:  spec.PruneClusterResources,
+		AllowedResourceKinds:   spec.AllowedResourceKinds,
+		DeniedResourceKinds:    spec.DeniedResourceKinds,
+		Jsonnet:                spec.Jsonnet,
+	})
+}
+
+// inputsHash combines the hash of the render inputs of a spec with the template and parameter commits it was run with
+func inputsHash(specHash, templateCommit, parameterCommit string) string {
+	return hashOf([]string{specHash, templateCommit, parameterCommit})
+}
+
+// currentInputsHash returns the hash of the render inputs of instance known to the operator: its spec, the parameter
+// file of its last run and the commits it last applied. New commits pushed to the refs are only known once cloned.
+func currentInputsHash(instance *gitopsv1alpha1.GitOpsConfig) string {
+	parameterFile := instance.Status.ParameterFile
+	if parameterFile == "" {
+		// a fileName that can't be resolved without a push is hashed as is
+		resolved, err := resolveParameterFile(instance, nil)
+		if err != nil {
+			resolved = instance.Spec.ParameterSource.FileName
+		}
+		parameterFile = resolved
+	}
+	return inputsHash(specInputsHash(instance, parameterFile), instance.Status.LastAppliedCommit, instance.Status.LastAppliedParameterCommit)
+}
+
+// recordInputsHash stores the hash of the current render inputs in the status of instance
+func (r *ReconcileGitOpsConfig) recordInputsHash(instance *gitopsv1alpha1.GitOpsConfig) error {
+	hash := currentInputsHash(instance)
+	if instance.Status.InputsHash == hash {
+		return nil
+	}
+	instance.Status.InputsHash = hash
+	err := r.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the inputs hash", "instance", instance.GetName())
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSpecInputsHash(t *testing.T) {
+	base := specInputsHash(gitops, "values.yaml")
+	assert.Equal(t, base, specInputsHash(gitops.DeepCopy(), "values.yaml"), "the hash must be stable")
+	tests := []struct {
+		name    string
+		mutate  func(*gitopsv1alpha1.GitOpsConfig)
+		changed bool
+	}{
+		{"template uri", func(c *gitopsv1alpha1.GitOpsConfig) {
+			c.Spec.TemplateSource.URI = "https://github.com/KohlsTechnology/other"
+		}, true},
+		{"template ref", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.TemplateSource.Ref = "v1.0.0" }, true},
+		{"template context dir", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.TemplateSource.ContextDir = "other" }, true},
+		{"parameter ref", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.ParameterSource.Ref = "v1.0.0" }, true},
+		{"parameter context dir", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.ParameterSource.ContextDir = "other" }, true},
+		{"image", func(c *gitopsv1alpha1.GitOpsConfig) {
+			c.Spec.TemplateProcessorImage = "quay.io/kohlstechnology/eunomia-helm:v1"
+		}, true},
+		{"working dir", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.WorkingDir = "/tmp" }, true},
+		{"handling mode", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.ResourceHandlingMode = "Patch" }, true},
+		{"field validation", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.FieldValidation = "Strict" }, true},
+		{"server side apply", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.ServerSideApply = true }, true},
+		{"force conflicts", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.ForceConflicts = true }, true},
+		{"allow recreate", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.AllowRecreate = true }, true},
+		{"target namespaces", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.TargetNamespaces = []string{"web"} }, true},
+		{"prune policy", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.PrunePolicy = "PruneThenApply" }, true},
+		{"empty render policy", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.EmptyRenderPolicy = "Prune" }, true},
+		{"prune blocklist", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.PruneBlocklist = []string{"PersistentVolumeClaim"} }, true},
+		{"prune allowlist", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.PruneAllowlist = []string{"ConfigMap"} }, true},
+		{"allowed resource kinds", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.AllowedResourceKinds = []string{"ConfigMap"} }, true},
+		{"denied resource kinds", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.DeniedResourceKinds = []string{"Secret"} }, true},
+		{"jsonnet", func(c *gitopsv1alpha1.GitOpsConfig) {
+			c.Spec.Jsonnet = &gitopsv1alpha1.JsonnetConfig{Entrypoint: "environments/prod.jsonnet"}
+		}, true},
+		{"prune removed resources", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.ResourceDeletionMode = "Prune" }, true},
+		{"prune cluster resources", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.PruneClusterResources = true }, true},
+		{"deletion mode", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.ResourceDeletionMode = "Retain" }, false},
+		{"secret", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.TemplateSource.SecretRef = "other" }, false},
+		{"proxy", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.TemplateSource.HTTPSProxy = "http://proxy.com:8080" }, false},
+		{"mirrors", func(c *gitopsv1alpha1.GitOpsConfig) {
+			c.Spec.TemplateSource.Mirrors = []string{"https://mirror.internal/eunomia"}
+		}, false},
+		{"triggers", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.Triggers = nil }, false},
+		{"service account", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.ServiceAccountRef = "other" }, false},
+		{"job profile", func(c *gitopsv1alpha1.GitOpsConfig) { c.Spec.JobProfile = "large" }, false},
+		{"status", func(c *gitopsv1alpha1.GitOpsConfig) { c.Status.ConsecutiveFailures = 3 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			tt.mutate(instance)
+			if tt.changed {
+				assert.NotEqual(t, base, specInputsHash(instance, "values.yaml"))
+			} else {
+				assert.Equal(t, base, specInputsHash(instance, "values.yaml"))
+			}
+		})
+	}
+	assert.NotEqual(t, base, specInputsHash(gitops, "staging.yaml"), "the parameter file must change the hash")
+}
+
+func TestInputsHashCommits(t *testing.T) {
+	base := inputsHash("sha256:spec", "abc123", "def456")
+	assert.Equal(t, base, inputsHash("sha256:spec", "abc123", "def456"))
+	assert.NotEqual(t, base, inputsHash("sha256:other", "abc123", "def456"))
+	assert.NotEqual(t, base, inputsHash("sha256:spec", "abc124", "def456"))
+	assert.NotEqual(t, base, inputsHash("sha256:spec", "abc123", "def457"))
+	// the fields are delimited, moving a character between them changes the hash
+	assert.NotEqual(t, inputsHash("sha256:spec", "abc", "123"), inputsHash("sha256:spec", "abc1", "23"))
+}
+
+func TestJobCompletionEmitterInputsHash(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(`{"commitMessage":"Scale the frontend","commit":"abc123","parameterCommit":"def456"}`))
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+	// the job carries the hash of the spec it was created with
+	_, err := r.createJob("create", gitops.DeepCopy(), 0, "", "", "")
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	job := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+	job.Annotations = map[string]string{inputsHashAnnotation: jobs.Items[0].Annotations[inputsHashAnnotation]}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), job)
+
+	// once it succeeds, the config is up to date
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.Equal(t, "def456", instance.Status.LastAppliedParameterCommit)
+	assert.NotEmpty(t, instance.Status.LastAppliedInputsHash)
+	assert.Equal(t, instance.Status.LastAppliedInputsHash, instance.Status.InputsHash)
+
+	// reconciling without changes keeps it up to date
+	assert.NoError(t, r.recordInputsHash(instance))
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.Equal(t, instance.Status.LastAppliedInputsHash, instance.Status.InputsHash)
+
+	// a change of the spec makes it out of date
+	instance.Spec.TemplateSource.Ref = "v2.0.0"
+	assert.NoError(t, r.recordInputsHash(instance))
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.NotEqual(t, instance.Status.LastAppliedInputsHash, instance.Status.InputsHash)
+}
+
+func TestJobCompletionEmitterInputsHashUnknown(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	previous := gitops.DeepCopy()
+	previous.Status.LastAppliedInputsHash = "sha256:previous"
+	cl := fake.NewFakeClient(previous, newTerminatedPod(`{"commitMessage":"Scale the frontend","commit":"abc123"}`))
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	// jobs created by older operators don't carry the hash of their inputs
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+	assert.Empty(t, instance.Status.LastAppliedInputsHash)
+	assert.NotEmpty(t, instance.Status.InputsHash)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// jobEventQueueLength is the number of job events waiting for each worker, above which the informer waits
+const jobEventQueueLength = 100
+
+// jobEventWorkers is the number of workers processing the job events, one processes them in the informer
+var jobEventWorkers = 1
+
+// SetJobEventWorkers makes workers process the changes of the watched Jobs in
+// parallel, instead of the informer processing them one after the other. The
+// changes of the jobs of a GitOpsConfig are processed in order by the same worker.
+func SetJobEventWorkers(workers int) {
+	jobEventWorkers = workers
+}
+
+// jobEventDispatcher passes the job events to handler from a pool of workers.
+// The events are dispatched by the GitOpsConfig of their job, so that the
+// events of unrelated GitOpsConfigs are processed in parallel while the ones
+// of a GitOpsConfig are processed in the order they were received.
+type jobEventDispatcher struct {
+	handler cache.ResourceEventHandler
+	queues  []chan func()
+	// pending counts the events queued and not processed yet
+	pending sync.WaitGroup
+}
+
+var (
+	_ cache.ResourceEventHandler = &jobEventDispatcher{}
+	_ manager.Runnable           = &jobEventDispatcher{}
+	_ pendingWaiter              = &jobEventDispatcher{}
+)
+
+func newJobEventDispatcher(handler cache.ResourceEventHandler, workers int) *jobEventDispatcher {
+	queues := make([]chan func(), workers)
+	for i := range queues {
+		queues[i] = make(chan func(), jobEventQueueLength)
+	}
+	return &jobEventDispatcher{handler: handler, queues: queues}
+}
+
+// OnAdd queues the addition of obj to the worker of its GitOpsConfig
+func (d *jobEventDispatcher) OnAdd(obj interface{}) {
+	d.dispatch(obj, func() { d.handler.OnAdd(obj) })
+}
+
+// OnUpdate queues the update of obj to the worker of its GitOpsConfig
+func (d *jobEventDispatcher) OnUpdate(oldObj, newObj interface{}) {
+	d.dispatch(newObj, func() { d.handler.OnUpdate(oldObj, newObj) })
+}
+
+// OnDelete queues the deletion of obj to the worker of its GitOpsConfig
+func (d *jobEventDispatcher) OnDelete(obj interface{}) {
+	d.dispatch(obj, func() { d.handler.OnDelete(obj) })
+}
+
+// dispatch queues event to the worker of the GitOpsConfig of obj, waiting while its queue is full
+func (d *jobEventDispatcher) dispatch(obj interface{}, event func()) {
+	d.pending.Add(1)
+	d.queues[d.worker(obj)] <- func() {
+		defer d.pending.Done()
+		event()
+	}
+}
+
+// waitPending returns once the events queued were processed
+func (d *jobEventDispatcher) waitPending() {
+	d.pending.Wait()
+}
+
+// worker returns the index of the worker processing the events of obj
+func (d *jobEventDispatcher) worker(obj interface{}) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(jobEventKey(obj)))
+	return int(hash.Sum32() % uint32(len(d.queues)))
+}
+
+// Start runs the workers until stopCh is closed. The workers keep processing
+// the events queued before the watch on Jobs stopped, so that the shutdown
+// drains them.
+func (d *jobEventDispatcher) Start(stopCh <-chan struct{}) error {
+	for _, queue := range d.queues {
+		go func(queue chan func()) {
+			for event := range queue {
+				event()
+			}
+		}(queue)
+	}
+	<-stopCh
+	return nil
+}
+
+// jobEventKey returns the key dispatching the events of obj, the name of the
+// GitOpsConfig of the job when it can be told without reading its owners. The
+// GitOpsConfigs of the same name in different namespaces only share a worker.
+func jobEventKey(obj interface{}) string {
+	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = deleted.Obj
+	}
+	job, ok := obj.(metav1.Object)
+	if !ok {
+		return ""
+	}
+	if owner, ok := annotatedOwnerName(job); ok {
+		return owner.Name
+	}
+	if ref := metav1.GetControllerOf(job); ref != nil {
+		switch ref.Kind {
+		case "GitOpsConfig":
+			return ref.Name
+		case "CronJob":
+			// the cronjob of a GitOpsConfig is named after it
+			return strings.TrimPrefix(ref.Name, "gitopsconfig-")
+		}
+	}
+	return job.GetNamespace() + "/" + job.GetName()
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// handlerFunc is a cache.ResourceEventHandler passing the updated objects to a function
+type handlerFunc func(obj interface{})
+
+func (f handlerFunc) OnAdd(obj interface{})               { f(obj) }
+func (f handlerFunc) OnUpdate(oldObj, newObj interface{}) { f(newObj) }
+func (f handlerFunc) OnDelete(obj interface{})            { f(obj) }
+
+// newConfigJob returns a job of the GitOpsConfig named config, with the given resource version
+func newConfigJob(config string, version int) *batchv1.Job {
+	controller := true
+	return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:            fmt.Sprintf("gitopsconfig-%s-%d", config, version),
+		Namespace:       namespace,
+		ResourceVersion: strconv.Itoa(version),
+		OwnerReferences: []metav1.OwnerReference{{Kind: "GitOpsConfig", Name: config, Controller: &controller}},
+	}}
+}
+
+// startDispatcher starts a dispatcher of handler, returning a function stopping it
+func startDispatcher(handler cache.ResourceEventHandler, workers int) (*jobEventDispatcher, func()) {
+	dispatcher := newJobEventDispatcher(handler, workers)
+	stopCh := make(chan struct{})
+	go dispatcher.Start(stopCh)
+	return dispatcher, func() { close(stopCh) }
+}
+
+func TestJobEventKey(t *testing.T) {
+	controller := true
+	cronJob := newOwnedJob(batchv1.JobStatus{})
+	cronJob.OwnerReferences = []metav1.OwnerReference{{Kind: "CronJob", Name: "gitopsconfig-" + name, Controller: &controller}}
+	annotated := newOwnedJob(batchv1.JobStatus{})
+	annotated.OwnerReferences = nil
+	annotated.Annotations = map[string]string{jobOwnerAnnotation: namespace + "/" + name}
+	other := newOwnedJob(batchv1.JobStatus{})
+	other.OwnerReferences = nil
+
+	// the jobs of a GitOpsConfig share a key, whoever started them
+	assert.Equal(t, name, jobEventKey(newOwnedJob(batchv1.JobStatus{})))
+	assert.Equal(t, name, jobEventKey(cronJob))
+	assert.Equal(t, name, jobEventKey(annotated))
+	assert.Equal(t, name, jobEventKey(cache.DeletedFinalStateUnknown{Obj: annotated}))
+	assert.Equal(t, namespace+"/"+other.Name, jobEventKey(other))
+}
+
+func TestJobEventDispatcherParallel(t *testing.T) {
+	release := make(chan struct{})
+	processed := make(chan string, 10)
+	dispatcher, stop := startDispatcher(handlerFunc(func(obj interface{}) {
+		job := obj.(*batchv1.Job)
+		if strings.HasPrefix(job.Name, "gitopsconfig-blocked-") {
+			<-release
+		}
+		processed <- job.Name
+	}), 4)
+	defer stop()
+
+	// another GitOpsConfig processed by another worker
+	blocked := newConfigJob("blocked", 1)
+	other := ""
+	for i := 0; other == ""; i++ {
+		if config := fmt.Sprintf("config-%d", i); dispatcher.worker(newConfigJob(config, 1)) != dispatcher.worker(blocked) {
+			other = config
+		}
+	}
+
+	dispatcher.OnUpdate(blocked, blocked)
+	dispatcher.OnUpdate(newConfigJob(other, 1), newConfigJob(other, 1))
+	select {
+	case job := <-processed:
+		assert.Equal(t, newConfigJob(other, 1).Name, job, "the other GitOpsConfig isn't held up")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job of the other GitOpsConfig wasn't processed while a worker is busy")
+	}
+	close(release)
+	assert.Equal(t, blocked.Name, <-processed)
+}
+
+func TestJobEventDispatcherOrder(t *testing.T) {
+	var mutex sync.Mutex
+	versions := map[string][]string{}
+	done := make(chan struct{}, 200)
+	dispatcher, stop := startDispatcher(handlerFunc(func(obj interface{}) {
+		job := obj.(*batchv1.Job)
+		mutex.Lock()
+		config := strings.TrimSuffix(job.Name, "-"+job.ResourceVersion)
+		versions[config] = append(versions[config], job.ResourceVersion)
+		mutex.Unlock()
+		done <- struct{}{}
+	}), 4)
+	defer stop()
+
+	expected := []string{}
+	for version := 1; version <= 50; version++ {
+		for _, config := range []string{"a", "b", "c", "d"} {
+			dispatcher.OnUpdate(nil, newConfigJob(config, version))
+		}
+		expected = append(expected, strconv.Itoa(version))
+	}
+	for i := 0; i < 200; i++ {
+		<-done
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, config := range []string{"a", "b", "c", "d"} {
+		assert.Equal(t, expected, versions["gitopsconfig-"+config], "the events of a GitOpsConfig are processed in order")
+	}
+}
+
+func TestJobEventDispatcherReportsOnce(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	job := newOwnedJob(succeededAt(time.Now()))
+	job.UID = "1234"
+	cl := fake.NewFakeClient(gitops.DeepCopy(), job.DeepCopy())
+	recorder := record.NewFakeRecorder(20)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	dispatcher, stop := startDispatcher(emitter, 4)
+	defer stop()
+
+	// the same completion seen twice before the annotation of the first one is set, e.g. by a restarted watch
+	started := newOwnedJob(batchv1.JobStatus{Active: 1})
+	dispatcher.OnUpdate(started, job.DeepCopy())
+	dispatcher.OnUpdate(started, job.DeepCopy())
+
+	successful := 0
+	deadline := time.After(5 * time.Second)
+	for successful < 2 {
+		select {
+		case event := <-recorder.Events:
+			if strings.HasPrefix(event, "Normal JobSuccessful") {
+				successful++
+			}
+		case <-time.After(500 * time.Millisecond):
+			assert.Equal(t, 1, successful)
+			return
+		case <-deadline:
+			t.Fatal("the completion wasn't reported")
+		}
+	}
+	t.Errorf("the completion was reported %d times", successful)
+}
+
+func TestReportedJobs(t *testing.T) {
+	reported := reportedJobs{}
+	assert.True(t, reported.claim("1234"))
+	assert.False(t, reported.claim("1234"))
+	assert.True(t, reported.claim("5678"))
+	assert.True(t, reported.claim(""), "the jobs without a UID can't be told apart")
+	assert.True(t, reported.claim(""))
+
+	// a deleted job is forgotten
+	reported.forget("1234")
+	assert.True(t, reported.claim("1234"))
+}
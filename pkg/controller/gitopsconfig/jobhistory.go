@@ -0,0 +1,106 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// jobHistoryLimit is the number of finished jobs of each GitOpsConfig kept when the operator deletes the expired ones
+var jobHistoryLimit = 3
+
+// SetJobHistoryLimit configures how many of the most recent finished jobs of each GitOpsConfig are kept when the
+// operator deletes the jobs whose ttlSecondsAfterFinished expired, in the clusters without a TTL controller
+func SetJobHistoryLimit(limit int) {
+	jobHistoryLimit = limit
+}
+
+// isTTLEnforced returns true if the cluster deletes job once its ttlSecondsAfterFinished expires. The API servers
+// without the TTLAfterFinished feature drop it from the jobs they store.
+func isTTLEnforced(job *batchv1.Job) bool {
+	return job.Spec.TTLSecondsAfterFinished != nil
+}
+
+// cleanupFinishedJobs deletes the finished jobs of the GitOpsConfig owning job whose ttlSecondsAfterFinished expired,
+// when the cluster didn't keep it on job. The jobHistoryLimit most recent finished jobs are kept. The jobs of the
+// cronjob are left to its history limits.
+func (j *jobCompletionEmitter) cleanupFinishedJobs(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) {
+	if isTTLEnforced(job) {
+		return
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.Error(err, "unable to lookup the GitOpsConfig owning the finished job", "job", job.GetName())
+		}
+		return
+	}
+	if instance.Spec.JobTemplate == nil || instance.Spec.JobTemplate.TTLSecondsAfterFinished == nil || instance.GetDeletionTimestamp() != nil {
+		return
+	}
+	jobList := &batchv1.JobList{}
+	err = j.client.List(context.TODO(), &client.ListOptions{Namespace: util.JobNamespace(*instance)}, jobList)
+	if err != nil {
+		log.Error(err, "unable to list the jobs of the GitOpsConfig", "instance", instance.GetName())
+		return
+	}
+	ttl := time.Duration(*instance.Spec.JobTemplate.TTLSecondsAfterFinished) * time.Second
+	for _, expired := range expiredJobs(instance, jobList.Items, ttl, jobHistoryLimit, time.Now()) {
+		log.Info("Deleting the expired job", "job", expired.GetName(), "instance", instance.GetName())
+		err = j.client.Delete(context.TODO(), expired, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "unable to delete the expired job", "job", expired.GetName())
+		}
+	}
+}
+
+// expiredJobs returns the jobs created by instance that finished more than ttl before now, except the keep most
+// recent finished ones
+func expiredJobs(instance *gitopsv1alpha1.GitOpsConfig, jobs []batchv1.Job, ttl time.Duration, keep int, now time.Time) []*batchv1.Job {
+	finished := []*batchv1.Job{}
+	for i := range jobs {
+		job := &jobs[i]
+		if !isOwner(instance, job) || !isJobFinished(job) {
+			continue
+		}
+		finished = append(finished, job)
+	}
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[b].CreationTimestamp.Before(&finished[a].CreationTimestamp)
+	})
+	expired := []*batchv1.Job{}
+	for i, job := range finished {
+		if i < keep {
+			continue
+		}
+		if at, ok := jobFinishTime(job); ok && !now.Before(at.Add(ttl)) {
+			expired = append(expired, job)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newHistoryJob returns a job of gitops created at created, with the given status
+func newHistoryJob(index int, created time.Time, status batchv1.JobStatus) *batchv1.Job {
+	job := newOwnedJob(status)
+	job.Name = fmt.Sprintf("gitopsconfig-gitops-operator-%d", index)
+	job.CreationTimestamp = metav1.NewTime(created)
+	return job
+}
+
+func TestCleanupFinishedJobs(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	now := time.Now()
+	ttl := int32(3600)
+	tests := []struct {
+		name        string
+		ttl         *int32
+		enforced    bool
+		historySize int
+		remaining   []string
+	}{
+		{"no ttl", nil, false, 3, []string{"0", "1", "2", "3", "4", "5", "6"}},
+		{"ttl enforced by the cluster", &ttl, true, 3, []string{"0", "1", "2", "3", "4", "5", "6"}},
+		// the expired jobs are deleted, except the 3 most recent finished ones, the running job is kept
+		{"ttl not supported", &ttl, false, 3, []string{"2", "4", "5", "6"}},
+		{"no history", &ttl, false, 0, []string{"2", "6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer SetJobHistoryLimit(jobHistoryLimit)
+			SetJobHistoryLimit(tt.historySize)
+			instance := gitops.DeepCopy()
+			instance.Spec.JobTemplate = &gitopsv1alpha1.JobTemplate{TTLSecondsAfterFinished: tt.ttl}
+			jobs := []*batchv1.Job{
+				newHistoryJob(0, now.Add(-6*time.Hour), succeededAt(now.Add(-6*time.Hour))),
+				newHistoryJob(1, now.Add(-5*time.Hour), failedAt(now.Add(-5*time.Hour))),
+				newHistoryJob(2, now.Add(-4*time.Hour), batchv1.JobStatus{Active: 1}),
+				newHistoryJob(3, now.Add(-3*time.Hour), succeededAt(now.Add(-3*time.Hour))),
+				newHistoryJob(4, now.Add(-2*time.Hour), succeededAt(now.Add(-2*time.Hour))),
+				newHistoryJob(5, now.Add(-90*time.Minute), succeededAt(now.Add(-90*time.Minute))),
+				newHistoryJob(6, now.Add(-time.Minute), succeededAt(now)),
+			}
+			objects := []runtime.Object{instance}
+			for _, job := range jobs {
+				objects = append(objects, job)
+			}
+			cl := fake.NewFakeClient(objects...)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+			finished := jobs[6].DeepCopy()
+			if tt.enforced {
+				finished.Spec.TTLSecondsAfterFinished = tt.ttl
+			}
+
+			emitter.cleanupFinishedJobs(gitops, finished)
+
+			jobList := &batchv1.JobList{}
+			err := cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobList)
+			if !assert.NoError(t, err) {
+				return
+			}
+			remaining := []string{}
+			for _, job := range jobList.Items {
+				remaining = append(remaining, job.Name[len("gitopsconfig-gitops-operator-"):])
+			}
+			assert.ElementsMatch(t, tt.remaining, remaining)
+		})
+	}
+}
+
+func TestOnDeleteReportsUnreportedCompletions(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	now := time.Now()
+	reported := func(job *batchv1.Job) *batchv1.Job {
+		job.Annotations = map[string]string{completionReportedAnnotation: "true"}
+		return job
+	}
+	deletedAt := func(job *batchv1.Job, deleted time.Time) *batchv1.Job {
+		deletion := metav1.NewTime(deleted)
+		job.DeletionTimestamp = &deletion
+		job.Finalizers = []string{metav1.FinalizerDeleteDependents}
+		return job
+	}
+	tests := []struct {
+		name  string
+		job   *batchv1.Job
+		event string
+	}{
+		{"never seen finishing", newOwnedJob(failedAt(now)), "Warning JobFailed"},
+		{"deleted by its ttl", reported(newOwnedJob(failedAt(now))), ""},
+		{"finished before the operator started", newOwnedJob(failedAt(operatorStart.Add(-time.Hour))), ""},
+		{"deleted while running", newOwnedJob(batchv1.JobStatus{Active: 1}), ""},
+		{"failed by its deletion", deletedAt(newOwnedJob(failedAt(now)), now.Add(-time.Second)), ""},
+		{"failed by its deletion without condition", deletedAt(newOwnedJob(batchv1.JobStatus{Failed: 1}), now), ""},
+		{"deleted once failed", deletedAt(newOwnedJob(failedAt(now)), now.Add(time.Second)), "Warning JobFailed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   fake.NewFakeClient(gitops.DeepCopy()),
+				scheme:   s,
+				recorder: recorder,
+			}
+			emitter.OnDelete(tt.job)
+			events := drainEvents(recorder)
+			if tt.event == "" {
+				assert.Empty(t, events)
+				return
+			}
+			if assert.Len(t, events, 1) {
+				assert.Contains(t, events[0], tt.event)
+			}
+		})
+	}
+}
+
+func TestDeletedJobs(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	started := metav1.NewTime(time.Now().Add(-time.Minute))
+	deletion := metav1.Now()
+	running := newOwnedJob(batchv1.JobStatus{Active: 1, StartTime: &started})
+	running.UID = "running"
+	running.CreationTimestamp = started
+	deleting := running.DeepCopy()
+	deleting.DeletionTimestamp = &deletion
+	deleting.Finalizers = []string{metav1.FinalizerDeleteDependents}
+	// the pod killed by the deletion fails the job
+	killed := deleting.DeepCopy()
+	killed.Status = batchv1.JobStatus{
+		Failed:    1,
+		StartTime: &started,
+		Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now(), Reason: "BackoffLimitExceeded"},
+		},
+	}
+	completedAt := metav1.Now()
+	completed := running.DeepCopy()
+	completed.UID = "completed"
+	completed.Status = batchv1.JobStatus{
+		Succeeded:      1,
+		StartTime:      &started,
+		CompletionTime: &completedAt,
+		Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: completedAt},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		events func(emitter *jobCompletionEmitter)
+		event  string
+	}{
+		{"running job deleted", func(emitter *jobCompletionEmitter) {
+			emitter.OnUpdate(running, deleting)
+			emitter.OnDelete(deleting)
+		}, ""},
+		{"running job failed by its deletion", func(emitter *jobCompletionEmitter) {
+			emitter.OnUpdate(running, deleting)
+			emitter.OnUpdate(deleting, killed)
+			emitter.OnDelete(killed)
+		}, ""},
+		{"running job deleted, only its final state seen", func(emitter *jobCompletionEmitter) {
+			emitter.OnDelete(cache.DeletedFinalStateUnknown{Key: namespace + "/" + killed.Name, Obj: killed})
+		}, ""},
+		{"completed job deleted", func(emitter *jobCompletionEmitter) {
+			emitter.OnUpdate(running, completed)
+			emitter.OnDelete(reportedCompletion(completed))
+		}, "Normal JobSuccessful"},
+		{"completed job deleted before its completion was seen", func(emitter *jobCompletionEmitter) {
+			emitter.OnDelete(completed)
+		}, "Normal JobSuccessful"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(50)
+			emitter := &jobCompletionEmitter{
+				client:   fake.NewFakeClient(gitops.DeepCopy()),
+				scheme:   s,
+				recorder: recorder,
+			}
+			tt.events(emitter)
+			events := strings.Join(drainEvents(recorder), "\n")
+			assert.NotContains(t, events, "JobFailed")
+			if tt.event == "" {
+				assert.Empty(t, events)
+				return
+			}
+			assert.Equal(t, 1, strings.Count(events, tt.event))
+		})
+	}
+}
+
+// reportedCompletion returns job once its completion was reported
+func reportedCompletion(job *batchv1.Job) *batchv1.Job {
+	reported := job.DeepCopy()
+	reported.Annotations = map[string]string{completionReportedAnnotation: "true"}
+	return reported
+}
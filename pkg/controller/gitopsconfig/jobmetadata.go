@@ -0,0 +1,68 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reservedJobLabels are the labels of the jobs used by Eunomia and the job controller
+var reservedJobLabels = map[string]bool{
+	"action":         true,
+	"job-name":       true,
+	"controller-uid": true,
+}
+
+// isReservedJobMetadata returns true if key is a label or annotation the users cannot set on the jobs
+func isReservedJobMetadata(key string) bool {
+	return reservedJobLabels[key] || strings.Contains(key, "eunomia.kohls.io/")
+}
+
+// applyJobMetadata adds the labels and annotations of the jobMetadata, then of the jobTemplate, of instance to meta.
+// The reserved ones and the ones already in meta, set by Eunomia, are skipped.
+func applyJobMetadata(instance *gitopsv1alpha1.GitOpsConfig, meta *metav1.ObjectMeta) {
+	meta.Labels = mergeJobMetadata(instance, meta.Labels, instance.Spec.JobMetadata.Labels, "label")
+	meta.Annotations = mergeJobMetadata(instance, meta.Annotations, instance.Spec.JobMetadata.Annotations, "annotation")
+	applyPodMetadata(instance, meta)
+}
+
+// applyPodMetadata adds the labels and annotations of the jobTemplate of instance to meta, e.g. the metadata of the
+// pod template of a job. The reserved ones and the ones already in meta are skipped.
+func applyPodMetadata(instance *gitopsv1alpha1.GitOpsConfig, meta *metav1.ObjectMeta) {
+	if instance.Spec.JobTemplate == nil {
+		return
+	}
+	meta.Labels = mergeJobMetadata(instance, meta.Labels, instance.Spec.JobTemplate.Labels, "label")
+	meta.Annotations = mergeJobMetadata(instance, meta.Annotations, instance.Spec.JobTemplate.Annotations, "annotation")
+}
+
+func mergeJobMetadata(instance *gitopsv1alpha1.GitOpsConfig, current, custom map[string]string, kind string) map[string]string {
+	for key, value := range custom {
+		if _, ok := current[key]; ok || isReservedJobMetadata(key) {
+			log.Info("Ignoring reserved job metadata", "instance", instance.GetName(), kind, key)
+			continue
+		}
+		if current == nil {
+			current = map[string]string{}
+		}
+		current[key] = value
+	}
+	return current
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newJobMetadataInstance() *gitopsv1alpha1.GitOpsConfig {
+	instance := gitops.DeepCopy()
+	instance.Spec.JobMetadata = gitopsv1alpha1.JobMetadata{
+		Labels: map[string]string{
+			"cost-center":    "1234",
+			"team":           "platform",
+			"action":         "delete",
+			"job-name":       "other",
+			"controller-uid": "abc",
+		},
+		Annotations: map[string]string{
+			"monitoring.example.com/owner":   "platform",
+			jobAttemptAnnotation:             "7",
+			"gitopsconfig.eunomia.kohls.io/": "x",
+		},
+	}
+	return instance
+}
+
+func assertJobMetadata(t *testing.T, meta metav1.ObjectMeta) {
+	assert.Equal(t, "1234", meta.Labels["cost-center"])
+	assert.Equal(t, "platform", meta.Labels["team"])
+	assert.NotContains(t, meta.Labels, "job-name")
+	assert.NotContains(t, meta.Labels, "controller-uid")
+	assert.Equal(t, "platform", meta.Annotations["monitoring.example.com/owner"])
+	assert.NotContains(t, meta.Annotations, jobAttemptAnnotation)
+	assert.NotContains(t, meta.Annotations, "gitopsconfig.eunomia.kohls.io/")
+}
+
+func TestJobMetadata(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := newJobMetadataInstance()
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		job := jobs.Items[0]
+		assertJobMetadata(t, job.ObjectMeta)
+		// the labels of Eunomia are preserved
+		assert.Equal(t, "create", job.Labels["action"])
+		assert.Equal(t, "gitops-operator", job.OwnerReferences[0].Name)
+	}
+}
+
+func TestJobMetadataRetry(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := newJobMetadataInstance()
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createJob("create", instance, 2, "", "", "")
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		assert.Equal(t, "1234", jobs.Items[0].Labels["cost-center"])
+		assert.Equal(t, "2", jobs.Items[0].Annotations[jobAttemptAnnotation])
+	}
+}
+
+func TestCronJobMetadata(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := newJobMetadataInstance()
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createCronJob(instance)
+	assert.NoError(t, err)
+
+	cronjob := &batchv1beta1.CronJob{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator", Namespace: namespace}, cronjob))
+	assertJobMetadata(t, cronjob.ObjectMeta)
+	assertJobMetadata(t, cronjob.Spec.JobTemplate.ObjectMeta)
+	assert.Equal(t, "gitops-operator", cronjob.OwnerReferences[0].Name)
+}
+
+func TestJobTemplateMetadata(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := newJobMetadataInstance()
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+	instance.Spec.JobTemplate = &gitopsv1alpha1.JobTemplate{
+		Labels: map[string]string{
+			"cost-center":    "5678",
+			"network-zone":   "git-egress",
+			"action":         "delete",
+			"controller-uid": "abc",
+		},
+		Annotations: map[string]string{
+			"sidecar.istio.io/inject":             "false",
+			"gitopsconfig.eunomia.kohls.io/owner": "team-b/other",
+		},
+	}
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	assertJobTemplateMetadata := func(meta metav1.ObjectMeta) {
+		assert.Equal(t, "git-egress", meta.Labels["network-zone"])
+		assert.Equal(t, "false", meta.Annotations["sidecar.istio.io/inject"])
+		assert.NotContains(t, meta.Labels, "controller-uid")
+		assert.NotContains(t, meta.Annotations, "gitopsconfig.eunomia.kohls.io/owner")
+	}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	job := jobs.Items[0]
+	assertJobTemplateMetadata(job.ObjectMeta)
+	assertJobTemplateMetadata(job.Spec.Template.ObjectMeta)
+	// the jobMetadata takes precedence, the labels of Eunomia are preserved
+	assert.Equal(t, "1234", job.Labels["cost-center"])
+	assert.Equal(t, "5678", job.Spec.Template.Labels["cost-center"])
+	assert.Equal(t, "create", job.Labels["action"])
+	assert.NotContains(t, job.Spec.Template.Labels, "action")
+
+	// the job is still found to be owned by the GitOpsConfig, and its completion reported
+	owner, err := findJobOwner(&job, cl, cl)
+	assert.NoError(t, err)
+	if assert.NotNil(t, owner) {
+		assert.Equal(t, name, owner.GetName())
+		assert.Equal(t, namespace, owner.GetNamespace())
+	}
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	running, succeeded := job.DeepCopy(), job.DeepCopy()
+	running.Status = batchv1.JobStatus{Active: 1}
+	succeeded.Status = batchv1.JobStatus{Succeeded: 1}
+	emitter.OnUpdate(running, succeeded)
+	assert.Contains(t, strings.Join(drainEvents(recorder), "\n"), "Normal JobSuccessful")
+
+	_, err = r.createCronJob(instance)
+	assert.NoError(t, err)
+	cronjob := &batchv1beta1.CronJob{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator", Namespace: namespace}, cronjob))
+	assertJobTemplateMetadata(cronjob.ObjectMeta)
+	assertJobTemplateMetadata(cronjob.Spec.JobTemplate.ObjectMeta)
+	assertJobTemplateMetadata(cronjob.Spec.JobTemplate.Spec.Template.ObjectMeta)
+}
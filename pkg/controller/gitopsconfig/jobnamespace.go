@@ -0,0 +1,232 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// jobOwnerAnnotation holds the <namespace>/<name> of the GitOpsConfig owning a job or cronjob created in its
+	// jobNamespace. Owner references can't cross namespaces, they are only set in the namespace of the GitOpsConfig.
+	jobOwnerAnnotation string = "gitopsconfig.eunomia.kohls.io/owner"
+	// jobOwnerUIDAnnotation holds the UID of the GitOpsConfig owning a job or cronjob created in its jobNamespace
+	jobOwnerUIDAnnotation string = "gitopsconfig.eunomia.kohls.io/owner-uid"
+	// allowedSourceNamespacesAnnotation lists, comma separated, the namespaces whose GitOpsConfigs may use the
+	// namespace it is set on as their jobNamespace, their jobs running with its service accounts and Secrets
+	allowedSourceNamespacesAnnotation string = "gitopsconfig.eunomia.kohls.io/allowed-source-namespaces"
+)
+
+// validateJobNamespace verifies the jobNamespace set by spec
+func validateJobNamespace(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.JobNamespace != "" && len(validation.IsDNS1123Label(spec.JobNamespace)) > 0 {
+		return fmt.Errorf("jobNamespace %q is not a valid namespace name", spec.JobNamespace)
+	}
+	return nil
+}
+
+// checkJobNamespaceAccess verifies that the jobNamespace of instance allows the GitOpsConfigs of the namespace of
+// instance to run their jobs in it, and that the operator can create the given resource of the batch group, jobs or
+// cronjobs, in it. The namespace of instance itself isn't checked.
+func (r *ReconcileGitOpsConfig) checkJobNamespaceAccess(instance *gitopsv1alpha1.GitOpsConfig, resource string) error {
+	namespace := util.JobNamespace(*instance)
+	if namespace == instance.GetNamespace() {
+		return nil
+	}
+	// the jobs use the service accounts and Secrets of the jobNamespace, which must opt in
+	ns := &corev1.Namespace{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: namespace}, ns)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "unable to lookup the job namespace", "instance", instance.GetName(), "namespace", namespace)
+		return err
+	}
+	if !allowsSourceNamespace(ns, instance.GetNamespace()) {
+		r.recorder.Eventf(instance, "Warning", "JobNamespaceNotAllowed", "Namespace %s doesn't list namespace %s in its %s annotation", namespace, instance.GetNamespace(), allowedSourceNamespacesAnnotation)
+		return fmt.Errorf("namespace %s doesn't allow the GitOpsConfigs of namespace %s to run their %s in it", namespace, instance.GetNamespace(), resource)
+	}
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "create",
+				Group:     "batch",
+				Resource:  resource,
+			},
+		},
+	}
+	err = r.client.Create(context.TODO(), review)
+	if err != nil {
+		log.Error(err, "unable to review the access to the job namespace", "instance", instance.GetName(), "namespace", namespace)
+		return err
+	}
+	if !review.Status.Allowed {
+		r.recorder.Eventf(instance, "Warning", "JobNamespaceForbidden", "The operator isn't allowed to create %s in namespace %s", resource, namespace)
+		return fmt.Errorf("the operator isn't allowed to create %s in namespace %s", resource, namespace)
+	}
+	return nil
+}
+
+// allowsSourceNamespace returns true if ns lists source in its allowedSourceNamespacesAnnotation
+func allowsSourceNamespace(ns *corev1.Namespace, source string) bool {
+	for _, allowed := range strings.Split(ns.GetAnnotations()[allowedSourceNamespacesAnnotation], ",") {
+		if strings.TrimSpace(allowed) == source {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteStaleCronJobs deletes the cronjobs created for the GitOpsConfig owner in another namespace than its own,
+// except keep, e.g. when its jobNamespace changed or once it is deleted. Without owner references they aren't garbage
+// collected, and would keep starting jobs.
+func (r *ReconcileGitOpsConfig) deleteStaleCronJobs(owner, keep types.NamespacedName) error {
+	cronjobs := &batchv1beta1.CronJobList{}
+	err := r.client.List(context.TODO(), &client.ListOptions{}, cronjobs)
+	if err != nil {
+		log.Error(err, "unable to list the cronjobs", "instance", owner.Name)
+		return err
+	}
+	for i := range cronjobs.Items {
+		cronjob := &cronjobs.Items[i]
+		if annotated, ok := annotatedOwnerName(cronjob); !ok || annotated != owner {
+			continue
+		}
+		if cronjob.GetNamespace() == keep.Namespace && cronjob.GetName() == keep.Name {
+			continue
+		}
+		log.Info("Deleting stale CronJob", "cronjob.Namespace", cronjob.GetNamespace(), "cronjob.Name", cronjob.GetName())
+		err = r.client.Delete(context.TODO(), cronjob, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "unable to delete the stale cronjob", "cronjob", cronjob.GetName())
+			return err
+		}
+	}
+	return nil
+}
+
+// setJobOwner makes instance the controller of obj, a job or cronjob. When obj is in another namespace, its owner is
+// recorded in annotations instead of an owner reference, and it isn't garbage collected with instance.
+func setJobOwner(instance *gitopsv1alpha1.GitOpsConfig, obj metav1.Object, scheme *runtime.Scheme) error {
+	if obj.GetNamespace() == instance.GetNamespace() {
+		return controllerutil.SetControllerReference(instance, obj, scheme)
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[jobOwnerAnnotation] = instance.GetNamespace() + "/" + instance.GetName()
+	annotations[jobOwnerUIDAnnotation] = string(instance.GetUID())
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// annotatedOwnerName returns the namespaced name of the GitOpsConfig recorded in the owner annotations of a job
+// or cronjob, and false if the annotations are missing
+func annotatedOwnerName(obj metav1.Object) (types.NamespacedName, bool) {
+	parts := strings.SplitN(obj.GetAnnotations()[jobOwnerAnnotation], "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, true
+}
+
+// getAnnotatedOwner returns the GitOpsConfig recorded in the owner annotations of a job or cronjob, with only its
+// type, name, namespace and UID set. It returns nil if the annotations are missing.
+func getAnnotatedOwner(obj metav1.Object) *gitopsv1alpha1.GitOpsConfig {
+	owner, ok := annotatedOwnerName(obj)
+	if !ok {
+		return nil
+	}
+	return &gitopsv1alpha1.GitOpsConfig{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: gitopsv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "GitOpsConfig",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      owner.Name,
+			Namespace: owner.Namespace,
+			UID:       types.UID(obj.GetAnnotations()[jobOwnerUIDAnnotation]),
+		},
+	}
+}
+
+// verifyAnnotatedOwner returns owner, read from the owner annotations of owned, once verified against the live
+// GitOpsConfig: the annotations can be set by anyone creating jobs or cronjobs, in any namespace. owned must carry
+// the UID of the GitOpsConfig, be in its jobNamespace, and that namespace must allow the GitOpsConfigs of its
+// namespace, as checked when the jobs are created. It returns nil if any of these doesn't hold.
+func verifyAnnotatedOwner(owner *gitopsv1alpha1.GitOpsConfig, owned metav1.Object, kubeclient client.Client) (*gitopsv1alpha1.GitOpsConfig, error) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := kubeclient.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if owner.GetUID() == "" || owner.GetUID() != instance.GetUID() || owned.GetNamespace() != util.JobNamespace(*instance) {
+		log.Info("Ignoring the owner annotations not matching the GitOpsConfig", "object", owned.GetName(), "namespace", owned.GetNamespace(), "owner", owner.GetNamespace()+"/"+owner.GetName())
+		return nil, nil
+	}
+	if owned.GetNamespace() == instance.GetNamespace() {
+		return owner, nil
+	}
+	ns := &corev1.Namespace{}
+	err = kubeclient.Get(context.TODO(), types.NamespacedName{Name: owned.GetNamespace()}, ns)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if !allowsSourceNamespace(ns, instance.GetNamespace()) {
+		log.Info("Ignoring the owner annotations of a GitOpsConfig not allowed in the namespace", "object", owned.GetName(), "namespace", owned.GetNamespace(), "owner", owner.GetNamespace()+"/"+owner.GetName())
+		return nil, nil
+	}
+	return owner, nil
+}
+
+// isAnnotatedOwner returns true if owner is recorded in the owner annotations of owned
+func isAnnotatedOwner(owner, owned metav1.Object) bool {
+	annotations := owned.GetAnnotations()
+	return annotations[jobOwnerAnnotation] == owner.GetNamespace()+"/"+owner.GetName() &&
+		annotations[jobOwnerUIDAnnotation] == string(owner.GetUID())
+}
+
+// enqueueAnnotatedOwner maps the cronjobs created in the jobNamespace of a GitOpsConfig to the GitOpsConfig
+var enqueueAnnotatedOwner = &handler.EnqueueRequestsFromMapFunc{
+	ToRequests: handler.ToRequestsFunc(func(object handler.MapObject) []reconcile.Request {
+		owner, ok := annotatedOwnerName(object.Meta)
+		if !ok {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: owner}}
+	}),
+}
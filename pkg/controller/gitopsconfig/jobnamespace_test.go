@@ -0,0 +1,395 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const jobNamespace = "builds"
+
+// accessReviewClient answers the access reviews of the operator, allowing it to create jobs and cronjobs in the given namespaces
+type accessReviewClient struct {
+	client.Client
+	allowed map[string]bool
+}
+
+func (c accessReviewClient) Create(ctx context.Context, obj runtime.Object) error {
+	if review, ok := obj.(*authorizationv1.SelfSubjectAccessReview); ok {
+		review.Status.Allowed = c.allowed[review.Spec.ResourceAttributes.Namespace]
+		return nil
+	}
+	return c.Client.Create(ctx, obj)
+}
+
+// objectRecorder records the namespace and name of the objects the events are recorded on, with their reason
+type objectRecorder struct {
+	events []string
+}
+
+func (r *objectRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	meta, _ := object.(metav1.Object)
+	r.events = append(r.events, fmt.Sprintf("%s/%s %s", meta.GetNamespace(), meta.GetName(), reason))
+}
+
+func (r *objectRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, "")
+}
+
+func (r *objectRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, "")
+}
+
+func (r *objectRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, "")
+}
+
+func newJobNamespaceConfig() *gitopsv1alpha1.GitOpsConfig {
+	instance := gitops.DeepCopy()
+	instance.UID = "0b1c2d3e"
+	instance.Spec.JobNamespace = jobNamespace
+	return instance
+}
+
+// newJobNamespace returns the jobNamespace allowing the GitOpsConfigs of the given namespaces to run their jobs in it
+func newJobNamespace(sources string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: jobNamespace, Annotations: map[string]string{allowedSourceNamespacesAnnotation: sources}}}
+}
+
+func TestCreateJobInJobNamespace(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := newJobNamespaceConfig()
+	cl := accessReviewClient{Client: fake.NewFakeClient(instance, newJobNamespace("team-a, gitops")), allowed: map[string]bool{jobNamespace: true}}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createJob("create", instance, 0, "", "", "")
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Empty(t, jobs.Items)
+	jobs = &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: jobNamespace}, jobs))
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	job := jobs.Items[0]
+	// owner references can't cross namespaces
+	assert.Empty(t, job.OwnerReferences)
+	assert.Equal(t, "gitops/gitops-operator", job.Annotations[jobOwnerAnnotation])
+	assert.Equal(t, "0b1c2d3e", job.Annotations[jobOwnerUIDAnnotation])
+	assert.True(t, isOwner(instance, &job))
+
+	other := newJobNamespaceConfig()
+	other.UID = "9f8e7d6c"
+	assert.False(t, isOwner(other, &job), "a GitOpsConfig recreated with the same name doesn't own the job")
+}
+
+func TestCreateJobInForbiddenJobNamespace(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := newJobNamespaceConfig()
+	cl := accessReviewClient{Client: fake.NewFakeClient(instance, newJobNamespace("gitops")), allowed: map[string]bool{}}
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+	_, err := r.createJob("create", instance, 0, "", "", "")
+	assert.EqualError(t, err, "the operator isn't allowed to create jobs in namespace builds")
+	assert.Contains(t, <-recorder.Events, "Warning JobNamespaceForbidden")
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: jobNamespace}, jobs))
+	assert.Empty(t, jobs.Items)
+
+	_, err = r.createCronJob(instance)
+	assert.EqualError(t, err, "the operator isn't allowed to create cronjobs in namespace builds")
+}
+
+func TestCreateJobInJobNamespaceNotAllowed(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name      string
+		namespace *corev1.Namespace
+	}{
+		{"missing", nil},
+		{"no annotation", &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: jobNamespace}}},
+		{"other namespaces", newJobNamespace("team-a,gitops-staging")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newJobNamespaceConfig()
+			objects := []runtime.Object{instance}
+			if tt.namespace != nil {
+				objects = append(objects, tt.namespace)
+			}
+			// the operator itself could create the jobs, but the jobNamespace didn't opt in
+			cl := accessReviewClient{Client: fake.NewFakeClient(objects...), allowed: map[string]bool{jobNamespace: true}}
+			recorder := record.NewFakeRecorder(10)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+			_, err := r.createJob("create", instance, 0, "", "", "")
+			assert.EqualError(t, err, "namespace builds doesn't allow the GitOpsConfigs of namespace gitops to run their jobs in it")
+			assert.Contains(t, <-recorder.Events, "Warning JobNamespaceNotAllowed")
+			jobs := &batchv1.JobList{}
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: jobNamespace}, jobs))
+			assert.Empty(t, jobs.Items)
+
+			_, err = r.createCronJob(instance)
+			assert.EqualError(t, err, "namespace builds doesn't allow the GitOpsConfigs of namespace gitops to run their cronjobs in it")
+		})
+	}
+}
+
+func TestCreateCronJobInJobNamespace(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := newJobNamespaceConfig()
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "*/5 * * * *"}}
+	// a GitOpsConfig of the same name in another namespace, sharing the jobNamespace
+	other := newJobNamespaceConfig()
+	other.Namespace = "team-a"
+	other.UID = "9f8e7d6c"
+	cl := accessReviewClient{Client: fake.NewFakeClient(instance, other, newJobNamespace("gitops,team-a")), allowed: map[string]bool{jobNamespace: true}}
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+	_, err := r.createCronJob(instance)
+	assert.NoError(t, err)
+	_, err = r.createCronJob(other)
+	assert.NoError(t, err)
+	cronjobs := &batchv1beta1.CronJobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: jobNamespace}, cronjobs))
+	if assert.Len(t, cronjobs.Items, 2) {
+		owners := map[string]string{}
+		for _, cronjob := range cronjobs.Items {
+			owners[cronjob.Name] = cronjob.Annotations[jobOwnerAnnotation]
+			// the jobs of the cronjob name their GitOpsConfig too
+			assert.Equal(t, cronjob.Annotations[jobOwnerAnnotation], cronjob.Spec.JobTemplate.Annotations[jobOwnerAnnotation])
+			assert.Equal(t, cronjob.Annotations[jobOwnerUIDAnnotation], cronjob.Spec.JobTemplate.Annotations[jobOwnerUIDAnnotation])
+		}
+		assert.Equal(t, map[string]string{
+			"gitopsconfig-gitops-gitops-operator": "gitops/gitops-operator",
+			"gitopsconfig-team-a-gitops-operator": "team-a/gitops-operator",
+		}, owners)
+	}
+
+	// the cronjob of a GitOpsConfig recreated with the same name isn't taken over
+	recreated := instance.DeepCopy()
+	recreated.UID = "5a4b3c2d"
+	_, err = r.createCronJob(recreated)
+	assert.EqualError(t, err, "cronjob gitopsconfig-gitops-gitops-operator of namespace builds belongs to another GitOpsConfig")
+	assert.Contains(t, strings.Join(drainEvents(recorder), "\n"), "Warning CronJobConflict")
+	cronjob := &batchv1beta1.CronJob{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-gitops-operator", Namespace: jobNamespace}, cronjob))
+	assert.Equal(t, "0b1c2d3e", cronjob.Annotations[jobOwnerUIDAnnotation])
+}
+
+func TestDeleteStaleCronJobs(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cronjob := func(namespace, name, owner string) *batchv1beta1.CronJob {
+		return &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: map[string]string{jobOwnerAnnotation: owner, jobOwnerUIDAnnotation: "0b1c2d3e"},
+		}}
+	}
+	cl := fake.NewFakeClient(
+		cronjob("builds", "gitopsconfig-gitops-gitops-operator", "gitops/gitops-operator"),
+		// left in the previous jobNamespace
+		cronjob("old-builds", "gitopsconfig-gitops-gitops-operator", "gitops/gitops-operator"),
+		// named before the cronjobs of other namespaces were prefixed with the namespace of their GitOpsConfig
+		cronjob("builds", "gitopsconfig-gitops-operator", "gitops/gitops-operator"),
+		cronjob("builds", "gitopsconfig-team-a-gitops-operator", "team-a/gitops-operator"),
+	)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	remaining := func() []string {
+		cronjobs := &batchv1beta1.CronJobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{}, cronjobs))
+		names := []string{}
+		for _, cronjob := range cronjobs.Items {
+			names = append(names, cronjob.Namespace+"/"+cronjob.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	owner := types.NamespacedName{Name: name, Namespace: namespace}
+
+	assert.NoError(t, r.deleteStaleCronJobs(owner, types.NamespacedName{Name: "gitopsconfig-gitops-gitops-operator", Namespace: jobNamespace}))
+	assert.Equal(t, []string{"builds/gitopsconfig-gitops-gitops-operator", "builds/gitopsconfig-team-a-gitops-operator"}, remaining())
+
+	// the GitOpsConfig was deleted
+	assert.NoError(t, r.deleteStaleCronJobs(owner, types.NamespacedName{}))
+	assert.Equal(t, []string{"builds/gitopsconfig-team-a-gitops-operator"}, remaining())
+}
+
+func TestCreateJobInOwnNamespace(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.JobNamespace = namespace
+	// the access to the namespace of the GitOpsConfig isn't reviewed
+	cl := accessReviewClient{Client: fake.NewFakeClient(instance), allowed: map[string]bool{}}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createJob("create", instance, 0, "", "", "")
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		assert.Len(t, jobs.Items[0].OwnerReferences, 1)
+		assert.Empty(t, jobs.Items[0].Annotations[jobOwnerAnnotation])
+	}
+}
+
+func TestJobCompletionEmitterJobNamespace(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := newJobNamespaceConfig()
+	pod := newTerminatedPod(`{"commitMessage":"Scale the frontend","commit":"abc123"}`)
+	pod.Namespace = jobNamespace
+	cl := fake.NewFakeClient(instance, newJobNamespace("gitops"), pod)
+	recorder := &objectRecorder{}
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	job := func(status batchv1.JobStatus) *batchv1.Job {
+		job := newOwnedJob(status)
+		job.Namespace = jobNamespace
+		job.OwnerReferences = nil
+		job.Annotations = map[string]string{jobOwnerAnnotation: "gitops/gitops-operator", jobOwnerUIDAnnotation: "0b1c2d3e"}
+		return job
+	}
+
+	emitter.OnUpdate(job(batchv1.JobStatus{Active: 1}), job(batchv1.JobStatus{Succeeded: 1}))
+	// the events are recorded on the GitOpsConfig, in its own namespace, and its status is updated
+	assert.Contains(t, recorder.events, "gitops/gitops-operator JobSuccessful")
+	for _, event := range recorder.events {
+		assert.Contains(t, event, "gitops/gitops-operator ")
+	}
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+	assert.Equal(t, "Scale the frontend", updated.Status.LastAppliedCommitMessage)
+}
+
+func TestFindJobOwnerThroughCronJobInJobNamespace(t *testing.T) {
+	controller := true
+	cronjob := &batchv1beta1.CronJob{
+		TypeMeta: metav1.TypeMeta{APIVersion: "batch/v1beta1", Kind: "CronJob"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "gitopsconfig-gitops-operator",
+			Namespace:   jobNamespace,
+			Annotations: map[string]string{jobOwnerAnnotation: "gitops/gitops-operator", jobOwnerUIDAnnotation: "0b1c2d3e"},
+		},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "gitopsconfig-gitops-operator-1571130000",
+			Namespace:       jobNamespace,
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: cronjob.Name, Controller: &controller}},
+		},
+	}
+	owner, err := findJobOwner(job, fake.NewFakeClient(newJobNamespaceConfig(), newJobNamespace("gitops")), fake.NewFakeClient(cronjob))
+	assert.NoError(t, err)
+	if assert.NotNil(t, owner) {
+		assert.Equal(t, namespace, owner.Namespace)
+		assert.Equal(t, name, owner.Name)
+		assert.Equal(t, types.UID("0b1c2d3e"), owner.UID)
+		assert.Equal(t, "GitOpsConfig", owner.Kind)
+	}
+}
+
+func TestValidateJobNamespace(t *testing.T) {
+	assert.NoError(t, validateJobNamespace(gitopsv1alpha1.GitOpsConfigSpec{}))
+	assert.NoError(t, validateJobNamespace(gitopsv1alpha1.GitOpsConfigSpec{JobNamespace: "team-builds"}))
+	assert.Error(t, validateJobNamespace(gitopsv1alpha1.GitOpsConfigSpec{JobNamespace: "Team_Builds"}))
+}
+
+func TestMissingSecretInJobNamespace(t *testing.T) {
+	instance := newJobNamespaceConfig()
+	instance.Spec.ParameterSource.SecretRef = ""
+	// the secret exists in the namespace of the GitOpsConfig, but the jobs mount it from theirs
+	cl := fake.NewFakeClient(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pio", Namespace: namespace}})
+	r := &ReconcileGitOpsConfig{client: cl, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(10)}
+
+	missing, err := r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Equal(t, "Secret pio", missing)
+
+	assert.NoError(t, cl.Create(context.TODO(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pio", Namespace: jobNamespace}}))
+	missing, err = r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestJobCompletionEmitterOwnerInOtherNamespace(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	central := gitops.DeepCopy()
+	central.Namespace = "eunomia-system"
+	central.UID = "0b1c2d3e"
+	// another GitOpsConfig of the same name, in the namespace of the job
+	tenant := gitops.DeepCopy()
+	tenant.Namespace = jobNamespace
+	tenant.UID = "9f8e7d6c"
+	pod := newTerminatedPod(`{"commitMessage":"Scale the frontend","commit":"abc123"}`)
+	pod.Namespace = jobNamespace
+	cl := fake.NewFakeClient(central, tenant, pod)
+	recorder := &objectRecorder{}
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	// a job created by another tool, referencing the GitOpsConfig across namespaces
+	job := func(status batchv1.JobStatus) *batchv1.Job {
+		job := newOwnedJob(status)
+		job.Namespace = jobNamespace
+		job.OwnerReferences[0].UID = central.UID
+		return job
+	}
+
+	owner, err := findJobOwner(job(batchv1.JobStatus{}), cl, cl)
+	assert.NoError(t, err)
+	if assert.NotNil(t, owner) {
+		assert.Equal(t, "eunomia-system", owner.Namespace)
+	}
+
+	emitter.OnUpdate(job(batchv1.JobStatus{Active: 1}), job(batchv1.JobStatus{Succeeded: 1}))
+	assert.Contains(t, recorder.events, "eunomia-system/gitops-operator JobSuccessful")
+	for _, event := range recorder.events {
+		assert.Contains(t, event, "eunomia-system/gitops-operator ")
+	}
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "eunomia-system"}, updated))
+	assert.Equal(t, "Scale the frontend", updated.Status.LastAppliedCommitMessage)
+	other := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: jobNamespace}, other))
+	assert.Empty(t, other.Status.LastAppliedCommitMessage)
+}
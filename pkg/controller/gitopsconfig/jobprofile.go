@@ -0,0 +1,99 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/ghodss/yaml"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// jobProfileKey is the key of the job profile ConfigMaps holding the partial JobSpec
+const jobProfileKey = "jobSpec"
+
+// jobProfileNamespace is the namespace of the job profile ConfigMaps, empty disables job profiles
+var jobProfileNamespace string
+
+// SetJobProfileNamespace configures the namespace where the job profiles referenced by the GitOpsConfigs are looked up
+func SetJobProfileNamespace(namespace string) {
+	jobProfileNamespace = namespace
+}
+
+// jobProfileReader returns the reader used to get the job profiles and the referenced secrets
+func (r *ReconcileGitOpsConfig) jobProfileReader() client.Reader {
+	if r.profileReader != nil {
+		return r.profileReader
+	}
+	return r.client
+}
+
+// applyJobProfile merges the job profile referenced by instance, if any, under spec.
+// The settings of spec, rendered from the GitOpsConfig, override the ones of the profile.
+func (r *ReconcileGitOpsConfig) applyJobProfile(instance *gitopsv1alpha1.GitOpsConfig, spec *batchv1.JobSpec) error {
+	if instance.Spec.JobProfile == "" {
+		return nil
+	}
+	if jobProfileNamespace == "" {
+		return fmt.Errorf("job profile %s cannot be used, the namespace of the job profiles is unknown", instance.Spec.JobProfile)
+	}
+	profile := &corev1.ConfigMap{}
+	err := r.jobProfileReader().Get(context.TODO(), types.NamespacedName{Name: instance.Spec.JobProfile, Namespace: jobProfileNamespace}, profile)
+	if err != nil {
+		log.Error(err, "unable to lookup the job profile", "profile", instance.Spec.JobProfile, "namespace", jobProfileNamespace)
+		return err
+	}
+	merged, err := mergeJobProfile([]byte(profile.Data[jobProfileKey]), *spec)
+	if err != nil {
+		log.Error(err, "unable to merge the job profile", "profile", instance.Spec.JobProfile)
+		return err
+	}
+	*spec = merged
+	return nil
+}
+
+// mergeJobProfile returns the partial JobSpec of profile, in YAML, with spec
+// strategically merged on top of it. Lists like containers, env or volumes are
+// merged by name, as kubectl apply does.
+func mergeJobProfile(profile []byte, spec batchv1.JobSpec) (batchv1.JobSpec, error) {
+	base, err := yaml.YAMLToJSON(profile)
+	if err != nil {
+		return spec, err
+	}
+	// the profile must be a valid JobSpec on its own
+	if err = json.Unmarshal(base, &batchv1.JobSpec{}); err != nil {
+		return spec, fmt.Errorf("job profile is not a valid JobSpec: %v", err)
+	}
+	overrides, err := json.Marshal(spec)
+	if err != nil {
+		return spec, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(base, overrides, batchv1.JobSpec{})
+	if err != nil {
+		return spec, err
+	}
+	result := batchv1.JobSpec{}
+	err = json.Unmarshal(merged, &result)
+	return result, err
+}
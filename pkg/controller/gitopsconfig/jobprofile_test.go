@@ -0,0 +1,157 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const profileYAML = `
+activeDeadlineSeconds: 600
+backoffLimit: 10
+template:
+  spec:
+    serviceAccountName: profile-runner
+    nodeSelector:
+      node-role.kubernetes.io/gitops: "true"
+    containers:
+    - name: template-processor
+      resources:
+        limits:
+          memory: 512Mi
+`
+
+func newJobProfile(data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "restricted",
+			Namespace: "eunomia-operator",
+		},
+		Data: map[string]string{jobProfileKey: data},
+	}
+}
+
+func TestJobProfile(t *testing.T) {
+	defer SetJobProfileNamespace(jobProfileNamespace)
+	SetJobProfileNamespace("eunomia-operator")
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.JobProfile = "restricted"
+	cl := fake.NewFakeClient(instance, newJobProfile(profileYAML))
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs.Items, 1) {
+		spec := jobs.Items[0].Spec
+		// settings only in the profile are merged
+		if assert.NotNil(t, spec.ActiveDeadlineSeconds) {
+			assert.Equal(t, int64(600), *spec.ActiveDeadlineSeconds)
+		}
+		assert.Equal(t, map[string]string{"node-role.kubernetes.io/gitops": "true"}, spec.Template.Spec.NodeSelector)
+		// settings of the configuration win
+		assert.Equal(t, instance.Spec.ServiceAccountRef, spec.Template.Spec.ServiceAccountName)
+		if assert.NotNil(t, spec.BackoffLimit) {
+			assert.Equal(t, int32(4), *spec.BackoffLimit)
+		}
+		// containers are merged by name
+		if assert.Len(t, spec.Template.Spec.Containers, 1) {
+			container := spec.Template.Spec.Containers[0]
+			assert.Equal(t, instance.Spec.TemplateProcessorImage, container.Image)
+			assert.Equal(t, resource.MustParse("512Mi"), container.Resources.Limits[corev1.ResourceMemory])
+			assert.NotEmpty(t, container.Env)
+		}
+	}
+}
+
+func TestJobProfileCronJob(t *testing.T) {
+	defer SetJobProfileNamespace(jobProfileNamespace)
+	SetJobProfileNamespace("eunomia-operator")
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.JobProfile = "restricted"
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+	cl := fake.NewFakeClient(instance, newJobProfile(profileYAML))
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createCronJob(instance)
+	assert.NoError(t, err)
+
+	cronjobs := &batchv1beta1.CronJobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, cronjobs)
+	assert.NoError(t, err)
+	if assert.Len(t, cronjobs.Items, 1) {
+		spec := cronjobs.Items[0].Spec.JobTemplate.Spec
+		assert.Equal(t, map[string]string{"node-role.kubernetes.io/gitops": "true"}, spec.Template.Spec.NodeSelector)
+		assert.Equal(t, instance.Spec.ServiceAccountRef, spec.Template.Spec.ServiceAccountName)
+	}
+}
+
+func TestJobProfileErrors(t *testing.T) {
+	defer SetJobProfileNamespace(jobProfileNamespace)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name      string
+		namespace string
+		profile   *corev1.ConfigMap
+	}{
+		{"unknown namespace", "", newJobProfile(profileYAML)},
+		{"missing profile", "eunomia-operator", nil},
+		{"invalid profile", "eunomia-operator", newJobProfile("backoffLimit: many")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetJobProfileNamespace(tt.namespace)
+			instance := gitops.DeepCopy()
+			instance.Spec.JobProfile = "restricted"
+			objs := []runtime.Object{instance}
+			if tt.profile != nil {
+				objs = append(objs, tt.profile)
+			}
+			cl := fake.NewFakeClient(objs...)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+			_, err := r.CreateJob("create", instance)
+			assert.Error(t, err)
+
+			jobs := &batchv1.JobList{}
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+			assert.Empty(t, jobs.Items)
+		})
+	}
+}
@@ -0,0 +1,385 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxCommitMessageLength is the length beyond which commit messages are truncated
+const maxCommitMessageLength int = 100
+
+// maxSummaryResources is how many resources are named in the events summarizing a list of resources
+const maxSummaryResources int = 10
+
+// jobReport is what a job reports to the operator through its termination message
+type jobReport struct {
+	// CommitMessage is the subject of the applied template commit
+	CommitMessage string `json:"commitMessage,omitempty"`
+	// ForceApplied lists the resources that were applied forcing conflicts
+	ForceApplied []string `json:"forceApplied,omitempty"`
+	// Commit is the hash of the applied template commit
+	Commit string `json:"commit,omitempty"`
+	// ParameterCommit is the hash of the applied parameter commit
+	ParameterCommit string `json:"parameterCommit,omitempty"`
+	// Drifted lists the resources whose live state differed from the manifests before they were applied, it may be truncated
+	Drifted []string `json:"drifted,omitempty"`
+	// DriftedCount is the number of resources whose live state differed from the manifests
+	DriftedCount int `json:"driftedCount,omitempty"`
+	// Recreated lists the resources that were deleted and created again because of changes to immutable fields
+	Recreated []string `json:"recreated,omitempty"`
+	// Pruned lists the resources that were deleted, it may be truncated
+	Pruned []string `json:"pruned,omitempty"`
+	// PrunedCount is the number of resources that were deleted
+	PrunedCount int `json:"prunedCount,omitempty"`
+	// PruneSkipped lists the resources that weren't deleted because of the prune lists, it may be truncated
+	PruneSkipped []string `json:"pruneSkipped,omitempty"`
+	// ResourcesSkipped lists the rendered resources that weren't applied because of the kind lists, it may be truncated
+	ResourcesSkipped []string `json:"resourcesSkipped,omitempty"`
+	// OwnershipConflicts lists the resources applied by other GitOpsConfigs, with the GitOpsConfig applying them, e.g.
+	// deployment/web team-b/web, it may be truncated
+	OwnershipConflicts []string `json:"ownershipConflicts,omitempty"`
+	// Changed tells whether the job changed any resource, nil if it isn't known
+	Changed *bool `json:"changed,omitempty"`
+	// Inventory lists what was applied into each target namespace
+	Inventory []gitopsv1alpha1.NamespaceInventory `json:"inventory,omitempty"`
+	// ManagedResources summarizes the inventory of all the applied resources, nil when the run applied nothing
+	ManagedResources *gitopsv1alpha1.ManagedResources `json:"managedResources,omitempty"`
+	// Namespaces is the result in each target namespace, without the job
+	Namespaces []gitopsv1alpha1.TargetNamespaceResult `json:"namespaces,omitempty"`
+	// Applied lists the result of the apply of every object in debug mode, e.g. deployment.apps/web created, it may be truncated
+	Applied []string `json:"applied,omitempty"`
+	// TemplateMirror is the mirror the template source was cloned from, empty when it was cloned from its URI
+	TemplateMirror string `json:"templateMirror,omitempty"`
+	// ParameterMirror is the mirror the parameter source was cloned from, empty when it was cloned from its URI
+	ParameterMirror string `json:"parameterMirror,omitempty"`
+	// FailedContextDirs lists the contextDirs of the template source that failed to render, with continueOnError
+	FailedContextDirs []string `json:"failedContextDirs,omitempty"`
+	// ContextDirCount is the number of contextDirs of the template source, zero without contextDirs
+	ContextDirCount int `json:"contextDirCount,omitempty"`
+	// DryRun is what a dry run would have changed, nil for the other runs
+	DryRun *dryRunSummary `json:"dryRun,omitempty"`
+	// Phases lists the phases of the job in order, when they started
+	Phases []jobPhase `json:"phases,omitempty"`
+	// Finished is when the job finished, in seconds since the epoch
+	Finished float64 `json:"finished,omitempty"`
+}
+
+// parseJobReport parses the termination message of a job. Messages that are
+// not JSON are reported by older template processors and hold the commit message only.
+// A JSON report that doesn't parse was truncated, nothing is known of the run then.
+func parseJobReport(message string) jobReport {
+	report := jobReport{}
+	if err := json.Unmarshal([]byte(message), &report); err != nil {
+		if strings.HasPrefix(strings.TrimSpace(message), "{") {
+			log.Info("Ignoring the truncated report of a job", "length", len(message), "error", err.Error())
+			return jobReport{}
+		}
+		report = jobReport{CommitMessage: message}
+	}
+	report.CommitMessage = truncateCommitMessage(report.CommitMessage)
+	return report
+}
+
+// recordJobReport stores the report of job, read from its termination message,
+// in the status of owner. It returns the recorded report, and whether it shows
+// a drift that wasn't already reported by the previous job.
+func (j *jobCompletionEmitter) recordJobReport(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) (jobReport, bool) {
+	terminated, err := getJobTerminatedState(j.client, job)
+	if err != nil {
+		log.Error(err, "unable to lookup the pods of the job", "job", job.GetName())
+		return jobReport{}, false
+	}
+	if terminated == nil {
+		return jobReport{}, false
+	}
+	report := parseJobReport(terminated.Message)
+	if report.Commit == "" {
+		// older template processors don't report the commit, the one pushed to the webhook is applied
+		report.Commit = job.GetAnnotations()[commitAnnotation]
+	}
+	if report.CommitMessage == "" && len(report.ForceApplied) == 0 && len(report.Recreated) == 0 && len(report.Pruned) == 0 && report.Commit == "" && len(report.Inventory) == 0 && len(report.Namespaces) == 0 && report.ManagedResources == nil {
+		return report, false
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err = j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the job", "job", job.GetName())
+		return report, false
+	}
+	// differences found while applying a new commit are the changes of that commit, not a drift
+	if report.Commit == "" || report.Commit != instance.Status.LastAppliedCommit {
+		report.Drifted = nil
+	}
+	newDrift := isNewDrift(instance.Status.DriftedResources, report.Drifted)
+	instance.Status.LastAppliedCommitMessage = report.CommitMessage
+	instance.Status.ForceAppliedResources = report.ForceApplied
+	instance.Status.LastAppliedCommit = report.Commit
+	instance.Status.LastAppliedParameterCommit = report.ParameterCommit
+	instance.Status.LastAppliedInputsHash = ""
+	if specHash, ok := job.GetAnnotations()[inputsHashAnnotation]; ok {
+		instance.Status.LastAppliedInputsHash = inputsHash(specHash, report.Commit, report.ParameterCommit)
+	}
+	instance.Status.InputsHash = currentInputsHash(instance)
+	instance.Status.DriftedResources = report.Drifted
+	instance.Status.RecreatedResources = report.Recreated
+	instance.Status.Inventory = report.Inventory
+	if report.ManagedResources != nil {
+		instance.Status.ManagedResources = report.ManagedResources
+	}
+	instance.Status.TargetNamespaces = nil
+	for _, result := range report.Namespaces {
+		result.Job = job.GetName()
+		instance.Status.TargetNamespaces = append(instance.Status.TargetNamespaces, result)
+	}
+	instance.Status.TemplateSourceMirror = report.TemplateMirror
+	instance.Status.ParameterSourceMirror = report.ParameterMirror
+	instance.Status.FailedContextDirs = report.FailedContextDirs
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+	}
+	return report, newDrift
+}
+
+// describeAppliedCommit describes the commit applied by the job of report, e.g. applied commit 0123abc: Fix the
+// deployment, empty when neither its hash nor its message is known
+func describeAppliedCommit(report jobReport) string {
+	switch {
+	case report.Commit != "" && report.CommitMessage != "":
+		return fmt.Sprintf("applied commit %s: %s", report.Commit, report.CommitMessage)
+	case report.Commit != "":
+		return "applied commit " + report.Commit
+	case report.CommitMessage != "":
+		return "applied commit: " + report.CommitMessage
+	}
+	return ""
+}
+
+// describeMirrors names the mirrors the sources of the job of report were cloned from
+func describeMirrors(report jobReport) string {
+	mirrors := []string{}
+	if report.TemplateMirror != "" {
+		mirrors = append(mirrors, "the template source from "+report.TemplateMirror)
+	}
+	if report.ParameterMirror != "" && report.ParameterMirror != report.TemplateMirror {
+		mirrors = append(mirrors, "the parameter source from "+report.ParameterMirror)
+	}
+	return strings.Join(mirrors, " and ")
+}
+
+// recordSyncResult stores in the status of owner the result of job, which finished at now, and the time it spent in
+// the Progressing condition, also recorded in the lastSyncDuration metric, and adds the sync to its history. The
+// Synced condition follows the result, except for the dry runs, the Progressing condition becomes False. The result
+// of a sync awaiting its post-sync hook is left to the hook, it returns true then.
+func (j *jobCompletionEmitter) recordSyncResult(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, now time.Time) bool {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the job", "job", job.GetName())
+		return false
+	}
+	var duration time.Duration
+	if since := progressingSince(&instance.Status, job); !since.IsZero() {
+		duration = now.Sub(since)
+		lastSyncDuration.WithLabelValues(owner.GetNamespace(), owner.GetName()).Set(duration.Seconds())
+	}
+	awaitsHook := awaitsPostSyncHook(instance, job)
+	progressing := gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionProgressing,
+		Status:  corev1.ConditionFalse,
+		Reason:  "JobFinished",
+		Message: fmt.Sprintf("Job %s finished", job.GetName()),
+	}
+	switch {
+	case awaitsHook:
+		if duration > 0 {
+			instance.Status.LastSyncDuration = metav1.Duration{Duration: duration.Round(time.Second)}
+		}
+		progressing = gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionProgressing,
+			Status:  corev1.ConditionTrue,
+			Reason:  "PostSync",
+			Message: fmt.Sprintf("Job %s applied the resources, running the post-sync hook", job.GetName()),
+		}
+	// a dry run didn't sync anything, only its Progressing condition changes
+	case !isDryRunJob(job):
+		message := j.terminationMessage(job)
+		recordSync(&instance.Status, job, failurePhase(message), duration, now)
+		instance.Status.History = appendSyncHistory(instance.Status.History, gitopsv1alpha1.SyncRecord{
+			Job:      job.GetName(),
+			Time:     metav1.NewTime(now),
+			Result:   instance.Status.LastSyncResult,
+			Commit:   syncCommit(job, message),
+			Duration: instance.Status.LastSyncDuration,
+		}, syncHistoryLimit)
+	}
+	if !isDryRunJob(job) {
+		imageID, err := getJobImageID(j.client, job)
+		if err != nil {
+			log.Error(err, "unable to lookup the pods of the job", "job", job.GetName())
+		} else if imageID != "" {
+			instance.Status.LastSyncImageID = imageID
+		}
+	}
+	setCondition(&instance.Status, progressing)
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+	}
+	return awaitsHook
+}
+
+// progressingSince returns when the Progressing condition of status became True, or the launch of job when it isn't
+// True, e.g. when the job finished before its pods were seen active
+func progressingSince(status *gitopsv1alpha1.GitOpsConfigStatus, job *batchv1.Job) time.Time {
+	if progressing := getCondition(status, gitopsv1alpha1.ConditionProgressing); progressing != nil &&
+		progressing.Status == corev1.ConditionTrue && !progressing.LastTransitionTime.IsZero() {
+		return progressing.LastTransitionTime.Time
+	}
+	return job.CreationTimestamp.Time
+}
+
+// recordSync records in status the time, result and duration of the sync of the finished job, and sets the Synced
+// condition. The failures of the jobs that couldn't clone their sources, in the Clone phase, are told apart from the
+// others by the CloneFailed reason of the condition.
+func recordSync(status *gitopsv1alpha1.GitOpsConfigStatus, job *batchv1.Job, phase string, duration time.Duration, now time.Time) {
+	if duration > 0 {
+		status.LastSyncDuration = metav1.Duration{Duration: duration.Round(time.Second)}
+	}
+	syncTime := metav1.NewTime(now)
+	status.LastSyncTime = &syncTime
+	status.LastSyncJob = job.GetName()
+	if isJobSucceeded(job) {
+		status.LastSyncResult = "Success"
+		status.LastErrorMessage = ""
+		setCondition(status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionSynced,
+			Status:  corev1.ConditionTrue,
+			Reason:  "JobSuccessful",
+			Message: fmt.Sprintf("Job %s finished successfully", job.GetName()),
+		})
+	} else if phase == "Clone" {
+		status.LastSyncResult = "Failed"
+		setCondition(status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionSynced,
+			Status:  corev1.ConditionFalse,
+			Reason:  reasonCloneFailed,
+			Message: fmt.Sprintf("Job %s failed to clone the git sources", job.GetName()),
+		})
+	} else {
+		status.LastSyncResult = "Failed"
+		setCondition(status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionSynced,
+			Status:  corev1.ConditionFalse,
+			Reason:  "JobFailed",
+			Message: fmt.Sprintf("Job %s failed", job.GetName()),
+		})
+	}
+}
+
+// terminationMessage returns the termination message of the last terminated pod of job, empty when it is unknown
+func (j *jobCompletionEmitter) terminationMessage(job *batchv1.Job) string {
+	terminated, err := getJobTerminatedState(j.client, job)
+	if err != nil {
+		log.Error(err, "unable to lookup the pods of the job", "job", job.GetName())
+		return ""
+	}
+	if terminated == nil {
+		return ""
+	}
+	return terminated.Message
+}
+
+// recordSyncStarted sets the Progressing condition of owner, whose job just became active
+func (j *jobCompletionEmitter) recordSyncStarted(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the job", "job", job.GetName())
+		return
+	}
+	changed := setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionProgressing,
+		Status:  corev1.ConditionTrue,
+		Reason:  "JobStarted",
+		Message: fmt.Sprintf("Job %s is running", job.GetName()),
+	})
+	if !changed {
+		return
+	}
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+	}
+}
+
+// truncateCommitMessage returns the first line of message, truncated to maxCommitMessageLength characters
+func truncateCommitMessage(message string) string {
+	message = strings.TrimSpace(strings.SplitN(strings.TrimSpace(message), "\n", 2)[0])
+	runes := []rune(message)
+	if len(runes) <= maxCommitMessageLength {
+		return message
+	}
+	return string(runes[:maxCommitMessageLength-3]) + "..."
+}
+
+// summarizeResources returns the total count of resources followed by the
+// first maxSummaryResources of them. resources may be a truncated list of the total.
+func summarizeResources(resources []string, total int) string {
+	if total < len(resources) {
+		total = len(resources)
+	}
+	if len(resources) > maxSummaryResources {
+		resources = resources[:maxSummaryResources]
+	}
+	if total == len(resources) {
+		return fmt.Sprintf("%d resources: %s", total, strings.Join(resources, ", "))
+	}
+	return fmt.Sprintf("%d resources: %s and %d more", total, strings.Join(resources, ", "), total-len(resources))
+}
+
+// recordPruned reports the resources deleted by job, one event per resource,
+// or a single summary event when there are more than maxSummaryResources.
+func (j *jobCompletionEmitter) recordPruned(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, report jobReport) {
+	count := report.PrunedCount
+	if count < len(report.Pruned) {
+		count = len(report.Pruned)
+	}
+	resourcesPruned.WithLabelValues(owner.GetNamespace(), owner.GetName()).Add(float64(count))
+	if count > maxSummaryResources {
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Warning", "ResourcePruned", "Job %s deleted %s", job.Name, summarizeResources(report.Pruned, count))
+		return
+	}
+	for _, resource := range report.Pruned {
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Warning", "ResourcePruned", "Job %s deleted %s", job.Name, resource)
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// jobSlotTimeout is how long a slot granted to a run is kept for its job to be seen by the watch, and how long a
+// queued run is kept without its GitOpsConfig checking for a slot again, e.g. once it was deleted
+const jobSlotTimeout = 2 * activeJobPollInterval
+
+// jobSlotEvents reconciles the GitOpsConfigs whose runs were queued by the job limit once slots are freed
+var jobSlotEvents = make(chan event.GenericEvent)
+
+// jobLimit caps the active jobs of all the GitOpsConfigs, nil when there is no cap
+var jobLimit *jobSlots
+
+// SetMaxConcurrentJobs caps the active jobs of all the GitOpsConfigs to max: the runs
+// of the GitOpsConfigs finding max jobs active are queued, and started in order as
+// the jobs complete. Zero disables the cap.
+func SetMaxConcurrentJobs(max int) {
+	if max <= 0 {
+		jobLimit = nil
+		return
+	}
+	jobLimit = newJobSlots(max, clock.RealClock{}, func(config types.NamespacedName) {
+		// the job watch isn't held up by the reconciles
+		go func() {
+			jobSlotEvents <- event.GenericEvent{Meta: &gitopsv1alpha1.GitOpsConfig{ObjectMeta: metav1.ObjectMeta{Name: config.Name, Namespace: config.Namespace}}}
+		}()
+	})
+}
+
+// jobSlots tracks the active jobs of the GitOpsConfigs, as seen by the job watch,
+// and the runs waiting for one of them to complete
+type jobSlots struct {
+	max   int
+	clock clock.Clock
+	// wake reconciles a GitOpsConfig whose queued run may now start
+	wake func(config types.NamespacedName)
+
+	lock sync.Mutex
+	// active maps the active jobs to their GitOpsConfig
+	active map[types.NamespacedName]types.NamespacedName
+	// starting records when the runs not seen by the watch yet were granted a slot
+	starting map[types.NamespacedName]time.Time
+	// queued lists the GitOpsConfigs waiting for a slot, in the order they were queued
+	queued []types.NamespacedName
+	// checked records when each queued GitOpsConfig last checked for a slot
+	checked map[types.NamespacedName]time.Time
+}
+
+func newJobSlots(max int, clock clock.Clock, wake func(config types.NamespacedName)) *jobSlots {
+	return &jobSlots{
+		max:      max,
+		clock:    clock,
+		wake:     wake,
+		active:   map[types.NamespacedName]types.NamespacedName{},
+		starting: map[types.NamespacedName]time.Time{},
+		checked:  map[types.NamespacedName]time.Time{},
+	}
+}
+
+// acquire grants a slot to the run of config, if the runs queued before it leave one free. Otherwise the run is
+// queued, and acquire returns false, the number of active jobs, and whether the run was just queued.
+func (s *jobSlots) acquire(config types.NamespacedName) (bool, int, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.clock.Now()
+	s.expire(now)
+	if _, ok := s.starting[config]; ok {
+		return true, len(s.active), false
+	}
+	position := -1
+	for i, queued := range s.queued {
+		if queued == config {
+			position = i
+		}
+	}
+	queued := position < 0
+	if queued {
+		position = len(s.queued)
+		s.queued = append(s.queued, config)
+	}
+	s.checked[config] = now
+	if position >= s.free() {
+		return false, len(s.active), queued
+	}
+	s.queued = append(s.queued[:position], s.queued[position+1:]...)
+	delete(s.checked, config)
+	s.starting[config] = now
+	return true, len(s.active), false
+}
+
+// release gives back the slot granted to the run of config, when its job couldn't be created
+func (s *jobSlots) release(config types.NamespacedName) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.starting, config)
+	s.drain()
+}
+
+// observe records whether job, seen by the job watch, is active, waking the queued runs when it completes
+func (s *jobSlots) observe(job *batchv1.Job) {
+	config, ok := jobConfig(job)
+	if !ok {
+		return
+	}
+	key := types.NamespacedName{Name: job.GetName(), Namespace: job.GetNamespace()}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !isJobFinished(job) && job.GetDeletionTimestamp() == nil {
+		s.active[key] = config
+		delete(s.starting, config)
+		return
+	}
+	s.forget(key)
+}
+
+// observeDeleted frees the slot of the deleted job
+func (s *jobSlots) observeDeleted(job *batchv1.Job) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.forget(types.NamespacedName{Name: job.GetName(), Namespace: job.GetNamespace()})
+}
+
+// forget frees the slot of the job key, if it was active. The lock must be held.
+func (s *jobSlots) forget(key types.NamespacedName) {
+	if _, ok := s.active[key]; !ok {
+		return
+	}
+	delete(s.active, key)
+	s.drain()
+}
+
+// free returns the number of slots neither taken by an active job nor granted to a starting run. The lock must be
+// held.
+func (s *jobSlots) free() int {
+	return s.max - len(s.active) - len(s.starting)
+}
+
+// drain wakes the queued runs the free slots can start. The lock must be held.
+func (s *jobSlots) drain() {
+	s.expire(s.clock.Now())
+	for i := 0; i < s.free() && i < len(s.queued); i++ {
+		s.wake(s.queued[i])
+	}
+}
+
+// expire drops the slots granted to runs whose job wasn't seen in time, e.g. as its creation failed, and the queued
+// runs that stopped checking for a slot. The lock must be held.
+func (s *jobSlots) expire(now time.Time) {
+	for config, granted := range s.starting {
+		if now.Sub(granted) > jobSlotTimeout {
+			delete(s.starting, config)
+		}
+	}
+	queued := s.queued[:0]
+	for _, config := range s.queued {
+		if now.Sub(s.checked[config]) > jobSlotTimeout {
+			delete(s.checked, config)
+			continue
+		}
+		queued = append(queued, config)
+	}
+	s.queued = queued
+}
+
+// jobConfig returns the GitOpsConfig job was started for, directly or by its CronJob, false if job isn't a job of a
+// GitOpsConfig
+func jobConfig(job *batchv1.Job) (types.NamespacedName, bool) {
+	if owner, ok := annotatedOwnerName(job); ok {
+		return owner, true
+	}
+	ref := metav1.GetControllerOf(job)
+	if ref == nil {
+		return types.NamespacedName{}, false
+	}
+	switch {
+	case ref.Kind == "GitOpsConfig":
+		return types.NamespacedName{Name: ref.Name, Namespace: job.GetNamespace()}, true
+	case ref.Kind == "CronJob" && strings.HasPrefix(ref.Name, "gitopsconfig-"):
+		return types.NamespacedName{Name: strings.TrimPrefix(ref.Name, "gitopsconfig-"), Namespace: job.GetNamespace()}, true
+	}
+	return types.NamespacedName{}, false
+}
+
+// waitForJobSlot returns how long the next run of instance must wait for the job limit to let it start, recording a
+// JobLimitReached event when the run is queued
+func (r *ReconcileGitOpsConfig) waitForJobSlot(instance *gitopsv1alpha1.GitOpsConfig) time.Duration {
+	if jobLimit == nil {
+		return 0
+	}
+	granted, active, queued := jobLimit.acquire(types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()})
+	if granted {
+		return 0
+	}
+	if queued {
+		r.recorder.Eventf(instance, "Normal", "JobLimitReached", "Run queued until one of the %d active jobs completes, the most the operator runs at once", active)
+	}
+	// the run is started once a job completes, the poll only keeps its place in the queue
+	return activeJobPollInterval
+}
+
+// releaseJobSlot gives back the slot granted to the run of instance, when its job couldn't be created
+func releaseJobSlot(instance *gitopsv1alpha1.GitOpsConfig) {
+	if jobLimit != nil {
+		jobLimit.release(types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()})
+	}
+}
+
+// observeJobSlot records the job seen by the job watch in the job limit
+func observeJobSlot(job *batchv1.Job) {
+	if jobLimit != nil {
+		jobLimit.observe(job)
+	}
+}
+
+// forgetJobSlot frees the slot of the job deleted from the job watch
+func forgetJobSlot(job *batchv1.Job) {
+	if jobLimit != nil {
+		jobLimit.observeDeleted(job)
+	}
+}
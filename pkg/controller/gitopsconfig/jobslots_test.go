@@ -0,0 +1,177 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// configJob returns a job of the GitOpsConfig config with status
+func configJob(config string, status batchv1.JobStatus) *batchv1.Job {
+	job := newOwnedJob(status)
+	job.Name = "gitopsconfig-" + config + "-abcde"
+	job.OwnerReferences[0].Name = config
+	return job
+}
+
+// newTestJobSlots returns job slots on a fake clock, recording the GitOpsConfigs woken up
+func newTestJobSlots(max int) (*jobSlots, *clock.FakeClock, *[]string) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	woken := []string{}
+	slots := newJobSlots(max, fakeClock, func(config types.NamespacedName) {
+		woken = append(woken, config.Name)
+	})
+	return slots, fakeClock, &woken
+}
+
+func acquired(slots *jobSlots, config string) bool {
+	granted, _, _ := slots.acquire(types.NamespacedName{Name: config, Namespace: namespace})
+	return granted
+}
+
+func TestJobSlotsQueue(t *testing.T) {
+	slots, _, woken := newTestJobSlots(2)
+
+	assert.True(t, acquired(slots, "a"))
+	assert.True(t, acquired(slots, "b"))
+	// a slot granted is kept while the job of the run is created
+	assert.True(t, acquired(slots, "b"))
+	granted, active, queued := slots.acquire(types.NamespacedName{Name: "c", Namespace: namespace})
+	assert.False(t, granted)
+	assert.Equal(t, 0, active)
+	assert.True(t, queued)
+	granted, _, queued = slots.acquire(types.NamespacedName{Name: "c", Namespace: namespace})
+	assert.False(t, granted)
+	assert.False(t, queued, "the run is only queued once")
+	assert.False(t, acquired(slots, "d"))
+
+	// the jobs seen by the watch take the slots of their runs
+	slots.observe(configJob("a", batchv1.JobStatus{Active: 1}))
+	slots.observe(configJob("b", batchv1.JobStatus{}))
+	granted, active, _ = slots.acquire(types.NamespacedName{Name: "c", Namespace: namespace})
+	assert.False(t, granted)
+	assert.Equal(t, 2, active)
+	assert.Empty(t, *woken)
+
+	// a completed job wakes the first run queued, the ones queued after it keep waiting
+	slots.observe(configJob("a", batchv1.JobStatus{Succeeded: 1}))
+	assert.Equal(t, []string{"c"}, *woken)
+	assert.False(t, acquired(slots, "d"))
+	assert.True(t, acquired(slots, "c"))
+	slots.observe(configJob("c", batchv1.JobStatus{Active: 1}))
+
+	// a deleted job frees its slot too
+	slots.observeDeleted(configJob("b", batchv1.JobStatus{Active: 1}))
+	assert.Equal(t, []string{"c", "d"}, *woken)
+	assert.True(t, acquired(slots, "d"))
+
+	// the jobs that aren't run for a GitOpsConfig aren't counted
+	other := configJob("e", batchv1.JobStatus{Active: 1})
+	other.OwnerReferences = nil
+	slots.observe(other)
+	assert.Len(t, slots.active, 1)
+}
+
+func TestJobSlotsRelease(t *testing.T) {
+	slots, _, woken := newTestJobSlots(1)
+
+	assert.True(t, acquired(slots, "a"))
+	assert.False(t, acquired(slots, "b"))
+	// the slot of a run whose job couldn't be created goes to the next one
+	slots.release(types.NamespacedName{Name: "a", Namespace: namespace})
+	assert.Equal(t, []string{"b"}, *woken)
+	assert.True(t, acquired(slots, "b"))
+}
+
+func TestJobSlotsExpire(t *testing.T) {
+	slots, fakeClock, _ := newTestJobSlots(1)
+
+	assert.True(t, acquired(slots, "a"))
+	assert.False(t, acquired(slots, "b"))
+	assert.False(t, acquired(slots, "c"))
+
+	// the run queued first keeps its place while it checks for a slot
+	fakeClock.Step(jobSlotTimeout)
+	assert.False(t, acquired(slots, "b"))
+
+	// the slot of a run whose job is never seen is freed, the queued runs that stopped checking are dropped
+	fakeClock.Step(time.Second)
+	assert.True(t, acquired(slots, "b"))
+	assert.Empty(t, slots.queued)
+	assert.False(t, acquired(slots, "c"))
+}
+
+func TestMaxConcurrentJobs(t *testing.T) {
+	defer SetMaxConcurrentJobs(0)
+	SetMaxConcurrentJobs(1)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}
+	countJobs := func() int {
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		return len(jobs.Items)
+	}
+
+	// the job of another GitOpsConfig takes the only slot, even before its pod starts
+	running := configJob("other", batchv1.JobStatus{})
+	emitter.OnAdd(running)
+	for i := 0; i < 2; i++ {
+		result, err := r.Reconcile(req)
+		assert.NoError(t, err)
+		assert.Equal(t, reconcile.Result{RequeueAfter: activeJobPollInterval}, result)
+	}
+	assert.Equal(t, 0, countJobs())
+	assert.Equal(t, []string{"Normal JobLimitReached Run queued until one of the 1 active jobs completes, the most the operator runs at once"}, drainEvents(recorder))
+
+	// its completion reconciles the queued GitOpsConfig, whose run starts
+	finished := running.DeepCopy()
+	finished.Status = batchv1.JobStatus{Succeeded: 1, CompletionTime: &metav1.Time{Time: time.Now()}}
+	emitter.OnUpdate(running, finished)
+	select {
+	case woken := <-jobSlotEvents:
+		assert.Equal(t, name, woken.Meta.GetName())
+		assert.Equal(t, namespace, woken.Meta.GetNamespace())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queued GitOpsConfig wasn't reconciled")
+	}
+	result, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, result)
+	assert.Equal(t, 1, countJobs())
+}
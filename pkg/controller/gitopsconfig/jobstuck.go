@@ -0,0 +1,195 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// jobStuckCheckInterval is how often the pods of the active jobs are checked for being stuck
+const jobStuckCheckInterval = time.Minute
+
+// reasonJobStuck is the reason of the JobStuck events and of the Degraded condition of the GitOpsConfigs whose job
+// has a pod pending for longer than jobStuckTimeout, alerts rely on it
+const reasonJobStuck = "JobStuck"
+
+// jobStuckTimeout is how long the pod of an active job may be pending before the job is reported stuck, zero
+// disables the reports
+var jobStuckTimeout = 10 * time.Minute
+
+// SetJobStuckTimeout configures how long the pod of a job may be pending, e.g. unschedulable or pulling its image,
+// before the job is reported stuck. Zero disables the reports.
+func SetJobStuckTimeout(timeout time.Duration) {
+	jobStuckTimeout = timeout
+}
+
+// stuckJobPod returns the pod of job pending for longer than jobStuckTimeout at now, and why it is pending, nil if
+// none is
+func stuckJobPod(kubeclient client.Client, job *batchv1.Job, now time.Time) (*corev1.Pod, string, error) {
+	if jobStuckTimeout <= 0 || job.Status.Active == 0 || isJobFinished(job) {
+		return nil, "", nil
+	}
+	podList := &corev1.PodList{}
+	selector := labels.SelectorFromSet(labels.Set{"job-name": job.GetName()})
+	err := kubeclient.List(context.TODO(), &client.ListOptions{
+		Namespace:     job.GetNamespace(),
+		LabelSelector: selector,
+	}, podList)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.GetLabels()["job-name"] != job.GetName() || pod.Status.Phase != corev1.PodPending || pod.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if now.Sub(pod.CreationTimestamp.Time) > jobStuckTimeout {
+			return pod, pendingReason(pod), nil
+		}
+	}
+	return nil, "", nil
+}
+
+// pendingReason returns why pod is pending: the reason the scheduler gave for not scheduling it, e.g.
+// Unschedulable, or the reason its containers are waiting for, e.g. ImagePullBackOff
+func pendingReason(pod *corev1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			return strings.TrimSuffix(condition.Reason+": "+condition.Message, ": ")
+		}
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "" {
+			return strings.TrimSuffix(waiting.Reason+": "+waiting.Message, ": ")
+		}
+	}
+	return "Pending"
+}
+
+// recordJobStuck sets the Degraded condition of instance, whose job has pod stuck pending for reason, reporting it
+// once per job with a JobStuck event
+func recordJobStuck(kubeclient client.Client, recorder record.EventRecorder, instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, pod *corev1.Pod, reason string) error {
+	prefix := fmt.Sprintf("Pod %s of job %s ", pod.GetName(), job.GetName())
+	previous := getCondition(&instance.Status, gitopsv1alpha1.ConditionDegraded)
+	reported := previous != nil && previous.Status == corev1.ConditionTrue && previous.Reason == reasonJobStuck &&
+		strings.HasPrefix(previous.Message, prefix)
+	changed := setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionDegraded,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonJobStuck,
+		Message: fmt.Sprintf("%spending for more than %s: %s", prefix, jobStuckTimeout, reason),
+	})
+	if !changed {
+		return nil
+	}
+	if err := kubeclient.Status().Update(context.TODO(), instance); err != nil {
+		log.Error(err, "unable to record the stuck job", "instance", instance.GetName(), "job", job.GetName())
+		return err
+	}
+	if !reported {
+		recorder.Eventf(instance, "Warning", reasonJobStuck, "Job %s stuck, its pod %s is pending for more than %s: %s", job.GetName(), pod.GetName(), jobStuckTimeout, reason)
+	}
+	return nil
+}
+
+// clearJobStuck resets the Degraded condition of instance set by recordJobStuck, none of its jobs being stuck anymore
+func clearJobStuck(kubeclient client.Client, instance *gitopsv1alpha1.GitOpsConfig) error {
+	previous := getCondition(&instance.Status, gitopsv1alpha1.ConditionDegraded)
+	if previous == nil || previous.Status != corev1.ConditionTrue || previous.Reason != reasonJobStuck {
+		return nil
+	}
+	setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionDegraded,
+		Status:  corev1.ConditionFalse,
+		Reason:  "JobNotStuck",
+		Message: fmt.Sprintf("No pod of the jobs is pending for more than %s", jobStuckTimeout),
+	})
+	return kubeclient.Status().Update(context.TODO(), instance)
+}
+
+// stuckJobChecker periodically looks for the active jobs of the GitOpsConfigs whose pod is pending for longer than
+// jobStuckTimeout. Such a job neither succeeds nor fails, e.g. when no node tolerates the pod, and would block the
+// runs queued behind it without any report.
+type stuckJobChecker struct {
+	client   client.Client
+	recorder record.EventRecorder
+}
+
+var _ manager.Runnable = &stuckJobChecker{}
+
+// Start checks the active jobs every jobStuckCheckInterval, until stopCh is closed
+func (c *stuckJobChecker) Start(stopCh <-chan struct{}) error {
+	ticker := time.NewTicker(jobStuckCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case <-ticker.C:
+			if err := c.check(time.Now()); err != nil {
+				log.Error(err, "unable to list the GitOpsConfigs to check their jobs")
+			}
+		}
+	}
+}
+
+// check reports the GitOpsConfigs with a stuck job at now, and the ones whose jobs aren't stuck anymore
+func (c *stuckJobChecker) check(now time.Time) error {
+	instances := &gitopsv1alpha1.GitOpsConfigList{}
+	err := c.client.List(context.TODO(), &client.ListOptions{}, instances)
+	if err != nil {
+		return err
+	}
+	for i := range instances.Items {
+		instance := &instances.Items[i]
+		if err := c.checkInstance(instance, now); err != nil {
+			log.Error(err, "unable to check the jobs of the GitOpsConfig", "instance", instance.GetName())
+		}
+	}
+	return nil
+}
+
+// checkInstance reports the first stuck job of instance at now, or clears the report if none is stuck
+func (c *stuckJobChecker) checkInstance(instance *gitopsv1alpha1.GitOpsConfig, now time.Time) error {
+	active, err := listActiveJobs(c.client, instance)
+	if err != nil {
+		return err
+	}
+	for i := range active {
+		job := &active[i]
+		pod, reason, err := stuckJobPod(c.client, job, now)
+		if err != nil {
+			return err
+		}
+		if pod != nil {
+			return recordJobStuck(c.client, c.recorder, instance, job, pod, reason)
+		}
+	}
+	return clearJobStuck(c.client, instance)
+}
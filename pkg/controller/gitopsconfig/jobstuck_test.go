@@ -0,0 +1,147 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newUnschedulablePod returns a pod of the job of newOwnedJob created at created, that no node can run
+func newUnschedulablePod(created time.Time) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "gitopsconfig-gitops-operator-abcde-x7k2p",
+			Namespace:         namespace,
+			Labels:            map[string]string{"job-name": "gitopsconfig-gitops-operator-abcde"},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{{
+				Type:    corev1.PodScheduled,
+				Status:  corev1.ConditionFalse,
+				Reason:  corev1.PodReasonUnschedulable,
+				Message: "0/3 nodes are available: 3 node(s) had taints that the pod didn't tolerate.",
+			}},
+		},
+	}
+}
+
+func TestPendingReason(t *testing.T) {
+	pod := newUnschedulablePod(time.Now())
+	assert.Equal(t, "Unschedulable: 0/3 nodes are available: 3 node(s) had taints that the pod didn't tolerate.", pendingReason(pod))
+	pod.Status.Conditions = nil
+	assert.Equal(t, "Pending", pendingReason(pod))
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "template-processor",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+	}}
+	assert.Equal(t, "ImagePullBackOff", pendingReason(pod))
+}
+
+func TestStuckJobChecker(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	now := time.Now()
+	job := newOwnedJob(batchv1.JobStatus{Active: 1})
+	pod := newUnschedulablePod(now.Add(-5 * time.Minute))
+	cl := fake.NewFakeClient(gitops.DeepCopy(), job, pod)
+	recorder := record.NewFakeRecorder(10)
+	checker := &stuckJobChecker{client: cl, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	degraded := func() *gitopsv1alpha1.GitOpsConfigCondition {
+		instance := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+		return getCondition(&instance.Status, gitopsv1alpha1.ConditionDegraded)
+	}
+
+	// pending for less than the timeout
+	assert.NoError(t, checker.check(now))
+	assert.Nil(t, degraded())
+	assert.Empty(t, drainEvents(recorder))
+
+	assert.NoError(t, checker.check(now.Add(6*time.Minute)))
+	if condition := degraded(); assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, reasonJobStuck, condition.Reason)
+		assert.Contains(t, condition.Message, "Pod gitopsconfig-gitops-operator-abcde-x7k2p of job gitopsconfig-gitops-operator-abcde pending for more than 10m0s: Unschedulable")
+	}
+	assert.Equal(t, []string{"Warning JobStuck Job gitopsconfig-gitops-operator-abcde stuck, its pod gitopsconfig-gitops-operator-abcde-x7k2p is pending for more than 10m0s: " +
+		"Unschedulable: 0/3 nodes are available: 3 node(s) had taints that the pod didn't tolerate."}, drainEvents(recorder))
+
+	// the stuck job is reported once, even when the scheduler explains it differently
+	pod.Status.Conditions[0].Message = "0/4 nodes are available: 4 node(s) had taints that the pod didn't tolerate."
+	assert.NoError(t, cl.Update(context.TODO(), pod))
+	assert.NoError(t, checker.check(now.Add(7*time.Minute)))
+	assert.Contains(t, degraded().Message, "0/4 nodes")
+	assert.Empty(t, drainEvents(recorder))
+
+	// the pod got scheduled
+	pod.Status = corev1.PodStatus{Phase: corev1.PodRunning}
+	assert.NoError(t, cl.Update(context.TODO(), pod))
+	assert.NoError(t, checker.check(now.Add(8*time.Minute)))
+	if condition := degraded(); assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, "JobNotStuck", condition.Reason)
+	}
+
+	// disabled
+	defer SetJobStuckTimeout(jobStuckTimeout)
+	SetJobStuckTimeout(0)
+	pod.Status = newUnschedulablePod(now).Status
+	assert.NoError(t, cl.Update(context.TODO(), pod))
+	assert.NoError(t, checker.check(now.Add(time.Hour)))
+	assert.Equal(t, corev1.ConditionFalse, degraded().Status)
+	assert.Empty(t, drainEvents(recorder))
+}
+
+func TestQueuedBehindStuckJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook"}}
+	instance.Spec.ConcurrencyPolicy = "Forbid"
+	cl := fake.NewFakeClient(instance, newOwnedJob(batchv1.JobStatus{Active: 1}), newUnschedulablePod(time.Now().Add(-time.Hour)))
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Equal(t, activeJobPollInterval, result.RequeueAfter, "the run stays queued behind the stuck job")
+	events := strings.Join(drainEvents(recorder), "\n")
+	assert.Contains(t, events, "Warning JobStuck Job gitopsconfig-gitops-operator-abcde stuck")
+	assert.NotContains(t, events, "RunQueued")
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.True(t, isConditionTrue(&updated.Status, gitopsv1alpha1.ConditionDegraded))
+}
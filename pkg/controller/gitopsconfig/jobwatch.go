@@ -0,0 +1,601 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/audit"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// jobWatchNamespaces are the namespaces whose Jobs are watched, all of them when empty
+var jobWatchNamespaces []string
+
+// SetJobWatchNamespaces restricts the watch on Jobs to namespaces, so that the
+// operator only needs access to the Jobs of these namespaces. All the
+// namespaces are watched when it is empty.
+func SetJobWatchNamespaces(namespaces []string) {
+	jobWatchNamespaces = namespaces
+}
+
+// watchedJobNamespaces returns the namespaces whose Jobs are watched,
+// corev1.NamespaceAll when they all are
+func watchedJobNamespaces() []string {
+	if len(jobWatchNamespaces) == 0 {
+		return []string{corev1.NamespaceAll}
+	}
+	return jobWatchNamespaces
+}
+
+// addJobWatch configures a new watch, monitoring the Jobs of the watched
+// namespaces and passing their changes to handler. It returns a function
+// stopping the watch. The watchdog, which needs the store of the watched Jobs
+// and their sync state, starts the informers with startJobInformers instead.
+func addJobWatch(kubecfg *rest.Config, handler cache.ResourceEventHandler) (func(), error) {
+	clientset, err := kubernetes.NewForConfig(kubecfg)
+	if err != nil {
+		return nil, err
+	}
+	_, _, stop := startJobInformers(clientset, watchedJobNamespaces(), handler)
+	return stop, nil
+}
+
+// startJobInformers starts a shared informer on the Jobs of each namespace,
+// passing their changes to handler. Each informer holds a single LIST/WATCH
+// whatever the number of handlers added to it. It returns the store of the
+// Jobs of all the namespaces, a function telling whether all the informers
+// completed their initial sync, and a function stopping the informers.
+//
+// The informer of the manager cache, through which the client of the
+// controller reads the Jobs, can't be used instead, at the cost of a second
+// watch on the Jobs: the informers of the cache run until the manager stops,
+// so the watchdog couldn't restart a stalled watch, and the cache is bound to
+// the WATCH_NAMESPACE, while the Jobs are watched in the namespaces of
+// SetJobWatchNamespaces, which the operator may be restricted to.
+func startJobInformers(clientset kubernetes.Interface, namespaces []string, handler cache.ResourceEventHandler) (cache.Store, cache.InformerSynced, func()) {
+	stopChan := make(chan struct{})
+	var store cache.Store
+	if len(namespaces) > 1 {
+		// the informers of the namespaces keep the combined store up to date
+		store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	}
+	synced := []cache.InformerSynced{}
+	for _, namespace := range namespaces {
+		// no resync: the handler only acts on changes, and the watchdog restarts a stalled watch
+		factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
+		informer := factory.Batch().V1().Jobs().Informer()
+		informer.AddEventHandler(handler)
+		if store == nil {
+			store = informer.GetStore()
+		} else {
+			informer.AddEventHandler(storeUpdater{store})
+		}
+		synced = append(synced, informer.HasSynced)
+		factory.Start(stopChan)
+	}
+	hasSynced := func() bool {
+		for _, informerSynced := range synced {
+			if !informerSynced() {
+				return false
+			}
+		}
+		return true
+	}
+	return store, hasSynced, func() { close(stopChan) }
+}
+
+// storeUpdater applies the changes of the objects to store
+type storeUpdater struct {
+	store cache.Store
+}
+
+func (u storeUpdater) OnAdd(obj interface{}) {
+	u.store.Add(obj)
+}
+
+func (u storeUpdater) OnUpdate(oldObj, newObj interface{}) {
+	u.store.Update(newObj)
+}
+
+func (u storeUpdater) OnDelete(obj interface{}) {
+	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = deleted.Obj
+	}
+	u.store.Delete(obj)
+}
+
+// jobCompletionEmitter records events on the GitOpsConfig owning a Job when
+// the Job completes, and relaunches failed Jobs when their failure is transient.
+type jobCompletionEmitter struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	audit    audit.Sink
+	reported reportedJobs
+	// secretReader reads the notification secrets and the attestation ConfigMaps from the API server, the client is used if nil
+	secretReader client.Reader
+	// clientset reads the logs of the failed pods, they aren't reported if nil
+	clientset kubernetes.Interface
+	// ownerReader reads the intermediate controllers of the jobs from the API server, the client is used if nil
+	ownerReader client.Reader
+}
+
+var _ cache.ResourceEventHandler = &jobCompletionEmitter{}
+
+// OnAdd emits an event on the GitOpsConfig owning the job, if the job is
+// already active when it is first seen. The jobs started before the operator
+// are listed when it starts watching them, they were reported by its predecessor.
+func (j *jobCompletionEmitter) OnAdd(obj interface{}) {
+	job, _ := obj.(*batchv1.Job)
+	if job == nil {
+		return
+	}
+	observeJobSlot(job)
+	if !isJobStarted(nil, job) {
+		return
+	}
+	if job.Status.StartTime != nil && job.Status.StartTime.Time.Before(operatorStart) {
+		return
+	}
+	j.onJobStarted(job)
+}
+
+// OnUpdate emits an event on the GitOpsConfig owning the job, if the job
+// became active, or if it transitioned to a finished state: either all its
+// completions succeeded, or it failed for good.
+func (j *jobCompletionEmitter) OnUpdate(oldObj, newObj interface{}) {
+	oldJob, ok := oldObj.(*batchv1.Job)
+	if !ok {
+		log.Error(nil, "old object is not a job", "oldObj", oldObj)
+		return
+	}
+	newJob, _ := newObj.(*batchv1.Job)
+	if newJob == nil {
+		return
+	}
+	observeJobSlot(newJob)
+	if isJobStarted(oldJob, newJob) {
+		j.onJobStarted(newJob)
+	}
+	// Is it a status change to a finished state?
+	if !isJobFinished(newJob) || isJobFinished(oldJob) {
+		return
+	}
+	if isFailedByDeletion(newJob) {
+		log.Info("Not reporting job failed by its deletion", "job", newJob.Name)
+		return
+	}
+	if isCompletionReported(newJob) {
+		log.Info("Not reporting job whose completion was already reported", "job", newJob.Name)
+		return
+	}
+
+	// Find the GitOpsConfig owning the job
+	owner, err := findJobOwner(newJob, j.client, j.controllerReader())
+	if err != nil {
+		log.Error(err, "cannot find owner of job", "job", newJob.Name)
+		return
+	}
+	if owner == nil {
+		// Not a job started by eunomia
+		return
+	}
+	gitops := owner
+	if !j.reported.claim(newJob.GetUID()) {
+		log.Info("Not reporting job whose completion is already being reported", "job", newJob.Name)
+		return
+	}
+	if isStaleCompletion(newJob, time.Now()) {
+		// its events were recorded by the previous operator, its completion is still handled
+		log.Info("Not recording the events of job finished before the operator started", "job", newJob.Name)
+		j = j.withoutEvents()
+	}
+
+	if ref := metav1.GetControllerOf(newJob); ref != nil && ref.Kind == "CronJob" {
+		// the runs of the cronjob are only seen by the operator once their job finishes
+		RecordTrigger(gitops, jobTrigger(newJob), false)
+	}
+	if isPostSyncHookJob(newJob) {
+		j.onPostSyncHookFinished(gitops, newJob, time.Now())
+		j.markCompletionReported(newJob)
+		j.cleanupFinishedJobs(gitops, newJob)
+		return
+	}
+	awaitsHook := j.recordSyncResult(gitops, newJob, time.Now())
+
+	switch {
+	case isJobSucceeded(newJob) && util.IsReadOnly():
+		j.onReadOnlyJobSucceeded(gitops, newJob)
+	case isJobSucceeded(newJob) && isDryRunJob(newJob):
+		j.onDryRunJobSucceeded(gitops, newJob, time.Now())
+	case isJobSucceeded(newJob):
+		report, newDrift := j.recordJobReport(gitops, newJob)
+		if awaitsHook {
+			// the sync is only successful once its post-sync hook passes
+			j.startPostSyncHook(gitops, newJob, report)
+		} else {
+			message := "Job finished successfully: " + describeJob(newJob)
+			if applied := describeAppliedCommit(report); applied != "" {
+				message += ", " + applied
+			}
+			j.recorder.AnnotatedEventf(gitops,
+				map[string]string{"job": newJob.Name},
+				"Normal", "JobSuccessful", "%s", message)
+			publishSyncEvent(gitops, newJob.Name, "Normal", "JobSuccessful", message)
+		}
+		recordJobCompletion(gitops, newJob, "success")
+		j.recordApplyResults(gitops, newJob, report.Applied)
+		if report.TemplateMirror != "" || report.ParameterMirror != "" {
+			j.recorder.AnnotatedEventf(gitops,
+				map[string]string{"job": newJob.Name},
+				"Warning", "ClonedFromMirror", "Job %s couldn't reach the git host, it cloned %s", newJob.Name, describeMirrors(report))
+		}
+		if len(report.FailedContextDirs) > 0 {
+			j.recorder.AnnotatedEventf(gitops,
+				map[string]string{"job": newJob.Name},
+				"Warning", "ContextDirsFailed", "Job %s %s", newJob.Name, describeFailedContextDirs(report))
+		}
+		if len(report.ForceApplied) > 0 {
+			j.recorder.AnnotatedEventf(gitops,
+				map[string]string{"job": newJob.Name},
+				"Warning", "ForceApplied", "Job %s took ownership of conflicting resources: %s", newJob.Name, strings.Join(report.ForceApplied, ", "))
+		}
+		if len(report.Recreated) > 0 {
+			j.recorder.AnnotatedEventf(gitops,
+				map[string]string{"job": newJob.Name},
+				"Warning", "ResourceRecreated", "Job %s deleted and recreated resources changing immutable fields: %s", newJob.Name, strings.Join(report.Recreated, ", "))
+		}
+		if len(report.Pruned) > 0 {
+			j.recordPruned(gitops, newJob, report)
+		}
+		if len(report.PruneSkipped) > 0 {
+			j.recorder.AnnotatedEventf(gitops,
+				map[string]string{"job": newJob.Name},
+				"Normal", "PruneSkipped", "Job %s kept resources blocked by the prune lists: %s", newJob.Name, strings.Join(report.PruneSkipped, ", "))
+		}
+		if len(report.ResourcesSkipped) > 0 {
+			j.recorder.AnnotatedEventf(gitops,
+				map[string]string{"job": newJob.Name},
+				"Warning", "ResourceSkipped", "Job %s skipped resources of kinds the GitOpsConfig may not manage: %s", newJob.Name, strings.Join(report.ResourcesSkipped, ", "))
+		}
+		j.recordOwnershipConflicts(gitops, newJob, "Warning", report.OwnershipConflicts)
+		if newDrift {
+			j.recorder.AnnotatedEventf(gitops,
+				map[string]string{"job": newJob.Name},
+				"Warning", "DriftDetected", "Drift detected by job %s on %s", newJob.Name, summarizeResources(report.Drifted, len(report.Drifted)))
+		}
+		j.recordSuccessReason(gitops, newJob, report)
+		j.clearDegraded(gitops, newJob)
+		j.clearClusterUnavailable(gitops, newJob)
+		if !awaitsHook {
+			j.resetJobFailures(gitops, newJob)
+		}
+		j.recordAttestation(gitops, newJob, report)
+		j.recordAudit(gitops, newJob, "Succeeded", report)
+	case isJobFailed(newJob):
+		j.onJobFailed(gitops, newJob)
+	}
+	j.exportRunTrace(gitops, newJob, time.Now())
+	j.markCompletionReported(newJob)
+	j.cleanupFinishedJobs(gitops, newJob)
+}
+
+// isJobFinished returns true if job won't run any further pod
+func isJobFinished(job *batchv1.Job) bool {
+	return isJobSucceeded(job) || isJobFailed(job)
+}
+
+// isJobSucceeded returns true if at least as many pods of job succeeded as its desired completions, once none is active.
+// A job without completions succeeds with any positive count, which can exceed 1 after a race of its pods.
+func isJobSucceeded(job *batchv1.Job) bool {
+	if hasJobCondition(job, batchv1.JobComplete) {
+		return true
+	}
+	completions := int32(1)
+	if job.Spec.Completions != nil {
+		completions = *job.Spec.Completions
+	}
+	return job.Status.Active == 0 && job.Status.Succeeded >= completions
+}
+
+// isJobFailed returns true if job exhausted its backoffLimit, or exceeded its
+// deadline, before reaching its desired completions. An unset backoffLimit,
+// which the API server always defaults, is exhausted by the first failure.
+func isJobFailed(job *batchv1.Job) bool {
+	if hasJobCondition(job, batchv1.JobFailed) {
+		return true
+	}
+	if job.Status.Active > 0 || isJobSucceeded(job) {
+		return false
+	}
+	backoffLimit := int32(0)
+	if job.Spec.BackoffLimit != nil {
+		backoffLimit = *job.Spec.BackoffLimit
+	}
+	return job.Status.Failed > backoffLimit
+}
+
+// hasJobCondition returns true if job has the condition of the given type set to true
+func hasJobCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// jobFailedReason returns the reason of the JobFailed condition of job, e.g. DeadlineExceeded or
+// BackoffLimitExceeded, empty if it has none
+func jobFailedReason(job *batchv1.Job) string {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return condition.Reason
+		}
+	}
+	return ""
+}
+
+// onJobFailed reports, notifies and retries a failed job. Failures due to an unreachable
+// API server are told apart from the real ones when the GitOpsConfig asks so,
+// and failures during a maintenance window don't raise Warning events.
+func (j *jobCompletionEmitter) onJobFailed(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the failed job", "job", job.GetName())
+		instance = nil
+	}
+	eventType := "Warning"
+	if instance != nil && inMaintenanceWindow(instance, time.Now()) {
+		eventType = "Normal"
+	}
+	terminated, err := getJobTerminatedState(j.client, job)
+	if err != nil {
+		log.Error(err, "unable to lookup the pods of the failed job", "job", job.GetName())
+	}
+	if instance != nil && instance.Spec.RetryClusterUnavailable {
+		if terminated != nil && isClusterUnavailable(terminated.Message) {
+			j.recordAudit(owner, job, "ClusterUnavailable", jobReport{})
+			attempt := getJobAttempt(job)
+			if attempt >= maxClusterUnavailableRetries {
+				j.recordClusterUnavailable(owner, job, attempt, false, 0)
+				j.recorder.AnnotatedEventf(owner,
+					map[string]string{"job": job.Name},
+					eventType, "ClusterUnavailable", "Job %s could not reach the API server, giving up after %d attempts", job.Name, attempt+1)
+				return
+			}
+			delay := clusterUnavailableBackoff(attempt)
+			err = j.relaunchJob(instance, job, attempt+1, delay)
+			if err == nil {
+				j.recordClusterUnavailable(owner, job, attempt, true, delay)
+				j.recorder.AnnotatedEventf(owner,
+					map[string]string{"job": job.Name},
+					eventType, "ClusterUnavailable", "Job %s could not reach the API server, retrying in %s", job.Name, delay)
+				return
+			}
+			// reported as a failure
+			log.Error(err, "unable to retry the job that could not reach the API server", "job", job.GetName())
+		}
+	}
+	format := "Job failed: %s"
+	if jobFailedReason(job) == "DeadlineExceeded" {
+		format += ", active longer than its activeDeadlineSeconds"
+	}
+	message := fmt.Sprintf(format, describeJob(job))
+	logs := j.readFailedPodLogs(job)
+	if snippet := logSnippet(logs); snippet != "" {
+		message += ", last logs: " + snippet
+	}
+	j.recorder.AnnotatedEventf(owner,
+		map[string]string{"job": job.Name},
+		eventType, "JobFailed", "%s", message)
+	publishSyncEvent(owner, job.Name, eventType, "JobFailed", message)
+	j.recordLastError(owner, job, logs)
+	recordJobCompletion(owner, job, "failure")
+	terminationMessage := ""
+	if terminated != nil {
+		terminationMessage = terminated.Message
+		j.recordApplyResults(owner, job, failedApplyResults(terminated.Message))
+		j.recordFailureReason(owner, job, eventType, terminated.Message)
+		j.recordQuotaExceeded(owner, job, terminated.Message)
+		j.recordForbidden(owner, job, eventType, terminated.Message)
+		j.recordNamespaceResults(owner, job, eventType, terminated.Message)
+		j.recordOwnershipConflicts(owner, job, eventType, parseOwnershipConflicts(terminated.Message))
+	}
+	// the failures during a maintenance window aren't worth paging anyone
+	if eventType == "Warning" {
+		j.notifyFailure(owner, instance, job, terminationMessage)
+	}
+	j.recordAudit(owner, job, "Failed", jobReport{})
+	// a failure counts towards pausing the configuration once it is not retried anymore
+	if !j.retryFailedJob(owner, job) {
+		j.recordJobFailure(owner, job)
+	}
+}
+
+// isJobStarted returns true if the pods of newJob became active, oldJob is nil when newJob is first seen
+func isJobStarted(oldJob, newJob *batchv1.Job) bool {
+	if newJob.Status.Active == 0 || isJobFinished(newJob) {
+		return false
+	}
+	return oldJob == nil || oldJob.Status.Active == 0
+}
+
+// onJobStarted emits a JobStarted event on the GitOpsConfig owning job, so that a run stuck before its pods are
+// active, e.g. on a missing image or an unschedulable pod, can be told apart from a running one
+func (j *jobCompletionEmitter) onJobStarted(job *batchv1.Job) {
+	owner, err := findJobOwner(job, j.client, j.controllerReader())
+	if err != nil {
+		log.Error(err, "cannot find owner of job", "job", job.Name)
+		return
+	}
+	if owner == nil {
+		// Not a job started by eunomia
+		return
+	}
+	started := time.Now()
+	if job.Status.StartTime != nil {
+		started = job.Status.StartTime.Time
+	}
+	message := fmt.Sprintf("Job %s started at %s", describeJob(job), started.UTC().Format(time.RFC3339))
+	j.recorder.AnnotatedEventf(owner,
+		map[string]string{"job": job.Name},
+		"Normal", "JobStarted", "%s", message)
+	publishSyncEvent(owner, job.Name, "Normal", "JobStarted", message)
+	j.recordSyncStarted(owner, job)
+}
+
+// OnDelete makes sure a deleted job is still reported, if it was never seen completing. The jobs deleted once
+// their completion was reported, e.g. by their TTL, the ones that finished before the operator started, e.g. deleted
+// with the expired jobs, and the ones deleted while running, including the ones whose pods failed once their
+// deletion started, aren't reported, so that their deletion isn't taken for a failure.
+func (j *jobCompletionEmitter) OnDelete(obj interface{}) {
+	if deleted, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = deleted.Obj
+	}
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return
+	}
+	if isJobFinished(job) && !isCompletionReported(job) && !isFinishedBeforeStart(job) {
+		j.OnUpdate(&batchv1.Job{}, job)
+	}
+	j.reported.forget(job.GetUID())
+	forgetJobSlot(job)
+}
+
+// isFailedByDeletion returns true if job failed after its deletion started, e.g. when its pods are killed by a
+// foreground deletion while it runs, its failure isn't the one of the sync
+func isFailedByDeletion(job *batchv1.Job) bool {
+	if job.GetDeletionTimestamp() == nil || !isJobFailed(job) {
+		return false
+	}
+	finished, ok := jobFinishTime(job)
+	return !ok || !finished.Before(job.GetDeletionTimestamp().Time)
+}
+
+// isFinishedBeforeStart returns true if job finished before the operator started
+func isFinishedBeforeStart(job *batchv1.Job) bool {
+	finished, ok := jobFinishTime(job)
+	return ok && finished.Before(operatorStart)
+}
+
+// controllerReader returns the reader used to get the intermediate controllers of the jobs. They may be of any kind,
+// reading them with the cached client would start an informer, and require the RBAC to list and watch, for each kind.
+func (j *jobCompletionEmitter) controllerReader() client.Reader {
+	if j.ownerReader != nil {
+		return j.ownerReader
+	}
+	return j.client
+}
+
+// maxOwnerDepth caps the owner references followed from a job to the
+// GitOpsConfig owning it, so that a cycle of references can't be followed forever
+const maxOwnerDepth = 10
+
+// findJobOwner returns the GitOpsConfig owning the job, with only its type,
+// name, namespace and UID set. The controller references are followed up from
+// the job, through any intermediate controller, e.g. a CronJob, read with
+// controllerReader. It returns nil if the job is not owned by a GitOpsConfig.
+func findJobOwner(job *batchv1.Job, kubeclient client.Client, controllerReader client.Reader) (*gitopsv1alpha1.GitOpsConfig, error) {
+	var owned metav1.Object = job
+	for depth := 0; depth < maxOwnerDepth; depth++ {
+		// jobs and cronjobs created in the jobNamespace of a GitOpsConfig, owner references can't cross namespaces
+		if owner := getAnnotatedOwner(owned); owner != nil {
+			return verifyAnnotatedOwner(owner, owned, kubeclient)
+		}
+		// only the controller is followed, the other owners don't manage the object
+		ref := metav1.GetControllerOf(owned)
+		if ref == nil {
+			return nil, nil
+		}
+		if ref.Kind == "GitOpsConfig" {
+			namespace, err := findOwnerNamespace(ref, owned.GetNamespace(), kubeclient)
+			if err != nil {
+				return nil, err
+			}
+			return &gitopsv1alpha1.GitOpsConfig{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: ref.APIVersion,
+					Kind:       ref.Kind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ref.Name,
+					Namespace: namespace,
+					UID:       ref.UID,
+				},
+			}, nil
+		}
+		controller := &unstructured.Unstructured{}
+		controller.SetAPIVersion(ref.APIVersion)
+		controller.SetKind(ref.Kind)
+		err := controllerReader.Get(context.TODO(), types.NamespacedName{Name: ref.Name, Namespace: owned.GetNamespace()}, controller)
+		if err != nil {
+			return nil, err
+		}
+		owned = controller
+	}
+	log.Info("Not following the owner references of the job further", "job", job.GetName(), "depth", maxOwnerDepth)
+	return nil, nil
+}
+
+// findOwnerNamespace returns the namespace of the GitOpsConfig referenced by ref, from an object of namespace.
+// The operator only sets owner references in the namespace of the GitOpsConfig, but the objects created by
+// other tools may reference a GitOpsConfig of another namespace, which is then found by its UID.
+func findOwnerNamespace(ref *metav1.OwnerReference, namespace string, kubeclient client.Client) (string, error) {
+	owner := &gitopsv1alpha1.GitOpsConfig{}
+	err := kubeclient.Get(context.TODO(), types.NamespacedName{Name: ref.Name, Namespace: namespace}, owner)
+	switch {
+	case err == nil && (ref.UID == "" || owner.GetUID() == ref.UID):
+		return namespace, nil
+	case err != nil && !errors.IsNotFound(err):
+		return "", err
+	case ref.UID == "":
+		// without a UID the owner can't be told apart from the GitOpsConfigs of the same name
+		return namespace, nil
+	}
+	list := &gitopsv1alpha1.GitOpsConfigList{}
+	err = kubeclient.List(context.TODO(), &client.ListOptions{}, list)
+	if err != nil {
+		return "", err
+	}
+	for _, instance := range list.Items {
+		if instance.GetUID() == ref.UID {
+			return instance.GetNamespace(), nil
+		}
+	}
+	return namespace, nil
+}
@@ -0,0 +1,1117 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/audit"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestShouldRetryJob(t *testing.T) {
+	instance := &gitopsv1alpha1.GitOpsConfig{
+		Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			RetryableExitCodes: []int32{75, 111},
+		},
+	}
+	tests := []struct {
+		name     string
+		exitCode int32
+		attempt  int
+		want     bool
+	}{
+		{"retryable code", 75, 0, true},
+		{"other retryable code", 111, 2, true},
+		{"non retryable code", 1, 0, false},
+		{"retries exhausted", 75, maxJobRetries, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, shouldRetryJob(instance, tt.exitCode, tt.attempt))
+		})
+	}
+	assert.False(t, shouldRetryJob(&gitopsv1alpha1.GitOpsConfig{}, 75, 0))
+}
+
+func TestJobRetryBackoff(t *testing.T) {
+	assert.Equal(t, jobRetryBaseDelay, jobRetryBackoff(0))
+	assert.Equal(t, 2*jobRetryBaseDelay, jobRetryBackoff(1))
+	assert.Equal(t, jobRetryMaxDelay, jobRetryBackoff(100))
+}
+
+func TestRetriedJob(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Spec.RetryableExitCodes = []int32{75}
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.createJob("create", instance, 2, "", "", "")
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs.Items, 1) {
+		job := jobs.Items[0]
+		assert.Equal(t, 2, getJobAttempt(&job))
+		// retries are handled by the controller, not by kubernetes
+		assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+	}
+}
+
+func TestRetryRun(t *testing.T) {
+	now := metav1.Now()
+	tests := []struct {
+		name          string
+		update        func(instance *gitopsv1alpha1.GitOpsConfig)
+		action        string
+		annotations   map[string]string
+		wantAction    string
+		parameterFile string
+		ref           string
+		wantErr       bool
+	}{
+		{"create", func(instance *gitopsv1alpha1.GitOpsConfig) {}, "create", nil, "create", "", "", false},
+		{"delete of a deleted config", func(instance *gitopsv1alpha1.GitOpsConfig) {
+			instance.DeletionTimestamp = &now
+		}, "delete", nil, "delete", "", "", false},
+		{"forged delete", func(instance *gitopsv1alpha1.GitOpsConfig) {}, "delete", nil, "", "", "", true},
+		{"parameter file of the last run", func(instance *gitopsv1alpha1.GitOpsConfig) {
+			instance.Spec.ParameterSource.FileName = "values-{{ .Branch }}.yaml"
+			instance.Status.ParameterFile = "values-main.yaml"
+		}, "create", map[string]string{parameterFileAnnotation: "../../secrets.yaml"}, "create", "values-main.yaml", "", false},
+		{"parameter file of the spec", func(instance *gitopsv1alpha1.GitOpsConfig) {
+			instance.Spec.ParameterSource.FileName = "values.yaml"
+		}, "create", map[string]string{parameterFileAnnotation: "values-prod.yaml"}, "create", "values.yaml", "", false},
+		{"ref of a fixed ref", func(instance *gitopsv1alpha1.GitOpsConfig) {}, "create", map[string]string{refAnnotation: "attacker"}, "create", "", "", false},
+		{"ref matching the pattern", func(instance *gitopsv1alpha1.GitOpsConfig) {
+			instance.Spec.TemplateSource.Ref = "release/*"
+		}, "create", map[string]string{refAnnotation: "release/1.2"}, "create", "", "release/1.2", false},
+		{"ref not matching the pattern", func(instance *gitopsv1alpha1.GitOpsConfig) {
+			instance.Spec.TemplateSource.Ref = "release/*"
+		}, "create", map[string]string{refAnnotation: "attacker"}, "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			tt.update(instance)
+			job := newOwnedJob(batchv1.JobStatus{Failed: 1})
+			job.Labels["action"] = tt.action
+			job.Annotations = tt.annotations
+
+			action, parameterFile, ref, err := retryRun(instance, job)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAction, action)
+			assert.Equal(t, tt.parameterFile, parameterFile)
+			assert.Equal(t, tt.ref, ref)
+		})
+	}
+}
+
+func TestGetJobExitCode(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "gitopsconfig-gitops-operator-abcde",
+			Namespace: namespace,
+		},
+	}
+	newPod := func(name, jobName string, exitCode int32, finished time.Time) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{"job-name": jobName},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "template-processor",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{
+								ExitCode:   exitCode,
+								FinishedAt: metav1.NewTime(finished),
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	now := time.Now()
+	cl := fake.NewFakeClient(
+		newPod("first", job.Name, 1, now.Add(-time.Minute)),
+		newPod("latest", job.Name, 75, now),
+		newPod("unrelated", "other-job", 2, now.Add(time.Minute)),
+	)
+
+	exitCode, found, err := getJobExitCode(cl, job)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int32(75), exitCode)
+
+	_, found, err = getJobExitCode(fake.NewFakeClient(), job)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestJobCompletionEmitterEvents(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name  string
+		old   batchv1.JobStatus
+		new   batchv1.JobStatus
+		event string
+	}{
+		{"success", batchv1.JobStatus{Active: 1}, batchv1.JobStatus{Succeeded: 1}, "Normal JobSuccessful"},
+		{"failure", batchv1.JobStatus{Active: 1}, batchv1.JobStatus{Failed: 1}, "Warning JobFailed"},
+		{"started", batchv1.JobStatus{}, batchv1.JobStatus{Active: 1}, "Normal JobStarted"},
+		{"still running", batchv1.JobStatus{Active: 1}, batchv1.JobStatus{Active: 1}, ""},
+		{"still pending", batchv1.JobStatus{}, batchv1.JobStatus{}, ""},
+		{"already finished", batchv1.JobStatus{Succeeded: 1}, batchv1.JobStatus{Succeeded: 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   fake.NewFakeClient([]runtime.Object{gitops}...),
+				scheme:   s,
+				recorder: recorder,
+			}
+			emitter.OnUpdate(newOwnedJob(tt.old), newOwnedJob(tt.new))
+			select {
+			case event := <-recorder.Events:
+				assert.Contains(t, event, tt.event)
+				assert.NotEmpty(t, tt.event, "unexpected event %q", event)
+			default:
+				assert.Empty(t, tt.event, "expected an event")
+			}
+		})
+	}
+}
+
+func TestJobCompletionEmitterForgedOwner(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name      string
+		namespace string
+		uid       string
+		objects   []runtime.Object
+	}{
+		{"foreign namespace", "attacker", "0b1c2d3e", []runtime.Object{
+			newJobNamespace("gitops"),
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "attacker", Annotations: map[string]string{allowedSourceNamespacesAnnotation: "gitops"}}},
+		}},
+		{"other UID", jobNamespace, "9f8e7d6c", []runtime.Object{newJobNamespace("gitops")}},
+		{"namespace not allowing the config", jobNamespace, "0b1c2d3e", []runtime.Object{newJobNamespace("team-a")}},
+		{"missing namespace", jobNamespace, "0b1c2d3e", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newJobNamespaceConfig()
+			pod := newTerminatedPod(`{"commitMessage":"Forged","commit":"abc123"}`)
+			pod.Namespace = tt.namespace
+			cl := fake.NewFakeClient(append(tt.objects, instance, pod)...)
+			recorder := &objectRecorder{}
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			// a job claiming to be owned by the GitOpsConfig, created by anyone allowed to create jobs
+			job := func(status batchv1.JobStatus) *batchv1.Job {
+				job := newOwnedJob(status)
+				job.Namespace = tt.namespace
+				job.OwnerReferences = nil
+				job.Annotations = map[string]string{jobOwnerAnnotation: "gitops/gitops-operator", jobOwnerUIDAnnotation: tt.uid}
+				return job
+			}
+
+			owner, err := findJobOwner(job(batchv1.JobStatus{}), cl, cl)
+			assert.NoError(t, err)
+			assert.Nil(t, owner)
+			emitter.OnUpdate(job(batchv1.JobStatus{Active: 1}), job(batchv1.JobStatus{Succeeded: 1}))
+			emitter.OnUpdate(job(batchv1.JobStatus{Active: 1}), job(batchv1.JobStatus{Failed: 1}))
+			assert.Empty(t, recorder.events)
+			current := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, current))
+			assert.Equal(t, instance.Status, current.Status)
+		})
+	}
+}
+
+func TestJobCompletionEmitterStarted(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	started := metav1.NewTime(time.Date(2019, 10, 15, 9, 30, 0, 0, time.UTC))
+	recent := metav1.NewTime(time.Now())
+	tests := []struct {
+		name   string
+		status batchv1.JobStatus
+		event  string
+	}{
+		{"active", batchv1.JobStatus{Active: 1, StartTime: &recent}, "Normal JobStarted"},
+		{"pending", batchv1.JobStatus{StartTime: &recent}, ""},
+		{"finished", batchv1.JobStatus{Succeeded: 1, StartTime: &recent}, ""},
+		// reported by the previous operator
+		{"started before the operator", batchv1.JobStatus{Active: 1, StartTime: &started}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{client: fake.NewFakeClient(gitops.DeepCopy()), scheme: s, recorder: recorder}
+			emitter.OnAdd(newOwnedJob(tt.status))
+			events := drainEvents(recorder)
+			if tt.event == "" {
+				assert.Empty(t, events)
+			} else if assert.Len(t, events, 1) {
+				assert.True(t, strings.HasPrefix(events[0], tt.event), events[0])
+			}
+		})
+	}
+
+	// the start time of the job is reported
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: fake.NewFakeClient(gitops.DeepCopy()), scheme: s, recorder: recorder}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{}), newOwnedJob(batchv1.JobStatus{Active: 1, StartTime: &started}))
+	events := drainEvents(recorder)
+	if assert.Len(t, events, 1) {
+		assert.True(t, strings.HasPrefix(events[0], "Normal JobStarted"), events[0])
+		assert.Contains(t, events[0], "2019-10-15T09:30:00Z")
+	}
+
+	// the jobs not started by eunomia aren't reported
+	job := newOwnedJob(batchv1.JobStatus{Active: 1, StartTime: &recent})
+	job.OwnerReferences = nil
+	emitter.OnAdd(job)
+	assert.Empty(t, drainEvents(recorder))
+}
+
+func TestJobCompletionEmitterMultipleCompletions(t *testing.T) {
+	completions := int32(3)
+	backoffLimit := int32(2)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	newJob := func(status batchv1.JobStatus) *batchv1.Job {
+		job := newOwnedJob(status)
+		job.Spec = batchv1.JobSpec{Completions: &completions, BackoffLimit: &backoffLimit}
+		return job
+	}
+	failedCondition := []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+	deadlineCondition := []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded"}}
+	tests := []struct {
+		name  string
+		old   batchv1.JobStatus
+		new   batchv1.JobStatus
+		event string
+	}{
+		{"first completion", batchv1.JobStatus{Active: 3}, batchv1.JobStatus{Active: 2, Succeeded: 1}, ""},
+		{"last pod running", batchv1.JobStatus{Active: 1, Succeeded: 1}, batchv1.JobStatus{Succeeded: 2}, ""},
+		{"all completions", batchv1.JobStatus{Active: 1, Succeeded: 2}, batchv1.JobStatus{Succeeded: 3}, "Normal JobSuccessful"},
+		{"success after a failure", batchv1.JobStatus{Active: 1, Succeeded: 2, Failed: 1}, batchv1.JobStatus{Succeeded: 3, Failed: 1}, "Normal JobSuccessful"},
+		{"already succeeded", batchv1.JobStatus{Succeeded: 3}, batchv1.JobStatus{Succeeded: 3}, ""},
+		{"failure within backoffLimit", batchv1.JobStatus{Active: 1, Succeeded: 2}, batchv1.JobStatus{Succeeded: 2, Failed: 1}, ""},
+		{"backoffLimit exhausted", batchv1.JobStatus{Active: 1, Succeeded: 1, Failed: 2}, batchv1.JobStatus{Succeeded: 1, Failed: 3}, "Warning JobFailed"},
+		{"failed condition", batchv1.JobStatus{Active: 1, Succeeded: 1}, batchv1.JobStatus{Succeeded: 1, Failed: 1, Conditions: failedCondition}, "Warning JobFailed"},
+		{"deadline exceeded", batchv1.JobStatus{Active: 1, Succeeded: 1}, batchv1.JobStatus{Succeeded: 1, Failed: 1, Conditions: deadlineCondition}, "active longer than its activeDeadlineSeconds"},
+		{"already failed", batchv1.JobStatus{Succeeded: 1, Failed: 3}, batchv1.JobStatus{Succeeded: 1, Failed: 3, Conditions: failedCondition}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   fake.NewFakeClient(gitops.DeepCopy()),
+				scheme:   s,
+				recorder: recorder,
+			}
+			emitter.OnUpdate(newJob(tt.old), newJob(tt.new))
+			if tt.event == "" {
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			assert.Contains(t, <-recorder.Events, tt.event)
+		})
+	}
+}
+
+func TestJobCompletionEmitterSucceededCount(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	// a job without completions succeeds with any positive success count, e.g. two pods after a scheduler race
+	for _, succeeded := range []int32{1, 2} {
+		t.Run(fmt.Sprintf("succeeded %d", succeeded), func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{client: fake.NewFakeClient(gitops.DeepCopy()), scheme: s, recorder: recorder}
+			finished := newOwnedJob(batchv1.JobStatus{Succeeded: succeeded})
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), finished)
+			emitter.OnUpdate(finished, finished.DeepCopy())
+			successes := 0
+			for _, event := range drainEvents(recorder) {
+				if strings.HasPrefix(event, "Normal JobSuccessful") {
+					successes++
+				}
+				assert.False(t, strings.HasPrefix(event, "Warning JobFailed"), event)
+			}
+			assert.Equal(t, 1, successes)
+		})
+	}
+}
+
+type stubAuditSink struct {
+	records chan audit.Record
+	err     error
+}
+
+func (s *stubAuditSink) Write(record audit.Record) error {
+	s.records <- record
+	return s.err
+}
+
+func TestJobCompletionEmitterAudit(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	pod := newTerminatedPod(`{"commit":"0123abc","changed":true,"inventory":[{"namespace":"team-a","resources":["deployment/web","service/web"],"resourceCount":2}]}`)
+
+	sink := &stubAuditSink{records: make(chan audit.Record, 10)}
+	emitter := &jobCompletionEmitter{
+		client:   fake.NewFakeClient(gitops, pod),
+		scheme:   s,
+		recorder: record.NewFakeRecorder(10),
+		audit:    sink,
+	}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+	select {
+	case rec := <-sink.records:
+		assert.Equal(t, name, rec.Config)
+		assert.Equal(t, namespace, rec.Namespace)
+		assert.Equal(t, "create", rec.Action)
+		assert.Equal(t, "Succeeded", rec.Result)
+		assert.Equal(t, gitops.Spec.TemplateSource.Ref, rec.Ref)
+		assert.Equal(t, "0123abc", rec.Commit)
+		assert.Equal(t, []string{"team-a/deployment/web", "team-a/service/web"}, rec.Resources)
+		if assert.NotNil(t, rec.Changed) {
+			assert.True(t, *rec.Changed)
+		}
+		assert.Equal(t, gitops.Spec.ServiceAccountRef, rec.Actor)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no audit record emitted")
+	}
+}
+
+func TestJobCompletionEmitterAuditFailure(t *testing.T) {
+	defer func(delay time.Duration) { auditRetryDelay = delay }(auditRetryDelay)
+	auditRetryDelay = 0
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+
+	sink := &stubAuditSink{records: make(chan audit.Record, auditAttempts), err: errors.New("sink unavailable")}
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{
+		client:   fake.NewFakeClient(gitops),
+		scheme:   s,
+		recorder: recorder,
+		audit:    sink,
+	}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+	assert.Contains(t, <-recorder.Events, "JobSuccessful")
+	assert.Contains(t, <-recorder.Events, "Normal Applied")
+	select {
+	case event := <-recorder.Events:
+		assert.Contains(t, event, "Warning AuditFailed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit failure not surfaced")
+	}
+	assert.Len(t, sink.records, auditAttempts)
+}
+
+func TestTruncateCommitMessage(t *testing.T) {
+	long := strings.Repeat("a", maxCommitMessageLength+20)
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"subject only", "Fix the deployment\n", "Fix the deployment"},
+		{"subject and body", "Fix the deployment\n\nThe replicas were wrong", "Fix the deployment"},
+		{"exact length", long[:maxCommitMessageLength], long[:maxCommitMessageLength]},
+		{"too long", long, long[:maxCommitMessageLength-3] + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, truncateCommitMessage(tt.message))
+		})
+	}
+}
+
+func TestJobCompletionEmitterCommitMessage(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	pod := newTerminatedPod("Scale the frontend to 3 replicas " + strings.Repeat("x", 200) + "\n")
+	cl := fake.NewFakeClient(gitops, pod)
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{
+		client:   cl,
+		scheme:   s,
+		recorder: recorder,
+	}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+	message := instance.Status.LastAppliedCommitMessage
+	assert.True(t, strings.HasPrefix(message, "Scale the frontend to 3 replicas"))
+	assert.True(t, strings.HasSuffix(message, "..."))
+	assert.Len(t, message, maxCommitMessageLength)
+	event := <-recorder.Events
+	assert.Contains(t, event, "Normal JobSuccessful")
+	assert.Contains(t, event, message)
+}
+
+func TestJobCompletionEmitterAppliedCommit(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name       string
+		message    string
+		annotation string
+		event      string
+		applied    string
+	}{
+		{"reported commit", `{"commit":"` + commit + `","commitMessage":"Scale the frontend"}`, "", "applied commit " + commit + ": Scale the frontend", commit},
+		{"pushed commit", "Scale the frontend\n", commit, "applied commit " + commit + ": Scale the frontend", commit},
+		{"reported over pushed commit", `{"commit":"` + commit + `"}`, "fedcba9876543210fedcba9876543210fedcba98", "applied commit " + commit, commit},
+		{"message only", "Scale the frontend\n", "", "applied commit: Scale the frontend", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(tt.message))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			succeeded := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+			if tt.annotation != "" {
+				succeeded.Annotations = map[string]string{commitAnnotation: tt.annotation}
+			}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), succeeded)
+
+			event := <-recorder.Events
+			assert.Contains(t, event, "Normal JobSuccessful")
+			assert.Contains(t, event, tt.event)
+			instance := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+			assert.Equal(t, tt.applied, instance.Status.LastAppliedCommit)
+		})
+	}
+}
+
+func TestParseJobReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    jobReport
+	}{
+		{"empty", "", jobReport{}},
+		{"plain commit message", "Fix the deployment\n", jobReport{CommitMessage: "Fix the deployment"}},
+		{"json without force", `{"commitMessage":"Fix the deployment","forceApplied":[]}`, jobReport{CommitMessage: "Fix the deployment", ForceApplied: []string{}}},
+		{"json with force", `{"commitMessage":"Fix the deployment","forceApplied":["deployment.apps/frontend"]}`, jobReport{CommitMessage: "Fix the deployment", ForceApplied: []string{"deployment.apps/frontend"}}},
+		// cut by kubernetes at 4096 bytes, it isn't a commit message
+		{"truncated json", `{"commitMessage":"Fix the deployment","commit":"0123abc","pruned":["deployment.apps/fro`, jobReport{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseJobReport(tt.message))
+		})
+	}
+}
+
+func TestJobCompletionEmitterForceApplied(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name   string
+		report string
+		forced []string
+	}{
+		{"with force", `{"commitMessage":"Take over","forceApplied":["deployment.apps/frontend"]}`, []string{"deployment.apps/frontend"}},
+		{"without force", `{"commitMessage":"Take over","forceApplied":[]}`, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops, newTerminatedPod(tt.report))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   cl,
+				scheme:   s,
+				recorder: recorder,
+			}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+			instance := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+			assert.Equal(t, len(tt.forced), len(instance.Status.ForceAppliedResources))
+			assert.Contains(t, <-recorder.Events, "Normal JobSuccessful")
+			if len(tt.forced) > 0 {
+				assert.Equal(t, tt.forced, instance.Status.ForceAppliedResources)
+				assert.Contains(t, <-recorder.Events, "Warning ForceApplied")
+			}
+			assert.Contains(t, <-recorder.Events, "Normal Applied")
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestJobCompletionEmitterRecreated(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name      string
+		report    string
+		recreated []string
+	}{
+		{"with recreate", `{"commitMessage":"Change the selector","recreated":["service/frontend"]}`, []string{"service/frontend"}},
+		{"without recreate", `{"commitMessage":"Change the selector","recreated":[]}`, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops, newTerminatedPod(tt.report))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   cl,
+				scheme:   s,
+				recorder: recorder,
+			}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+			instance := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+			assert.Equal(t, len(tt.recreated), len(instance.Status.RecreatedResources))
+			assert.Contains(t, <-recorder.Events, "Normal JobSuccessful")
+			if len(tt.recreated) > 0 {
+				assert.Equal(t, tt.recreated, instance.Status.RecreatedResources)
+				event := <-recorder.Events
+				assert.Contains(t, event, "Warning ResourceRecreated")
+				assert.Contains(t, event, "service/frontend")
+			}
+			assert.Contains(t, <-recorder.Events, "Normal Applied")
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestJobCompletionEmitterDrift(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	pod := newTerminatedPod(`{"commitMessage":"Scale the frontend","commit":"abc123","drifted":["apps.v1.Deployment.gitops.frontend"]}`)
+	tests := []struct {
+		name     string
+		status   gitopsv1alpha1.GitOpsConfigStatus
+		detected bool
+		drifted  []string
+	}{
+		{"new drift", gitopsv1alpha1.GitOpsConfigStatus{LastAppliedCommit: "abc123"}, true, []string{"apps.v1.Deployment.gitops.frontend"}},
+		{"unchanged drift", gitopsv1alpha1.GitOpsConfigStatus{LastAppliedCommit: "abc123", DriftedResources: []string{"apps.v1.Deployment.gitops.frontend"}}, false, []string{"apps.v1.Deployment.gitops.frontend"}},
+		{"new commit", gitopsv1alpha1.GitOpsConfigStatus{LastAppliedCommit: "def456"}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Status = tt.status
+			cl := fake.NewFakeClient(instance, pod)
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   cl,
+				scheme:   s,
+				recorder: recorder,
+			}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+			assert.Equal(t, "abc123", instance.Status.LastAppliedCommit)
+			assert.Equal(t, tt.drifted, instance.Status.DriftedResources)
+			assert.Contains(t, <-recorder.Events, "Normal JobSuccessful")
+			if tt.detected {
+				event := <-recorder.Events
+				assert.Contains(t, event, "Warning DriftDetected")
+				assert.Contains(t, event, "1 resources: apps.v1.Deployment.gitops.frontend")
+			}
+			assert.Contains(t, <-recorder.Events, "Normal Applied")
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestSummarizeResources(t *testing.T) {
+	var drifted []string
+	for i := 0; i < maxSummaryResources+2; i++ {
+		drifted = append(drifted, fmt.Sprintf("v1.ConfigMap.gitops.cm%d", i))
+	}
+	assert.Equal(t, "2 resources: v1.ConfigMap.gitops.cm0, v1.ConfigMap.gitops.cm1", summarizeResources(drifted[:2], 2))
+	summary := summarizeResources(drifted, len(drifted))
+	assert.True(t, strings.HasPrefix(summary, "12 resources: v1.ConfigMap.gitops.cm0, "))
+	assert.True(t, strings.HasSuffix(summary, "v1.ConfigMap.gitops.cm9 and 2 more"))
+	// a truncated list is summarized with its total count
+	assert.True(t, strings.HasSuffix(summarizeResources(drifted, 100), "v1.ConfigMap.gitops.cm9 and 90 more"))
+}
+
+func TestIsClusterUnavailable(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    bool
+	}{
+		{"connection refused", "Unable to connect to the server: dial tcp 10.96.0.1:443: connect: connection refused", true},
+		{"timeout", "error: Get https://kubernetes.default.svc:443/api?timeout=32s: dial tcp 10.96.0.1:443: i/o timeout", true},
+		{"tls handshake timeout", "Unable to connect to the server: net/http: TLS handshake timeout", true},
+		{"invalid manifest", `error: error validating "deployment.yaml": error validating data: unknown field "replica"`, false},
+		{"forbidden", `Error from server (Forbidden): deployments.apps "frontend" is forbidden`, false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isClusterUnavailable(tt.message))
+		})
+	}
+}
+
+func TestClusterUnavailableBackoff(t *testing.T) {
+	assert.Equal(t, clusterUnavailableBaseDelay, clusterUnavailableBackoff(0))
+	assert.Equal(t, 2*clusterUnavailableBaseDelay, clusterUnavailableBackoff(1))
+	assert.Equal(t, clusterUnavailableMaxDelay, clusterUnavailableBackoff(maxClusterUnavailableRetries))
+}
+
+func TestJobCompletionEmitterClusterUnavailable(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	defer func(after func(time.Duration, func())) { relaunchAfter = after }(relaunchAfter)
+	job := func(attempt int, status batchv1.JobStatus) *batchv1.Job {
+		job := newOwnedJob(status)
+		job.Annotations = map[string]string{jobAttemptAnnotation: strconv.Itoa(attempt)}
+		return job
+	}
+	pod := func(message string) *corev1.Pod {
+		pod := newTerminatedPod(message)
+		pod.Status.ContainerStatuses[0].State.Terminated.ExitCode = 1
+		return pod
+	}
+	unreachable := "Unable to connect to the server: dial tcp 10.96.0.1:443: connect: connection refused"
+	applyError := `error: error validating "deployment.yaml": error validating data: unknown field "replica"`
+	now := time.Now()
+	maintenance := []gitopsv1alpha1.MaintenanceWindow{{Start: metav1.NewTime(now.Add(-time.Hour)), End: metav1.NewTime(now.Add(time.Hour))}}
+	tests := []struct {
+		name        string
+		retry       bool
+		maintenance []gitopsv1alpha1.MaintenanceWindow
+		attempt     int
+		message     string
+		event       string
+		// the delay before the job is relaunched, 0 when it isn't
+		delay  time.Duration
+		reason string
+	}{
+		{"unreachable", true, nil, 0, unreachable, "Warning ClusterUnavailable", clusterUnavailableBaseDelay, reasonRetrying},
+		{"unreachable again", true, nil, 2, unreachable, "Warning ClusterUnavailable", 4 * clusterUnavailableBaseDelay, reasonRetrying},
+		{"retries exhausted", true, nil, maxClusterUnavailableRetries, unreachable, "Warning ClusterUnavailable", 0, reasonRetriesExhausted},
+		{"apply error", true, nil, 0, applyError, "Warning JobFailed", 0, ""},
+		{"unreachable without option", false, nil, 0, unreachable, "Warning JobFailed", 0, ""},
+		{"unreachable during maintenance", true, maintenance, 0, unreachable, "Normal ClusterUnavailable", clusterUnavailableBaseDelay, reasonRetrying},
+		{"apply error during maintenance", true, maintenance, 0, applyError, "Normal JobFailed", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var delays []time.Duration
+			relaunchAfter = func(delay time.Duration, relaunch func()) {
+				delays = append(delays, delay)
+				relaunch()
+			}
+			instance := gitops.DeepCopy()
+			instance.Spec.RetryClusterUnavailable = tt.retry
+			instance.Spec.MaintenanceWindows = tt.maintenance
+			cl := fake.NewFakeClient(instance, pod(tt.message))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   cl,
+				scheme:   s,
+				recorder: recorder,
+			}
+			emitter.OnUpdate(job(tt.attempt, batchv1.JobStatus{Active: 1}), job(tt.attempt, batchv1.JobStatus{Failed: 1}))
+
+			assert.Contains(t, <-recorder.Events, tt.event)
+			assert.Empty(t, drainEvents(recorder))
+			jobs := &batchv1.JobList{}
+			assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+			if tt.delay > 0 {
+				assert.Equal(t, []time.Duration{tt.delay}, delays)
+				// the relaunched job is the next attempt
+				if assert.Len(t, jobs.Items, 1) {
+					assert.Equal(t, tt.attempt+1, getJobAttempt(&jobs.Items[0]))
+				}
+			} else {
+				assert.Empty(t, delays)
+				assert.Empty(t, jobs.Items)
+			}
+			updated := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+			condition := getCondition(&updated.Status, gitopsv1alpha1.ConditionClusterUnavailable)
+			if tt.reason == "" {
+				assert.Nil(t, condition)
+				return
+			}
+			if assert.NotNil(t, condition) {
+				assert.Equal(t, corev1.ConditionTrue, condition.Status)
+				assert.Equal(t, tt.reason, condition.Reason)
+			}
+
+			// the condition is cleared once a job succeeds
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+			updated = &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+			assert.False(t, isConditionTrue(&updated.Status, gitopsv1alpha1.ConditionClusterUnavailable))
+		})
+	}
+}
+
+func TestJobCompletionEmitterPruned(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	job := func(status batchv1.JobStatus) *batchv1.Job {
+		job := newOwnedJob(status)
+		job.Labels = map[string]string{"action": "delete"}
+		return job
+	}
+	tests := []struct {
+		name   string
+		report string
+		pruned float64
+		events []string
+	}{
+		{"nothing pruned", `{"commitMessage":"Remove the frontend","pruned":[],"prunedCount":0}`, 0, nil},
+		{"few pruned", `{"commitMessage":"Remove the frontend","pruned":["deployment.apps/frontend","service/frontend"],"prunedCount":2}`, 2,
+			[]string{"deployment.apps/frontend", "service/frontend"}},
+		{"many pruned", `{"commitMessage":"Remove everything","pruned":["configmap/cm0","configmap/cm1"],"prunedCount":120}`, 120,
+			[]string{"120 resources: configmap/cm0, configmap/cm1 and 118 more"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(tt.report))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   cl,
+				scheme:   s,
+				recorder: recorder,
+			}
+			before := testutil.ToFloat64(resourcesPruned.WithLabelValues(namespace, name))
+			emitter.OnUpdate(job(batchv1.JobStatus{Active: 1}), job(batchv1.JobStatus{Succeeded: 1}))
+
+			assert.Equal(t, before+tt.pruned, testutil.ToFloat64(resourcesPruned.WithLabelValues(namespace, name)))
+			assert.Contains(t, <-recorder.Events, "Normal JobSuccessful")
+			for _, resources := range tt.events {
+				event := <-recorder.Events
+				assert.Contains(t, event, "Warning ResourcePruned")
+				assert.Contains(t, event, resources)
+			}
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestJobCompletionEmitterPruneSkipped(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy(),
+		newTerminatedPod(`{"commitMessage":"Remove team-b","pruned":["deployment.apps/web"],"pruneSkipped":["persistentvolumeclaim/data"]}`))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	skipped := []string{}
+	for _, event := range drainEvents(recorder) {
+		if strings.HasPrefix(event, "Normal PruneSkipped") {
+			skipped = append(skipped, event)
+		}
+	}
+	if assert.Len(t, skipped, 1) {
+		assert.Contains(t, skipped[0], "persistentvolumeclaim/data")
+	}
+}
+
+func TestJobCompletionEmitterSyncResult(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	launched := metav1.NewTime(time.Now().Add(-90 * time.Second))
+	job := func(status batchv1.JobStatus) *batchv1.Job {
+		job := newOwnedJob(status)
+		job.CreationTimestamp = launched
+		return job
+	}
+	tests := []struct {
+		name        string
+		status      batchv1.JobStatus
+		progressing bool
+		duration    float64
+		result      string
+		synced      corev1.ConditionStatus
+	}{
+		// the duration is measured from the transition of the Progressing condition
+		{"ready", batchv1.JobStatus{Succeeded: 1}, true, 60, "Success", corev1.ConditionTrue},
+		{"degraded", batchv1.JobStatus{Failed: 1}, true, 60, "Failed", corev1.ConditionFalse},
+		// or from the launch of the job when it wasn't seen running
+		{"not seen progressing", batchv1.JobStatus{Succeeded: 1}, false, 90, "Success", corev1.ConditionTrue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			if tt.progressing {
+				instance.Status.Conditions = []gitopsv1alpha1.GitOpsConfigCondition{{
+					Type:               gitopsv1alpha1.ConditionProgressing,
+					Status:             corev1.ConditionTrue,
+					Reason:             "JobStarted",
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-60 * time.Second)),
+				}}
+			}
+			cl := fake.NewFakeClient(instance)
+			emitter := &jobCompletionEmitter{
+				client:   cl,
+				scheme:   s,
+				recorder: record.NewFakeRecorder(10),
+			}
+			emitter.OnUpdate(job(batchv1.JobStatus{Active: 1}), job(tt.status))
+
+			instance = &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+			assert.InDelta(t, tt.duration, instance.Status.LastSyncDuration.Seconds(), 5)
+			assert.InDelta(t, tt.duration, testutil.ToFloat64(lastSyncDuration.WithLabelValues(namespace, name)), 5)
+			assert.Equal(t, tt.result, instance.Status.LastSyncResult)
+			assert.Equal(t, "gitopsconfig-gitops-operator-abcde", instance.Status.LastSyncJob)
+			if assert.NotNil(t, instance.Status.LastSyncTime) {
+				assert.WithinDuration(t, time.Now(), instance.Status.LastSyncTime.Time, 5*time.Second)
+			}
+			if synced := getCondition(&instance.Status, gitopsv1alpha1.ConditionSynced); assert.NotNil(t, synced) {
+				assert.Equal(t, tt.synced, synced.Status)
+			}
+		})
+	}
+
+	// a job still running doesn't end the sync
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	emitter.OnUpdate(job(batchv1.JobStatus{}), job(batchv1.JobStatus{Active: 1}))
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+	assert.Zero(t, instance.Status.LastSyncDuration.Duration)
+	assert.Nil(t, instance.Status.LastSyncTime)
+	assert.Nil(t, getCondition(&instance.Status, gitopsv1alpha1.ConditionSynced))
+}
+
+func TestJobCompletionEmitterProgressing(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	progressing := func() *gitopsv1alpha1.GitOpsConfigCondition {
+		instance := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+		return getCondition(&instance.Status, gitopsv1alpha1.ConditionProgressing)
+	}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{}), newOwnedJob(batchv1.JobStatus{Active: 1}))
+	if condition := progressing(); assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, "JobStarted", condition.Reason)
+	}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	if condition := progressing(); assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, "JobFinished", condition.Reason)
+	}
+}
+
+func TestJobCompletionEmitterMirror(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name      string
+		report    string
+		template  string
+		parameter string
+		event     string
+	}{
+		{"primary", `{"commitMessage":"Scale the frontend"}`, "", "", ""},
+		{"shared mirror", `{"commitMessage":"Scale the frontend","templateMirror":"https://mirror.example.com/apps.git","parameterMirror":"https://mirror.example.com/apps.git"}`,
+			"https://mirror.example.com/apps.git", "https://mirror.example.com/apps.git", "https://mirror.example.com/apps.git"},
+		{"parameter mirror", `{"commitMessage":"Scale the frontend","parameterMirror":"https://mirror.example.com/params.git"}`,
+			"", "https://mirror.example.com/params.git", "https://mirror.example.com/params.git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(tt.report))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+			instance := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+			assert.Equal(t, tt.template, instance.Status.TemplateSourceMirror)
+			assert.Equal(t, tt.parameter, instance.Status.ParameterSourceMirror)
+			mirrored := []string{}
+			for _, event := range drainEvents(recorder) {
+				if strings.HasPrefix(event, "Warning ClonedFromMirror") {
+					mirrored = append(mirrored, event)
+				}
+			}
+			if tt.event == "" {
+				assert.Empty(t, mirrored)
+			} else if assert.Len(t, mirrored, 1) {
+				assert.Contains(t, mirrored[0], tt.event)
+			}
+		})
+	}
+}
+
+func TestDescribeMirrors(t *testing.T) {
+	assert.Equal(t, "the template source from https://a", describeMirrors(jobReport{TemplateMirror: "https://a", ParameterMirror: "https://a"}))
+	assert.Equal(t, "the template source from https://a and the parameter source from https://b",
+		describeMirrors(jobReport{TemplateMirror: "https://a", ParameterMirror: "https://b"}))
+}
+
+func TestFindJobOwner(t *testing.T) {
+	scheme.Scheme.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	controller := true
+	// controlledBy returns the metadata of an object in the namespace of the tests, controlled by the given owner
+	controlledBy := func(objectName, apiVersion, kind, owner string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:            objectName,
+			Namespace:       namespace,
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: owner, UID: types.UID(owner + "-uid"), Controller: &controller}},
+		}
+	}
+	cronjob := func(cronjobName, apiVersion, kind, owner string) *batchv1beta1.CronJob {
+		return &batchv1beta1.CronJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1beta1", Kind: "CronJob"},
+			ObjectMeta: controlledBy(cronjobName, apiVersion, kind, owner),
+		}
+	}
+	deployment := func(deploymentName, apiVersion, kind, owner string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: controlledBy(deploymentName, apiVersion, kind, owner),
+		}
+	}
+	tests := []struct {
+		name    string
+		job     metav1.ObjectMeta
+		objects []runtime.Object
+		owner   string
+		wantErr bool
+	}{
+		{"direct", controlledBy("job", "eunomia.kohls.io/v1alpha1", "GitOpsConfig", name), nil, name, false},
+		{"through a cronjob", controlledBy("job", "batch/v1beta1", "CronJob", "periodic"), []runtime.Object{
+			cronjob("periodic", "eunomia.kohls.io/v1alpha1", "GitOpsConfig", name),
+		}, name, false},
+		{"through two controllers", controlledBy("job", "batch/v1beta1", "CronJob", "periodic"), []runtime.Object{
+			cronjob("periodic", "apps/v1", "Deployment", "release"),
+			deployment("release", "eunomia.kohls.io/v1alpha1", "GitOpsConfig", name),
+		}, name, false},
+		{"not controlled by a GitOpsConfig", controlledBy("job", "batch/v1beta1", "CronJob", "periodic"), []runtime.Object{
+			cronjob("periodic", "apps/v1", "Deployment", "release"),
+			&appsv1.Deployment{TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}, ObjectMeta: metav1.ObjectMeta{Name: "release", Namespace: namespace}},
+		}, "", false},
+		{"not a controller", metav1.ObjectMeta{
+			Name:            "job",
+			Namespace:       namespace,
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "eunomia.kohls.io/v1alpha1", Kind: "GitOpsConfig", Name: name}},
+		}, nil, "", false},
+		{"cycle", controlledBy("job", "batch/v1beta1", "CronJob", "ping"), []runtime.Object{
+			cronjob("ping", "batch/v1beta1", "CronJob", "pong"),
+			cronjob("pong", "batch/v1beta1", "CronJob", "ping"),
+		}, "", false},
+		{"missing controller", controlledBy("job", "batch/v1beta1", "CronJob", "periodic"), nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the intermediate controllers are read with the reader of the controllers, not with the cached client
+			owner, err := findJobOwner(&batchv1.Job{ObjectMeta: tt.job}, fake.NewFakeClient(), fake.NewFakeClient(tt.objects...))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.owner == "" {
+				assert.Nil(t, owner)
+				return
+			}
+			if assert.NotNil(t, owner) {
+				assert.Equal(t, tt.owner, owner.Name)
+				assert.Equal(t, namespace, owner.Namespace)
+				assert.Equal(t, types.UID(tt.owner+"-uid"), owner.UID)
+				assert.Equal(t, "GitOpsConfig", owner.Kind)
+			}
+		})
+	}
+}
+
+func TestRecordManagedResources(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	job := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+	managedResources := func(report string) *gitopsv1alpha1.ManagedResources {
+		pod := newTerminatedPod(report)
+		_ = cl.Delete(context.TODO(), pod.DeepCopy())
+		assert.NoError(t, cl.Create(context.TODO(), pod))
+		emitter.recordJobReport(gitops, job)
+		instance := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+		return instance.Status.ManagedResources
+	}
+
+	assert.Equal(t, &gitopsv1alpha1.ManagedResources{Count: 2, Hash: "a1b2", ConfigMap: "gitopsconfig-gitops-operator-inventory"},
+		managedResources(`{"commit":"abc","managedResources":{"count":2,"hash":"a1b2","configMap":"gitopsconfig-gitops-operator-inventory"}}`))
+	// every sync replaces the inventory
+	assert.Equal(t, &gitopsv1alpha1.ManagedResources{Count: 3, Hash: "c3d4"},
+		managedResources(`{"commit":"def","managedResources":{"count":3,"hash":"c3d4","configMap":""}}`))
+	// a run whose applied resources aren't all known keeps the previous inventory
+	assert.Equal(t, &gitopsv1alpha1.ManagedResources{Count: 3, Hash: "c3d4"}, managedResources(`{"commit":"def","managedResources":null}`))
+}
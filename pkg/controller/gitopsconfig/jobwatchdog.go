@@ -0,0 +1,230 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// jobWatchCheckInterval is how often the watch on Jobs is compared with the API server
+const jobWatchCheckInterval = 5 * time.Minute
+
+// jobWatchdog runs the watch on Jobs and restarts it when it silently stops
+// delivering events. Every interval it lists the Jobs from the API server and
+// compares their resource versions with the ones seen by the watch. A Job
+// lagging behind in two consecutive checks means the watch is dead.
+type jobWatchdog struct {
+	// start starts the watch, returning its store, a function telling whether its initial sync completed and a
+	// function stopping it
+	start func() (cache.Store, cache.InformerSynced, func(), error)
+	// list returns the Jobs as seen by the API server
+	list     func() ([]batchv1.Job, error)
+	interval time.Duration
+
+	store cache.Store
+	stop  func()
+	// synced tells whether the running watch completed its initial sync, guarded by mu as the readiness probe reads it
+	synced cache.InformerSynced
+	mu     sync.Mutex
+	// lagging maps the Jobs the watch was behind on at the last check to their resource version
+	lagging map[string]string
+	// handler receives the changes of the Jobs from the watch, it is drained when the watchdog stops
+	handler *drainingHandler
+	// started is set once the watch started, guarded by mu, and drained closed once it stopped and was drained
+	started bool
+	drained chan struct{}
+}
+
+var _ manager.Runnable = &jobWatchdog{}
+
+// runningWatchdog is the watchdog of the operator, nil until the controller is added to the manager
+var runningWatchdog *jobWatchdog
+
+// JobWatchSynced returns true once the watch on Jobs listed the existing Jobs, its handler receiving the changes of
+// all of them from then on. It is false again while the watch is restarted.
+func JobWatchSynced() bool {
+	return runningWatchdog != nil && runningWatchdog.hasSynced()
+}
+
+// newJobWatchdog returns a watchdog running the watch on the Jobs of the watched namespaces for handler
+func newJobWatchdog(kubecfg *rest.Config, handler cache.ResourceEventHandler) (*jobWatchdog, error) {
+	clientset, err := kubernetes.NewForConfig(kubecfg)
+	if err != nil {
+		return nil, err
+	}
+	// the restarted watches share the handler, so that the shutdown drains the events of all of them
+	draining := &drainingHandler{handler: handler}
+	return &jobWatchdog{
+		start: func() (cache.Store, cache.InformerSynced, func(), error) {
+			store, synced, stop := startJobInformers(clientset, watchedJobNamespaces(), draining)
+			return store, synced, stop, nil
+		},
+		list: func() ([]batchv1.Job, error) {
+			all := []batchv1.Job{}
+			for _, namespace := range watchedJobNamespaces() {
+				jobs, err := clientset.BatchV1().Jobs(namespace).List(metav1.ListOptions{})
+				if err != nil {
+					return nil, err
+				}
+				all = append(all, jobs.Items...)
+			}
+			return all, nil
+		},
+		interval: jobWatchCheckInterval,
+		handler:  draining,
+		drained:  make(chan struct{}),
+	}, nil
+}
+
+// Start starts the watch and checks it every interval, until stopCh is closed.
+// The watch is then stopped and the events in flight are processed, at most
+// the shutdown grace period.
+func (w *jobWatchdog) Start(stopCh <-chan struct{}) error {
+	err := w.run()
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.started = true
+	w.mu.Unlock()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			w.shutdown(shutdownGracePeriod)
+			return nil
+		case <-ticker.C:
+			if _, err := w.check(); err != nil {
+				log.Error(err, "unable to check the watch on jobs")
+			}
+		}
+	}
+}
+
+// check compares the watched Jobs with the API server and restarts the watch
+// if it is found stalled. It returns true if the watch was restarted.
+func (w *jobWatchdog) check() (bool, error) {
+	jobs, err := w.list()
+	if err != nil {
+		return false, err
+	}
+	lagging := map[string]string{}
+	stalled := false
+	for i := range jobs {
+		key, err := cache.MetaNamespaceKeyFunc(&jobs[i])
+		if err != nil {
+			return false, err
+		}
+		version := jobs[i].GetResourceVersion()
+		obj, exists, err := w.store.GetByKey(key)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			if seen, ok := obj.(*batchv1.Job); ok && seen.GetResourceVersion() == version {
+				continue
+			}
+		}
+		lagging[key] = version
+		if w.lagging[key] == version {
+			stalled = true
+		}
+	}
+	w.lagging = lagging
+	if !stalled {
+		return false, nil
+	}
+
+	log.Info("watch on jobs is stalled, restarting it", "laggingJobs", len(lagging))
+	w.stop()
+	w.lagging = nil
+	err = w.run()
+	if err != nil {
+		// an empty store makes the next check retry the restart
+		w.store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+		w.stop = func() {}
+		return false, err
+	}
+	jobWatchRestarts.Inc()
+	return true, nil
+}
+
+// run starts a watch, replacing the one previously started. The watch isn't
+// synced until it is started.
+func (w *jobWatchdog) run() error {
+	w.mu.Lock()
+	w.synced = nil
+	w.mu.Unlock()
+	store, synced, stop, err := w.start()
+	if err != nil {
+		return err
+	}
+	w.store, w.stop = store, stop
+	w.mu.Lock()
+	w.synced = synced
+	w.mu.Unlock()
+	return nil
+}
+
+// hasSynced returns true if the running watch completed its initial sync
+func (w *jobWatchdog) hasSynced() bool {
+	w.mu.Lock()
+	synced := w.synced
+	w.mu.Unlock()
+	return synced != nil && synced()
+}
+
+// shutdown stops the watch and waits for the events in flight to be processed, at most grace
+func (w *jobWatchdog) shutdown(grace time.Duration) {
+	w.stop()
+	if w.handler != nil {
+		if w.handler.drain(grace) {
+			log.Info("the job events in flight were processed")
+		} else {
+			log.Info("the job events in flight were not processed within the shutdown grace period", "gracePeriod", grace)
+		}
+	}
+	if w.drained != nil {
+		close(w.drained)
+	}
+}
+
+// waitDrained waits for the watchdog to stop the watch and drain its events, at most grace. It returns right away if
+// the watch never started.
+func (w *jobWatchdog) waitDrained(grace time.Duration) {
+	w.mu.Lock()
+	started := w.started
+	w.mu.Unlock()
+	if !started || w.drained == nil {
+		return
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-w.drained:
+	case <-timer.C:
+	}
+}
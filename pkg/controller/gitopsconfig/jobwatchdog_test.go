@@ -0,0 +1,289 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newWatchdogJob(name, version string) batchv1.Job {
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			ResourceVersion: version,
+		},
+	}
+}
+
+// newTestWatchdog returns a watchdog whose watch is a store filled by the test,
+// and a pointer to the number of times the watch was started
+func newTestWatchdog(apiJobs *[]batchv1.Job) (*jobWatchdog, *int) {
+	starts := 0
+	w := &jobWatchdog{
+		start: func() (cache.Store, cache.InformerSynced, func(), error) {
+			starts++
+			store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+			// a freshly started watch lists all the jobs
+			for i := range *apiJobs {
+				job := (*apiJobs)[i]
+				store.Add(&job)
+			}
+			return store, func() bool { return true }, func() {}, nil
+		},
+		list: func() ([]batchv1.Job, error) {
+			return *apiJobs, nil
+		},
+	}
+	w.run()
+	return w, &starts
+}
+
+func TestJobWatchdogHealthy(t *testing.T) {
+	apiJobs := []batchv1.Job{newWatchdogJob("job-a", "1")}
+	w, starts := newTestWatchdog(&apiJobs)
+
+	// The watch delivers the update of job-a and the creation of job-b
+	apiJobs = []batchv1.Job{newWatchdogJob("job-a", "2"), newWatchdogJob("job-b", "3")}
+	for i := range apiJobs {
+		job := apiJobs[i]
+		w.store.Update(&job)
+	}
+	for i := 0; i < 3; i++ {
+		restarted, err := w.check()
+		assert.NoError(t, err)
+		assert.False(t, restarted)
+	}
+	assert.Equal(t, 1, *starts)
+}
+
+func TestJobWatchdogStalled(t *testing.T) {
+	before := testutil.ToFloat64(jobWatchRestarts)
+	apiJobs := []batchv1.Job{newWatchdogJob("job-a", "1")}
+	w, starts := newTestWatchdog(&apiJobs)
+
+	// The watch is dead: the API server sees changes that never reach the store
+	apiJobs = []batchv1.Job{newWatchdogJob("job-a", "2"), newWatchdogJob("job-b", "3")}
+
+	// A single lagging check may be an event in flight
+	restarted, err := w.check()
+	assert.NoError(t, err)
+	assert.False(t, restarted)
+
+	// Lagging behind twice on the same versions means the watch is stalled
+	restarted, err = w.check()
+	assert.NoError(t, err)
+	assert.True(t, restarted)
+	assert.Equal(t, 2, *starts)
+	assert.Equal(t, before+1, testutil.ToFloat64(jobWatchRestarts))
+
+	// The restarted watch is up to date
+	restarted, err = w.check()
+	assert.NoError(t, err)
+	assert.False(t, restarted)
+}
+
+func TestJobWatchdogSynced(t *testing.T) {
+	synced := false
+	w := &jobWatchdog{
+		start: func() (cache.Store, cache.InformerSynced, func(), error) {
+			return cache.NewStore(cache.MetaNamespaceKeyFunc), func() bool { return synced }, func() {}, nil
+		},
+	}
+	assert.False(t, w.hasSynced(), "the watch isn't started")
+	assert.NoError(t, w.run())
+	assert.False(t, w.hasSynced(), "the jobs aren't listed yet")
+	synced = true
+	assert.True(t, w.hasSynced())
+
+	defer func() { runningWatchdog = nil }()
+	assert.False(t, JobWatchSynced(), "the controller isn't added to the manager")
+	runningWatchdog = w
+	assert.True(t, JobWatchSynced())
+
+	w.start = func() (cache.Store, cache.InformerSynced, func(), error) {
+		return nil, nil, nil, fmt.Errorf("connection refused")
+	}
+	assert.Error(t, w.run())
+	assert.False(t, JobWatchSynced(), "the watch failed to restart")
+}
+
+// recordingHandler returns a handler sending its calls to a channel, and a
+// function returning the next call, or timeout
+func recordingHandler() (cache.ResourceEventHandler, func() string) {
+	events := make(chan string, 10)
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			job := obj.(*batchv1.Job)
+			events <- fmt.Sprintf("add %s/%s", job.Namespace, job.Name)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			job := newObj.(*batchv1.Job)
+			events <- fmt.Sprintf("update %s/%s %d", job.Namespace, job.Name, job.Status.Active)
+		},
+		DeleteFunc: func(obj interface{}) {
+			job := obj.(*batchv1.Job)
+			events <- fmt.Sprintf("delete %s/%s", job.Namespace, job.Name)
+		},
+	}
+	next := func() string {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			return "timeout"
+		}
+	}
+	return handler, next
+}
+
+// waitForWatches waits until count watches are opened on clientset. The fake
+// clientset only sends the changes made after the watch is opened.
+func waitForWatches(t *testing.T, clientset *kubefake.Clientset, count int) {
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		watches := 0
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "watch" {
+				watches++
+			}
+		}
+		return watches >= count, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartJobInformers(t *testing.T) {
+	existing := newWatchdogJob("existing", "1")
+	clientset := kubefake.NewSimpleClientset(&existing)
+	handler, next := recordingHandler()
+
+	store, synced, stop := startJobInformers(clientset, []string{corev1.NamespaceAll}, handler)
+	defer stop()
+	assert.Equal(t, "add gitops/existing", next(), "the existing jobs are listed")
+	waitForWatches(t, clientset, 1)
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return synced(), nil
+	}), "the informer completes its initial sync")
+
+	jobs := clientset.BatchV1().Jobs(namespace)
+	created := newWatchdogJob("created", "")
+	_, err := jobs.Create(&created)
+	assert.NoError(t, err)
+	assert.Equal(t, "add gitops/created", next())
+	created.Status.Active = 1
+	_, err = jobs.Update(&created)
+	assert.NoError(t, err)
+	assert.Equal(t, "update gitops/created 1", next())
+	err = jobs.Delete("existing", &metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "delete gitops/existing", next())
+
+	_, exists, err := store.GetByKey(namespace + "/created")
+	assert.NoError(t, err)
+	assert.True(t, exists, "the store holds the watched jobs")
+	_, exists, _ = store.GetByKey(namespace + "/existing")
+	assert.False(t, exists)
+}
+
+func TestAddJobWatch(t *testing.T) {
+	job := func(name, version string, active int) string {
+		return fmt.Sprintf(`{"kind":"Job","apiVersion":"batch/v1","metadata":{"name":"%s","namespace":"%s","resourceVersion":"%s"},"status":{"active":%d}}`,
+			name, namespace, version, active)
+	}
+	done := make(chan struct{})
+	// the API server lists a job, then its watch adds, updates and deletes jobs
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/batch/v1/jobs" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") != "true" {
+			fmt.Fprintf(w, `{"kind":"JobList","apiVersion":"batch/v1","metadata":{"resourceVersion":"1"},"items":[%s]}`, job("existing", "1", 0))
+			return
+		}
+		fmt.Fprintf(w, "{\"type\":\"ADDED\",\"object\":%s}\n", job("created", "2", 0))
+		fmt.Fprintf(w, "{\"type\":\"MODIFIED\",\"object\":%s}\n", job("created", "3", 1))
+		fmt.Fprintf(w, "{\"type\":\"DELETED\",\"object\":%s}\n", job("existing", "4", 0))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+	handler, next := recordingHandler()
+
+	stop, err := addJobWatch(&rest.Config{Host: server.URL}, handler)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer stop()
+	assert.Equal(t, "add gitops/existing", next(), "the existing jobs are listed")
+	assert.Equal(t, "add gitops/created", next())
+	assert.Equal(t, "update gitops/created 1", next())
+	assert.Equal(t, "delete gitops/existing", next())
+}
+
+func TestStartJobInformersNamespaces(t *testing.T) {
+	newJob := func(namespace, name string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+	clientset := kubefake.NewSimpleClientset(newJob("team-a", "existing"), newJob("team-c", "existing"))
+	handler, next := recordingHandler()
+
+	store, synced, stop := startJobInformers(clientset, []string{"team-a", "team-b"}, handler)
+	defer stop()
+	assert.Equal(t, "add team-a/existing", next(), "only the jobs of the watched namespaces are listed")
+	waitForWatches(t, clientset, 2)
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return synced(), nil
+	}), "the informers of all the namespaces complete their initial sync")
+
+	for _, namespace := range []string{"team-c", "team-b"} {
+		_, err := clientset.BatchV1().Jobs(namespace).Create(newJob(namespace, "created"))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, "add team-b/created", next())
+	err := clientset.BatchV1().Jobs("team-a").Delete("existing", &metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "delete team-a/existing", next())
+
+	// the store of all the namespaces is updated by the informers, after the handler
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		keys := store.ListKeys()
+		return len(keys) == 1 && keys[0] == "team-b/created", nil
+	})
+	assert.NoError(t, err, "the store holds %v", store.ListKeys())
+}
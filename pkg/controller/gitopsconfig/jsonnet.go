@@ -0,0 +1,64 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// jsonnetImage is the template processor image of the GitOpsConfigs whose templateProcessorType is Jsonnet
+var jsonnetImage = "quay.io/kohlstechnology/eunomia-jsonnet:latest"
+
+// SetJsonnetImage configures the template processor image set on the GitOpsConfigs whose templateProcessorType is
+// Jsonnet, when they don't set templateProcessorImage
+func SetJsonnetImage(image string) {
+	jsonnetImage = image
+}
+
+// defaultJsonnet sets the template processor image of instance to the Jsonnet image of the operator when it sets the
+// Jsonnet templateProcessorType without an image
+func defaultJsonnet(instance *gitopsv1alpha1.GitOpsConfig) {
+	if instance.Spec.TemplateProcessorType == "Jsonnet" && instance.Spec.TemplateProcessorImage == "" {
+		instance.Spec.TemplateProcessorImage = jsonnetImage
+	}
+}
+
+// validateJsonnet verifies that the entrypoint evaluated is a file of the contextDir of the template source, and how
+// the parameters are passed to it
+func validateJsonnet(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.Jsonnet == nil {
+		return nil
+	}
+	switch spec.Jsonnet.Variables {
+	case "", "External", "TopLevel":
+	default:
+		return fmt.Errorf("jsonnet variables %q is not one of External, TopLevel", spec.Jsonnet.Variables)
+	}
+	entrypoint := spec.Jsonnet.Entrypoint
+	if entrypoint == "" {
+		return nil
+	}
+	clean := path.Clean(entrypoint)
+	if path.IsAbs(entrypoint) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || strings.HasSuffix(entrypoint, "/") {
+		return fmt.Errorf("jsonnet entrypoint %q is not a file of the template source contextDir", entrypoint)
+	}
+	return nil
+}
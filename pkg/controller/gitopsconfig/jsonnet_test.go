@@ -0,0 +1,98 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestValidateJsonnet(t *testing.T) {
+	tests := []struct {
+		name    string
+		jsonnet gitopsv1alpha1.JsonnetConfig
+		errMsg  string
+	}{
+		{"defaults", gitopsv1alpha1.JsonnetConfig{}, ""},
+		{"entrypoint", gitopsv1alpha1.JsonnetConfig{Entrypoint: "environments/prod.jsonnet", Variables: "TopLevel"}, ""},
+		{"variables", gitopsv1alpha1.JsonnetConfig{Variables: "Env"}, `jsonnet variables "Env" is not one of External, TopLevel`},
+		{"absolute", gitopsv1alpha1.JsonnetConfig{Entrypoint: "/main.jsonnet"}, `jsonnet entrypoint "/main.jsonnet" is not a file of the template source contextDir`},
+		{"outside", gitopsv1alpha1.JsonnetConfig{Entrypoint: "lib/../../main.jsonnet"}, `jsonnet entrypoint "lib/../../main.jsonnet" is not a file of the template source contextDir`},
+		{"directory", gitopsv1alpha1.JsonnetConfig{Entrypoint: "environments/"}, `jsonnet entrypoint "environments/" is not a file of the template source contextDir`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonnet := tt.jsonnet
+			err := validateJsonnet(gitopsv1alpha1.GitOpsConfigSpec{Jsonnet: &jsonnet})
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestDefaultJsonnet(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateProcessorType = "Jsonnet"
+	defaultJsonnet(instance)
+	assert.Equal(t, gitops.Spec.TemplateProcessorImage, instance.Spec.TemplateProcessorImage, "the image set is kept")
+
+	instance.Spec.TemplateProcessorImage = ""
+	defaultJsonnet(instance)
+	assert.Equal(t, jsonnetImage, instance.Spec.TemplateProcessorImage)
+}
+
+func TestJsonnetJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.TemplateSource.SecretRef = ""
+	instance.Spec.ParameterSource.SecretRef = ""
+	instance.Spec.TemplateProcessorType = "Jsonnet"
+	instance.Spec.Jsonnet = &gitopsv1alpha1.JsonnetConfig{Entrypoint: "environments/prod.jsonnet", Variables: "TopLevel"}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	env := map[string]string{}
+	for _, e := range jobs.Items[0].Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, "environments/prod.jsonnet", env["JSONNET_ENTRYPOINT"])
+	assert.Equal(t, "TopLevel", env["JSONNET_VARIABLES"])
+	assert.NotContains(t, env, "KUSTOMIZE_OVERLAY")
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// kustomizeImage is the template processor image of the GitOpsConfigs whose templateProcessorType is Kustomize
+var kustomizeImage = "quay.io/kohlstechnology/eunomia-kustomize:latest"
+
+// SetKustomizeImage configures the template processor image set on the GitOpsConfigs whose templateProcessorType is
+// Kustomize, when they don't set templateProcessorImage
+func SetKustomizeImage(image string) {
+	kustomizeImage = image
+}
+
+// defaultKustomize sets the template processor image of instance to the Kustomize image of the operator when it sets
+// the Kustomize templateProcessorType without an image
+func defaultKustomize(instance *gitopsv1alpha1.GitOpsConfig) {
+	if instance.Spec.TemplateProcessorType == "Kustomize" && instance.Spec.TemplateProcessorImage == "" {
+		instance.Spec.TemplateProcessorImage = kustomizeImage
+	}
+}
+
+// validateKustomize verifies that the overlay built is a directory of the contextDir of the template source
+func validateKustomize(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.Kustomize == nil || spec.Kustomize.Overlay == "" {
+		return nil
+	}
+	overlay := spec.Kustomize.Overlay
+	if path.IsAbs(overlay) || path.Clean(overlay) == ".." || strings.HasPrefix(path.Clean(overlay), "../") {
+		return fmt.Errorf("kustomize overlay %q is not a directory of the template source contextDir", overlay)
+	}
+	return nil
+}
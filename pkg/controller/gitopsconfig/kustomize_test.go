@@ -0,0 +1,96 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestValidateKustomize(t *testing.T) {
+	tests := []struct {
+		name    string
+		overlay string
+		errMsg  string
+	}{
+		{"context dir", "", ""},
+		{"overlay", "overlays/prod", ""},
+		{"overlay with dots", "overlays/../base", ""},
+		{"absolute", "/overlays/prod", `kustomize overlay "/overlays/prod" is not a directory of the template source contextDir`},
+		{"parent", "..", `kustomize overlay ".." is not a directory of the template source contextDir`},
+		{"outside", "overlays/../../prod", `kustomize overlay "overlays/../../prod" is not a directory of the template source contextDir`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateKustomize(gitopsv1alpha1.GitOpsConfigSpec{Kustomize: &gitopsv1alpha1.KustomizeConfig{Overlay: tt.overlay}})
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestDefaultKustomize(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateProcessorType = "Kustomize"
+	defaultKustomize(instance)
+	assert.Equal(t, gitops.Spec.TemplateProcessorImage, instance.Spec.TemplateProcessorImage, "the image set is kept")
+
+	instance.Spec.TemplateProcessorImage = ""
+	defaultKustomize(instance)
+	assert.Equal(t, kustomizeImage, instance.Spec.TemplateProcessorImage)
+}
+
+func TestKustomizeJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.TemplateSource.SecretRef = ""
+	instance.Spec.ParameterSource.SecretRef = ""
+	instance.Spec.TemplateProcessorType = "Kustomize"
+	instance.Spec.Kustomize = &gitopsv1alpha1.KustomizeConfig{Overlay: "overlays/prod"}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	env := map[string]string{}
+	for _, e := range jobs.Items[0].Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, "overlays/prod", env["KUSTOMIZE_OVERLAY"])
+	assert.NotContains(t, env, "HELM_SET")
+}
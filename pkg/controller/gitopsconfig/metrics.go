@@ -0,0 +1,208 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"strconv"
+	"sync"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The states of the GitOpsConfigs counted by eunomia_gitopsconfig_status
+const (
+	// configStateSynced is the state of the GitOpsConfigs whose last finished job succeeded
+	configStateSynced = "Synced"
+	// configStateFailed is the state of the GitOpsConfigs whose last finished job failed
+	configStateFailed = "Failed"
+	// configStateSuspended is the state of the GitOpsConfigs whose jobs are suspended, whatever their last job
+	configStateSuspended = "Suspended"
+	// configStateUnknown is the state of the GitOpsConfigs none of whose jobs finished yet
+	configStateUnknown = "Unknown"
+)
+
+var (
+	jobWatchRestarts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "eunomia_job_watch_restarts_total",
+		Help: "Number of times the watch on Jobs was found stalled and restarted",
+	})
+	resourcesPruned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eunomia_resources_pruned_total",
+		Help: "Number of resources deleted by the jobs of a GitOpsConfig",
+	}, []string{"namespace", "config"})
+	lastSyncDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "eunomia_last_sync_duration_seconds",
+		Help: "Time a GitOpsConfig spent in the Progressing condition until its last finished job completed",
+	}, []string{"namespace", "config"})
+	triggers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eunomia_triggers_total",
+		Help: "Number of triggers of a GitOpsConfig processed by the operator, by type and whether they were ignored",
+	}, []string{"namespace", "config", "type", "ignored"})
+	jobCompletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eunomia_job_completions_total",
+		Help: "Number of jobs of a GitOpsConfig that finished, by result, success or failure",
+	}, []string{"namespace", "config", "result"})
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "eunomia_job_duration_seconds",
+		Help: "Time between the start of the jobs of a GitOpsConfig and their completion, by result, success or failure",
+		// from 5 seconds to about 40 minutes
+		Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{"namespace", "config", "result"})
+	gitCloneFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eunomia_git_clone_failures_total",
+		Help: "Number of jobs of a GitOpsConfig that failed to clone its git sources",
+	}, []string{"namespace", "config"})
+	eventEmitFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eunomia_event_emit_failures_total",
+		Help: "Number of events the operator failed to record on an object, by reason of the event",
+	}, []string{"namespace", "name", "reason"})
+	configStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "eunomia_gitopsconfig_status",
+		Help: "Number of GitOpsConfigs by state, Synced, Failed, Suspended or Unknown until one of their jobs finishes",
+	}, []string{"state"})
+
+	// configStates is the state of each GitOpsConfig counted by configStatus
+	configStates = &configStateTracker{states: map[types.NamespacedName]string{}}
+)
+
+func init() {
+	// Register the metrics with the registry exposed by controller-runtime
+	metrics.Registry.MustRegister(
+		jobWatchRestarts,
+		resourcesPruned,
+		lastSyncDuration,
+		triggers,
+		jobCompletions,
+		jobDuration,
+		gitCloneFailures,
+		eventEmitFailures,
+		configStatus,
+	)
+	// the states without GitOpsConfig are reported too, as 0
+	for _, state := range []string{configStateSynced, configStateFailed, configStateSuspended, configStateUnknown} {
+		configStatus.WithLabelValues(state)
+	}
+}
+
+// RecordTrigger counts a trigger of instance, Change, Webhook, Periodic or Time, that was
+// processed by the operator. An ignored trigger didn't start a job.
+func RecordTrigger(instance *gitopsv1alpha1.GitOpsConfig, triggerType string, ignored bool) {
+	triggers.WithLabelValues(instance.GetNamespace(), instance.GetName(), triggerType, strconv.FormatBool(ignored)).Inc()
+}
+
+// recordJobCompletion counts a job of instance that finished with result, success or failure, along with its
+// JobSuccessful or JobFailed event, and observes its duration. The duration is skipped when the job lacks its start
+// or finish time.
+func recordJobCompletion(instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, result string) {
+	jobCompletions.WithLabelValues(instance.GetNamespace(), instance.GetName(), result).Inc()
+	finished, ok := jobFinishTime(job)
+	if !ok || job.Status.StartTime == nil {
+		return
+	}
+	jobDuration.WithLabelValues(instance.GetNamespace(), instance.GetName(), result).Observe(finished.Sub(job.Status.StartTime.Time).Seconds())
+}
+
+// recordChangeTrigger counts the run of instance started, or not, by Reconcile as a Change trigger. The runs requested
+// by a webhook, with a trigger context, are counted by the webhook handler.
+func recordChangeTrigger(instance *gitopsv1alpha1.GitOpsConfig, trigger *TriggerContext, ignored bool) {
+	if trigger == nil {
+		RecordTrigger(instance, "Change", ignored)
+	}
+}
+
+// configState returns the state of instance counted by eunomia_gitopsconfig_status. A suspended GitOpsConfig, by its
+// spec, its pause or the kill switch, is counted as Suspended whatever the result of its last job.
+func configState(instance *gitopsv1alpha1.GitOpsConfig) string {
+	if instance.Spec.Suspend || isConditionTrue(&instance.Status, gitopsv1alpha1.ConditionSuspended) {
+		return configStateSuspended
+	}
+	synced := getCondition(&instance.Status, gitopsv1alpha1.ConditionSynced)
+	switch {
+	case synced == nil:
+		return configStateUnknown
+	case synced.Status == corev1.ConditionTrue:
+		return configStateSynced
+	default:
+		return configStateFailed
+	}
+}
+
+// configStateTracker keeps the state of each GitOpsConfig, moving it between the states counted by configStatus as
+// its status changes
+type configStateTracker struct {
+	mu     sync.Mutex
+	states map[types.NamespacedName]string
+}
+
+// record counts instance in its current state, instead of the one it was previously counted in
+func (c *configStateTracker) record(instance *gitopsv1alpha1.GitOpsConfig) {
+	key := types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}
+	state := configState(instance)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous, ok := c.states[key]
+	if ok && previous == state {
+		return
+	}
+	if ok {
+		configStatus.WithLabelValues(previous).Dec()
+	}
+	configStatus.WithLabelValues(state).Inc()
+	c.states[key] = state
+}
+
+// forget stops counting the deleted GitOpsConfig named key
+func (c *configStateTracker) forget(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if previous, ok := c.states[key]; ok {
+		configStatus.WithLabelValues(previous).Dec()
+		delete(c.states, key)
+	}
+}
+
+// recordConfigStates updates eunomia_gitopsconfig_status with the GitOpsConfigs as they are created, their status
+// conditions change and they are deleted. Unlike the watch reconciling them, it sees the status updates of the
+// operator. Nothing is enqueued.
+func recordConfigStates() handler.EventHandler {
+	record := func(obj interface{}) {
+		if instance, ok := obj.(*gitopsv1alpha1.GitOpsConfig); ok {
+			configStates.record(instance)
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+			record(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			record(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			if e.Meta != nil {
+				configStates.forget(types.NamespacedName{Name: e.Meta.GetName(), Namespace: e.Meta.GetNamespace()})
+			}
+		},
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileTriggerMetrics(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	newInstance := func(annotations map[string]string) *gitopsv1alpha1.GitOpsConfig {
+		instance := gitops.DeepCopy()
+		instance.Annotations = map[string]string{initLabel: "true"}
+		for key, value := range annotations {
+			instance.Annotations[key] = value
+		}
+		instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}, {Type: "Webhook"}}
+		return instance
+	}
+	tests := []struct {
+		name        string
+		instance    *gitopsv1alpha1.GitOpsConfig
+		trigger     *TriggerContext
+		changed     float64
+		changedSkip float64
+	}{
+		{"change", newInstance(nil), nil, 1, 0},
+		{"ignored change", newInstance(map[string]string{runHandlingModeAnnotation: "Replace"}), nil, 0, 1},
+		// the webhook handler counts the runs it requests
+		{"webhook", newInstance(nil), &TriggerContext{Branch: "master", Repo: "KohlsTechnology/eunomia"}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ReconcileGitOpsConfig{client: fake.NewFakeClient(tt.instance), scheme: s, recorder: record.NewFakeRecorder(10)}
+			if tt.trigger != nil {
+				SetTriggerContext(nsn, *tt.trigger)
+			}
+			changed := testutil.ToFloat64(triggers.WithLabelValues(namespace, name, "Change", "false"))
+			changedSkip := testutil.ToFloat64(triggers.WithLabelValues(namespace, name, "Change", "true"))
+			webhook := testutil.ToFloat64(triggers.WithLabelValues(namespace, name, "Webhook", "false"))
+
+			_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+			assert.NoError(t, err)
+			assert.Equal(t, changed+tt.changed, testutil.ToFloat64(triggers.WithLabelValues(namespace, name, "Change", "false")))
+			assert.Equal(t, changedSkip+tt.changedSkip, testutil.ToFloat64(triggers.WithLabelValues(namespace, name, "Change", "true")))
+			assert.Equal(t, webhook, testutil.ToFloat64(triggers.WithLabelValues(namespace, name, "Webhook", "false")))
+		})
+	}
+}
+
+func TestJobCompletionEmitterTriggerMetrics(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	controller := true
+	cronjob := &batchv1beta1.CronJob{
+		TypeMeta: metav1.TypeMeta{APIVersion: "batch/v1beta1", Kind: "CronJob"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "gitopsconfig-gitops-operator",
+			Namespace:       namespace,
+			OwnerReferences: newOwnedJob(batchv1.JobStatus{}).OwnerReferences,
+		},
+	}
+	periodic := func(status batchv1.JobStatus) *batchv1.Job {
+		job := newOwnedJob(status)
+		job.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: cronjob.Name, Controller: &controller}}
+		return job
+	}
+	tests := []struct {
+		name     string
+		job      func(batchv1.JobStatus) *batchv1.Job
+		periodic float64
+	}{
+		{"run of the cronjob", periodic, 1},
+		// the runs started by the operator are counted when they are requested
+		{"run of the operator", newOwnedJob, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), cronjob.DeepCopy(), newTerminatedPod(`{"commitMessage":"Scale the frontend"}`))
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+			before := testutil.ToFloat64(triggers.WithLabelValues(namespace, name, "Periodic", "false"))
+
+			emitter.OnUpdate(tt.job(batchv1.JobStatus{Active: 1}), tt.job(batchv1.JobStatus{Succeeded: 1}))
+			assert.Equal(t, before+tt.periodic, testutil.ToFloat64(triggers.WithLabelValues(namespace, name, "Periodic", "false")))
+		})
+	}
+}
+
+func TestJobCompletionEmitterCompletionMetrics(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name    string
+		old     batchv1.JobStatus
+		new     batchv1.JobStatus
+		success float64
+		failure float64
+	}{
+		{"success", batchv1.JobStatus{Active: 1}, batchv1.JobStatus{Succeeded: 1}, 1, 0},
+		{"failure", batchv1.JobStatus{Active: 1}, batchv1.JobStatus{Failed: 1}, 0, 1},
+		{"still running", batchv1.JobStatus{}, batchv1.JobStatus{Active: 1}, 0, 0},
+		{"already finished", batchv1.JobStatus{Succeeded: 1}, batchv1.JobStatus{Succeeded: 1}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(`{"commitMessage":"Scale the frontend"}`))
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+			success := testutil.ToFloat64(jobCompletions.WithLabelValues(namespace, name, "success"))
+			failure := testutil.ToFloat64(jobCompletions.WithLabelValues(namespace, name, "failure"))
+
+			emitter.OnUpdate(newOwnedJob(tt.old), newOwnedJob(tt.new))
+			assert.Equal(t, success+tt.success, testutil.ToFloat64(jobCompletions.WithLabelValues(namespace, name, "success")))
+			assert.Equal(t, failure+tt.failure, testutil.ToFloat64(jobCompletions.WithLabelValues(namespace, name, "failure")))
+		})
+	}
+}
+
+// jobDurationSamples returns the count and sum of the jobDuration observations of the test GitOpsConfig with result
+func jobDurationSamples(t *testing.T, result string) (uint64, float64) {
+	families, err := metrics.Registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "eunomia_job_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["namespace"] == namespace && labels["config"] == name && labels["result"] == result {
+				return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	return 0, 0
+}
+
+func TestJobCompletionEmitterDurationMetrics(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	started := metav1.NewTime(time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC))
+	completed := metav1.NewTime(started.Add(90 * time.Second))
+	failed := []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: "True", LastTransitionTime: metav1.NewTime(started.Add(30 * time.Second))}}
+	tests := []struct {
+		name     string
+		status   batchv1.JobStatus
+		result   string
+		samples  uint64
+		duration float64
+	}{
+		{"success", batchv1.JobStatus{Succeeded: 1, StartTime: &started, CompletionTime: &completed}, "success", 1, 90},
+		// the failed jobs have no completion time, they are marked failed
+		{"failure", batchv1.JobStatus{Failed: 1, StartTime: &started, Conditions: failed}, "failure", 1, 30},
+		{"no start time", batchv1.JobStatus{Succeeded: 1, CompletionTime: &completed}, "success", 0, 0},
+		{"no completion time", batchv1.JobStatus{Succeeded: 1, StartTime: &started}, "success", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(`{"commitMessage":"Scale the frontend"}`))
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+			samples, sum := jobDurationSamples(t, tt.result)
+			completions := testutil.ToFloat64(jobCompletions.WithLabelValues(namespace, name, tt.result))
+
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(tt.status))
+			newSamples, newSum := jobDurationSamples(t, tt.result)
+			assert.Equal(t, samples+tt.samples, newSamples)
+			assert.Equal(t, sum+tt.duration, newSum)
+			// the completion is counted even when its duration is unknown
+			assert.Equal(t, completions+1, testutil.ToFloat64(jobCompletions.WithLabelValues(namespace, name, tt.result)))
+		})
+	}
+}
+
+func TestConfigStatusMetrics(t *testing.T) {
+	newInstance := func(name string, synced corev1.ConditionStatus) *gitopsv1alpha1.GitOpsConfig {
+		instance := gitops.DeepCopy()
+		instance.Name = name
+		if synced != "" {
+			instance.Status.Conditions = []gitopsv1alpha1.GitOpsConfigCondition{{Type: gitopsv1alpha1.ConditionSynced, Status: synced}}
+		}
+		return instance
+	}
+	states := []string{configStateSynced, configStateFailed, configStateSuspended, configStateUnknown}
+	before := map[string]float64{}
+	for _, state := range states {
+		before[state] = testutil.ToFloat64(configStatus.WithLabelValues(state))
+	}
+	assertCounts := func(t *testing.T, counts ...float64) {
+		for i, state := range states {
+			assert.Equal(t, before[state]+counts[i], testutil.ToFloat64(configStatus.WithLabelValues(state)), state)
+		}
+	}
+	handler := recordConfigStates()
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	synced := newInstance("synced", corev1.ConditionTrue)
+	failed := newInstance("failed", corev1.ConditionFalse)
+	created := newInstance("created", "")
+	for _, instance := range []*gitopsv1alpha1.GitOpsConfig{synced, failed, created} {
+		handler.Create(event.CreateEvent{Meta: instance, Object: instance}, q)
+	}
+	assertCounts(t, 1, 1, 0, 1)
+
+	// the first job of created fails
+	updated := newInstance("created", corev1.ConditionFalse)
+	handler.Update(event.UpdateEvent{MetaOld: created, ObjectOld: created, MetaNew: updated, ObjectNew: updated}, q)
+	assertCounts(t, 1, 2, 0, 0)
+
+	// a suspended GitOpsConfig is counted apart, whatever its last job
+	suspended := synced.DeepCopy()
+	suspended.Spec.Suspend = true
+	handler.Update(event.UpdateEvent{MetaOld: synced, ObjectOld: synced, MetaNew: suspended, ObjectNew: suspended}, q)
+	assertCounts(t, 0, 2, 1, 0)
+	killed := failed.DeepCopy()
+	killed.Status.Conditions = append(killed.Status.Conditions, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:   gitopsv1alpha1.ConditionSuspended,
+		Status: corev1.ConditionTrue,
+		Reason: "KillSwitchEngaged",
+	})
+	handler.Update(event.UpdateEvent{MetaOld: failed, ObjectOld: failed, MetaNew: killed, ObjectNew: killed}, q)
+	assertCounts(t, 0, 1, 2, 0)
+
+	// an update leaving the state alone isn't counted twice
+	handler.Update(event.UpdateEvent{MetaOld: killed, ObjectOld: killed, MetaNew: killed, ObjectNew: killed}, q)
+	assertCounts(t, 0, 1, 2, 0)
+
+	for _, instance := range []*gitopsv1alpha1.GitOpsConfig{suspended, killed, updated} {
+		handler.Delete(event.DeleteEvent{Meta: instance, Object: instance}, q)
+	}
+	assertCounts(t, 0, 0, 0, 0)
+	assert.Equal(t, 0, q.Len(), "the GitOpsConfigs aren't reconciled")
+}
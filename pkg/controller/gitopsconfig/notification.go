@@ -0,0 +1,170 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/notify"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// notificationURLKey is the key of the notification Secrets holding the URL of the webhook
+const notificationURLKey = "url"
+
+// notificationTimeout bounds the delivery of a notification, so that an unresponsive webhook doesn't hold it forever
+const notificationTimeout = 10 * time.Second
+
+// notificationClient posts the notifications
+var notificationClient = &http.Client{Timeout: notificationTimeout}
+
+// defaultNotification is the webhook notified of the failures of the GitOpsConfigs without notification, its Secret
+// being in defaultNotificationNamespace. Nil disables the notifications of these GitOpsConfigs.
+var defaultNotification *gitopsv1alpha1.Notification
+var defaultNotificationNamespace string
+
+// notificationLogsURL is the URL of the logs of the failed jobs, whose {namespace} and {job} are replaced by the
+// namespace and the name of the job. Empty makes the notifications tell the kubectl command reading them.
+var notificationLogsURL string
+
+// SetDefaultNotification configures the webhook notified when a job fails, for the GitOpsConfigs that don't set their
+// own notification: its URL is in the url key of the Secret secret, and the messages have format. An empty secret name
+// disables it.
+func SetDefaultNotification(secret types.NamespacedName, format string) error {
+	if secret.Name == "" {
+		defaultNotification = nil
+		return nil
+	}
+	if _, err := notify.NewFormatter(format); err != nil {
+		return err
+	}
+	defaultNotification = &gitopsv1alpha1.Notification{SecretRef: secret.Name, Format: format}
+	defaultNotificationNamespace = secret.Namespace
+	return nil
+}
+
+// SetNotificationLogsURL configures the link to the logs of the failed jobs in the notifications, e.g. the URL of a
+// log search, where {namespace} and {job} are replaced by the namespace and the name of the job
+func SetNotificationLogsURL(url string) {
+	notificationLogsURL = url
+}
+
+// validateNotification verifies the notification of spec, if any
+func validateNotification(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.Notification == nil {
+		return nil
+	}
+	if spec.Notification.SecretRef == "" {
+		return errors.New("notification secretRef cannot be empty")
+	}
+	_, err := notify.NewFormatter(notificationFormat(spec.Notification))
+	return err
+}
+
+// notificationFormat returns the format of the messages of notification, Slack by default
+func notificationFormat(notification *gitopsv1alpha1.Notification) string {
+	if notification.Format == "" {
+		return "Slack"
+	}
+	return notification.Format
+}
+
+// notificationTarget returns the webhook notified of the failures of owner, and the namespace of its Secret, nil if
+// none is. instance is the GitOpsConfig, nil when it couldn't be read.
+func notificationTarget(owner, instance *gitopsv1alpha1.GitOpsConfig) (*gitopsv1alpha1.Notification, string) {
+	if instance != nil && instance.Spec.Notification != nil {
+		return instance.Spec.Notification, owner.GetNamespace()
+	}
+	return defaultNotification, defaultNotificationNamespace
+}
+
+// jobLogs returns where the logs of job can be read
+func jobLogs(job *batchv1.Job) string {
+	if notificationLogsURL == "" {
+		return fmt.Sprintf("kubectl logs -n %s job/%s", job.GetNamespace(), job.GetName())
+	}
+	return strings.NewReplacer("{namespace}", job.GetNamespace(), "{job}", job.GetName()).Replace(notificationLogsURL)
+}
+
+// describeFailure returns why job failed, as far as known from its condition and the termination message of its pod
+func describeFailure(job *batchv1.Job, terminationMessage string) string {
+	description := "Job failed"
+	if reason := jobFailedReason(job); reason != "" {
+		description += ": " + reason
+	}
+	if phase := failurePhase(terminationMessage); phase != "" {
+		description += " in the " + phase + " phase"
+	}
+	return description
+}
+
+// notifyFailure notifies the webhook of owner that job failed, in the background so that a slow webhook doesn't delay
+// the reports of the other jobs. instance is the GitOpsConfig, nil when it couldn't be read. A notification that can't
+// be delivered is reported with a NotificationFailed event.
+func (j *jobCompletionEmitter) notifyFailure(owner, instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, terminationMessage string) {
+	target, namespace := notificationTarget(owner, instance)
+	if target == nil {
+		return
+	}
+	notification := notify.Notification{
+		Time:      time.Now(),
+		Namespace: owner.GetNamespace(),
+		Config:    owner.GetName(),
+		Job:       job.GetName(),
+		Message:   describeFailure(job, terminationMessage),
+		Logs:      jobLogs(job),
+	}
+	go func() {
+		err := j.sendNotification(target, namespace, notification)
+		if err != nil {
+			log.Error(err, "unable to send the failure notification", "job", job.GetName())
+			j.recorder.AnnotatedEventf(owner,
+				map[string]string{"job": job.GetName()},
+				"Warning", "NotificationFailed", "Unable to notify the failure of job %s: %v", job.GetName(), err)
+		}
+	}()
+}
+
+// sendNotification posts notification to the webhook of target, whose Secret is in namespace
+func (j *jobCompletionEmitter) sendNotification(target *gitopsv1alpha1.Notification, namespace string, notification notify.Notification) error {
+	formatter, err := notify.NewFormatter(notificationFormat(target))
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{}
+	reader := j.secretReader
+	if reader == nil {
+		reader = j.client
+	}
+	err = reader.Get(context.TODO(), types.NamespacedName{Name: target.SecretRef, Namespace: namespace}, secret)
+	if err != nil {
+		return fmt.Errorf("unable to read the notification secret %s of namespace %s: %v", target.SecretRef, namespace, err)
+	}
+	url := strings.TrimSpace(string(secret.Data[notificationURLKey]))
+	if url == "" {
+		return fmt.Errorf("notification secret %s of namespace %s has no %s", target.SecretRef, namespace, notificationURLKey)
+	}
+	return notify.Send(notificationClient, url, formatter, notification)
+}
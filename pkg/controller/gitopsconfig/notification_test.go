@@ -0,0 +1,226 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/notify"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newWebhookServer returns a server standing for a chat webhook, sending the bodies it receives to the returned channel
+func newWebhookServer() (*httptest.Server, chan []byte) {
+	received := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- body
+	}))
+	return server, received
+}
+
+// newWebhookSecret returns the Secret of namespace holding the URL of a notification webhook
+func newWebhookSecret(namespace, url string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "alerts", Namespace: namespace},
+		Data:       map[string][]byte{"url": []byte(url + "\n")},
+	}
+}
+
+// failedJob returns the job of newOwnedJob having exhausted its backoffLimit
+func failedJob() *batchv1.Job {
+	return newOwnedJob(batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{
+		{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"},
+	}})
+}
+
+func TestValidateNotification(t *testing.T) {
+	tests := []struct {
+		name         string
+		notification *gitopsv1alpha1.Notification
+		err          string
+	}{
+		{"unset", nil, ""},
+		{"default format", &gitopsv1alpha1.Notification{SecretRef: "alerts"}, ""},
+		{"teams", &gitopsv1alpha1.Notification{SecretRef: "alerts", Format: "Teams"}, ""},
+		{"missing secret", &gitopsv1alpha1.Notification{Format: "Slack"}, "notification secretRef cannot be empty"},
+		{"unknown format", &gitopsv1alpha1.Notification{SecretRef: "alerts", Format: "Email"}, `notification format "Email" is not one of Slack, Teams, Generic`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNotification(gitopsv1alpha1.GitOpsConfigSpec{Notification: tt.notification})
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestJobLogs(t *testing.T) {
+	job := failedJob()
+	assert.Equal(t, "kubectl logs -n gitops job/gitopsconfig-gitops-operator-abcde", jobLogs(job))
+	defer SetNotificationLogsURL("")
+	SetNotificationLogsURL("https://logs.example.com/?query=namespace:{namespace}+job:{job}")
+	assert.Equal(t, "https://logs.example.com/?query=namespace:gitops+job:gitopsconfig-gitops-operator-abcde", jobLogs(job))
+}
+
+func TestDescribeFailure(t *testing.T) {
+	assert.Equal(t, "Job failed: BackoffLimitExceeded", describeFailure(failedJob(), ""))
+	assert.Equal(t, "Job failed: BackoffLimitExceeded in the Apply phase", describeFailure(failedJob(), "error: unable to apply\neunomia-phase: Apply"))
+	assert.Equal(t, "Job failed", describeFailure(newOwnedJob(batchv1.JobStatus{Failed: 1}), ""))
+}
+
+func TestJobCompletionEmitterNotification(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	server, received := newWebhookServer()
+	defer server.Close()
+	now := time.Now()
+	maintenance := []gitopsv1alpha1.MaintenanceWindow{{Start: metav1.NewTime(now.Add(-time.Hour)), End: metav1.NewTime(now.Add(time.Hour))}}
+	tests := []struct {
+		name         string
+		notification *gitopsv1alpha1.Notification
+		operator     bool
+		maintenance  []gitopsv1alpha1.MaintenanceWindow
+		payload      string
+	}{
+		{
+			name:         "slack",
+			notification: &gitopsv1alpha1.Notification{SecretRef: "alerts"},
+			payload: "GitOpsConfig gitops/gitops-operator failed to sync, job gitopsconfig-gitops-operator-abcde: " +
+				"Job failed: BackoffLimitExceeded\nLogs: kubectl logs -n gitops job/gitopsconfig-gitops-operator-abcde",
+		},
+		{
+			name:     "operator default",
+			operator: true,
+			payload:  "Job failed: BackoffLimitExceeded",
+		},
+		{
+			name:         "maintenance window",
+			notification: &gitopsv1alpha1.Notification{SecretRef: "alerts"},
+			maintenance:  maintenance,
+		},
+		{
+			name: "disabled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.operator {
+				assert.NoError(t, SetDefaultNotification(types.NamespacedName{Namespace: "eunomia-operator", Name: "alerts"}, "Generic"))
+				defer SetDefaultNotification(types.NamespacedName{}, "")
+			}
+			instance := gitops.DeepCopy()
+			instance.Spec.Notification = tt.notification
+			instance.Spec.MaintenanceWindows = tt.maintenance
+			objects := []runtime.Object{instance, newWebhookSecret(namespace, server.URL), newWebhookSecret("eunomia-operator", server.URL)}
+			emitter := &jobCompletionEmitter{
+				client:   fake.NewFakeClient(objects...),
+				scheme:   s,
+				recorder: record.NewFakeRecorder(10),
+			}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), failedJob())
+
+			if tt.payload == "" {
+				select {
+				case body := <-received:
+					t.Fatalf("unexpected notification %s", body)
+				case <-time.After(200 * time.Millisecond):
+				}
+				return
+			}
+			select {
+			case body := <-received:
+				if tt.operator {
+					notification := notify.Notification{}
+					assert.NoError(t, json.Unmarshal(body, &notification))
+					assert.Equal(t, name, notification.Config)
+					assert.Equal(t, namespace, notification.Namespace)
+					assert.Equal(t, "gitopsconfig-gitops-operator-abcde", notification.Job)
+					assert.Equal(t, tt.payload, notification.Message)
+				} else {
+					message := map[string]string{}
+					assert.NoError(t, json.Unmarshal(body, &message))
+					assert.Equal(t, tt.payload, message["text"])
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no notification sent")
+			}
+		})
+	}
+}
+
+func TestJobCompletionEmitterNotificationFailed(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		event   string
+	}{
+		{"missing secret", nil, "unable to read the notification secret alerts of namespace gitops"},
+		{"webhook error", []runtime.Object{newWebhookSecret(namespace, server.URL)}, "notification webhook responded with 403 Forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Spec.Notification = &gitopsv1alpha1.Notification{SecretRef: "alerts"}
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{
+				client:   fake.NewFakeClient(append(tt.objects, instance)...),
+				scheme:   s,
+				recorder: recorder,
+			}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), failedJob())
+
+			deadline := time.After(5 * time.Second)
+			for {
+				select {
+				case event := <-recorder.Events:
+					if strings.Contains(event, "NotificationFailed") {
+						assert.Contains(t, event, tt.event)
+						assert.NotContains(t, event, server.URL)
+						return
+					}
+				case <-deadline:
+					t.Fatal("no NotificationFailed event")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// conflictPattern matches the lines printed by the template processor of a failed job, before its phase, for every
+// resource applied by another GitOpsConfig, e.g. eunomia-conflict: deployment/web team-b/web
+var conflictPattern = regexp.MustCompile(`(?m)^eunomia-conflict: (\S+ \S+)$`)
+
+// parseOwnershipConflicts returns the resources applied by other GitOpsConfigs found by a failed job, printed in its
+// termination message, in the format of the report of the successful jobs
+func parseOwnershipConflicts(message string) []string {
+	conflicts := []string{}
+	for _, match := range conflictPattern.FindAllStringSubmatch(message, -1) {
+		conflicts = append(conflicts, match[1])
+	}
+	return conflicts
+}
+
+// describeOwnershipConflicts describes the resources applied by other GitOpsConfigs, listed as
+// <kind>/<name> <namespace>/<gitopsconfig>, e.g. deployment/web (team-b/web)
+func describeOwnershipConflicts(conflicts []string) string {
+	descriptions := []string{}
+	for _, conflict := range conflicts {
+		fields := strings.Fields(conflict)
+		if len(fields) != 2 {
+			continue
+		}
+		descriptions = append(descriptions, fields[0]+" ("+fields[1]+")")
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// recordOwnershipConflicts reports the resources job found applied by other GitOpsConfigs with an OwnershipConflict
+// event, so that two GitOpsConfigs overwriting each other's resources on every run don't go unnoticed
+func (j *jobCompletionEmitter) recordOwnershipConflicts(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, eventType string, conflicts []string) {
+	description := describeOwnershipConflicts(conflicts)
+	if description == "" {
+		return
+	}
+	j.recorder.AnnotatedEventf(owner,
+		map[string]string{"job": job.Name},
+		eventType, reasonOwnershipConflict, "%s", fmt.Sprintf("Job %s found resources managed by other GitOpsConfigs: %s", job.Name, description))
+}
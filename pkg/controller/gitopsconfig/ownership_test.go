@@ -0,0 +1,70 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseOwnershipConflicts(t *testing.T) {
+	message := "Refusing to apply resources managed by other GitOpsConfigs\n" +
+		"eunomia-conflict: deployment/web team-b/web\neunomia-conflict: configmap/settings team-a/app\neunomia-phase: Apply\n"
+	conflicts := parseOwnershipConflicts(message)
+	assert.Equal(t, []string{"deployment/web team-b/web", "configmap/settings team-a/app"}, conflicts)
+	assert.Equal(t, "deployment/web (team-b/web), configmap/settings (team-a/app)", describeOwnershipConflicts(conflicts))
+	assert.Empty(t, parseOwnershipConflicts("error: unable to apply\neunomia-phase: Apply\n"))
+	assert.Equal(t, "", describeOwnershipConflicts([]string{"deployment/web"}))
+}
+
+func TestJobCompletionEmitterOwnershipConflict(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name    string
+		message string
+		status  batchv1.JobStatus
+	}{
+		{"applied anyway", `{"commitMessage":"Scale the web","ownershipConflicts":["deployment/web team-b/web"]}`, batchv1.JobStatus{Succeeded: 1}},
+		{"refused", "Refusing to apply resources managed by other GitOpsConfigs\neunomia-conflict: deployment/web team-b/web\neunomia-phase: Apply\n", batchv1.JobStatus{Failed: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(tt.message))
+			recorder := record.NewFakeRecorder(20)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(tt.status))
+			conflicts := []string{}
+			for _, event := range drainEvents(recorder) {
+				if strings.HasPrefix(event, "Warning OwnershipConflict") {
+					conflicts = append(conflicts, event)
+				}
+			}
+			if assert.Len(t, conflicts, 1) {
+				assert.Contains(t, conflicts[0], "managed by other GitOpsConfigs: deployment/web (team-b/web)")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	parameterFileAnnotation string = "gitopsconfig.eunomia.kohls.io/parameter-file"
+	commitAnnotation        string = "gitopsconfig.eunomia.kohls.io/commit"
+)
+
+// TriggerContext holds the data of the webhook payload that triggered a run
+type TriggerContext struct {
+	// Branch is the pushed branch, empty for pushes of tags
+	Branch string
+	// Ref is the pushed ref, e.g. refs/heads/master, deployed by the sources whose ref is a pattern
+	Ref string
+	// Repo is the full name of the pushed repository, e.g. KohlsTechnology/eunomia
+	Repo string
+	// Commit is the hash of the pushed head commit, used in the names of the jobs
+	Commit string
+	// Deleted is true when the push deleted Branch
+	Deleted bool
+	// TraceParent is the W3C traceparent of the span of the webhook call, empty when tracing is disabled
+	TraceParent string
+}
+
+var (
+	triggerContextsLock sync.Mutex
+	triggerContexts     = map[types.NamespacedName]TriggerContext{}
+)
+
+// SetTriggerContext records the context of the webhook call triggering the next run of
+// the named GitOpsConfig. It must be called before sending the event to PushEvents.
+func SetTriggerContext(name types.NamespacedName, trigger TriggerContext) {
+	triggerContextsLock.Lock()
+	defer triggerContextsLock.Unlock()
+	triggerContexts[name] = trigger
+}
+
+// takeTriggerContext returns and forgets the context of the webhook call that triggered
+// the run of the named GitOpsConfig, or nil if it wasn't triggered by a webhook call
+func takeTriggerContext(name types.NamespacedName) *TriggerContext {
+	triggerContextsLock.Lock()
+	defer triggerContextsLock.Unlock()
+	trigger, ok := triggerContexts[name]
+	if !ok {
+		return nil
+	}
+	delete(triggerContexts, name)
+	return &trigger
+}
+
+// resolveParameterFile returns the parameter file of instance, its fileName
+// template being executed with the fields of trigger. It fails if the template
+// uses a field that trigger doesn't have, e.g. the branch of a run that wasn't
+// triggered by a push on a branch.
+func resolveParameterFile(instance *gitopsv1alpha1.GitOpsConfig, trigger *TriggerContext) (string, error) {
+	fileName := instance.Spec.ParameterSource.FileName
+	if fileName == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("fileName").Option("missingkey=error").Parse(fileName)
+	if err != nil {
+		return "", fmt.Errorf("parameter source fileName %q is not a valid template: %v", fileName, err)
+	}
+	data := map[string]string{}
+	if trigger != nil {
+		if trigger.Branch != "" {
+			data["Branch"] = trigger.Branch
+		}
+		if trigger.Repo != "" {
+			data["Repo"] = trigger.Repo
+		}
+	}
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, data)
+	if err != nil {
+		return "", fmt.Errorf("parameter source fileName %q cannot be resolved: %v", fileName, err)
+	}
+	resolved := b.String()
+	clean := path.Clean(resolved)
+	if resolved == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.ContainsAny(resolved, "\"\n") {
+		return "", fmt.Errorf("parameter source fileName %q resolves to %q, which is not a file within the context directory", fileName, resolved)
+	}
+	return clean, nil
+}
+
+// DependsOnBranch returns true if the parameter file of instance is selected by the pushed branch,
+// i.e. if instance deploys an environment for every branch
+func DependsOnBranch(instance *gitopsv1alpha1.GitOpsConfig) bool {
+	return strings.Contains(instance.Spec.ParameterSource.FileName, ".Branch")
+}
+
+// recordParameterFile stores in the status of instance the parameter file used by its last run
+func (r *ReconcileGitOpsConfig) recordParameterFile(instance *gitopsv1alpha1.GitOpsConfig, parameterFile string) error {
+	if instance.Status.ParameterFile == parameterFile {
+		return nil
+	}
+	instance.Status.ParameterFile = parameterFile
+	err := r.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to record the parameter file of the GitOpsConfig", "instance", instance.GetName())
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestResolveParameterFile(t *testing.T) {
+	push := &TriggerContext{Branch: "feature-x", Repo: "KohlsTechnology/eunomia"}
+	tests := []struct {
+		name     string
+		fileName string
+		trigger  *TriggerContext
+		expected string
+		fails    bool
+	}{
+		{"no fileName", "", push, "", false},
+		{"static", "params/prod.yaml", nil, "params/prod.yaml", false},
+		{"branch", "params/{{ .Branch }}.yaml", push, "params/feature-x.yaml", false},
+		{"repo", "{{ .Repo }}/values.yaml", push, "KohlsTechnology/eunomia/values.yaml", false},
+		{"no trigger", "params/{{ .Branch }}.yaml", nil, "", true},
+		{"tag push", "params/{{ .Branch }}.yaml", &TriggerContext{Repo: "KohlsTechnology/eunomia"}, "", true},
+		{"unknown field", "params/{{ .Author }}.yaml", push, "", true},
+		{"invalid template", "params/{{ .Branch }.yaml", push, "", true},
+		{"outside context dir", "../{{ .Branch }}.yaml", push, "", true},
+		{"absolute", "/etc/{{ .Branch }}", push, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Spec.ParameterSource.FileName = tt.fileName
+			resolved, err := resolveParameterFile(instance, tt.trigger)
+			if tt.fails {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, resolved)
+		})
+	}
+}
+
+func TestParameterFileFromWebhook(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	newInstance := func() *gitopsv1alpha1.GitOpsConfig {
+		instance := gitops.DeepCopy()
+		instance.Annotations = map[string]string{initLabel: "true"}
+		instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook"}}
+		instance.Spec.ParameterSource.FileName = "params/{{ .Branch }}.yaml"
+		return instance
+	}
+
+	t.Run("push on a branch", func(t *testing.T) {
+		cl := fake.NewFakeClient(newInstance())
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+		SetTriggerContext(nsn, TriggerContext{Branch: "X", Repo: "KohlsTechnology/eunomia", Commit: "0123456789abcdef"})
+
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		if assert.Len(t, jobs.Items, 1) {
+			job := jobs.Items[0]
+			assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "PARAMETER_FILE", Value: "params/X.yaml"})
+			assert.Equal(t, "params/X.yaml", job.Annotations[parameterFileAnnotation])
+			// the job is named after the pushed commit
+			assert.Regexp(t, "^gitopsconfig-"+name+"-0123456-[a-z0-9]{6}$", job.Name)
+			assert.Equal(t, "0123456789abcdef", job.Annotations[commitAnnotation])
+		}
+		instance := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+		assert.Equal(t, "params/X.yaml", instance.Status.ParameterFile)
+		// the context only applies to the run it triggered
+		assert.Nil(t, takeTriggerContext(nsn))
+	})
+
+	t.Run("missing resolution", func(t *testing.T) {
+		cl := fake.NewFakeClient(newInstance())
+		recorder := record.NewFakeRecorder(10)
+		r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+		SetTriggerContext(nsn, TriggerContext{Repo: "KohlsTechnology/eunomia"})
+
+		_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+		assert.NoError(t, err)
+
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		assert.Empty(t, jobs.Items)
+		assert.Contains(t, <-recorder.Events, "Warning ParameterFileUnresolved")
+	})
+}
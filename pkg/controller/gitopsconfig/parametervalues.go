@@ -0,0 +1,191 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// vaultPathPattern matches the paths of the Vault mounts and secrets, e.g. my-app/prod
+var vaultPathPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+
+// validateValuesFrom verifies the references to the ConfigMaps, Secrets and Vault secrets whose values are merged
+// into the parameters. Only the parameter source can have them.
+func validateValuesFrom(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if len(spec.TemplateSource.ValuesFrom) > 0 {
+		return fmt.Errorf("template source can't have valuesFrom, only the parameter source can")
+	}
+	switch spec.ParameterSource.ValuesPrecedence {
+	case "", "Git", "ValuesFrom":
+	default:
+		return fmt.Errorf("parameter source valuesPrecedence %q is not one of Git, ValuesFrom", spec.ParameterSource.ValuesPrecedence)
+	}
+	for _, values := range spec.ParameterSource.ValuesFrom {
+		if values.Kind == "Vault" {
+			if err := validateVaultValues(values); err != nil {
+				return err
+			}
+			continue
+		}
+		if values.Kind != "ConfigMap" && values.Kind != "Secret" {
+			return fmt.Errorf("parameter source valuesFrom kind %q is not one of ConfigMap, Secret, Vault", values.Kind)
+		}
+		if values.Vault != nil {
+			return fmt.Errorf("parameter source valuesFrom %s %s can't have vault", values.Kind, values.Name)
+		}
+		if errs := validation.IsDNS1123Subdomain(values.Name); len(errs) > 0 {
+			return fmt.Errorf("parameter source valuesFrom name %q is not a valid %s name: %s", values.Name, values.Kind, strings.Join(errs, ", "))
+		}
+		if values.Key == "" {
+			continue
+		}
+		if errs := validation.IsConfigMapKey(values.Key); len(errs) > 0 {
+			return fmt.Errorf("parameter source valuesFrom key %q is not a valid %s key: %s", values.Key, values.Kind, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// validateVaultValues verifies the reference to a Vault secret whose values are merged into the parameters
+func validateVaultValues(values gitopsv1alpha1.ValuesReference) error {
+	vault := values.Vault
+	if vault == nil {
+		return fmt.Errorf("parameter source valuesFrom of kind Vault must have vault")
+	}
+	address, err := url.Parse(vault.Address)
+	if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return fmt.Errorf("parameter source valuesFrom vault address %q is not an http(s) URL", vault.Address)
+	}
+	if vault.Role == "" {
+		return fmt.Errorf("parameter source valuesFrom vault role is required")
+	}
+	paths := []struct {
+		field    string
+		path     string
+		required bool
+	}{
+		{"authMount", vault.AuthMount, false},
+		{"mount", vault.Mount, false},
+		{"path", vault.Path, true},
+	}
+	for _, p := range paths {
+		path := strings.Trim(p.path, "/")
+		if path == "" && !p.required {
+			continue
+		}
+		if !vaultPathPattern.MatchString(path) || strings.Contains("/"+path+"/", "/../") {
+			return fmt.Errorf("parameter source valuesFrom vault %s %q is not a valid Vault path", p.field, p.path)
+		}
+	}
+	if vault.KVVersion != 0 && vault.KVVersion != 1 && vault.KVVersion != 2 {
+		return fmt.Errorf("parameter source valuesFrom vault kvVersion %d is not one of 1, 2", vault.KVVersion)
+	}
+	if values.Key != "" && strings.ContainsAny(values.Key, "\"\\") {
+		return fmt.Errorf("parameter source valuesFrom key %q is not a valid Vault key", values.Key)
+	}
+	return nil
+}
+
+// missingValues returns the kind and name of the first ConfigMap or Secret of the valuesFrom of instance that
+// doesn't exist or lacks the referenced key, or an empty string if they all exist
+func missingValues(reader client.Reader, namespace string, instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	for _, values := range instance.Spec.ParameterSource.ValuesFrom {
+		if values.Kind == "Vault" {
+			// the Vault secrets are read by the jobs, their failures fail the runs
+			continue
+		}
+		key := types.NamespacedName{Name: values.Name, Namespace: namespace}
+		var keys []string
+		if values.Kind == "Secret" {
+			secret := &corev1.Secret{}
+			missing, err := isMissing(reader, key, secret)
+			if missing || err != nil {
+				return "Secret " + values.Name, err
+			}
+			for k := range secret.Data {
+				keys = append(keys, k)
+			}
+		} else {
+			configMap := &corev1.ConfigMap{}
+			missing, err := isMissing(reader, key, configMap)
+			if missing || err != nil {
+				return "ConfigMap " + values.Name, err
+			}
+			for k := range configMap.Data {
+				keys = append(keys, k)
+			}
+			for k := range configMap.BinaryData {
+				keys = append(keys, k)
+			}
+		}
+		if values.Key != "" && !containsString(keys, values.Key) {
+			return fmt.Sprintf("Key %s of %s %s", values.Key, values.Kind, values.Name), nil
+		}
+	}
+	return "", nil
+}
+
+// validateParameterValues fails the reconciliation of instance, recording the MissingParameterValues condition, while
+// a ConfigMap or Secret of its valuesFrom is missing. They aren't watched, the failed reconcile is retried until they exist.
+func (r *ReconcileGitOpsConfig) validateParameterValues(instance *gitopsv1alpha1.GitOpsConfig) error {
+	missing, err := missingValues(r.jobProfileReader(), util.JobNamespace(*instance), instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the parameter values of the GitOpsConfig", "instance", instance.GetName())
+		return err
+	}
+	if missing == "" {
+		if !isConditionTrue(&instance.Status, gitopsv1alpha1.ConditionMissingParameterValues) {
+			return nil
+		}
+		setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionMissingParameterValues,
+			Status:  corev1.ConditionFalse,
+			Reason:  "ParameterValuesFound",
+			Message: "All the ConfigMaps and Secrets of valuesFrom exist",
+		})
+		if err = r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return err
+		}
+		return nil
+	}
+	changed := setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionMissingParameterValues,
+		Status:  corev1.ConditionTrue,
+		Reason:  "ParameterValuesNotFound",
+		Message: fmt.Sprintf("%s doesn't exist", missing),
+	})
+	if changed {
+		if err = r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return err
+		}
+		r.recorder.Eventf(instance, "Warning", "ParameterValuesNotFound", "Runs not started: %s doesn't exist", missing)
+	}
+	return fmt.Errorf("missing parameter values: %s doesn't exist", missing)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestValidateValuesFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   gitopsv1alpha1.GitOpsConfigSpec
+		errMsg string
+	}{
+		{"none", gitopsv1alpha1.GitOpsConfigSpec{}, ""},
+		{"configmap and secret key", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom:       []gitopsv1alpha1.ValuesReference{{Kind: "ConfigMap", Name: "env-values"}, {Kind: "Secret", Name: "db", Key: "values.yaml"}},
+			ValuesPrecedence: "ValuesFrom",
+		}}, ""},
+		{"template source", gitopsv1alpha1.GitOpsConfigSpec{TemplateSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "ConfigMap", Name: "env-values"}},
+		}}, "template source can't have valuesFrom, only the parameter source can"},
+		{"kind", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "Deployment", Name: "env-values"}},
+		}}, `parameter source valuesFrom kind "Deployment" is not one of ConfigMap, Secret, Vault`},
+		{"vault", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "Vault", Key: "values", Vault: &gitopsv1alpha1.VaultValues{Address: "https://vault.example.com:8200", Role: "web", Path: "teams/web/prod", KVVersion: 1}}},
+		}}, ""},
+		{"vault missing", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "Vault"}},
+		}}, "parameter source valuesFrom of kind Vault must have vault"},
+		{"vault address", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "Vault", Vault: &gitopsv1alpha1.VaultValues{Address: "vault:8200", Role: "web", Path: "web"}}},
+		}}, `parameter source valuesFrom vault address "vault:8200" is not an http(s) URL`},
+		{"vault role", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "Vault", Vault: &gitopsv1alpha1.VaultValues{Address: "https://vault", Path: "web"}}},
+		}}, "parameter source valuesFrom vault role is required"},
+		{"vault path", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "Vault", Vault: &gitopsv1alpha1.VaultValues{Address: "https://vault", Role: "web", Path: "web/../ops"}}},
+		}}, `parameter source valuesFrom vault path "web/../ops" is not a valid Vault path`},
+		{"vault mount", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "Vault", Vault: &gitopsv1alpha1.VaultValues{Address: "https://vault", Role: "web", Mount: "kv store", Path: "web"}}},
+		}}, `parameter source valuesFrom vault mount "kv store" is not a valid Vault path`},
+		{"vault on a ConfigMap", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "ConfigMap", Name: "env-values", Vault: &gitopsv1alpha1.VaultValues{Address: "https://vault", Role: "web", Path: "web"}}},
+		}}, "vault"},
+		{"name", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "ConfigMap", Name: "Env_Values"}},
+		}}, `parameter source valuesFrom name "Env_Values" is not a valid ConfigMap name`},
+		{"key", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{
+			ValuesFrom: []gitopsv1alpha1.ValuesReference{{Kind: "Secret", Name: "db", Key: "../values.yaml"}},
+		}}, `parameter source valuesFrom key "../values.yaml" is not a valid Secret key`},
+		{"precedence", gitopsv1alpha1.GitOpsConfigSpec{ParameterSource: gitopsv1alpha1.GitConfig{ValuesPrecedence: "Cluster"}},
+			`parameter source valuesPrecedence "Cluster" is not one of Git, ValuesFrom`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateValuesFrom(tt.spec)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestParameterValues(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.TemplateSource.SecretRef = ""
+	instance.Spec.ParameterSource.SecretRef = ""
+	instance.Spec.ParameterSource.ValuesFrom = []gitopsv1alpha1.ValuesReference{
+		{Kind: "ConfigMap", Name: "env-values"},
+		{Kind: "Secret", Name: "db", Key: "values.yaml"},
+		{Kind: "Vault", Vault: &gitopsv1alpha1.VaultValues{Address: "https://vault.example.com/", Role: "web", Path: "/web/prod"}},
+	}
+	instance.Spec.ParameterSource.ValuesPrecedence = "ValuesFrom"
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	missingCondition := func() *gitopsv1alpha1.GitOpsConfigCondition {
+		updated := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+		return getCondition(&updated.Status, gitopsv1alpha1.ConditionMissingParameterValues)
+	}
+	jobCount := func() int {
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		return len(jobs.Items)
+	}
+
+	// the ConfigMap doesn't exist, the reconcile fails
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.EqualError(t, err, "missing parameter values: ConfigMap env-values doesn't exist")
+	assert.Contains(t, <-recorder.Events, "Warning ParameterValuesNotFound Runs not started: ConfigMap env-values doesn't exist")
+	if condition := missingCondition(); assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	}
+	assert.Zero(t, jobCount())
+
+	// the Secret lacks the referenced key
+	assert.NoError(t, cl.Create(context.TODO(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "env-values", Namespace: namespace}, Data: map[string]string{"values.yaml": "replicas: 3\n"}}))
+	assert.NoError(t, cl.Create(context.TODO(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: namespace}, Data: map[string][]byte{"password": []byte("s3cret")}}))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.EqualError(t, err, "missing parameter values: Key values.yaml of Secret db doesn't exist")
+	assert.Zero(t, jobCount())
+
+	// once it exists, the values are mounted in the job
+	secret := &corev1.Secret{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "db", Namespace: namespace}, secret))
+	secret.Data["values.yaml"] = []byte("password: s3cret\n")
+	assert.NoError(t, cl.Update(context.TODO(), secret))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	if condition := missingCondition(); assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	}
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	pod := jobs.Items[0].Spec.Template.Spec
+	env := map[string]string{}
+	for _, e := range pod.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, "/parameter-values", env["PARAMETER_VALUES_DIR"])
+	assert.Equal(t, "ValuesFrom", env["PARAMETER_VALUES_PRECEDENCE"])
+	assert.JSONEq(t, `[{"index":2,"address":"https://vault.example.com","role":"web","authMount":"kubernetes","mount":"secret","path":"web/prod","kvVersion":2}]`, env["PARAMETER_VALUES_VAULT"])
+	volumes := map[string]corev1.Volume{}
+	for _, volume := range pod.Volumes {
+		volumes[volume.Name] = volume
+	}
+	if assert.NotNil(t, volumes["parameter-values-0"].ConfigMap) {
+		assert.Equal(t, "env-values", volumes["parameter-values-0"].ConfigMap.Name)
+		assert.Empty(t, volumes["parameter-values-0"].ConfigMap.Items)
+	}
+	if assert.NotNil(t, volumes["parameter-values-1"].Secret) {
+		assert.Equal(t, "db", volumes["parameter-values-1"].Secret.SecretName)
+		assert.Equal(t, []corev1.KeyToPath{{Key: "values.yaml", Path: "values.yaml"}}, volumes["parameter-values-1"].Secret.Items)
+	}
+	mounts := map[string]string{}
+	for _, mount := range pod.Containers[0].VolumeMounts {
+		mounts[mount.Name] = mount.MountPath
+	}
+	assert.Equal(t, "/parameter-values/0", mounts["parameter-values-0"])
+	assert.Equal(t, "/parameter-values/1", mounts["parameter-values-1"])
+	// the Vault secret is read by the job, it isn't mounted
+	assert.NotContains(t, volumes, "parameter-values-2")
+	assert.NotContains(t, mounts, "parameter-values-2")
+}
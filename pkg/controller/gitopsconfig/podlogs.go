@@ -0,0 +1,160 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// failedPodLogLines is the number of lines of the logs of a failed pod that are read
+	failedPodLogLines int64 = 50
+	// maxLastErrorMessageLength is the size the logs stored in status.lastErrorMessage are truncated to, so that
+	// the failures don't bloat etcd
+	maxLastErrorMessageLength = 2048
+	// logSnippetLines is the number of the last lines of the logs of a failed pod quoted in the JobFailed event
+	logSnippetLines = 3
+	// maxLogSnippetLength is the size the snippet of the JobFailed event is truncated to
+	maxLogSnippetLength = 300
+)
+
+// getFailedPod returns the pod of job whose container terminated last and the name of the container, nil if the
+// pods of job were already garbage collected
+func getFailedPod(kubeclient client.Client, job *batchv1.Job) (*corev1.Pod, string, error) {
+	podList := &corev1.PodList{}
+	err := kubeclient.List(context.TODO(), &client.ListOptions{
+		Namespace:     job.GetNamespace(),
+		LabelSelector: labels.SelectorFromSet(labels.Set{"job-name": job.GetName()}),
+	}, podList)
+	if err != nil {
+		return nil, "", err
+	}
+	var failed *corev1.Pod
+	var container string
+	var latest *corev1.ContainerStateTerminated
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.GetLabels()["job-name"] != job.GetName() {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.State.Terminated
+			if terminated == nil {
+				continue
+			}
+			if latest == nil || latest.FinishedAt.Before(&terminated.FinishedAt) {
+				failed, container, latest = pod, status.Name, terminated
+			}
+		}
+	}
+	return failed, container, nil
+}
+
+// getFailedPodLogs returns the last failedPodLogLines lines of the logs of the failed pod of job, empty if the pod
+// or its logs are gone
+func getFailedPodLogs(clientset kubernetes.Interface, kubeclient client.Client, job *batchv1.Job) (string, error) {
+	pod, container, err := getFailedPod(kubeclient, job)
+	if err != nil || pod == nil {
+		return "", err
+	}
+	tailLines := failedPodLogLines
+	logs, err := clientset.CoreV1().Pods(pod.GetNamespace()).GetLogs(pod.GetName(), &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &tailLines,
+	}).DoRaw()
+	if errors.IsNotFound(err) {
+		// the pod was garbage collected since it was listed
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(logs), nil
+}
+
+// truncateLogTail returns the end of logs holding in max bytes, starting at a line when it is truncated
+func truncateLogTail(logs string, max int) string {
+	logs = strings.TrimRight(logs, "\n")
+	if len(logs) <= max {
+		return logs
+	}
+	tail := logs[len(logs)-max:]
+	if logs[len(logs)-max-1] == '\n' {
+		return tail
+	}
+	if i := strings.Index(tail, "\n"); i >= 0 {
+		return tail[i+1:]
+	}
+	return tail
+}
+
+// logSnippet returns the last logSnippetLines lines of logs, on a single line, to be quoted in an event
+func logSnippet(logs string) string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimRight(logs, "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > logSnippetLines {
+		lines = lines[len(lines)-logSnippetLines:]
+	}
+	return truncateLogTail(strings.Join(lines, " | "), maxLogSnippetLength)
+}
+
+// readFailedPodLogs returns the tail of the logs of the failed pod of job, truncated to maxLastErrorMessageLength,
+// empty if they can't be read
+func (j *jobCompletionEmitter) readFailedPodLogs(job *batchv1.Job) string {
+	if j.clientset == nil {
+		return ""
+	}
+	logs, err := getFailedPodLogs(j.clientset, j.client, job)
+	if err != nil {
+		log.Error(err, "unable to read the logs of the failed job", "job", job.GetName())
+		return ""
+	}
+	return truncateLogTail(logs, maxLastErrorMessageLength)
+}
+
+// recordLastError stores in status.lastErrorMessage of owner the tail of the logs of its failed job, empty when they
+// aren't available, so that the logs of an older failure aren't mistaken for the ones of job
+func (j *jobCompletionEmitter) recordLastError(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, logs string) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the failed job", "job", job.GetName())
+		return
+	}
+	if instance.Status.LastErrorMessage == logs {
+		return
+	}
+	instance.Status.LastErrorMessage = logs
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newLogsClientset returns a clientset whose API server serves logs as the logs of the container template-processor
+// of the pod of newTerminatedPod, and a 404 for the other pods
+func newLogsClientset(t *testing.T, logs string) (kubernetes.Interface, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/api/v1/namespaces/%s/pods/gitopsconfig-gitops-operator-abcde-xyz/log", namespace) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`)
+			return
+		}
+		assert.Equal(t, "template-processor", r.URL.Query().Get("container"))
+		assert.Equal(t, "50", r.URL.Query().Get("tailLines"))
+		fmt.Fprint(w, logs)
+	}))
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset, server.Close
+}
+
+func TestFailedPodLogs(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	logs := "Cloning the template source\nRendering the templates\nerror: unable to recognize \"web.yaml\": no matches for kind \"Deploymnt\"\n"
+	clientset, stop := newLogsClientset(t, logs)
+	defer stop()
+
+	cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod("eunomia-phase: Apply\n"))
+	recorder := record.NewFakeRecorder(20)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder, clientset: clientset}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	failed := []string{}
+	for _, event := range drainEvents(recorder) {
+		if strings.HasPrefix(event, "Warning JobFailed") {
+			failed = append(failed, event)
+		}
+	}
+	if assert.Len(t, failed, 1) {
+		assert.Contains(t, failed[0], `last logs: Cloning the template source | Rendering the templates | error: unable to recognize "web.yaml"`)
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.Equal(t, strings.TrimSuffix(logs, "\n"), instance.Status.LastErrorMessage)
+
+	// the pod was garbage collected, the logs of the previous failure aren't kept
+	cl = fake.NewFakeClient(instance.DeepCopy())
+	recorder = record.NewFakeRecorder(20)
+	emitter = &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder, clientset: clientset}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	for _, event := range drainEvents(recorder) {
+		assert.NotContains(t, event, "last logs")
+	}
+	instance = &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.Empty(t, instance.Status.LastErrorMessage)
+
+	// the pod is listed but its logs are gone
+	gone := newTerminatedPod("")
+	gone.Name = "gitopsconfig-gitops-operator-abcde-gone"
+	instance.Status.LastErrorMessage = "an older failure"
+	cl = fake.NewFakeClient(instance.DeepCopy(), gone)
+	emitter = &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(20), clientset: clientset}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	instance = &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.Empty(t, instance.Status.LastErrorMessage)
+
+	// a successful job clears the logs
+	instance.Status.LastErrorMessage = "an older failure"
+	cl = fake.NewFakeClient(instance.DeepCopy(), newTerminatedPod(`{"commitMessage":"Fix the kind"}`))
+	emitter = &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(20), clientset: clientset}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	instance = &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.Empty(t, instance.Status.LastErrorMessage)
+}
+
+func TestTruncateLogTail(t *testing.T) {
+	assert.Equal(t, "short", truncateLogTail("short\n", 10))
+	// the tail starts at a line
+	assert.Equal(t, "third", truncateLogTail("first\nsecond\nthird\n", 10))
+	assert.Equal(t, "second\nthird", truncateLogTail("first\nsecond\nthird\n", 12))
+	// a single long line is cut
+	assert.Equal(t, "6789", truncateLogTail("0123456789", 4))
+
+	long := strings.Repeat("a line of the logs of the failed pod\n", 100)
+	assert.True(t, len(truncateLogTail(long, maxLastErrorMessageLength)) <= maxLastErrorMessageLength)
+	assert.Equal(t, "a line of the logs of the failed pod | a line of the logs of the failed pod | a line of the logs of the failed pod", logSnippet(long))
+}
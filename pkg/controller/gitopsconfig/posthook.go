@@ -0,0 +1,303 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// postSyncAction is the action label of the jobs running the postSync hook of a GitOpsConfig
+	postSyncAction string = "postsync"
+	// syncJobAnnotation names the sync job whose applied resources the post-sync hook job validates
+	syncJobAnnotation string = "gitopsconfig.eunomia.kohls.io/sync-job"
+	// postSyncJobSuffix is appended to the name of the sync job to name its post-sync hook job
+	postSyncJobSuffix = "-postsync"
+)
+
+// defaultHookDeadlineSeconds is how long a hook runs before it fails when it doesn't set its activeDeadlineSeconds
+var defaultHookDeadlineSeconds int64 = 600
+
+// validateHooks verifies the hooks set by spec
+func validateHooks(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.Hooks == nil || spec.Hooks.PostSync == nil {
+		return nil
+	}
+	hook := spec.Hooks.PostSync
+	if hook.Image == "" {
+		return fmt.Errorf("hooks.postSync.image is required")
+	}
+	if strings.ContainsAny(hook.Image, " \t\n") {
+		return fmt.Errorf("hooks.postSync.image %q is not a valid image", hook.Image)
+	}
+	if hook.ActiveDeadlineSeconds != nil && *hook.ActiveDeadlineSeconds < 1 {
+		return fmt.Errorf("hooks.postSync.activeDeadlineSeconds must be at least 1")
+	}
+	if hook.BackoffLimit != nil && *hook.BackoffLimit < 0 {
+		return fmt.Errorf("hooks.postSync.backoffLimit must not be negative")
+	}
+	for _, env := range hook.Env {
+		if env.Name == "" {
+			return fmt.Errorf("hooks.postSync.env has a variable without a name")
+		}
+	}
+	return nil
+}
+
+// isPostSyncHookJob returns true if job runs the postSync hook of a GitOpsConfig
+func isPostSyncHookJob(job *batchv1.Job) bool {
+	return job.GetLabels()["action"] == postSyncAction
+}
+
+// awaitsPostSyncHook returns true if the successful job, which applied the resources of instance, is only reported
+// once the postSync hook of instance passes. The dry runs, the delete jobs and the read-only runs don't run the hook.
+func awaitsPostSyncHook(instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) bool {
+	if instance.Spec.Hooks == nil || instance.Spec.Hooks.PostSync == nil {
+		return false
+	}
+	return isJobSucceeded(job) && job.GetLabels()["action"] == "create" && !isDryRunJob(job) && !util.IsReadOnly()
+}
+
+// postSyncHookJobName returns the name of the post-sync hook job of the sync job named syncJob, truncated to fit in
+// 63 characters
+func postSyncHookJobName(syncJob string) string {
+	if len(syncJob)+len(postSyncJobSuffix) > 63 {
+		syncJob = strings.TrimRight(syncJob[:63-len(postSyncJobSuffix)], "-.")
+	}
+	return syncJob + postSyncJobSuffix
+}
+
+// newPostSyncHookJob returns the job running the postSync hook of instance once job applied its resources, with the
+// commit it applied, empty when it isn't known
+func newPostSyncHookJob(instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, commit string) *batchv1.Job {
+	hook := instance.Spec.Hooks.PostSync
+	deadline := defaultHookDeadlineSeconds
+	if hook.ActiveDeadlineSeconds != nil {
+		deadline = *hook.ActiveDeadlineSeconds
+	}
+	backoffLimit := int32(0)
+	if hook.BackoffLimit != nil {
+		backoffLimit = *hook.BackoffLimit
+	}
+	annotations := map[string]string{syncJobAnnotation: job.GetName()}
+	// the hook is reported with the trigger of the sync
+	if trigger := jobTrigger(job); trigger != "" {
+		annotations[triggerAnnotation] = trigger
+	}
+	if commit != "" {
+		annotations[commitAnnotation] = commit
+	}
+	env := []corev1.EnvVar{
+		{Name: "GITOPSCONFIG", Value: instance.GetName()},
+		{Name: "SYNC_JOB", Value: job.GetName()},
+		{Name: "COMMIT", Value: commit},
+	}
+	hookJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        postSyncHookJobName(job.GetName()),
+			Namespace:   job.GetNamespace(),
+			Labels:      map[string]string{"action": postSyncAction},
+			Annotations: annotations,
+		},
+		Spec: batchv1.JobSpec{
+			ActiveDeadlineSeconds: &deadline,
+			BackoffLimit:          &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					ServiceAccountName: instance.Spec.ServiceAccountRef,
+					RestartPolicy:      corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:    "post-sync",
+						Image:   hook.Image,
+						Command: hook.Command,
+						Args:    hook.Args,
+						Env:     append(env, hook.Env...),
+					}},
+				},
+			},
+		},
+	}
+	if instance.Spec.JobTemplate != nil {
+		hookJob.Spec.TTLSecondsAfterFinished = instance.Spec.JobTemplate.TTLSecondsAfterFinished
+	}
+	applyJobMetadata(instance, &hookJob.ObjectMeta)
+	applyPodMetadata(instance, &hookJob.Spec.Template.ObjectMeta)
+	return hookJob
+}
+
+// startPostSyncHook creates the job running the postSync hook of owner once job applied its resources, reported in
+// a PostSyncStarted event. The sync fails when the hook can't be started.
+func (j *jobCompletionEmitter) startPostSyncHook(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, report jobReport) {
+	hookJob, err := j.createPostSyncHook(owner, job, report)
+	if err != nil {
+		log.Error(err, "unable to start the post-sync hook", "job", job.GetName())
+		message := fmt.Sprintf("Post-sync hook of job %s could not be started: %v", job.GetName(), err)
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Warning", reasonPostSyncFailed, "%s", message)
+		publishSyncEvent(owner, job.Name, "Warning", reasonPostSyncFailed, message)
+		j.recordPostSyncResult(owner, job.GetName(), false, message, time.Now())
+		j.recordJobFailure(owner, job)
+		return
+	}
+	message := fmt.Sprintf("Job %s applied the resources, running the post-sync hook %s", job.Name, hookJob.Name)
+	j.recorder.AnnotatedEventf(owner,
+		map[string]string{"job": job.Name},
+		"Normal", "PostSyncStarted", "%s", message)
+}
+
+// createPostSyncHook creates the job running the postSync hook of owner once job applied its resources. The job
+// already created for job, e.g. by a previous instance of the operator, is returned as is.
+func (j *jobCompletionEmitter) createPostSyncHook(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, report jobReport) (*batchv1.Job, error) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Spec.Hooks == nil || instance.Spec.Hooks.PostSync == nil {
+		return nil, fmt.Errorf("the postSync hook was removed")
+	}
+	hookJob := newPostSyncHookJob(instance, job, report.Commit)
+	err = setJobOwner(instance, hookJob, j.scheme)
+	if err != nil {
+		return nil, err
+	}
+	err = j.client.Create(context.TODO(), hookJob)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return hookJob, nil
+}
+
+// onPostSyncHookFinished reports the sync whose post-sync hook job finished: the JobSuccessful event is only emitted
+// once the hook passed, a failed hook fails the sync with a PostSyncFailed event, although its resources were applied
+func (j *jobCompletionEmitter) onPostSyncHookFinished(owner *gitopsv1alpha1.GitOpsConfig, hookJob *batchv1.Job, now time.Time) {
+	syncJob := hookJob.GetAnnotations()[syncJobAnnotation]
+	// the sync is described with its trigger, copied on the hook job
+	described := describeJob(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: syncJob, Annotations: hookJob.GetAnnotations()}})
+	if isJobSucceeded(hookJob) {
+		j.recordPostSyncResult(owner, syncJob, true, fmt.Sprintf("Job %s finished successfully, post-sync hook %s passed", syncJob, hookJob.Name), now)
+		message := "Job finished successfully: " + described
+		if commit := hookJob.GetAnnotations()[commitAnnotation]; commit != "" {
+			message += ", " + describeAppliedCommit(jobReport{Commit: commit})
+		}
+		message += fmt.Sprintf(", post-sync hook %s passed", hookJob.Name)
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": syncJob},
+			"Normal", "JobSuccessful", "%s", message)
+		publishSyncEvent(owner, syncJob, "Normal", "JobSuccessful", message)
+		j.resetJobFailures(owner, hookJob)
+		// the resources were applied by the sync job, audited with them
+		j.recordAudit(owner, hookJob, "Succeeded", jobReport{Commit: hookJob.GetAnnotations()[commitAnnotation]})
+		return
+	}
+	format := "Post-sync hook %s of job %s failed"
+	if jobFailedReason(hookJob) == "DeadlineExceeded" {
+		format += ", active longer than its activeDeadlineSeconds"
+	}
+	message := fmt.Sprintf(format, hookJob.Name, described)
+	logs := j.readFailedPodLogs(hookJob)
+	status := message
+	if snippet := logSnippet(logs); snippet != "" {
+		message += ", last logs: " + snippet
+	}
+	if logs != "" {
+		status = logs
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the post-sync hook", "job", hookJob.GetName())
+		instance = nil
+	}
+	eventType := "Warning"
+	if instance != nil && inMaintenanceWindow(instance, now) {
+		eventType = "Normal"
+	}
+	j.recorder.AnnotatedEventf(owner,
+		map[string]string{"job": syncJob},
+		eventType, reasonPostSyncFailed, "%s", message)
+	publishSyncEvent(owner, syncJob, eventType, reasonPostSyncFailed, message)
+	j.recordPostSyncResult(owner, syncJob, false, status, now)
+	if eventType == "Warning" {
+		j.notifyFailure(owner, instance, hookJob, "")
+	}
+	j.recordAudit(owner, hookJob, "Failed", jobReport{})
+	j.recordJobFailure(owner, hookJob)
+}
+
+// recordPostSyncResult stores in the status of owner the result of the sync of the job named syncJob, decided by its
+// post-sync hook at now, with message as its lastErrorMessage when it failed, and adds the sync to its history. The
+// Progressing condition becomes False.
+func (j *jobCompletionEmitter) recordPostSyncResult(owner *gitopsv1alpha1.GitOpsConfig, syncJob string, passed bool, message string, now time.Time) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the job", "job", syncJob)
+		return
+	}
+	syncTime := metav1.NewTime(now)
+	instance.Status.LastSyncTime = &syncTime
+	instance.Status.LastSyncJob = syncJob
+	if passed {
+		instance.Status.LastSyncResult = "Success"
+		instance.Status.LastErrorMessage = ""
+		setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionSynced,
+			Status:  corev1.ConditionTrue,
+			Reason:  "JobSuccessful",
+			Message: message,
+		})
+	} else {
+		instance.Status.LastSyncResult = "Failed"
+		instance.Status.LastErrorMessage = message
+		setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionSynced,
+			Status:  corev1.ConditionFalse,
+			Reason:  reasonPostSyncFailed,
+			Message: fmt.Sprintf("The post-sync hook of job %s failed", syncJob),
+		})
+	}
+	instance.Status.History = appendSyncHistory(instance.Status.History, gitopsv1alpha1.SyncRecord{
+		Job:      syncJob,
+		Time:     syncTime,
+		Result:   instance.Status.LastSyncResult,
+		Commit:   instance.Status.LastAppliedCommit,
+		Duration: instance.Status.LastSyncDuration,
+	}, syncHistoryLimit)
+	setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionProgressing,
+		Status:  corev1.ConditionFalse,
+		Reason:  "JobFinished",
+		Message: fmt.Sprintf("Job %s finished", syncJob),
+	})
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// smokeTests is a postSync hook running the smoke tests of the applied resources
+var smokeTests = &gitopsv1alpha1.GitOpsHooks{PostSync: &gitopsv1alpha1.HookJob{
+	Image:   "quay.io/example/smoke-tests:v1",
+	Command: []string{"/bin/smoke-tests"},
+	Env:     []corev1.EnvVar{{Name: "TARGET", Value: "web"}},
+}}
+
+func TestValidateHooks(t *testing.T) {
+	zero := int64(0)
+	negative := int32(-1)
+	tests := []struct {
+		name  string
+		hooks *gitopsv1alpha1.GitOpsHooks
+		valid bool
+	}{
+		{"no hooks", nil, true},
+		{"no postSync hook", &gitopsv1alpha1.GitOpsHooks{}, true},
+		{"postSync hook", smokeTests, true},
+		{"missing image", &gitopsv1alpha1.GitOpsHooks{PostSync: &gitopsv1alpha1.HookJob{}}, false},
+		{"invalid image", &gitopsv1alpha1.GitOpsHooks{PostSync: &gitopsv1alpha1.HookJob{Image: "smoke tests"}}, false},
+		{"zero deadline", &gitopsv1alpha1.GitOpsHooks{PostSync: &gitopsv1alpha1.HookJob{Image: "smoke-tests", ActiveDeadlineSeconds: &zero}}, false},
+		{"negative backoffLimit", &gitopsv1alpha1.GitOpsHooks{PostSync: &gitopsv1alpha1.HookJob{Image: "smoke-tests", BackoffLimit: &negative}}, false},
+		{"unnamed variable", &gitopsv1alpha1.GitOpsHooks{PostSync: &gitopsv1alpha1.HookJob{Image: "smoke-tests", Env: []corev1.EnvVar{{Value: "web"}}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHooks(gitopsv1alpha1.GitOpsConfigSpec{Hooks: tt.hooks})
+			assert.Equal(t, tt.valid, err == nil, "%v", err)
+		})
+	}
+}
+
+func TestPostSyncHookJobName(t *testing.T) {
+	assert.Equal(t, "gitopsconfig-web-abcde-postsync", postSyncHookJobName("gitopsconfig-web-abcde"))
+	long := postSyncHookJobName("gitopsconfig-" + strings.Repeat("a", 44) + "-abcde")
+	assert.Len(t, long, 63)
+	assert.True(t, strings.HasSuffix(long, "-postsync"))
+}
+
+// hookJobStatus returns the post-sync hook job of the job of newOwnedJob, as stored by cl, moved from active to status
+func hookJobStatus(t *testing.T, cl client.Client, status batchv1.JobStatus) (*batchv1.Job, *batchv1.Job) {
+	hookJob := &batchv1.Job{}
+	err := cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator-abcde-postsync", Namespace: namespace}, hookJob)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	hookJob.UID = "post-sync-uid"
+	oldJob := hookJob.DeepCopy()
+	oldJob.Status = batchv1.JobStatus{Active: 1}
+	hookJob.Status = status
+	return oldJob, hookJob
+}
+
+func TestPostSyncHookGatesSuccess(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	tests := []struct {
+		name      string
+		status    batchv1.JobStatus
+		event     string
+		result    string
+		synced    corev1.ConditionStatus
+		reason    string
+		failures  int32
+		unwelcome string
+	}{
+		{"hook passed", batchv1.JobStatus{Succeeded: 1}, "Normal JobSuccessful", "Success", corev1.ConditionTrue, "JobSuccessful", 0, "PostSyncFailed"},
+		{"hook failed", batchv1.JobStatus{Failed: 1}, "Warning PostSyncFailed", "Failed", corev1.ConditionFalse, reasonPostSyncFailed, 1, "JobSuccessful"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Spec.Hooks = smokeTests
+			cl := fake.NewFakeClient(instance, newTerminatedPod(`{"commit":"0123abc"}`))
+			recorder := record.NewFakeRecorder(50)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+			// the apply succeeded, the sync awaits its hook
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+			events := strings.Join(drainEvents(recorder), "\n")
+			assert.NotContains(t, events, "JobSuccessful")
+			assert.Contains(t, events, "Normal PostSyncStarted")
+			synced := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), nsn, synced))
+			assert.Empty(t, synced.Status.LastSyncResult)
+			if progressing := getCondition(&synced.Status, gitopsv1alpha1.ConditionProgressing); assert.NotNil(t, progressing) {
+				assert.Equal(t, corev1.ConditionTrue, progressing.Status)
+				assert.Equal(t, "PostSync", progressing.Reason)
+			}
+
+			oldJob, hookJob := hookJobStatus(t, cl, tt.status)
+			container := hookJob.Spec.Template.Spec.Containers[0]
+			assert.Equal(t, "quay.io/example/smoke-tests:v1", container.Image)
+			assert.Equal(t, []string{"/bin/smoke-tests"}, container.Command)
+			assert.Contains(t, container.Env, corev1.EnvVar{Name: "SYNC_JOB", Value: "gitopsconfig-gitops-operator-abcde"})
+			assert.Contains(t, container.Env, corev1.EnvVar{Name: "COMMIT", Value: "0123abc"})
+			assert.Contains(t, container.Env, corev1.EnvVar{Name: "TARGET", Value: "web"})
+			assert.Equal(t, corev1.RestartPolicyNever, hookJob.Spec.Template.Spec.RestartPolicy)
+
+			// the hook decides the result of the sync
+			emitter.OnUpdate(oldJob, hookJob)
+			events = strings.Join(drainEvents(recorder), "\n")
+			assert.Contains(t, events, tt.event)
+			assert.NotContains(t, events, tt.unwelcome)
+			if tt.result == "Success" {
+				assert.Contains(t, events, "applied commit 0123abc, post-sync hook gitopsconfig-gitops-operator-abcde-postsync passed")
+			}
+			result := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), nsn, result))
+			assert.Equal(t, tt.result, result.Status.LastSyncResult)
+			assert.Equal(t, "gitopsconfig-gitops-operator-abcde", result.Status.LastSyncJob)
+			assert.Equal(t, tt.failures, result.Status.ConsecutiveFailures)
+			if assert.Len(t, result.Status.History, 1) {
+				assert.Equal(t, tt.result, result.Status.History[0].Result)
+				assert.Equal(t, "0123abc", result.Status.History[0].Commit)
+			}
+			if condition := getCondition(&result.Status, gitopsv1alpha1.ConditionSynced); assert.NotNil(t, condition) {
+				assert.Equal(t, tt.synced, condition.Status)
+				assert.Equal(t, tt.reason, condition.Reason)
+			}
+			if progressing := getCondition(&result.Status, gitopsv1alpha1.ConditionProgressing); assert.NotNil(t, progressing) {
+				assert.Equal(t, corev1.ConditionFalse, progressing.Status)
+			}
+		})
+	}
+}
+
+func TestPostSyncHookSkipped(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.Hooks = smokeTests
+	cl := fake.NewFakeClient(instance, newTerminatedPod(`{}`))
+	recorder := record.NewFakeRecorder(50)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+	// a delete job doesn't run the hook
+	deleted := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+	deleted.Labels["action"] = "delete"
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), deleted)
+	events := strings.Join(drainEvents(recorder), "\n")
+	assert.Contains(t, events, "Normal JobSuccessful")
+	assert.NotContains(t, events, "PostSyncStarted")
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	for _, job := range jobs.Items {
+		assert.False(t, isPostSyncHookJob(&job))
+	}
+}
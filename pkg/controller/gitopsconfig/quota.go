@@ -0,0 +1,59 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// exceededQuotaPattern matches the lines printed by the quota preflight for every exceeded quota
+var exceededQuotaPattern = regexp.MustCompile(`(?m)^ResourceQuota .*$`)
+
+// recordQuotaExceeded sets the Degraded condition of the GitOpsConfig owning job
+// when its quota preflight failed, the termination message lists the exceeded quotas
+func (j *jobCompletionEmitter) recordQuotaExceeded(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, message string) {
+	if failurePhase(message) != "Quota" {
+		return
+	}
+	exceeded := exceededQuotaPattern.FindAllString(message, -1)
+	condition := gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionDegraded,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonQuotaExceeded,
+		Message: fmt.Sprintf("The resources of job %s don't fit in the ResourceQuotas, nothing was applied", job.GetName()),
+	}
+	if len(exceeded) > 0 {
+		condition.Message += ": " + strings.Join(exceeded, "; ")
+	}
+	j.setOwnerCondition(owner, condition)
+}
+
+// clearDegraded resets the Degraded condition of the GitOpsConfig owning job, which succeeded
+func (j *jobCompletionEmitter) clearDegraded(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) {
+	j.setOwnerCondition(owner, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionDegraded,
+		Status:  corev1.ConditionFalse,
+		Reason:  reasonApplied,
+		Message: fmt.Sprintf("Job %s succeeded", job.GetName()),
+	})
+}
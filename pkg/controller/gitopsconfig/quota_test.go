@@ -0,0 +1,78 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestQuotaExceeded(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	message := "The resources don't fit in the ResourceQuotas of namespace gitops, nothing is applied:\n" +
+		"ResourceQuota compute: requests.cpu would reach 2400m over its hard limit of 2\n" +
+		"eunomia-phase: Quota\n"
+	pod := newTerminatedPod(message)
+	cl := fake.NewFakeClient(gitops.DeepCopy(), pod)
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+	// a render exceeding the quota degrades the configuration
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	assert.Contains(t, <-recorder.Events, "Warning JobFailed")
+	assert.Contains(t, <-recorder.Events, "Warning QuotaExceeded")
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	degraded := getCondition(&instance.Status, gitopsv1alpha1.ConditionDegraded)
+	if assert.NotNil(t, degraded) {
+		assert.Equal(t, corev1.ConditionTrue, degraded.Status)
+		assert.Equal(t, "QuotaExceeded", degraded.Reason)
+		assert.Contains(t, degraded.Message, "ResourceQuota compute: requests.cpu would reach 2400m over its hard limit of 2")
+	}
+
+	// a render fitting in the quota clears it
+	pod.Status.ContainerStatuses[0].State.Terminated.Message = `{"commitMessage":"Scale down the frontend"}`
+	assert.NoError(t, cl.Update(context.TODO(), pod))
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.False(t, isConditionTrue(&instance.Status, gitopsv1alpha1.ConditionDegraded))
+	assert.NotNil(t, getCondition(&instance.Status, gitopsv1alpha1.ConditionDegraded))
+}
+
+func TestQuotaNeverExceeded(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod("eunomia-phase: Apply\n"))
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+	assert.Nil(t, getCondition(&instance.Status, gitopsv1alpha1.ConditionDegraded))
+}
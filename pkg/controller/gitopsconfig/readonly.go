@@ -0,0 +1,68 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// onReadOnlyJobSucceeded reports the resources found differing from git by a
+// job that ran in read-only mode. Nothing was applied, so the last applied
+// commit is left untouched and every divergence is reported, not only new ones.
+func (j *jobCompletionEmitter) onReadOnlyJobSucceeded(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) {
+	message := fmt.Sprintf("Job finished successfully: %s, in read-only mode", job.Name)
+	j.recorder.AnnotatedEventf(owner,
+		map[string]string{"job": job.Name},
+		"Normal", "JobSuccessful", "Job finished successfully: %s, in read-only mode", job.Name)
+	publishSyncEvent(owner, job.Name, "Normal", "JobSuccessful", message)
+	recordJobCompletion(owner, job, "success")
+	terminated, err := getJobTerminatedState(j.client, job)
+	if err != nil {
+		log.Error(err, "unable to lookup the pods of the job", "job", job.GetName())
+	}
+	report := jobReport{}
+	if terminated != nil {
+		report = parseJobReport(terminated.Message)
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err = j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the job", "job", job.GetName())
+	} else {
+		instance.Status.DriftedResources = report.Drifted
+		err = j.client.Status().Update(context.TODO(), instance)
+		if err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+		}
+	}
+	if len(report.Drifted) > 0 {
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Warning", "Diverged", "Job %s found %s differing from git", job.Name, summarizeResources(report.Drifted, report.DriftedCount))
+	} else {
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Normal", "InSync", "Job %s found the resources in sync with git", job.Name)
+	}
+	j.resetJobFailures(owner, job)
+	j.recordAudit(owner, job, "Succeeded", jobReport{})
+}
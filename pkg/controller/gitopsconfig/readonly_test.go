@@ -0,0 +1,124 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReadOnlyJobs(t *testing.T) {
+	defer util.SetReadOnly(false)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	configs := map[string]func(*gitopsv1alpha1.GitOpsConfigSpec){
+		"create or merge": func(spec *gitopsv1alpha1.GitOpsConfigSpec) {},
+		"force conflicts": func(spec *gitopsv1alpha1.GitOpsConfigSpec) {
+			spec.ServerSideApply = true
+			spec.ForceConflicts = true
+		},
+		"allow recreate":   func(spec *gitopsv1alpha1.GitOpsConfigSpec) { spec.AllowRecreate = true },
+		"create or update": func(spec *gitopsv1alpha1.GitOpsConfigSpec) { spec.ResourceHandlingMode = "CreateOrUpdate" },
+		"patch":            func(spec *gitopsv1alpha1.GitOpsConfigSpec) { spec.ResourceHandlingMode = "Patch" },
+		"delete":           func(spec *gitopsv1alpha1.GitOpsConfigSpec) { spec.ResourceDeletionMode = "Delete" },
+	}
+	for _, readOnly := range []bool{true, false} {
+		util.SetReadOnly(readOnly)
+		expected := corev1.EnvVar{Name: "READ_ONLY", Value: "false"}
+		if readOnly {
+			expected.Value = "true"
+		}
+		for name, configure := range configs {
+			t.Run(name, func(t *testing.T) {
+				instance := gitops.DeepCopy()
+				configure(&instance.Spec)
+				cl := fake.NewFakeClient(instance)
+				r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+				for _, action := range []string{"create", "delete"} {
+					_, err := r.CreateJob(action, instance)
+					assert.NoError(t, err)
+				}
+				_, err := r.createCronJob(instance)
+				assert.NoError(t, err)
+
+				jobs := &batchv1.JobList{}
+				assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+				if assert.Len(t, jobs.Items, 2) {
+					for _, job := range jobs.Items {
+						assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, expected)
+					}
+				}
+				cronjobs := &batchv1beta1.CronJobList{}
+				assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, cronjobs))
+				if assert.Len(t, cronjobs.Items, 1) {
+					assert.Contains(t, cronjobs.Items[0].Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env, expected)
+				}
+			})
+		}
+	}
+}
+
+func TestReadOnlyJobReport(t *testing.T) {
+	defer util.SetReadOnly(false)
+	util.SetReadOnly(true)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name    string
+		report  string
+		drifted []string
+		event   string
+	}{
+		{"diverged", `{"commitMessage":"Scale the frontend","commit":"def","drifted":["apps.v1.Deployment.gitops.frontend"],"driftedCount":1}`,
+			[]string{"apps.v1.Deployment.gitops.frontend"}, "Warning Diverged"},
+		{"in sync", `{"commitMessage":"Scale the frontend","commit":"def","drifted":[],"driftedCount":0}`, nil, "Normal InSync"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Status.LastAppliedCommit = "abc"
+			instance.Status.LastAppliedCommitMessage = "Add the frontend"
+			cl := fake.NewFakeClient(instance, newTerminatedPod(tt.report))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+
+			assert.Contains(t, <-recorder.Events, "Normal JobSuccessful")
+			assert.Contains(t, <-recorder.Events, tt.event)
+			assert.Empty(t, recorder.Events)
+			updated := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+			// divergence is reported even if the commit changed, nothing was applied
+			assert.Equal(t, tt.drifted, updated.Status.DriftedResources)
+			assert.Equal(t, "abc", updated.Status.LastAppliedCommit)
+			assert.Equal(t, "Add the frontend", updated.Status.LastAppliedCommitMessage)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+)
+
+// refAnnotation records on a job the pushed ref it deploys, for the sources whose ref is a pattern
+const refAnnotation string = "gitopsconfig.eunomia.kohls.io/ref"
+
+// refPatternWildcards matches the wildcards and character classes of a ref pattern
+var refPatternWildcards = regexp.MustCompile(`\[[^]]*\]|[*?]`)
+
+// IsRefPattern returns true if ref is a wildcard pattern, e.g. release/*, matching several branches or tags
+func IsRefPattern(ref string) bool {
+	return strings.ContainsAny(ref, "*?[")
+}
+
+// MatchRef returns true if the pushed ref, e.g. refs/heads/release/1.2, is the branch or tag ref designates. A
+// pattern ref matches the branches and tags it matches with path.Match, its * not matching slashes.
+func MatchRef(ref, pushed string) bool {
+	for _, name := range []string{pushed, strings.TrimPrefix(pushed, "refs/heads/"), strings.TrimPrefix(pushed, "refs/tags/")} {
+		if ref == name {
+			return true
+		}
+		if matched, _ := path.Match(ref, name); matched && IsRefPattern(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidRefPattern returns true if pattern is a valid path.Match pattern, which is a valid ref once its wildcards
+// are replaced by a character
+func isValidRefPattern(pattern string) bool {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return false
+	}
+	return isValidGitRef(refPatternWildcards.ReplaceAllString(pattern, "x"))
+}
+
+// validateRefPatterns verifies that the sources of spec with a pattern ref are only deployed by the pushes. The
+// runs that aren't triggered by a push don't know the ref to deploy, so a pattern can't be used with the Periodic
+// and Time triggers.
+func validateRefPatterns(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	for _, ref := range []string{spec.TemplateSource.Ref, spec.ParameterSource.Ref} {
+		if !IsRefPattern(ref) {
+			continue
+		}
+		for _, trigger := range spec.Triggers {
+			if util.IsScheduledTrigger(trigger.Type) {
+				return fmt.Errorf("source ref %q is a pattern, which can't be used with the %s trigger", ref, trigger.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// resolvePushedRef returns the branch or tag pushed by trigger that the pattern refs of the sources of instance
+// deploy, or an empty string if they have none. It fails if the run wasn't triggered by a push to a matching ref.
+func resolvePushedRef(instance *gitopsv1alpha1.GitOpsConfig, trigger *TriggerContext) (string, error) {
+	for _, ref := range []string{instance.Spec.TemplateSource.Ref, instance.Spec.ParameterSource.Ref} {
+		if !IsRefPattern(ref) {
+			continue
+		}
+		if trigger == nil || trigger.Ref == "" {
+			return "", fmt.Errorf("source ref %q is a pattern, only the runs triggered by a push to a matching ref can be started", ref)
+		}
+		if !MatchRef(ref, trigger.Ref) {
+			return "", fmt.Errorf("source ref %q doesn't match the pushed ref %s", ref, trigger.Ref)
+		}
+	}
+	if trigger == nil || (!IsRefPattern(instance.Spec.TemplateSource.Ref) && !IsRefPattern(instance.Spec.ParameterSource.Ref)) {
+		return "", nil
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(trigger.Ref, "refs/heads/"), "refs/tags/"), nil
+}
+
+// withPushedRef returns instance with the pattern refs of its sources replaced by the pushed ref, if any
+func withPushedRef(instance *gitopsv1alpha1.GitOpsConfig, ref string) *gitopsv1alpha1.GitOpsConfig {
+	if ref == "" {
+		return instance
+	}
+	run := instance.DeepCopy()
+	if IsRefPattern(run.Spec.TemplateSource.Ref) {
+		run.Spec.TemplateSource.Ref = ref
+	}
+	if IsRefPattern(run.Spec.ParameterSource.Ref) {
+		run.Spec.ParameterSource.Ref = ref
+	}
+	return run
+}
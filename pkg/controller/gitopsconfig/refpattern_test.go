@@ -0,0 +1,129 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMatchRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		pushed  string
+		matches bool
+	}{
+		{"master", "refs/heads/master", true},
+		{"master", "refs/heads/main", false},
+		{"v1.0.0", "refs/tags/v1.0.0", true},
+		{"refs/heads/master", "refs/heads/master", true},
+		{"release/*", "refs/heads/release/1.2", true},
+		{"release/*", "refs/heads/release/1.2/hotfix", false},
+		{"release/*", "refs/heads/feature/1.2", false},
+		{"release-?", "refs/heads/release-3", true},
+		{"v[12].*", "refs/tags/v2.1", true},
+		{"v[12].*", "refs/tags/v3.1", false},
+		// a literal ref isn't matched as a pattern
+		{"release", "refs/heads/release-1", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.matches, MatchRef(tt.ref, tt.pushed), "%s %s", tt.ref, tt.pushed)
+	}
+}
+
+func TestValidateRefPatterns(t *testing.T) {
+	assert.NoError(t, validateGitConfig("template", gitopsv1alpha1.GitConfig{Ref: "release/*"}))
+	assert.NoError(t, validateGitConfig("template", gitopsv1alpha1.GitConfig{Ref: "v[0-9].*"}))
+	assert.Error(t, validateGitConfig("template", gitopsv1alpha1.GitConfig{Ref: "release/["}), "unterminated class")
+	assert.Error(t, validateGitConfig("template", gitopsv1alpha1.GitConfig{Ref: "release/*..x"}))
+	assert.Error(t, validateGitConfig("template", gitopsv1alpha1.GitConfig{Ref: "release/* x"}))
+
+	spec := gitopsv1alpha1.GitOpsConfigSpec{
+		TemplateSource:  gitopsv1alpha1.GitConfig{Ref: "master"},
+		ParameterSource: gitopsv1alpha1.GitConfig{Ref: "release/*"},
+		Triggers:        []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook"}},
+	}
+	assert.NoError(t, validateRefPatterns(spec))
+	spec.Triggers = append(spec.Triggers, gitopsv1alpha1.GitOpsTrigger{Type: "Periodic", Cron: "0 * * * *"})
+	assert.Error(t, validateRefPatterns(spec))
+	spec.ParameterSource.Ref = "master"
+	assert.NoError(t, validateRefPatterns(spec))
+}
+
+func TestResolvePushedRef(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource.Ref = "release/*"
+
+	ref, err := resolvePushedRef(instance, &TriggerContext{Ref: "refs/heads/release/1.2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "release/1.2", ref)
+	_, err = resolvePushedRef(instance, &TriggerContext{Ref: "refs/heads/feature-x"})
+	assert.Error(t, err)
+	_, err = resolvePushedRef(instance, nil)
+	assert.Error(t, err, "the runs not triggered by a push don't know the ref")
+
+	// without a pattern, the refs of the sources are deployed
+	ref, err = resolvePushedRef(gitops, &TriggerContext{Ref: "refs/heads/master"})
+	assert.NoError(t, err)
+	assert.Empty(t, ref)
+	assert.Equal(t, gitops, withPushedRef(gitops, ""))
+}
+
+func TestRefPatternFromWebhook(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook"}}
+	instance.Spec.TemplateSource.Ref = "release/*"
+	instance.Spec.ParameterSource.Ref = "master"
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+	// a run that isn't triggered by a push can't be started
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "Warning RefUnresolved")
+
+	SetTriggerContext(nsn, TriggerContext{Branch: "release/1.2", Ref: "refs/heads/release/1.2", Repo: "KohlsTechnology/eunomia"})
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		job := jobs.Items[0]
+		env := job.Spec.Template.Spec.Containers[0].Env
+		assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_GIT_REF", Value: "release/1.2"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "PARAMETER_GIT_REF", Value: "master"})
+		// retries of the job deploy the same ref
+		assert.Equal(t, "release/1.2", job.Annotations[refAnnotation])
+	}
+}
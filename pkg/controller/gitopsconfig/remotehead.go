@@ -0,0 +1,205 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/gitremote"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// remoteLookupTimeout bounds the lookup of the ref of a single repository
+const remoteLookupTimeout = 30 * time.Second
+
+// remotePollInterval is how often the template source ref of every GitOpsConfig is looked up, zero disables the lookups
+var remotePollInterval time.Duration
+
+// SetRemotePollInterval makes the operator look up the commit the template source ref of every GitOpsConfig points to,
+// every interval, recording it in status.availableCommit. Zero disables the lookups.
+func SetRemotePollInterval(interval time.Duration) {
+	remotePollInterval = interval
+}
+
+// remoteHeadPoller looks up the commit of the template source ref of the GitOpsConfigs in their remote repository,
+// only listing its refs like git ls-remote. The repositories that aren't served over HTTP(S) and the pattern refs
+// are skipped.
+type remoteHeadPoller struct {
+	client client.Client
+	// reader reads the git credentials secrets directly from the API server, like the job profiles
+	reader client.Reader
+}
+
+var _ manager.Runnable = &remoteHeadPoller{}
+
+// Start polls the remote repositories every remotePollInterval, until stopCh is closed
+func (p *remoteHeadPoller) Start(stopCh <-chan struct{}) error {
+	ticker := time.NewTicker(remotePollInterval)
+	defer ticker.Stop()
+	for {
+		if err := p.poll(); err != nil {
+			log.Error(err, "unable to list the GitOpsConfigs to look up their remote ref")
+		}
+		select {
+		case <-stopCh:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll records the available commit of every GitOpsConfig, the ones that fail being looked up again on the next poll
+func (p *remoteHeadPoller) poll() error {
+	instances := &gitopsv1alpha1.GitOpsConfigList{}
+	err := p.client.List(context.TODO(), &client.ListOptions{}, instances)
+	if err != nil {
+		return err
+	}
+	for i := range instances.Items {
+		instance := &instances.Items[i]
+		if err := p.refresh(instance); err != nil {
+			log.Error(err, "unable to look up the remote ref of the template source", "instance", instance.GetName(),
+				"uri", instance.Spec.TemplateSource.URI, "ref", instance.Spec.TemplateSource.Ref)
+		}
+	}
+	return nil
+}
+
+// refresh looks up the commit of the template source ref of instance, updating status.availableCommit if it changed
+func (p *remoteHeadPoller) refresh(instance *gitopsv1alpha1.GitOpsConfig) error {
+	source := instance.Spec.TemplateSource
+	if !strings.HasPrefix(source.URI, "http://") && !strings.HasPrefix(source.URI, "https://") || IsRefPattern(source.Ref) {
+		return nil
+	}
+	ref := source.Ref
+	var commit string
+	if isSemVerRef(source) {
+		// the highest tag matching the range, new matching tags move it
+		var err error
+		ref, commit, err = resolveSemVerTag(p.reader, instance)
+		if err != nil {
+			return err
+		}
+	} else {
+		auth, err := sourceCredentials(p.reader, instance)
+		if err != nil {
+			return err
+		}
+		if ref == "" {
+			ref = "master"
+		}
+		switch source.RefType {
+		case "Branch":
+			ref = "refs/heads/" + ref
+		case "Tag":
+			ref = "refs/tags/" + ref
+		}
+		commit, err = gitremote.ResolveRef(remoteHTTPClient(source), source.URI, ref, auth)
+		if err != nil {
+			return err
+		}
+	}
+	if instance.Status.AvailableCommit == commit {
+		return nil
+	}
+	log.Info("Template source ref moved", "instance", instance.GetName(), "ref", ref, "commit", commit,
+		"lastAppliedCommit", instance.Status.LastAppliedCommit)
+	instance.Status.AvailableCommit = commit
+	return p.client.Status().Update(context.TODO(), instance)
+}
+
+// sourceCredentials returns the credentials of the template source of instance in the .git-credentials of its secret,
+// if any, read with reader
+func sourceCredentials(reader client.Reader, instance *gitopsv1alpha1.GitOpsConfig) (*url.Userinfo, error) {
+	source := instance.Spec.TemplateSource
+	if source.SecretRef == "" {
+		return nil, nil
+	}
+	secret := &corev1.Secret{}
+	// the secrets are mounted by the jobs, from their namespace
+	err := reader.Get(context.TODO(), types.NamespacedName{Name: source.SecretRef, Namespace: util.JobNamespace(*instance)}, secret)
+	if errors.IsNotFound(err) {
+		// the repository may be public, the missing secret is reported by the runs
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gitremote.Credentials(secret.Data[".git-credentials"], source.URI), nil
+}
+
+// remoteHTTPClient returns an HTTP client reaching the repository of source like its jobs, through its proxies or the
+// ones of the jobs, and without verifying the certificate of its insecureSkipTLSVerifyHosts
+func remoteHTTPClient(source gitopsv1alpha1.GitConfig) *http.Client {
+	transport := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			sourceProxy := util.SourceProxy(source)
+			proxy := sourceProxy.HTTPSProxy
+			if req.URL.Scheme == "http" {
+				proxy = sourceProxy.HTTPProxy
+			}
+			if proxy == "" || isNoProxy(sourceProxy.NOProxy, req.URL.Hostname()) {
+				return nil, nil
+			}
+			return url.Parse(proxy)
+		},
+		DialContext:         (&net.Dialer{Timeout: remoteLookupTimeout}).DialContext,
+		TLSHandshakeTimeout: remoteLookupTimeout,
+		DisableKeepAlives:   true,
+	}
+	if target, err := url.Parse(source.URI); err == nil {
+		transport.TLSClientConfig = tlsConfig(source, target)
+	}
+	return &http.Client{Transport: transport, Timeout: remoteLookupTimeout}
+}
+
+// tlsConfig skips the verification of the certificate of target if its host is one of the insecureSkipTLSVerifyHosts of source
+func tlsConfig(source gitopsv1alpha1.GitConfig, target *url.URL) *tls.Config {
+	host := target.Host
+	if target.Port() == "443" {
+		host = target.Hostname()
+	}
+	for _, insecure := range source.InsecureSkipTLSVerifyHosts {
+		if insecure == host {
+			return &tls.Config{InsecureSkipVerify: true}
+		}
+	}
+	return nil
+}
+
+// isNoProxy returns true if host matches one of the comma separated domains of noProxy, like git
+func isNoProxy(noProxy, host string) bool {
+	for _, domain := range strings.Split(noProxy, ",") {
+		domain = strings.TrimPrefix(strings.TrimSpace(domain), ".")
+		if domain == "*" || (domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newRefsServer serves the refs advertisement of a repository whose master branch points to *head, to the user
+// eunomia if auth is true
+func newRefsServer(head *string, auth bool) *httptest.Server {
+	pktLine := func(line string) string {
+		return fmt.Sprintf("%04x%s", len(line)+4, line)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); auth && (user != "eunomia" || password != "t0ken") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		fmt.Fprint(w, pktLine("# service=git-upload-pack\n")+"0000"+
+			pktLine(*head+" HEAD\x00side-band\n")+pktLine(*head+" refs/heads/master\n")+"0000")
+	}))
+}
+
+func TestAvailableCommit(t *testing.T) {
+	applied := strings.Repeat("a", 40)
+	head := applied
+	server := newRefsServer(&head, false)
+	defer server.Close()
+
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource = gitopsv1alpha1.GitConfig{URI: server.URL + "/repo.git", Ref: "master"}
+	instance.Status.LastAppliedCommit = applied
+	ssh := gitops.DeepCopy()
+	ssh.Name = "ssh"
+	ssh.Spec.TemplateSource = gitopsv1alpha1.GitConfig{URI: "git@github.com:KohlsTechnology/eunomia.git", Ref: "master"}
+	cl := fake.NewFakeClient(instance, ssh)
+	poller := &remoteHeadPoller{client: cl, reader: cl}
+
+	availableCommit := func(name string) string {
+		updated := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+		return updated.Status.AvailableCommit
+	}
+
+	// up to date
+	assert.NoError(t, poller.poll())
+	assert.Equal(t, applied, availableCommit(instance.Name))
+	assert.Empty(t, availableCommit(ssh.Name), "the repositories not served over HTTP(S) are skipped")
+
+	// behind the remote head
+	head = strings.Repeat("b", 40)
+	assert.NoError(t, poller.poll())
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+	assert.Equal(t, head, updated.Status.AvailableCommit)
+	assert.NotEqual(t, updated.Status.LastAppliedCommit, updated.Status.AvailableCommit)
+}
+
+func TestAvailableCommitCredentials(t *testing.T) {
+	head := strings.Repeat("c", 40)
+	server := newRefsServer(&head, true)
+	defer server.Close()
+
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource = gitopsv1alpha1.GitConfig{URI: server.URL + "/repo.git", SecretRef: "git-credentials"}
+	cl := fake.NewFakeClient(instance)
+	poller := &remoteHeadPoller{client: cl, reader: cl}
+
+	// without the secret, the lookup is anonymous and fails
+	assert.Error(t, poller.refresh(instance.DeepCopy()))
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-credentials", Namespace: namespace},
+		Data: map[string][]byte{
+			".git-credentials": []byte(strings.Replace(server.URL, "http://", "http://eunomia:t0ken@", 1) + "\n"),
+		},
+	}
+	assert.NoError(t, cl.Create(context.TODO(), secret))
+	assert.NoError(t, poller.refresh(instance))
+	assert.Equal(t, head, instance.Status.AvailableCommit, "the default ref is master")
+}
+
+func TestIsNoProxy(t *testing.T) {
+	assert.True(t, isNoProxy("localhost, .kohls.com", "git.kohls.com"))
+	assert.True(t, isNoProxy("localhost,kohls.com", "kohls.com"))
+	assert.True(t, isNoProxy("*", "github.com"))
+	assert.False(t, isNoProxy("kohls.com", "github.com"))
+	assert.False(t, isNoProxy("", "github.com"))
+}
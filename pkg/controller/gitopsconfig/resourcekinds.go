@@ -0,0 +1,64 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+)
+
+// validateResourceKinds verifies the allowedResourceKinds and deniedResourceKinds set by spec. The kinds are passed to
+// the jobs separated by spaces, and a kind denied by the operator can't be allowed.
+func validateResourceKinds(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	for field, kinds := range map[string][]string{"allowedResourceKinds": spec.AllowedResourceKinds, "deniedResourceKinds": spec.DeniedResourceKinds} {
+		for _, kind := range kinds {
+			if kind == "" || strings.ContainsAny(kind, " \t\n/") {
+				return fmt.Errorf("%s holds an invalid kind %q", field, kind)
+			}
+		}
+	}
+	for _, kind := range spec.AllowedResourceKinds {
+		if denied := util.ClusterDeniedKind(kind); denied != "" {
+			return fmt.Errorf("allowedResourceKinds can't hold %s, the operator denies %s", kind, denied)
+		}
+	}
+	return validateClusterDeniedKinds(spec.ResourceHandlingMode, spec)
+}
+
+// validateClusterDeniedKinds rejects the GitOpsConfigs that could apply the kinds denied by the operator: the kinds
+// are skipped by the scripts of the template processor images of the operator, while another image, the None
+// handling mode, which leaves the resources to the scripts of the image, or a hook run whatever they want with the
+// service account of the jobs. mode is the resourceHandlingMode of the run.
+func validateClusterDeniedKinds(mode string, spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if !util.HasClusterDeniedKinds() {
+		return nil
+	}
+	if mode == "None" {
+		return errors.New("resourceHandlingMode can't be None, the operator denies kinds to every GitOpsConfig")
+	}
+	if image := spec.TemplateProcessorImage; image != "" && !containsString([]string{templateProcessorImage, helmImage, kustomizeImage, jsonnetImage}, image) {
+		return fmt.Errorf("templateProcessorImage can't be %s, the operator denies kinds to every GitOpsConfig, only its own images can run", image)
+	}
+	if spec.Hooks != nil && spec.Hooks.PostSync != nil {
+		return errors.New("hooks can't be run, the operator denies kinds to every GitOpsConfig")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateResourceKinds(t *testing.T) {
+	defer util.SetDeniedResourceKinds(nil)
+	util.SetDeniedResourceKinds([]string{"ClusterRoleBinding.rbac.authorization.k8s.io"})
+	tests := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		valid   bool
+	}{
+		{name: "without lists", valid: true},
+		{name: "allowed kinds", allowed: []string{"Deployment.apps", "ConfigMap"}, denied: []string{"Secret"}, valid: true},
+		{name: "kind denied by the operator", allowed: []string{"ConfigMap", "ClusterRoleBinding"}},
+		{name: "qualified kind denied by the operator", allowed: []string{"clusterrolebinding.rbac.authorization.k8s.io"}},
+		{name: "kind denied twice", denied: []string{"ClusterRoleBinding"}, valid: true},
+		{name: "empty kind", allowed: []string{""}},
+		{name: "kind with spaces", denied: []string{"Config Map"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateResourceKinds(gitopsv1alpha1.GitOpsConfigSpec{AllowedResourceKinds: tt.allowed, DeniedResourceKinds: tt.denied})
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateClusterDeniedKinds(t *testing.T) {
+	hooks := &gitopsv1alpha1.GitOpsHooks{PostSync: &gitopsv1alpha1.HookJob{}}
+	tests := []struct {
+		name  string
+		spec  gitopsv1alpha1.GitOpsConfigSpec
+		valid bool
+	}{
+		{"operator image", gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorImage: helmImage, ResourceHandlingMode: "CreateOrMerge"}, true},
+		{"defaulted image", gitopsv1alpha1.GitOpsConfigSpec{}, true},
+		// the scripts of another image don't have to skip the denied kinds
+		{"custom image", gitopsv1alpha1.GitOpsConfigSpec{TemplateProcessorImage: "quay.io/team-a/processor:v1"}, false},
+		{"None handling mode", gitopsv1alpha1.GitOpsConfigSpec{ResourceHandlingMode: "None"}, false},
+		{"hooks", gitopsv1alpha1.GitOpsConfigSpec{Hooks: hooks}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, validateResourceKinds(tt.spec), "nothing is denied by the operator")
+			util.SetDeniedResourceKinds([]string{"ClusterRoleBinding.rbac.authorization.k8s.io"})
+			defer util.SetDeniedResourceKinds(nil)
+			err := validateResourceKinds(tt.spec)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	// the None mode can't be requested for a single run either
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{runHandlingModeAnnotation: "None"}
+	mode, err := getRunHandlingMode(instance)
+	assert.NoError(t, err)
+	assert.Equal(t, "None", mode)
+	util.SetDeniedResourceKinds([]string{"ClusterRoleBinding.rbac.authorization.k8s.io"})
+	defer util.SetDeniedResourceKinds(nil)
+	_, err = getRunHandlingMode(instance)
+	assert.Error(t, err)
+}
+
+func TestJobCompletionEmitterResourceSkipped(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy(),
+		newTerminatedPod(`{"commitMessage":"Add the admins","resourcesSkipped":["clusterrolebinding/admin","secret/token"]}`))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	skipped := []string{}
+	for _, event := range drainEvents(recorder) {
+		if strings.HasPrefix(event, "Warning ResourceSkipped") {
+			skipped = append(skipped, event)
+		}
+	}
+	if assert.Len(t, skipped, 1) {
+		assert.Contains(t, skipped[0], "clusterrolebinding/admin, secret/token")
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const jobAttemptAnnotation string = "gitopsconfig.eunomia.kohls.io/attempt"
+
+// maxJobRetries is the number of times a job failing with a retryable exit
+// code is relaunched. It matches the backoffLimit used by the job templates.
+const maxJobRetries int = 4
+
+// jobRetryBaseDelay is the delay before the first retry, doubled at every further attempt
+const jobRetryBaseDelay = 10 * time.Second
+
+// jobRetryMaxDelay caps the delay between retries
+const jobRetryMaxDelay = 5 * time.Minute
+
+// shouldRetryJob decides whether a job of instance that failed with exitCode,
+// after the given number of previous attempts, must be relaunched.
+func shouldRetryJob(instance *gitopsv1alpha1.GitOpsConfig, exitCode int32, attempt int) bool {
+	if attempt >= maxJobRetries {
+		return false
+	}
+	for _, code := range instance.Spec.RetryableExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// jobRetryBackoff returns how long to wait before launching the retry following attempt
+func jobRetryBackoff(attempt int) time.Duration {
+	delay := jobRetryBaseDelay
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= jobRetryMaxDelay {
+			return jobRetryMaxDelay
+		}
+	}
+	return delay
+}
+
+// getJobAttempt returns how many times the job was already retried
+func getJobAttempt(job *batchv1.Job) int {
+	attempt, err := strconv.Atoi(job.GetAnnotations()[jobAttemptAnnotation])
+	if err != nil {
+		return 0
+	}
+	return attempt
+}
+
+// getJobExitCode returns the exit code of the template processor container
+// of the most recently terminated pod of job. The second returned value is
+// false if no terminated container could be found.
+func getJobExitCode(kubeclient client.Client, job *batchv1.Job) (int32, bool, error) {
+	terminated, err := getJobTerminatedState(kubeclient, job)
+	if err != nil || terminated == nil {
+		return 0, false, err
+	}
+	return terminated.ExitCode, true, nil
+}
+
+// getJobTerminatedState returns the state of the most recently terminated
+// container of the pods of job, or nil if none terminated yet.
+func getJobTerminatedState(kubeclient client.Client, job *batchv1.Job) (*corev1.ContainerStateTerminated, error) {
+	podList := &corev1.PodList{}
+	selector := labels.SelectorFromSet(labels.Set{"job-name": job.GetName()})
+	err := kubeclient.List(context.TODO(), &client.ListOptions{
+		Namespace:     job.GetNamespace(),
+		LabelSelector: selector,
+	}, podList)
+	if err != nil {
+		return nil, err
+	}
+	var latest *corev1.ContainerStateTerminated
+	for _, pod := range podList.Items {
+		if pod.GetLabels()["job-name"] != job.GetName() {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.State.Terminated
+			if terminated == nil {
+				continue
+			}
+			if latest == nil || latest.FinishedAt.Before(&terminated.FinishedAt) {
+				latest = terminated
+			}
+		}
+	}
+	return latest, nil
+}
+
+// retryFailedJob relaunches job after a backoff, if the GitOpsConfig owning it
+// considers the exit code of its failed pod retryable. When no retryable exit
+// codes are configured, retries are left to the backoffLimit of the job.
+// It returns true if the job was relaunched.
+func (j *jobCompletionEmitter) retryFailedJob(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) bool {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the failed job", "job", job.GetName())
+		return false
+	}
+	if len(instance.Spec.RetryableExitCodes) == 0 {
+		return false
+	}
+	exitCode, found, err := getJobExitCode(j.client, job)
+	if err != nil {
+		log.Error(err, "unable to lookup the pods of the failed job", "job", job.GetName())
+		return false
+	}
+	if !found {
+		log.Info("no terminated pod found for the failed job, not retrying", "job", job.GetName())
+		return false
+	}
+	attempt := getJobAttempt(job)
+	if !shouldRetryJob(instance, exitCode, attempt) {
+		log.Info("job failure is not retryable", "job", job.GetName(), "exitCode", exitCode, "attempt", attempt)
+		return false
+	}
+	delay := jobRetryBackoff(attempt)
+	err = j.relaunchJob(instance, job, attempt+1, delay)
+	if err != nil {
+		log.Error(err, "unable to retry the failed job", "job", job.GetName())
+		return false
+	}
+	log.Info("retrying failed job", "job", job.GetName(), "exitCode", exitCode, "attempt", attempt+1, "delay", delay)
+	return true
+}
+
+// relaunchAfter runs the relaunch of a job once its delay elapsed, in its own goroutine
+var relaunchAfter = func(delay time.Duration, relaunch func()) {
+	time.AfterFunc(delay, relaunch)
+}
+
+// retryRun returns the action, parameter file and ref of the retry of job, derived from instance: the labels and
+// annotations of job can't be trusted, anyone creating jobs can forge them. The retry runs the action instance runs
+// now, with the parameter file of its last run, and the ref of job only if the pattern ref of instance matches it.
+// It fails if the retry wouldn't run what job ran.
+func retryRun(instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job) (string, string, string, error) {
+	action := "create"
+	if instance.DeletionTimestamp != nil {
+		action = "delete"
+	}
+	if jobAction := job.GetLabels()["action"]; jobAction != action && !(jobAction == "" && action == "create") {
+		return "", "", "", fmt.Errorf("job %s ran %s, GitOpsConfig %s runs %s", job.GetName(), jobAction, instance.GetName(), action)
+	}
+	parameterFile := instance.Status.ParameterFile
+	if parameterFile == "" {
+		var err error
+		parameterFile, err = resolveParameterFile(instance, nil)
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+	var trigger *TriggerContext
+	if ref := job.GetAnnotations()[refAnnotation]; ref != "" {
+		trigger = &TriggerContext{Ref: ref}
+	}
+	ref, err := resolvePushedRef(instance, trigger)
+	if err != nil {
+		return "", "", "", err
+	}
+	return action, parameterFile, ref, nil
+}
+
+// relaunchJob creates a new job of instance retrying job, as the given attempt, after delay. It fails if the retry
+// can't be derived from instance.
+func (j *jobCompletionEmitter) relaunchJob(instance *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, attempt int, delay time.Duration) error {
+	action, parameterFile, ref, err := retryRun(instance, job)
+	if err != nil {
+		return err
+	}
+	if mode, ok := job.GetAnnotations()[runHandlingModeAnnotation]; ok {
+		// the retry runs with the resource handling mode overridden for the failed run
+		instance = instance.DeepCopy()
+		if instance.Annotations == nil {
+			instance.Annotations = map[string]string{}
+		}
+		instance.Annotations[runHandlingModeAnnotation] = mode
+	}
+	// the retry is reported as started by the trigger of the failed run
+	instance = withTrigger(instance, jobTrigger(job))
+	relaunchAfter(delay, func() {
+		r := &ReconcileGitOpsConfig{client: j.client, scheme: j.scheme, recorder: j.recorder}
+		_, err := r.createJob(action, instance, attempt, parameterFile, ref, job.GetAnnotations()[commitAnnotation])
+		if err != nil {
+			log.Error(err, "unable to retry job", "job", job.GetName())
+		}
+	})
+	return nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"sync"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// deferredRuns counts the triggers of each GitOpsConfig deferred by its minRunInterval, coalesced into the run
+// started at the end of the interval
+var deferredRuns = struct {
+	sync.Mutex
+	triggers map[types.NamespacedName]int
+}{triggers: map[types.NamespacedName]int{}}
+
+// deferRun records a trigger of instance deferred by its minRunInterval for wait. The first trigger deferred is
+// reported with a RunDeferred event, the next ones are coalesced into the same run.
+func (r *ReconcileGitOpsConfig) deferRun(instance *gitopsv1alpha1.GitOpsConfig, wait time.Duration) {
+	key := types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}
+	deferredRuns.Lock()
+	deferredRuns.triggers[key]++
+	first := deferredRuns.triggers[key] == 1
+	deferredRuns.Unlock()
+	if first {
+		r.recorder.Eventf(instance, "Normal", "RunDeferred", "Run deferred by %s, less than the minRunInterval %s elapsed since the last run", wait.Round(time.Second), instance.Spec.MinRunInterval.Duration)
+	}
+}
+
+// recordCoalescedTriggers reports with a TriggersCoalesced event the triggers of instance deferred by its
+// minRunInterval into the run being started, when there were several of them
+func (r *ReconcileGitOpsConfig) recordCoalescedTriggers(instance *gitopsv1alpha1.GitOpsConfig) {
+	key := types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}
+	deferredRuns.Lock()
+	count := deferredRuns.triggers[key]
+	delete(deferredRuns.triggers, key)
+	deferredRuns.Unlock()
+	if count > 1 {
+		r.recorder.Eventf(instance, "Normal", "TriggersCoalesced", "%d triggers received within the minRunInterval %s coalesced into a single run", count, instance.Spec.MinRunInterval.Duration)
+	}
+}
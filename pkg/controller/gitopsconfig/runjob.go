@@ -0,0 +1,46 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// RunJob returns the job the operator creates to apply the resources of instance, for a run triggered with trigger,
+// nil when it wasn't triggered by a push. The settings looked up in the cluster, e.g. the job profile or the
+// namespaces of the targetNamespaceSelector, are left out. The job templates must be initialized.
+func RunJob(instance *gitopsv1alpha1.GitOpsConfig, trigger *TriggerContext) (batchv1.Job, error) {
+	run := instance.DeepCopy()
+	defaultSources(&run.Spec)
+	if err := validateSpec(run.Spec); err != nil {
+		return batchv1.Job{}, err
+	}
+	parameterFile, err := resolveParameterFile(run, trigger)
+	if err != nil {
+		return batchv1.Job{}, err
+	}
+	run, err = withRunHandlingMode(run)
+	if err != nil {
+		return batchv1.Job{}, err
+	}
+	if trigger != nil {
+		run = withPushedRef(run, trigger.Ref)
+	}
+	return util.CreateJob(util.JobMergeData{Config: *run, Action: "create", ParameterFile: parameterFile})
+}
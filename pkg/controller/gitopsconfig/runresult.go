@@ -0,0 +1,120 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"regexp"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// The reasons of the events reporting the result of a run, on top of JobSuccessful and JobFailed.
+// They are part of the interface of the operator, alerts rely on them.
+const (
+	reasonApplied           = "Applied"
+	reasonNoChanges         = "NoChanges"
+	reasonCloneFailed       = "CloneFailed"
+	reasonRenderFailed      = "RenderFailed"
+	reasonValidationFailed  = "ValidationFailed"
+	reasonApplyFailed       = "ApplyFailed"
+	reasonHealthCheckFailed = "HealthCheckFailed"
+	reasonPruneFailed       = "PruneFailed"
+	reasonQuotaExceeded     = "QuotaExceeded"
+	// reasonVaultFailed reports the Vault secrets of the parameter values that couldn't be read
+	reasonVaultFailed = "VaultFailed"
+	// reasonSecretsFailed reports the Secrets of the secret placeholders of the manifests that couldn't be read
+	reasonSecretsFailed = "SecretsFailed"
+	// reasonForbidden reports a request the service account of the job isn't allowed to make
+	reasonForbidden = "Forbidden"
+	// reasonNamespacesFailed reports the target namespaces a job failed to apply the resources into
+	reasonNamespacesFailed = "NamespacesFailed"
+	// reasonOwnershipConflict reports the resources a job applies that other GitOpsConfigs apply too
+	reasonOwnershipConflict = "OwnershipConflict"
+	// reasonPostSyncFailed reports the post-sync hook failing a sync whose resources were applied
+	reasonPostSyncFailed = "PostSyncFailed"
+)
+
+// failureReasons maps the phases reported by the template processors to the reasons of the events of their failures
+var failureReasons = map[string]string{
+	"Clone":       reasonCloneFailed,
+	"Render":      reasonRenderFailed,
+	"Validation":  reasonValidationFailed,
+	"Apply":       reasonApplyFailed,
+	"HealthCheck": reasonHealthCheckFailed,
+	"Prune":       reasonPruneFailed,
+	"Quota":       reasonQuotaExceeded,
+	"Vault":       reasonVaultFailed,
+	"Secrets":     reasonSecretsFailed,
+}
+
+// failurePhasePattern matches the line printed by the template processor, as the last line of its logs, naming the phase that failed
+var failurePhasePattern = regexp.MustCompile(`(?m)^eunomia-phase: (\w+)\s*$`)
+
+// failurePhase returns the phase in which the job whose termination message
+// is message failed, empty if the template processor didn't tell it
+func failurePhase(message string) string {
+	matches := failurePhasePattern.FindAllStringSubmatch(message, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1][1]
+}
+
+// successReason returns the reason of the event reporting a successful run,
+// the runs whose changes are unknown are reported as Applied
+func successReason(report jobReport) string {
+	if report.Changed != nil && !*report.Changed {
+		return reasonNoChanges
+	}
+	return reasonApplied
+}
+
+// recordSuccessReason reports with a fine grained reason whether the successful job changed any resource.
+// Delete jobs are reported by their pruned resources only.
+func (j *jobCompletionEmitter) recordSuccessReason(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, report jobReport) {
+	if job.GetLabels()["action"] == "delete" {
+		return
+	}
+	switch successReason(report) {
+	case reasonNoChanges:
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Normal", reasonNoChanges, "Job %s found all the resources in sync, nothing changed", job.Name)
+	default:
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			"Normal", reasonApplied, "Job %s applied the resources", job.Name)
+	}
+}
+
+// recordFailureReason reports with a fine grained reason the phase in which job failed, if its template processor told it.
+// The failures to clone the sources are counted by the eunomia_git_clone_failures_total metric, to alert on the
+// reachability of the git hosts apart from the other failures.
+func (j *jobCompletionEmitter) recordFailureReason(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, eventType string, message string) {
+	phase := failurePhase(message)
+	reason, ok := failureReasons[phase]
+	if !ok {
+		return
+	}
+	if reason == reasonCloneFailed {
+		gitCloneFailures.WithLabelValues(owner.GetNamespace(), owner.GetName()).Inc()
+	}
+	j.recorder.AnnotatedEventf(owner,
+		map[string]string{"job": job.Name},
+		eventType, reason, "Job %s failed in the %s phase", job.Name, phase)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTerminatedPod(message string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "gitopsconfig-gitops-operator-abcde-xyz",
+			Namespace: namespace,
+			Labels:    map[string]string{"job-name": "gitopsconfig-gitops-operator-abcde"},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "template-processor",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{Message: message},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name    string
+		message string
+		reason  string
+	}{
+		{"clone", "fatal: repository 'https://github.com/URI1/URI2/' not found\neunomia-phase: Clone\n", "Warning CloneFailed"},
+		{"render", "Error: parse error in \"deployment.yaml\"\neunomia-phase: Render\n", "Warning RenderFailed"},
+		{"validation", "error validating \"deployment.yaml\": unknown field \"replica\"\neunomia-phase: Validation\n", "Warning ValidationFailed"},
+		{"apply", "Error from server (Forbidden): deployments.apps is forbidden\neunomia-phase: Apply\n", "Warning ApplyFailed"},
+		{"health check", "deployment \"frontend\" exceeded its progress deadline\neunomia-phase: HealthCheck\n", "Warning HealthCheckFailed"},
+		{"prune", "Error from server (Forbidden): services is forbidden\neunomia-phase: Prune\n", "Warning PruneFailed"},
+		{"vault", "Vault secret web/prod not found in the secret mount of https://vault:8200\neunomia-phase: Vault\n", "Warning VaultFailed"},
+		{"secrets", "Unable to inject the secret placeholders of the manifests, missing in team-a: Secret web-db\neunomia-phase: Secrets\n", "Warning SecretsFailed"},
+		{"last phase wins", "eunomia-phase: Clone\nretrying\neunomia-phase: Apply\n", "Warning ApplyFailed"},
+		{"unknown phase", "eunomia-phase: Publish\n", ""},
+		{"no phase", "Error from server (Forbidden): deployments.apps is forbidden\n", ""},
+		{"phase within a line", "the eunomia-phase: Apply line is missing\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(tt.message))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+
+			assert.Contains(t, <-recorder.Events, "Warning JobFailed")
+			if tt.reason != "" {
+				event := <-recorder.Events
+				assert.Contains(t, event, tt.reason)
+				assert.Contains(t, event, "gitopsconfig-gitops-operator-abcde")
+			}
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestCloneFailure(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name    string
+		message string
+		reason  string
+		counted float64
+	}{
+		{"unreachable host", "fatal: unable to access 'https://github.com/KohlsTechnology/eunomia.git/': Could not resolve host: github.com\neunomia-phase: Clone\n", reasonCloneFailed, 1},
+		{"cloned then failed to apply", "eunomia-phase: Clone\nretrying\neunomia-phase: Apply\n", "JobFailed", 0},
+		{"render", "Error: parse error in \"deployment.yaml\"\neunomia-phase: Render\n", "JobFailed", 0},
+		{"no phase", "fatal: unable to access 'https://github.com/KohlsTechnology/eunomia.git/'\n", "JobFailed", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(tt.message))
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+			before := testutil.ToFloat64(gitCloneFailures.WithLabelValues(namespace, name))
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+
+			assert.Equal(t, tt.counted, testutil.ToFloat64(gitCloneFailures.WithLabelValues(namespace, name))-before)
+			instance := &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance))
+			if synced := getCondition(&instance.Status, gitopsv1alpha1.ConditionSynced); assert.NotNil(t, synced) {
+				assert.Equal(t, corev1.ConditionFalse, synced.Status)
+				assert.Equal(t, tt.reason, synced.Reason)
+			}
+		})
+	}
+}
+
+func TestFailureReasonMaintenanceWindow(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	now := time.Now()
+	instance.Spec.MaintenanceWindows = []gitopsv1alpha1.MaintenanceWindow{{Start: metav1.NewTime(now.Add(-time.Hour)), End: metav1.NewTime(now.Add(time.Hour))}}
+	cl := fake.NewFakeClient(instance, newTerminatedPod("eunomia-phase: Apply\n"))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+
+	assert.Contains(t, <-recorder.Events, "Normal JobFailed")
+	assert.Contains(t, <-recorder.Events, "Normal ApplyFailed")
+}
+
+func TestSuccessReason(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	tests := []struct {
+		name   string
+		action string
+		report string
+		reason string
+	}{
+		{"changed", "create", `{"commit":"abc123","changed":true}`, "Normal Applied"},
+		{"unchanged", "create", `{"commit":"abc123","changed":false}`, "Normal NoChanges"},
+		{"unknown changes", "create", `{"commit":"abc123"}`, "Normal Applied"},
+		{"no report", "create", "", "Normal Applied"},
+		{"delete", "delete", `{"commit":"abc123","changed":false}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(tt.report))
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			oldJob := newOwnedJob(batchv1.JobStatus{Active: 1})
+			newJob := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+			oldJob.Labels["action"] = tt.action
+			newJob.Labels["action"] = tt.action
+			emitter.OnUpdate(oldJob, newJob)
+
+			assert.Contains(t, <-recorder.Events, "Normal JobSuccessful")
+			if tt.reason != "" {
+				assert.Contains(t, <-recorder.Events, tt.reason)
+			}
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// triggerAnnotation records on a job the type of the trigger that started its run, so that its events tell the
+// scheduled runs from the ones started by a change or a push
+const triggerAnnotation string = "gitopsconfig.eunomia.kohls.io/trigger"
+
+// hasScheduledTrigger returns true if instance runs on a schedule, with the CronJob of its Periodic or Time trigger
+func hasScheduledTrigger(instance *gitopsv1alpha1.GitOpsConfig) bool {
+	return util.ScheduleTrigger(*instance) != nil
+}
+
+// validateSchedule verifies that the scheduled trigger of spec, if any, can be turned into the schedule of a CronJob
+func validateSchedule(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	trigger := util.ScheduleTrigger(gitopsv1alpha1.GitOpsConfig{Spec: spec})
+	if trigger == nil {
+		return nil
+	}
+	_, err := util.CronSchedule(*trigger)
+	return err
+}
+
+// withTrigger returns instance recording that its next run is started by a trigger of type triggerType
+func withTrigger(instance *gitopsv1alpha1.GitOpsConfig, triggerType string) *gitopsv1alpha1.GitOpsConfig {
+	if triggerType == "" {
+		return instance
+	}
+	run := instance.DeepCopy()
+	if run.Annotations == nil {
+		run.Annotations = map[string]string{}
+	}
+	run.Annotations[triggerAnnotation] = triggerType
+	return run
+}
+
+// jobTrigger returns the type of the trigger that started the run of job, empty if it is unknown
+func jobTrigger(job *batchv1.Job) string {
+	if trigger := job.GetAnnotations()[triggerAnnotation]; trigger != "" {
+		return trigger
+	}
+	if ref := metav1.GetControllerOf(job); ref != nil && ref.Kind == "CronJob" {
+		// started by a cronjob created before the trigger annotation
+		return "Periodic"
+	}
+	return ""
+}
+
+// describeJob returns the name of job, telling in the events which kind of trigger started its run
+func describeJob(job *batchv1.Job) string {
+	trigger := jobTrigger(job)
+	switch {
+	case util.IsScheduledTrigger(trigger):
+		return job.GetName() + " (scheduled run)"
+	case trigger == "Webhook":
+		return job.GetName() + " (webhook run)"
+	case trigger == "Change":
+		return job.GetName() + " (change run)"
+	case trigger == "Manual":
+		return job.GetName() + " (manual run)"
+	}
+	return job.GetName()
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestTimeTrigger(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Time", Interval: &metav1.Duration{Duration: 30 * time.Minute}}}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}})
+	assert.NoError(t, err)
+	cronjob := &batchv1beta1.CronJob{}
+	err = cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-" + name, Namespace: namespace}, cronjob)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "*/30 * * * *", cronjob.Spec.Schedule)
+	assert.Equal(t, "Time", cronjob.Spec.JobTemplate.Annotations[triggerAnnotation])
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Empty(t, jobs.Items, "the runs are only started by the CronJob")
+}
+
+func TestValidateSchedule(t *testing.T) {
+	spec := gitopsv1alpha1.GitOpsConfigSpec{Triggers: []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook"}}}
+	assert.NoError(t, validateSchedule(spec))
+	spec.Triggers = append(spec.Triggers, gitopsv1alpha1.GitOpsTrigger{Type: "Time", Interval: &metav1.Duration{Duration: 7 * time.Minute}})
+	assert.EqualError(t, validateSchedule(spec), "the interval 7m0s of the Time trigger must divide an hour or a day")
+}
+
+func TestRunTriggerReachesJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}, {Type: "Webhook"}}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	SetTriggerContext(nsn, TriggerContext{Branch: "master", Commit: "0123456789abcdef"})
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	triggers := []string{}
+	for _, job := range jobs.Items {
+		triggers = append(triggers, job.Annotations[triggerAnnotation])
+	}
+	assert.ElementsMatch(t, []string{"Change", "Webhook"}, triggers)
+}
+
+func TestDescribeJob(t *testing.T) {
+	job := newOwnedJob(batchv1.JobStatus{})
+	assert.Equal(t, "gitopsconfig-gitops-operator-abcde", describeJob(job))
+	job.Annotations = map[string]string{triggerAnnotation: "Webhook"}
+	assert.Equal(t, "gitopsconfig-gitops-operator-abcde (webhook run)", describeJob(job))
+	run := newCronJobRun()
+	assert.Equal(t, "gitopsconfig-gitops-operator-1234 (scheduled run)", describeJob(run))
+	run.Annotations = map[string]string{triggerAnnotation: "Time"}
+	assert.Equal(t, "Time", jobTrigger(run))
+}
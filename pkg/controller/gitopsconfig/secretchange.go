@@ -0,0 +1,127 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"reflect"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// secretRefsIndex indexes the GitOpsConfigs by the Secrets their jobs use, as <namespace>/<name>
+const secretRefsIndex = "spec.secretRefs"
+
+// resyncOnSecretChange enables the watch on the Secrets, which caches all the Secrets the operator can read
+var resyncOnSecretChange bool
+
+// SetResyncOnSecretChange makes the GitOpsConfigs run again when a Secret their jobs use changes, e.g. when the
+// credentials of their sources are rotated
+func SetResyncOnSecretChange(enabled bool) {
+	resyncOnSecretChange = enabled
+}
+
+// referencedSecrets returns the Secrets the jobs of instance use, as <namespace>/<name>: the credentials of its
+// sources and their mirrors, the Secrets of the valuesFrom of its parameter source, of its CA bundle and of the
+// kubeconfig of its target cluster. The Secrets read by the operator itself, e.g. the webhook secret, are left out.
+func referencedSecrets(instance *gitopsv1alpha1.GitOpsConfig) []string {
+	names := sourceSecretRefs(instance)
+	for _, values := range instance.Spec.ParameterSource.ValuesFrom {
+		if values.Kind == "Secret" {
+			names = append(names, values.Name)
+		}
+	}
+	if bundle := instance.Spec.CABundle; bundle != nil && bundle.Kind == "Secret" {
+		names = append(names, bundle.Name)
+	}
+	if cluster := instance.Spec.TargetCluster; cluster != nil {
+		names = append(names, cluster.SecretRef)
+	}
+	namespace := util.JobNamespace(*instance)
+	secrets := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		secret := namespace + "/" + name
+		if !seen[secret] {
+			seen[secret] = true
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// indexSecretRefs is the indexer of secretRefsIndex
+func indexSecretRefs(object runtime.Object) []string {
+	instance, ok := object.(*gitopsv1alpha1.GitOpsConfig)
+	if !ok {
+		return nil
+	}
+	return referencedSecrets(instance)
+}
+
+// referencesSecret returns true if the jobs of instance use the Secret key
+func referencesSecret(instance *gitopsv1alpha1.GitOpsConfig, key types.NamespacedName) bool {
+	for _, secret := range referencedSecrets(instance) {
+		if secret == key.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueReferencingConfigs maps the Secrets whose data changes to the GitOpsConfigs whose jobs use them, found with
+// secretRefsIndex, so that they run again with the new data. The runs are started like for the Change trigger,
+// minRunInterval coalescing them with the other triggers.
+func enqueueReferencingConfigs(reader client.Reader) handler.EventHandler {
+	return handler.Funcs{
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			oldSecret, ok := e.ObjectOld.(*corev1.Secret)
+			if !ok {
+				return
+			}
+			newSecret, ok := e.ObjectNew.(*corev1.Secret)
+			if !ok || reflect.DeepEqual(oldSecret.Data, newSecret.Data) {
+				// only the metadata changed
+				return
+			}
+			key := types.NamespacedName{Name: newSecret.GetName(), Namespace: newSecret.GetNamespace()}
+			instances := &gitopsv1alpha1.GitOpsConfigList{}
+			if err := reader.List(context.TODO(), client.MatchingField(secretRefsIndex, key.String()), instances); err != nil {
+				log.Error(err, "unable to list the GitOpsConfigs referencing the Secret", "secret", key.String())
+				return
+			}
+			for i := range instances.Items {
+				instance := &instances.Items[i]
+				// the readers without the index ignore the field selector
+				if !referencesSecret(instance, key) {
+					continue
+				}
+				log.Info("Secret changed, running the GitOpsConfig again", "secret", key.String(), "instance", instance.GetName())
+				q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}})
+			}
+		},
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newSecret(namespace, name string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Data: data}
+}
+
+func TestReferencedSecrets(t *testing.T) {
+	instance := gitops.DeepCopy()
+	assert.Equal(t, []string{"gitops/pio"}, referencedSecrets(instance))
+	assert.Equal(t, []string{"gitops/pio"}, indexSecretRefs(instance))
+
+	instance.Spec.JobNamespace = "gitops-jobs"
+	instance.Spec.TemplateSource.MirrorSecretRefs = []gitopsv1alpha1.MirrorSecretRef{{SecretRef: "mirror"}}
+	instance.Spec.ParameterSource.ValuesFrom = []gitopsv1alpha1.ValuesReference{
+		{Kind: "ConfigMap", Name: "settings"},
+		{Kind: "Secret", Name: "passwords"},
+		{Kind: "Secret", Name: "pio"},
+	}
+	instance.Spec.CABundle = &gitopsv1alpha1.CABundleReference{Kind: "Secret", Name: "ca"}
+	instance.Spec.TargetCluster = &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote"}
+	// the Secrets read by the operator aren't used by the jobs
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook", SecretRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"}, Key: "secret"}}}
+	instance.Spec.Notification = &gitopsv1alpha1.Notification{SecretRef: "slack"}
+	assert.Equal(t, []string{"gitops-jobs/pio", "gitops-jobs/mirror", "gitops-jobs/passwords", "gitops-jobs/ca", "gitops-jobs/remote"}, referencedSecrets(instance))
+	assert.True(t, referencesSecret(instance, types.NamespacedName{Name: "remote", Namespace: "gitops-jobs"}))
+	assert.False(t, referencesSecret(instance, types.NamespacedName{Name: "remote", Namespace: namespace}))
+	assert.False(t, referencesSecret(instance, types.NamespacedName{Name: "slack", Namespace: namespace}))
+
+	assert.Nil(t, indexSecretRefs(&corev1.Secret{}))
+}
+
+func TestEnqueueReferencingConfigs(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	other := gitops.DeepCopy()
+	other.Name = "other"
+	other.Spec.TemplateSource.SecretRef = ""
+	other.Spec.ParameterSource.SecretRef = ""
+	credentials := newSecret(namespace, "pio", map[string][]byte{"token": []byte("old")})
+	cl := fake.NewFakeClient(instance, other, credentials)
+	handler := enqueueReferencingConfigs(cl)
+	rotated := newSecret(namespace, "pio", map[string][]byte{"token": []byte("new")})
+	relabeled := newSecret(namespace, "pio", map[string][]byte{"token": []byte("old")})
+	relabeled.Labels = map[string]string{"rotated": "false"}
+	unrelated := newSecret(namespace, "unrelated", map[string][]byte{"token": []byte("new")})
+
+	tests := []struct {
+		name     string
+		old, new *corev1.Secret
+		enqueued int
+	}{
+		{"referenced secret data changed", credentials, rotated, 1},
+		{"referenced secret metadata changed", credentials, relabeled, 0},
+		{"other secret changed", newSecret(namespace, "unrelated", nil), unrelated, 0},
+		{"secret of another namespace changed", newSecret("elsewhere", "pio", nil), newSecret("elsewhere", "pio", rotated.Data), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer q.ShutDown()
+			handler.Update(event.UpdateEvent{MetaOld: tt.old, ObjectOld: tt.old, MetaNew: tt.new, ObjectNew: tt.new}, q)
+			assert.Equal(t, tt.enqueued, q.Len())
+		})
+	}
+
+	// the enqueued GitOpsConfig runs again, with the rotated credentials
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+	handler.Update(event.UpdateEvent{MetaOld: credentials, ObjectOld: credentials, MetaNew: rotated, ObjectNew: rotated}, q)
+	item, _ := q.Get()
+	request := item.(reconcile.Request)
+	assert.Equal(t, types.NamespacedName{Name: name, Namespace: namespace}, request.NamespacedName)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	_, err := r.Reconcile(request)
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Len(t, jobs.Items, 1)
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/gitremote"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// defaultSemVerPollInterval is how often the SemVer range of the template source of a GitOpsConfig with a scheduled
+// trigger is resolved again, to update its CronJob with a new matching tag, when the remote polling is disabled
+const defaultSemVerPollInterval = 5 * time.Minute
+
+// isSemVerRef returns true if the ref of source is a range of tags whose highest match is deployed
+func isSemVerRef(source gitopsv1alpha1.GitConfig) bool {
+	return source.RefType == "SemVer"
+}
+
+// semVerPollInterval returns how often the SemVer range of a GitOpsConfig with a scheduled trigger is resolved again
+func semVerPollInterval() time.Duration {
+	if remotePollInterval > 0 {
+		return remotePollInterval
+	}
+	return defaultSemVerPollInterval
+}
+
+// validateSemVerRef verifies that the named source with a SemVer ref is the template source, reachable by the
+// operator to list its tags, and that its ref is a valid range
+func validateSemVerRef(source string, config gitopsv1alpha1.GitConfig) error {
+	if source != "template" {
+		return fmt.Errorf("%s source refType SemVer is only supported for the template source", source)
+	}
+	if !strings.HasPrefix(config.URI, "http://") && !strings.HasPrefix(config.URI, "https://") {
+		return fmt.Errorf("%s source refType SemVer needs an http or https uri, the tags are listed by the operator", source)
+	}
+	if _, err := gitremote.ParseConstraint(config.Ref); err != nil {
+		return fmt.Errorf("%s source ref is not a valid semver range: %s", source, err)
+	}
+	return nil
+}
+
+// MatchSourceRef returns true if the pushed ref, e.g. refs/tags/v1.4.2, is deployed by source: a tag matching its
+// SemVer range, or the branch or tag its ref designates like MatchRef, restricted to the branches or the tags by
+// its refType
+func MatchSourceRef(source gitopsv1alpha1.GitConfig, pushed string) bool {
+	switch source.RefType {
+	case "SemVer":
+		if !strings.HasPrefix(pushed, "refs/tags/") {
+			return false
+		}
+		constraint, err := gitremote.ParseConstraint(source.Ref)
+		if err != nil {
+			return false
+		}
+		version, err := gitremote.ParseVersion(strings.TrimPrefix(pushed, "refs/tags/"))
+		return err == nil && constraint.Check(version)
+	case "Branch":
+		if strings.HasPrefix(pushed, "refs/tags/") {
+			return false
+		}
+	case "Tag":
+		if strings.HasPrefix(pushed, "refs/heads/") {
+			return false
+		}
+	}
+	return MatchRef(source.Ref, pushed)
+}
+
+// resolveSemVerTag returns the highest tag of the repository of the template source of instance matching its
+// SemVer range, and the commit it points to, reading the credentials of the source with reader
+func resolveSemVerTag(reader client.Reader, instance *gitopsv1alpha1.GitOpsConfig) (string, string, error) {
+	source := instance.Spec.TemplateSource
+	constraint, err := gitremote.ParseConstraint(source.Ref)
+	if err != nil {
+		return "", "", err
+	}
+	auth, err := sourceCredentials(reader, instance)
+	if err != nil {
+		return "", "", err
+	}
+	refs, err := gitremote.ListRefs(remoteHTTPClient(source), source.URI, auth)
+	if err != nil {
+		return "", "", err
+	}
+	tag, err := refs.HighestTag(constraint)
+	if err == gitremote.ErrRefNotFound {
+		return "", "", fmt.Errorf("no tag of %s matches the semver range %q", source.URI, source.Ref)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	commit, err := refs.Resolve("refs/tags/" + tag)
+	return tag, commit, err
+}
+
+// withSemVerTag returns instance with the SemVer range of its template source resolved, deploying the highest
+// matching tag. The delete jobs delete the resources of the tag of the last run.
+func (r *ReconcileGitOpsConfig) withSemVerTag(instance *gitopsv1alpha1.GitOpsConfig, jobtype string) (*gitopsv1alpha1.GitOpsConfig, error) {
+	if !isSemVerRef(instance.Spec.TemplateSource) {
+		return instance, nil
+	}
+	tag := instance.Status.ResolvedRef
+	if jobtype != "delete" || tag == "" {
+		var err error
+		tag, _, err = resolveSemVerTag(r.jobProfileReader(), instance)
+		if err != nil {
+			log.Error(err, "unable to resolve the semver range of the template source", "instance", instance.GetName(),
+				"uri", instance.Spec.TemplateSource.URI, "ref", instance.Spec.TemplateSource.Ref)
+			return nil, err
+		}
+	}
+	run := instance.DeepCopy()
+	run.Spec.TemplateSource.Ref = tag
+	run.Spec.TemplateSource.RefType = "Tag"
+	return run, nil
+}
+
+// recordResolvedRef records in status.resolvedRef the tag the SemVer range of the template source of instance
+// resolved to for the run of run, reporting the new tags with a TagResolved event
+func (r *ReconcileGitOpsConfig) recordResolvedRef(instance, run *gitopsv1alpha1.GitOpsConfig) error {
+	if !isSemVerRef(instance.Spec.TemplateSource) || instance.Status.ResolvedRef == run.Spec.TemplateSource.Ref {
+		return nil
+	}
+	tag := run.Spec.TemplateSource.Ref
+	instance.Status.ResolvedRef = tag
+	if err := r.client.Status().Update(context.TODO(), instance); err != nil {
+		log.Error(err, "unable to record the resolved tag", "instance", instance.GetName(), "tag", tag)
+		return err
+	}
+	r.recorder.Eventf(instance, "Normal", "TagResolved", "Semver range %q resolved to tag %s", instance.Spec.TemplateSource.Ref, tag)
+	return nil
+}
+
+// semVerPoller resolves again, every semVerPollInterval, the SemVer range of the template source of the GitOpsConfigs
+// with a scheduled trigger, updating their cronjob when it resolves to a new tag. The GitOpsConfigs aren't reconciled
+// for it, their Change and Webhook triggers would start a run on every poll.
+type semVerPoller struct {
+	reconciler *ReconcileGitOpsConfig
+}
+
+var _ manager.Runnable = &semVerPoller{}
+
+// Start polls the tags of the template sources every semVerPollInterval, until stopCh is closed. The cronjobs are
+// created with the tag resolved when the GitOpsConfigs are reconciled, the first poll waits for an interval.
+func (p *semVerPoller) Start(stopCh <-chan struct{}) error {
+	ticker := time.NewTicker(semVerPollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case <-ticker.C:
+		}
+		if err := p.poll(); err != nil {
+			log.Error(err, "unable to list the GitOpsConfigs to resolve their semver range")
+		}
+	}
+}
+
+// poll updates the cronjob of every GitOpsConfig whose SemVer range resolves to a new tag, the ones that fail being
+// resolved again on the next poll
+func (p *semVerPoller) poll() error {
+	instances := &gitopsv1alpha1.GitOpsConfigList{}
+	err := p.reconciler.client.List(context.TODO(), &client.ListOptions{}, instances)
+	if err != nil {
+		return err
+	}
+	for i := range instances.Items {
+		instance := &instances.Items[i]
+		if err := p.refresh(instance); err != nil {
+			log.Error(err, "unable to update the cronjob with the semver range of the template source", "instance", instance.GetName(),
+				"uri", instance.Spec.TemplateSource.URI, "ref", instance.Spec.TemplateSource.Ref)
+		}
+	}
+	return nil
+}
+
+// refresh resolves the SemVer range of instance, updating its cronjob if the range resolves to another tag than the
+// one of its last run
+func (p *semVerPoller) refresh(instance *gitopsv1alpha1.GitOpsConfig) error {
+	if !hasScheduledTrigger(instance) || !isSemVerRef(instance.Spec.TemplateSource) || !instance.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	if _, ok := instance.GetAnnotations()[initLabel]; !ok {
+		return nil
+	}
+	tag, _, err := resolveSemVerTag(p.reconciler.jobProfileReader(), instance)
+	if err != nil {
+		return err
+	}
+	if tag == instance.Status.ResolvedRef {
+		return nil
+	}
+	log.Info("New tag matching the semver range, updating the cronjob", "instance", instance.GetName(), "tag", tag,
+		"resolvedRef", instance.Status.ResolvedRef)
+	_, err = p.reconciler.createCronJob(instance)
+	return err
+}
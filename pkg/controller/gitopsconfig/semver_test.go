@@ -0,0 +1,236 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newTagsServer serves the refs advertisement of a repository with a master branch and the *tags, each tag pointing
+// to a commit made of its first character
+func newTagsServer(tags *[]string) *httptest.Server {
+	pktLine := func(line string) string {
+		return fmt.Sprintf("%04x%s", len(line)+4, line)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		master := strings.Repeat("0", 40)
+		advertisement := pktLine("# service=git-upload-pack\n") + "0000" +
+			pktLine(master+" HEAD\x00side-band\n") + pktLine(master+" refs/heads/master\n")
+		for _, tag := range *tags {
+			advertisement += pktLine(tagCommit(tag) + " refs/tags/" + tag + "\n")
+		}
+		fmt.Fprint(w, advertisement+"0000")
+	}))
+}
+
+// tagCommit returns the commit tag points to in the repository of newTagsServer
+func tagCommit(tag string) string {
+	return strings.Repeat(fmt.Sprintf("%x", tag[len(tag)-1]), 20)
+}
+
+// envValue returns the value of the variable name of the first container of spec
+func envValue(spec corev1.PodSpec, name string) string {
+	for _, env := range spec.Containers[0].Env {
+		if env.Name == name {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+func TestValidateSemVerRef(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		config gitopsv1alpha1.GitConfig
+		err    string
+	}{
+		{name: "range", source: "template", config: gitopsv1alpha1.GitConfig{URI: "https://github.com/org/templates.git", Ref: ">=1.4.0 <2.0.0", RefType: "SemVer"}},
+		{name: "tag", source: "template", config: gitopsv1alpha1.GitConfig{URI: "git@github.com:org/templates.git", Ref: "v1.4.2", RefType: "Tag"}},
+		{name: "unknown ref type", source: "template", config: gitopsv1alpha1.GitConfig{Ref: "v1.4.2", RefType: "Version"},
+			err: `template source refType "Version" is not one of Branch, Tag, SemVer`},
+		{name: "invalid range", source: "template", config: gitopsv1alpha1.GitConfig{URI: "https://github.com/org/templates.git", Ref: ">=one", RefType: "SemVer"},
+			err: `template source ref is not a valid semver range: invalid semver range ">=one": "one" is not a semantic version`},
+		{name: "ssh", source: "template", config: gitopsv1alpha1.GitConfig{URI: "git@github.com:org/templates.git", Ref: "^1.4", RefType: "SemVer"},
+			err: "template source refType SemVer needs an http or https uri, the tags are listed by the operator"},
+		{name: "parameter source", source: "parameter", config: gitopsv1alpha1.GitConfig{URI: "https://github.com/org/params.git", Ref: "^1.4", RefType: "SemVer"},
+			err: "parameter source refType SemVer is only supported for the template source"},
+	}
+	for _, tt := range tests {
+		err := validateGitConfig(tt.source, tt.config)
+		if tt.err == "" {
+			assert.NoError(t, err, tt.name)
+		} else {
+			assert.EqualError(t, err, tt.err, tt.name)
+		}
+	}
+}
+
+func TestSemVerJob(t *testing.T) {
+	tags := []string{"v1.3.0", "v1.4.2", "v2.0.0"}
+	server := newTagsServer(&tags)
+	defer server.Close()
+
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}}
+	instance.Spec.TemplateSource = gitopsv1alpha1.GitConfig{URI: server.URL + "/repo.git", Ref: ">=1.4.0 <2.0.0", RefType: "SemVer"}
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter, "the change runs resolve the range when they start")
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		assert.Equal(t, "v1.4.2", envValue(jobs.Items[0].Spec.Template.Spec, "TEMPLATE_GIT_REF"))
+	}
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.Equal(t, "v1.4.2", updated.Status.ResolvedRef)
+	assert.Contains(t, <-recorder.Events, `Normal TagResolved Semver range ">=1.4.0 <2.0.0" resolved to tag v1.4.2`)
+
+	// the delete jobs delete the resources of the tag of the last run
+	tags = append(tags, "v1.5.0")
+	assert.NoError(t, cl.Delete(context.TODO(), &jobs.Items[0]))
+	_, err = r.CreateJob("delete", updated)
+	assert.NoError(t, err)
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		assert.Equal(t, "v1.4.2", envValue(jobs.Items[0].Spec.Template.Spec, "TEMPLATE_GIT_REF"))
+	}
+
+	// no tag matches
+	tags = []string{"v3.0.0"}
+	_, err = r.CreateJob("create", updated)
+	assert.EqualError(t, err, fmt.Sprintf("no tag of %s/repo.git matches the semver range \">=1.4.0 <2.0.0\"", server.URL))
+}
+
+func TestSemVerCronJob(t *testing.T) {
+	tags := []string{"v1.4.0"}
+	server := newTagsServer(&tags)
+	defer server.Close()
+
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+	instance.Spec.TemplateSource = gitopsv1alpha1.GitConfig{URI: server.URL + "/repo.git", Ref: "^1.4", RefType: "SemVer"}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	cronJobRef := func() string {
+		cronjob := &batchv1beta1.CronJob{}
+		err := cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-" + name, Namespace: namespace}, cronjob)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		return envValue(cronjob.Spec.JobTemplate.Spec.Template.Spec, "TEMPLATE_GIT_REF")
+	}
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter, "the range is resolved again by the poller")
+	assert.Equal(t, "v1.4.0", cronJobRef())
+
+	// the scheduled runs deploy the new matching tags once the range is resolved again
+	poller := &semVerPoller{reconciler: r}
+	tags = append(tags, "v1.6.1", "v2.0.0")
+	assert.NoError(t, poller.poll())
+	assert.Equal(t, "v1.6.1", cronJobRef())
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+	assert.Equal(t, "v1.6.1", updated.Status.ResolvedRef)
+}
+
+func TestSemVerCronJobAndChangeTrigger(t *testing.T) {
+	tags := []string{"v1.4.0"}
+	server := newTagsServer(&tags)
+	defer server.Close()
+
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	instance := gitops.DeepCopy()
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}, {Type: "Change"}}
+	instance.Spec.TemplateSource = gitopsv1alpha1.GitConfig{URI: server.URL + "/repo.git", Ref: "^1.4", RefType: "SemVer"}
+	cl := fake.NewFakeClient(instance)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	poller := &semVerPoller{reconciler: r}
+	countJobs := func() int {
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		return len(jobs.Items)
+	}
+
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter, "the config isn't reconciled again to resolve the range")
+	assert.Equal(t, 1, countJobs())
+
+	// polling the same tags starts no run, neither does a new tag, which only updates the cronjob
+	assert.NoError(t, poller.poll())
+	assert.Equal(t, 1, countJobs())
+	tags = append(tags, "v1.5.0")
+	assert.NoError(t, poller.poll())
+	assert.Equal(t, 1, countJobs())
+	cronjob := &batchv1beta1.CronJob{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-" + name, Namespace: namespace}, cronjob))
+	assert.Equal(t, "v1.5.0", envValue(cronjob.Spec.JobTemplate.Spec.Template.Spec, "TEMPLATE_GIT_REF"))
+}
+
+func TestAvailableCommitSemVer(t *testing.T) {
+	tags := []string{"v1.4.0", "v1.4.7", "v2.0.0"}
+	server := newTagsServer(&tags)
+	defer server.Close()
+
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource = gitopsv1alpha1.GitConfig{URI: server.URL + "/repo.git", Ref: "~1.4", RefType: "SemVer"}
+	cl := fake.NewFakeClient(instance)
+	poller := &remoteHeadPoller{client: cl, reader: cl}
+
+	assert.NoError(t, poller.refresh(instance))
+	assert.Equal(t, tagCommit("v1.4.7"), instance.Status.AvailableCommit)
+	tags = append(tags, "v1.4.9")
+	assert.NoError(t, poller.refresh(instance))
+	assert.Equal(t, tagCommit("v1.4.9"), instance.Status.AvailableCommit, "a new matching tag moves the available commit")
+}
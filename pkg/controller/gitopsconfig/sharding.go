@@ -0,0 +1,45 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// validateSharding verifies the parallelism and the shards of the resources, one per completion, set in the jobTemplate
+// of spec. Every pod of a sharded job applies its own shard, none can apply the canary before the other resources.
+func validateSharding(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.JobTemplate == nil {
+		return nil
+	}
+	if parallelism := spec.JobTemplate.Parallelism; parallelism != nil && *parallelism < 1 {
+		return fmt.Errorf("jobTemplate parallelism %d must be at least 1", *parallelism)
+	}
+	completions := spec.JobTemplate.Completions
+	if completions == nil {
+		return nil
+	}
+	if *completions < 1 {
+		return fmt.Errorf("jobTemplate completions %d must be at least 1", *completions)
+	}
+	if *completions > 1 && spec.Canary != nil {
+		return fmt.Errorf("jobTemplate completions %d can't be set with a canary, the shards are applied independently", *completions)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestValidateSharding(t *testing.T) {
+	count := func(n int32) *int32 { return &n }
+	canary := &gitopsv1alpha1.Canary{Namespaces: []string{"team-a"}}
+	tests := []struct {
+		name        string
+		parallelism *int32
+		completions *int32
+		canary      *gitopsv1alpha1.Canary
+		err         string
+	}{
+		{"unset", nil, nil, nil, ""},
+		{"shards", count(2), count(4), nil, ""},
+		{"single shard with a canary", nil, count(1), canary, ""},
+		{"zero parallelism", count(0), count(4), nil, "jobTemplate parallelism 0 must be at least 1"},
+		{"zero completions", nil, count(0), nil, "jobTemplate completions 0 must be at least 1"},
+		{"shards with a canary", count(2), count(4), canary, "jobTemplate completions 4 can't be set with a canary, the shards are applied independently"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := gitopsv1alpha1.GitOpsConfigSpec{
+				JobTemplate: &gitopsv1alpha1.JobTemplate{Parallelism: tt.parallelism, Completions: tt.completions},
+				Canary:      tt.canary,
+			}
+			err := validateSharding(spec)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestShardedJobSucceedsOnceAllShardsAreApplied(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	parallelism, completions := int32(2), int32(3)
+	instance.Spec.JobTemplate = &gitopsv1alpha1.JobTemplate{Parallelism: &parallelism, Completions: &completions}
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+	_, err := r.CreateJob("create", instance)
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	err = cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs)
+	assert.NoError(t, err)
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	assert.Equal(t, &parallelism, jobs.Items[0].Spec.Parallelism)
+	assert.Equal(t, &completions, jobs.Items[0].Spec.Completions)
+	drainEvents(recorder)
+
+	// the shards are applied one after the other, the job succeeding with the last one only
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	statuses := []batchv1.JobStatus{
+		{Active: 2},
+		{Active: 2, Succeeded: 1},
+		{Active: 1, Succeeded: 2},
+		{Succeeded: 3},
+	}
+	for i := 1; i < len(statuses); i++ {
+		oldJob, newJob := jobs.Items[0].DeepCopy(), jobs.Items[0].DeepCopy()
+		oldJob.Status, newJob.Status = statuses[i-1], statuses[i]
+		emitter.OnUpdate(oldJob, newJob)
+		events := drainEvents(recorder)
+		successes := 0
+		for _, event := range events {
+			if strings.HasPrefix(event, "Normal JobSuccessful") {
+				successes++
+			}
+		}
+		if i < len(statuses)-1 {
+			assert.Zero(t, successes, "%d of the %d shards applied", statuses[i].Succeeded, completions)
+		} else {
+			assert.Equal(t, 1, successes)
+		}
+	}
+}
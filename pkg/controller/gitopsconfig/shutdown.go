@@ -0,0 +1,123 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// shutdownGracePeriod is how long the operator waits, when it is terminated, for the job events in flight to be
+// processed, below the 30s the kubelet waits for the pod to stop by default
+var shutdownGracePeriod = 20 * time.Second
+
+// SetShutdownGracePeriod configures how long the operator waits, when it is terminated, for the changes of the Jobs
+// already received from the watch, e.g. a Job completion, to be processed. 0 doesn't wait.
+func SetShutdownGracePeriod(period time.Duration) {
+	shutdownGracePeriod = period
+}
+
+// pendingWaiter is implemented by the handlers processing the events after the informer called them
+type pendingWaiter interface {
+	// waitPending returns once the events received were processed
+	waitPending()
+}
+
+// drainingHandler passes the changes of the Jobs to handler until it is
+// stopped, keeping count of the calls in flight so that the shutdown lets
+// them finish, e.g. the status of a GitOpsConfig being patched.
+type drainingHandler struct {
+	handler  cache.ResourceEventHandler
+	mu       sync.RWMutex
+	stopped  bool
+	inFlight sync.WaitGroup
+}
+
+var _ cache.ResourceEventHandler = &drainingHandler{}
+
+func (d *drainingHandler) OnAdd(obj interface{}) {
+	if !d.begin() {
+		return
+	}
+	defer d.inFlight.Done()
+	d.handler.OnAdd(obj)
+}
+
+func (d *drainingHandler) OnUpdate(oldObj, newObj interface{}) {
+	if !d.begin() {
+		return
+	}
+	defer d.inFlight.Done()
+	d.handler.OnUpdate(oldObj, newObj)
+}
+
+func (d *drainingHandler) OnDelete(obj interface{}) {
+	if !d.begin() {
+		return
+	}
+	defer d.inFlight.Done()
+	d.handler.OnDelete(obj)
+}
+
+// begin counts a call in flight, it returns false once the handler is stopped
+func (d *drainingHandler) begin() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.stopped {
+		return false
+	}
+	d.inFlight.Add(1)
+	return true
+}
+
+// drain refuses the new events and waits for the calls in flight, and the
+// events they queued, to be processed, at most grace. It returns false if
+// they weren't all processed in time.
+func (d *drainingHandler) drain(grace time.Duration) bool {
+	d.mu.Lock()
+	d.stopped = true
+	d.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		if waiter, ok := d.handler.(pendingWaiter); ok {
+			waiter.waitPending()
+		}
+		close(done)
+	}()
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// WaitForJobWatchDrained waits, once the manager was stopped, for the watch
+// on Jobs to stop and the changes of the Jobs it received to be processed, at
+// most the shutdown grace period. It returns right away if the watch never
+// started, e.g. the operator wasn't the leader.
+func WaitForJobWatchDrained() {
+	if runningWatchdog == nil {
+		return
+	}
+	runningWatchdog.waitDrained(shutdownGracePeriod)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+// blockingHandler returns a handler recording the jobs it processed, blocking on the jobs named blocked until release
+// is closed, and a channel receiving the jobs it starts processing
+func blockingHandler(blocked string, release chan struct{}) (cache.ResourceEventHandler, chan string, func() []string) {
+	var mu sync.Mutex
+	processed := []string{}
+	entered := make(chan string, 10)
+	handler := handlerFunc(func(obj interface{}) {
+		job := obj.(*batchv1.Job)
+		entered <- job.Name
+		if job.Name == blocked {
+			<-release
+		}
+		mu.Lock()
+		processed = append(processed, job.Name)
+		mu.Unlock()
+	})
+	return handler, entered, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, processed...)
+	}
+}
+
+func TestShutdownMidHandler(t *testing.T) {
+	release := make(chan struct{})
+	handler, entered, processed := blockingHandler("gitopsconfig-a-1", release)
+	stopped := false
+	w := &jobWatchdog{
+		start: func() (cache.Store, cache.InformerSynced, func(), error) {
+			return cache.NewStore(cache.MetaNamespaceKeyFunc), func() bool { return true }, func() { stopped = true }, nil
+		},
+		interval: time.Hour,
+		handler:  &drainingHandler{handler: handler},
+		drained:  make(chan struct{}),
+	}
+	stopCh := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- w.Start(stopCh) }()
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.started, nil
+	}), "the watch starts")
+
+	// the completion of a job is being processed when the operator is terminated
+	go w.handler.OnUpdate(&batchv1.Job{}, newConfigJob("a", 1))
+	assert.Equal(t, "gitopsconfig-a-1", <-entered)
+	close(stopCh)
+
+	drained := make(chan struct{})
+	go func() {
+		w.waitDrained(time.Minute)
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		t.Fatal("the shutdown didn't wait for the event in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the events received once the shutdown started are refused
+	w.handler.OnUpdate(&batchv1.Job{}, newConfigJob("b", 1))
+	close(release)
+	<-drained
+	assert.NoError(t, <-done)
+	assert.True(t, stopped, "the watch is stopped")
+	assert.Equal(t, []string{"gitopsconfig-a-1"}, processed())
+
+	// the watch of a replica that wasn't the leader never started
+	assert.NotPanics(t, WaitForJobWatchDrained)
+	w.started = false
+	w.waitDrained(time.Minute)
+}
+
+func TestShutdownGracePeriod(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler, entered, processed := blockingHandler("gitopsconfig-a-1", release)
+	draining := &drainingHandler{handler: handler}
+
+	go draining.OnUpdate(&batchv1.Job{}, newConfigJob("a", 1))
+	<-entered
+	// the event still in flight after the grace period is abandoned
+	assert.False(t, draining.drain(50*time.Millisecond))
+	assert.Empty(t, processed())
+
+	// a drain without event in flight returns right away
+	assert.True(t, (&drainingHandler{handler: handler}).drain(time.Second))
+}
+
+func TestShutdownDrainsDispatcher(t *testing.T) {
+	release := make(chan struct{})
+	handler, entered, processed := blockingHandler("gitopsconfig-a-1", release)
+	dispatcher, stop := startDispatcher(handler, 2)
+	draining := &drainingHandler{handler: dispatcher}
+
+	// the events of a GitOpsConfig are queued behind the one being processed
+	draining.OnUpdate(&batchv1.Job{}, newConfigJob("a", 1))
+	draining.OnUpdate(&batchv1.Job{}, newConfigJob("a", 2))
+	<-entered
+	stop()
+
+	drained := make(chan bool)
+	go func() { drained <- draining.drain(time.Minute) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	assert.True(t, <-drained)
+	assert.Equal(t, []string{"gitopsconfig-a-1", "gitopsconfig-a-2"}, processed(), "the queued events are processed after the stop")
+}
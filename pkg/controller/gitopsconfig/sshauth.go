@@ -0,0 +1,89 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// invalidSecret returns why the first Secret referenced by the sources of instance can't be used to clone
+// them, or an empty string if they can. The missing Secrets are left to waitForDependencies.
+func (r *ReconcileGitOpsConfig) invalidSecret(instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	for _, name := range sourceSecretRefs(instance) {
+		secret := &corev1.Secret{}
+		key := types.NamespacedName{Name: name, Namespace: util.JobNamespace(*instance)}
+		err := r.jobProfileReader().Get(context.TODO(), key, secret)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		// the deploy keys are mounted with the other files of the secret, gitClone.sh uses them for the git@ URIs
+		if secret.Type == corev1.SecretTypeSSHAuth && len(secret.Data[corev1.SSHAuthPrivateKey]) == 0 {
+			return fmt.Sprintf("Secret %s of type %s has no %s key", name, corev1.SecretTypeSSHAuth, corev1.SSHAuthPrivateKey), nil
+		}
+	}
+	return "", nil
+}
+
+// validateSecrets fails if a Secret referenced by instance can't be used to clone its sources, the jobs would
+// fail to clone them. The InvalidSecret condition of instance tells why.
+func (r *ReconcileGitOpsConfig) validateSecrets(instance *gitopsv1alpha1.GitOpsConfig) error {
+	invalid, err := r.invalidSecret(instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the secrets of the GitOpsConfig", "instance", instance.GetName())
+		return err
+	}
+	if invalid == "" {
+		if !isConditionTrue(&instance.Status, gitopsv1alpha1.ConditionInvalidSecret) {
+			return nil
+		}
+		setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionInvalidSecret,
+			Status:  corev1.ConditionFalse,
+			Reason:  "SecretsValid",
+			Message: "The referenced Secrets can be used to clone the sources",
+		})
+		if err = r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return err
+		}
+		return nil
+	}
+	changed := setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionInvalidSecret,
+		Status:  corev1.ConditionTrue,
+		Reason:  "MissingSSHPrivateKey",
+		Message: invalid,
+	})
+	if changed {
+		if err = r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return err
+		}
+		r.recorder.Eventf(instance, "Warning", "InvalidSecret", "Runs not started: %s", invalid)
+	}
+	return fmt.Errorf("invalid secret: %s", invalid)
+}
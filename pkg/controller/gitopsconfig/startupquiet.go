@@ -0,0 +1,98 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+var (
+	// operatorStart is when the operator started
+	operatorStart = time.Now()
+	// startupQuietWindow is how long after operatorStart the events of the jobs finished before it aren't recorded, zero disables it
+	startupQuietWindow time.Duration
+)
+
+// SetStartupQuietWindow configures how long after the start of the operator
+// the events of the jobs that finished before it are not recorded again
+func SetStartupQuietWindow(window time.Duration) {
+	startupQuietWindow = window
+}
+
+// isStaleCompletion returns true if job finished before the operator started
+// and now is still within the startup quiet window, so that the events of its
+// completion, already recorded by the previous operator, aren't recorded again
+func isStaleCompletion(job *batchv1.Job, now time.Time) bool {
+	if startupQuietWindow <= 0 || !now.Before(operatorStart.Add(startupQuietWindow)) {
+		return false
+	}
+	finished, ok := jobFinishTime(job)
+	return ok && finished.Before(operatorStart)
+}
+
+// jobFinishTime returns when job finished: its completion time if it
+// succeeded, the time it was marked failed otherwise
+func jobFinishTime(job *batchv1.Job) (time.Time, bool) {
+	if job.Status.CompletionTime != nil {
+		return job.Status.CompletionTime.Time, true
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && !condition.LastTransitionTime.IsZero() {
+			return condition.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// withoutEvents returns a copy of j discarding its events, handling the
+// completion of a job like j otherwise. The jobs claimed by j aren't shared, the
+// completion must be claimed before.
+func (j *jobCompletionEmitter) withoutEvents() *jobCompletionEmitter {
+	return &jobCompletionEmitter{
+		client:       j.client,
+		scheme:       j.scheme,
+		recorder:     quietRecorder{},
+		audit:        j.audit,
+		secretReader: j.secretReader,
+		clientset:    j.clientset,
+	}
+}
+
+// quietRecorder is an event recorder discarding all the events
+type quietRecorder struct{}
+
+var _ record.EventRecorder = quietRecorder{}
+
+// Event discards the event
+func (quietRecorder) Event(object runtime.Object, eventtype, reason, message string) {}
+
+// Eventf discards the event
+func (quietRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+// PastEventf discards the event
+func (quietRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+// AnnotatedEventf discards the event
+func (quietRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+}
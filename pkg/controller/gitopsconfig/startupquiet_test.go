@@ -0,0 +1,95 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func succeededAt(finished time.Time) batchv1.JobStatus {
+	completion := metav1.NewTime(finished)
+	return batchv1.JobStatus{Succeeded: 1, CompletionTime: &completion}
+}
+
+func failedAt(finished time.Time) batchv1.JobStatus {
+	return batchv1.JobStatus{
+		Failed: 1,
+		Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(finished)},
+		},
+	}
+}
+
+func TestStartupQuietWindow(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	defer func(start time.Time, window time.Duration) {
+		operatorStart = start
+		startupQuietWindow = window
+	}(operatorStart, startupQuietWindow)
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		start  time.Time
+		window time.Duration
+		status batchv1.JobStatus
+		event  string
+		result string
+	}{
+		{"succeeded before start", now.Add(-time.Minute), 5 * time.Minute, succeededAt(now.Add(-time.Hour)), "", "Success"},
+		{"failed before start", now.Add(-time.Minute), 5 * time.Minute, failedAt(now.Add(-time.Hour)), "", "Failed"},
+		{"succeeded after start", now.Add(-time.Minute), 5 * time.Minute, succeededAt(now), "Normal JobSuccessful", "Success"},
+		{"failed after start", now.Add(-time.Minute), 5 * time.Minute, failedAt(now), "Warning JobFailed", "Failed"},
+		{"unknown finish time", now.Add(-time.Minute), 5 * time.Minute, batchv1.JobStatus{Succeeded: 1}, "Normal JobSuccessful", "Success"},
+		{"window elapsed", now.Add(-time.Hour), 5 * time.Minute, succeededAt(now.Add(-2 * time.Hour)), "Normal JobSuccessful", "Success"},
+		{"window disabled", now.Add(-time.Minute), 0, succeededAt(now.Add(-time.Hour)), "Normal JobSuccessful", "Success"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operatorStart = tt.start
+			SetStartupQuietWindow(tt.window)
+			cl := fake.NewFakeClient(gitops.DeepCopy())
+			recorder := record.NewFakeRecorder(10)
+			emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+			emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(tt.status))
+
+			// the completion is handled even when its events aren't recorded
+			instance := &gitopsv1alpha1.GitOpsConfig{}
+			err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, instance)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.result, instance.Status.LastSyncResult)
+			if tt.event == "" {
+				assert.Empty(t, drainEvents(recorder))
+				return
+			}
+			assert.Contains(t, <-recorder.Events, tt.event)
+		})
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// suspendPollInterval is how often the kill switch ConfigMap is looked up
+const suspendPollInterval = 5 * time.Second
+
+var (
+	// suspendConfigMap is the ConfigMap whose existence suspends all the jobs, an empty name disables the kill switch
+	suspendConfigMap types.NamespacedName
+	// suspended is 1 while the kill switch is engaged
+	suspended int32
+
+	errSuspended = goerrors.New("all the jobs are suspended by the kill switch")
+	// errConfigSuspended is returned when a job of a GitOpsConfig whose spec.suspend is set would be created
+	errConfigSuspended = goerrors.New("the jobs of the GitOpsConfig are suspended by spec.suspend")
+)
+
+// SetSuspendConfigMap configures the ConfigMap acting as a kill switch: while it
+// exists, no job of any GitOpsConfig is created and all the cronjobs are suspended
+func SetSuspendConfigMap(name types.NamespacedName) {
+	suspendConfigMap = name
+}
+
+// isSuspended returns true while the kill switch is engaged
+func isSuspended() bool {
+	return atomic.LoadInt32(&suspended) == 1
+}
+
+// setSuspended records whether the kill switch is engaged, returning true if it changed
+func setSuspended(engaged bool) bool {
+	value := int32(0)
+	if engaged {
+		value = 1
+	}
+	return atomic.SwapInt32(&suspended, value) != value
+}
+
+// suspendWatcher polls the kill switch ConfigMap, suspending or resuming all the GitOpsConfigs when it is created or deleted
+type suspendWatcher struct {
+	client   client.Client
+	reader   client.Reader
+	recorder record.EventRecorder
+	// synced is true once the GitOpsConfigs reflect the state of the kill switch
+	synced bool
+}
+
+var _ manager.Runnable = &suspendWatcher{}
+
+// Start polls the kill switch every suspendPollInterval, until stopCh is closed
+func (w *suspendWatcher) Start(stopCh <-chan struct{}) error {
+	ticker := time.NewTicker(suspendPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.poll(); err != nil {
+			log.Error(err, "unable to check the kill switch", "configmap", suspendConfigMap.String())
+		}
+		select {
+		case <-stopCh:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll looks up the kill switch once, updating all the GitOpsConfigs if its state changed
+func (w *suspendWatcher) poll() error {
+	err := w.reader.Get(context.TODO(), suspendConfigMap, &corev1.ConfigMap{})
+	if err != nil && !errors.IsNotFound(err) {
+		// the previous state is kept, a flaky API server must not release the brake
+		return err
+	}
+	engaged := err == nil
+	if !setSuspended(engaged) && w.synced {
+		return nil
+	}
+	if engaged {
+		log.Info("Kill switch engaged, suspending all the jobs", "configmap", suspendConfigMap.String())
+	} else if w.synced {
+		log.Info("Kill switch cleared, resuming all the jobs", "configmap", suspendConfigMap.String())
+	}
+	instances := &gitopsv1alpha1.GitOpsConfigList{}
+	err = w.client.List(context.TODO(), &client.ListOptions{}, instances)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for i := range instances.Items {
+		err = w.applySuspended(&instances.Items[i], engaged)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	// the GitOpsConfigs that failed are updated again on the next poll
+	w.synced = firstErr == nil
+	return firstErr
+}
+
+// applySuspended suspends or resumes the cronjob of instance and records the kill switch in its Suspended condition
+func (w *suspendWatcher) applySuspended(instance *gitopsv1alpha1.GitOpsConfig, engaged bool) error {
+	// the cronjob of a paused, quarantined or suspended instance stays suspended
+	err := suspendCronJobs(w.client, instance, engaged || isPaused(instance) || isQuarantined(instance) || instance.Spec.Suspend)
+	if err != nil {
+		return err
+	}
+	return recordSuspended(w.client, w.recorder, instance, engaged)
+}
+
+// suspendCronJobs suspends or resumes the cronjobs of instance
+func suspendCronJobs(c client.Client, instance *gitopsv1alpha1.GitOpsConfig, suspend bool) error {
+	cronjobs := &batchv1beta1.CronJobList{}
+	err := c.List(context.TODO(), &client.ListOptions{Namespace: util.JobNamespace(*instance)}, cronjobs)
+	if err != nil {
+		return err
+	}
+	for i := range cronjobs.Items {
+		cronjob := &cronjobs.Items[i]
+		if owner := metav1.GetControllerOf(cronjob); (owner == nil || owner.UID != instance.GetUID()) && !isAnnotatedOwner(instance, cronjob) {
+			continue
+		}
+		if cronjob.Spec.Suspend != nil && *cronjob.Spec.Suspend == suspend {
+			continue
+		}
+		cronjob.Spec.Suspend = &suspend
+		err = c.Update(context.TODO(), cronjob)
+		if err != nil {
+			log.Error(err, "unable to update the cronjob", "cronjob", cronjob.GetName())
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSuspended sets the Suspended condition of instance from the kill switch and its spec.suspend, with an event
+// when it changes
+func recordSuspended(c client.Client, recorder record.EventRecorder, instance *gitopsv1alpha1.GitOpsConfig, engaged bool) error {
+	condition := gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionSuspended,
+		Status:  corev1.ConditionFalse,
+		Reason:  "KillSwitchCleared",
+		Message: "Jobs are allowed to run",
+	}
+	previous := getCondition(&instance.Status, gitopsv1alpha1.ConditionSuspended)
+	switch {
+	case engaged:
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = "KillSwitchEngaged"
+		condition.Message = fmt.Sprintf("All the jobs are suspended while the ConfigMap %s exists", suspendConfigMap.String())
+	case instance.Spec.Suspend:
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = "SpecSuspended"
+		condition.Message = "The jobs of this configuration are suspended while spec.suspend is set"
+	case previous == nil:
+		// the configurations that were never suspended don't need the condition
+		return nil
+	case previous.Reason == "SpecSuspended":
+		condition.Reason = "SpecResumed"
+	}
+	if !setCondition(&instance.Status, condition) {
+		return nil
+	}
+	err := c.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+		return err
+	}
+	switch condition.Reason {
+	case "KillSwitchEngaged":
+		recorder.Event(instance, "Warning", "Suspended", condition.Message)
+	case "SpecSuspended":
+		recorder.Event(instance, "Normal", "Suspended", condition.Message)
+	case "SpecResumed":
+		recorder.Event(instance, "Normal", "Unsuspended", "Jobs resumed after spec.suspend was cleared")
+	default:
+		recorder.Event(instance, "Normal", "Unsuspended", "Jobs resumed after the kill switch was cleared")
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestKillSwitch(t *testing.T) {
+	killSwitch := types.NamespacedName{Namespace: "eunomia-operator", Name: "eunomia-suspend"}
+	SetSuspendConfigMap(killSwitch)
+	defer func() {
+		SetSuspendConfigMap(types.NamespacedName{})
+		setSuspended(false)
+	}()
+
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	instance := gitops.DeepCopy()
+	instance.UID = "1234"
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}, {Type: "Change"}}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: killSwitch.Name, Namespace: killSwitch.Namespace}}
+	cl := fake.NewFakeClient(instance, configMap)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	watcher := &suspendWatcher{client: cl, reader: cl, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+	assertState := func(engaged bool, jobCount int) {
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		assert.Len(t, jobs.Items, jobCount)
+		cronjob := &batchv1beta1.CronJob{}
+		assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator", Namespace: namespace}, cronjob))
+		if assert.NotNil(t, cronjob.Spec.Suspend) {
+			assert.Equal(t, engaged, *cronjob.Spec.Suspend)
+		}
+		updated := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+		assert.Equal(t, engaged, isConditionTrue(&updated.Status, gitopsv1alpha1.ConditionSuspended))
+	}
+
+	// no job is launched while the kill switch is engaged
+	assert.NoError(t, watcher.poll())
+	assert.True(t, isSuspended())
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assertState(true, 0)
+	assert.Contains(t, <-recorder.Events, "Warning Suspended")
+	_, err = r.createJob("create", instance, 1, "", "", "")
+	assert.Equal(t, errSuspended, err)
+	assertState(true, 0)
+
+	// clearing the kill switch resumes the cronjob and the jobs
+	assert.NoError(t, cl.Delete(context.TODO(), configMap))
+	assert.NoError(t, watcher.poll())
+	assert.False(t, isSuspended())
+	assert.Contains(t, <-recorder.Events, "Normal Unsuspended")
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assertState(false, 1)
+}
+
+func TestKillSwitchNeverEngaged(t *testing.T) {
+	killSwitch := types.NamespacedName{Namespace: "eunomia-operator", Name: "eunomia-suspend"}
+	SetSuspendConfigMap(killSwitch)
+	defer SetSuspendConfigMap(types.NamespacedName{})
+
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	watcher := &suspendWatcher{client: cl, reader: cl, recorder: record.NewFakeRecorder(10)}
+	assert.NoError(t, watcher.poll())
+	assert.False(t, isSuspended())
+
+	// the configurations that were never suspended don't get the condition
+	updated := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, updated))
+	assert.Empty(t, updated.Status.Conditions)
+}
+
+func TestSpecSuspend(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	instance := gitops.DeepCopy()
+	instance.UID = "1234"
+	instance.Annotations = map[string]string{initLabel: "true"}
+	instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}, {Type: "Change"}}
+	instance.Spec.Suspend = true
+	cl := fake.NewFakeClient(instance)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+	assertState := func(suspended bool, reason string, jobCount int) {
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		assert.Len(t, jobs.Items, jobCount)
+		cronjob := &batchv1beta1.CronJob{}
+		assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "gitopsconfig-gitops-operator", Namespace: namespace}, cronjob))
+		if assert.NotNil(t, cronjob.Spec.Suspend) {
+			assert.Equal(t, suspended, *cronjob.Spec.Suspend)
+		}
+		updated := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), nsn, updated))
+		condition := getCondition(&updated.Status, gitopsv1alpha1.ConditionSuspended)
+		if assert.NotNil(t, condition) {
+			assert.Equal(t, suspended, condition.Status == corev1.ConditionTrue)
+			assert.Equal(t, reason, condition.Reason)
+		}
+	}
+
+	// no job is launched while spec.suspend is set
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assertState(true, "SpecSuspended", 0)
+	assert.Contains(t, <-recorder.Events, "Normal Suspended")
+	_, err = r.createJob("create", instance, 1, "", "", "")
+	assert.Equal(t, errConfigSuspended, err)
+	assertState(true, "SpecSuspended", 0)
+
+	// clearing spec.suspend resumes the cronjob and the jobs
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	instance.Spec.Suspend = false
+	assert.NoError(t, cl.Update(context.TODO(), instance))
+	_, err = r.Reconcile(reconcile.Request{NamespacedName: nsn})
+	assert.NoError(t, err)
+	assertState(false, "SpecResumed", 1)
+	assert.Contains(t, <-recorder.Events, "Normal Unsuspended")
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// syncEventBuffer is how many sync events a subscriber may lag behind, the next ones being dropped for it
+const syncEventBuffer = 64
+
+// SyncEvent is a JobStarted, JobSuccessful, JobFailed, PostSyncFailed or DryRunCompleted event recorded on a
+// GitOpsConfig by the job watch, streamed to the subscribers of the sync events
+type SyncEvent struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Job       string    `json:"job"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+// syncEvents broadcasts the sync events to their subscribers
+var syncEvents = &syncEventBroadcaster{subscribers: map[*syncEventSubscriber]bool{}}
+
+// SetMaxSyncEventSubscribers caps the subscribers of the sync events, zero
+// refusing them all
+func SetMaxSyncEventSubscribers(max int) {
+	syncEvents.lock.Lock()
+	defer syncEvents.lock.Unlock()
+	syncEvents.max = max
+}
+
+// SubscribeSyncEvents returns the channel receiving the next sync events of
+// the GitOpsConfig name of namespace, an empty namespace or name matching them
+// all, and the function ending the subscription, which closes the channel. It
+// fails when the subscribers are already as many as allowed.
+func SubscribeSyncEvents(namespace, name string) (<-chan SyncEvent, func(), error) {
+	return syncEvents.subscribe(namespace, name, true)
+}
+
+// WatchSyncEvents is SubscribeSyncEvents for the webhook calls waiting for the
+// runs they trigger, which don't count against the most subscribers allowed
+func WatchSyncEvents(namespace, name string) (<-chan SyncEvent, func(), error) {
+	return syncEvents.subscribe(namespace, name, false)
+}
+
+// syncEventBroadcaster sends the sync events to the subscribers they match
+type syncEventBroadcaster struct {
+	lock        sync.Mutex
+	max         int
+	subscribers map[*syncEventSubscriber]bool
+}
+
+// syncEventSubscriber receives the sync events of the GitOpsConfigs matching its namespace and name
+type syncEventSubscriber struct {
+	namespace string
+	name      string
+	events    chan SyncEvent
+	// capped is true for the subscribers counted against the most allowed
+	capped bool
+	// dropped is true while the events of a lagging subscriber are being dropped, so that it is only logged once
+	dropped bool
+}
+
+func (b *syncEventBroadcaster) subscribe(namespace, name string, capped bool) (<-chan SyncEvent, func(), error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if capped {
+		count := 0
+		for subscriber := range b.subscribers {
+			if subscriber.capped {
+				count++
+			}
+		}
+		if count >= b.max {
+			return nil, nil, fmt.Errorf("the sync events already have %d subscribers, the most allowed", count)
+		}
+	}
+	subscriber := &syncEventSubscriber{namespace: namespace, name: name, events: make(chan SyncEvent, syncEventBuffer), capped: capped}
+	b.subscribers[subscriber] = true
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			delete(b.subscribers, subscriber)
+			close(subscriber.events)
+		})
+	}
+	return subscriber.events, unsubscribe, nil
+}
+
+// publish sends event to the subscribers it matches, without waiting for the lagging ones
+func (b *syncEventBroadcaster) publish(event SyncEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for subscriber := range b.subscribers {
+		if (subscriber.namespace != "" && subscriber.namespace != event.Namespace) || (subscriber.name != "" && subscriber.name != event.Name) {
+			continue
+		}
+		select {
+		case subscriber.events <- event:
+			subscriber.dropped = false
+		default:
+			if !subscriber.dropped {
+				log.Info("Dropping the sync events of a lagging subscriber", "buffer", syncEventBuffer)
+				subscriber.dropped = true
+			}
+		}
+	}
+}
+
+// publishSyncEvent streams the event recorded on owner for job to the subscribers of the sync events
+func publishSyncEvent(owner *gitopsv1alpha1.GitOpsConfig, job, eventType, reason, message string) {
+	syncEvents.publish(SyncEvent{
+		Namespace: owner.GetNamespace(),
+		Name:      owner.GetName(),
+		Job:       job,
+		Type:      eventType,
+		Reason:    reason,
+		Message:   message,
+		Time:      time.Now(),
+	})
+}
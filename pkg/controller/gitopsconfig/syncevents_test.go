@@ -0,0 +1,109 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// receiveSyncEvents returns the sync events already sent to events
+func receiveSyncEvents(events <-chan SyncEvent) []SyncEvent {
+	received := []SyncEvent{}
+	for {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		default:
+			return received
+		}
+	}
+}
+
+func TestSyncEventsStreamed(t *testing.T) {
+	defer SetMaxSyncEventSubscribers(0)
+	SetMaxSyncEventSubscribers(2)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(20)}
+
+	events, unsubscribe, err := SubscribeSyncEvents(namespace, name)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer unsubscribe()
+	others, unsubscribeOthers, err := SubscribeSyncEvents(namespace, "other")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the subscribers are capped, the webhook calls waiting for their runs aren't
+	_, _, err = SubscribeSyncEvents("", "")
+	assert.EqualError(t, err, "the sync events already have 2 subscribers, the most allowed")
+	waiting, unsubscribeWaiting, err := WatchSyncEvents(namespace, name)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer unsubscribeWaiting()
+
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{}), newOwnedJob(batchv1.JobStatus{Active: 1}))
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	received := receiveSyncEvents(events)
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, "JobStarted", received[0].Reason)
+		assert.Equal(t, "JobFailed", received[1].Reason)
+		assert.Equal(t, "Warning", received[1].Type)
+		assert.Equal(t, namespace, received[1].Namespace)
+		assert.Equal(t, name, received[1].Name)
+		assert.Equal(t, "gitopsconfig-gitops-operator-abcde", received[1].Job)
+		assert.Contains(t, received[1].Message, "Job failed: ")
+	}
+	assert.Equal(t, received, receiveSyncEvents(waiting))
+	// the subscribers only receive the events of the GitOpsConfigs they filter
+	assert.Empty(t, receiveSyncEvents(others))
+
+	// an unsubscribed client frees its place, its channel is closed
+	unsubscribeOthers()
+	unsubscribeOthers()
+	_, ok := <-others
+	assert.False(t, ok)
+	_, unsubscribeAll, err := SubscribeSyncEvents("", "")
+	assert.NoError(t, err)
+	unsubscribeAll()
+}
+
+func TestSyncEventsLaggingSubscriber(t *testing.T) {
+	broadcaster := &syncEventBroadcaster{max: 1, subscribers: map[*syncEventSubscriber]bool{}}
+	events, unsubscribe, err := broadcaster.subscribe("", "", true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer unsubscribe()
+	// the events above the buffer of a subscriber that doesn't read them are dropped, without blocking the job watch
+	for i := 0; i < syncEventBuffer+10; i++ {
+		broadcaster.publish(SyncEvent{Namespace: namespace, Name: name, Reason: "JobStarted"})
+	}
+	assert.Len(t, receiveSyncEvents(events), syncEventBuffer)
+	broadcaster.publish(SyncEvent{Namespace: namespace, Name: name, Reason: "JobSuccessful"})
+	assert.Equal(t, []SyncEvent{{Namespace: namespace, Name: name, Reason: "JobSuccessful"}}, receiveSyncEvents(events))
+}
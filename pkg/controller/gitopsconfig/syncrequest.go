@@ -0,0 +1,61 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// syncAnnotation set on a GitOpsConfig, or changed to a new value, e.g. the current time, starts a run right away
+// whatever its triggers, e.g. to retry a run that failed on a transient error
+const syncAnnotation string = "gitopsconfig.eunomia.kohls.io/sync"
+
+// isSyncRequested returns true if the sync annotation of instance holds a value no run was started for yet
+func isSyncRequested(instance *gitopsv1alpha1.GitOpsConfig) bool {
+	request := instance.GetAnnotations()[syncAnnotation]
+	return request != "" && request != instance.Status.LastSyncRequest
+}
+
+// syncOnRequest starts the run requested with the sync annotation of instance, with the parameter file of its last
+// run, and records in its status that it was started, so that the next reconciles don't start it again. It returns
+// how long the run must wait for the active jobs of instance, with the Forbid concurrency policy.
+func (r *ReconcileGitOpsConfig) syncOnRequest(instance *gitopsv1alpha1.GitOpsConfig) (time.Duration, error) {
+	wait, err := r.applyConcurrencyPolicy(instance)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	if wait = r.waitForJobSlot(instance); wait > 0 {
+		return wait, nil
+	}
+	request := instance.GetAnnotations()[syncAnnotation]
+	log.Info("Instance has a sync request, creating job", "instance", instance.GetName(), "request", request)
+	_, err = r.CreateJob("create", withTrigger(instance, "Manual"))
+	if err != nil {
+		releaseJobSlot(instance)
+		return 0, err
+	}
+	instance.Status.LastSyncRequest = request
+	err = r.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to record the sync request of the GitOpsConfig", "instance", instance.GetName())
+		return 0, err
+	}
+	return 0, r.clearRunHandlingMode(instance)
+}
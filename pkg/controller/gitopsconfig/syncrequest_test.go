@@ -0,0 +1,107 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestIsSyncRequested(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Annotations = nil
+	assert.False(t, isSyncRequested(instance))
+	instance.Annotations = map[string]string{syncAnnotation: "2019-06-01T12:00:00Z"}
+	assert.True(t, isSyncRequested(instance))
+	instance.Status.LastSyncRequest = "2019-06-01T12:00:00Z"
+	assert.False(t, isSyncRequested(instance), "the run was already started")
+	instance.Annotations[syncAnnotation] = "2019-06-01T12:05:00Z"
+	assert.True(t, isSyncRequested(instance))
+}
+
+func TestSyncRequest(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+	req := reconcile.Request{NamespacedName: nsn}
+	// listJobs returns the jobs of the GitOpsConfig
+	listJobs := func(t *testing.T, cl client.Client) []batchv1.Job {
+		jobs := &batchv1.JobList{}
+		assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+		return jobs.Items
+	}
+	// requestSync sets the sync annotation of the GitOpsConfig to value
+	requestSync := func(t *testing.T, cl client.Client, value string) {
+		instance := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+		instance.Annotations[syncAnnotation] = value
+		assert.NoError(t, cl.Update(context.TODO(), instance))
+	}
+
+	for _, trigger := range []string{"Periodic", "Change"} {
+		t.Run(trigger, func(t *testing.T) {
+			instance := gitops.DeepCopy()
+			instance.Annotations = map[string]string{"gitopsconfig.eunomia.kohls.io/initialized": "true"}
+			instance.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: trigger, Cron: "0 * * * *"}}
+			cl := fake.NewFakeClient(instance)
+			r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+			_, err := r.Reconcile(req)
+			assert.NoError(t, err)
+			before := len(listJobs(t, cl))
+
+			// changing the annotation spawns exactly one job, whatever the number of reconciles
+			requestSync(t, cl, "2019-06-01T12:00:00Z")
+			for i := 0; i < 3; i++ {
+				_, err = r.Reconcile(req)
+				assert.NoError(t, err)
+				if trigger == "Change" {
+					// the change trigger runs again on every reconcile
+					break
+				}
+			}
+			jobs := listJobs(t, cl)
+			if assert.Len(t, jobs, before+1) {
+				manual := 0
+				for _, job := range jobs {
+					if jobTrigger(&job) == "Manual" {
+						manual++
+					}
+				}
+				assert.Equal(t, 1, manual)
+			}
+			instance = &gitopsv1alpha1.GitOpsConfig{}
+			assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+			assert.Equal(t, "2019-06-01T12:00:00Z", instance.Status.LastSyncRequest)
+
+			// a new value requests a new run
+			requestSync(t, cl, "2019-06-01T12:05:00Z")
+			_, err = r.Reconcile(req)
+			assert.NoError(t, err)
+			assert.Len(t, listJobs(t, cl), before+2)
+		})
+	}
+}
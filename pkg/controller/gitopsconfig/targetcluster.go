@@ -0,0 +1,175 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// targetClusterTimeout is how long the version of a remote cluster is waited for when its reachability is checked
+var targetClusterTimeout = 10 * time.Second
+
+// validateTargetCluster verifies the reference to the Secret holding the kubeconfig of the remote cluster
+func validateTargetCluster(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	cluster := spec.TargetCluster
+	if cluster == nil {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(cluster.SecretRef); len(errs) > 0 {
+		return fmt.Errorf("targetCluster secretRef %q is not a valid Secret name: %s", cluster.SecretRef, strings.Join(errs, ", "))
+	}
+	if cluster.Key != "" {
+		if errs := validation.IsConfigMapKey(cluster.Key); len(errs) > 0 {
+			return fmt.Errorf("targetCluster key %q is not a valid Secret key: %s", cluster.Key, strings.Join(errs, ", "))
+		}
+	}
+	// the selected namespaces are looked up in the local cluster, they may not exist in the remote one
+	if spec.TargetNamespaceSelector != nil {
+		return fmt.Errorf("targetCluster can't be used with targetNamespaceSelector")
+	}
+	return nil
+}
+
+// missingTargetCluster returns the name of the Secret of the target cluster of instance, or of its key, if it doesn't
+// exist in namespace, an empty string otherwise
+func missingTargetCluster(reader client.Reader, namespace string, instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	cluster := instance.Spec.TargetCluster
+	if cluster == nil {
+		return "", nil
+	}
+	secret := &corev1.Secret{}
+	missing, err := isMissing(reader, types.NamespacedName{Name: cluster.SecretRef, Namespace: namespace}, secret)
+	if missing || err != nil {
+		return "Secret " + cluster.SecretRef, err
+	}
+	if _, found := secret.Data[util.GetTargetKubeconfigKey(*instance)]; !found {
+		return fmt.Sprintf("Key %s of Secret %s", util.GetTargetKubeconfigKey(*instance), cluster.SecretRef), nil
+	}
+	return "", nil
+}
+
+// targetClusterError returns the reason and message of why the remote cluster of instance can't be reached with its
+// kubeconfig, empty when it answers with its version
+func (r *ReconcileGitOpsConfig) targetClusterError(instance *gitopsv1alpha1.GitOpsConfig) (string, string, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: instance.Spec.TargetCluster.SecretRef, Namespace: util.JobNamespace(*instance)}
+	if err := r.jobProfileReader().Get(context.TODO(), key, secret); err != nil {
+		return "", "", err
+	}
+	kubeconfig, err := clientcmd.Load(secret.Data[util.GetTargetKubeconfigKey(*instance)])
+	if err == nil {
+		// the client is built in the operator, which must not run the plugins nor read the files of the kubeconfig
+		err = checkKubeconfigInline(kubeconfig)
+	}
+	if err != nil {
+		return "InvalidKubeconfig", fmt.Sprintf("the kubeconfig of Secret %s is invalid: %s", key.Name, err), nil
+	}
+	config, err := clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return "InvalidKubeconfig", fmt.Sprintf("the kubeconfig of Secret %s is invalid: %s", key.Name, err), nil
+	}
+	config.Timeout = targetClusterTimeout
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return "InvalidKubeconfig", fmt.Sprintf("the kubeconfig of Secret %s is invalid: %s", key.Name, err), nil
+	}
+	if _, err = discoveryClient.ServerVersion(); err != nil {
+		return "Unreachable", fmt.Sprintf("the cluster %s of the kubeconfig of Secret %s is unreachable: %s", config.Host, key.Name, err), nil
+	}
+	return "", "", nil
+}
+
+// checkKubeconfigInline returns an error if kubeconfig runs a credential plugin or reads a file, e.g. the token of
+// the service account of the pod using it. Only the certificates, keys and tokens embedded in it are allowed.
+func checkKubeconfigInline(kubeconfig *clientcmdapi.Config) error {
+	for name, cluster := range kubeconfig.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return fmt.Errorf("cluster %s reads the file %s, only certificate-authority-data is allowed", name, cluster.CertificateAuthority)
+		}
+	}
+	for name, user := range kubeconfig.AuthInfos {
+		switch {
+		case user.Exec != nil:
+			return fmt.Errorf("user %s runs the exec credential plugin %s, which isn't allowed", name, user.Exec.Command)
+		case user.AuthProvider != nil:
+			return fmt.Errorf("user %s uses the auth-provider %s, which isn't allowed", name, user.AuthProvider.Name)
+		case user.TokenFile != "":
+			return fmt.Errorf("user %s reads the file %s, only token is allowed", name, user.TokenFile)
+		case user.ClientCertificate != "":
+			return fmt.Errorf("user %s reads the file %s, only client-certificate-data is allowed", name, user.ClientCertificate)
+		case user.ClientKey != "":
+			return fmt.Errorf("user %s reads the file %s, only client-key-data is allowed", name, user.ClientKey)
+		}
+	}
+	return nil
+}
+
+// checkTargetCluster fails the reconciliation of instance, recording the TargetClusterUnreachable condition, while
+// the remote cluster of its TargetCluster can't be reached. The failed reconcile is retried until it is.
+func (r *ReconcileGitOpsConfig) checkTargetCluster(instance *gitopsv1alpha1.GitOpsConfig) error {
+	if instance.Spec.TargetCluster == nil {
+		return nil
+	}
+	reason, message, err := r.targetClusterError(instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the target cluster of the GitOpsConfig", "instance", instance.GetName())
+		return err
+	}
+	if reason == "" {
+		if !isConditionTrue(&instance.Status, gitopsv1alpha1.ConditionTargetClusterUnreachable) {
+			return nil
+		}
+		setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+			Type:    gitopsv1alpha1.ConditionTargetClusterUnreachable,
+			Status:  corev1.ConditionFalse,
+			Reason:  "Reachable",
+			Message: "The target cluster answers with its kubeconfig",
+		})
+		if err = r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return err
+		}
+		return nil
+	}
+	changed := setCondition(&instance.Status, gitopsv1alpha1.GitOpsConfigCondition{
+		Type:    gitopsv1alpha1.ConditionTargetClusterUnreachable,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+	if changed {
+		if err = r.client.Status().Update(context.TODO(), instance); err != nil {
+			log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+			return err
+		}
+		r.recorder.Eventf(instance, "Warning", "TargetClusterUnreachable", "Runs not started: %s", message)
+	}
+	return fmt.Errorf("target cluster unreachable: %s", message)
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// targetKubeconfig returns a kubeconfig connecting to server
+func targetKubeconfig(server string) []byte {
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: %s
+users:
+- name: remote
+  user:
+    token: abcde
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+current-context: remote
+`, server))
+}
+
+func TestValidateTargetCluster(t *testing.T) {
+	tests := []struct {
+		name     string
+		cluster  *gitopsv1alpha1.TargetClusterReference
+		selector *metav1.LabelSelector
+		errMsg   string
+	}{
+		{"none", nil, nil, ""},
+		{"secret", &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote"}, nil, ""},
+		{"secret key", &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote", Key: "config"}, nil, ""},
+		{"selector only", nil, &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}, ""},
+		{"name", &gitopsv1alpha1.TargetClusterReference{SecretRef: "Remote_Cluster"}, nil, `targetCluster secretRef "Remote_Cluster" is not a valid Secret name`},
+		{"key", &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote", Key: "kube/config"}, nil, `targetCluster key "kube/config" is not a valid Secret key`},
+		{"selector", &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote"}, &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}, "targetCluster can't be used with targetNamespaceSelector"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTargetCluster(gitopsv1alpha1.GitOpsConfigSpec{TargetCluster: tt.cluster, TargetNamespaceSelector: tt.selector})
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestMissingTargetCluster(t *testing.T) {
+	instance := gitops.DeepCopy()
+	instance.Spec.TemplateSource.SecretRef = ""
+	instance.Spec.ParameterSource.SecretRef = ""
+	instance.Spec.TargetCluster = &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote"}
+	cl := fake.NewFakeClient()
+	r := &ReconcileGitOpsConfig{client: cl, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(10)}
+
+	missing, err := r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Equal(t, "Secret remote", missing)
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "remote", Namespace: namespace}, Data: map[string][]byte{"config": targetKubeconfig("https://remote:6443")}}
+	assert.NoError(t, cl.Create(context.TODO(), secret))
+	missing, err = r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Equal(t, "Key kubeconfig of Secret remote", missing)
+
+	instance.Spec.TargetCluster.Key = "config"
+	missing, err = r.missingDependency(instance)
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestTargetClusterKubeconfigInline(t *testing.T) {
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		fmt.Fprint(w, `{"major": "1", "minor": "13", "gitVersion": "v1.13.4"}`)
+	}))
+	defer server.Close()
+	inline := string(targetKubeconfig(server.URL))
+	tests := []struct {
+		name       string
+		kubeconfig string
+		errMsg     string
+	}{
+		{"inline", inline, ""},
+		{"exec", strings.Replace(inline, "    token: abcde\n", "    exec:\n      apiVersion: client.authentication.k8s.io/v1beta1\n      command: /bin/sh\n      args: [-c, id]\n", 1), "user remote runs the exec credential plugin /bin/sh"},
+		{"auth-provider", strings.Replace(inline, "    token: abcde\n", "    auth-provider:\n      name: gcp\n", 1), "user remote uses the auth-provider gcp"},
+		{"token file", strings.Replace(inline, "    token: abcde\n", "    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token\n", 1), "user remote reads the file /var/run/secrets/kubernetes.io/serviceaccount/token"},
+		{"client certificate", strings.Replace(inline, "    token: abcde\n", "    client-certificate: /etc/tls/tls.crt\n", 1), "user remote reads the file /etc/tls/tls.crt"},
+		{"client key", strings.Replace(inline, "    token: abcde\n", "    client-key: /etc/tls/tls.key\n", 1), "user remote reads the file /etc/tls/tls.key"},
+		{"certificate authority", strings.Replace(inline, "    server: ", "    certificate-authority: /var/run/secrets/kubernetes.io/serviceaccount/ca.crt\n    server: ", 1), "cluster remote reads the file /var/run/secrets/kubernetes.io/serviceaccount/ca.crt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested = false
+			instance := gitops.DeepCopy()
+			instance.Spec.TargetCluster = &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote"}
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "remote", Namespace: namespace}, Data: map[string][]byte{"kubeconfig": []byte(tt.kubeconfig)}}
+			r := &ReconcileGitOpsConfig{client: fake.NewFakeClient(instance, secret), scheme: scheme.Scheme, recorder: record.NewFakeRecorder(10)}
+
+			reason, message, err := r.targetClusterError(instance)
+			assert.NoError(t, err)
+			if tt.errMsg == "" {
+				assert.Empty(t, reason, message)
+				assert.True(t, requested)
+				return
+			}
+			assert.Equal(t, "InvalidKubeconfig", reason)
+			assert.Contains(t, message, tt.errMsg)
+			// the cluster isn't even contacted
+			assert.False(t, requested)
+		})
+	}
+}
+
+func TestCheckTargetCluster(t *testing.T) {
+	reachable := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !reachable || r.URL.Path != "/version" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"major": "1", "minor": "13", "gitVersion": "v1.13.4"}`)
+	}))
+	defer server.Close()
+
+	instance := gitops.DeepCopy()
+	instance.Spec.TargetCluster = &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote"}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "remote", Namespace: namespace}, Data: map[string][]byte{"kubeconfig": []byte("clusters: [")}}
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, instance)
+	cl := fake.NewFakeClient(instance, secret)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+	condition := func() *gitopsv1alpha1.GitOpsConfigCondition {
+		found := &gitopsv1alpha1.GitOpsConfig{}
+		assert.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, found))
+		return getCondition(&found.Status, gitopsv1alpha1.ConditionTargetClusterUnreachable)
+	}
+
+	// an invalid kubeconfig doesn't start the runs
+	err := r.checkTargetCluster(instance)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "target cluster unreachable: the kubeconfig of Secret remote is invalid")
+	}
+	if c := condition(); assert.NotNil(t, c) {
+		assert.Equal(t, corev1.ConditionTrue, c.Status)
+		assert.Equal(t, "InvalidKubeconfig", c.Reason)
+	}
+	assert.Contains(t, <-recorder.Events, "Warning TargetClusterUnreachable Runs not started: the kubeconfig of Secret remote is invalid")
+
+	// nor does a cluster that doesn't answer
+	reachable = false
+	secret.Data["kubeconfig"] = targetKubeconfig(server.URL)
+	assert.NoError(t, cl.Update(context.TODO(), secret))
+	err = r.checkTargetCluster(instance)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "target cluster unreachable: the cluster "+server.URL+" of the kubeconfig of Secret remote is unreachable")
+	}
+	if c := condition(); assert.NotNil(t, c) {
+		assert.Equal(t, "Unreachable", c.Reason)
+	}
+	assert.Contains(t, <-recorder.Events, "Warning TargetClusterUnreachable Runs not started: the cluster "+server.URL)
+
+	// the condition is cleared once the cluster answers
+	reachable = true
+	assert.NoError(t, r.checkTargetCluster(instance))
+	if c := condition(); assert.NotNil(t, c) {
+		assert.Equal(t, corev1.ConditionFalse, c.Status)
+		assert.Equal(t, "Reachable", c.Reason)
+	}
+	assert.Empty(t, drainEvents(recorder))
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// namespaceResultPattern matches the result of a failed job in each of its target namespaces, printed before its
+// phase, e.g. eunomia-namespace: team-a Failed
+var namespaceResultPattern = regexp.MustCompile(`(?m)^eunomia-namespace: (\S+) (Success|Failed)$`)
+
+// errNoTargetNamespaces is returned when the targetNamespaceSelector of a GitOpsConfig without targetNamespaces
+// matches no namespace. The resources would be applied into the namespace of the GitOpsConfig otherwise.
+var errNoTargetNamespaces = goerrors.New("the targetNamespaceSelector matches no namespace")
+
+// validateTargetNamespaceSelector verifies the targetNamespaceSelector set by spec
+func validateTargetNamespaceSelector(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.TargetNamespaceSelector == nil {
+		return nil
+	}
+	if _, err := metav1.LabelSelectorAsSelector(spec.TargetNamespaceSelector); err != nil {
+		return fmt.Errorf("targetNamespaceSelector is invalid: %s", err)
+	}
+	return nil
+}
+
+// selectsNamespace returns true if the targetNamespaceSelector of instance matches namespace
+func selectsNamespace(instance *gitopsv1alpha1.GitOpsConfig, namespace metav1.Object) bool {
+	if instance.Spec.TargetNamespaceSelector == nil {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(instance.Spec.TargetNamespaceSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(namespace.GetLabels()))
+}
+
+// withTargetNamespaces returns instance with the namespaces matching its targetNamespaceSelector added to its
+// targetNamespaces, in the order they are listed. The namespaces being deleted aren't targeted, and the namespaces
+// deleted since the last run are dropped from its inventory, their resources went away with them. The delete jobs
+// delete the resources of the inventory when no namespace matches anymore.
+func (r *ReconcileGitOpsConfig) withTargetNamespaces(instance *gitopsv1alpha1.GitOpsConfig, jobtype string) (*gitopsv1alpha1.GitOpsConfig, error) {
+	if instance.Spec.TargetNamespaceSelector == nil {
+		return instance, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(instance.Spec.TargetNamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := &corev1.NamespaceList{}
+	err = r.client.List(context.TODO(), &client.ListOptions{}, namespaces)
+	if err != nil {
+		log.Error(err, "unable to list the namespaces", "instance", instance.GetName())
+		return nil, err
+	}
+	run := instance.DeepCopy()
+	existing := map[string]bool{}
+	for _, namespace := range namespaces.Items {
+		existing[namespace.Name] = true
+		if namespace.DeletionTimestamp == nil && selector.Matches(labels.Set(namespace.Labels)) && !containsString(run.Spec.TargetNamespaces, namespace.Name) {
+			run.Spec.TargetNamespaces = append(run.Spec.TargetNamespaces, namespace.Name)
+		}
+	}
+	inventory := []gitopsv1alpha1.NamespaceInventory{}
+	for _, namespace := range run.Status.Inventory {
+		if existing[namespace.Namespace] {
+			inventory = append(inventory, namespace)
+		}
+	}
+	run.Status.Inventory = inventory
+	if len(run.Spec.TargetNamespaces) == 0 && jobtype == "delete" {
+		for _, namespace := range inventory {
+			run.Spec.TargetNamespaces = append(run.Spec.TargetNamespaces, namespace.Namespace)
+		}
+	}
+	if len(run.Spec.TargetNamespaces) == 0 {
+		return nil, errNoTargetNamespaces
+	}
+	return run, nil
+}
+
+// enqueueSelectingConfigs maps the namespaces that start or stop matching the targetNamespaceSelector of a
+// GitOpsConfig, when they are created or their labels change, to the GitOpsConfig, so that it runs again
+func enqueueSelectingConfigs(c client.Client) handler.EventHandler {
+	enqueue := func(q workqueue.RateLimitingInterface, changed func(instance *gitopsv1alpha1.GitOpsConfig) bool) {
+		instances := &gitopsv1alpha1.GitOpsConfigList{}
+		if err := c.List(context.TODO(), &client.ListOptions{}, instances); err != nil {
+			log.Error(err, "unable to list the GitOpsConfigs selecting namespaces")
+			return
+		}
+		for i := range instances.Items {
+			instance := &instances.Items[i]
+			if changed(instance) {
+				q.Add(reconcile.Request{NamespacedName: types.NamespacedName{Name: instance.GetName(), Namespace: instance.GetNamespace()}})
+			}
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, func(instance *gitopsv1alpha1.GitOpsConfig) bool {
+				return selectsNamespace(instance, e.Meta)
+			})
+		},
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, func(instance *gitopsv1alpha1.GitOpsConfig) bool {
+				return selectsNamespace(instance, e.MetaOld) != selectsNamespace(instance, e.MetaNew)
+			})
+		},
+	}
+}
+
+// parseNamespaceResults returns the result of job in each of its target namespaces, printed in the termination
+// message of a failed job
+func parseNamespaceResults(job *batchv1.Job, message string) []gitopsv1alpha1.TargetNamespaceResult {
+	results := []gitopsv1alpha1.TargetNamespaceResult{}
+	for _, match := range namespaceResultPattern.FindAllStringSubmatch(message, -1) {
+		results = append(results, gitopsv1alpha1.TargetNamespaceResult{Namespace: match[1], Result: match[2], Job: job.GetName()})
+	}
+	return results
+}
+
+// recordNamespaceResults stores in the status of owner the result of the failed job in each of its target namespaces,
+// found in its termination message, with a NamespacesFailed event naming the namespaces it failed to apply into
+func (j *jobCompletionEmitter) recordNamespaceResults(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, eventType string, message string) {
+	results := parseNamespaceResults(job, message)
+	if len(results) == 0 {
+		return
+	}
+	failed := []string{}
+	for _, result := range results {
+		if result.Result == "Failed" {
+			failed = append(failed, result.Namespace)
+		}
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	err := j.client.Get(context.TODO(), types.NamespacedName{Name: owner.GetName(), Namespace: owner.GetNamespace()}, instance)
+	if err != nil {
+		log.Error(err, "unable to lookup the GitOpsConfig owning the job", "job", job.GetName())
+		return
+	}
+	instance.Status.TargetNamespaces = results
+	err = j.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the status of the GitOpsConfig", "instance", instance.GetName())
+	}
+	if len(failed) > 0 {
+		j.recorder.AnnotatedEventf(owner,
+			map[string]string{"job": job.Name},
+			eventType, reasonNamespacesFailed, "Job %s failed to apply the resources into %d of %d target namespaces: %s", job.Name,
+			len(failed), len(results), strings.Join(failed, ", "))
+	}
+}
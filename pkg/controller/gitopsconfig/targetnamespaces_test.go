@@ -0,0 +1,202 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// newNamespace returns a namespace with labels
+func newNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+// tenantSelector selects the namespaces labeled tier=tenant
+var tenantSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "tenant"}}
+
+func TestValidateTargetNamespaceSelector(t *testing.T) {
+	assert.NoError(t, validateTargetNamespaceSelector(gitopsv1alpha1.GitOpsConfigSpec{}))
+	assert.NoError(t, validateTargetNamespaceSelector(gitopsv1alpha1.GitOpsConfigSpec{TargetNamespaceSelector: tenantSelector}))
+	invalid := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Near"}}}
+	assert.Error(t, validateTargetNamespaceSelector(gitopsv1alpha1.GitOpsConfigSpec{TargetNamespaceSelector: invalid}))
+}
+
+func TestWithTargetNamespaces(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	terminating := newNamespace("team-c", map[string]string{"tier": "tenant"})
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+	namespaces := []runtime.Object{
+		newNamespace("shared", nil),
+		newNamespace("team-a", map[string]string{"tier": "tenant"}),
+		newNamespace("team-b", map[string]string{"tier": "tenant"}),
+		terminating,
+		newNamespace("kube-system", nil),
+	}
+	inventory := []gitopsv1alpha1.NamespaceInventory{{Namespace: "team-a"}, {Namespace: "team-d"}}
+
+	instance := gitops.DeepCopy()
+	instance.Spec.TargetNamespaces = []string{"shared", "team-a"}
+	instance.Spec.TargetNamespaceSelector = tenantSelector
+	instance.Status.Inventory = inventory
+	r := &ReconcileGitOpsConfig{client: fake.NewFakeClient(namespaces...), scheme: s}
+	run, err := r.withTargetNamespaces(instance, "create")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"shared", "team-a", "team-b"}, run.Spec.TargetNamespaces)
+	// team-d was deleted since the last run, its resources aren't pruned
+	assert.Equal(t, []gitopsv1alpha1.NamespaceInventory{{Namespace: "team-a"}}, run.Status.Inventory)
+	assert.Equal(t, []string{"shared", "team-a"}, instance.Spec.TargetNamespaces)
+
+	// without targetNamespaces, the resources must not land in the namespace of the GitOpsConfig
+	instance.Spec.TargetNamespaces = nil
+	r = &ReconcileGitOpsConfig{client: fake.NewFakeClient(newNamespace("team-a", nil)), scheme: s}
+	_, err = r.withTargetNamespaces(instance, "create")
+	assert.Equal(t, errNoTargetNamespaces, err)
+	run, err = r.withTargetNamespaces(instance, "delete")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a"}, run.Spec.TargetNamespaces)
+
+	instance.Spec.TargetNamespaceSelector = nil
+	run, err = r.withTargetNamespaces(instance, "create")
+	assert.NoError(t, err)
+	assert.Equal(t, instance, run)
+}
+
+func TestTargetNamespaceSelectorReachesJob(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	instance := gitops.DeepCopy()
+	instance.Spec.TargetNamespaceSelector = tenantSelector
+	instance.Status.Inventory = []gitopsv1alpha1.NamespaceInventory{{Namespace: "team-a"}, {Namespace: "team-b"}}
+	cl := fake.NewFakeClient(instance, newNamespace("team-a", map[string]string{"tier": "tenant"}), newNamespace("team-b", nil))
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: recorder}
+
+	_, err := r.createJob("create", instance, 0, "", "", "")
+	assert.NoError(t, err)
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		env := jobs.Items[0].Spec.Template.Spec.Containers[0].Env
+		assert.Contains(t, env, corev1.EnvVar{Name: "TARGET_NAMESPACES", Value: "team-a"})
+		// team-b doesn't match anymore, its resources are deleted
+		assert.Contains(t, env, corev1.EnvVar{Name: "PRUNE_NAMESPACES", Value: "team-b"})
+	}
+
+	// no job is created when no namespace matches
+	assert.NoError(t, cl.Delete(context.TODO(), jobs.Items[0].DeepCopy()))
+	assert.NoError(t, cl.Delete(context.TODO(), newNamespace("team-a", nil)))
+	_, err = r.createJob("create", instance, 0, "", "", "")
+	assert.NoError(t, err)
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	assert.Empty(t, jobs.Items)
+	assert.Contains(t, <-recorder.Events, "Warning NoTargetNamespaces")
+}
+
+func TestEnqueueSelectingConfigs(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops, &gitopsv1alpha1.GitOpsConfigList{})
+	selecting := gitops.DeepCopy()
+	selecting.Spec.TargetNamespaceSelector = tenantSelector
+	other := gitops.DeepCopy()
+	other.Name = "other"
+	handler := enqueueSelectingConfigs(fake.NewFakeClient(selecting, other))
+	tenant := newNamespace("team-a", map[string]string{"tier": "tenant"})
+	plain := newNamespace("team-a", nil)
+	relabeled := newNamespace("team-a", map[string]string{"tier": "tenant", "owner": "team-a"})
+
+	tests := []struct {
+		name     string
+		send     func(q workqueue.RateLimitingInterface)
+		enqueued int
+	}{
+		{"matching namespace created", func(q workqueue.RateLimitingInterface) {
+			handler.Create(event.CreateEvent{Meta: tenant, Object: tenant}, q)
+		}, 1},
+		{"other namespace created", func(q workqueue.RateLimitingInterface) {
+			handler.Create(event.CreateEvent{Meta: plain, Object: plain}, q)
+		}, 0},
+		{"namespace starts matching", func(q workqueue.RateLimitingInterface) {
+			handler.Update(event.UpdateEvent{MetaOld: plain, ObjectOld: plain, MetaNew: tenant, ObjectNew: tenant}, q)
+		}, 1},
+		{"namespace stops matching", func(q workqueue.RateLimitingInterface) {
+			handler.Update(event.UpdateEvent{MetaOld: tenant, ObjectOld: tenant, MetaNew: plain, ObjectNew: plain}, q)
+		}, 1},
+		{"namespace still matching", func(q workqueue.RateLimitingInterface) {
+			handler.Update(event.UpdateEvent{MetaOld: tenant, ObjectOld: tenant, MetaNew: relabeled, ObjectNew: relabeled}, q)
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer q.ShutDown()
+			tt.send(q)
+			assert.Equal(t, tt.enqueued, q.Len())
+		})
+	}
+}
+
+func TestNamespaceResults(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	nsn := types.NamespacedName{Name: name, Namespace: namespace}
+
+	// a failed job reports the namespaces it applied into before failing
+	cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod("error: unable to apply\n"+
+		"eunomia-namespace: team-a Success\neunomia-namespace: team-b Failed\neunomia-namespace: team-c Success\neunomia-phase: Apply\n"))
+	recorder := record.NewFakeRecorder(10)
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: recorder}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Failed: 1}))
+	assert.Contains(t, <-recorder.Events, "Warning JobFailed")
+	assert.Contains(t, <-recorder.Events, "Warning ApplyFailed")
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning NamespacesFailed")
+	assert.Contains(t, event, "team-b")
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.Equal(t, []gitopsv1alpha1.TargetNamespaceResult{
+		{Namespace: "team-a", Result: "Success", Job: "gitopsconfig-gitops-operator-abcde"},
+		{Namespace: "team-b", Result: "Failed", Job: "gitopsconfig-gitops-operator-abcde"},
+		{Namespace: "team-c", Result: "Success", Job: "gitopsconfig-gitops-operator-abcde"},
+	}, instance.Status.TargetNamespaces)
+
+	// a successful job reports them in its report
+	cl = fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod(`{"namespaces":[{"namespace":"team-a","result":"Success"},{"namespace":"team-b","result":"Success"}]}`))
+	emitter = &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), newOwnedJob(batchv1.JobStatus{Succeeded: 1}))
+	assert.NoError(t, cl.Get(context.TODO(), nsn, instance))
+	assert.Equal(t, []gitopsv1alpha1.TargetNamespaceResult{
+		{Namespace: "team-a", Result: "Success", Job: "gitopsconfig-gitops-operator-abcde"},
+		{Namespace: "team-b", Result: "Success", Job: "gitopsconfig-gitops-operator-abcde"},
+	}, instance.Status.TargetNamespaces)
+}
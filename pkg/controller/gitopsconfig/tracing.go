@@ -0,0 +1,190 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"encoding/hex"
+	"math"
+	"strings"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/tracing"
+	"go.opencensus.io/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// traceParentAnnotation records on a job the W3C traceparent of the span of its run, and on the in-memory copy of
+	// a GitOpsConfig passed to createJob the span the run belongs to
+	traceParentAnnotation string = "gitopsconfig.eunomia.kohls.io/traceparent"
+	// parentSpanAnnotation records on a job the ID of the span its run belongs to, e.g. the one of the webhook call
+	parentSpanAnnotation string = "gitopsconfig.eunomia.kohls.io/parent-span-id"
+)
+
+// jobPhase is a phase of a job, as reported in its termination message
+type jobPhase struct {
+	// Name is the phase, e.g. Clone, Render, Apply or Prune
+	Name string `json:"name"`
+	// Start is when the phase started, in seconds since the epoch. It ends when the next phase starts.
+	Start float64 `json:"start"`
+}
+
+// peekTriggerTraceParent returns the traceparent of the webhook call that triggered the next run of the named
+// GitOpsConfig, without forgetting its context
+func peekTriggerTraceParent(name types.NamespacedName) string {
+	triggerContextsLock.Lock()
+	defer triggerContextsLock.Unlock()
+	return triggerContexts[name].TraceParent
+}
+
+// startReconcileSpan starts the span of the reconcile of the named GitOpsConfig, in the trace of the webhook call that
+// triggered it if any
+func startReconcileSpan(name types.NamespacedName) *trace.Span {
+	var span *trace.Span
+	if parent, ok := tracing.ParseTraceParent(peekTriggerTraceParent(name)); ok {
+		_, span = trace.StartSpanWithRemoteParent(context.Background(), "reconcile", parent)
+	} else {
+		_, span = trace.StartSpan(context.Background(), "reconcile")
+	}
+	span.AddAttributes(trace.StringAttribute("gitopsconfig", name.String()))
+	return span
+}
+
+// withTraceParent returns instance recording that its next run belongs to the trace of parent, instance itself when
+// tracing is disabled
+func withTraceParent(instance *gitopsv1alpha1.GitOpsConfig, parent *trace.Span) *gitopsv1alpha1.GitOpsConfig {
+	if !tracing.Enabled() {
+		return instance
+	}
+	run := instance.DeepCopy()
+	if run.Annotations == nil {
+		run.Annotations = map[string]string{}
+	}
+	run.Annotations[traceParentAnnotation] = tracing.FormatTraceParent(parent.SpanContext())
+	return run
+}
+
+// newRunSpan returns the traceparent of the span of a new run of instance, a child of the span recorded by
+// withTraceParent or the root of a new trace, and the ID of its parent, empty for a root. The traceparent is empty
+// when tracing is disabled.
+func newRunSpan(instance *gitopsv1alpha1.GitOpsConfig) (string, string) {
+	if !tracing.Enabled() {
+		return "", ""
+	}
+	parent, ok := tracing.ParseTraceParent(instance.GetAnnotations()[traceParentAnnotation])
+	if !ok {
+		return tracing.FormatTraceParent(tracing.NewSpanContext(trace.SpanContext{})), ""
+	}
+	return tracing.FormatTraceParent(tracing.NewSpanContext(parent)), hex.EncodeToString(parent.SpanID[:])
+}
+
+// exportRunTrace exports the span of the run of job, from its creation to its completion, and the spans of its
+// phases reported in its termination message. The span of the run is the one recorded on the job by createJob, the
+// runs of the cronjobs get a new trace.
+func (j *jobCompletionEmitter) exportRunTrace(owner *gitopsv1alpha1.GitOpsConfig, job *batchv1.Job, now time.Time) {
+	if !tracing.Enabled() {
+		return
+	}
+	run, ok := tracing.ParseTraceParent(job.GetAnnotations()[traceParentAnnotation])
+	if !ok {
+		run = tracing.NewSpanContext(trace.SpanContext{})
+	}
+	parent, _ := tracing.ParseSpanID(job.GetAnnotations()[parentSpanAnnotation])
+	end := now
+	if job.Status.CompletionTime != nil {
+		end = job.Status.CompletionTime.Time
+	}
+	span := &trace.SpanData{
+		SpanContext:     run,
+		ParentSpanID:    parent,
+		HasRemoteParent: parent != trace.SpanID{},
+		Name:            "sync",
+		StartTime:       job.CreationTimestamp.Time,
+		EndTime:         end,
+		Attributes: map[string]interface{}{
+			"gitopsconfig": owner.GetNamespace() + "/" + owner.GetName(),
+			"job":          job.GetName(),
+			"action":       job.GetLabels()["action"],
+		},
+		Status: trace.Status{Code: trace.StatusCodeOK},
+	}
+	if trigger := jobTrigger(job); trigger != "" {
+		span.Attributes["trigger"] = trigger
+	}
+	if isJobFailed(job) {
+		span.Status = trace.Status{Code: trace.StatusCodeUnknown, Message: "Job failed"}
+	}
+	report := jobReport{}
+	terminated, err := getJobTerminatedState(j.client, job)
+	if err != nil {
+		log.Error(err, "unable to lookup the pods of the job, its phases aren't traced", "job", job.GetName())
+	} else if terminated != nil {
+		report = parseJobReport(terminated.Message)
+		if phase := failurePhase(terminated.Message); phase != "" && isJobFailed(job) {
+			span.Status.Message = "Job failed in the " + phase + " phase"
+			span.Attributes["phase"] = phase
+		}
+	}
+	if commit := report.Commit; commit != "" {
+		span.Attributes["commit"] = commit
+	} else if commit := job.GetAnnotations()[commitAnnotation]; commit != "" {
+		span.Attributes["commit"] = commit
+	}
+	for _, phase := range runPhaseSpans(run, report.Phases, report.Finished) {
+		tracing.Export(phase)
+	}
+	tracing.Export(span)
+}
+
+// runPhaseSpans returns the spans of the phases of the run whose span is run, each phase ending when the next one
+// starts and the last one at finished, in seconds since the epoch. The consecutive reports of the same phase are merged.
+func runPhaseSpans(run trace.SpanContext, phases []jobPhase, finished float64) []*trace.SpanData {
+	spans := []*trace.SpanData{}
+	for i, phase := range phases {
+		if i > 0 && phase.Name == phases[i-1].Name {
+			continue
+		}
+		end := finished
+		for _, next := range phases[i+1:] {
+			if next.Name != phase.Name {
+				end = next.Start
+				break
+			}
+		}
+		if end < phase.Start {
+			end = phase.Start
+		}
+		spans = append(spans, &trace.SpanData{
+			SpanContext:  tracing.NewSpanContext(run),
+			ParentSpanID: run.SpanID,
+			Name:         strings.ToLower(phase.Name),
+			StartTime:    epochTime(phase.Start),
+			EndTime:      epochTime(end),
+			Status:       trace.Status{Code: trace.StatusCodeOK},
+		})
+	}
+	return spans
+}
+
+// epochTime returns the time of seconds since the epoch
+func epochTime(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9))
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// recordingExporter collects the exported spans
+type recordingExporter struct {
+	lock  sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (e *recordingExporter) ExportSpan(span *trace.SpanData) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// named returns the exported spans called name
+func (e *recordingExporter) named(name string) []*trace.SpanData {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	spans := []*trace.SpanData{}
+	for _, span := range e.spans {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func getEnv(job *batchv1.Job, name string) string {
+	for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+		if env.Name == name {
+			return env.Value
+		}
+	}
+	return ""
+}
+
+func TestRunTrace(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracing.Register(exporter)
+	defer tracing.Unregister(exporter)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	// the reconcile belongs to the trace of the webhook call that triggered it
+	webhook := tracing.NewSpanContext(trace.SpanContext{})
+	config := types.NamespacedName{Name: name, Namespace: namespace}
+	SetTriggerContext(config, TriggerContext{TraceParent: tracing.FormatTraceParent(webhook)})
+	defer takeTriggerContext(config)
+	span := startReconcileSpan(config)
+	_, err := r.createJob("create", withTraceParent(gitops.DeepCopy(), span), 0, "", "", "")
+	assert.NoError(t, err)
+	span.End()
+
+	reconciles := exporter.named("reconcile")
+	if assert.Len(t, reconciles, 1) {
+		assert.Equal(t, webhook.TraceID, reconciles[0].TraceID)
+		assert.Equal(t, webhook.SpanID, reconciles[0].ParentSpanID)
+	}
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if !assert.Len(t, jobs.Items, 1) {
+		return
+	}
+	created := jobs.Items[0]
+	run, ok := tracing.ParseTraceParent(created.Annotations[traceParentAnnotation])
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, webhook.TraceID, run.TraceID)
+	assert.Equal(t, span.SpanContext().SpanID.String(), created.Annotations[parentSpanAnnotation])
+	// the job is given the span of its run
+	assert.Equal(t, created.Annotations[traceParentAnnotation], getEnv(&created, "TRACEPARENT"))
+
+	// the run and its phases are exported once it completes
+	pod := newTerminatedPod(`{"commit":"0123456789abcdef","phases":[{"name":"Clone","start":1000},{"name":"Render","start":1002.5},{"name":"Apply","start":1004},{"name":"Apply","start":1006},{"name":"Prune","start":1010}],"finished":1012}`)
+	emitter := &jobCompletionEmitter{client: fake.NewFakeClient(gitops.DeepCopy(), pod), scheme: s, recorder: record.NewFakeRecorder(10)}
+	succeeded := newOwnedJob(batchv1.JobStatus{Succeeded: 1})
+	succeeded.Annotations = created.Annotations
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), succeeded)
+
+	syncs := exporter.named("sync")
+	if !assert.Len(t, syncs, 1) {
+		return
+	}
+	assert.Equal(t, run, syncs[0].SpanContext)
+	assert.Equal(t, span.SpanContext().SpanID, syncs[0].ParentSpanID)
+	assert.Equal(t, int32(trace.StatusCodeOK), syncs[0].Status.Code)
+	assert.Equal(t, "0123456789abcdef", syncs[0].Attributes["commit"])
+	assert.Equal(t, "create", syncs[0].Attributes["action"])
+	for _, phase := range []struct {
+		name  string
+		start float64
+		end   float64
+	}{{"clone", 1000, 1002.5}, {"render", 1002.5, 1004}, {"apply", 1004, 1010}, {"prune", 1010, 1012}} {
+		spans := exporter.named(phase.name)
+		if assert.Len(t, spans, 1, phase.name) {
+			assert.Equal(t, run.TraceID, spans[0].TraceID)
+			assert.Equal(t, run.SpanID, spans[0].ParentSpanID)
+			assert.Equal(t, epochTime(phase.start), spans[0].StartTime)
+			assert.Equal(t, epochTime(phase.end), spans[0].EndTime)
+		}
+	}
+}
+
+func TestRunTraceFailed(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracing.Register(exporter)
+	defer tracing.Unregister(exporter)
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy(), newTerminatedPod("error: unable to apply\neunomia-phase: Apply\n"))
+	emitter := &jobCompletionEmitter{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	// the runs of the cronjobs have no span yet, they get a new trace
+	created := metav1.NewTime(time.Now().Add(-time.Minute))
+	failed := newOwnedJob(batchv1.JobStatus{Failed: 1})
+	failed.CreationTimestamp = created
+	emitter.OnUpdate(newOwnedJob(batchv1.JobStatus{Active: 1}), failed)
+
+	syncs := exporter.named("sync")
+	if assert.Len(t, syncs, 1) {
+		assert.NotEqual(t, trace.TraceID{}, syncs[0].TraceID)
+		assert.Equal(t, trace.SpanID{}, syncs[0].ParentSpanID)
+		assert.Equal(t, created.Time, syncs[0].StartTime)
+		assert.Equal(t, int32(trace.StatusCodeUnknown), syncs[0].Status.Code)
+		assert.Equal(t, "Job failed in the Apply phase", syncs[0].Status.Message)
+		assert.Equal(t, "Apply", syncs[0].Attributes["phase"])
+	}
+	// the phases are only reported by the successful runs
+	assert.Empty(t, exporter.named("apply"))
+}
+
+func TestRunTraceDisabled(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, gitops)
+	cl := fake.NewFakeClient(gitops.DeepCopy())
+	r := &ReconcileGitOpsConfig{client: cl, scheme: s, recorder: record.NewFakeRecorder(10)}
+
+	span := startReconcileSpan(types.NamespacedName{Name: name, Namespace: namespace})
+	defer span.End()
+	_, err := r.createJob("create", withTraceParent(gitops.DeepCopy(), span), 0, "", "", "")
+	assert.NoError(t, err)
+
+	jobs := &batchv1.JobList{}
+	assert.NoError(t, cl.List(context.TODO(), &client.ListOptions{Namespace: namespace}, jobs))
+	if assert.Len(t, jobs.Items, 1) {
+		assert.NotContains(t, jobs.Items[0].Annotations, traceParentAnnotation)
+		assert.Empty(t, getEnv(&jobs.Items[0], "TRACEPARENT"))
+	}
+}
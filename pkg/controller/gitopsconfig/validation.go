@@ -0,0 +1,134 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"errors"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultSources sets the defaults of the template and parameter sources of spec, the parameter source being the
+// template repository by default
+func defaultSources(spec *gitopsv1alpha1.GitOpsConfigSpec) {
+	if spec.TemplateSource.Ref == "" {
+		spec.TemplateSource.Ref = "master"
+	}
+	if spec.TemplateSource.ContextDir == "" && len(spec.TemplateSource.ContextDirs) == 0 {
+		spec.TemplateSource.ContextDir = "."
+	}
+	if spec.ParameterSource.URI == "" {
+		spec.ParameterSource.URI = spec.TemplateSource.URI
+	}
+	if spec.ParameterSource.Ref == "" {
+		spec.ParameterSource.Ref = "master"
+	}
+	if spec.ParameterSource.ContextDir == "" {
+		spec.ParameterSource.ContextDir = "."
+	}
+}
+
+// validateSpec verifies spec, whose sources are defaulted, before its jobs are run
+func validateSpec(spec gitopsv1alpha1.GitOpsConfigSpec) error {
+	if spec.TemplateSource.URI == "" {
+		return errors.New("template source URI cannot be empty")
+	}
+	// the template and parameter sources are cloned independently, each with its own ref and secret
+	if err := validateGitConfig("template", spec.TemplateSource); err != nil {
+		return err
+	}
+	if err := validateGitConfig("parameter", spec.ParameterSource); err != nil {
+		return err
+	}
+	validators := []func(gitopsv1alpha1.GitOpsConfigSpec) error{
+		validateModes,
+		validateRefPatterns,
+		validateGenericWebhook,
+		validateSourcePaths,
+		validateContextDirs,
+		validateFilePatterns,
+		validateJobNamespace,
+		validateCanary,
+		validateTargetNamespaceSelector,
+		validateTargetCluster,
+		validateTemplateProcessorImage,
+		validateApplyRetry,
+		validateSharding,
+		validateNotification,
+		validateEventNotifications,
+		validateSchedule,
+		validateValuesFrom,
+		validateCABundle,
+		validateHelm,
+		validateValuesFiles,
+		validateKustomize,
+		validateJsonnet,
+		validateResourceKinds,
+		validateHooks,
+	}
+	for _, validate := range validators {
+		if err := validate(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateGitOpsConfig verifies instance like the operator does before running its jobs, so that an invalid
+// GitOpsConfig is rejected when it is applied instead of failing later. The Secrets and the ServiceAccount the jobs
+// use are looked up with reader, except the Secrets when the runs wait for their missing dependencies.
+func ValidateGitOpsConfig(reader client.Reader, instance *gitopsv1alpha1.GitOpsConfig) error {
+	defaulted := instance.DeepCopy()
+	defaultSources(&defaulted.Spec)
+	if err := validateSpec(defaulted.Spec); err != nil {
+		return err
+	}
+	return validateReferences(reader, defaulted)
+}
+
+// validateReferences verifies that the Secrets and the ServiceAccount referenced by instance exist in the namespace
+// of its jobs
+func validateReferences(reader client.Reader, instance *gitopsv1alpha1.GitOpsConfig) error {
+	namespace := util.JobNamespace(*instance)
+	// the runs of a GitOpsConfig applied before its Secrets are deferred until they exist
+	if dependencyWaitMaxDelay <= 0 {
+		for _, secret := range sourceSecretRefs(instance) {
+			missing, err := isMissing(reader, types.NamespacedName{Name: secret, Namespace: namespace}, &corev1.Secret{})
+			if err != nil {
+				return err
+			}
+			if missing {
+				return fmt.Errorf("secret %s referenced by the sources doesn't exist in namespace %s", secret, namespace)
+			}
+		}
+	}
+	if account := instance.Spec.ServiceAccountRef; account != "" && account != "default" {
+		missing, err := isMissing(reader, types.NamespacedName{Name: account, Namespace: namespace}, &corev1.ServiceAccount{})
+		if err != nil {
+			return err
+		}
+		if missing {
+			return fmt.Errorf("serviceAccountRef %s doesn't exist in namespace %s", account, namespace)
+		}
+	}
+	return nil
+}
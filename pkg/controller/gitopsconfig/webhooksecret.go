@@ -0,0 +1,85 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitopsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// GetWebhookSecret returns the secret of the Webhook trigger of instance, empty if there is none. The key referenced
+// by the secretRef of the trigger is read from the namespace of instance, the inline secret is used otherwise.
+func (r *ReconcileGitOpsConfig) GetWebhookSecret(instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	for _, trigger := range instance.Spec.Triggers {
+		if trigger.Type != "Webhook" {
+			continue
+		}
+		if trigger.SecretRef == nil {
+			return trigger.Secret, nil
+		}
+		// the secrets are read directly from the API server like the job profiles, instead of caching all the Secrets of the cluster
+		secret := &corev1.Secret{}
+		key := types.NamespacedName{Name: trigger.SecretRef.Name, Namespace: instance.GetNamespace()}
+		if err := r.jobProfileReader().Get(context.TODO(), key, secret); err != nil {
+			return "", err
+		}
+		value, ok := secret.Data[trigger.SecretRef.Key]
+		if !ok || len(value) == 0 {
+			return "", fmt.Errorf("key %s not found in secret %s", trigger.SecretRef.Key, key)
+		}
+		return string(value), nil
+	}
+	return "", nil
+}
+
+// webhookSecretFingerprint returns a fingerprint identifying the webhook
+// secret, empty if there is none. Only a prefix of the SHA-256 hash is kept,
+// so that the secret cannot be recovered from it.
+func webhookSecretFingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// recordWebhookSecretFingerprint stores the fingerprint of the webhook secret
+// in the status of instance, so that secret rotations can be tracked. A
+// referenced secret that can't be read leaves the fingerprint unchanged.
+func (r *ReconcileGitOpsConfig) recordWebhookSecretFingerprint(instance *gitopsv1alpha1.GitOpsConfig) error {
+	secret, err := r.GetWebhookSecret(instance)
+	if err != nil {
+		log.Error(err, "unable to read the webhook secret", "instance", instance.GetName())
+		return nil
+	}
+	fingerprint := webhookSecretFingerprint(secret)
+	if instance.Status.WebhookSecretFingerprint == fingerprint {
+		return nil
+	}
+	instance.Status.WebhookSecretFingerprint = fingerprint
+	err = r.client.Status().Update(context.TODO(), instance)
+	if err != nil {
+		log.Error(err, "unable to update the webhook secret fingerprint", "instance", instance.GetName())
+	}
+	return err
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitremote looks up the refs of git repositories served over HTTP(S), like git ls-remote, without a git
+// binary nor a clone.
+package gitremote
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxAdvertisementSize bounds the refs advertisement read from a server
+const maxAdvertisementSize = 32 << 20
+
+var (
+	// ErrRefNotFound is returned when the repository has no such ref
+	ErrRefNotFound = errors.New("ref not found")
+	// ErrUnsupportedURI is returned for the repositories that aren't served over HTTP(S), e.g. over ssh
+	ErrUnsupportedURI = errors.New("only http and https repositories are supported")
+
+	commitHash = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// Refs maps the names of the refs of a repository, e.g. refs/heads/master, to the hash of the object they point to.
+// The annotated tags also have their peeled commit under their name followed by ^{}.
+type Refs map[string]string
+
+// ListRefs returns the refs advertised by the repository at uri, over the smart HTTP protocol. The user of uri, if any,
+// is replaced by auth.
+func ListRefs(client *http.Client, uri string, auth *url.Userinfo) (Refs, error) {
+	endpoint, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, ErrUnsupportedURI
+	}
+	if auth != nil {
+		endpoint.User = auth
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/info/refs"
+	endpoint.RawQuery = "service=git-upload-pack"
+	resp, err := client.Get(endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to list the refs of %s: %s", redact(endpoint), resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/x-git-upload-pack-advertisement" {
+		return nil, fmt.Errorf("%s doesn't support the smart HTTP protocol, its content type is %q", redact(endpoint), contentType)
+	}
+	return parseAdvertisement(io.LimitReader(resp.Body, maxAdvertisementSize))
+}
+
+// ResolveRef returns the commit ref points to in the repository at uri. Like git clone, a short ref is looked up as a
+// branch, then as a tag, and a commit hash resolves to itself without reaching the repository.
+func ResolveRef(client *http.Client, uri, ref string, auth *url.Userinfo) (string, error) {
+	if commitHash.MatchString(ref) {
+		return ref, nil
+	}
+	refs, err := ListRefs(client, uri, auth)
+	if err != nil {
+		return "", err
+	}
+	return refs.Resolve(ref)
+}
+
+// Resolve returns the commit ref points to, peeling the annotated tags
+func (refs Refs) Resolve(ref string) (string, error) {
+	candidates := []string{ref}
+	if ref != "HEAD" && !strings.HasPrefix(ref, "refs/") {
+		candidates = []string{"refs/heads/" + ref, "refs/tags/" + ref}
+	}
+	for _, name := range candidates {
+		if peeled, ok := refs[name+"^{}"]; ok {
+			return peeled, nil
+		}
+		if hash, ok := refs[name]; ok {
+			return hash, nil
+		}
+	}
+	return "", ErrRefNotFound
+}
+
+// parseAdvertisement parses the pkt-lines of a smart HTTP refs advertisement
+func parseAdvertisement(r io.Reader) (Refs, error) {
+	reader := bufio.NewReader(r)
+	refs := Refs{}
+	flushes := 0
+	for flushes < 2 {
+		line, flush, err := readPktLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if flush {
+			flushes++
+			continue
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if flushes == 0 {
+			// the service announcement, ended by the first flush
+			if !bytes.HasPrefix(line, []byte("# service=")) {
+				return nil, fmt.Errorf("unexpected refs advertisement: %q", line)
+			}
+			continue
+		}
+		if i := bytes.IndexByte(line, 0); i >= 0 {
+			// the capabilities follow the first ref
+			line = line[:i]
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected ref line: %q", line)
+		}
+		if fields[1] == "capabilities^{}" {
+			// the placeholder of an empty repository
+			continue
+		}
+		refs[fields[1]] = fields[0]
+	}
+	return refs, nil
+}
+
+// readPktLine reads a pkt-line, returning true for a flush-pkt
+func readPktLine(reader *bufio.Reader) ([]byte, bool, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, false, fmt.Errorf("truncated refs advertisement: %v", err)
+	}
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid pkt-line length %q", header)
+	}
+	if length == 0 {
+		return nil, true, nil
+	}
+	if length < 4 {
+		return nil, false, fmt.Errorf("invalid pkt-line length %q", header)
+	}
+	line := make([]byte, length-4)
+	if _, err := io.ReadFull(reader, line); err != nil {
+		return nil, false, fmt.Errorf("truncated refs advertisement: %v", err)
+	}
+	return line, false, nil
+}
+
+// Credentials returns the user and password of uri in the git-credentials store file content, e.g. the
+// .git-credentials key of the secret of a GitOpsConfig source, or nil if it has none
+func Credentials(gitCredentials []byte, uri string) *url.Userinfo {
+	target, err := url.Parse(uri)
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(gitCredentials), "\n") {
+		stored, err := url.Parse(strings.TrimSpace(line))
+		if err != nil || stored.User == nil {
+			continue
+		}
+		if stored.Scheme != target.Scheme || stored.Host != target.Host {
+			continue
+		}
+		// like the store helper, a credential with a path only applies to the repositories under it
+		if path := strings.TrimSuffix(stored.Path, "/"); path != "" && !strings.HasPrefix(target.Path, path) {
+			continue
+		}
+		return stored.User
+	}
+	return nil
+}
+
+// redact returns endpoint without its password, for the error messages
+func redact(endpoint *url.URL) string {
+	redacted := *endpoint
+	if redacted.User != nil {
+		redacted.User = url.User(redacted.User.Username())
+	}
+	return redacted.String()
+}
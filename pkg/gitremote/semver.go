@@ -0,0 +1,244 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitremote
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// version matches a semantic version with an optional v prefix, its minor and patch may be omitted in a constraint
+var version = regexp.MustCompile(`^v?(0|[1-9][0-9]*)(?:\.(0|[1-9][0-9]*))?(?:\.(0|[1-9][0-9]*))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// comparatorOperator matches the operator of a comparator of a constraint
+var comparatorOperator = regexp.MustCompile(`^(>=|<=|!=|>|<|=|~|\^)?`)
+
+// Version is a semantic version, e.g. the 1.4.2 of the tag v1.4.2
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease string
+}
+
+// ParseVersion parses a semantic version with an optional v prefix, e.g. v1.4.2 or 1.5.0-rc.1. The build metadata is
+// ignored.
+func ParseVersion(s string) (Version, error) {
+	v, parts, err := parseVersion(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if parts < 3 {
+		return Version{}, fmt.Errorf("%q is not a major.minor.patch version", s)
+	}
+	return v, nil
+}
+
+// parseVersion parses a version whose minor and patch may be omitted, returning how many of the three are set
+func parseVersion(s string) (Version, int, error) {
+	match := version.FindStringSubmatch(s)
+	if match == nil {
+		return Version{}, 0, fmt.Errorf("%q is not a semantic version", s)
+	}
+	v := Version{PreRelease: match[4]}
+	parts := 0
+	for i, field := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if match[i+1] == "" {
+			break
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return Version{}, 0, fmt.Errorf("%q is not a semantic version: %s", s, err)
+		}
+		*field = n
+		parts++
+	}
+	return v, parts, nil
+}
+
+// Compare returns -1, 0 or 1 when v is lower than, equal to or greater than other. A pre-release is lower than its
+// release, the pre-releases are compared by their dot separated identifiers like semver.org.
+func (v Version) Compare(other Version) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff != 0 {
+			return sign(diff)
+		}
+	}
+	switch {
+	case v.PreRelease == other.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case other.PreRelease == "":
+		return -1
+	}
+	ids, otherIds := strings.Split(v.PreRelease, "."), strings.Split(other.PreRelease, ".")
+	for i := 0; i < len(ids) && i < len(otherIds); i++ {
+		if c := compareIdentifier(ids[i], otherIds[i]); c != 0 {
+			return c
+		}
+	}
+	return sign(len(ids) - len(otherIds))
+}
+
+// compareIdentifier compares pre-release identifiers, numerically when both are numbers, the numbers being lower
+func compareIdentifier(a, b string) int {
+	n, aErr := strconv.Atoi(a)
+	m, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		return sign(n - m)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	return s
+}
+
+// comparator checks a version against the version of an operator
+type comparator struct {
+	operator string
+	version  Version
+}
+
+func (c comparator) check(v Version) bool {
+	compare := v.Compare(c.version)
+	switch c.operator {
+	case "=":
+		return compare == 0
+	case "!=":
+		return compare != 0
+	case ">":
+		return compare > 0
+	case ">=":
+		return compare >= 0
+	case "<":
+		return compare < 0
+	}
+	return compare <= 0
+}
+
+// Constraint is a range of semantic versions, the versions matching all its comparators
+type Constraint []comparator
+
+// ParseConstraint parses a range of versions, e.g. ">=1.4.0 <2.0.0", made of comparators separated by spaces or
+// commas. A comparator is a version preceded by one of the =, !=, >, >=, <, <= operators, = by default. The minor
+// and patch of its version may be omitted, they are 0. The ~ operator matches the versions of the same minor, e.g.
+// ~1.4 is >=1.4.0 <1.5.0, ^ the versions of the same major, e.g. ^1.4 is >=1.4.0 <2.0.0, or of the same minor for
+// the 0 major.
+func ParseConstraint(s string) (Constraint, error) {
+	constraint := Constraint{}
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		operator := comparatorOperator.FindString(field)
+		v, parts, err := parseVersion(strings.TrimPrefix(field, operator))
+		if err != nil {
+			return nil, fmt.Errorf("invalid semver range %q: %s", s, err)
+		}
+		switch operator {
+		case "~":
+			upper := Version{Major: v.Major, Minor: v.Minor + 1}
+			if parts == 1 {
+				upper = Version{Major: v.Major + 1}
+			}
+			constraint = append(constraint, comparator{">=", v}, comparator{"<", upper})
+		case "^":
+			upper := Version{Major: v.Major + 1}
+			if v.Major == 0 && parts > 1 {
+				upper = Version{Minor: v.Minor + 1}
+			}
+			constraint = append(constraint, comparator{">=", v}, comparator{"<", upper})
+		case "":
+			constraint = append(constraint, comparator{"=", v})
+		default:
+			constraint = append(constraint, comparator{operator, v})
+		}
+	}
+	if len(constraint) == 0 {
+		return nil, fmt.Errorf("invalid semver range %q: it has no comparator", s)
+	}
+	return constraint, nil
+}
+
+// Check returns true if v matches all the comparators of the constraint. The pre-releases only match the constraints
+// whose comparators name a pre-release of the same version, so that a range doesn't pick a release candidate.
+func (c Constraint) Check(v Version) bool {
+	if v.PreRelease != "" && !c.allowsPreRelease(v) {
+		return false
+	}
+	for _, comparator := range c {
+		if !comparator.check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) allowsPreRelease(v Version) bool {
+	for _, comparator := range c {
+		bound := comparator.version
+		if bound.PreRelease != "" && bound.Major == v.Major && bound.Minor == v.Minor && bound.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
+
+// HighestTag returns the name of the tag, e.g. v1.4.2, whose semantic version is the highest matching constraint.
+// The tags that aren't semantic versions are ignored. It returns ErrRefNotFound if none matches.
+func (refs Refs) HighestTag(constraint Constraint) (string, error) {
+	highest := ""
+	var highestVersion Version
+	for name := range refs {
+		if !strings.HasPrefix(name, "refs/tags/") || strings.HasSuffix(name, "^{}") {
+			continue
+		}
+		tag := strings.TrimPrefix(name, "refs/tags/")
+		v, err := ParseVersion(tag)
+		if err != nil || !constraint.Check(v) {
+			continue
+		}
+		// v1.4.2 and 1.4.2 tagging the same version, the one sorting first wins for a stable result
+		if compare := v.Compare(highestVersion); highest == "" || compare > 0 || compare == 0 && tag < highest {
+			highest, highestVersion = tag, v
+		}
+	}
+	if highest == "" {
+		return "", ErrRefNotFound
+	}
+	return highest, nil
+}
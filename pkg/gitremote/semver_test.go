@@ -0,0 +1,115 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitremote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tagRefs returns the refs of a repository with the given tags and a master branch
+func tagRefs(tags ...string) Refs {
+	refs := Refs{"refs/heads/master": masterHash}
+	for _, tag := range tags {
+		refs["refs/tags/"+tag] = tagHash
+		refs["refs/tags/"+tag+"^{}"] = peeledHash
+	}
+	return refs
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("v1.4.2")
+	assert.NoError(t, err)
+	assert.Equal(t, Version{Major: 1, Minor: 4, Patch: 2}, v)
+	v, err = ParseVersion("2.0.0-rc.1+build.5")
+	assert.NoError(t, err)
+	assert.Equal(t, Version{Major: 2, PreRelease: "rc.1"}, v)
+	for _, invalid := range []string{"", "v1.4", "1.4.2.1", "01.4.2", "release-1.4.2", "latest"} {
+		_, err = ParseVersion(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"0.9.9", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0", "2.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		lower, _ := ParseVersion(ordered[i-1])
+		higher, _ := ParseVersion(ordered[i])
+		assert.Equal(t, -1, lower.Compare(higher), "%s < %s", ordered[i-1], ordered[i])
+		assert.Equal(t, 1, higher.Compare(lower), "%s > %s", ordered[i], ordered[i-1])
+	}
+	v, _ := ParseVersion("v1.0.0")
+	w, _ := ParseVersion("1.0.0+build")
+	assert.Equal(t, 0, v.Compare(w))
+}
+
+func TestParseConstraint(t *testing.T) {
+	for _, invalid := range []string{"", " , ", ">=1.x", "=>1.0.0", ">=1.0.0 <two"} {
+		_, err := ParseConstraint(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestHighestTag(t *testing.T) {
+	tags := []string{"v1.3.9", "v1.4.0", "v1.4.2", "v1.5.0-rc.1", "v1.10.1", "v2.0.0", "v2.1.0-beta", "release-3.0.0", "latest", "0.2.3", "0.3.0"}
+	tests := []struct {
+		constraint string
+		tag        string
+	}{
+		{">=1.4.0 <2.0.0", "v1.10.1"},
+		{">=1.4.0, <1.5.0", "v1.4.2"},
+		{"~1.4", "v1.4.2"},
+		{"~1.4.1", "v1.4.2"},
+		{"~1", "v1.10.1"},
+		{"^1.4.0", "v1.10.1"},
+		{"^0.2", "0.2.3"},
+		{"^0", "0.3.0"},
+		{"1.4.0", "v1.4.0"},
+		{"=1.4", "v1.4.0"},
+		{"<1.4.0", "v1.3.9"},
+		{">=1.0.0 !=2.0.0 <3.0.0", "v1.10.1"},
+		{">1.0.0", "v2.0.0"},
+		{"<=1.4.2", "v1.4.2"},
+		// the release candidates are only picked when named
+		{"~1.5", ""},
+		{">=1.5.0-rc.1 <1.6.0", "v1.5.0-rc.1"},
+		{">=3.0.0", ""},
+	}
+	refs := tagRefs(tags...)
+	for _, tt := range tests {
+		constraint, err := ParseConstraint(tt.constraint)
+		if !assert.NoError(t, err, tt.constraint) {
+			continue
+		}
+		tag, err := refs.HighestTag(constraint)
+		if tt.tag == "" {
+			assert.Equal(t, ErrRefNotFound, err, tt.constraint)
+			continue
+		}
+		assert.NoError(t, err, tt.constraint)
+		assert.Equal(t, tt.tag, tag, tt.constraint)
+	}
+
+	// the same version tagged with and without the v prefix resolves to the same tag every time
+	constraint, _ := ParseConstraint("^1.0.0")
+	for i := 0; i < 10; i++ {
+		tag, err := tagRefs("1.2.0", "v1.2.0").HighestTag(constraint)
+		assert.NoError(t, err)
+		assert.Equal(t, "1.2.0", tag)
+	}
+}
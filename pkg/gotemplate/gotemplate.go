@@ -0,0 +1,182 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+)
+
+// LoadParameters reads the YAML parameter files and merges them in order, the values of a file overriding the ones of
+// the previous files. Nested maps are merged, any other value is replaced.
+func LoadParameters(files ...string) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		parameters, err := parseParameters(data)
+		if err != nil {
+			return nil, fmt.Errorf("parameter file %s is invalid: %v", file, err)
+		}
+		mergeParameters(merged, parameters)
+	}
+	return merged, nil
+}
+
+// parseParameters parses a YAML document into a map. The numbers are kept as written, so that large integers aren't
+// rendered in scientific notation.
+func parseParameters(data []byte) (map[string]interface{}, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	parameters := map[string]interface{}{}
+	if string(data) == "null" {
+		return parameters, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&parameters)
+	return parameters, err
+}
+
+func mergeParameters(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeParameters(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// ParameterFiles returns the parameter files of dir: file if it is set, all the .yaml and .yml files of dir otherwise,
+// sorted by name
+func ParameterFiles(dir, file string) ([]string, error) {
+	if file != "" {
+		return []string{filepath.Join(dir, file)}, nil
+	}
+	files := []string{}
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Render renders every file of templateDir as a Go template with parameters, into the same path under manifestDir.
+// The files whose name starts with an underscore only define named templates, shared by the other files, and aren't
+// rendered. The hidden files and directories, e.g. .git, are skipped. The errors name the file and line of the
+// failing template.
+func Render(templateDir, manifestDir string, parameters map[string]interface{}) error {
+	files := []string{}
+	helpers := []string{}
+	err := filepath.Walk(templateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if strings.HasPrefix(name, ".") && path != templateDir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(name, "_") {
+			helpers = append(helpers, path)
+		} else {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	root := template.New("").Funcs(FuncMap())
+	// like in helm charts, include renders a named template into a string, which can be piped, e.g. into nindent
+	root.Funcs(template.FuncMap{
+		"include": func(name string, data interface{}) (string, error) {
+			var rendered bytes.Buffer
+			err := root.ExecuteTemplate(&rendered, name, data)
+			return rendered.String(), err
+		},
+	})
+	for _, path := range helpers {
+		if _, err := parseFile(root, templateDir, path); err != nil {
+			return err
+		}
+	}
+	for _, path := range files {
+		tmpl, err := parseFile(root, templateDir, path)
+		if err != nil {
+			return err
+		}
+		var rendered bytes.Buffer
+		err = tmpl.Execute(&rendered, parameters)
+		if err != nil {
+			return err
+		}
+		// like helm, the missing parameters render as empty strings
+		output := strings.Replace(rendered.String(), "<no value>", "", -1)
+		name, _ := filepath.Rel(templateDir, path)
+		target := filepath.Join(manifestDir, name)
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(target, []byte(output), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFile parses the template at path into root, named after its path relative to templateDir so that the errors
+// name it, e.g. "template: apps/deployment.yaml:12: function "foo" not defined"
+func parseFile(root *template.Template, templateDir, path string) (*template.Template, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name, err := filepath.Rel(templateDir, path)
+	if err != nil {
+		return nil, err
+	}
+	return root.New(filepath.ToSlash(name)).Parse(string(data))
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gotemplate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles writes the files, by path relative to dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// render renders the templates with the parameter files, returning the rendered files by path
+func render(t *testing.T, templates, parameters map[string]string, parameterFile string) (map[string]string, error) {
+	tmp, err := ioutil.TempDir("", "gotemplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	templateDir := filepath.Join(tmp, "templates")
+	parameterDir := filepath.Join(tmp, "parameters")
+	manifestDir := filepath.Join(tmp, "manifests")
+	writeFiles(t, templateDir, templates)
+	writeFiles(t, parameterDir, parameters)
+
+	files, err := ParameterFiles(parameterDir, parameterFile)
+	if err != nil {
+		return nil, err
+	}
+	values, err := LoadParameters(files...)
+	if err != nil {
+		return nil, err
+	}
+	err = Render(templateDir, manifestDir, values)
+	if err != nil {
+		return nil, err
+	}
+	rendered := map[string]string{}
+	err = filepath.Walk(manifestDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		name, _ := filepath.Rel(manifestDir, path)
+		rendered[filepath.ToSlash(name)] = string(data)
+		return err
+	})
+	return rendered, err
+}
+
+func TestRender(t *testing.T) {
+	templates := map[string]string{
+		"_helpers.tpl": `{{ define "labels" }}app: {{ .name }}
+tier: {{ .tier | default "web" }}{{ end }}`,
+		"deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .name }}
+  labels:{{ include "labels" . | nindent 4 }}
+spec:
+  replicas: {{ .replicas }}
+  template:
+    spec:
+      containers:
+      - name: {{ .name }}
+        image: {{ .image.repository }}:{{ .image.tag | quote }}
+        resources:
+          limits: {{ .resources | toJson }}
+`,
+		"config/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name | upper | lower }}-{{ .missing }}config
+data:
+  hosts: {{ join "," .hosts }}
+  settings: |{{ .settings | toYaml | nindent 4 }}
+`,
+		".git/config": "{{ .broken",
+	}
+	parameters := map[string]string{
+		"base.yaml": `name: frontend
+replicas: 1000000
+image:
+  repository: nginx
+  tag: "1.17"
+resources:
+  cpu: 100m
+hosts: [a, b]
+settings:
+  debug: false
+`,
+		"prod.yml": `image:
+  tag: "1.19"
+settings:
+  level: 3
+`,
+	}
+	rendered, err := render(t, templates, parameters, "")
+	assert.NoError(t, err)
+	assert.Len(t, rendered, 2, "the helpers and hidden files aren't rendered")
+	assert.Equal(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+  labels:
+    app: frontend
+    tier: web
+spec:
+  replicas: 1000000
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: nginx:"1.19"
+        resources:
+          limits: {"cpu":"100m"}
+`, rendered["deployment.yaml"])
+	assert.Equal(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: frontend-config
+data:
+  hosts: a,b
+  settings: |
+    debug: false
+    level: 3
+`, rendered["config/configmap.yaml"])
+
+	// a parameter file can be selected
+	rendered, err = render(t, templates, parameters, "base.yaml")
+	assert.NoError(t, err)
+	assert.Contains(t, rendered["deployment.yaml"], `image: nginx:"1.17"`)
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		templates  map[string]string
+		parameters string
+		err        string
+	}{
+		{
+			name:      "parse error",
+			templates: map[string]string{"apps/deployment.yaml": "kind: Deployment\nmetadata:\n  name: {{ .name }\n"},
+			err:       `template: apps/deployment.yaml:3: unexpected "}" in operand`,
+		},
+		{
+			name:      "unknown function",
+			templates: map[string]string{"service.yaml": "kind: Service\n\nname: {{ .name | shout }}\n"},
+			err:       `template: service.yaml:3: function "shout" not defined`,
+		},
+		{
+			name:      "required parameter",
+			templates: map[string]string{"service.yaml": "kind: Service\nport: {{ required \"port is required\" .port }}\n"},
+			err:       `template: service.yaml:2:9: executing "service.yaml" at <required "port is required" .port>: error calling required: port is required`,
+		},
+		{
+			name:       "invalid parameters",
+			templates:  map[string]string{"service.yaml": "kind: Service\n"},
+			parameters: "name: [frontend\n",
+			err:        "parameter file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := render(t, tt.templates, map[string]string{"values.yaml": tt.parameters}, "")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadParametersMissingFile(t *testing.T) {
+	_, err := LoadParameters("/nonexistent/values.yaml")
+	assert.Error(t, err)
+}
+
+func TestFuncMap(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`{{ .missing | default "x" }}`, "x"},
+		{`{{ "" | default "x" }}`, "x"},
+		{`{{ .zero | default 5 }}`, "5"},
+		{`{{ "y" | default "x" }}`, "y"},
+		{`{{ empty .list }}`, "false"},
+		{`{{ "a b" | quote }}`, `"a b"`},
+		{`{{ "a" | squote }}`, "'a'"},
+		{`{{ " a " | trim }}`, "a"},
+		{`{{ "v1.2" | trimPrefix "v" }}`, "1.2"},
+		{`{{ "app.yaml" | trimSuffix ".yaml" }}`, "app"},
+		{`{{ "a-b" | replace "-" "_" }}`, "a_b"},
+		{`{{ contains "b" "abc" }}`, "true"},
+		{`{{ hasPrefix "a" "abc" }}`, "true"},
+		{`{{ hasSuffix "a" "abc" }}`, "false"},
+		{`{{ splitList "," "a,b" | join "-" }}`, "a-b"},
+		{`{{ .list | join "," }}`, "1,2"},
+		{`{{ "a\nb" | indent 2 }}`, "  a\n  b"},
+		{`{{ "hello world" | title }}`, "Hello World"},
+		{`{{ "s3cr3t" | b64enc }}`, "czNjcjN0"},
+		{`{{ "czNjcjN0" | b64dec }}`, "s3cr3t"},
+		{`{{ list 1 "a" | toJson }}`, `[1,"a"]`},
+		{`{{ env "GOTEMPLATE_TEST" }}`, "set"},
+	}
+	os.Setenv("GOTEMPLATE_TEST", "set")
+	defer os.Unsetenv("GOTEMPLATE_TEST")
+	data := map[string]interface{}{"zero": 0, "list": []interface{}{1, 2}}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := template.New("test").Funcs(FuncMap()).Parse(tt.template)
+			if !assert.NoError(t, err) {
+				return
+			}
+			var rendered strings.Builder
+			assert.NoError(t, tmpl.Execute(&rendered, data))
+			assert.Equal(t, tt.expected, rendered.String())
+		})
+	}
+}
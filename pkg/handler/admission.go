@@ -0,0 +1,191 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	gitopsv1beta1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1beta1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/appscode/jsonpatch"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AdmissionPath is the path of the validating admission webhook of the GitOpsConfigs
+const AdmissionPath string = "/validate-gitopsconfig"
+
+// DefaultingPath is the path of the mutating admission webhook of the GitOpsConfigs
+const DefaultingPath string = "/default-gitopsconfig"
+
+// AdmissionHandler answers the AdmissionReviews of the GitOpsConfigs being created or updated, rejecting the ones
+// the operator would refuse to run, so that kubectl apply fails with the reason instead of a job failing later.
+// The Secrets and ServiceAccounts they reference are looked up with reader.
+func AdmissionHandler(w http.ResponseWriter, r *http.Request, reader client.Reader) {
+	serveAdmission(w, r, func(request *admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error) {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}, validateAdmission(request, reader)
+	})
+}
+
+// DefaultingHandler answers the AdmissionReviews of the GitOpsConfigs being created or updated with the patch
+// setting the defaults of the fields they leave empty
+func DefaultingHandler(w http.ResponseWriter, r *http.Request) {
+	serveAdmission(w, r, defaultAdmission)
+}
+
+// serveAdmission answers the AdmissionReview posted in r with the response of review, the GitOpsConfig being
+// rejected if review fails
+func serveAdmission(w http.ResponseWriter, r *http.Request, review func(*admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error)) {
+	if r.Method != "POST" {
+		w.WriteHeader(405)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error(err, "error reading request body")
+		w.WriteHeader(400)
+		return
+	}
+	defer r.Body.Close()
+	admissionReview := admissionv1beta1.AdmissionReview{}
+	if err = json.Unmarshal(body, &admissionReview); err != nil || admissionReview.Request == nil {
+		log.Info("invalid admission review", "error", fmt.Sprint(err))
+		w.WriteHeader(400)
+		return
+	}
+	request := admissionReview.Request
+	response, err := review(request)
+	if err != nil {
+		log.Info("rejecting GitOpsConfig", "namespace", request.Namespace, "name", request.Name, "reason", err.Error())
+		response = &admissionv1beta1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  metav1.StatusReasonInvalid,
+				Code:    422,
+				Message: err.Error(),
+			},
+		}
+	}
+	response.UID = request.UID
+	admissionReview.Response = response
+	admissionReview.Request = nil
+	answer, err := json.Marshal(admissionReview)
+	if err != nil {
+		log.Error(err, "unable to encode the admission review")
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(answer)
+}
+
+// validateAdmission returns why the GitOpsConfig of request must be rejected, nil if it can be admitted. The
+// GitOpsConfigs being deleted and the updates leaving the spec unchanged, e.g. of the finalizers, are always
+// admitted, so that a Secret deleted since doesn't block them.
+func validateAdmission(request *admissionv1beta1.AdmissionRequest, reader client.Reader) error {
+	if request.Operation != admissionv1beta1.Create && request.Operation != admissionv1beta1.Update {
+		return nil
+	}
+	instance, err := decodeGitOpsConfig(request.Object.Raw, request.Kind.Version)
+	if err != nil {
+		return err
+	}
+	if instance.GetDeletionTimestamp() != nil {
+		return nil
+	}
+	if request.Operation == admissionv1beta1.Update {
+		if old, err := decodeGitOpsConfig(request.OldObject.Raw, request.Kind.Version); err == nil && reflect.DeepEqual(old.Spec, instance.Spec) {
+			return nil
+		}
+	}
+	if instance.GetNamespace() == "" {
+		instance.SetNamespace(request.Namespace)
+	}
+	return gitopsconfig.ValidateGitOpsConfig(reader, instance)
+}
+
+// defaultAdmission returns the response admitting the GitOpsConfig of request with the JSON patch setting its
+// defaults, if any. The GitOpsConfigs being deleted are admitted unchanged.
+func defaultAdmission(request *admissionv1beta1.AdmissionRequest) (*admissionv1beta1.AdmissionResponse, error) {
+	response := &admissionv1beta1.AdmissionResponse{Allowed: true}
+	if request.Operation != admissionv1beta1.Create && request.Operation != admissionv1beta1.Update {
+		return response, nil
+	}
+	instance, err := decodeGitOpsConfig(request.Object.Raw, request.Kind.Version)
+	if err != nil {
+		return nil, err
+	}
+	if instance.GetDeletionTimestamp() != nil {
+		return response, nil
+	}
+	// the patch is computed between the decoded GitOpsConfigs, so that it doesn't remove the fields unknown here, in
+	// the version of the request
+	original, err := encodeGitOpsConfig(instance, request.Kind.Version)
+	if err != nil {
+		return nil, err
+	}
+	gitopsconfig.DefaultGitOpsConfig(instance)
+	defaulted, err := encodeGitOpsConfig(instance, request.Kind.Version)
+	if err != nil {
+		return nil, err
+	}
+	operations, err := jsonpatch.CreatePatch(original, defaulted)
+	if err != nil || len(operations) == 0 {
+		return response, err
+	}
+	if response.Patch, err = json.Marshal(operations); err != nil {
+		return nil, err
+	}
+	patchType := admissionv1beta1.PatchTypeJSONPatch
+	response.PatchType = &patchType
+	return response, nil
+}
+
+// decodeGitOpsConfig returns the GitOpsConfig of raw in the API version of an AdmissionRequest, converted to v1alpha1
+func decodeGitOpsConfig(raw []byte, version string) (*gitopsv1alpha1.GitOpsConfig, error) {
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	if version != gitopsv1beta1.SchemeGroupVersion.Version {
+		if err := json.Unmarshal(raw, instance); err != nil {
+			return nil, fmt.Errorf("unable to decode the GitOpsConfig: %s", err)
+		}
+		return instance, nil
+	}
+	decoded := &gitopsv1beta1.GitOpsConfig{}
+	if err := json.Unmarshal(raw, decoded); err != nil {
+		return nil, fmt.Errorf("unable to decode the GitOpsConfig: %s", err)
+	}
+	return instance, decoded.ConvertTo(instance)
+}
+
+// encodeGitOpsConfig returns the JSON of instance in the API version of an AdmissionRequest
+func encodeGitOpsConfig(instance *gitopsv1alpha1.GitOpsConfig, version string) ([]byte, error) {
+	if version != gitopsv1beta1.SchemeGroupVersion.Version {
+		return json.Marshal(instance)
+	}
+	converted := &gitopsv1beta1.GitOpsConfig{}
+	if err := converted.ConvertFrom(instance); err != nil {
+		return nil, err
+	}
+	return json.Marshal(converted)
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/appscode/jsonpatch"
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newValidGitOpsConfig returns a GitOpsConfig referencing the Secret and the ServiceAccount known to
+// sendAdmissionReview
+func newValidGitOpsConfig() gitopsv1alpha1.GitOpsConfig {
+	instance := newGitOpsConfig("gitops", "gitops-operator", "https://github.com/KohlsTechnology/eunomia.git")
+	instance.Spec.TemplateSource.SecretRef = "git-credentials"
+	instance.Spec.ServiceAccountRef = "eunomia-runner"
+	instance.Spec.ResourceHandlingMode = "CreateOrMerge"
+	instance.Spec.ResourceDeletionMode = "Delete"
+	return instance
+}
+
+// sendAdmissionReview posts an AdmissionReview of operation on instance, old being the GitOpsConfig it updates, and
+// returns the response of the webhook
+func sendAdmissionReview(t *testing.T, operation admissionv1beta1.Operation, instance, old *gitopsv1alpha1.GitOpsConfig) *admissionv1beta1.AdmissionResponse {
+	reader := fake.NewFakeClient(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-credentials", Namespace: "gitops"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "eunomia-runner", Namespace: "gitops"}},
+	)
+	request := &admissionv1beta1.AdmissionRequest{
+		UID:       "b7f1c4a2",
+		Operation: operation,
+		Namespace: instance.GetNamespace(),
+		Name:      instance.GetName(),
+		Object:    rawExtension(t, instance),
+	}
+	if old != nil {
+		request.OldObject = rawExtension(t, old)
+	}
+	body, err := json.Marshal(admissionv1beta1.AdmissionReview{Request: request})
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	AdmissionHandler(rr, httptest.NewRequest("POST", AdmissionPath, bytes.NewReader(body)), reader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	review := admissionv1beta1.AdmissionReview{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &review))
+	if assert.NotNil(t, review.Response) {
+		assert.EqualValues(t, "b7f1c4a2", review.Response.UID)
+	}
+	return review.Response
+}
+
+func rawExtension(t *testing.T, instance *gitopsv1alpha1.GitOpsConfig) runtime.RawExtension {
+	raw, err := json.Marshal(instance)
+	assert.NoError(t, err)
+	return runtime.RawExtension{Raw: raw}
+}
+
+func TestAdmissionRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*gitopsv1alpha1.GitOpsConfig)
+		message string
+	}{
+		{
+			name:    "missing template source URI",
+			mutate:  func(instance *gitopsv1alpha1.GitOpsConfig) { instance.Spec.TemplateSource.URI = "" },
+			message: "template source URI cannot be empty",
+		},
+		{
+			name:    "invalid resourceHandlingMode",
+			mutate:  func(instance *gitopsv1alpha1.GitOpsConfig) { instance.Spec.ResourceHandlingMode = "Apply" },
+			message: `resourceHandlingMode "Apply" is not one of`,
+		},
+		{
+			name:    "invalid resourceDeletionMode",
+			mutate:  func(instance *gitopsv1alpha1.GitOpsConfig) { instance.Spec.ResourceDeletionMode = "Cascade" },
+			message: `resourceDeletionMode "Cascade" is not one of`,
+		},
+		{
+			name: "malformed template source URI",
+			mutate: func(instance *gitopsv1alpha1.GitOpsConfig) {
+				instance.Spec.TemplateSource.URI = "github.com KohlsTechnology"
+			},
+			message: `template source uri "github.com KohlsTechnology" is not a git repository URI`,
+		},
+		{
+			name: "missing Secret",
+			mutate: func(instance *gitopsv1alpha1.GitOpsConfig) {
+				instance.Spec.ParameterSource.SecretRef = "other-credentials"
+			},
+			message: "secret other-credentials referenced by the sources doesn't exist in namespace gitops",
+		},
+		{
+			name:    "missing ServiceAccount",
+			mutate:  func(instance *gitopsv1alpha1.GitOpsConfig) { instance.Spec.ServiceAccountRef = "other-runner" },
+			message: "serviceAccountRef other-runner doesn't exist in namespace gitops",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := newValidGitOpsConfig()
+			tt.mutate(&instance)
+			response := sendAdmissionReview(t, admissionv1beta1.Create, &instance, nil)
+			if assert.NotNil(t, response) {
+				assert.False(t, response.Allowed)
+				if assert.NotNil(t, response.Result) {
+					assert.Contains(t, response.Result.Message, tt.message)
+					assert.Equal(t, metav1.StatusReasonInvalid, response.Result.Reason)
+				}
+			}
+		})
+	}
+}
+
+func TestAdmissionPinnedImages(t *testing.T) {
+	gitopsconfig.SetRequirePinnedImages(true)
+	defer gitopsconfig.SetRequirePinnedImages(false)
+	tests := []struct {
+		image   string
+		allowed bool
+	}{
+		{"quay.io/kohlstechnology/eunomia-base:latest", false},
+		{"quay.io/kohlstechnology/eunomia-base", false},
+		{"quay.io/kohlstechnology/eunomia-base:v0.1.0", true},
+		{"quay.io/kohlstechnology/eunomia-base@sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2", true},
+	}
+	for _, tt := range tests {
+		instance := newValidGitOpsConfig()
+		instance.Spec.TemplateProcessorImage = tt.image
+		response := sendAdmissionReview(t, admissionv1beta1.Create, &instance, nil)
+		if assert.NotNil(t, response, tt.image) {
+			assert.Equal(t, tt.allowed, response.Allowed, tt.image)
+		}
+	}
+}
+
+func TestAdmissionAllowed(t *testing.T) {
+	instance := newValidGitOpsConfig()
+	response := sendAdmissionReview(t, admissionv1beta1.Create, &instance, nil)
+	if assert.NotNil(t, response) {
+		assert.True(t, response.Allowed)
+	}
+
+	// the finalizers of a GitOpsConfig whose Secret is gone can still be updated
+	old := newValidGitOpsConfig()
+	old.Spec.TemplateSource.SecretRef = "deleted-credentials"
+	updated := old.DeepCopy()
+	updated.Finalizers = []string{"eunomia-finalizer"}
+	response = sendAdmissionReview(t, admissionv1beta1.Update, updated, &old)
+	if assert.NotNil(t, response) {
+		assert.True(t, response.Allowed)
+	}
+
+	// but not its spec
+	updated.Spec.TemplateSource.Ref = "develop"
+	response = sendAdmissionReview(t, admissionv1beta1.Update, updated, &old)
+	if assert.NotNil(t, response) {
+		assert.False(t, response.Allowed)
+	}
+}
+
+func TestAdmissionMethod(t *testing.T) {
+	rr := httptest.NewRecorder()
+	AdmissionHandler(rr, httptest.NewRequest("GET", AdmissionPath, nil), fake.NewFakeClient())
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = httptest.NewRecorder()
+	AdmissionHandler(rr, httptest.NewRequest("POST", AdmissionPath, bytes.NewReader([]byte("{}"))), fake.NewFakeClient())
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDefaulting(t *testing.T) {
+	send := func(instance *gitopsv1alpha1.GitOpsConfig) *admissionv1beta1.AdmissionResponse {
+		body, err := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{
+			UID:       "0e6a9d31",
+			Operation: admissionv1beta1.Create,
+			Object:    rawExtension(t, instance),
+		}})
+		assert.NoError(t, err)
+		rr := httptest.NewRecorder()
+		DefaultingHandler(rr, httptest.NewRequest("POST", DefaultingPath, bytes.NewReader(body)))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		review := admissionv1beta1.AdmissionReview{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &review))
+		if assert.NotNil(t, review.Response) {
+			assert.True(t, review.Response.Allowed)
+			assert.EqualValues(t, "0e6a9d31", review.Response.UID)
+		}
+		return review.Response
+	}
+
+	instance := newGitOpsConfig("gitops", "gitops-operator", "https://github.com/KohlsTechnology/eunomia.git")
+	instance.Spec.ResourceHandlingMode = "Patch"
+	response := send(&instance)
+	if assert.NotNil(t, response) && assert.NotNil(t, response.PatchType) {
+		assert.Equal(t, admissionv1beta1.PatchTypeJSONPatch, *response.PatchType)
+		operations := []jsonpatch.Operation{}
+		assert.NoError(t, json.Unmarshal(response.Patch, &operations))
+		patched := map[string]interface{}{}
+		for _, operation := range operations {
+			assert.Equal(t, "add", operation.Operation)
+			patched[operation.Path] = operation.Value
+		}
+		assert.Equal(t, map[string]interface{}{
+			"/spec/templateProcessorImage": "quay.io/kohlstechnology/eunomia-base:latest",
+			"/spec/resourceDeletionMode":   "Retain",
+			"/spec/serviceAccountRef":      "gitops-operator",
+		}, patched, "the resourceHandlingMode set is kept")
+	}
+
+	// nothing left to default
+	instance = newValidGitOpsConfig()
+	instance.Spec.TemplateProcessorImage = "example.com/processor:v1"
+	response = send(&instance)
+	if assert.NotNil(t, response) {
+		assert.Nil(t, response.PatchType)
+		assert.Empty(t, response.Patch)
+	}
+}
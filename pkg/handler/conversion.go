@@ -0,0 +1,116 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	gitopsv1beta1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1beta1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ConversionPath is the path of the conversion webhook of the GitOpsConfigs
+const ConversionPath string = "/convert-gitopsconfig"
+
+// ConversionHandler answers the ConversionReviews of the API server with the GitOpsConfigs converted between v1alpha1
+// and v1beta1. A failure to convert one of them fails the whole review, as the API server expects.
+func ConversionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(405)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error(err, "error reading request body")
+		w.WriteHeader(400)
+		return
+	}
+	defer r.Body.Close()
+	review := apiextensionsv1beta1.ConversionReview{}
+	if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		log.Info("invalid conversion review", "error", fmt.Sprint(err))
+		w.WriteHeader(400)
+		return
+	}
+	response := &apiextensionsv1beta1.ConversionResponse{
+		UID:    review.Request.UID,
+		Result: metav1.Status{Status: metav1.StatusSuccess},
+	}
+	for _, object := range review.Request.Objects {
+		converted, err := convertGitOpsConfig(object.Raw, review.Request.DesiredAPIVersion)
+		if err != nil {
+			log.Info("unable to convert GitOpsConfig", "desiredAPIVersion", review.Request.DesiredAPIVersion, "reason", err.Error())
+			response.ConvertedObjects = nil
+			response.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			break
+		}
+		response.ConvertedObjects = append(response.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+	review.Response = response
+	review.Request = nil
+	answer, err := json.Marshal(review)
+	if err != nil {
+		log.Error(err, "unable to encode the conversion review")
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(answer)
+}
+
+// convertGitOpsConfig returns the JSON of the GitOpsConfig raw in the desired API version
+func convertGitOpsConfig(raw []byte, desiredAPIVersion string) ([]byte, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, fmt.Errorf("unable to decode the GitOpsConfig: %s", err)
+	}
+	if typeMeta.Kind != "GitOpsConfig" {
+		return nil, fmt.Errorf("unable to convert the kind %q, only GitOpsConfig is supported", typeMeta.Kind)
+	}
+	if typeMeta.APIVersion == desiredAPIVersion {
+		return raw, nil
+	}
+	switch {
+	case typeMeta.APIVersion == gitopsv1alpha1.SchemeGroupVersion.String() && desiredAPIVersion == gitopsv1beta1.SchemeGroupVersion.String():
+		instance := &gitopsv1alpha1.GitOpsConfig{}
+		if err := json.Unmarshal(raw, instance); err != nil {
+			return nil, fmt.Errorf("unable to decode the GitOpsConfig: %s", err)
+		}
+		converted := &gitopsv1beta1.GitOpsConfig{}
+		if err := converted.ConvertFrom(instance); err != nil {
+			return nil, err
+		}
+		return json.Marshal(converted)
+	case typeMeta.APIVersion == gitopsv1beta1.SchemeGroupVersion.String() && desiredAPIVersion == gitopsv1alpha1.SchemeGroupVersion.String():
+		instance := &gitopsv1beta1.GitOpsConfig{}
+		if err := json.Unmarshal(raw, instance); err != nil {
+			return nil, fmt.Errorf("unable to decode the GitOpsConfig: %s", err)
+		}
+		converted := &gitopsv1alpha1.GitOpsConfig{}
+		if err := instance.ConvertTo(converted); err != nil {
+			return nil, err
+		}
+		return json.Marshal(converted)
+	}
+	return nil, fmt.Errorf("unable to convert the GitOpsConfig from %s to %s", typeMeta.APIVersion, desiredAPIVersion)
+}
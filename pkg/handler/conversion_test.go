@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	gitopsv1beta1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1beta1"
+	"github.com/appscode/jsonpatch"
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// sendConversionReview posts a ConversionReview of objects to desiredAPIVersion and returns the response of the webhook
+func sendConversionReview(t *testing.T, desiredAPIVersion string, objects ...interface{}) *apiextensionsv1beta1.ConversionResponse {
+	request := &apiextensionsv1beta1.ConversionRequest{UID: "5d2e8f10", DesiredAPIVersion: desiredAPIVersion}
+	for _, object := range objects {
+		raw, err := json.Marshal(object)
+		assert.NoError(t, err)
+		request.Objects = append(request.Objects, runtime.RawExtension{Raw: raw})
+	}
+	body, err := json.Marshal(apiextensionsv1beta1.ConversionReview{Request: request})
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	ConversionHandler(rr, httptest.NewRequest("POST", ConversionPath, bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	review := apiextensionsv1beta1.ConversionReview{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &review))
+	if assert.NotNil(t, review.Response) {
+		assert.EqualValues(t, "5d2e8f10", review.Response.UID)
+	}
+	return review.Response
+}
+
+func TestConversion(t *testing.T) {
+	alpha := newGitOpsConfig("gitops", "gitops-operator", "https://github.com/KohlsTechnology/eunomia.git")
+	alpha.SetGroupVersionKind(gitopsv1alpha1.SchemeGroupVersion.WithKind("GitOpsConfig"))
+	alpha.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Change"}, {Type: "Time", Cron: "0 * * * *"}}
+	alpha.Status.ConsecutiveFailures = 2
+
+	response := sendConversionReview(t, "eunomia.kohls.io/v1beta1", alpha)
+	if !assert.NotNil(t, response) || !assert.Equal(t, metav1.StatusSuccess, response.Result.Status) || !assert.Len(t, response.ConvertedObjects, 1) {
+		return
+	}
+	beta := gitopsv1beta1.GitOpsConfig{}
+	assert.NoError(t, json.Unmarshal(response.ConvertedObjects[0].Raw, &beta))
+	assert.Equal(t, "eunomia.kohls.io/v1beta1", beta.APIVersion)
+	assert.Equal(t, alpha.ObjectMeta.Name, beta.Name)
+	assert.Equal(t, gitopsv1beta1.TriggerPeriodic, beta.Spec.Triggers[1].Type)
+	assert.Equal(t, alpha.Spec.TemplateSource.URI, beta.Spec.TemplateSource.URI)
+	assert.Equal(t, int32(2), beta.Status.ConsecutiveFailures)
+
+	// converting back restores the v1alpha1 GitOpsConfig
+	response = sendConversionReview(t, "eunomia.kohls.io/v1alpha1", beta)
+	if !assert.NotNil(t, response) || !assert.Len(t, response.ConvertedObjects, 1) {
+		return
+	}
+	roundTripped := gitopsv1alpha1.GitOpsConfig{}
+	assert.NoError(t, json.Unmarshal(response.ConvertedObjects[0].Raw, &roundTripped))
+	assert.Equal(t, alpha, roundTripped)
+}
+
+func TestConversionFailed(t *testing.T) {
+	alpha := newGitOpsConfig("gitops", "gitops-operator", "https://github.com/KohlsTechnology/eunomia.git")
+	alpha.SetGroupVersionKind(gitopsv1alpha1.SchemeGroupVersion.WithKind("GitOpsConfig"))
+	other := alpha.DeepCopy()
+	other.SetGroupVersionKind(gitopsv1alpha1.SchemeGroupVersion.WithKind("Widget"))
+
+	// a single object that can't be converted fails the review
+	response := sendConversionReview(t, "eunomia.kohls.io/v1beta1", alpha, other)
+	if assert.NotNil(t, response) {
+		assert.Equal(t, metav1.StatusFailure, response.Result.Status)
+		assert.Equal(t, `unable to convert the kind "Widget", only GitOpsConfig is supported`, response.Result.Message)
+		assert.Empty(t, response.ConvertedObjects)
+	}
+	response = sendConversionReview(t, "eunomia.kohls.io/v2", alpha)
+	if assert.NotNil(t, response) {
+		assert.Equal(t, "unable to convert the GitOpsConfig from eunomia.kohls.io/v1alpha1 to eunomia.kohls.io/v2", response.Result.Message)
+	}
+
+	rr := httptest.NewRecorder()
+	ConversionHandler(rr, httptest.NewRequest("POST", ConversionPath, bytes.NewReader([]byte("{}"))))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDefaultingV1beta1(t *testing.T) {
+	alpha := newGitOpsConfig("gitops", "gitops-operator", "https://github.com/KohlsTechnology/eunomia.git")
+	alpha.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Periodic", Cron: "0 * * * *"}}
+	instance := &gitopsv1beta1.GitOpsConfig{}
+	assert.NoError(t, instance.ConvertFrom(&alpha))
+	raw, err := json.Marshal(instance)
+	assert.NoError(t, err)
+	body, err := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{
+		UID:       "0e6a9d31",
+		Kind:      metav1.GroupVersionKind{Group: "eunomia.kohls.io", Version: "v1beta1", Kind: "GitOpsConfig"},
+		Operation: admissionv1beta1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}})
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	DefaultingHandler(rr, httptest.NewRequest("POST", DefaultingPath, bytes.NewReader(body)))
+	review := admissionv1beta1.AdmissionReview{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &review))
+	if !assert.NotNil(t, review.Response) || !assert.True(t, review.Response.Allowed) {
+		return
+	}
+	// the patch only sets the defaults of the v1beta1 GitOpsConfig, its apiVersion is left as it is
+	operations := []jsonpatch.Operation{}
+	assert.NoError(t, json.Unmarshal(review.Response.Patch, &operations))
+	paths := []string{}
+	for _, operation := range operations {
+		assert.Equal(t, "add", operation.Operation)
+		paths = append(paths, operation.Path)
+	}
+	assert.ElementsMatch(t, []string{"/spec/templateProcessorImage", "/spec/resourceDeletionMode", "/spec/serviceAccountRef", "/spec/resourceHandlingMode"}, paths)
+}
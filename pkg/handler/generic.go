@@ -0,0 +1,153 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// webhookFormatHeader selects the format of the payload of the senders that aren't git providers
+	webhookFormatHeader string = "X-Eunomia-Webhook-Format"
+	// webhookFormatGeneric is the value of webhookFormatHeader selecting the generic format
+	webhookFormatGeneric string = "generic"
+)
+
+// defaultGenericWebhook is the mapping of the generic payloads sent without a mapping configured by their GitOpsConfig,
+// e.g. {"repo": "KohlsTechnology/eunomia", "ref": "refs/heads/master", "commit": "..."}
+var defaultGenericWebhook = gitopsv1alpha1.GenericWebhook{RepoPath: "repo", RefPath: "ref", CommitPath: "commit"}
+
+// genericPayloadError is the error of a generic payload the push can't be extracted from, answered with 400 so that
+// the sender can fix its payload or the mapping
+type genericPayloadError struct {
+	message string
+}
+
+func (e *genericPayloadError) Error() string {
+	return e.message
+}
+
+// genericWebhookMapping returns the generic webhook mapping of the GitOpsConfig targeted by the webhook call, nil if
+// it has none or the call targets none
+func genericWebhookMapping(reconciler GitOpsConfigLister, target types.NamespacedName, scoped bool) (*gitopsv1alpha1.GenericWebhook, error) {
+	if !scoped {
+		return nil, nil
+	}
+	list, err := reconciler.GetAllGitOpsConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range list.Items {
+		if instance.GetNamespace() != target.Namespace || instance.GetName() != target.Name {
+			continue
+		}
+		for _, trigger := range instance.Spec.Triggers {
+			if trigger.Type == "Webhook" {
+				return trigger.Generic, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// parseGenericPush extracts the push of a generic payload with mapping, the default mapping when it is nil. The
+// repository and the ref are required, the commit is optional. The changed files are unknown.
+func parseGenericPush(payload []byte, mapping *gitopsv1alpha1.GenericWebhook) (*pushEvent, error) {
+	paths := defaultGenericWebhook
+	if mapping != nil {
+		if mapping.RepoPath != "" {
+			paths.RepoPath = mapping.RepoPath
+		}
+		if mapping.RefPath != "" {
+			paths.RefPath = mapping.RefPath
+		}
+		if mapping.CommitPath != "" {
+			paths.CommitPath = mapping.CommitPath
+		}
+	}
+	var document interface{}
+	if err := json.Unmarshal(payload, &document); err != nil {
+		return nil, &genericPayloadError{fmt.Sprintf("the generic webhook payload is not valid JSON: %s", err)}
+	}
+	push := &pushEvent{Provider: providerGeneric, Truncated: true}
+	var err error
+	if push.Repo, err = lookupGenericField(document, "repository", paths.RepoPath, true); err != nil {
+		return nil, err
+	}
+	if push.Ref, err = lookupGenericField(document, "ref", paths.RefPath, true); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(push.Ref, "refs/") {
+		push.Ref = "refs/heads/" + push.Ref
+	}
+	if push.After, err = lookupGenericField(document, "commit", paths.CommitPath, false); err != nil {
+		return nil, err
+	}
+	push.RepoURL = push.Repo
+	return push, nil
+}
+
+// lookupGenericField returns the string at path in document, failing when a required field is missing or empty, or
+// when the field isn't a string
+func lookupGenericField(document interface{}, field, path string, required bool) (string, error) {
+	value, found := lookupJSONPath(document, path)
+	if !found || value == nil {
+		if required {
+			return "", &genericPayloadError{fmt.Sprintf("the %s of the generic webhook payload is missing at %s", field, path)}
+		}
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", &genericPayloadError{fmt.Sprintf("the %s of the generic webhook payload at %s is not a string", field, path)}
+	}
+	if s == "" && required {
+		return "", &genericPayloadError{fmt.Sprintf("the %s of the generic webhook payload at %s is empty", field, path)}
+	}
+	return s, nil
+}
+
+// lookupJSONPath returns the value at the dot-separated path of field names and array indexes in the decoded JSON
+// document, and whether it was found
+func lookupJSONPath(document interface{}, path string) (interface{}, bool) {
+	value := document
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, found := node[segment]
+			if !found {
+				return nil, false
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			value = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
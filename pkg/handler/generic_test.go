@@ -0,0 +1,127 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParseGenericPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping *gitopsv1alpha1.GenericWebhook
+		payload string
+		push    *pushEvent
+		err     string
+	}{
+		{
+			name:    "default mapping",
+			payload: `{"repo": "KohlsTechnology/eunomia", "ref": "refs/heads/master", "commit": "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c"}`,
+			push: &pushEvent{
+				Provider:  providerGeneric,
+				Repo:      "KohlsTechnology/eunomia",
+				RepoURL:   "KohlsTechnology/eunomia",
+				Ref:       "refs/heads/master",
+				After:     "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+				Truncated: true,
+			},
+		},
+		{
+			name:    "branch name",
+			payload: `{"repo": "KohlsTechnology/eunomia", "ref": "master"}`,
+			push:    &pushEvent{Provider: providerGeneric, Repo: "KohlsTechnology/eunomia", RepoURL: "KohlsTechnology/eunomia", Ref: "refs/heads/master", Truncated: true},
+		},
+		{
+			name:    "nested fields",
+			mapping: &gitopsv1alpha1.GenericWebhook{RepoPath: "$.build.repository.url", RefPath: "build.sources.0.ref", CommitPath: "build.sources.0.sha"},
+			payload: `{"build": {"repository": {"url": "https://git.example.com/team/app.git"}, "sources": [{"ref": "refs/tags/v1.2.0", "sha": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7"}]}}`,
+			push: &pushEvent{
+				Provider:  providerGeneric,
+				Repo:      "https://git.example.com/team/app.git",
+				RepoURL:   "https://git.example.com/team/app.git",
+				Ref:       "refs/tags/v1.2.0",
+				After:     "da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+				Truncated: true,
+			},
+		},
+		{
+			name:    "partial mapping",
+			mapping: &gitopsv1alpha1.GenericWebhook{RefPath: "branch"},
+			payload: `{"repo": "team/app", "branch": "release/1.0"}`,
+			push:    &pushEvent{Provider: providerGeneric, Repo: "team/app", RepoURL: "team/app", Ref: "refs/heads/release/1.0", Truncated: true},
+		},
+		{name: "missing repository", payload: `{"ref": "master"}`, err: "the repository of the generic webhook payload is missing at repo"},
+		{name: "empty ref", payload: `{"repo": "team/app", "ref": ""}`, err: "the ref of the generic webhook payload at ref is empty"},
+		{name: "index out of range", mapping: &gitopsv1alpha1.GenericWebhook{RefPath: "refs.1"}, payload: `{"repo": "team/app", "refs": ["master"]}`, err: "the ref of the generic webhook payload is missing at refs.1"},
+		{name: "not a string", payload: `{"repo": "team/app", "ref": "master", "commit": 42}`, err: "the commit of the generic webhook payload at commit is not a string"},
+		{name: "invalid JSON", payload: `{"repo": `, err: "the generic webhook payload is not valid JSON: unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			push, err := parseGenericPush([]byte(tt.payload), tt.mapping)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.IsType(t, &genericPayloadError{}, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.push, push)
+		})
+	}
+}
+
+func TestWebhookGeneric(t *testing.T) {
+	config := newGitOpsConfig("team-a", "app", "https://git.example.com/team/app.git")
+	mapped := newGitOpsConfig("team-b", "app", "https://git.example.com/team/app.git")
+	mapped.Spec.Triggers[0].Generic = &gitopsv1alpha1.GenericWebhook{RepoPath: "project.url", RefPath: "project.branch"}
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{config, mapped}}
+	tests := []struct {
+		name      string
+		path      string
+		header    bool
+		payload   string
+		code      int
+		triggered []types.NamespacedName
+	}{
+		{"header", "/webhook/", true, `{"repo": "team/app", "ref": "master"}`, http.StatusOK, []types.NamespacedName{{Namespace: "team-a", Name: "app"}, {Namespace: "team-b", Name: "app"}}},
+		{"header to another branch", "/webhook/", true, `{"repo": "team/app", "ref": "develop"}`, http.StatusOK, nil},
+		{"mapping of the path", "/webhook/team-b/app", false, `{"project": {"url": "https://git.example.com/team/app", "branch": "master"}}`, http.StatusOK, []types.NamespacedName{{Namespace: "team-b", Name: "app"}}},
+		{"missing ref", "/webhook/team-b/app", false, `{"project": {"url": "https://git.example.com/team/app"}}`, http.StatusBadRequest, nil},
+		{"no mapping nor header", "/webhook/team-a/app", false, `{"repo": "team/app", "ref": "master"}`, http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newPushRequest(tt.path, tt.payload)
+			req.Header.Del("X-GitHub-Event")
+			if tt.header {
+				req.Header.Set(webhookFormatHeader, webhookFormatGeneric)
+			}
+			w, triggered := sendRequest(t, lister, req)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.triggered, triggered)
+		})
+	}
+	req := newPushRequest("/webhook/team-b/app", `{"project": {"url": "https://git.example.com/team/app"}}`)
+	req.Header.Del("X-GitHub-Event")
+	w, _ := sendRequest(t, lister, req)
+	assert.Equal(t, "the ref of the generic webhook payload is missing at project.branch\n", w.Body.String())
+}
@@ -17,26 +17,67 @@ limitations under the License.
 package handler
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"path"
 	"strings"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
 	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
-	"github.com/google/go-github/github"
+	"github.com/KohlsTechnology/eunomia/pkg/tracing"
+	"go.opencensus.io/trace"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	k8sevent "sigs.k8s.io/controller-runtime/pkg/event"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 )
 
 var log = logf.Log.WithName("handler")
 
-// WebhookHandler manages the calls from github
-func WebhookHandler(w http.ResponseWriter, r *http.Request, reconciler gitopsconfig.ReconcileGitOpsConfig) {
+// webhookPathPrefix is the path under which the webhook server is mounted
+const webhookPathPrefix string = "/webhook/"
+
+// GitOpsConfigLister lists the GitOpsConfig the webhook can be dispatched to
+type GitOpsConfigLister interface {
+	GetAllGitOpsConfig() (gitopsv1alpha1.GitOpsConfigList, error)
+	GetRecorder() record.EventRecorder
+	GetWebhookSecret(instance *gitopsv1alpha1.GitOpsConfig) (string, error)
+}
+
+// WebhookHandler manages the push events from GitHub, GitLab and Bitbucket, and the ones in the generic format. Calls to
+// /webhook/<namespace>/<name>, or /webhook/?gitopsconfig=<namespace>/<name>, are dispatched
+// only to the named GitOpsConfig, other calls to all the GitOpsConfig whose repository
+// matches the event. The GitOpsConfigs ignore
+// the pushes to other refs than the ones they deploy, the calls triggering none of them
+// for that reason being answered with a "no matching ref, skipped" body. The suspended
+// GitOpsConfigs ignore all the pushes, the calls triggering none of them for that reason
+// being answered with a "suspended, skipped" body. The GitOpsConfigs with a webhook secret
+// ignore the payloads not signed with it, which are answered with 401 when no GitOpsConfig
+// accepted them.
+func WebhookHandler(w http.ResponseWriter, r *http.Request, reconciler GitOpsConfigLister) {
 	log.Info("received webhook call")
 	if r.Method != "POST" {
 		w.WriteHeader(405)
 		return
 	}
+	// the runs triggered by the call belong to its trace
+	span := startWebhookSpan(r)
+	defer span.End()
+	target, scoped, ok := parseWebhookTarget(r)
+	if !ok {
+		log.Info("unknown webhook path", "path", r.URL.RequestURI())
+		w.WriteHeader(404)
+		return
+	}
+	// the call may wait for the runs it triggers to finish
+	waitTimeout, err := parseWebhookWait(r)
+	if err != nil {
+		log.Info("invalid webhook wait", "error", err.Error())
+		w.WriteHeader(400)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
 	//log.Info("webhook is of type post")
 	payload, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -45,16 +86,27 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request, reconciler gitopscon
 	}
 	defer r.Body.Close()
 	//log.Info("parsed body")
-	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	mapping, err := genericWebhookMapping(reconciler, target, scoped)
+	if err != nil {
+		log.Error(err, "unable to get the list of GitOpsConfig")
+		w.WriteHeader(500)
+		return
+	}
+	e, err := parsePushEvent(r.Header, payload, mapping)
 	if err != nil {
 		log.Error(err, "could not parse webhook")
+		if _, ok := err.(*genericPayloadError); ok {
+			w.WriteHeader(400)
+			fmt.Fprintln(w, err.Error())
+		}
 		return
 	}
 	//log.Info("parsed body, found event", "event", event)
-	switch e := event.(type) {
-	case *github.PushEvent:
+	switch {
+	case e != nil:
 		// this is a commit push, do something with it
 		{
+			span.AddAttributes(trace.StringAttribute("repo", e.Repo), trace.StringAttribute("ref", e.Ref))
 			//find the list of CR that have this url.
 			//log.Info("event is of type push")
 			list, err := reconciler.GetAllGitOpsConfig()
@@ -67,7 +119,7 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request, reconciler gitopscon
 			targetList := gitopsv1alpha1.GitOpsConfigList{
 				TypeMeta: list.TypeMeta,
 				ListMeta: list.ListMeta,
-				Items:    make([]gitopsv1alpha1.GitOpsConfig, len(list.Items)),
+				Items:    make([]gitopsv1alpha1.GitOpsConfig, 0, len(list.Items)),
 			}
 
 			for _, instance := range list.Items {
@@ -75,57 +127,345 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request, reconciler gitopscon
 				if !gitopsconfig.ContainsTrigger(&instance, "Webhook") {
 					continue
 				}
-				// if the repo URL do not correspond continue
-				if !repoURLMatch(&instance, e) {
+				if scoped {
+					// the path designates the instance, regardless of the repo URL
+					if instance.GetNamespace() != target.Namespace || instance.GetName() != target.Name {
+						continue
+					}
+				} else if !repoURLMatch(&instance, e) {
+					// if the repo URL do not correspond continue
 					continue
 				}
 				targetList.Items = append(targetList.Items, instance)
 			}
+			if scoped && len(targetList.Items) == 0 {
+				log.Info("no GitOpsConfig with a webhook trigger found for path", "path", r.URL.RequestURI())
+				w.WriteHeader(404)
+				return
+			}
 			//log.Info("event is applicable to the following instances", "instances", targetList)
 
+			changedPaths, complete := getChangedPaths(e)
+			accepted, rejected, unmatchedRef, suspended, triggered := 0, 0, 0, 0, 0
+			runs := []awaitedRun{}
+			defer func() {
+				for _, run := range runs {
+					run.unsubscribe()
+				}
+			}()
 			for _, instance := range targetList.Items {
 				//if secured discard those that do not validate
-				//log.Info("managing instance", "instances", instance)
-				secret := getWebhookSecret(&instance)
+				secret, err := reconciler.GetWebhookSecret(&instance)
+				if err != nil {
+					log.Error(err, "unable to get the webhook secret, ignoring this instance", "instance", instance.GetName())
+					gitopsconfig.RecordTrigger(&instance, "Webhook", true)
+					rejected++
+					continue
+				}
 				if secret != "" {
-					//log.Info("validating payload instance")
-					_, err := github.ValidatePayload(r, []byte(secret))
-					if err != nil {
-						log.Error(err, "webhook payload could not be validated with instanec secret, ignoring this instance")
+					if err := verifyPushEvent(e.Provider, payload, secret, r.Header); err != nil {
+						log.Error(err, "webhook payload could not be validated with instance secret, ignoring this instance", "instance", instance.GetName())
+						gitopsconfig.RecordTrigger(&instance, "Webhook", true)
+						rejected++
 						continue
 					}
 				}
-				//log.Info("payload validated")
+				accepted++
+				if !isWatchedRef(&instance, e) {
+					log.Info("push is not to the ref of the sources, ignoring this instance", "instance", instance.GetName(), "ref", e.Ref)
+					gitopsconfig.RecordTrigger(&instance, "Webhook", true)
+					unmatchedRef++
+					continue
+				}
+				if instance.Spec.Suspend {
+					log.Info("instance is suspended, ignoring this instance", "instance", instance.GetName())
+					reconciler.GetRecorder().Eventf(&instance, "Normal", "TriggerIgnored", "Push to %s ignored, the GitOpsConfig is suspended", e.Repo)
+					gitopsconfig.RecordTrigger(&instance, "Webhook", true)
+					suspended++
+					continue
+				}
+				// skip the instances whose templates and parameters are not affected by the change
+				if complete && !isAffectedByChange(&instance, e, changedPaths) {
+					log.Info("push does not change the context directories, ignoring this instance", "instance", instance.GetName())
+					reconciler.GetRecorder().Eventf(&instance, "Normal", "TriggerIgnored", "Push to %s does not change the template or parameter context directories", e.Repo)
+					gitopsconfig.RecordTrigger(&instance, "Webhook", true)
+					continue
+				}
+				if allowed := getAllowedAuthors(&instance); len(allowed) > 0 && !isAllowedAuthor(allowed, e) {
+					log.Info("push is not from an allowed author, ignoring this instance", "instance", instance.GetName(), "authors", getPushAuthors(e))
+					reconciler.GetRecorder().Eventf(&instance, "Normal", "TriggerIgnored", "Push to %s by %s is not from an allowed author", e.Repo, strings.Join(getPushAuthors(e), ", "))
+					gitopsconfig.RecordTrigger(&instance, "Webhook", true)
+					continue
+				}
+				if isBranchDeletion(e) && gitopsconfig.DependsOnBranch(&instance) && !prunesDeletedBranches(&instance) {
+					// the environment of the deleted branch must not be deployed again
+					log.Info("branch was deleted, ignoring this instance", "instance", instance.GetName(), "ref", e.Ref)
+					reconciler.GetRecorder().Eventf(&instance, "Normal", "TriggerIgnored", "Branch %s of %s was deleted", strings.TrimPrefix(e.Ref, "refs/heads/"), e.Repo)
+					gitopsconfig.RecordTrigger(&instance, "Webhook", true)
+					continue
+				}
 				//log.Info("creating job")
+				// the payload data can select the parameter file of the run
+				trigger := getTriggerContext(e)
+				if tracing.Enabled() {
+					trigger.TraceParent = tracing.FormatTraceParent(span.SpanContext())
+				}
+				instanceName := types.NamespacedName{Namespace: instance.GetNamespace(), Name: instance.GetName()}
+				if waitTimeout > 0 {
+					// subscribed before the run is triggered, so that its job starting isn't missed
+					events, unsubscribe, err := watchRunEvents(instance.GetNamespace(), instance.GetName())
+					if err != nil {
+						log.Error(err, "unable to watch the run, not waiting for it", "instance", instance.GetName())
+					} else {
+						runs = append(runs, awaitedRun{instance: instanceName, events: events, unsubscribe: unsubscribe})
+					}
+				}
+				gitopsconfig.SetTriggerContext(instanceName, trigger)
 				gitopsconfig.PushEvents <- k8sevent.GenericEvent{
 					Meta:   instance.GetObjectMeta(),
 					Object: instance.DeepCopyObject(),
 				}
+				gitopsconfig.RecordTrigger(&instance, "Webhook", false)
+				triggered++
 
 				// _, err := reconciler.CreateJob("create", &instance)
 				// if err != nil {
 				// 	log.Error(err, "unable to create job for instance", "instance", instance)
 				// }
 			}
+			if rejected > 0 && accepted == 0 {
+				w.WriteHeader(401)
+				return
+			}
+			if triggered == 0 && unmatchedRef > 0 {
+				// a success, so that the sender doesn't retry the push
+				w.WriteHeader(200)
+				fmt.Fprintln(w, "no matching ref, skipped")
+				return
+			}
+			if triggered == 0 && suspended > 0 {
+				w.WriteHeader(200)
+				fmt.Fprintln(w, "suspended, skipped")
+				return
+			}
+			if waitTimeout > 0 {
+				writeRunResults(w, r, runs, waitTimeout)
+				return
+			}
 		}
 	default:
 		{
-			log.Info("unknown event type", "type", github.WebHookType(r))
+			provider, eventType := webhookProvider(r.Header)
+			log.Info("unknown event type", "provider", provider, "type", eventType)
 			return
 		}
 	}
 	log.Info("webhook handling concluded correctly")
 }
 
-func repoURLMatch(instance *gitopsv1alpha1.GitOpsConfig, event *github.PushEvent) bool {
-	return strings.Contains(instance.Spec.TemplateSource.URI, *event.Repo.FullName) || strings.Contains(instance.Spec.ParameterSource.URI, *event.Repo.FullName)
+// webhookTargetParam is the query parameter of the /webhook/ path naming the targeted GitOpsConfig, as
+// <namespace>/<name>, for the senders that can't register a path per GitOpsConfig
+const webhookTargetParam = "gitopsconfig"
+
+// parseWebhookTarget returns the GitOpsConfig targeted by the path of r, or by its gitopsconfig query parameter.
+// scoped is false when r targets none, ok is false for unknown paths, malformed query parameters, or a query
+// parameter set on a /webhook/<namespace>/<name> path.
+func parseWebhookTarget(r *http.Request) (target types.NamespacedName, scoped bool, ok bool) {
+	target, scoped, ok = parseWebhookPath(r.URL.Path)
+	values, set := r.URL.Query()[webhookTargetParam]
+	if !ok || !set {
+		return target, scoped, ok
+	}
+	if scoped || len(values) != 1 {
+		return target, false, false
+	}
+	parts := strings.Split(values[0], "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return target, false, false
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, true, true
 }
 
-func getWebhookSecret(instance *gitopsv1alpha1.GitOpsConfig) string {
+// parseWebhookPath returns the GitOpsConfig targeted by a /webhook/<namespace>/<name> path.
+// scoped is false for the bare /webhook/ path, ok is false for any other path.
+func parseWebhookPath(path string) (target types.NamespacedName, scoped bool, ok bool) {
+	if !strings.HasPrefix(path, webhookPathPrefix) {
+		return target, false, false
+	}
+	rest := strings.Trim(strings.TrimPrefix(path, webhookPathPrefix), "/")
+	if rest == "" {
+		return target, false, true
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return target, false, false
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, true, true
+}
+
+// startWebhookSpan starts the span of a webhook call, in the trace of its traceparent header if it has one
+func startWebhookSpan(r *http.Request) *trace.Span {
+	if parent, ok := tracing.ParseTraceParent(r.Header.Get(tracing.TraceParentHeader)); ok {
+		_, span := trace.StartSpanWithRemoteParent(r.Context(), "webhook", parent, trace.WithSpanKind(trace.SpanKindServer))
+		return span
+	}
+	_, span := trace.StartSpan(r.Context(), "webhook", trace.WithSpanKind(trace.SpanKindServer))
+	return span
+}
+
+// getTriggerContext returns the data of the push event that can be used in the fileName of the parameter source
+// and the names of the jobs. The branch is empty for pushes of tags.
+func getTriggerContext(event *pushEvent) gitopsconfig.TriggerContext {
+	trigger := gitopsconfig.TriggerContext{Repo: event.Repo, Ref: event.Ref, Commit: event.After}
+	if strings.HasPrefix(event.Ref, "refs/heads/") {
+		trigger.Branch = strings.TrimPrefix(event.Ref, "refs/heads/")
+	}
+	if isBranchDeletion(event) {
+		// there is no pushed commit
+		trigger.Deleted = true
+		trigger.Commit = ""
+	}
+	return trigger
+}
+
+// isBranchDeletion returns true if the push event deleted a branch. The providers
+// sending GitHub payloads may only send the zero hash as the new head commit.
+func isBranchDeletion(event *pushEvent) bool {
+	if !strings.HasPrefix(event.Ref, "refs/heads/") {
+		return false
+	}
+	return event.Deleted || isZeroCommit(event.After)
+}
+
+// prunesDeletedBranches returns true if the resources applied for a branch must be deleted with the branch
+func prunesDeletedBranches(instance *gitopsv1alpha1.GitOpsConfig) bool {
 	for _, trigger := range instance.Spec.Triggers {
 		if trigger.Type == "Webhook" {
-			return trigger.Secret
+			return trigger.PruneDeletedBranches
+		}
+	}
+	return false
+}
+
+// getChangedPaths returns the paths changed by the commits of the push event.
+// complete is false when the event does not list all the changes, e.g. for
+// forced pushes, new branches or pushes of many commits.
+func getChangedPaths(event *pushEvent) (paths []string, complete bool) {
+	if event.Forced || event.Created || event.Deleted {
+		return nil, false
+	}
+	if len(event.Commits) == 0 || event.Truncated {
+		return nil, false
+	}
+	for _, commit := range event.Commits {
+		paths = append(paths, commit.Added...)
+		paths = append(paths, commit.Removed...)
+		paths = append(paths, commit.Modified...)
+	}
+	return paths, true
+}
+
+// isAffectedByChange returns true if one of the changed paths is within the template or
+// parameter context directories of the instance, for the sources in the pushed repository
+func isAffectedByChange(instance *gitopsv1alpha1.GitOpsConfig, event *pushEvent, changedPaths []string) bool {
+	repo := event.Repo
+	var dirs []string
+	if strings.Contains(instance.Spec.TemplateSource.URI, repo) {
+		if len(instance.Spec.TemplateSource.ContextDirs) > 0 {
+			dirs = append(dirs, instance.Spec.TemplateSource.ContextDirs...)
+		} else {
+			dirs = append(dirs, instance.Spec.TemplateSource.ContextDir)
+		}
+	}
+	if strings.Contains(instance.Spec.ParameterSource.URI, repo) {
+		dirs = append(dirs, instance.Spec.ParameterSource.ContextDir)
+	}
+	if len(dirs) == 0 {
+		// the instance was designated by the webhook path, the change can't be matched to its sources
+		return true
+	}
+	for _, dir := range dirs {
+		dir = strings.Trim(path.Clean("/"+dir), "/")
+		if dir == "" {
+			return true
+		}
+		for _, changed := range changedPaths {
+			if changed == dir || strings.HasPrefix(changed, dir+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func repoURLMatch(instance *gitopsv1alpha1.GitOpsConfig, event *pushEvent) bool {
+	return strings.Contains(instance.Spec.TemplateSource.URI, event.Repo) || strings.Contains(instance.Spec.ParameterSource.URI, event.Repo)
+}
+
+// isWatchedRef returns true if the pushed ref is the ref of a source of instance in the pushed repository, master by
+// default, or matches its pattern, e.g. release/*, or is a tag matching its semver range, or if the parameter file of
+// instance is selected by the pushed branch. An instance designated by the webhook path whose sources aren't in the
+// pushed repository watches every ref.
+func isWatchedRef(instance *gitopsv1alpha1.GitOpsConfig, event *pushEvent) bool {
+	if gitopsconfig.DependsOnBranch(instance) {
+		return true
+	}
+	parameter := instance.Spec.ParameterSource
+	if parameter.URI == "" {
+		parameter.URI = instance.Spec.TemplateSource.URI
+	}
+	var sources []gitopsv1alpha1.GitConfig
+	for _, source := range []gitopsv1alpha1.GitConfig{instance.Spec.TemplateSource, parameter} {
+		if source.URI == "" || !strings.Contains(source.URI, event.Repo) {
+			continue
+		}
+		if source.Ref == "" {
+			source.Ref = "master"
+		}
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return true
+	}
+	for _, source := range sources {
+		if gitopsconfig.MatchSourceRef(source, event.Ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAllowedAuthors returns the authors allowed to trigger instance by pushing, empty if everyone is
+func getAllowedAuthors(instance *gitopsv1alpha1.GitOpsConfig) []string {
+	for _, trigger := range instance.Spec.Triggers {
+		if trigger.Type == "Webhook" {
+			return trigger.AllowedAuthors
+		}
+	}
+	return nil
+}
+
+// getPushAuthors returns the identities of the author of the push: the login of the
+// sender and the name and email of the pusher. The authors and committers of the commits
+// are left out, anyone can set them.
+func getPushAuthors(event *pushEvent) []string {
+	authors := []string{}
+	for _, author := range []string{event.Sender, event.PusherName, event.PusherEmail} {
+		if author != "" {
+			authors = append(authors, author)
+		}
+	}
+	return authors
+}
+
+// isAllowedAuthor returns true if one of the identities of the author of the push is allowed, ignoring the case
+func isAllowedAuthor(allowed []string, event *pushEvent) bool {
+	for _, author := range getPushAuthors(event) {
+		for _, a := range allowed {
+			if strings.EqualFold(author, a) {
+				return true
+			}
 		}
 	}
-	return ""
+	return false
 }
@@ -0,0 +1,436 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/KohlsTechnology/eunomia/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const pushPayload = `{"ref": "refs/heads/master", "repository": {"full_name": "KohlsTechnology/eunomia"}}`
+
+type staticLister struct {
+	items    []gitopsv1alpha1.GitOpsConfig
+	recorder *record.FakeRecorder
+	// secrets are the webhook secrets of the items, by namespace/name
+	secrets map[string]string
+}
+
+func (l *staticLister) GetAllGitOpsConfig() (gitopsv1alpha1.GitOpsConfigList, error) {
+	return gitopsv1alpha1.GitOpsConfigList{Items: l.items}, nil
+}
+
+func (l *staticLister) GetRecorder() record.EventRecorder {
+	if l.recorder == nil {
+		l.recorder = record.NewFakeRecorder(10)
+	}
+	return l.recorder
+}
+
+func (l *staticLister) GetWebhookSecret(instance *gitopsv1alpha1.GitOpsConfig) (string, error) {
+	return l.secrets[instance.GetNamespace()+"/"+instance.GetName()], nil
+}
+
+func newGitOpsConfig(namespace, name, uri string) gitopsv1alpha1.GitOpsConfig {
+	return gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource: gitopsv1alpha1.GitConfig{URI: uri},
+			Triggers: []gitopsv1alpha1.GitOpsTrigger{
+				{
+					Type: "Webhook",
+				},
+			},
+		},
+	}
+}
+
+// sendPush posts a push event to path and returns the response and the names of the triggered configs
+func sendPush(t *testing.T, lister GitOpsConfigLister, path string) (*httptest.ResponseRecorder, []types.NamespacedName) {
+	return sendPayload(t, lister, path, pushPayload)
+}
+
+// sendPayload posts the push event payload to path and returns the response and the names of the triggered configs
+func sendPayload(t *testing.T, lister GitOpsConfigLister, path string, payload string) (*httptest.ResponseRecorder, []types.NamespacedName) {
+	return sendRequest(t, lister, newPushRequest(path, payload))
+}
+
+// newPushRequest returns a request posting the push event payload to path
+func newPushRequest(path string, payload string) *http.Request {
+	req := httptest.NewRequest("POST", path, strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// sendRequest sends req to the webhook handler and returns the response and the names of the triggered configs
+func sendRequest(t *testing.T, lister GitOpsConfigLister, req *http.Request) (*httptest.ResponseRecorder, []types.NamespacedName) {
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	var triggered []types.NamespacedName
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case e := <-gitopsconfig.PushEvents:
+				triggered = append(triggered, types.NamespacedName{Namespace: e.Meta.GetNamespace(), Name: e.Meta.GetName()})
+			case <-time.After(200 * time.Millisecond):
+				return
+			}
+		}
+	}()
+	WebhookHandler(w, req, lister)
+	<-done
+	return w, triggered
+}
+
+func TestWebhookPathScoped(t *testing.T) {
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{
+		newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia"),
+		newGitOpsConfig("team-b", "app", "https://github.com/KohlsTechnology/eunomia"),
+	}}
+
+	w, triggered := sendPush(t, lister, "/webhook/team-b/app")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []types.NamespacedName{{Namespace: "team-b", Name: "app"}}, triggered)
+}
+
+func TestWebhookQueryScoped(t *testing.T) {
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{
+		newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia"),
+		newGitOpsConfig("team-b", "app", "https://github.com/KohlsTechnology/eunomia"),
+	}}
+
+	w, triggered := sendPush(t, lister, "/webhook/?gitopsconfig=team-a/app")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []types.NamespacedName{{Namespace: "team-a", Name: "app"}}, triggered)
+
+	// the push to another ref than the one of the GitOpsConfig doesn't trigger it
+	w, triggered = sendPayload(t, lister, "/webhook/?gitopsconfig=team-a/app", `{"ref": "refs/heads/feature", "repository": {"full_name": "KohlsTechnology/eunomia"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no matching ref, skipped\n", w.Body.String())
+	assert.Empty(t, triggered)
+
+	for _, path := range []string{
+		"/webhook/?gitopsconfig=team-a/missing",
+		"/webhook/?gitopsconfig=team-a",
+		"/webhook/?gitopsconfig=",
+		"/webhook/?gitopsconfig=team-a/app&gitopsconfig=team-b/app",
+		// the path already names a GitOpsConfig
+		"/webhook/team-b/app?gitopsconfig=team-a/app",
+	} {
+		w, triggered := sendPush(t, lister, path)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.Empty(t, triggered, path)
+	}
+}
+
+func TestWebhookRepoMatch(t *testing.T) {
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{
+		newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia"),
+		newGitOpsConfig("team-b", "other", "https://github.com/KohlsTechnology/other"),
+	}}
+
+	w, triggered := sendPush(t, lister, "/webhook/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []types.NamespacedName{{Namespace: "team-a", Name: "app"}}, triggered)
+}
+
+func TestWebhookUnknownPath(t *testing.T) {
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{
+		newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia"),
+	}}
+
+	for _, path := range []string{"/webhook/team-a/missing", "/webhook/team-a", "/webhook/team-a/app/extra"} {
+		w, triggered := sendPush(t, lister, path)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.Empty(t, triggered, path)
+	}
+}
+
+func TestWebhookChangedPaths(t *testing.T) {
+	config := newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia")
+	config.Spec.TemplateSource.ContextDir = "apps/frontend"
+	config.Spec.ParameterSource = gitopsv1alpha1.GitConfig{URI: "https://github.com/KohlsTechnology/eunomia", ContextDir: "params/frontend"}
+
+	payload := func(files string) string {
+		return `{"ref": "refs/heads/master", "repository": {"full_name": "KohlsTechnology/eunomia"},
+			"commits": [{"id": "1", "added": [], "removed": [], "modified": [` + files + `]}]}`
+	}
+	tests := []struct {
+		name      string
+		payload   string
+		triggered bool
+	}{
+		{"change inside template context dir", payload(`"apps/frontend/deployment.yaml"`), true},
+		{"change inside parameter context dir", payload(`"params/frontend/values.yaml"`), true},
+		{"change outside context dirs", payload(`"apps/backend/deployment.yaml", "README.md"`), false},
+		{"change to a sibling with the same prefix", payload(`"apps/frontend-v2/deployment.yaml"`), false},
+		{"unknown changes", pushPayload, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{config}}
+			w, triggered := sendPayload(t, lister, "/webhook/", tt.payload)
+			assert.Equal(t, http.StatusOK, w.Code)
+			if tt.triggered {
+				assert.Len(t, triggered, 1)
+				assert.Empty(t, lister.GetRecorder().(*record.FakeRecorder).Events)
+			} else {
+				assert.Empty(t, triggered)
+				assert.Contains(t, <-lister.GetRecorder().(*record.FakeRecorder).Events, "Normal TriggerIgnored")
+			}
+		})
+	}
+}
+
+func TestWebhookAllowedAuthors(t *testing.T) {
+	config := newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia")
+	config.Spec.Triggers[0].AllowedAuthors = []string{"release-bot", "Jane.Doe@example.com"}
+
+	payload := func(sender, pusher, email string) string {
+		return `{"ref": "refs/heads/master", "repository": {"full_name": "KohlsTechnology/eunomia"},
+			"sender": {"login": "` + sender + `"}, "pusher": {"name": "` + pusher + `", "email": "` + email + `"},
+			"head_commit": {"id": "1", "author": {"name": "release-bot", "email": "jane.doe@example.com"}}}`
+	}
+	tests := []struct {
+		name      string
+		payload   string
+		triggered bool
+	}{
+		{"allowed sender", payload("release-bot", "release-bot", "bot@example.com"), true},
+		{"allowed pusher email with another case", payload("jdoe", "jdoe", "jane.doe@EXAMPLE.com"), true},
+		{"disallowed author of allowed commits", payload("mallory", "mallory", "mallory@example.com"), false},
+		{"unknown author", pushPayload, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{config}}
+			w, triggered := sendPayload(t, lister, "/webhook/", tt.payload)
+			assert.Equal(t, http.StatusOK, w.Code)
+			if tt.triggered {
+				assert.Len(t, triggered, 1)
+				assert.Empty(t, lister.GetRecorder().(*record.FakeRecorder).Events)
+			} else {
+				assert.Empty(t, triggered)
+				event := <-lister.GetRecorder().(*record.FakeRecorder).Events
+				assert.Contains(t, event, "Normal TriggerIgnored")
+				assert.Contains(t, event, "is not from an allowed author")
+			}
+		})
+	}
+}
+
+func TestWebhookBranchDeletion(t *testing.T) {
+	branchPattern := func(name string, prune bool) gitopsv1alpha1.GitOpsConfig {
+		config := newGitOpsConfig("team-a", name, "https://github.com/KohlsTechnology/eunomia")
+		config.Spec.ParameterSource.FileName = "params/{{ .Branch }}.yaml"
+		config.Spec.Triggers[0].PruneDeletedBranches = prune
+		return config
+	}
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{
+		branchPattern("pruned", true),
+		branchPattern("kept", false),
+		newGitOpsConfig("team-a", "single", "https://github.com/KohlsTechnology/eunomia"),
+	}}
+	payload := `{"ref": "refs/heads/feature-x", "before": "0123456789abcdef0123456789abcdef01234567", "after": "0000000000000000000000000000000000000000",
+		"deleted": true, "repository": {"full_name": "KohlsTechnology/eunomia"}}`
+
+	w, triggered := sendPayload(t, lister, "/webhook/", payload)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// the environment of the branch is torn down, or at least not deployed again, the single environment deploys master
+	assert.ElementsMatch(t, []types.NamespacedName{{Namespace: "team-a", Name: "pruned"}}, triggered)
+	event := <-lister.GetRecorder().(*record.FakeRecorder).Events
+	assert.Contains(t, event, "Normal TriggerIgnored")
+	assert.Contains(t, event, "Branch feature-x of KohlsTechnology/eunomia was deleted")
+}
+
+func TestIsBranchDeletion(t *testing.T) {
+	zero := "0000000000000000000000000000000000000000"
+	tests := []struct {
+		name    string
+		event   *pushEvent
+		deleted bool
+	}{
+		{"github", &pushEvent{Ref: "refs/heads/feature-x", After: zero, Deleted: true}, true},
+		{"zero after commit", &pushEvent{Ref: "refs/heads/feature-x", After: zero}, true},
+		{"push", &pushEvent{Ref: "refs/heads/feature-x", After: "0123456789abcdef0123456789abcdef01234567"}, false},
+		{"no after commit", &pushEvent{Ref: "refs/heads/feature-x"}, false},
+		{"deleted tag", &pushEvent{Ref: "refs/tags/v1.0.0", After: zero, Deleted: true}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.deleted, isBranchDeletion(tt.event), tt.name)
+	}
+	trigger := getTriggerContext(&pushEvent{Ref: "refs/heads/feature-x", After: zero, Deleted: true, Repo: "KohlsTechnology/eunomia"})
+	assert.Equal(t, gitopsconfig.TriggerContext{Branch: "feature-x", Ref: "refs/heads/feature-x", Repo: "KohlsTechnology/eunomia", Deleted: true}, trigger)
+}
+
+func TestIsAffectedByChangeRootContextDir(t *testing.T) {
+	for _, dir := range []string{"", ".", "/", "./"} {
+		config := newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia")
+		config.Spec.TemplateSource.ContextDir = dir
+		event := &pushEvent{Repo: "KohlsTechnology/eunomia"}
+		assert.True(t, isAffectedByChange(&config, event, []string{"anything.yaml"}), dir)
+	}
+}
+
+func TestIsAffectedByChangeContextDirs(t *testing.T) {
+	config := newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia")
+	config.Spec.TemplateSource.ContextDirs = []string{"apps/frontend", "apps/backend"}
+	config.Spec.ParameterSource = gitopsv1alpha1.GitConfig{URI: "https://github.com/KohlsTechnology/params", ContextDir: "."}
+	event := &pushEvent{Repo: "KohlsTechnology/eunomia"}
+	assert.True(t, isAffectedByChange(&config, event, []string{"apps/backend/deployment.yaml"}))
+	assert.False(t, isAffectedByChange(&config, event, []string{"apps/batch/cronjob.yaml", "README.md"}))
+}
+
+func TestGetTriggerContext(t *testing.T) {
+	tests := []struct {
+		ref    string
+		branch string
+	}{
+		{"refs/heads/master", "master"},
+		{"refs/heads/feature/params", "feature/params"},
+		{"refs/tags/v1.0.0", ""},
+	}
+	for _, tt := range tests {
+		trigger := getTriggerContext(&pushEvent{Ref: tt.ref, After: "0123456789abcdef", Repo: "KohlsTechnology/eunomia"})
+		assert.Equal(t, gitopsconfig.TriggerContext{Branch: tt.branch, Ref: tt.ref, Repo: "KohlsTechnology/eunomia", Commit: "0123456789abcdef"}, trigger, tt.ref)
+	}
+}
+
+// triggerCount returns the number of triggers of the named GitOpsConfig counted by eunomia_triggers_total
+func triggerCount(t *testing.T, namespace, name, triggerType, ignored string) float64 {
+	families, err := metrics.Registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "eunomia_triggers_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["namespace"] == namespace && labels["config"] == name && labels["type"] == triggerType && labels["ignored"] == ignored {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestWebhookTriggerMetrics(t *testing.T) {
+	config := newGitOpsConfig("metrics", "app", "https://github.com/KohlsTechnology/eunomia")
+	config.Spec.TemplateSource.ContextDir = "apps/frontend"
+	config.Spec.Triggers[0].AllowedAuthors = []string{"release-bot"}
+
+	payload := func(sender, file string) string {
+		return `{"ref": "refs/heads/master", "repository": {"full_name": "KohlsTechnology/eunomia"}, "sender": {"login": "` + sender + `"},
+			"commits": [{"id": "1", "added": [], "removed": [], "modified": ["` + file + `"]}]}`
+	}
+	tests := []struct {
+		name    string
+		payload string
+		ignored bool
+	}{
+		{"processed", payload("release-bot", "apps/frontend/deployment.yaml"), false},
+		{"change outside context dirs", payload("release-bot", "README.md"), true},
+		{"disallowed author", payload("mallory", "apps/frontend/deployment.yaml"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed := triggerCount(t, "metrics", "app", "Webhook", "false")
+			ignored := triggerCount(t, "metrics", "app", "Webhook", "true")
+			lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{config}}
+			_, triggered := sendPayload(t, lister, "/webhook/", tt.payload)
+			if tt.ignored {
+				assert.Empty(t, triggered)
+				assert.Equal(t, processed, triggerCount(t, "metrics", "app", "Webhook", "false"))
+				assert.Equal(t, ignored+1, triggerCount(t, "metrics", "app", "Webhook", "true"))
+			} else {
+				assert.Len(t, triggered, 1)
+				assert.Equal(t, processed+1, triggerCount(t, "metrics", "app", "Webhook", "false"))
+				assert.Equal(t, ignored, triggerCount(t, "metrics", "app", "Webhook", "true"))
+			}
+		})
+	}
+
+	// the configs that don't match the push aren't triggered at all
+	other := newGitOpsConfig("metrics", "other", "https://github.com/KohlsTechnology/other")
+	sendPayload(t, &staticLister{items: []gitopsv1alpha1.GitOpsConfig{other}}, "/webhook/", pushPayload)
+	assert.Zero(t, triggerCount(t, "metrics", "other", "Webhook", "false"))
+	assert.Zero(t, triggerCount(t, "metrics", "other", "Webhook", "true"))
+}
+
+// spanRecorder collects the exported spans
+type spanRecorder struct {
+	lock  sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(span *trace.SpanData) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func TestWebhookTrace(t *testing.T) {
+	recorder := &spanRecorder{}
+	tracing.Register(recorder)
+	defer tracing.Unregister(recorder)
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia")}}
+
+	// the call belongs to the trace of its traceparent header
+	parent := tracing.NewSpanContext(trace.SpanContext{})
+	req := newPushRequest("/webhook/", pushPayload)
+	req.Header.Set(tracing.TraceParentHeader, tracing.FormatTraceParent(parent))
+	_, triggered := sendRequest(t, lister, req)
+	assert.Len(t, triggered, 1)
+	// a call without one starts a new trace
+	sendPush(t, lister, "/webhook/")
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	if assert.Len(t, recorder.spans, 2) {
+		assert.Equal(t, "webhook", recorder.spans[0].Name)
+		assert.Equal(t, parent.TraceID, recorder.spans[0].TraceID)
+		assert.Equal(t, parent.SpanID, recorder.spans[0].ParentSpanID)
+		assert.True(t, recorder.spans[0].HasRemoteParent)
+		assert.Equal(t, "KohlsTechnology/eunomia", recorder.spans[0].Attributes["repo"])
+		assert.Equal(t, "webhook", recorder.spans[1].Name)
+		assert.NotEqual(t, parent.TraceID, recorder.spans[1].TraceID)
+		assert.Equal(t, trace.SpanID{}, recorder.spans[1].ParentSpanID)
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HealthzPath is the path of the liveness probe of the operator
+const HealthzPath string = "/healthz"
+
+// ReadyzPath is the path of the readiness probe of the operator
+const ReadyzPath string = "/readyz"
+
+// HealthzHandler answers the liveness probes, the operator being alive as long as it serves them
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// ReadyzHandler answers the readiness probes, the operator being ready once synced returns true, i.e. once the watch
+// on Jobs listed the existing Jobs, so that a rolled out operator doesn't miss the completion of the Jobs finishing
+// before its watch is running
+func ReadyzHandler(w http.ResponseWriter, r *http.Request, synced func() bool) {
+	if !synced() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "the watch on jobs is not synced")
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
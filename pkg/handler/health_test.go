@@ -0,0 +1,44 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	HealthzHandler(w, httptest.NewRequest("GET", HealthzPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReadyzHandler(t *testing.T) {
+	synced := false
+	w := httptest.NewRecorder()
+	ReadyzHandler(w, httptest.NewRequest("GET", ReadyzPath, nil), func() bool { return synced })
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "the watch on jobs is not synced\n", w.Body.String())
+
+	synced = true
+	w = httptest.NewRecorder()
+	ReadyzHandler(w, httptest.NewRequest("GET", ReadyzPath, nil), func() bool { return synced })
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/google/go-github/github"
+)
+
+// the git providers whose push events are understood
+const (
+	providerGitHub    string = "GitHub"
+	providerGitLab    string = "GitLab"
+	providerBitbucket string = "Bitbucket"
+	// providerGeneric sends the payloads in the generic webhook format, e.g. a CI system
+	providerGeneric string = "Generic"
+)
+
+// maxPushEventCommits is the number of commits after which GitHub truncates the commit list of a push event
+const maxPushEventCommits int = 20
+
+// pushEvent is a push to a git repository, normalized from the webhook payload of its provider
+type pushEvent struct {
+	// Provider is the git provider that sent the event
+	Provider string
+	// Repo is the full name of the pushed repository, e.g. KohlsTechnology/eunomia
+	Repo string
+	// RepoURL is the web URL of the pushed repository
+	RepoURL string
+	// Ref is the pushed ref, e.g. refs/heads/master
+	Ref string
+	// After is the pushed head commit, empty or the zero hash when Ref was deleted
+	After string
+	// Created, Deleted and Forced are true when the push created, deleted or force-pushed Ref
+	Created bool
+	Deleted bool
+	Forced  bool
+	// Commits are the pushed commits with the files they changed
+	Commits []pushCommit
+	// Truncated is true when Commits doesn't list all the pushed commits or their files
+	Truncated bool
+	// Sender is the login of the user who pushed
+	Sender string
+	// PusherName and PusherEmail identify the user who pushed, as set in git
+	PusherName  string
+	PusherEmail string
+}
+
+// pushCommit lists the files changed by a pushed commit
+type pushCommit struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// errUnknownProvider is returned for the requests that don't come from a known git provider
+var errUnknownProvider = errors.New("the webhook is not from GitHub, GitLab or Bitbucket, nor in the generic format")
+
+// webhookProvider returns the git provider that sent the webhook with header, and the type of its event
+func webhookProvider(header http.Header) (provider string, eventType string) {
+	switch {
+	case strings.EqualFold(header.Get(webhookFormatHeader), webhookFormatGeneric):
+		return providerGeneric, "push"
+	case header.Get("X-GitHub-Event") != "":
+		return providerGitHub, header.Get("X-GitHub-Event")
+	case header.Get("X-Gitlab-Event") != "":
+		return providerGitLab, header.Get("X-Gitlab-Event")
+	case header.Get("X-Event-Key") != "":
+		return providerBitbucket, header.Get("X-Event-Key")
+	}
+	return "", ""
+}
+
+// parsePushEvent returns the push event of payload, according to the provider detected from header. The event is nil
+// for the other events of the provider. The payloads without a provider header are in the generic format when mapping
+// is set.
+func parsePushEvent(header http.Header, payload []byte, mapping *gitopsv1alpha1.GenericWebhook) (*pushEvent, error) {
+	provider, eventType := webhookProvider(header)
+	if provider == "" && mapping != nil {
+		provider = providerGeneric
+	}
+	switch provider {
+	case providerGeneric:
+		return parseGenericPush(payload, mapping)
+	case providerGitHub:
+		if eventType != "push" {
+			return nil, nil
+		}
+		return parseGitHubPush(payload)
+	case providerGitLab:
+		if eventType != "Push Hook" && eventType != "Tag Push Hook" {
+			return nil, nil
+		}
+		return parseGitLabPush(payload)
+	case providerBitbucket:
+		if eventType != "repo:push" {
+			return nil, nil
+		}
+		return parseBitbucketPush(payload)
+	}
+	return nil, errUnknownProvider
+}
+
+// parseGitHubPush parses the payload of a GitHub push event
+func parseGitHubPush(payload []byte) (*pushEvent, error) {
+	event := &github.PushEvent{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	push := &pushEvent{
+		Provider:    providerGitHub,
+		Repo:        event.GetRepo().GetFullName(),
+		RepoURL:     event.GetRepo().GetHTMLURL(),
+		Ref:         event.GetRef(),
+		After:       event.GetAfter(),
+		Created:     event.GetCreated(),
+		Deleted:     event.GetDeleted(),
+		Forced:      event.GetForced(),
+		Truncated:   len(event.Commits) >= maxPushEventCommits,
+		Sender:      event.GetSender().GetLogin(),
+		PusherName:  event.GetPusher().GetName(),
+		PusherEmail: event.GetPusher().GetEmail(),
+	}
+	for _, commit := range event.Commits {
+		push.Commits = append(push.Commits, pushCommit{Added: commit.Added, Removed: commit.Removed, Modified: commit.Modified})
+	}
+	return push, nil
+}
+
+// gitLabPush is the payload of a GitLab push event
+type gitLabPush struct {
+	Ref          string `json:"ref"`
+	Before       string `json:"before"`
+	After        string `json:"after"`
+	UserUsername string `json:"user_username"`
+	UserName     string `json:"user_name"`
+	UserEmail    string `json:"user_email"`
+	Project      struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+	TotalCommitsCount int `json:"total_commits_count"`
+}
+
+// parseGitLabPush parses the payload of a GitLab push or tag push event. GitLab sends the zero hash as the previous
+// commit of a created ref and as the new commit of a deleted one.
+func parseGitLabPush(payload []byte) (*pushEvent, error) {
+	event := &gitLabPush{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	push := &pushEvent{
+		Provider:    providerGitLab,
+		Repo:        event.Project.PathWithNamespace,
+		RepoURL:     event.Project.WebURL,
+		Ref:         event.Ref,
+		After:       event.After,
+		Created:     isZeroCommit(event.Before),
+		Deleted:     isZeroCommit(event.After),
+		Truncated:   event.TotalCommitsCount > len(event.Commits),
+		Sender:      event.UserUsername,
+		PusherName:  event.UserName,
+		PusherEmail: event.UserEmail,
+	}
+	for _, commit := range event.Commits {
+		push.Commits = append(push.Commits, pushCommit{Added: commit.Added, Removed: commit.Removed, Modified: commit.Modified})
+	}
+	return push, nil
+}
+
+// bitbucketRef is the state of a branch or tag before or after a Bitbucket push
+type bitbucketRef struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Target struct {
+		Hash string `json:"hash"`
+	} `json:"target"`
+}
+
+// bitbucketPush is the payload of a Bitbucket Cloud push event
+type bitbucketPush struct {
+	Actor struct {
+		Nickname string `json:"nickname"`
+		Username string `json:"username"`
+	} `json:"actor"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		Links    struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	} `json:"repository"`
+	Push struct {
+		Changes []struct {
+			New    *bitbucketRef `json:"new"`
+			Old    *bitbucketRef `json:"old"`
+			Forced bool          `json:"forced"`
+		} `json:"changes"`
+	} `json:"push"`
+}
+
+// parseBitbucketPush parses the payload of a Bitbucket Cloud push event. Only its first change is considered, the
+// changed files of its commits are not listed.
+func parseBitbucketPush(payload []byte) (*pushEvent, error) {
+	event := &bitbucketPush{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	push := &pushEvent{
+		Provider:  providerBitbucket,
+		Repo:      event.Repository.FullName,
+		RepoURL:   event.Repository.Links.HTML.Href,
+		Truncated: true,
+		Sender:    event.Actor.Nickname,
+	}
+	if push.Sender == "" {
+		push.Sender = event.Actor.Username
+	}
+	if len(event.Push.Changes) == 0 {
+		return push, nil
+	}
+	change := event.Push.Changes[0]
+	ref := change.New
+	if ref == nil {
+		ref = change.Old
+	}
+	if ref != nil {
+		push.Ref = bitbucketRefName(ref)
+	}
+	if change.New != nil {
+		push.After = change.New.Target.Hash
+	}
+	push.Created = change.Old == nil
+	push.Deleted = change.New == nil
+	push.Forced = change.Forced
+	return push, nil
+}
+
+// bitbucketRefName returns the full name of a Bitbucket branch or tag, e.g. refs/heads/master
+func bitbucketRefName(ref *bitbucketRef) string {
+	if ref.Type == "tag" {
+		return "refs/tags/" + ref.Name
+	}
+	return "refs/heads/" + ref.Name
+}
+
+// isZeroCommit returns true if commit is the zero hash that denotes a missing commit
+func isZeroCommit(commit string) bool {
+	return commit != "" && strings.Trim(commit, "0") == ""
+}
@@ -0,0 +1,410 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// the sample push events of the documentation of the providers
+const (
+	gitHubPushPayload = `{
+  "ref": "refs/heads/master",
+  "before": "9049f1265b7d61be4a8904a9a27120d2064dab3b",
+  "after": "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+  "created": false,
+  "deleted": false,
+  "forced": false,
+  "commits": [
+    {
+      "id": "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+      "message": "Update README.md",
+      "author": {"name": "baxterthehacker", "email": "baxterthehacker@users.noreply.github.com", "username": "baxterthehacker"},
+      "added": [],
+      "removed": [],
+      "modified": ["README.md"]
+    }
+  ],
+  "repository": {
+    "id": 35129377,
+    "name": "public-repo",
+    "full_name": "baxterthehacker/public-repo",
+    "html_url": "https://github.com/baxterthehacker/public-repo"
+  },
+  "pusher": {"name": "baxterthehacker", "email": "baxterthehacker@users.noreply.github.com"},
+  "sender": {"login": "baxterthehacker", "id": 6752317}
+}`
+	gitLabPushPayload = `{
+  "object_kind": "push",
+  "event_name": "push",
+  "before": "95790bf891e76fee5e1747ab589903a6a1f80f22",
+  "after": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+  "ref": "refs/heads/master",
+  "checkout_sha": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+  "user_id": 4,
+  "user_name": "John Smith",
+  "user_username": "jsmith",
+  "user_email": "john@example.com",
+  "project_id": 15,
+  "project": {
+    "id": 15,
+    "name": "Diaspora",
+    "web_url": "http://example.com/mike/diaspora",
+    "git_ssh_url": "git@example.com:mike/diaspora.git",
+    "git_http_url": "http://example.com/mike/diaspora.git",
+    "namespace": "Mike",
+    "path_with_namespace": "mike/diaspora",
+    "default_branch": "master"
+  },
+  "commits": [
+    {
+      "id": "b6568db1bc1dcd7f8b4d5a946b0b91f9dacd7327",
+      "message": "Update Catalan translation to e38cb41.",
+      "author": {"name": "Jordi Mallach", "email": "jordi@softcatala.org"},
+      "added": ["CHANGELOG"],
+      "modified": ["app/controller/application.rb"],
+      "removed": []
+    },
+    {
+      "id": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+      "message": "fixed readme",
+      "author": {"name": "GitLab dev user", "email": "gitlabdev@dv6700.(none)"},
+      "added": ["CHANGELOG"],
+      "modified": ["app/controller/application.rb"],
+      "removed": []
+    }
+  ],
+  "total_commits_count": 4
+}`
+	gitLabTagPushPayload = `{
+  "object_kind": "tag_push",
+  "event_name": "tag_push",
+  "before": "0000000000000000000000000000000000000000",
+  "after": "82b3d5ae55f7080f1e6022629cdb57bfae7cccc7",
+  "ref": "refs/tags/v1.0.0",
+  "checkout_sha": "82b3d5ae55f7080f1e6022629cdb57bfae7cccc7",
+  "user_name": "John Smith",
+  "user_username": "jsmith",
+  "project": {
+    "web_url": "http://example.com/jsmith/example",
+    "path_with_namespace": "jsmith/example"
+  },
+  "commits": [],
+  "total_commits_count": 0
+}`
+	gitLabBranchDeletionPayload = `{
+  "object_kind": "push",
+  "before": "95790bf891e76fee5e1747ab589903a6a1f80f22",
+  "after": "0000000000000000000000000000000000000000",
+  "ref": "refs/heads/feature-x",
+  "checkout_sha": null,
+  "user_name": "John Smith",
+  "user_username": "jsmith",
+  "user_email": "john@example.com",
+  "project": {
+    "web_url": "http://example.com/mike/diaspora",
+    "path_with_namespace": "mike/diaspora"
+  },
+  "commits": [],
+  "total_commits_count": 0
+}`
+	bitbucketPushPayload = `{
+  "actor": {"display_name": "Emma", "nickname": "emma", "type": "user"},
+  "repository": {
+    "type": "repository",
+    "name": "eunomia",
+    "full_name": "team_name/repo_name",
+    "links": {"html": {"href": "https://bitbucket.org/team_name/repo_name"}}
+  },
+  "push": {
+    "changes": [
+      {
+        "new": {"type": "branch", "name": "master", "target": {"type": "commit", "hash": "709d658dc5b6d6afcd46049c2f332ee3f515a67d"}},
+        "old": {"type": "branch", "name": "master", "target": {"type": "commit", "hash": "1e65c05c1d5171631d92438a13901ca7dae9618c"}},
+        "created": false,
+        "forced": false,
+        "closed": false,
+        "truncated": false,
+        "commits": [{"hash": "709d658dc5b6d6afcd46049c2f332ee3f515a67d", "message": "Update the parameters"}]
+      }
+    ]
+  }
+}`
+	bitbucketBranchDeletionPayload = `{
+  "actor": {"display_name": "Emma", "nickname": "emma", "type": "user"},
+  "repository": {"full_name": "team_name/repo_name", "links": {"html": {"href": "https://bitbucket.org/team_name/repo_name"}}},
+  "push": {
+    "changes": [
+      {
+        "new": null,
+        "old": {"type": "branch", "name": "feature-x", "target": {"type": "commit", "hash": "1e65c05c1d5171631d92438a13901ca7dae9618c"}},
+        "created": false,
+        "forced": false,
+        "closed": true
+      }
+    ]
+  }
+}`
+)
+
+func TestParsePushEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		event   string
+		payload string
+		push    *pushEvent
+		err     bool
+	}{
+		{
+			name: "GitHub push", header: "X-GitHub-Event", event: "push", payload: gitHubPushPayload,
+			push: &pushEvent{
+				Provider:    providerGitHub,
+				Repo:        "baxterthehacker/public-repo",
+				RepoURL:     "https://github.com/baxterthehacker/public-repo",
+				Ref:         "refs/heads/master",
+				After:       "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+				Commits:     []pushCommit{{Added: []string{}, Removed: []string{}, Modified: []string{"README.md"}}},
+				Sender:      "baxterthehacker",
+				PusherName:  "baxterthehacker",
+				PusherEmail: "baxterthehacker@users.noreply.github.com",
+			},
+		},
+		{name: "GitHub other event", header: "X-GitHub-Event", event: "issues", payload: `{}`},
+		{
+			name: "GitLab push", header: "X-Gitlab-Event", event: "Push Hook", payload: gitLabPushPayload,
+			push: &pushEvent{
+				Provider: providerGitLab,
+				Repo:     "mike/diaspora",
+				RepoURL:  "http://example.com/mike/diaspora",
+				Ref:      "refs/heads/master",
+				After:    "da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+				Commits: []pushCommit{
+					{Added: []string{"CHANGELOG"}, Removed: []string{}, Modified: []string{"app/controller/application.rb"}},
+					{Added: []string{"CHANGELOG"}, Removed: []string{}, Modified: []string{"app/controller/application.rb"}},
+				},
+				// 4 commits were pushed, only 2 are listed
+				Truncated:   true,
+				Sender:      "jsmith",
+				PusherName:  "John Smith",
+				PusherEmail: "john@example.com",
+			},
+		},
+		{
+			name: "GitLab tag push", header: "X-Gitlab-Event", event: "Tag Push Hook", payload: gitLabTagPushPayload,
+			push: &pushEvent{
+				Provider:   providerGitLab,
+				Repo:       "jsmith/example",
+				RepoURL:    "http://example.com/jsmith/example",
+				Ref:        "refs/tags/v1.0.0",
+				After:      "82b3d5ae55f7080f1e6022629cdb57bfae7cccc7",
+				Created:    true,
+				Sender:     "jsmith",
+				PusherName: "John Smith",
+			},
+		},
+		{
+			name: "GitLab branch deletion", header: "X-Gitlab-Event", event: "Push Hook", payload: gitLabBranchDeletionPayload,
+			push: &pushEvent{
+				Provider:    providerGitLab,
+				Repo:        "mike/diaspora",
+				RepoURL:     "http://example.com/mike/diaspora",
+				Ref:         "refs/heads/feature-x",
+				After:       "0000000000000000000000000000000000000000",
+				Deleted:     true,
+				Sender:      "jsmith",
+				PusherName:  "John Smith",
+				PusherEmail: "john@example.com",
+			},
+		},
+		{name: "GitLab other event", header: "X-Gitlab-Event", event: "Merge Request Hook", payload: `{}`},
+		{
+			name: "Bitbucket push", header: "X-Event-Key", event: "repo:push", payload: bitbucketPushPayload,
+			push: &pushEvent{
+				Provider:  providerBitbucket,
+				Repo:      "team_name/repo_name",
+				RepoURL:   "https://bitbucket.org/team_name/repo_name",
+				Ref:       "refs/heads/master",
+				After:     "709d658dc5b6d6afcd46049c2f332ee3f515a67d",
+				Truncated: true,
+				Sender:    "emma",
+			},
+		},
+		{
+			name: "Bitbucket branch deletion", header: "X-Event-Key", event: "repo:push", payload: bitbucketBranchDeletionPayload,
+			push: &pushEvent{
+				Provider:  providerBitbucket,
+				Repo:      "team_name/repo_name",
+				RepoURL:   "https://bitbucket.org/team_name/repo_name",
+				Ref:       "refs/heads/feature-x",
+				Deleted:   true,
+				Truncated: true,
+				Sender:    "emma",
+			},
+		},
+		{name: "Bitbucket other event", header: "X-Event-Key", event: "pullrequest:created", payload: `{}`},
+		{name: "unknown provider", header: "X-Gitea-Event", event: "push", payload: gitHubPushPayload, err: true},
+		{name: "invalid payload", header: "X-Gitlab-Event", event: "Push Hook", payload: `{"ref": 1}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(tt.header, tt.event)
+			push, err := parsePushEvent(header, []byte(tt.payload), nil)
+			assert.Equal(t, tt.err, err != nil, "%v", err)
+			assert.Equal(t, tt.push, push)
+		})
+	}
+}
+
+func TestWebhookProviders(t *testing.T) {
+	gitLabConfig := newGitOpsConfig("team-a", "diaspora", "git@example.com:mike/diaspora.git")
+	gitLabConfig.Spec.TemplateSource.Ref = "master"
+	bitbucketConfig := newGitOpsConfig("team-b", "repo", "https://bitbucket.org/team_name/repo_name.git")
+	bitbucketConfig.Spec.TemplateSource.Ref = "master"
+	releaseConfig := newGitOpsConfig("team-c", "example", "https://example.com/jsmith/example.git")
+	releaseConfig.Spec.TemplateSource.Ref = "v1.0.0"
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{gitLabConfig, bitbucketConfig, releaseConfig}}
+	tests := []struct {
+		name      string
+		header    string
+		event     string
+		payload   string
+		triggered []types.NamespacedName
+	}{
+		{"GitLab push", "X-Gitlab-Event", "Push Hook", gitLabPushPayload, []types.NamespacedName{{Namespace: "team-a", Name: "diaspora"}}},
+		{"GitLab push to another branch", "X-Gitlab-Event", "Push Hook", gitLabBranchDeletionPayload, nil},
+		{"GitLab tag push", "X-Gitlab-Event", "Tag Push Hook", gitLabTagPushPayload, []types.NamespacedName{{Namespace: "team-c", Name: "example"}}},
+		{"Bitbucket push", "X-Event-Key", "repo:push", bitbucketPushPayload, []types.NamespacedName{{Namespace: "team-b", Name: "repo"}}},
+		{"Bitbucket push to another branch", "X-Event-Key", "repo:push", bitbucketBranchDeletionPayload, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newPushRequest("/webhook/", tt.payload)
+			req.Header.Del("X-GitHub-Event")
+			req.Header.Set(tt.header, tt.event)
+			w, triggered := sendRequest(t, lister, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.triggered, triggered)
+		})
+	}
+}
+
+func TestWebhookGitLabToken(t *testing.T) {
+	config := newGitOpsConfig("team-a", "diaspora", "git@example.com:mike/diaspora.git")
+	lister := &staticLister{
+		items:   []gitopsv1alpha1.GitOpsConfig{config},
+		secrets: map[string]string{"team-a/diaspora": "s3cr3t"},
+	}
+	for token, code := range map[string]int{"s3cr3t": http.StatusOK, "wrong": http.StatusUnauthorized, "": http.StatusUnauthorized} {
+		req := newPushRequest("/webhook/team-a/diaspora", gitLabPushPayload)
+		req.Header.Del("X-GitHub-Event")
+		req.Header.Set("X-Gitlab-Event", "Push Hook")
+		if token != "" {
+			req.Header.Set(gitLabTokenHeader, token)
+		}
+		w, triggered := sendRequest(t, lister, req)
+		assert.Equal(t, code, w.Code, token)
+		assert.Equal(t, code == http.StatusOK, len(triggered) == 1, token)
+	}
+}
+
+func TestIsWatchedRef(t *testing.T) {
+	config := func(uri, ref, parameterURI, parameterRef string) *gitopsv1alpha1.GitOpsConfig {
+		instance := newGitOpsConfig("team-a", "app", uri)
+		instance.Spec.TemplateSource.Ref = ref
+		instance.Spec.ParameterSource = gitopsv1alpha1.GitConfig{URI: parameterURI, Ref: parameterRef}
+		return &instance
+	}
+	branchPattern := config("https://github.com/org/templates", "master", "", "")
+	branchPattern.Spec.ParameterSource.FileName = "params/{{ .Branch }}.yaml"
+	semVer := config("https://github.com/org/templates", ">=1.4.0 <2.0.0", "", "")
+	semVer.Spec.TemplateSource.RefType = "SemVer"
+	branch := config("https://github.com/org/templates", "v1.0.0", "", "")
+	branch.Spec.TemplateSource.RefType = "Branch"
+	tests := []struct {
+		name     string
+		instance *gitopsv1alpha1.GitOpsConfig
+		ref      string
+		watched  bool
+	}{
+		{"template branch", config("https://github.com/org/templates", "main", "", ""), "refs/heads/main", true},
+		{"other branch", config("https://github.com/org/templates", "main", "", ""), "refs/heads/feature-x", false},
+		{"default master", config("https://github.com/org/templates", "", "", ""), "refs/heads/master", true},
+		{"tag", config("https://github.com/org/templates", "v1.0.0", "", ""), "refs/tags/v1.0.0", true},
+		{"parameter branch of the same repository", config("https://github.com/org/templates", "main", "", "release"), "refs/heads/release", true},
+		{"parameter branch of another repository", config("https://github.com/org/templates", "main", "https://github.com/org/params", "release"), "refs/heads/release", false},
+		{"branch pattern", branchPattern, "refs/heads/feature-x", true},
+		{"wildcard branch", config("https://github.com/org/templates", "release/*", "", ""), "refs/heads/release/1.2", true},
+		{"wildcard other branch", config("https://github.com/org/templates", "release/*", "", ""), "refs/heads/feature/1.2", false},
+		{"wildcard below the branch", config("https://github.com/org/templates", "release/*", "", ""), "refs/heads/release/1.2/hotfix", false},
+		{"wildcard tag", config("https://github.com/org/templates", "v1.*", "", ""), "refs/tags/v1.4.0", true},
+		{"semver matching tag", semVer, "refs/tags/v1.5.0", true},
+		{"semver other tag", semVer, "refs/tags/v2.0.0", false},
+		{"semver branch", semVer, "refs/heads/v1.5.0", false},
+		{"branch ref type", branch, "refs/tags/v1.0.0", false},
+		{"sources in other repositories", config("https://github.com/org/other", "main", "", ""), "refs/heads/feature-x", true},
+	}
+	for _, tt := range tests {
+		event := &pushEvent{Repo: "org/templates", Ref: tt.ref}
+		assert.Equal(t, tt.watched, isWatchedRef(tt.instance, event), tt.name)
+	}
+}
+
+func TestWebhookRefPattern(t *testing.T) {
+	config := func(name, ref string) gitopsv1alpha1.GitOpsConfig {
+		instance := newGitOpsConfig("team-a", name, "https://github.com/KohlsTechnology/eunomia.git")
+		instance.Spec.TemplateSource.Ref = ref
+		return instance
+	}
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{config("production", "master"), config("releases", "release/*")}}
+
+	w, triggered := sendPayload(t, lister, "/webhook/", `{"ref": "refs/heads/release/1.2", "after": "0123456789abcdef0123456789abcdef01234567",
+		"repository": {"full_name": "KohlsTechnology/eunomia"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, []types.NamespacedName{{Namespace: "team-a", Name: "releases"}}, triggered)
+
+	// the sender must not retry the pushes to refs that no GitOpsConfig deploys
+	w, triggered = sendPayload(t, lister, "/webhook/", `{"ref": "refs/heads/feature-x", "repository": {"full_name": "KohlsTechnology/eunomia"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no matching ref, skipped\n", w.Body.String())
+	assert.Empty(t, triggered)
+}
+
+func TestWebhookSuspended(t *testing.T) {
+	suspended := newGitOpsConfig("team-a", "production", "https://github.com/KohlsTechnology/eunomia.git")
+	suspended.Spec.Suspend = true
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{suspended}}
+
+	w, triggered := sendPayload(t, lister, "/webhook/", `{"ref": "refs/heads/master", "repository": {"full_name": "KohlsTechnology/eunomia"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "suspended, skipped\n", w.Body.String())
+	assert.Empty(t, triggered)
+
+	// the other GitOpsConfigs of the repository are still triggered
+	lister.items = append(lister.items, newGitOpsConfig("team-a", "staging", "https://github.com/KohlsTechnology/eunomia.git"))
+	w, triggered = sendPayload(t, lister, "/webhook/", `{"ref": "refs/heads/master", "repository": {"full_name": "KohlsTechnology/eunomia"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, []types.NamespacedName{{Namespace: "team-a", Name: "staging"}}, triggered)
+}
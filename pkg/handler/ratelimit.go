@@ -0,0 +1,172 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// webhookBucketSweepInterval is how often the buckets of the senders that stopped calling are forgotten
+const webhookBucketSweepInterval = time.Minute
+
+// WebhookLimiter protects the webhook handler from the bursts of misconfigured senders, each of them starting jobs. It
+// keeps a token bucket per sender, the GitOpsConfig targeted by the call or the IP address of the caller otherwise,
+// answering the calls finding their bucket empty with 429 and a Retry-After header. The payloads larger than its
+// maximum size are answered with 413.
+type WebhookLimiter struct {
+	// perSecond is the rate the buckets are refilled at, zero disables the rate limit
+	perSecond float64
+	burst     float64
+	// maxPayloadSize is the largest payload accepted in bytes, zero accepts them all
+	maxPayloadSize int64
+	clock          clock.Clock
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket holds the tokens left to a sender, when they were last counted
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewWebhookLimiter returns a WebhookLimiter allowing each sender perMinute calls, with bursts of up to burst calls,
+// and rejecting the payloads larger than maxPayloadSize bytes. Zero disables either limit.
+func NewWebhookLimiter(perMinute float64, burst int, maxPayloadSize int64) *WebhookLimiter {
+	return newWebhookLimiter(perMinute, burst, maxPayloadSize, clock.RealClock{})
+}
+
+func newWebhookLimiter(perMinute float64, burst int, maxPayloadSize int64, clock clock.Clock) *WebhookLimiter {
+	limiter := &WebhookLimiter{
+		maxPayloadSize: maxPayloadSize,
+		clock:          clock,
+		buckets:        map[string]*tokenBucket{},
+		lastSweep:      clock.Now(),
+	}
+	if perMinute > 0 && burst > 0 {
+		limiter.perSecond = perMinute / 60
+		limiter.burst = float64(burst)
+	}
+	return limiter
+}
+
+// Limit returns handler with the calls above the rate of their sender, and the payloads above the maximum size,
+// rejected before they reach it
+func (l *WebhookLimiter) Limit(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sender := webhookSender(r)
+		if ok, retryAfter := l.allow(sender); !ok {
+			log.Info("webhook call throttled", "sender", sender, "retryAfter", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintln(w, "rate limit exceeded")
+			return
+		}
+		if l.maxPayloadSize > 0 && r.Body != nil {
+			// the declared length is checked first, the length of a chunked payload once it is read
+			if r.ContentLength > l.maxPayloadSize {
+				l.rejectPayload(w, sender, r.ContentLength)
+				return
+			}
+			payload, err := ioutil.ReadAll(io.LimitReader(r.Body, l.maxPayloadSize+1))
+			r.Body.Close()
+			if err != nil {
+				log.Error(err, "error reading request body")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if int64(len(payload)) > l.maxPayloadSize {
+				l.rejectPayload(w, sender, -1)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(payload))
+		}
+		handler(w, r)
+	}
+}
+
+// rejectPayload answers a call whose payload is larger than the maximum size, of size bytes or -1 if it isn't known
+func (l *WebhookLimiter) rejectPayload(w http.ResponseWriter, sender string, size int64) {
+	log.Info("webhook payload too large", "sender", sender, "size", size, "maxPayloadSize", l.maxPayloadSize)
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	fmt.Fprintf(w, "payload larger than %d bytes\n", l.maxPayloadSize)
+}
+
+// allow takes a token from the bucket of sender. When it is empty, it returns false and how long until a token is
+// available.
+func (l *WebhookLimiter) allow(sender string) (bool, time.Duration) {
+	if l.perSecond == 0 {
+		return true, 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.clock.Now()
+	l.sweep(now)
+	bucket, ok := l.buckets[sender]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[sender] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.perSecond)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.perSecond * float64(time.Second))
+}
+
+// sweep forgets the buckets refilled since they were last used, they are created full again, at most every
+// webhookBucketSweepInterval
+func (l *WebhookLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < webhookBucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for sender, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.perSecond >= l.burst {
+			delete(l.buckets, sender)
+		}
+	}
+}
+
+// webhookSender returns the key of the bucket of a call: the GitOpsConfig it targets with its path or gitopsconfig
+// query parameter, so that the senders of a GitOpsConfig don't throttle the other ones behind a shared gateway, or the
+// IP address of the caller
+func webhookSender(r *http.Request) string {
+	if target, scoped, ok := parseWebhookTarget(r); ok && scoped {
+		return target.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
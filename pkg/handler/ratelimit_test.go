@@ -0,0 +1,110 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// countingHandler returns a handler answering 200 with the payload it received, and the number of calls it received
+func countingHandler() (http.HandlerFunc, *int) {
+	calls := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		payload, _ := ioutil.ReadAll(r.Body)
+		w.Write(payload)
+	}, &calls
+}
+
+// callWebhook calls handler on path from remoteAddr with payload
+func callWebhook(handler http.HandlerFunc, path, remoteAddr, payload string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", path, strings.NewReader(payload))
+	r.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestWebhookLimiterRate(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	// a call every 10 seconds, bursts of 2
+	limiter := newWebhookLimiter(6, 2, 0, fakeClock)
+	next, calls := countingHandler()
+	handler := limiter.Limit(next)
+
+	assert.Equal(t, 200, callWebhook(handler, "/webhook/", "10.0.0.1:40000", "{}").Code)
+	assert.Equal(t, 200, callWebhook(handler, "/webhook/", "10.0.0.1:40001", "{}").Code)
+	w := callWebhook(handler, "/webhook/", "10.0.0.1:40002", "{}")
+	assert.Equal(t, 429, w.Code, "the burst of the sender is spent, whatever its port")
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	assert.Equal(t, 2, *calls)
+
+	// the other senders have their own bucket
+	assert.Equal(t, 200, callWebhook(handler, "/webhook/", "10.0.0.2:40000", "{}").Code)
+	assert.Equal(t, 200, callWebhook(handler, "/webhook/gitops/hello-world", "10.0.0.1:40003", "{}").Code)
+	assert.Equal(t, 200, callWebhook(handler, "/webhook/?gitopsconfig=gitops/other", "10.0.0.1:40006", "{}").Code)
+
+	fakeClock.Step(4 * time.Second)
+	w = callWebhook(handler, "/webhook/", "10.0.0.1:40004", "{}")
+	assert.Equal(t, 429, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Retry-After"))
+	fakeClock.Step(6 * time.Second)
+	assert.Equal(t, 200, callWebhook(handler, "/webhook/", "10.0.0.1:40005", "{}").Code, "a token was refilled")
+	assert.Equal(t, 6, *calls)
+
+	// the buckets refilled since their last call are forgotten
+	fakeClock.Step(time.Minute)
+	limiter.allow("10.0.0.3")
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestWebhookLimiterDisabled(t *testing.T) {
+	limiter := newWebhookLimiter(0, 20, 0, clock.NewFakeClock(time.Now()))
+	next, calls := countingHandler()
+	handler := limiter.Limit(next)
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, 200, callWebhook(handler, "/webhook/", "10.0.0.1:40000", "{}").Code)
+	}
+	assert.Equal(t, 50, *calls)
+}
+
+func TestWebhookLimiterPayloadSize(t *testing.T) {
+	limiter := newWebhookLimiter(0, 0, 10, clock.NewFakeClock(time.Now()))
+	next, calls := countingHandler()
+	handler := limiter.Limit(next)
+
+	w := callWebhook(handler, "/webhook/", "10.0.0.1:40000", `{"a":"b"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `{"a":"b"}`, w.Body.String(), "the payload reaches the handler")
+	assert.Equal(t, 413, callWebhook(handler, "/webhook/", "10.0.0.1:40000", `{"a":"bcdef"}`).Code)
+
+	// a chunked payload doesn't declare its length
+	r := httptest.NewRequest("POST", "/webhook/", ioutil.NopCloser(strings.NewReader(`{"a":"bcdef"}`)))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	handler(w, r)
+	assert.Equal(t, 413, w.Code)
+	assert.Equal(t, 1, *calls)
+}
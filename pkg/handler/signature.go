@@ -0,0 +1,95 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+const (
+	// signatureHeader is the HMAC-SHA256 signature of the payload sent by GitHub
+	signatureHeader string = "X-Hub-Signature-256"
+	// legacySignatureHeader is the HMAC-SHA1 signature of the payload, sent alone by older installs
+	legacySignatureHeader string = "X-Hub-Signature"
+	// gitLabTokenHeader is the secret token of the GitLab webhooks, GitLab doesn't sign the payloads
+	gitLabTokenHeader string = "X-Gitlab-Token"
+)
+
+var (
+	errMissingSignature = errors.New("the payload is not signed")
+	errInvalidSignature = errors.New("the signature of the payload is invalid")
+)
+
+// verifyPushEvent checks that the payload sent by provider, with header, was sent with secret: GitLab sends the secret
+// itself, GitHub, Bitbucket and the generic senders sign the payload with it
+func verifyPushEvent(provider string, payload []byte, secret string, header http.Header) error {
+	if provider == providerGitLab {
+		return verifyToken(secret, header)
+	}
+	return verifySignature(payload, secret, header)
+}
+
+// verifyToken checks the GitLab token in header against secret, in constant time
+func verifyToken(secret string, header http.Header) error {
+	token := header.Get(gitLabTokenHeader)
+	if token == "" {
+		return errMissingSignature
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// verifySignature checks the signature of payload, in header, against the HMAC of payload computed with secret. The
+// X-Hub-Signature-256 header is preferred, X-Hub-Signature is only checked when it is missing. The digests are
+// compared in constant time.
+func verifySignature(payload []byte, secret string, header http.Header) error {
+	var prefix string
+	var newHash func() hash.Hash
+	signature := header.Get(signatureHeader)
+	if signature != "" {
+		prefix, newHash = "sha256=", sha256.New
+	} else {
+		signature = header.Get(legacySignatureHeader)
+		prefix, newHash = "sha1=", sha1.New
+	}
+	if signature == "" {
+		return errMissingSignature
+	}
+	if !strings.HasPrefix(signature, prefix) {
+		return errInvalidSignature
+	}
+	received, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return errInvalidSignature
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(received, mac.Sum(nil)) {
+		return errInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestVerifySignature(t *testing.T) {
+	// the example of the GitHub documentation
+	payload := []byte("Hello, World!")
+	secret := "It's a Secret to Everybody"
+	sha256Signature := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	sha1Signature := "sha1=01dc10d0c83e72ed246219cdd91669667fe2ca59"
+	tests := []struct {
+		name    string
+		headers map[string]string
+		err     error
+	}{
+		{"sha256", map[string]string{signatureHeader: sha256Signature}, nil},
+		{"sha1 fallback", map[string]string{legacySignatureHeader: sha1Signature}, nil},
+		{"sha256 preferred", map[string]string{signatureHeader: sha256Signature, legacySignatureHeader: "sha1=00"}, nil},
+		{"invalid sha256 with a valid sha1", map[string]string{signatureHeader: "sha256=00", legacySignatureHeader: sha1Signature}, errInvalidSignature},
+		{"wrong digest", map[string]string{signatureHeader: "sha256=857107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"}, errInvalidSignature},
+		{"wrong algorithm", map[string]string{signatureHeader: "sha1=01dc10d0c83e72ed246219cdd91669667fe2ca59"}, errInvalidSignature},
+		{"not hexadecimal", map[string]string{signatureHeader: "sha256=not-hex"}, errInvalidSignature},
+		{"missing", map[string]string{}, errMissingSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+			assert.Equal(t, tt.err, verifySignature(payload, secret, header))
+		})
+	}
+	header := http.Header{}
+	header.Set(signatureHeader, sha256Signature)
+	assert.Equal(t, errInvalidSignature, verifySignature(payload, "another secret", header))
+	assert.Equal(t, errInvalidSignature, verifySignature([]byte("Hello, World?"), secret, header))
+}
+
+func TestWebhookSignature(t *testing.T) {
+	// the signatures of pushPayload with the s3cr3t secret
+	sha256Signature := "sha256=b106fb8febdcb06b6d58a324e886a16a017f3987d29e4a42a457e1fdf8f04d04"
+	sha1Signature := "sha1=5934d10c0d053cb1512f8e7fbaa107bc296c6c43"
+	secured := newGitOpsConfig("team-a", "secured", "https://github.com/KohlsTechnology/eunomia")
+	open := newGitOpsConfig("team-b", "open", "https://github.com/KohlsTechnology/eunomia")
+	lister := &staticLister{
+		items:   []gitopsv1alpha1.GitOpsConfig{secured, open},
+		secrets: map[string]string{"team-a/secured": "s3cr3t"},
+	}
+	tests := []struct {
+		name      string
+		path      string
+		headers   map[string]string
+		code      int
+		triggered []types.NamespacedName
+	}{
+		{"sha256", "/webhook/team-a/secured", map[string]string{signatureHeader: sha256Signature}, http.StatusOK,
+			[]types.NamespacedName{{Namespace: "team-a", Name: "secured"}}},
+		{"sha1", "/webhook/team-a/secured", map[string]string{legacySignatureHeader: sha1Signature}, http.StatusOK,
+			[]types.NamespacedName{{Namespace: "team-a", Name: "secured"}}},
+		{"wrong signature", "/webhook/team-a/secured", map[string]string{signatureHeader: "sha256=00"}, http.StatusUnauthorized, nil},
+		{"unsigned", "/webhook/team-a/secured", nil, http.StatusUnauthorized, nil},
+		{"unsigned to all", "/webhook/", nil, http.StatusOK,
+			[]types.NamespacedName{{Namespace: "team-b", Name: "open"}}},
+		{"signed to all", "/webhook/", map[string]string{signatureHeader: sha256Signature}, http.StatusOK,
+			[]types.NamespacedName{{Namespace: "team-a", Name: "secured"}, {Namespace: "team-b", Name: "open"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newPushRequest(tt.path, pushPayload)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w, triggered := sendRequest(t, lister, req)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.triggered, triggered)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+)
+
+// SyncEventsPath is the path streaming the sync events of the GitOpsConfigs
+const SyncEventsPath string = "/syncevents"
+
+// syncEventsKeepAlive is how often a comment is sent on the idle streams, so that the proxies don't close them
+var syncEventsKeepAlive = 30 * time.Second
+
+// SyncEventSubscriber subscribes to the sync events of the GitOpsConfig name of namespace, an empty namespace or name
+// matching them all, see gitopsconfig.SubscribeSyncEvents
+type SyncEventSubscriber func(namespace, name string) (<-chan gitopsconfig.SyncEvent, func(), error)
+
+// SyncEventsHandler streams the sync events of the GitOpsConfigs as server-sent events, named after their reason and
+// holding their JSON, until the client disconnects. The namespace and name query parameters filter the GitOpsConfigs.
+// The clients above the most subscribers allowed are answered with 503.
+func SyncEventsHandler(w http.ResponseWriter, r *http.Request, subscribe SyncEventSubscriber) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	events, unsubscribe, err := subscribe(query.Get("namespace"), query.Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribe()
+	log.Info("Streaming the sync events", "remote", r.RemoteAddr, "namespace", query.Get("namespace"), "name", query.Get("name"))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(syncEventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Info("Sync events client disconnected", "remote", r.RemoteAddr)
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Error(err, "unable to encode the sync event", "job", event.Job)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Reason, data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncEventsHandler(t *testing.T) {
+	events := make(chan gitopsconfig.SyncEvent, 1)
+	unsubscribed := make(chan bool)
+	filters := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SyncEventsHandler(w, r, func(namespace, name string) (<-chan gitopsconfig.SyncEvent, func(), error) {
+			filters <- namespace + "/" + name
+			return events, func() { close(unsubscribed) }, nil
+		})
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + SyncEventsPath + "?namespace=gitops&name=app")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "gitops/app", <-filters)
+
+	// the events are streamed as they are published
+	events <- gitopsconfig.SyncEvent{Namespace: "gitops", Name: "app", Job: "gitopsconfig-app-abcde", Type: "Warning", Reason: "JobFailed", Message: "Job failed"}
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: JobFailed\n", line)
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	event := gitopsconfig.SyncEvent{}
+	if assert.True(t, strings.HasPrefix(line, "data: ")) {
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+	}
+	assert.Equal(t, "gitopsconfig-app-abcde", event.Job)
+	assert.Equal(t, "Job failed", event.Message)
+
+	// the subscription ends with the connection
+	resp.Body.Close()
+	select {
+	case <-unsubscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the disconnected client wasn't unsubscribed")
+	}
+}
+
+func TestSyncEventsHandlerTooManySubscribers(t *testing.T) {
+	w := httptest.NewRecorder()
+	SyncEventsHandler(w, httptest.NewRequest("GET", SyncEventsPath, nil), func(namespace, name string) (<-chan gitopsconfig.SyncEvent, func(), error) {
+		return nil, nil, fmt.Errorf("the sync events already have 1 subscribers, the most allowed")
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "the sync events already have 1 subscribers, the most allowed\n", w.Body.String())
+}
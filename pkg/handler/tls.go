@@ -0,0 +1,95 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertificateLoader serves the TLS certificate of the webhook server from a certificate and a key file, e.g. the
+// tls.crt and tls.key of a mounted Secret. The files are reloaded when they change, so that a rotated certificate is
+// served without restarting the operator.
+type CertificateLoader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// NewCertificateLoader returns a CertificateLoader of certFile and keyFile, failing if they aren't a valid pair
+func NewCertificateLoader(certFile, keyFile string) (*CertificateLoader, error) {
+	loader := &CertificateLoader{certFile: certFile, keyFile: keyFile}
+	if err := loader.reload(); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// GetCertificate returns the current certificate, reloading the files if they changed since they were last loaded. It
+// is meant for tls.Config.GetCertificate. While the files are being rotated, e.g. the certificate was updated but not
+// yet the key, the previous certificate is kept.
+func (l *CertificateLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.changed() {
+		if err := l.reload(); err != nil {
+			log.Error(err, "unable to reload the webhook certificate, keeping the previous one", "cert", l.certFile, "key", l.keyFile)
+		} else {
+			log.Info("reloaded the webhook certificate", "cert", l.certFile)
+		}
+	}
+	return l.certificate, nil
+}
+
+// changed returns true if a file was modified since it was last loaded
+func (l *CertificateLoader) changed() bool {
+	certInfo, err := os.Stat(l.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(l.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(l.certModTime) || !keyInfo.ModTime().Equal(l.keyModTime)
+}
+
+// reload loads the certificate and key files, keeping the previous certificate on failure
+func (l *CertificateLoader) reload() error {
+	certInfo, err := os.Stat(l.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(l.keyFile)
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return err
+	}
+	l.certificate = &certificate
+	l.certModTime = certInfo.ModTime()
+	l.keyModTime = keyInfo.ModTime()
+	return nil
+}
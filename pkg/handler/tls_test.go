@@ -0,0 +1,161 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its key in dir, as tls.crt and tls.key, with
+// the given modification time
+func writeCertificate(t *testing.T, dir, commonName string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(modTime.Unix()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"tls.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedCommonName connects to the TLS server at address and returns the common name of its certificate
+func servedCommonName(t *testing.T, address string) string {
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}}
+	resp, err := client.Get("https://" + address + "/webhook/")
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertificateLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	loaded := time.Now().Add(-time.Minute)
+	writeCertificate(t, dir, "eunomia-1", loaded)
+
+	loader, err := NewCertificateLoader(certFile, keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			WebhookHandler(w, r, nil)
+		}),
+		TLSConfig: &tls.Config{GetCertificate: loader.GetCertificate},
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+	address := listener.Addr().String()
+
+	assert.Equal(t, "eunomia-1", servedCommonName(t, address))
+
+	// a rotated certificate is served by the next connections
+	writeCertificate(t, dir, "eunomia-2", loaded.Add(30*time.Second))
+	assert.Equal(t, "eunomia-2", servedCommonName(t, address))
+
+	// while only the certificate is rotated, the previous pair is kept
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCertificate(t, dir, "eunomia-3", loaded.Add(40*time.Second))
+	err = ioutil.WriteFile(keyFile, key, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "eunomia-2", servedCommonName(t, address))
+}
+
+func TestNewCertificateLoaderInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	_, err = NewCertificateLoader(certFile, keyFile)
+	assert.Error(t, err, "the files are missing")
+
+	err = ioutil.WriteFile(certFile, []byte("not a certificate"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, []byte("not a key"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewCertificateLoader(certFile, keyFile)
+	assert.Error(t, err)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// webhookWaitParam is the query parameter of the webhook calls waiting for the runs they trigger to finish
+	webhookWaitParam = "wait"
+	// webhookTimeoutParam is the query parameter of the webhook calls setting how long they wait, e.g. 300s
+	webhookTimeoutParam = "timeout"
+	// defaultWebhookWaitTimeout is how long the webhook calls wait without a timeout
+	defaultWebhookWaitTimeout = 5 * time.Minute
+	// maxWebhookWaitTimeout is the longest the webhook calls may wait
+	maxWebhookWaitTimeout = time.Hour
+)
+
+// watchRunEvents subscribes the webhook calls waiting for their runs to the sync events of the GitOpsConfigs they
+// trigger, received from the job watch
+var watchRunEvents SyncEventSubscriber = gitopsconfig.WatchSyncEvents
+
+// parseWebhookWait returns how long the call r waits for the runs it triggers, zero when it doesn't wait
+func parseWebhookWait(r *http.Request) (time.Duration, error) {
+	query := r.URL.Query()
+	wait, err := strconv.ParseBool(query.Get(webhookWaitParam))
+	if query.Get(webhookWaitParam) == "" || (err == nil && !wait) {
+		if query.Get(webhookTimeoutParam) != "" {
+			return 0, fmt.Errorf("%s is only allowed with %s=true", webhookTimeoutParam, webhookWaitParam)
+		}
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is not a boolean", webhookWaitParam, query.Get(webhookWaitParam))
+	}
+	if query.Get(webhookTimeoutParam) == "" {
+		return defaultWebhookWaitTimeout, nil
+	}
+	timeout, err := time.ParseDuration(query.Get(webhookTimeoutParam))
+	if err != nil || timeout <= 0 || timeout > maxWebhookWaitTimeout {
+		return 0, fmt.Errorf("%s %q must be a duration between 0s and %s, e.g. 300s", webhookTimeoutParam, query.Get(webhookTimeoutParam), maxWebhookWaitTimeout)
+	}
+	return timeout, nil
+}
+
+// awaitedRun is a run triggered by a webhook call waiting for it, whose sync events are received on events until
+// unsubscribe is called
+type awaitedRun struct {
+	instance    types.NamespacedName
+	events      <-chan gitopsconfig.SyncEvent
+	unsubscribe func()
+}
+
+// The results of the awaited runs
+const (
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+	runTimedOut  = "timed out"
+)
+
+// waitForRun waits for the result of run: the first job of its GitOpsConfig starting once it is triggered, until the
+// job succeeds, or completes its dry run, or fails, its post-sync hook included. The result is runTimedOut when
+// timeout fires first, the event is empty until the job starts. ok is false when ctx is done first, e.g. when the
+// client disconnected.
+func waitForRun(ctx context.Context, run awaitedRun, timeout <-chan time.Time) (result string, event gitopsconfig.SyncEvent, ok bool) {
+	job := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return "", event, false
+		case <-timeout:
+			return runTimedOut, event, true
+		case e, open := <-run.events:
+			if !open {
+				return runTimedOut, event, true
+			}
+			if job == "" {
+				if e.Reason == "JobStarted" {
+					job, event = e.Job, e
+				}
+				continue
+			}
+			if e.Job != job {
+				continue
+			}
+			switch e.Reason {
+			case "JobSuccessful", "DryRunCompleted":
+				return runSucceeded, e, true
+			case "JobFailed", "PostSyncFailed":
+				return runFailed, e, true
+			}
+		}
+	}
+}
+
+// writeRunResults waits for runs until timeout, and answers the webhook call with their results: 200 when they all
+// succeeded, 502 when one failed and 504 when one didn't finish in time, the body listing the result of every run.
+// Nothing is written when the client disconnects, the wait ends with the call.
+func writeRunResults(w http.ResponseWriter, r *http.Request, runs []awaitedRun, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	deadline := timer.C
+	status := http.StatusOK
+	lines := []string{}
+	for _, run := range runs {
+		result, event, ok := waitForRun(r.Context(), run, deadline)
+		if !ok {
+			log.Info("webhook client disconnected while waiting for the runs", "remote", r.RemoteAddr)
+			return
+		}
+		switch {
+		case result == runFailed:
+			status = http.StatusBadGateway
+		case result == runTimedOut && status == http.StatusOK:
+			status = http.StatusGatewayTimeout
+		}
+		if result == runTimedOut && deadline == timer.C {
+			// the timer fired, the runs left are not waited for anymore
+			expired := make(chan time.Time)
+			close(expired)
+			deadline = expired
+		}
+		line := fmt.Sprintf("%s: %s", run.instance, result)
+		if event.Job != "" {
+			line += fmt.Sprintf(", job %s", event.Job)
+		}
+		if result != runTimedOut {
+			line += ": " + event.Message
+		}
+		lines = append(lines, line)
+	}
+	log.Info("webhook runs finished", "status", status)
+	w.WriteHeader(status)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunEvents replaces the sync events watched by the webhook calls waiting for their runs with events, and
+// returns a function restoring them and another one telling whether the watches were all ended
+func fakeRunEvents(events ...gitopsconfig.SyncEvent) (restore func(), unsubscribed func() bool) {
+	saved := watchRunEvents
+	subscribed := 0
+	watchRunEvents = func(namespace, name string) (<-chan gitopsconfig.SyncEvent, func(), error) {
+		channel := make(chan gitopsconfig.SyncEvent, len(events))
+		for _, e := range events {
+			channel <- e
+		}
+		subscribed++
+		return channel, func() { subscribed-- }, nil
+	}
+	return func() { watchRunEvents = saved }, func() bool { return subscribed == 0 }
+}
+
+func TestWebhookWait(t *testing.T) {
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{
+		newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia"),
+	}}
+	started := gitopsconfig.SyncEvent{Namespace: "team-a", Name: "app", Job: "gitopsconfig-app-abcde", Reason: "JobStarted", Message: "Job started: gitopsconfig-app-abcde"}
+	tests := []struct {
+		name   string
+		path   string
+		events []gitopsconfig.SyncEvent
+		code   int
+		body   string
+	}{
+		{
+			name:   "success",
+			path:   "/webhook/team-a/app?wait=true",
+			events: []gitopsconfig.SyncEvent{started, {Job: "gitopsconfig-app-abcde", Reason: "JobSuccessful", Message: "Job finished successfully: gitopsconfig-app-abcde"}},
+			code:   http.StatusOK,
+			body:   "team-a/app: succeeded, job gitopsconfig-app-abcde: Job finished successfully: gitopsconfig-app-abcde\n",
+		},
+		{
+			name: "failure",
+			path: "/webhook/team-a/app?wait=true&timeout=300s",
+			events: []gitopsconfig.SyncEvent{
+				// the events of a job started before the call are ignored
+				{Job: "gitopsconfig-app-zyxwv", Reason: "JobSuccessful", Message: "Job finished successfully: gitopsconfig-app-zyxwv"},
+				started,
+				{Job: "gitopsconfig-app-abcde", Reason: "JobFailed", Message: "Job failed: gitopsconfig-app-abcde, the Apply phase failed"},
+			},
+			code: http.StatusBadGateway,
+			body: "team-a/app: failed, job gitopsconfig-app-abcde: Job failed: gitopsconfig-app-abcde, the Apply phase failed\n",
+		},
+		{
+			name:   "timeout",
+			path:   "/webhook/team-a/app?wait=true&timeout=50ms",
+			events: []gitopsconfig.SyncEvent{started},
+			code:   http.StatusGatewayTimeout,
+			body:   "team-a/app: timed out, job gitopsconfig-app-abcde\n",
+		},
+		{
+			name: "not waiting",
+			path: "/webhook/team-a/app?wait=false",
+			code: http.StatusOK,
+		},
+		{
+			name: "invalid timeout",
+			path: "/webhook/team-a/app?wait=true&timeout=300",
+			code: http.StatusBadRequest,
+			body: "timeout \"300\" must be a duration between 0s and 1h0m0s, e.g. 300s\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restore, unsubscribed := fakeRunEvents(tt.events...)
+			defer restore()
+			w, _ := sendPush(t, lister, tt.path)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.body, w.Body.String())
+			assert.True(t, unsubscribed())
+		})
+	}
+}
+
+func TestWebhookWaitClientDisconnected(t *testing.T) {
+	lister := &staticLister{items: []gitopsv1alpha1.GitOpsConfig{
+		newGitOpsConfig("team-a", "app", "https://github.com/KohlsTechnology/eunomia"),
+	}}
+	restore, unsubscribed := fakeRunEvents()
+	defer restore()
+
+	// the call returns as soon as the client is gone, long before the timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := newPushRequest("/webhook/team-a/app?wait=true&timeout=1h", pushPayload).WithContext(ctx)
+	w, triggered := sendRequest(t, lister, req)
+	assert.Len(t, triggered, 1)
+	assert.Empty(t, w.Body.String())
+	assert.True(t, unsubscribed())
+}
+
+func TestParseWebhookWait(t *testing.T) {
+	for query, expected := range map[string]string{
+		"":                                  "0s",
+		"wait=true":                         "5m0s",
+		"wait=1&timeout=30s":                "30s",
+		"wait=false":                        "0s",
+		"timeout=30s":                       "timeout is only allowed with wait=true",
+		"wait=yes":                          "wait \"yes\" is not a boolean",
+		"wait=true&timeout=-1s":             "timeout \"-1s\" must be a duration between 0s and 1h0m0s, e.g. 300s",
+		"wait=true&timeout=2h":              "timeout \"2h\" must be a duration between 0s and 1h0m0s, e.g. 300s",
+		"wait=true&timeout=0s&x=y":          "timeout \"0s\" must be a duration between 0s and 1h0m0s, e.g. 300s",
+		"gitopsconfig=team-a/app&wait=true": "5m0s",
+	} {
+		timeout, err := parseWebhookWait(newPushRequest("/webhook/?"+query, ""))
+		if err != nil {
+			assert.Equal(t, expected, err.Error(), query)
+			continue
+		}
+		assert.Equal(t, expected, timeout.String(), query)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package history formats the sync history recorded in the status of a GitOpsConfig, for the kubectl-eunomia plugin.
+package history
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// shortCommitLength is the number of characters of the commit hashes printed
+const shortCommitLength = 7
+
+// Print writes to w the syncs of history, the most recent first, as a table, or a message when the GitOpsConfig
+// called name has no sync yet
+func Print(w io.Writer, name string, history []gitopsv1alpha1.SyncRecord) error {
+	if len(history) == 0 {
+		_, err := fmt.Fprintf(w, "No sync recorded for GitOpsConfig %s\n", name)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tRESULT\tCOMMIT\tDURATION\tJOB")
+	for _, record := range history {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			formatTime(record.Time.Time), record.Result, shortCommit(record.Commit), formatDuration(record.Duration.Duration), record.Job)
+	}
+	return tw.Flush()
+}
+
+// formatTime formats t in UTC, or - when it isn't known
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// shortCommit abbreviates the hash of commit, or returns - when it isn't known
+func shortCommit(commit string) string {
+	if commit == "" {
+		return "-"
+	}
+	if len(commit) > shortCommitLength {
+		return commit[:shortCommitLength]
+	}
+	return commit
+}
+
+// formatDuration formats d, or returns - when it isn't known
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.String()
+}
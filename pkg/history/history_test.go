@@ -0,0 +1,73 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestPrint(t *testing.T) {
+	finished := time.Date(2019, time.June, 3, 14, 5, 0, 0, time.FixedZone("EDT", -4*3600))
+	history := []gitopsv1alpha1.SyncRecord{
+		{
+			Job:      "gitopsconfig-app-7fd2x",
+			Time:     metav1.NewTime(finished),
+			Result:   "Success",
+			Commit:   "0123456789abcdef0123456789abcdef01234567",
+			Duration: metav1.Duration{Duration: 42 * time.Second},
+		},
+		{
+			Job:      "gitopsconfig-app-9kq4m",
+			Time:     metav1.NewTime(finished.Add(-time.Hour)),
+			Result:   "Failed",
+			Commit:   "fedcba9",
+			Duration: metav1.Duration{Duration: 3*time.Minute + 5*time.Second},
+		},
+		{
+			Job:    "gitopsconfig-app-z2b8c",
+			Time:   metav1.NewTime(finished.Add(-2 * time.Hour)),
+			Result: "Success",
+		},
+	}
+	out := &bytes.Buffer{}
+	assert.NoError(t, Print(out, "app", history))
+
+	golden := filepath.Join("testdata", "history.golden")
+	if *update {
+		assert.NoError(t, ioutil.WriteFile(golden, out.Bytes(), 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), out.String())
+}
+
+func TestPrintEmpty(t *testing.T) {
+	out := &bytes.Buffer{}
+	assert.NoError(t, Print(out, "app", nil))
+	assert.Equal(t, "No sync recorded for GitOpsConfig app\n", out.String())
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// Notification is sent to a webhook when a GitOpsConfig fails to sync
+type Notification struct {
+	// Time at which the failure was reported
+	Time time.Time `json:"time"`
+	// Namespace of the GitOpsConfig
+	Namespace string `json:"namespace"`
+	// Config is the name of the GitOpsConfig
+	Config string `json:"config"`
+	// Job is the name of the failed job
+	Job string `json:"job"`
+	// Message describes the failure
+	Message string `json:"message"`
+	// Logs is where the logs of the job can be read, a URL or a kubectl command
+	Logs string `json:"logs"`
+}
+
+// Summary returns the one line description of n
+func (n Notification) Summary() string {
+	return fmt.Sprintf("GitOpsConfig %s/%s failed to sync", n.Namespace, n.Config)
+}
+
+// Text returns the description of n, including where to read the logs of the job
+func (n Notification) Text() string {
+	return fmt.Sprintf("%s, job %s: %s\nLogs: %s", n.Summary(), n.Job, n.Message, n.Logs)
+}
+
+// Formatter renders a notification as the payload of a webhook
+type Formatter interface {
+	Format(n Notification) ([]byte, error)
+}
+
+// Formats are the supported notification formats
+var Formats = []string{"Slack", "Teams", "Generic"}
+
+// NewFormatter returns the formatter of the given format, one of Formats
+func NewFormatter(format string) (Formatter, error) {
+	switch format {
+	case "Slack":
+		return SlackFormatter{}, nil
+	case "Teams":
+		return TeamsFormatter{}, nil
+	case "Generic":
+		return GenericFormatter{}, nil
+	}
+	return nil, fmt.Errorf("notification format %q is not one of %s", format, strings.Join(Formats, ", "))
+}
+
+// SlackFormatter renders the notifications as the messages of the Slack incoming webhooks
+type SlackFormatter struct{}
+
+// Format returns the Slack message of n
+func (SlackFormatter) Format(n Notification) ([]byte, error) {
+	return json.Marshal(map[string]string{"text": n.Text()})
+}
+
+// TeamsFormatter renders the notifications as the message cards of the Microsoft Teams incoming webhooks
+type TeamsFormatter struct{}
+
+// Format returns the Teams message card of n, linking to the logs of the job when they are at a URL
+func (TeamsFormatter) Format(n Notification) ([]byte, error) {
+	card := map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    n.Summary(),
+		"themeColor": "D63333",
+		"title":      n.Summary(),
+		"text":       fmt.Sprintf("Job %s: %s", n.Job, n.Message),
+	}
+	if strings.HasPrefix(n.Logs, "http://") || strings.HasPrefix(n.Logs, "https://") {
+		card["potentialAction"] = []map[string]interface{}{{
+			"@type":   "OpenUri",
+			"name":    "View logs",
+			"targets": []map[string]string{{"os": "default", "uri": n.Logs}},
+		}}
+	} else {
+		card["text"] = fmt.Sprintf("Job %s: %s\n\nLogs: %s", n.Job, n.Message, n.Logs)
+	}
+	return json.Marshal(card)
+}
+
+// GenericFormatter renders the notifications as their JSON encoding
+type GenericFormatter struct{}
+
+// Format returns the JSON encoding of n
+func (GenericFormatter) Format(n Notification) ([]byte, error) {
+	return json.Marshal(n)
+}
+
+// Send POSTs n rendered by formatter to url, any non 2xx response is an error
+func Send(client *http.Client, url string, formatter Formatter, n Notification) error {
+	body, err := formatter.Format(n)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if urlErr, ok := err.(*neturl.Error); ok {
+		// the URL of a webhook is a secret, it is left out of the error
+		return fmt.Errorf("unable to post the notification: %v", urlErr.Err)
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification webhook responded with %s", resp.Status)
+	}
+	return nil
+}
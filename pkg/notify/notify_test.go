@@ -0,0 +1,106 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var notification = Notification{
+	Namespace: "gitops",
+	Config:    "gitops-operator",
+	Job:       "gitopsconfig-gitops-operator-abcde",
+	Message:   "Job failed: BackoffLimitExceeded",
+	Logs:      "kubectl logs -n gitops job/gitopsconfig-gitops-operator-abcde",
+}
+
+func TestSlackFormatter(t *testing.T) {
+	body, err := SlackFormatter{}.Format(notification)
+	assert.NoError(t, err)
+	message := map[string]string{}
+	assert.NoError(t, json.Unmarshal(body, &message))
+	assert.Equal(t, "GitOpsConfig gitops/gitops-operator failed to sync, job gitopsconfig-gitops-operator-abcde: "+
+		"Job failed: BackoffLimitExceeded\nLogs: kubectl logs -n gitops job/gitopsconfig-gitops-operator-abcde", message["text"])
+}
+
+func TestTeamsFormatter(t *testing.T) {
+	body, err := TeamsFormatter{}.Format(notification)
+	assert.NoError(t, err)
+	card := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(body, &card))
+	assert.Equal(t, "MessageCard", card["@type"])
+	assert.Equal(t, "GitOpsConfig gitops/gitops-operator failed to sync", card["title"])
+	assert.Contains(t, card["text"], "Logs: kubectl logs")
+	assert.Nil(t, card["potentialAction"])
+
+	withURL := notification
+	withURL.Logs = "https://logs.example.com/gitops/gitopsconfig-gitops-operator-abcde"
+	body, err = TeamsFormatter{}.Format(withURL)
+	assert.NoError(t, err)
+	card = map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(body, &card))
+	assert.Equal(t, "Job gitopsconfig-gitops-operator-abcde: Job failed: BackoffLimitExceeded", card["text"])
+	assert.Contains(t, string(body), `"uri":"https://logs.example.com/gitops/gitopsconfig-gitops-operator-abcde"`)
+}
+
+func TestGenericFormatter(t *testing.T) {
+	sent := notification
+	sent.Time = time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	body, err := GenericFormatter{}.Format(sent)
+	assert.NoError(t, err)
+	received := Notification{}
+	assert.NoError(t, json.Unmarshal(body, &received))
+	assert.Equal(t, sent, received)
+}
+
+func TestNewFormatter(t *testing.T) {
+	for _, format := range Formats {
+		formatter, err := NewFormatter(format)
+		assert.NoError(t, err)
+		assert.NotNil(t, formatter)
+	}
+	_, err := NewFormatter("PagerDuty")
+	assert.EqualError(t, err, `notification format "PagerDuty" is not one of Slack, Teams, Generic`)
+}
+
+func TestSend(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	assert.NoError(t, Send(server.Client(), server.URL, SlackFormatter{}, notification))
+	assert.Contains(t, string(received), "failed to sync")
+}
+
+func TestSendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	assert.EqualError(t, Send(server.Client(), server.URL, SlackFormatter{}, notification), "notification webhook responded with 404 Not Found")
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package orphan finds the resources applied by Eunomia that no GitOpsConfig
+// claims anymore, e.g. the leftovers of deleted configurations.
+package orphan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+var log = logf.Log.WithName("orphan")
+
+const (
+	// ManagedByLabel is set by the template processors on the resources they apply
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of ManagedByLabel on the resources applied by Eunomia
+	ManagedByValue = "eunomia"
+	// OwnerAnnotation is set by the template processors to the <namespace>/<name> of the GitOpsConfig applying the resource
+	OwnerAnnotation = "gitopsconfig.eunomia.kohls.io/owner"
+)
+
+// Resource is a resource applied by Eunomia that no GitOpsConfig claims
+type Resource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Owner is the GitOpsConfig that applied the resource, empty if unknown
+	Owner string `json:"owner,omitempty"`
+	// Reason tells why no GitOpsConfig claims the resource
+	Reason string `json:"reason"`
+
+	resource schema.GroupVersionResource
+}
+
+// String returns the kind, namespace and name of the resource
+func (r Resource) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", strings.ToLower(r.Kind), r.Name)
+	}
+	return fmt.Sprintf("%s/%s in %s", strings.ToLower(r.Kind), r.Name, r.Namespace)
+}
+
+// Finder finds the orphaned resources of the cluster
+type Finder struct {
+	discovery discovery.DiscoveryInterface
+	dynamic   dynamic.Interface
+	// configs reads the GitOpsConfigs claiming the resources
+	configs client.Reader
+}
+
+// NewFinder returns a finder of the orphaned resources of the cluster of kubecfg,
+// reading the GitOpsConfigs with configs
+func NewFinder(kubecfg *rest.Config, configs client.Reader) (*Finder, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(kubecfg)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubecfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Finder{discovery: discoveryClient, dynamic: dynamicClient, configs: configs}, nil
+}
+
+// Find returns the resources labeled as managed by Eunomia whose GitOpsConfig
+// doesn't exist anymore, or doesn't target their namespace anymore. The
+// resources controlled by another resource are left out, they are not leftovers.
+func (f *Finder) Find() ([]Resource, error) {
+	configList := &gitopsv1alpha1.GitOpsConfigList{}
+	if err := f.configs.List(context.TODO(), &client.ListOptions{}, configList); err != nil {
+		return nil, err
+	}
+	configs := map[string]*gitopsv1alpha1.GitOpsConfig{}
+	for i := range configList.Items {
+		config := &configList.Items[i]
+		configs[config.Namespace+"/"+config.Name] = config
+	}
+
+	lists, err := discovery.ServerPreferredResources(f.discovery)
+	if err != nil {
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return nil, err
+		}
+		// the resources of the available groups can still be checked
+		log.Info("unable to discover some API groups, their resources are not checked", "error", err.Error())
+	}
+	lists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "delete"}}, lists)
+
+	orphans := []Resource{}
+	selector := ManagedByLabel + "=" + ManagedByValue
+	for _, list := range lists {
+		groupVersion, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, apiResource := range list.APIResources {
+			resource := groupVersion.WithResource(apiResource.Name)
+			objects, err := f.dynamic.Resource(resource).List(metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, fmt.Errorf("unable to list %s: %v", resource.String(), err)
+			}
+			for i := range objects.Items {
+				object := &objects.Items[i]
+				if metav1.GetControllerOf(object) != nil {
+					continue
+				}
+				if reason, orphaned := orphanReason(object, configs); orphaned {
+					orphans = append(orphans, Resource{
+						APIVersion: object.GetAPIVersion(),
+						Kind:       object.GetKind(),
+						Namespace:  object.GetNamespace(),
+						Name:       object.GetName(),
+						Owner:      object.GetAnnotations()[OwnerAnnotation],
+						Reason:     reason,
+						resource:   resource,
+					})
+				}
+			}
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].String() < orphans[j].String()
+	})
+	return orphans, nil
+}
+
+// orphanReason returns why object isn't claimed by any of configs, and false if it is claimed.
+// A GitOpsConfig with an inventory only claims the resources of the namespaces in it, and of its
+// target namespaces, which the next job applies into. The inventory has no cluster-scoped resources,
+// they are claimed by their GitOpsConfig as long as it exists.
+func orphanReason(object *unstructured.Unstructured, configs map[string]*gitopsv1alpha1.GitOpsConfig) (string, bool) {
+	owner := object.GetAnnotations()[OwnerAnnotation]
+	if owner == "" {
+		return "the resource has no owner annotation", true
+	}
+	config, ok := configs[owner]
+	if !ok {
+		return fmt.Sprintf("GitOpsConfig %s doesn't exist", owner), true
+	}
+	if len(config.Status.Inventory) == 0 || object.GetNamespace() == "" {
+		return "", false
+	}
+	for _, namespace := range config.Spec.TargetNamespaces {
+		if namespace == object.GetNamespace() {
+			return "", false
+		}
+	}
+	for _, inventory := range config.Status.Inventory {
+		if inventory.Namespace == object.GetNamespace() {
+			return "", false
+		}
+	}
+	return fmt.Sprintf("namespace %s isn't in the inventory of GitOpsConfig %s", object.GetNamespace(), owner), true
+}
+
+// Delete deletes the orphaned resources, returning the first error met, if any, once all are attempted
+func (f *Finder) Delete(orphans []Resource) error {
+	var firstErr error
+	for _, orphan := range orphans {
+		err := f.dynamic.Resource(orphan.resource).Namespace(orphan.Namespace).Delete(orphan.Name, &metav1.DeleteOptions{})
+		if err != nil {
+			log.Error(err, "unable to delete orphaned resource", "resource", orphan.String())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		log.Info("Deleted orphaned resource", "resource", orphan.String(), "reason", orphan.Reason)
+	}
+	return firstErr
+}
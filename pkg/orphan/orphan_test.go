@@ -0,0 +1,171 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphan
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var configMaps = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// newObject returns a config map in namespace, managed by owner unless empty
+func newObject(namespace, name, owner string) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion("v1")
+	object.SetKind("ConfigMap")
+	object.SetNamespace(namespace)
+	object.SetName(name)
+	if owner != "" {
+		object.SetLabels(map[string]string{ManagedByLabel: ManagedByValue})
+		object.SetAnnotations(map[string]string{OwnerAnnotation: owner})
+	}
+	return object
+}
+
+func newFinder(objects ...runtime.Object) *Finder {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(gitopsv1alpha1.SchemeGroupVersion, &gitopsv1alpha1.GitOpsConfig{}, &gitopsv1alpha1.GitOpsConfigList{})
+	configs := []runtime.Object{
+		&gitopsv1alpha1.GitOpsConfig{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "gitops"}},
+		&gitopsv1alpha1.GitOpsConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "tenants", Namespace: "gitops"},
+			Status: gitopsv1alpha1.GitOpsConfigStatus{
+				Inventory: []gitopsv1alpha1.NamespaceInventory{{Namespace: "tenant-a"}, {Namespace: "tenant-b"}},
+			},
+		},
+	}
+	discovery := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	discovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"list", "delete"}},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: []string{"create"}},
+			},
+		},
+	}
+	return &Finder{
+		discovery: discovery,
+		dynamic:   fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), objects...),
+		configs:   fake.NewFakeClientWithScheme(s, configs...),
+	}
+}
+
+func TestFind(t *testing.T) {
+	controller := true
+	controlled := newObject("gitops", "controlled", "gitops/deleted")
+	controlled.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "frontend", UID: "1234", Controller: &controller}})
+	finder := newFinder(
+		newObject("gitops", "claimed", "gitops/frontend"),
+		newObject("tenant-a", "claimed-tenant", "gitops/tenants"),
+		newObject("gitops", "unmanaged", ""),
+		controlled,
+		newObject("gitops", "leftover", "gitops/deleted"),
+		newObject("tenant-c", "untargeted", "gitops/tenants"),
+	)
+	unowned := newObject("gitops", "unowned", "")
+	unowned.SetLabels(map[string]string{ManagedByLabel: ManagedByValue})
+	_, err := finder.dynamic.Resource(configMaps).Namespace("gitops").Create(unowned, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	orphans, err := finder.Find()
+	assert.NoError(t, err)
+	if assert.Len(t, orphans, 3) {
+		assert.Equal(t, "configmap/leftover in gitops", orphans[0].String())
+		assert.Equal(t, "gitops/deleted", orphans[0].Owner)
+		assert.Equal(t, "GitOpsConfig gitops/deleted doesn't exist", orphans[0].Reason)
+		assert.Equal(t, "configmap/unowned in gitops", orphans[1].String())
+		assert.Equal(t, "the resource has no owner annotation", orphans[1].Reason)
+		assert.Equal(t, "configmap/untargeted in tenant-c", orphans[2].String())
+		assert.Equal(t, "namespace tenant-c isn't in the inventory of GitOpsConfig gitops/tenants", orphans[2].Reason)
+	}
+}
+
+func TestOrphanReason(t *testing.T) {
+	tenants := &gitopsv1alpha1.GitOpsConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenants", Namespace: "gitops"},
+		Spec:       gitopsv1alpha1.GitOpsConfigSpec{TargetNamespaces: []string{"tenant-a", "tenant-d"}},
+		Status: gitopsv1alpha1.GitOpsConfigStatus{
+			Inventory: []gitopsv1alpha1.NamespaceInventory{{Namespace: "tenant-a"}, {Namespace: "tenant-b"}},
+		},
+	}
+	configs := map[string]*gitopsv1alpha1.GitOpsConfig{"gitops/tenants": tenants}
+	clusterRole := newObject("", "tenant-reader", "gitops/tenants")
+	clusterRole.SetAPIVersion("rbac.authorization.k8s.io/v1")
+	clusterRole.SetKind("ClusterRole")
+	tests := []struct {
+		name     string
+		object   *unstructured.Unstructured
+		reason   string
+		orphaned bool
+	}{
+		{"inventory", newObject("tenant-b", "web", "gitops/tenants"), "", false},
+		// added to the target namespaces since the last job
+		{"target namespace", newObject("tenant-d", "web", "gitops/tenants"), "", false},
+		{"untargeted namespace", newObject("tenant-c", "web", "gitops/tenants"), "namespace tenant-c isn't in the inventory of GitOpsConfig gitops/tenants", true},
+		{"cluster-scoped", clusterRole, "", false},
+		{"cluster-scoped of a deleted config", newObject("", "tenant-reader", "gitops/deleted"), "GitOpsConfig gitops/deleted doesn't exist", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, orphaned := orphanReason(tt.object, configs)
+			assert.Equal(t, tt.orphaned, orphaned)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	finder := newFinder(
+		newObject("gitops", "claimed", "gitops/frontend"),
+		newObject("gitops", "leftover", "gitops/deleted"),
+	)
+	orphans, err := finder.Find()
+	assert.NoError(t, err)
+	assert.Len(t, orphans, 1)
+
+	assert.NoError(t, finder.Delete(orphans))
+	_, err = finder.dynamic.Resource(configMaps).Namespace("gitops").Get("leftover", metav1.GetOptions{})
+	assert.Error(t, err)
+	_, err = finder.dynamic.Resource(configMaps).Namespace("gitops").Get("claimed", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestSweep(t *testing.T) {
+	for _, remove := range []bool{false, true} {
+		finder := newFinder(newObject("gitops", "leftover", "gitops/deleted"))
+		sweeper := &Sweeper{Finder: finder, Delete: remove}
+		orphans, err := sweeper.sweep()
+		assert.NoError(t, err)
+		assert.Len(t, orphans, 1)
+
+		// orphans are only deleted when asked for
+		_, err = finder.dynamic.Resource(configMaps).Namespace("gitops").Get("leftover", metav1.GetOptions{})
+		assert.Equal(t, remove, err != nil)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphan
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var orphanedResources = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "eunomia_orphaned_resources",
+	Help: "Number of resources applied by Eunomia that no GitOpsConfig claims, as found by the last sweep",
+})
+
+func init() {
+	// Register the metrics with the registry exposed by controller-runtime
+	metrics.Registry.MustRegister(orphanedResources)
+}
+
+// finder is what the sweeper needs from Finder
+type finder interface {
+	Find() ([]Resource, error)
+	Delete(orphans []Resource) error
+}
+
+// Sweeper looks for orphaned resources every Interval, logging them and
+// counting them in the eunomia_orphaned_resources metric. They are only
+// deleted with Delete.
+type Sweeper struct {
+	Finder   finder
+	Interval time.Duration
+	Delete   bool
+}
+
+var _ manager.Runnable = &Sweeper{}
+
+// Start sweeps every interval, until stopCh is closed
+func (s *Sweeper) Start(stopCh <-chan struct{}) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case <-ticker.C:
+			if _, err := s.sweep(); err != nil {
+				log.Error(err, "unable to look for orphaned resources")
+			}
+		}
+	}
+}
+
+// sweep looks for orphaned resources once, returning the ones found
+func (s *Sweeper) sweep() ([]Resource, error) {
+	orphans, err := s.Finder.Find()
+	if err != nil {
+		return nil, err
+	}
+	orphanedResources.Set(float64(len(orphans)))
+	for _, orphan := range orphans {
+		log.Info("Found orphaned resource", "resource", orphan.String(), "reason", orphan.Reason)
+	}
+	if s.Delete && len(orphans) > 0 {
+		return orphans, s.Finder.Delete(orphans)
+	}
+	return orphans, nil
+}
@@ -0,0 +1,328 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render renders the templates of a GitOpsConfig locally, from working trees of its sources, with the
+// scripts of its template processor image and the environment of its jobs, for the kubectl-eunomia plugin.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	gitopsv1beta1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1beta1"
+	"github.com/KohlsTechnology/eunomia/pkg/controller/gitopsconfig"
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// renderScripts are the scripts of the job rendering the templates, in the order they run. The clone is replaced by
+// the copy of the working trees, and the discovery of the environment of the cluster is skipped.
+var renderScripts = []string{"filterTemplates.sh", "mergeParameterValues.sh", "renderTemplates.sh"}
+
+// Options are the inputs of a local render
+type Options struct {
+	// Config is the YAML of the GitOpsConfig, v1alpha1 or v1beta1
+	Config []byte
+	// TemplateDir is the working tree of the template repository, rendered instead of its clone
+	TemplateDir string
+	// ParameterDir is the working tree of the parameter repository, TemplateDir by default
+	ParameterDir string
+	// Branch is the pushed branch selecting the parameter file, when its fileName depends on it
+	Branch string
+	// Set are the key=value parameters overriding the ones of the parameter file, the keys being dotted paths
+	Set []string
+	// ProcessorsDir is the template-processors directory of eunomia, with the scripts of the images
+	ProcessorsDir string
+	// Processor is the directory of ProcessorsDir of the template processor image, e.g. helm. It is inferred from the
+	// templateProcessorImage, without its eunomia- prefix, by default.
+	Processor string
+}
+
+// Render renders the templates of the GitOpsConfig of options like its jobs do and writes the manifests to out, each
+// preceded by the path of its file. The output of the scripts and the warnings go to log. The job templates must be
+// initialized.
+func Render(out, log io.Writer, options Options) error {
+	instance, err := loadConfig(options.Config)
+	if err != nil {
+		return err
+	}
+	gitopsconfig.DefaultGitOpsConfig(instance)
+	processor := options.Processor
+	if processor == "" {
+		processor = imageProcessor(instance.Spec.TemplateProcessorImage)
+	}
+	if _, err = os.Stat(filepath.Join(options.ProcessorsDir, processor, "bin")); err != nil {
+		return fmt.Errorf("template processor %q not found in %s: %v", processor, options.ProcessorsDir, err)
+	}
+
+	workspace, err := ioutil.TempDir("", "eunomia-render-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workspace)
+	instance.Spec.SourceMountPath = filepath.Join(workspace, "git")
+	var trigger *gitopsconfig.TriggerContext
+	if options.Branch != "" {
+		trigger = &gitopsconfig.TriggerContext{Branch: options.Branch, Ref: "refs/heads/" + options.Branch}
+	}
+	job, err := gitopsconfig.RunJob(instance, trigger)
+	if err != nil {
+		return err
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+
+	parameterDir := options.ParameterDir
+	if parameterDir == "" {
+		parameterDir = options.TemplateDir
+	}
+	bin := filepath.Join(workspace, "bin")
+	home := filepath.Join(workspace, "home")
+	manifests := filepath.Join(instance.Spec.SourceMountPath, "manifests")
+	for _, copy := range []struct{ from, to string }{
+		{options.TemplateDir, filepath.Join(instance.Spec.SourceMountPath, "templates")},
+		{parameterDir, filepath.Join(instance.Spec.SourceMountPath, "parameters")},
+		{filepath.Join(options.ProcessorsDir, "base", "bin"), bin},
+		// the scripts of the image replace the ones of the base image
+		{filepath.Join(options.ProcessorsDir, processor, "bin"), bin},
+	} {
+		if err = copyTree(copy.from, copy.to); err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{home, manifests} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	env := append(jobEnv(log, instance, container), "HOME="+home)
+	if len(options.Set) > 0 {
+		values, err := overrides(options.Set)
+		if err != nil {
+			return err
+		}
+		dir := filepath.Join(workspace, "parameter-values", "0")
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, "set.yaml"), values, 0644); err != nil {
+			return err
+		}
+		env = append(env, "PARAMETER_VALUES_DIR="+filepath.Dir(dir), "PARAMETER_VALUES_PRECEDENCE=ValuesFrom")
+	}
+	for _, script := range renderScripts {
+		cmd := exec.Command(filepath.Join(bin, script))
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout, cmd.Stderr = log, log
+		if err = cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %v", script, err)
+		}
+	}
+	return printManifests(out, manifests)
+}
+
+// loadConfig returns the v1alpha1 version of the GitOpsConfig of data, in the default namespace when it has none
+func loadConfig(data []byte) (*gitopsv1alpha1.GitOpsConfig, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+		return nil, fmt.Errorf("unable to decode the GitOpsConfig: %v", err)
+	}
+	if typeMeta.Kind != "GitOpsConfig" {
+		return nil, fmt.Errorf("the kind %q is not GitOpsConfig", typeMeta.Kind)
+	}
+	instance := &gitopsv1alpha1.GitOpsConfig{}
+	switch typeMeta.APIVersion {
+	case gitopsv1alpha1.SchemeGroupVersion.String():
+		if err := yaml.Unmarshal(data, instance); err != nil {
+			return nil, fmt.Errorf("unable to decode the GitOpsConfig: %v", err)
+		}
+	case gitopsv1beta1.SchemeGroupVersion.String():
+		config := &gitopsv1beta1.GitOpsConfig{}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("unable to decode the GitOpsConfig: %v", err)
+		}
+		if err := config.ConvertTo(instance); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("the apiVersion %q of the GitOpsConfig is not supported", typeMeta.APIVersion)
+	}
+	if instance.Namespace == "" {
+		instance.Namespace = "default"
+	}
+	return instance, nil
+}
+
+// imageProcessor returns the name of the template processor of image, e.g. helm for
+// quay.io/kohlstechnology/eunomia-helm:latest
+func imageProcessor(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimPrefix(name, "eunomia-")
+}
+
+// jobEnv returns the environment variables of the job container, as NAME=value. The ones pointing into its volumes
+// other than the sources, e.g. the CA bundle or the valuesFrom, only exist in the cluster and are left out, with a
+// warning when the GitOpsConfig uses them.
+func jobEnv(log io.Writer, instance *gitopsv1alpha1.GitOpsConfig, container corev1.Container) []string {
+	volumes := []string{}
+	for _, mount := range container.VolumeMounts {
+		if mount.MountPath != instance.Spec.SourceMountPath {
+			volumes = append(volumes, mount.MountPath)
+		}
+	}
+	env := []string{}
+	for _, variable := range container.Env {
+		switch {
+		case variable.Name == "NAMESPACE":
+			env = append(env, "NAMESPACE="+util.JobNamespace(*instance))
+		case variable.ValueFrom != nil || inVolumes(variable.Value, volumes):
+			continue
+		case strings.HasPrefix(variable.Name, "PARAMETER_VALUES_"):
+			// the valuesFrom are replaced by the parameters set
+			continue
+		default:
+			env = append(env, variable.Name+"="+variable.Value)
+		}
+	}
+	if len(instance.Spec.ParameterSource.ValuesFrom) > 0 {
+		fmt.Fprintln(log, "Warning: the valuesFrom of the parameter source are not merged, set their values instead")
+	}
+	return env
+}
+
+// inVolumes returns true if value is the path of one of the volumes, of a file in it, or of the directory holding it
+func inVolumes(value string, volumes []string) bool {
+	for _, volume := range volumes {
+		if value == volume || strings.HasPrefix(value, volume+"/") || strings.HasPrefix(volume, value+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// overrides returns the YAML map of the key=value parameters of set, the dots of the keys separating nested maps. Like
+// with helm --set, the values are strings except the integers, true, false and null, e.g. 1.10 stays a string.
+func overrides(set []string) ([]byte, error) {
+	values := map[string]interface{}{}
+	for _, parameter := range set {
+		key, raw := parameter, ""
+		if i := strings.Index(parameter, "="); i >= 0 {
+			key, raw = parameter[:i], parameter[i+1:]
+		}
+		if key == "" || key == parameter || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") || strings.Contains(key, "..") {
+			return nil, fmt.Errorf("parameter %q is not a key=value pair", parameter)
+		}
+		var value interface{} = raw
+		switch number, err := strconv.ParseInt(raw, 10, 64); {
+		case raw == "true" || raw == "false":
+			value = raw == "true"
+		case raw == "null":
+			value = nil
+		case err == nil && (raw == "0" || !strings.HasPrefix(strings.TrimPrefix(raw, "-"), "0")):
+			value = number
+		}
+		path := strings.Split(key, ".")
+		parent := values
+		for _, name := range path[:len(path)-1] {
+			child, ok := parent[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[name] = child
+			}
+			parent = child
+		}
+		parent[path[len(path)-1]] = value
+	}
+	return json.Marshal(values)
+}
+
+// copyTree copies the files of the directory from into the directory to, the .git directory excepted
+func copyTree(from, to string) error {
+	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		default:
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(target, data, info.Mode().Perm())
+		}
+	})
+}
+
+// printManifests writes to out the files of the manifests directory, sorted by path, as a YAML stream
+func printManifests(out io.Writer, manifests string) error {
+	files := []string{}
+	err := filepath.Walk(manifests, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(manifests, file)
+		if err != nil {
+			return err
+		}
+		content := strings.TrimPrefix(strings.TrimSpace(string(data)), "---\n")
+		if _, err = fmt.Fprintf(out, "---\n# Source: %s\n%s\n", filepath.ToSlash(rel), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/KohlsTechnology/eunomia/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const processorsDir = "../../template-processors"
+
+// initRender initializes the job templates and puts on the PATH a gotemplate built from the sources, for the
+// eunomia-gotemplate scripts, until the returned function is called. It skips the test when the tools of the scripts
+// are missing.
+func initRender(t *testing.T) func() {
+	for _, tool := range []string{"bash", "jq", "yq", "go"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to render the templates", tool)
+		}
+	}
+	err := util.InitializeTemplates("../../deploy/helm/operator/eunomia-templates/job.yaml", "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+	bin, err := ioutil.TempDir("", "render-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("go", "build", "-o", filepath.Join(bin, "gotemplate"), "../../cmd/gotemplate").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(bin)
+		t.Fatalf("unable to build gotemplate: %v\n%s", err, out)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(bin)
+	}
+}
+
+func TestRender(t *testing.T) {
+	defer initRender(t)()
+	tests := []struct {
+		name   string
+		config string
+		branch string
+		set    []string
+	}{
+		{
+			name:   "base",
+			config: "base.yaml",
+		},
+		{
+			name:   "gotemplate",
+			config: "gotemplate.yaml",
+		},
+		{
+			name:   "gotemplate-set",
+			config: "gotemplate.yaml",
+			set:    []string{"replicas=3", "image.tag=1.19", "name=web"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ioutil.ReadFile(filepath.Join("testdata", tt.config))
+			assert.NoError(t, err)
+			out, log := &bytes.Buffer{}, &bytes.Buffer{}
+			err = Render(out, log, Options{
+				Config:        config,
+				TemplateDir:   filepath.Join("testdata", "repo"),
+				Set:           tt.set,
+				ProcessorsDir: processorsDir,
+			})
+			if !assert.NoError(t, err, log.String()) {
+				return
+			}
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				assert.NoError(t, ioutil.WriteFile(golden, out.Bytes(), 0644))
+			}
+			expected, err := ioutil.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), out.String())
+		})
+	}
+}
+
+func TestRenderLeavesWorkingTree(t *testing.T) {
+	defer initRender(t)()
+	config, err := ioutil.ReadFile(filepath.Join("testdata", "gotemplate.yaml"))
+	assert.NoError(t, err)
+	err = Render(ioutil.Discard, ioutil.Discard, Options{
+		Config:        config,
+		TemplateDir:   filepath.Join("testdata", "repo"),
+		Set:           []string{"replicas=3"},
+		ProcessorsDir: processorsDir,
+	})
+	assert.NoError(t, err)
+	// the excluded files and the parameter file are changed in a copy
+	assert.FileExists(t, filepath.Join("testdata", "repo", "app", "README.md"))
+	values, err := ioutil.ReadFile(filepath.Join("testdata", "repo", "parameters", "values.yaml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(values), "replicas: 1\n")
+}
+
+func TestRenderErrors(t *testing.T) {
+	defer initRender(t)()
+	config, err := ioutil.ReadFile(filepath.Join("testdata", "base.yaml"))
+	assert.NoError(t, err)
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{
+			name:    "not a GitOpsConfig",
+			options: Options{Config: []byte("apiVersion: v1\nkind: ConfigMap\n")},
+		},
+		{
+			name:    "unknown processor",
+			options: Options{Config: config, Processor: "erb"},
+		},
+		{
+			name:    "invalid parameter",
+			options: Options{Config: config, Set: []string{"replicas"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.TemplateDir = filepath.Join("testdata", "repo")
+			tt.options.ProcessorsDir = processorsDir
+			assert.Error(t, Render(ioutil.Discard, ioutil.Discard, tt.options))
+		})
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	values, err := overrides([]string{"replicas=3", "image.tag=1.10", "image.repository=nginx", "debug=true", "port=08", "empty=", "none=null"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"replicas": 3, "image": {"tag": "1.10", "repository": "nginx"}, "debug": true, "port": "08", "empty": "", "none": null}`, string(values))
+	for _, invalid := range []string{"replicas", "=3", ".tag=1", "image..tag=1"} {
+		_, err = overrides([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestImageProcessor(t *testing.T) {
+	assert.Equal(t, "helm", imageProcessor("quay.io/kohlstechnology/eunomia-helm:latest"))
+	assert.Equal(t, "base", imageProcessor("mydockeregistry.io:5000/gitops/eunomia-base:latest"))
+	assert.Equal(t, "gotemplate", imageProcessor("eunomia-gotemplate@sha256:0123"))
+	assert.Equal(t, "custom", imageProcessor("registry.example.com/custom"))
+}
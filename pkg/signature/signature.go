@@ -0,0 +1,155 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Verifier checks the signature of container images
+type Verifier interface {
+	// Verify returns image pinned to the digest whose signature was verified, e.g.
+	// quay.io/kohlstechnology/eunomia-base@sha256:45b23dee..., or an error if it isn't signed by the trusted key or identity
+	Verify(image string) (string, error)
+}
+
+// Options configure the cosign verification of the images
+type Options struct {
+	// Key is the path of the trusted public key
+	Key string
+	// Identity is the trusted certificate identity of keyless signatures, e.g. an email or a workflow URL
+	Identity string
+	// Issuer is the OIDC issuer of the certificates of keyless signatures
+	Issuer string
+}
+
+// NewVerifier returns a verifier running cosign with either the public key or the keyless identity of options
+func NewVerifier(options Options) (Verifier, error) {
+	switch {
+	case options.Key != "" && (options.Identity != "" || options.Issuer != ""):
+		return nil, errors.New("either a public key or a keyless identity can be trusted, not both")
+	case options.Key != "":
+		return &CosignVerifier{Command: "cosign", Args: []string{"verify", "--key", options.Key}, Timeout: 2 * time.Minute}, nil
+	case options.Identity != "" && options.Issuer != "":
+		return &CosignVerifier{Command: "cosign", Args: []string{"verify", "--certificate-identity", options.Identity, "--certificate-oidc-issuer", options.Issuer}, Timeout: 2 * time.Minute}, nil
+	}
+	return nil, errors.New("keyless verification needs both the certificate identity and its OIDC issuer")
+}
+
+// CosignVerifier verifies the images by running the cosign CLI
+type CosignVerifier struct {
+	// Command is the cosign executable
+	Command string
+	// Args are the arguments of Command, the image is appended to them
+	Args []string
+	// Timeout bounds a single verification, which fetches the signatures from the registry
+	Timeout time.Duration
+}
+
+// cosignPayload is the part of the payloads of the verified signatures printed by cosign that names the image
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			Digest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// Verify runs cosign on image, any non zero exit code is an error. The digest is read from the payloads of the
+// verified signatures cosign prints.
+func (v *CosignVerifier) Verify(image string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), v.Timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	args := append(append([]string{}, v.Args...), image)
+	cmd := exec.CommandContext(ctx, v.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("signature of image %s cannot be verified: %v: %s", image, err, strings.TrimSpace(stderr.String()))
+	}
+	payloads := []cosignPayload{}
+	if err := json.Unmarshal(stdout.Bytes(), &payloads); err != nil || len(payloads) == 0 || payloads[0].Critical.Image.Digest == "" {
+		return "", fmt.Errorf("the digest of the verified image %s isn't known", image)
+	}
+	return repository(image) + "@" + payloads[0].Critical.Image.Digest, nil
+}
+
+// repository returns image without its tag or digest
+func repository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// CachingVerifier keeps the results of the verifications of Verifier, so that the signature of an image isn't
+// fetched from the registry before every job. The images pinned to a verified digest stay verified, the tags are
+// verified again once TTL passed since, as they can be moved to another digest, as are the failures.
+type CachingVerifier struct {
+	Verifier Verifier
+	TTL      time.Duration
+
+	mutex   sync.Mutex
+	results map[string]verification
+}
+
+// verification is the result of the verification of an image
+type verification struct {
+	pinned  string
+	err     error
+	expires time.Time
+}
+
+// NewCachingVerifier returns a verifier keeping the results of verifier for ttl
+func NewCachingVerifier(verifier Verifier, ttl time.Duration) *CachingVerifier {
+	return &CachingVerifier{Verifier: verifier, TTL: ttl, results: map[string]verification{}}
+}
+
+// Verify returns the cached result of the verification of image, verifying it with Verifier if there is none
+func (v *CachingVerifier) Verify(image string) (string, error) {
+	v.mutex.Lock()
+	result, ok := v.results[image]
+	v.mutex.Unlock()
+	if ok && (result.expires.IsZero() || time.Now().Before(result.expires)) {
+		return result.pinned, result.err
+	}
+	pinned, err := v.Verifier.Verify(image)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.results[image] = verification{pinned: pinned, err: err, expires: time.Now().Add(v.TTL)}
+	if err == nil {
+		// the digest was verified, it is the same image whichever tag it was reached by
+		v.results[pinned] = verification{pinned: pinned}
+		if pinned == image {
+			v.results[image] = verification{pinned: pinned}
+		}
+	}
+	return pinned, err
+}
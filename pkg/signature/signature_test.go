@@ -0,0 +1,117 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVerifier(t *testing.T) {
+	v, err := NewVerifier(Options{Key: "/etc/cosign/cosign.pub"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"verify", "--key", "/etc/cosign/cosign.pub"}, v.(*CosignVerifier).Args)
+
+	v, err = NewVerifier(Options{Identity: "release@kohls.com", Issuer: "https://accounts.google.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"verify", "--certificate-identity", "release@kohls.com", "--certificate-oidc-issuer", "https://accounts.google.com"}, v.(*CosignVerifier).Args)
+
+	_, err = NewVerifier(Options{Identity: "release@kohls.com"})
+	assert.Error(t, err)
+	_, err = NewVerifier(Options{Key: "/etc/cosign/cosign.pub", Identity: "release@kohls.com", Issuer: "https://accounts.google.com"})
+	assert.Error(t, err)
+}
+
+// digest is the digest of the verified images
+const digest = "sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2"
+
+func TestCosignVerifier(t *testing.T) {
+	// sh stands in for cosign, exiting with the code passed as the image
+	v := &CosignVerifier{Command: "sh", Args: []string{"-c", `echo "no matching signatures" >&2; exit $0`}, Timeout: time.Minute}
+	_, err := v.Verify("1")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no matching signatures")
+	}
+	// cosign prints the payloads of the verified signatures
+	payload := `[{"critical":{"identity":{"docker-reference":"quay.io/kohlstechnology/eunomia-helm"},"image":{"docker-manifest-digest":"` + digest + `"},"type":"cosign container image signature"},"optional":null}]`
+	v = &CosignVerifier{Command: "sh", Args: []string{"-c", `echo '` + payload + `'`}, Timeout: time.Minute}
+	for _, image := range []string{"quay.io/kohlstechnology/eunomia-helm:v0.0.3", "quay.io/kohlstechnology/eunomia-helm", "quay.io/kohlstechnology/eunomia-helm@" + digest} {
+		pinned, err := v.Verify(image)
+		assert.NoError(t, err)
+		assert.Equal(t, "quay.io/kohlstechnology/eunomia-helm@"+digest, pinned)
+	}
+	pinned, err := v.Verify("localhost:5000/eunomia-helm")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:5000/eunomia-helm@"+digest, pinned)
+	// the digest must be known to pin the image
+	v = &CosignVerifier{Command: "sh", Args: []string{"-c", "true"}, Timeout: time.Minute}
+	_, err = v.Verify("quay.io/kohlstechnology/eunomia-helm:v0.0.3")
+	assert.Error(t, err)
+}
+
+// countingVerifier counts its verifications, only trusting the images of quay.io/kohlstechnology
+type countingVerifier struct {
+	calls int
+}
+
+func (v *countingVerifier) Verify(image string) (string, error) {
+	v.calls++
+	if !strings.HasPrefix(image, "quay.io/kohlstechnology/") {
+		return "", errors.New("no matching signatures")
+	}
+	return repository(image) + "@" + digest, nil
+}
+
+func TestCachingVerifier(t *testing.T) {
+	counting := &countingVerifier{}
+	v := NewCachingVerifier(counting, time.Hour)
+	tag := "quay.io/kohlstechnology/eunomia-helm:v0.0.3"
+	pinned := "quay.io/kohlstechnology/eunomia-helm@" + digest
+	for i := 0; i < 2; i++ {
+		image, err := v.Verify(tag)
+		assert.NoError(t, err)
+		assert.Equal(t, pinned, image)
+	}
+	// the verified digest is known too
+	image, err := v.Verify(pinned)
+	assert.NoError(t, err)
+	assert.Equal(t, pinned, image)
+	assert.Equal(t, 1, counting.calls)
+
+	for i := 0; i < 2; i++ {
+		_, err = v.Verify("quay.io/attacker/eunomia-helm:v0.0.3")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, counting.calls)
+
+	// the tags and the failures are verified again once the results expire, the digests stay verified
+	counting.calls = 0
+	v = NewCachingVerifier(counting, 0)
+	for i := 0; i < 2; i++ {
+		_, err = v.Verify(tag)
+		assert.NoError(t, err)
+		_, err = v.Verify(pinned)
+		assert.NoError(t, err)
+		_, err = v.Verify("quay.io/attacker/eunomia-helm:v0.0.3")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 4, counting.calls)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+	"go.opencensus.io/trace"
+)
+
+// ServiceName names the operator in the exported traces
+const ServiceName = "eunomia-operator"
+
+// TraceParentHeader is the W3C Trace Context header carrying the span a webhook call belongs to
+const TraceParentHeader = "traceparent"
+
+// traceParentPattern matches a version 00 W3C traceparent, e.g. 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01
+var traceParentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+var (
+	exportersLock sync.Mutex
+	exporters     []trace.Exporter
+)
+
+// Start exports the traces of the operator to the OpenCensus agent at endpoint, host:port, e.g. the opencensus
+// receiver of an OpenTelemetry Collector. Tracing stays disabled when endpoint is empty. The returned function flushes
+// the spans not exported yet and stops the exporter.
+func Start(endpoint string) (func(), error) {
+	if endpoint == "" {
+		return func() {}, nil
+	}
+	exporter, err := ocagent.NewExporter(ocagent.WithInsecure(), ocagent.WithAddress(endpoint), ocagent.WithServiceName(ServiceName))
+	if err != nil {
+		return nil, fmt.Errorf("unable to export the traces to %s: %v", endpoint, err)
+	}
+	Register(exporter)
+	return func() {
+		Unregister(exporter)
+		exporter.Stop()
+	}, nil
+}
+
+// Register enables tracing, all the spans being sampled and passed to exporter
+func Register(exporter trace.Exporter) {
+	exportersLock.Lock()
+	defer exportersLock.Unlock()
+	exporters = append(exporters, exporter)
+	trace.RegisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+}
+
+// Unregister stops passing the spans to exporter, tracing being disabled once no exporter is left
+func Unregister(exporter trace.Exporter) {
+	exportersLock.Lock()
+	defer exportersLock.Unlock()
+	for i, e := range exporters {
+		if e == exporter {
+			exporters = append(exporters[:i], exporters[i+1:]...)
+			break
+		}
+	}
+	trace.UnregisterExporter(exporter)
+	if len(exporters) == 0 {
+		trace.ApplyConfig(trace.Config{DefaultSampler: trace.NeverSample()})
+	}
+}
+
+// Enabled returns true if the spans are exported
+func Enabled() bool {
+	exportersLock.Lock()
+	defer exportersLock.Unlock()
+	return len(exporters) > 0
+}
+
+// Export passes span to the exporters. It is used for the spans whose start is only known once they ended, like the
+// runs of the jobs and their phases, which the trace package can't start in the past.
+func Export(span *trace.SpanData) {
+	exportersLock.Lock()
+	defer exportersLock.Unlock()
+	for _, exporter := range exporters {
+		exporter.ExportSpan(span)
+	}
+}
+
+// NewSpanContext returns a new sampled span of the trace of parent, of a new trace if parent is the zero SpanContext
+func NewSpanContext(parent trace.SpanContext) trace.SpanContext {
+	span := trace.SpanContext{TraceID: parent.TraceID, TraceOptions: 1}
+	if span.TraceID == (trace.TraceID{}) {
+		rand.Read(span.TraceID[:])
+	}
+	rand.Read(span.SpanID[:])
+	return span
+}
+
+// FormatTraceParent returns span as a W3C traceparent
+func FormatTraceParent(span trace.SpanContext) string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(span.TraceID[:]), hex.EncodeToString(span.SpanID[:]), byte(span.TraceOptions))
+}
+
+// ParseTraceParent returns the span of a W3C traceparent, false if it isn't a valid one
+func ParseTraceParent(traceParent string) (trace.SpanContext, bool) {
+	span := trace.SpanContext{}
+	match := traceParentPattern.FindStringSubmatch(traceParent)
+	if match == nil {
+		return span, false
+	}
+	traceID, _ := hex.DecodeString(match[1])
+	spanID, _ := hex.DecodeString(match[2])
+	options, _ := hex.DecodeString(match[3])
+	copy(span.TraceID[:], traceID)
+	copy(span.SpanID[:], spanID)
+	span.TraceOptions = trace.TraceOptions(options[0])
+	if span.TraceID == (trace.TraceID{}) || span.SpanID == (trace.SpanID{}) {
+		return trace.SpanContext{}, false
+	}
+	return span, true
+}
+
+// ParseSpanID returns the span ID in hexadecimal id, false if it isn't a valid one
+func ParseSpanID(id string) (trace.SpanID, bool) {
+	span := trace.SpanID{}
+	decoded, err := hex.DecodeString(id)
+	if err != nil || len(decoded) != len(span) {
+		return span, false
+	}
+	copy(span[:], decoded)
+	return span, true
+}
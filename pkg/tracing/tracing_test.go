@@ -0,0 +1,75 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+)
+
+func TestTraceParent(t *testing.T) {
+	const traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	span, ok := ParseTraceParent(traceParent)
+	assert.True(t, ok)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", span.TraceID.String())
+	assert.Equal(t, "b7ad6b7169203331", span.SpanID.String())
+	assert.True(t, span.IsSampled())
+	assert.Equal(t, traceParent, FormatTraceParent(span))
+
+	for _, invalid := range []string{
+		"",
+		"01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-0AF7651916CD43DD8448EB211C80319C-B7AD6B7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b71692033-01",
+	} {
+		_, ok := ParseTraceParent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestNewSpanContext(t *testing.T) {
+	root := NewSpanContext(trace.SpanContext{})
+	assert.NotEqual(t, trace.TraceID{}, root.TraceID)
+	assert.NotEqual(t, trace.SpanID{}, root.SpanID)
+	assert.True(t, root.IsSampled())
+
+	child := NewSpanContext(root)
+	assert.Equal(t, root.TraceID, child.TraceID)
+	assert.NotEqual(t, root.SpanID, child.SpanID)
+}
+
+func TestParseSpanID(t *testing.T) {
+	span, ok := ParseSpanID("b7ad6b7169203331")
+	assert.True(t, ok)
+	assert.Equal(t, "b7ad6b7169203331", span.String())
+	for _, invalid := range []string{"", "b7ad6b71692033", "b7ad6b716920333g"} {
+		_, ok := ParseSpanID(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	assert.False(t, Enabled())
+	stop, err := Start("")
+	assert.NoError(t, err)
+	stop()
+	assert.False(t, Enabled())
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// applyBatchMock is a mock of kubectl logging in $HOME/batches.log the names of the objects of each List it applies,
+// failing to apply the Lists with an object named broken
+const applyBatchMock = `case " $* " in
+*" apply "*" -f "*)
+  file=${@: -1}
+  names=$(jq -r '[.items[].metadata.name] | join(" ")' $file)
+  echo "$names" >> $HOME/batches.log
+  if [[ " $names " == *" broken "* ]]; then
+    echo 'The ConfigMap "broken" is invalid' >&2
+    exit 1
+  fi ;;
+esac
+`
+
+// batchConfigMaps returns the manifests of ConfigMaps with the given names, in a single file
+func batchConfigMaps(names ...string) string {
+	var manifests []string
+	for _, name := range names {
+		manifests = append(manifests, modeManifest("ConfigMap", name, ""))
+	}
+	return strings.Join(manifests, "---\n")
+}
+
+func TestApplyInBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifests map[string]string
+		size      string
+		fails     bool
+		batches   []string
+		output    string
+	}{
+		{
+			name:      "batches keeping the order",
+			manifests: map[string]string{"a.yaml": batchConfigMaps("a1", "a2", "a3"), "b.yaml": batchConfigMaps("b1", "b2"), "c.yaml": batchConfigMaps("c1")},
+			size:      "4",
+			batches:   []string{"a1 a2 a3 b1", "b2 c1"},
+			output:    "Applied 2 batches of up to 4 objects, 0 failed",
+		},
+		{
+			name:      "batches of a single object",
+			manifests: map[string]string{"a.yaml": batchConfigMaps("a1", "a2"), "b.yaml": batchConfigMaps("b1")},
+			size:      "1",
+			batches:   []string{"a1", "a2", "b1"},
+			output:    "Applied 3 batches of up to 1 objects, 0 failed",
+		},
+		{
+			name:      "single batch",
+			manifests: map[string]string{"a.yaml": batchConfigMaps("a1", "a2"), "b.yaml": batchConfigMaps("b1")},
+			size:      "10",
+			batches:   []string{"a1 a2 b1"},
+			output:    "Applied 1 batches of up to 10 objects, 0 failed",
+		},
+		{
+			name:      "failed batch",
+			manifests: map[string]string{"a.yaml": batchConfigMaps("a1", "a2"), "b.yaml": batchConfigMaps("broken", "b2"), "c.yaml": batchConfigMaps("c1")},
+			size:      "2",
+			fails:     true,
+			// the batches after the failed one are still applied
+			batches: []string{"a1 a2", "broken b2", "c1"},
+			output:  "Apply of batch 2 failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, applyBatchMock, tt.manifests, "Fail", "APPLY_BATCH_SIZE="+tt.size)
+			assert.Equal(t, tt.fails, err != nil, output)
+			assert.Contains(t, output, tt.output)
+			assert.Equal(t, tt.batches, strings.Split(strings.TrimSpace(readFile(filepath.Join(tmp, "batches.log"))), "\n"))
+			if tt.fails {
+				assert.Contains(t, output, "Applied 3 batches of up to 2 objects, 1 failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingApplyMock is a mock of kubectl counting its applies in $HOME/attempts, the first FAILED_APPLIES of which fail
+// with APPLY_ERROR
+const failingApplyMock = `case " $* " in
+*" apply "*)
+  attempts=$(cat $HOME/attempts 2> /dev/null || echo 0)
+  echo $((attempts + 1)) > $HOME/attempts
+  if [ $attempts -lt ${FAILED_APPLIES:-0} ]; then
+    echo "$APPLY_ERROR" >&2
+    exit 1
+  fi ;;
+esac
+`
+
+func TestApplyRetries(t *testing.T) {
+	const (
+		throttled  = `Error from server (TooManyRequests): error when retrieving current configuration of: Resource: "apps/v1, Resource=deployments", Name: "web": the server has received too many requests and has asked us to try again later`
+		conflict   = `Error from server (Conflict): error when applying patch: Operation cannot be fulfilled on deployments.apps "web": the object has been modified; please apply your changes to the latest version and try again`
+		timeout    = `Error from server (Timeout): error when creating "web.yaml": the server was unable to return a response in the time allotted, but may still be processing the request`
+		invalid    = `error: error validating "web.yaml": error validating data: ValidationError(Deployment.spec): unknown field "replica" in io.k8s.api.apps.v1.DeploymentSpec`
+		ownership  = `error: Apply failed with 1 conflict: conflict with "kubectl-edit" using apps/v1: .spec.replicas`
+		retryDelay = "APPLY_RETRY_DELAY=0.01"
+	)
+	tests := []struct {
+		name     string
+		env      []string
+		fails    bool
+		attempts string
+		output   string
+	}{
+		{
+			name:     "throttled",
+			env:      []string{"FAILED_APPLIES=2", "APPLY_ERROR=" + throttled, "APPLY_RETRIES=3", retryDelay},
+			attempts: "3",
+			output:   "kubectl apply failed on a transient error, retrying in 0.02s (2/3)",
+		},
+		{
+			name:     "conflict with a concurrent update",
+			env:      []string{"FAILED_APPLIES=1", "APPLY_ERROR=" + conflict, "APPLY_RETRIES=3", retryDelay},
+			attempts: "2",
+			output:   "kubectl apply failed on a transient error, retrying in 0.01s (1/3)",
+		},
+		{
+			name:     "timeout",
+			env:      []string{"FAILED_APPLIES=1", "APPLY_ERROR=" + timeout, "APPLY_RETRIES=1", retryDelay},
+			attempts: "2",
+		},
+		{
+			name:     "retries exhausted",
+			env:      []string{"FAILED_APPLIES=3", "APPLY_ERROR=" + throttled, "APPLY_RETRIES=2", retryDelay},
+			fails:    true,
+			attempts: "3",
+			output:   "too many requests",
+		},
+		{
+			name:     "invalid manifests not retried",
+			env:      []string{"FAILED_APPLIES=1", "APPLY_ERROR=" + invalid, "APPLY_RETRIES=3", retryDelay},
+			fails:    true,
+			attempts: "1",
+		},
+		{
+			name:     "field ownership conflicts not retried",
+			env:      []string{"FAILED_APPLIES=1", "APPLY_ERROR=" + ownership, "APPLY_RETRIES=3", retryDelay},
+			fails:    true,
+			attempts: "1",
+		},
+		{
+			name:     "not retried by default",
+			env:      []string{"FAILED_APPLIES=1", "APPLY_ERROR=" + throttled},
+			fails:    true,
+			attempts: "1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "applyretry")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			manifests := map[string]string{"web.yaml": waveManifest("Deployment", "web", "")}
+			output, err := runResourceManagerWithMock(t, tmp, failingApplyMock, manifests, "Fail", tt.env...)
+			assert.Equal(t, tt.fails, err != nil, output)
+			assert.Contains(t, output, tt.output)
+			assert.Equal(t, tt.attempts, strings.TrimSpace(readFile(filepath.Join(tmp, "attempts"))))
+		})
+	}
+}
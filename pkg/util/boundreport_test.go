@@ -0,0 +1,108 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const boundReportScript = "../../template-processors/base/bin/boundReport.sh"
+
+// runBoundReport runs boundReport.sh on report and returns its output
+func runBoundReport(t *testing.T, report interface{}, env ...string) string {
+	for _, tool := range []string{"bash", "jq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run boundReport.sh", tool)
+		}
+	}
+	input, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", boundReportScript)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(string(input))
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// resources returns count resources of kind, e.g. deployment.apps/app-with-a-long-name-0
+func resources(kind string, count int) []string {
+	list := []string{}
+	for i := 0; i < count; i++ {
+		list = append(list, fmt.Sprintf("%s/app-with-a-long-name-%d", kind, i))
+	}
+	return list
+}
+
+func TestBoundReport(t *testing.T) {
+	small := map[string]interface{}{"commit": "0123abc", "pruned": resources("deployment.apps", 2), "prunedCount": 2}
+	output := runBoundReport(t, small)
+	expected, _ := json.Marshal(small)
+	assert.JSONEq(t, string(expected), output, "a report that fits is left as it is")
+
+	large := map[string]interface{}{
+		"commitMessage": "Scale the frontend",
+		"commit":        "0123abc",
+		"pruned":        resources("deployment.apps", 120),
+		"prunedCount":   120,
+		"applied":       resources("configmap", 30),
+		"inventory": []map[string]interface{}{
+			{"namespace": "team-a", "resources": resources("service", 10), "resourceCount": 120},
+		},
+		"phases":   []map[string]interface{}{{"name": "Clone", "start": 1571130000.1}, {"name": "Apply", "start": 1571130010.2}},
+		"finished": 1571130020.3,
+	}
+	output = runBoundReport(t, large)
+	assert.True(t, len(output) <= 4096, "the report is %d bytes long", len(output))
+	report := struct {
+		CommitMessage string                   `json:"commitMessage"`
+		Commit        string                   `json:"commit"`
+		Pruned        []string                 `json:"pruned"`
+		PrunedCount   int                      `json:"prunedCount"`
+		Applied       []string                 `json:"applied"`
+		Inventory     []map[string]interface{} `json:"inventory"`
+		Phases        []map[string]interface{} `json:"phases"`
+	}{}
+	if !assert.NoError(t, json.Unmarshal([]byte(output), &report), output) {
+		return
+	}
+	assert.Equal(t, "Scale the frontend", report.CommitMessage)
+	assert.Equal(t, "0123abc", report.Commit)
+	assert.Equal(t, 120, report.PrunedCount, "the counts are kept")
+	// the tails of the longest lists are dropped first
+	assert.NotEmpty(t, report.Pruned)
+	assert.Equal(t, resources("deployment.apps", len(report.Pruned)), report.Pruned)
+	assert.True(t, len(report.Pruned) < 120)
+	assert.NotEmpty(t, report.Applied)
+	assert.Len(t, report.Inventory, 1)
+	assert.Len(t, report.Phases, 2, "the lists of objects are only cut once the lists of strings are empty")
+
+	// as a last resort only the commits and the summary are reported
+	output = runBoundReport(t, large, "REPORT_MAX_SIZE=100")
+	assert.JSONEq(t, `{"commit":"0123abc","finished":1571130020.3}`, output)
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// DefaultCABundleKey is the key of the ConfigMap or Secret of the CA bundle of a GitOpsConfig that doesn't set one
+const DefaultCABundleKey = "ca.crt"
+
+// GetCABundleKey returns the key of the CA bundle of config, empty when it has none
+func GetCABundleKey(config v1alpha1.GitOpsConfig) string {
+	if config.Spec.CABundle == nil {
+		return ""
+	}
+	if config.Spec.CABundle.Key == "" {
+		return DefaultCABundleKey
+	}
+	return config.Spec.CABundle.Key
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCABundleMounted(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+	tests := []struct {
+		name   string
+		bundle *gitopsv1alpha1.CABundleReference
+		volume corev1.VolumeSource
+	}{
+		{
+			"secret",
+			&gitopsv1alpha1.CABundleReference{Kind: "Secret", Name: "internal-ca", Key: "bundle.pem"},
+			corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: "internal-ca",
+				Items:      []corev1.KeyToPath{{Key: "bundle.pem", Path: "ca.crt"}},
+			}},
+		},
+		{
+			"configmap with the default key",
+			&gitopsv1alpha1.CABundleReference{Kind: "ConfigMap", Name: "internal-ca"},
+			corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "internal-ca"},
+				Items:                []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergedata := fullconfig
+			mergedata.Config.Spec.CABundle = tt.bundle
+			job, err := CreateJob(mergedata)
+			if !assert.NoError(t, err) {
+				return
+			}
+			cronjob, err := CreateCronJob(mergedata)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, spec := range []corev1.PodSpec{job.Spec.Template.Spec, cronjob.Spec.JobTemplate.Spec.Template.Spec} {
+				assert.Contains(t, spec.Volumes, corev1.Volume{Name: "ca-bundle", VolumeSource: tt.volume})
+				container := spec.Containers[0]
+				assert.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "ca-bundle", MountPath: "/ca-bundle", ReadOnly: true})
+				assert.Contains(t, container.Env, corev1.EnvVar{Name: "CA_BUNDLE", Value: "/ca-bundle/ca.crt"})
+			}
+		})
+	}
+
+	// without a CA bundle the jobs only trust the certificate authorities of their image
+	job, err := CreateJob(fullconfig)
+	if assert.NoError(t, err) {
+		for _, volume := range job.Spec.Template.Spec.Volumes {
+			assert.NotEqual(t, "ca-bundle", volume.Name)
+		}
+		for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+			assert.NotEqual(t, "CA_BUNDLE", env.Name)
+		}
+	}
+}
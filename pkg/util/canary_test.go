@@ -0,0 +1,166 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const canaryScript = "../../template-processors/base/bin/canary.sh"
+
+// canaryKubectlMock logs its calls in $HOME/kubectl.log. The rollout of the web deployment succeeds, the one of
+// the web-canary deployment when CANARY_HEALTHY is true, it times out otherwise.
+const canaryKubectlMock = `echo "$*" >> $HOME/kubectl.log
+case " $* " in
+*" config "*|*" diff "*|*" apply "*|*" rollout status deployment/web "*) ;;
+*" rollout status deployment/web-canary "*)
+  if [ "$CANARY_HEALTHY" != "true" ]; then
+    echo "error: timed out waiting for the condition" >&2
+    exit 1
+  fi ;;
+*) exit 2 ;;
+esac
+`
+
+// canaryManifest is a manifest with the web deployment and its web-canary deployment, labeled track=canary
+const canaryManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web-canary
+  labels:
+    track: canary
+`
+
+// runCanary runs canary.sh in tmp, with a mock of kubectl, on the manifest of each namespace, the empty one
+// standing for the manifests without target namespaces. It returns the output.
+func runCanary(t *testing.T, tmp string, manifests map[string]string, healthy bool, env ...string) (string, error) {
+	for _, tool := range []string{"bash", "jq", "yq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run canary.sh", tool)
+		}
+	}
+	for namespace, manifest := range manifests {
+		dir := filepath.Join(tmp, "manifests", namespace)
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, "web.yaml"), []byte(manifest), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	kubectl := filepath.Join(tmp, "kubectl")
+	err := ioutil.WriteFile(kubectl, []byte("#!/usr/bin/env bash\n"+canaryKubectlMock), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", canaryScript)
+	cmd.Env = append(os.Environ(),
+		"kubectl="+kubectl,
+		"HOME="+tmp,
+		"MANIFEST_DIR="+filepath.Join(tmp, "manifests"),
+		"ACTION=create",
+		"CREATE_MODE=CreateOrMerge",
+		"DELETE_MODE=Delete",
+		"CANARY_HEALTH_TIMEOUT=60",
+	)
+	if healthy {
+		cmd.Env = append(cmd.Env, "CANARY_HEALTHY=true")
+	}
+	cmd.Env = append(cmd.Env, env...)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestCanarySelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		healthy bool
+	}{
+		{"canary healthy", true},
+		{"canary unhealthy", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			output, err := runCanary(t, tmp, map[string]string{"": canaryManifest}, tt.healthy, "CANARY_SELECTOR=track=canary")
+			log := readFile(filepath.Join(tmp, "kubectl.log"))
+			// only the canary is applied first
+			assert.Contains(t, log, "apply --validate=warn --field-manager=eunomia -R -f "+filepath.Join(tmp, "canary"))
+			assert.Contains(t, readFile(filepath.Join(tmp, "canary", "canary.json")), "web-canary")
+			assert.NotContains(t, readFile(filepath.Join(tmp, "canary", "canary.json")), `"web"`)
+			assert.Contains(t, log, "rollout status deployment/web-canary")
+			if tt.healthy {
+				assert.NoError(t, err, output)
+				assert.Contains(t, log, "apply --validate=warn --field-manager=eunomia -R -f "+filepath.Join(tmp, "manifests")+"\n")
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, output, "The canary deployment/web-canary isn't healthy, the rollout is aborted")
+				assert.NotContains(t, log, "-R -f "+filepath.Join(tmp, "manifests"), "the rollout is aborted")
+				assert.Equal(t, "HealthCheck\n", readFile(filepath.Join(tmp, "phase")))
+			}
+		})
+	}
+}
+
+func TestCanaryNamespaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		healthy bool
+	}{
+		{"canary healthy", true},
+		{"canary unhealthy", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			manifests := map[string]string{"team-a": canaryManifest, "team-b": canaryManifest}
+			output, err := runCanary(t, tmp, manifests, tt.healthy, "TARGET_NAMESPACES=team-a team-b", "CANARY_NAMESPACES=team-a")
+			log := readFile(filepath.Join(tmp, "kubectl.log"))
+			// all the resources of the canary namespace are applied first
+			assert.Contains(t, log, "-R -f "+filepath.Join(tmp, "canary", "team-a"))
+			assert.NotContains(t, log, filepath.Join(tmp, "canary", "team-b"))
+			assert.Contains(t, log, "rollout status deployment/web-canary -n team-a")
+			if tt.healthy {
+				assert.NoError(t, err, output)
+				assert.Contains(t, log, "-R -f "+filepath.Join(tmp, "manifests", "team-a"))
+				assert.Contains(t, log, "-R -f "+filepath.Join(tmp, "manifests", "team-b"))
+				assert.Contains(t, readFile(filepath.Join(tmp, "inventory", "team-b")), "deployment/web-canary")
+			} else {
+				assert.Error(t, err)
+				assert.NotContains(t, log, "-R -f "+filepath.Join(tmp, "manifests", "team-b"), "the rollout is aborted")
+				assert.Equal(t, "HealthCheck\n", readFile(filepath.Join(tmp, "phase")))
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// ClientSettings tunes the client side rate limiting and the timeout of the calls to the API server
+type ClientSettings struct {
+	// QPS is the sustained number of requests per second, 0 keeps the client-go default
+	QPS float32
+	// Burst is the number of requests allowed above QPS for short periods, 0 keeps the client-go default
+	Burst int
+	// Timeout is the timeout of a single request, except the watches, 0 means no timeout
+	Timeout time.Duration
+}
+
+var clientSettings ClientSettings
+
+// InitializeClientSettings sets the client settings used by the operator and the jobs, it must be called at controller boot time
+func InitializeClientSettings(settings ClientSettings) {
+	clientSettings = settings
+}
+
+// ConfigureClient applies the client settings to cfg. The timeout isn't set as
+// the timeout of cfg, which would also cut the watches of the informers off.
+func ConfigureClient(cfg *rest.Config) {
+	if clientSettings.QPS > 0 {
+		cfg.QPS = clientSettings.QPS
+	}
+	if clientSettings.Burst > 0 {
+		cfg.Burst = clientSettings.Burst
+	}
+	if clientSettings.Timeout > 0 {
+		timeout := clientSettings.Timeout
+		wrap := cfg.WrapTransport
+		cfg.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+			if wrap != nil {
+				rt = wrap(rt)
+			}
+			return &requestTimeout{next: rt, timeout: timeout}
+		}
+	}
+}
+
+// requestTimeout cancels the requests lasting more than timeout, except the
+// watches which last until the API server closes them
+type requestTimeout struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip sends req, canceling it after the timeout unless it is a watch
+func (r *requestTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get("watch") == "true" {
+		return r.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), r.timeout)
+	resp, err := r.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the body is read after RoundTrip returns, the request is only released once it is closed
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose is a response body releasing the context of its request when it is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context of its request
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// getRequestTimeout returns the request timeout in the format of the kubectl --request-timeout flag
+func getRequestTimeout() string {
+	if clientSettings.Timeout <= 0 {
+		return "0"
+	}
+	return clientSettings.Timeout.String()
+}
+
+// getKubeAPIQPS returns the requests per second of the jobs to the API server, 0 when they aren't limited
+func getKubeAPIQPS() string {
+	return strconv.FormatFloat(float64(clientSettings.QPS), 'f', -1, 32)
+}
+
+// getKubeAPIBurst returns the requests the jobs are allowed above their QPS, 0 for the client default
+func getKubeAPIBurst() string {
+	return strconv.Itoa(clientSettings.Burst)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestConfigureClient(t *testing.T) {
+	defer InitializeClientSettings(ClientSettings{})
+
+	InitializeClientSettings(ClientSettings{QPS: 50, Burst: 100, Timeout: 30 * time.Second})
+	cfg := &rest.Config{}
+	ConfigureClient(cfg)
+	assert.Equal(t, float32(50), cfg.QPS)
+	assert.Equal(t, 100, cfg.Burst)
+	// the timeout of cfg would cut the watches off
+	assert.Equal(t, time.Duration(0), cfg.Timeout)
+	assert.NotNil(t, cfg.WrapTransport)
+
+	// zero values keep the existing settings
+	InitializeClientSettings(ClientSettings{})
+	cfg = &rest.Config{QPS: 5, Burst: 10}
+	ConfigureClient(cfg)
+	assert.Equal(t, float32(5), cfg.QPS)
+	assert.Equal(t, 10, cfg.Burst)
+	assert.Equal(t, time.Duration(0), cfg.Timeout)
+	assert.Nil(t, cfg.WrapTransport)
+}
+
+func TestRequestTimeoutSkipsWatches(t *testing.T) {
+	defer InitializeClientSettings(ClientSettings{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, "done")
+	}))
+	defer server.Close()
+
+	InitializeClientSettings(ClientSettings{Timeout: 50 * time.Millisecond})
+	cfg := &rest.Config{}
+	ConfigureClient(cfg)
+	client := &http.Client{Transport: cfg.WrapTransport(http.DefaultTransport)}
+
+	_, err := client.Get(server.URL + "/api/v1/namespaces/default/pods")
+	assert.Error(t, err)
+
+	resp, err := client.Get(server.URL + "/api/v1/namespaces/default/pods?watch=true")
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Body.Close())
+		assert.Equal(t, "done", string(body))
+	}
+}
+
+func TestRequestTimeoutReachesJob(t *testing.T) {
+	defer InitializeClientSettings(ClientSettings{})
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		settings ClientSettings
+		timeout  string
+		qps      string
+		burst    string
+	}{
+		{ClientSettings{}, "0", "0", "0"},
+		{ClientSettings{QPS: 2.5, Burst: 20, Timeout: 90 * time.Second}, "1m30s", "2.5", "20"},
+	}
+	for _, tt := range tests {
+		InitializeClientSettings(tt.settings)
+		job, err := CreateJob(fullconfig)
+		assert.NoError(t, err)
+		cronjob, err := CreateCronJob(fullconfig)
+		assert.NoError(t, err)
+		for _, env := range [][]corev1.EnvVar{job.Spec.Template.Spec.Containers[0].Env, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env} {
+			assert.Contains(t, env, corev1.EnvVar{Name: "REQUEST_TIMEOUT", Value: tt.timeout})
+			assert.Contains(t, env, corev1.EnvVar{Name: "KUBE_API_QPS", Value: tt.qps})
+			assert.Contains(t, env, corev1.EnvVar{Name: "KUBE_API_BURST", Value: tt.burst})
+		}
+	}
+}
+
+func TestKubectlThrottle(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+	kubectl := filepath.Join(tmp, "kubectl")
+	err := ioutil.WriteFile(kubectl, []byte("#!/usr/bin/env bash\ndate +%s.%N >> $HOME/calls\necho \"$*\" >> $HOME/args\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 calls at once, then one every 100ms
+	for i := 0; i < 5; i++ {
+		cmd := exec.Command("bash", "../../template-processors/base/bin/kubectlThrottle.sh", "get", "pods", "-o", "name")
+		cmd.Env = append(os.Environ(), "HOME="+tmp, "KUBECTL="+kubectl, "KUBE_API_QPS=10", "KUBE_API_BURST=2")
+		output, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(output))
+	}
+	assert.Equal(t, strings.Repeat("get pods -o name\n", 5), readFile(filepath.Join(tmp, "args")))
+	var calls []float64
+	for _, line := range strings.Fields(readFile(filepath.Join(tmp, "calls"))) {
+		call, err := strconv.ParseFloat(line, 64)
+		assert.NoError(t, err)
+		calls = append(calls, call)
+	}
+	if assert.Len(t, calls, 5) {
+		assert.InDelta(t, 0.3, calls[4]-calls[0], 0.1)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unservedKindsMock is a mock of kubectl logging its calls in $HOME/kubectl.log, whose apply of the manifest directory
+// fails UNSERVED_APPLIES times with APPLY_ERROR, as when the kinds of just established CRDs aren't served yet
+const unservedKindsMock = `echo "$*" >> $HOME/kubectl.log
+case " $* " in
+*" config "*|*" diff "*|*" wait "*) ;;
+*" apply "*" -R "*)
+  attempts=$(cat $HOME/attempts 2> /dev/null || echo 0)
+  echo $((attempts + 1)) > $HOME/attempts
+  if [ $attempts -lt ${UNSERVED_APPLIES:-0} ]; then
+    echo "${APPLY_ERROR:-error: unable to recognize \"widget.yaml\": no matches for kind \"Widget\" in version \"example.com/v1\"}" >&2
+    exit 1
+  fi ;;
+*" apply "*) ;;
+*) exit 2 ;;
+esac
+`
+
+const widgetCRD = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  version: v1
+`
+
+const widget = `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gadget
+`
+
+func TestCRDsAppliedFirst(t *testing.T) {
+	withCRD := map[string]string{"crd.yaml": widgetCRD, "widget.yaml": widget}
+	tests := []struct {
+		name      string
+		manifests map[string]string
+		env       []string
+		fails     bool
+		calls     []string
+		output    string
+	}{
+		{
+			name:      "without CRDs",
+			manifests: map[string]string{"widget.yaml": widget},
+			calls:     []string{"apply -R"},
+		},
+		{
+			name:      "CRDs first",
+			manifests: withCRD,
+			calls:     []string{"apply -f crds.json", "wait --for condition=established", "apply -R"},
+		},
+		{
+			name:      "grace period",
+			manifests: withCRD,
+			env:       []string{"CRD_GRACE_PERIOD=0.1"},
+			calls:     []string{"apply -f crds.json", "wait --for condition=established", "apply -R"},
+			output:    "Waiting 0.1s for the CustomResourceDefinitions to be served",
+		},
+		{
+			name:      "kinds served after a retry",
+			manifests: withCRD,
+			env:       []string{"UNSERVED_APPLIES=2", "CRD_APPLY_RETRIES=3", "CRD_GRACE_PERIOD=0.1"},
+			calls:     []string{"apply -f crds.json", "wait --for condition=established", "apply -R", "apply -R", "apply -R"},
+			output:    "Apply failed on kinds not served yet, retrying (2/3)",
+		},
+		{
+			name:      "retries exhausted",
+			manifests: withCRD,
+			env:       []string{"UNSERVED_APPLIES=3", "CRD_APPLY_RETRIES=1", "CRD_GRACE_PERIOD=0.1"},
+			fails:     true,
+			calls:     []string{"apply -f crds.json", "wait --for condition=established", "apply -R", "apply -R"},
+			output:    "no matches for kind",
+		},
+		{
+			name:      "other failures not retried",
+			manifests: withCRD,
+			env:       []string{"UNSERVED_APPLIES=1", "CRD_APPLY_RETRIES=3", "APPLY_ERROR=The Widget \"gadget\" is invalid"},
+			fails:     true,
+			calls:     []string{"apply -f crds.json", "wait --for condition=established", "apply -R"},
+		},
+		{
+			name:      "not retried by default",
+			manifests: withCRD,
+			env:       []string{"UNSERVED_APPLIES=1"},
+			fails:     true,
+			calls:     []string{"apply -f crds.json", "wait --for condition=established", "apply -R"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "crdorder")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, unservedKindsMock, tt.manifests, "Fail", tt.env...)
+			assert.Equal(t, tt.fails, err != nil, output)
+			assert.Contains(t, output, tt.output)
+
+			var calls []string
+			for _, call := range strings.Split(strings.TrimSpace(readFile(filepath.Join(tmp, "kubectl.log"))), "\n") {
+				switch {
+				case strings.Contains(call, " wait "):
+					calls = append(calls, "wait --for condition=established")
+				case strings.Contains(call, " apply ") && strings.Contains(call, "crds.json"):
+					calls = append(calls, "apply -f crds.json")
+				case strings.Contains(call, " apply ") && strings.Contains(call, " -R "):
+					calls = append(calls, "apply -R")
+				}
+			}
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dryRunKubectlMock is pruneKubectlMock where only the web deployment of the manifests exists, and the diff finds
+// both the web deployment and the new configmap changed
+const dryRunKubectlMock = `case " $* " in
+*" diff "*)
+  echo "$*" >> $HOME/kubectl.log
+  echo "diff -u -N /tmp/LIVE-1/apps.v1.Deployment.team-a.web /tmp/MERGED-1/apps.v1.Deployment.team-a.web"
+  echo "diff -u -N /tmp/LIVE-1/v1.ConfigMap.team-a.new /tmp/MERGED-1/v1.ConfigMap.team-a.new"
+  exit 1 ;;
+*" get --ignore-not-found "*)
+  echo "$*" >> $HOME/kubectl.log
+  echo deployment.apps/web
+  exit 0 ;;
+esac
+` + pruneKubectlMock
+
+// dryRunManifests are the web deployment, which exists, and the new configmap
+var dryRunManifests = map[string]string{
+	"web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: new
+`,
+}
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     []string
+		created string
+		updated string
+		deleted string
+	}{
+		{name: "apply", env: []string{"DRY_RUN=true"}, created: "1\n", updated: "1\n"},
+		// the old configmap isn't in the manifests anymore
+		{name: "prune", env: []string{"DRY_RUN=true", "DELETE_MODE=Prune"}, created: "1\n", updated: "1\n", deleted: "configmap/old\n"},
+		{name: "delete", env: []string{"DRY_RUN=true", "ACTION=delete"}, deleted: "deployment/web\nconfigmap/new\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, dryRunKubectlMock, dryRunManifests, "", tt.env...)
+			assert.NoError(t, err, output)
+			log := readFile(filepath.Join(tmp, "kubectl.log"))
+			assert.NotContains(t, log, " apply ")
+			assert.NotContains(t, log, " delete ")
+			assert.Equal(t, tt.created, readFile(filepath.Join(tmp, "dry-run-created")))
+			assert.Equal(t, tt.updated, readFile(filepath.Join(tmp, "dry-run-updated")))
+			assert.Equal(t, tt.deleted, readFile(filepath.Join(tmp, "dry-run-deleted")))
+			assert.Empty(t, readFile(filepath.Join(tmp, "pruned")))
+			if tt.created != "" {
+				// the diff is written in the logs
+				assert.Contains(t, output, "diff -u -N /tmp/LIVE-1/v1.ConfigMap.team-a.new")
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const resourceManagerScript = "../../template-processors/base/bin/resourceManager.sh"
+
+// kubectlMock logs its calls in $HOME/kubectl.log. The live resources labeled as managed by eunomia are the web
+// deployment and the data persistentvolumeclaim of team-a/app and the settings configmap of team-a/other. Deleting
+// the objects of a file or directory prints their names.
+const kubectlMock = `echo "$*" >> $HOME/kubectl.log
+args=("$@")
+case " $* " in
+*" config "*) ;;
+*" api-resources "*) printf "deployments.apps\nconfigmaps\npersistentvolumeclaims\n" ;;
+*" get deployments.apps,configmaps,persistentvolumeclaims -l app.kubernetes.io/managed-by=eunomia "*)
+  echo '{"kind": "List", "items": [
+    {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "annotations": {"gitopsconfig.eunomia.kohls.io/owner": "team-a/app"}}},
+    {"apiVersion": "v1", "kind": "PersistentVolumeClaim", "metadata": {"name": "data", "annotations": {"gitopsconfig.eunomia.kohls.io/owner": "team-a/app"}}},
+    {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "settings", "annotations": {"gitopsconfig.eunomia.kohls.io/owner": "team-a/other"}}}]}' ;;
+*" delete -R -f "*) for ((i = 0; i < $#; i++)); do if [ "${args[$i]}" == -f ]; then find ${args[$i + 1]} -type f | sort | \
+  xargs yq -r 'select(. != null) | if .kind == "List" then .items[] else . end | (.kind | ascii_downcase) + "/" + .metadata.name'; fi; done ;;
+*" delete -f "*) for ((i = 0; i < $#; i++)); do if [ "${args[$i]}" == -f ]; then jq -r '.items[]? | (.kind | ascii_downcase) + "/" + .metadata.name' ${args[$i + 1]}; fi; done ;;
+*" delete "*) for ((i = 0; i < $#; i++)); do if [ "${args[$i]}" == delete ]; then echo ${args[$i + 1]}; fi; done ;;
+*" diff "*|*" apply "*) ;;
+*) exit 2 ;;
+esac
+`
+
+// runResourceManager runs resourceManager.sh in tmp, with a mock of kubectl, on the given manifest files and
+// emptyRenderPolicy, with env overriding the default environment. It returns the output.
+func runResourceManager(t *testing.T, tmp string, manifests map[string]string, policy string, env ...string) (string, error) {
+	return runResourceManagerWithMock(t, tmp, kubectlMock, manifests, policy, env...)
+}
+
+// runResourceManagerWithMock runs resourceManager.sh like runResourceManager, with mock as the script of kubectl
+func runResourceManagerWithMock(t *testing.T, tmp, mock string, manifests map[string]string, policy string, env ...string) (string, error) {
+	for _, tool := range []string{"bash", "jq", "yq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run resourceManager.sh", tool)
+		}
+	}
+	dir := filepath.Join(tmp, "manifests")
+	err := os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, manifest := range manifests {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(manifest), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	kubectl := filepath.Join(tmp, "kubectl")
+	err = ioutil.WriteFile(kubectl, []byte("#!/usr/bin/env bash\n"+mock), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", resourceManagerScript)
+	cmd.Env = append(os.Environ(),
+		"kubectl="+kubectl,
+		"HOME="+tmp,
+		"MANIFEST_DIR="+dir,
+		"ACTION=create",
+		"CREATE_MODE=CreateOrMerge",
+		"DELETE_MODE=Delete",
+		"TARGET_NAMESPACE=team-a",
+		"GITOPSCONFIG=team-a/app",
+		"EMPTY_RENDER_POLICY="+policy,
+	)
+	cmd.Env = append(cmd.Env, env...)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestEmptyRenderPolicy(t *testing.T) {
+	empty := map[string]string{"empty.yaml": "---\n# nothing to deploy\n---\n"}
+	tests := []struct {
+		name      string
+		manifests map[string]string
+		policy    string
+		fails     bool
+		applied   bool
+		pruned    string
+		changed   string
+	}{
+		{name: "default", manifests: empty, fails: true},
+		{name: "fail", manifests: empty, policy: "Fail", fails: true},
+		{name: "fail without files", manifests: map[string]string{}, policy: "Fail", fails: true},
+		{name: "ignore", manifests: empty, policy: "Ignore", changed: "false\n"},
+		// only the resources of the GitOpsConfig are deleted
+		{name: "prune", manifests: empty, policy: "Prune", pruned: "deployment/web\npersistentvolumeclaim/data\n", changed: "true\n"},
+		{
+			name:      "not empty",
+			manifests: map[string]string{"web.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n"},
+			policy:    "Prune",
+			applied:   true,
+			changed:   "false\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "emptyrender")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManager(t, tmp, tt.manifests, tt.policy)
+			if tt.fails {
+				assert.Error(t, err, output)
+				assert.Contains(t, output, "The templates rendered no resource")
+				assert.Equal(t, "Render\n", readFile(filepath.Join(tmp, "phase")))
+			} else {
+				assert.NoError(t, err, output)
+			}
+			log := readFile(filepath.Join(tmp, "kubectl.log"))
+			if tt.applied {
+				assert.Contains(t, log, " apply ")
+			} else {
+				assert.NotContains(t, log, " apply ")
+			}
+			assert.Equal(t, tt.pruned, readFile(filepath.Join(tmp, "pruned")))
+			if tt.pruned == "" {
+				assert.NotContains(t, log, " delete ")
+			}
+			assert.Equal(t, tt.changed, readFile(filepath.Join(tmp, "changed")))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fieldValidationMock is a mock of kubectl logging the applies in $HOME/applies, which handles the manifests with the
+// unknown field replica like the API server: they are rejected with --validate=strict, only warned about with
+// --validate=warn and applied silently with --validate=ignore. The manifests with a hard limit exceed a quota.
+const fieldValidationMock = `file=""
+previous=""
+for arg in "$@"; do
+  if [ "$previous" == "-f" ]; then
+    file=$arg
+  fi
+  previous=$arg
+done
+case " $* " in
+*" apply "*)
+  echo "$*" >> $HOME/applies
+  if [ -n "$file" ] && grep -rqs "^  replica:" "$file"; then
+    case " $* " in
+    *" --validate=strict "*)
+      echo 'error: error validating "web.yaml": error validating data: ValidationError(Deployment.spec): unknown field "replica" in io.k8s.api.apps.v1.DeploymentSpec' >&2
+      exit 1 ;;
+    *" --validate=warn "*)
+      echo 'Warning: unknown field "spec.replica"' >&2 ;;
+    esac
+  fi
+  if [ -n "$file" ] && grep -rqs "^    hard:" "$file"; then
+    echo 'Error from server (Forbidden): error when creating "web.yaml": pods "web" is forbidden: exceeded quota: compute' >&2
+    exit 1
+  fi ;;
+esac
+`
+
+func TestFieldValidationFlag(t *testing.T) {
+	valid := map[string]string{"web.yaml": waveManifest("Deployment", "web", "") + "spec:\n  replicas: 2\n"}
+	unknownField := map[string]string{"web.yaml": waveManifest("Deployment", "web", "") + "spec:\n  replica: 2\n"}
+	overQuota := map[string]string{"web.yaml": waveManifest("Deployment", "web", "") + "spec:\n  replica: 2\n  resources:\n    hard: {}\n"}
+	tests := []struct {
+		name      string
+		manifests map[string]string
+		env       []string
+		flag      string
+		fails     bool
+		warned    bool
+		phase     string
+	}{
+		{"default", valid, nil, "--validate=warn", false, false, ""},
+		{"ignore", valid, []string{"FIELD_VALIDATION=Ignore"}, "--validate=ignore", false, false, ""},
+		{"warn", valid, []string{"FIELD_VALIDATION=Warn"}, "--validate=warn", false, false, ""},
+		{"strict", valid, []string{"FIELD_VALIDATION=Strict"}, "--validate=strict", false, false, ""},
+		{"ignore unknown field", unknownField, []string{"FIELD_VALIDATION=Ignore"}, "--validate=ignore", false, false, ""},
+		{"warn unknown field", unknownField, []string{"FIELD_VALIDATION=Warn"}, "--validate=warn", false, true, ""},
+		// the rejection of the API server fails the run
+		{"strict unknown field", unknownField, []string{"FIELD_VALIDATION=Strict"}, "--validate=strict", true, false, "Validation"},
+		// the warning doesn't make a failure for another reason a validation one
+		{"warn unknown field over quota", overQuota, []string{"FIELD_VALIDATION=Warn"}, "--validate=warn", true, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, fieldValidationMock, tt.manifests, "Fail", tt.env...)
+			assert.Equal(t, tt.fails, err != nil, output)
+			applies := readFile(filepath.Join(tmp, "applies"))
+			assert.Contains(t, applies, tt.flag)
+			for _, flag := range []string{"--validate=ignore", "--validate=warn", "--validate=strict"} {
+				if flag != tt.flag {
+					assert.NotContains(t, applies, flag)
+				}
+			}
+			if tt.phase == "Validation" {
+				assert.Contains(t, output, `unknown field "replica"`)
+			}
+			if tt.fails {
+				assert.Equal(t, tt.phase == "Validation", strings.TrimSpace(readFile(filepath.Join(tmp, "phase"))) == "Validation")
+			}
+			if tt.warned {
+				assert.Contains(t, output, `Warning: unknown field "spec.replica"`)
+			} else {
+				assert.NotContains(t, output, "Warning: unknown field")
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const filterTemplatesScript = "../../template-processors/base/bin/filterTemplates.sh"
+
+var templateFiles = []string{
+	".git/config",
+	".github/ci.yaml",
+	"README.md",
+	"app/deploy.yaml",
+	"app/nested/config.yaml",
+	"app/nested/notes.md",
+	"docs/guide.md",
+	"service.yaml",
+}
+
+// runFilterTemplates runs filterTemplates.sh on a copy of templateFiles in tmp, and returns the files left
+func runFilterTemplates(t *testing.T, tmp string, env ...string) ([]string, string) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is needed to run filterTemplates.sh")
+	}
+	for _, file := range templateFiles {
+		path := filepath.Join(tmp, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script, err := filepath.Abs(filterTemplatesScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the script is run from the template directory, whose files the patterns mustn't expand to
+	cmd := exec.Command("bash", script)
+	cmd.Dir = tmp
+	cmd.Env = append(os.Environ(), "HOME="+tmp, "CLONED_TEMPLATE_GIT_DIR="+tmp, "TEMPLATE_GIT_DIR="+tmp)
+	cmd.Env = append(cmd.Env, env...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	left := []string{}
+	filepath.Walk(tmp, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(tmp, path)
+			left = append(left, rel)
+		}
+		return nil
+	})
+	sort.Strings(left)
+	return left, string(output)
+}
+
+func TestFilterTemplates(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		left []string
+	}{
+		{"no patterns", nil, templateFiles},
+		{
+			"exclude names at any depth",
+			[]string{"TEMPLATE_EXCLUDE_PATTERNS=*.md .github"},
+			[]string{".git/config", "app/deploy.yaml", "app/nested/config.yaml", "service.yaml"},
+		},
+		{
+			"exclude anchored paths",
+			[]string{"TEMPLATE_EXCLUDE_PATTERNS=app/nested/ /docs"},
+			[]string{".git/config", ".github/ci.yaml", "README.md", "app/deploy.yaml", "service.yaml"},
+		},
+		{
+			"include",
+			[]string{"TEMPLATE_INCLUDE_PATTERNS=*.yaml"},
+			[]string{".git/config", ".github/ci.yaml", "app/deploy.yaml", "app/nested/config.yaml", "service.yaml"},
+		},
+		{
+			"include after exclude",
+			[]string{"TEMPLATE_INCLUDE_PATTERNS=app/**", "TEMPLATE_EXCLUDE_PATTERNS=**/nested/*.md"},
+			[]string{".git/config", "app/deploy.yaml", "app/nested/config.yaml"},
+		},
+		{
+			"single star stays in its directory",
+			[]string{"TEMPLATE_INCLUDE_PATTERNS=app/*.yaml"},
+			[]string{".git/config", "app/deploy.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+			left, _ := runFilterTemplates(t, tmp, tt.env...)
+			assert.Equal(t, tt.left, left)
+		})
+	}
+}
+
+func TestFilterTemplatesContextDirs(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+	// the patterns are relative to each of the contextDirs
+	left, output := runFilterTemplates(t, tmp, "TEMPLATE_CONTEXT_DIRS=app docs", "TEMPLATE_EXCLUDE_PATTERNS=/nested *.md")
+	assert.Equal(t, []string{".git/config", ".github/ci.yaml", "README.md", "app/deploy.yaml", "service.yaml"}, left)
+	assert.Contains(t, output, "Excluded 2 of the 3 files of "+filepath.Join(tmp, "app"))
+	assert.Contains(t, output, "Excluded 1 of the 1 files of "+filepath.Join(tmp, "docs"))
+}
+
+func TestFilePatternsReachJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	job, err := CreateJob(mergedata)
+	assert.NoError(t, err)
+	for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+		assert.False(t, strings.HasSuffix(e.Name, "_PATTERNS"), e.Name)
+	}
+
+	mergedata.Config.Spec.TemplateSource.ExcludePatterns = []string{"*.md", ".github/"}
+	mergedata.Config.Spec.TemplateSource.IncludePatterns = []string{"deploy/**"}
+	job, err = CreateJob(mergedata)
+	assert.NoError(t, err)
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	for _, env := range [][]corev1.EnvVar{job.Spec.Template.Spec.Containers[0].Env, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env} {
+		assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_EXCLUDE_PATTERNS", Value: "*.md .github/"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_INCLUDE_PATTERNS", Value: "deploy/**"})
+	}
+}
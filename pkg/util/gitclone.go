@@ -0,0 +1,37 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// defaultCloneDepth is the number of commits fetched by the jobs when the source doesn't set its cloneDepth
+const defaultCloneDepth int32 = 1
+
+// getCloneDepth returns the number of commits of the ref of source fetched by the jobs, 0 for its whole history
+func getCloneDepth(source v1alpha1.GitConfig) int32 {
+	if source.CloneDepth != nil {
+		return *source.CloneDepth
+	}
+	return defaultCloneDepth
+}
+
+// isSingleBranch returns true if the jobs fetch the ref of source alone, without the other branches and tags
+func isSingleBranch(source v1alpha1.GitConfig) bool {
+	return source.SingleBranch == nil || *source.SingleBranch
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// handlingModeMock is a mock of kubectl logging in $HOME/modes.log how it applies, creates, updates or patches each
+// directory, with the names of its objects
+const handlingModeMock = `case " $* " in
+*" apply "*" -R "*|*" create "*" -R "*|*" update "*" -R "*|*" patch "*" -R "*)
+  dir=${@: -1}
+  names=$(find $dir -type f | sort | xargs -r yq -r 'select(. != null) | .metadata.name' | tr '\n' ' ')
+  for verb in apply create update patch; do
+    if [[ " $* " == *" $verb "* ]]; then
+      break
+    fi
+  done
+  if [[ " $* " == *" --server-side "* ]]; then
+    verb="server-side $verb"
+  fi
+  echo "$verb $names" >> $HOME/modes.log ;;
+esac
+`
+
+// modeManifest returns a manifest of the given kind and name, annotated with the given handling mode if any
+func modeManifest(kind, name, mode string) string {
+	manifest := "apiVersion: v1\nkind: " + kind + "\nmetadata:\n  name: " + name + "\n"
+	if mode != "" {
+		manifest += "  annotations:\n    gitopsconfig.eunomia.kohls.io/handling-mode: " + mode + "\n"
+	}
+	return manifest
+}
+
+func TestHandlingModeAnnotation(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifests map[string]string
+		env       []string
+		fails     bool
+		calls     []string
+		output    string
+		phase     string
+	}{
+		{
+			name:      "without annotations",
+			manifests: map[string]string{"a-web.yaml": modeManifest("Deployment", "web", ""), "b-db.yaml": modeManifest("Deployment", "db", "")},
+			calls:     []string{"apply web db"},
+		},
+		{
+			name: "mixed modes",
+			manifests: map[string]string{
+				"a-web.yaml":    modeManifest("Deployment", "web", ""),
+				"b-config.yaml": modeManifest("ConfigMap", "config", "CreateOrUpdate"),
+				"c-db.yaml":     modeManifest("Deployment", "db", "") + "---\n" + modeManifest("ConfigMap", "db-config", "ServerSideApply"),
+			},
+			calls:  []string{"apply web db", "create config", "update config", "server-side apply db-config"},
+			output: "Applying the resources in the CreateOrUpdate handling mode",
+		},
+		{
+			name: "annotation overriding the mode of the spec",
+			manifests: map[string]string{
+				"a-web.yaml":    modeManifest("Deployment", "web", ""),
+				"b-config.yaml": modeManifest("ConfigMap", "config", "CreateOrMerge"),
+			},
+			env:   []string{"CREATE_MODE=ServerSideApply"},
+			calls: []string{"server-side apply web", "apply config"},
+		},
+		{
+			name: "annotation matching the mode of the spec",
+			manifests: map[string]string{
+				"a-web.yaml":    modeManifest("Deployment", "web", ""),
+				"b-config.yaml": modeManifest("ConfigMap", "config", "CreateOrMerge"),
+			},
+			calls: []string{"apply web config"},
+		},
+		{
+			name: "only annotated resources",
+			manifests: map[string]string{
+				"a-config.yaml": modeManifest("ConfigMap", "config", "Patch"),
+			},
+			calls: []string{"patch config"},
+		},
+		{
+			name: "invalid mode",
+			manifests: map[string]string{
+				"a-web.yaml":    modeManifest("Deployment", "web", ""),
+				"b-config.yaml": modeManifest("ConfigMap", "config", "Replace"),
+			},
+			fails:  true,
+			output: "The gitopsconfig.eunomia.kohls.io/handling-mode annotation must be one of CreateOrMerge, ServerSideApply, CreateOrUpdate, Patch: ConfigMap/config Replace",
+			phase:  "Validation",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "handlingmode")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, handlingModeMock, tt.manifests, "Fail", tt.env...)
+			assert.Equal(t, tt.fails, err != nil, output)
+			assert.Contains(t, output, tt.output)
+
+			var calls []string
+			if log := strings.TrimSpace(readFile(filepath.Join(tmp, "modes.log"))); log != "" {
+				for _, call := range strings.Split(log, "\n") {
+					calls = append(calls, strings.TrimSpace(call))
+				}
+			}
+			assert.Equal(t, tt.calls, calls)
+			assert.Equal(t, tt.phase, strings.TrimSpace(readFile(filepath.Join(tmp, "phase"))))
+			// the annotated resources stay in the manifests, so that they aren't pruned
+			for name := range tt.manifests {
+				assert.FileExists(t, filepath.Join(tmp, "manifests", name))
+			}
+		})
+	}
+}
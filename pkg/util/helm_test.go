@@ -0,0 +1,187 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const helmScript = "../../template-processors/helm/bin/processTemplates.sh"
+
+// helmMock logs its calls in $HOME/helm.log, one argument per line and a blank line after every call
+const helmMock = `printf '%s\n' "$@" "" >> $HOME/helm.log
+`
+
+// helmChart is a chart depending on a chart of a remote repository and on a local one
+const helmChart = `apiVersion: v2
+name: web
+version: 0.1.0
+dependencies:
+- name: redis
+  version: 10.x.x
+  repository: https://charts.example.com/stable
+- name: common
+  version: 0.1.0
+  repository: file://../common
+`
+
+// helmCommand returns the command running the processTemplates.sh of the helm image in tmp, with a mock of helm, on
+// helmChart and the parameter file values
+func helmCommand(t *testing.T, tmp string, values string, env ...string) *exec.Cmd {
+	for _, tool := range []string{"bash", "envsubst", "jq", "yq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run processTemplates.sh", tool)
+		}
+	}
+	bin := filepath.Join(tmp, "bin")
+	for _, dir := range []string{bin, filepath.Join(tmp, "templates"), filepath.Join(tmp, "parameters")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(bin, "helm"):                    "#!/usr/bin/env bash\n" + helmMock,
+		filepath.Join(tmp, "templates", "Chart.yaml"): helmChart,
+	}
+	if values != "" {
+		files[filepath.Join(tmp, "parameters", "values.yaml")] = values
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("bash", helmScript)
+	cmd.Env = append(os.Environ(),
+		"PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"HOME="+tmp,
+		"CLONED_TEMPLATE_GIT_DIR="+filepath.Join(tmp, "templates"),
+		"CLONED_PARAMETER_GIT_DIR="+filepath.Join(tmp, "parameters"),
+		"MANIFEST_DIR="+filepath.Join(tmp, "manifests"),
+		"NAMESPACE=gitops",
+		"REPLICAS=3",
+	)
+	cmd.Env = append(cmd.Env, env...)
+	return cmd
+}
+
+// runHelm runs helmCommand, and returns the calls of helm, one argument per line
+func runHelm(t *testing.T, tmp string, values string, env ...string) string {
+	output, err := helmCommand(t, tmp, values, env...).CombinedOutput()
+	assert.NoError(t, err, string(output))
+	return readFile(filepath.Join(tmp, "helm.log"))
+}
+
+func TestHelmTemplate(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	log := runHelm(t, tmp, "replicas: ${REPLICAS}\n",
+		"HELM_RELEASE_NAME=web",
+		"HELM_RELEASE_NAMESPACE=team-a",
+		"HELM_SET=image.tag=v1.2.0\nmotd=hello world",
+	)
+	calls := strings.Split(strings.TrimSuffix(log, "\n\n"), "\n\n")
+	if !assert.Len(t, calls, 3, log) {
+		return
+	}
+	// only the remote repositories are added before the dependencies are built
+	assert.Equal(t, "repo\nadd\ndependency-0\nhttps://charts.example.com/stable", calls[0])
+	assert.Equal(t, "dependency\nbuild\n"+filepath.Join(tmp, "templates"), calls[1])
+	assert.Equal(t, strings.Join([]string{"template", "web", filepath.Join(tmp, "templates"),
+		"--namespace", "team-a", "--include-crds", "--no-hooks", "--output-dir", filepath.Join(tmp, "manifests"),
+		"--values", filepath.Join(tmp, "values_subst.yaml"), "--set", "image.tag=v1.2.0", "--set", "motd=hello world"}, "\n"), calls[2])
+	assert.Equal(t, "replicas: 3\n", readFile(filepath.Join(tmp, "values_subst.yaml")))
+
+	// the dependencies are built once for all the target namespaces
+	log = runHelm(t, tmp, "")
+	calls = strings.Split(strings.TrimSuffix(log, "\n\n"), "\n\n")
+	assert.Len(t, calls, 4, log)
+	assert.Contains(t, calls[3], "template\nrelease-name\n")
+	assert.Contains(t, calls[3], "--namespace\ngitops\n")
+}
+
+func TestHelmValuesFiles(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+	chart := filepath.Join(tmp, "templates")
+	if err := os.MkdirAll(filepath.Join(chart, "env"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"values-common.yaml", "env/values-production.yaml"} {
+		if err := ioutil.WriteFile(filepath.Join(chart, file), []byte("replicas: 1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// helm merges the values from left to right: the values files in order, then the parameter file, then the set values
+	log := runHelm(t, tmp, "replicas: ${REPLICAS}\n",
+		"TEMPLATE_VALUES_FILES=values-common.yaml\nenv/values-production.yaml",
+		"HELM_SET=replicas=5",
+	)
+	calls := strings.Split(strings.TrimSuffix(log, "\n\n"), "\n\n")
+	template := calls[len(calls)-1]
+	assert.True(t, strings.HasSuffix(template, strings.Join([]string{
+		"--values", filepath.Join(chart, "values-common.yaml"),
+		"--values", filepath.Join(chart, "env/values-production.yaml"),
+		"--values", filepath.Join(tmp, "values_subst.yaml"),
+		"--set", "replicas=5"}, "\n")), template)
+
+	// the values files alone, without a parameter file
+	os.Remove(filepath.Join(tmp, "parameters", "values.yaml"))
+	log = runHelm(t, tmp, "", "TEMPLATE_VALUES_FILES=env/values-production.yaml\nvalues-common.yaml")
+	calls = strings.Split(strings.TrimSuffix(log, "\n\n"), "\n\n")
+	template = calls[len(calls)-1]
+	assert.True(t, strings.HasSuffix(template, strings.Join([]string{"--output-dir", filepath.Join(tmp, "manifests"),
+		"--values", filepath.Join(chart, "env/values-production.yaml"),
+		"--values", filepath.Join(chart, "values-common.yaml")}, "\n")), template)
+}
+
+func TestHelmMissingValuesFile(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	cmd := helmCommand(t, tmp, "", "TEMPLATE_VALUES_FILES=values-staging.yaml\nvalues-qa.yaml")
+	output, err := cmd.CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "The valuesFiles values-staging.yaml values-qa.yaml of the template source don't exist in "+filepath.Join(tmp, "templates"))
+	// the run fails before the dependencies of the chart are fetched
+	assert.Equal(t, "", readFile(filepath.Join(tmp, "helm.log")))
+}
+
+func TestValuesFilesReachJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	mergedata.Config.Spec.TemplateSource.ValuesFiles = []string{"values.yaml", "values-production.yaml"}
+	job, err := CreateJob(mergedata)
+	assert.NoError(t, err)
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	for _, env := range [][]corev1.EnvVar{job.Spec.Template.Spec.Containers[0].Env, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env} {
+		assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_VALUES_FILES", Value: "values.yaml\nvalues-production.yaml"})
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	storeInventoryScript      = "../../template-processors/base/bin/storeInventory.sh"
+	inventoryNamespacesScript = "../../template-processors/base/bin/inventoryNamespaces.sh"
+)
+
+// inventoryKubectlMock logs its calls in $HOME/kubectl.log and keeps the file it applies in $HOME/applied.json. Listing
+// the applied resources prints the web deployment of team-a and the web clusterrole.
+const inventoryKubectlMock = `echo "$*" >> $HOME/kubectl.log
+args=("$@")
+case " $* " in
+*" get -R -f "*" -o custom-columns="*) printf "apps/v1   Deployment    team-a   web\nrbac.authorization.k8s.io/v1   ClusterRole   <none>   web\n" ;;
+*" apply --server-side "*)
+  for ((i = 0; i < $#; i++)); do if [ "${args[$i]}" == -f ]; then cp ${args[$i + 1]} $HOME/applied.json; fi; done ;;
+*" config "*|*" diff "*|*" apply "*) ;;
+*) exit 2 ;;
+esac
+`
+
+// runStoreInventory runs storeInventory.sh in tmp on the managed resources, with the kubectl mock, and returns the
+// ConfigMap it applied, nil if none, and its output
+func runStoreInventory(t *testing.T, tmp, mock, managed string, env ...string) (*corev1.ConfigMap, string) {
+	for _, tool := range []string{"bash", "jq", "gzip", "base64", "sha256sum"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run storeInventory.sh", tool)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(tmp, "kubectl"):           "#!/usr/bin/env bash\n" + mock,
+		filepath.Join(tmp, "managed-resources"): managed,
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Remove(filepath.Join(tmp, "applied.json"))
+	cmd := exec.Command("bash", storeInventoryScript)
+	cmd.Env = append(os.Environ(), "kubectl="+filepath.Join(tmp, "kubectl"), "HOME="+tmp, "GITOPSCONFIG=team-a/app", "GITOPSCONFIG_UID=1234")
+	cmd.Env = append(cmd.Env, env...)
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	applied := readFile(filepath.Join(tmp, "applied.json"))
+	if applied == "" {
+		return nil, string(output)
+	}
+	configMap := &corev1.ConfigMap{}
+	assert.NoError(t, json.Unmarshal([]byte(applied), configMap))
+	return configMap, string(output)
+}
+
+func TestRecordManagedResources(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	output, err := runResourceManagerWithMock(t, tmp, inventoryKubectlMock, pruneManifests, "")
+	assert.NoError(t, err, output)
+	// the namespaces are the ones of the live resources, the cluster-scoped ones have none
+	assert.Equal(t, "apps/v1/Deployment team-a/web\nrbac.authorization.k8s.io/v1/ClusterRole web\n", readFile(filepath.Join(tmp, "managed-resources")))
+	assert.Equal(t, "", readFile(filepath.Join(tmp, "inventory-unknown")))
+
+	// the resources applied by a run that can't list them aren't known
+	tmp2 := tempDir(t)
+	defer os.RemoveAll(tmp2)
+	mock := strings.Replace(inventoryKubectlMock, `printf "apps/v1`, `exit 1; printf "apps/v1`, 1)
+	output, err = runResourceManagerWithMock(t, tmp2, mock, pruneManifests, "")
+	assert.NoError(t, err, output)
+	assert.Equal(t, "", readFile(filepath.Join(tmp2, "managed-resources")))
+	assert.Equal(t, "the applied resources of namespace team-a couldn't be listed\n", readFile(filepath.Join(tmp2, "inventory-unknown")))
+}
+
+func TestStoreInventory(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	configMap, _ := runStoreInventory(t, tmp, inventoryKubectlMock, "v1/Service team-b/web\napps/v1/Deployment team-a/web\nv1/Service team-b/web\n")
+	if assert.NotNil(t, configMap) {
+		assert.Equal(t, "gitopsconfig-app-inventory", configMap.Name)
+		assert.Equal(t, "team-a", configMap.Namespace)
+		// the inventory is sorted, each resource listed once
+		assert.Equal(t, map[string]string{"resources": "apps/v1/Deployment team-a/web\nv1/Service team-b/web\n"}, configMap.Data)
+		if assert.Len(t, configMap.OwnerReferences, 1) {
+			assert.Equal(t, "GitOpsConfig", configMap.OwnerReferences[0].Kind)
+			assert.Equal(t, "app", configMap.OwnerReferences[0].Name)
+			assert.Equal(t, "1234", string(configMap.OwnerReferences[0].UID))
+		}
+	}
+	hash := readFile(filepath.Join(tmp, "inventory-hash"))
+	assert.Regexp(t, "^[0-9a-f]{64}\n$", hash)
+	assert.Equal(t, strings.TrimSpace(hash), configMap.Annotations["gitopsconfig.eunomia.kohls.io/inventory-hash"])
+	assert.Equal(t, "2\n", readFile(filepath.Join(tmp, "inventory-count")))
+	assert.Equal(t, "gitopsconfig-app-inventory\n", readFile(filepath.Join(tmp, "inventory-configmap")))
+	assert.Contains(t, readFile(filepath.Join(tmp, "kubectl.log")), "apply --server-side --force-conflicts --field-manager=eunomia-inventory")
+
+	// the next sync replaces it, a removed resource changes the hash
+	configMap, _ = runStoreInventory(t, tmp, inventoryKubectlMock, "apps/v1/Deployment team-a/web\n")
+	if assert.NotNil(t, configMap) {
+		assert.Equal(t, map[string]string{"resources": "apps/v1/Deployment team-a/web\n"}, configMap.Data)
+	}
+	assert.NotEqual(t, hash, readFile(filepath.Join(tmp, "inventory-hash")))
+	assert.Equal(t, "1\n", readFile(filepath.Join(tmp, "inventory-count")))
+}
+
+func TestStoreLargeInventory(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	managed := "apps/v1/Deployment team-a/api\napps/v1/Deployment team-a/web\n"
+	configMap, _ := runStoreInventory(t, tmp, inventoryKubectlMock, managed, "INVENTORY_MAX_SIZE=32")
+	if !assert.NotNil(t, configMap) {
+		return
+	}
+	assert.Empty(t, configMap.Data)
+	reader, err := gzip.NewReader(bytes.NewReader(configMap.BinaryData["resources.gz"]))
+	if assert.NoError(t, err) {
+		resources, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, managed, string(resources))
+	}
+}
+
+func TestStoreInventoryKeepsPrevious(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	// the resources of a run aren't all known, nothing is reported
+	err := ioutil.WriteFile(filepath.Join(tmp, "inventory-unknown"), []byte("the applied resources of namespace team-a couldn't be listed\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap, output := runStoreInventory(t, tmp, inventoryKubectlMock, "apps/v1/Deployment team-a/web\n")
+	assert.Nil(t, configMap)
+	assert.Contains(t, output, "Keeping the previous inventory, the applied resources of namespace team-a couldn't be listed")
+	assert.Equal(t, "", readFile(filepath.Join(tmp, "inventory-hash")))
+	os.Remove(filepath.Join(tmp, "inventory-unknown"))
+
+	// the ConfigMap can't be written, the inventory is still reported without it
+	mock := strings.Replace(inventoryKubectlMock, "cp ${args[$i + 1]} $HOME/applied.json", "exit 1", 1)
+	configMap, output = runStoreInventory(t, tmp, mock, "apps/v1/Deployment team-a/web\n")
+	assert.Nil(t, configMap)
+	assert.Contains(t, output, "Unable to keep the inventory in ConfigMap team-a/gitopsconfig-app-inventory")
+	assert.Equal(t, "1\n", readFile(filepath.Join(tmp, "inventory-count")))
+	assert.Equal(t, "", readFile(filepath.Join(tmp, "inventory-configmap")))
+}
+
+func TestInventoryNamespaces(t *testing.T) {
+	for _, tool := range []string{"bash", "jq", "gzip", "base64"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run inventoryNamespaces.sh", tool)
+		}
+	}
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	// the ConfigMap stored by a previous run is printed by the mock
+	inventory := "apps/v1/Deployment team-a/web\nrbac.authorization.k8s.io/v1/ClusterRole web\nv1/Service team-b/web\nv1/Service team-c/api\nv1/Service team-e/web\n"
+	configMap, _ := runStoreInventory(t, tmp, inventoryKubectlMock, inventory)
+	if !assert.NotNil(t, configMap) {
+		return
+	}
+	large, _ := runStoreInventory(t, tmp, inventoryKubectlMock, inventory, "INVENTORY_MAX_SIZE=32")
+	if !assert.NotNil(t, large) {
+		return
+	}
+	tests := []struct {
+		name      string
+		configMap *corev1.ConfigMap
+		prune     string
+		expected  string
+	}{
+		// team-b was removed from the target namespaces, it is pruned even when the status doesn't list it
+		{"inventory", configMap, "", "team-b"},
+		{"gzipped inventory", large, "", "team-b"},
+		{"status and inventory", configMap, "team-d team-b", "team-d team-b"},
+		{"no inventory", nil, "team-d", "team-d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := `echo 'Error from server (NotFound): configmaps "gitopsconfig-app-inventory" not found' >&2; exit 1`
+			if tt.configMap != nil {
+				content, err := json.Marshal(tt.configMap)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(tmp, "configmap.json"), content, 0644); err != nil {
+					t.Fatal(err)
+				}
+				// team-e was deleted since the inventory was stored
+				mock = `echo "$*" >> $HOME/kubectl.log
+case " $* " in
+*" get namespace team-e "*) echo 'Error from server (NotFound): namespaces "team-e" not found' >&2; exit 1 ;;
+*" get namespace "*) ;;
+*) cat $HOME/configmap.json ;;
+esac`
+			}
+			if err := ioutil.WriteFile(filepath.Join(tmp, "kubectl"), []byte("#!/usr/bin/env bash\n"+mock+"\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command("bash", inventoryNamespacesScript)
+			cmd.Env = append(os.Environ(), "kubectl="+filepath.Join(tmp, "kubectl"), "HOME="+tmp, "GITOPSCONFIG=team-a/app",
+				"TARGET_NAMESPACES=team-a team-c", "PRUNE_NAMESPACES="+tt.prune)
+			output, err := cmd.Output()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, strings.TrimSpace(string(output)))
+		})
+	}
+	assert.Contains(t, readFile(filepath.Join(tmp, "kubectl.log")), "get configmap gitopsconfig-app-inventory -n team-a -o json")
+}
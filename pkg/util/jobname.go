@@ -0,0 +1,88 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// DefaultJobNameTemplate names the jobs after their configuration, and the pushed commit when known
+	DefaultJobNameTemplate = "gitopsconfig-{{ .Name }}{{ with .Commit }}-{{ . }}{{ end }}"
+	// maxJobNameLength is the length of the job-name label set on the pods of the jobs
+	maxJobNameLength  = validation.DNS1123LabelMaxLength
+	nonceLength       = 6
+	shortCommitLength = 7
+)
+
+// JobNameData holds the fields that can be used in the jobNameTemplate of a GitOpsConfig
+type JobNameData struct {
+	// Name is the name of the GitOpsConfig
+	Name string
+	// Commit is the short hash of the pushed commit that triggered the run, empty if unknown
+	Commit string
+	// Timestamp is the UTC creation time of the job, formatted as 20060102150405
+	Timestamp string
+}
+
+// getJobName returns the name of a job of jobmergedata, created at the current time
+func getJobName(jobmergedata *JobMergeData) (string, error) {
+	return jobName(jobmergedata, time.Now())
+}
+
+// jobName executes the jobNameTemplate of the configuration, truncating the
+// result so that a random suffix can be appended within maxJobNameLength
+func jobName(jobmergedata *JobMergeData, now time.Time) (string, error) {
+	text := jobmergedata.Config.Spec.JobNameTemplate
+	if text == "" {
+		text = DefaultJobNameTemplate
+	}
+	tmpl, err := template.New("jobName").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("jobNameTemplate %q is not a valid template: %v", text, err)
+	}
+	commit := jobmergedata.Commit
+	if len(commit) > shortCommitLength {
+		commit = commit[:shortCommitLength]
+	}
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, JobNameData{
+		Name:      jobmergedata.Config.GetName(),
+		Commit:    commit,
+		Timestamp: now.UTC().Format("20060102150405"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to execute jobNameTemplate %q: %v", text, err)
+	}
+	prefix := b.String()
+	if max := maxJobNameLength - nonceLength - 1; len(prefix) > max {
+		prefix = prefix[:max]
+	}
+	prefix = strings.TrimRight(prefix, "-.")
+	name := prefix + "-" + uniuri.NewLenChars(nonceLength, []byte("abcdefghijklmnopqrstuvwxyz0123456789"))
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return "", fmt.Errorf("jobNameTemplate %q gives the invalid job name %q: %s", text, name, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
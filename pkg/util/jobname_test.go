@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobName(t *testing.T) {
+	now := time.Date(2019, 7, 4, 13, 30, 15, 0, time.FixedZone("EDT", -4*3600))
+	tests := []struct {
+		name     string
+		config   string
+		template string
+		commit   string
+		prefix   string
+	}{
+		{"default", "frontend", "", "", "gitopsconfig-frontend-"},
+		{"commit", "frontend", "", "0123456789abcdef", "gitopsconfig-frontend-0123456-"},
+		{"timestamp", "frontend", "{{ .Name }}-{{ .Timestamp }}", "", "frontend-20190704173015-"},
+		{"truncated", strings.Repeat("a", 60), "", "0123456789abcdef", "gitopsconfig-" + strings.Repeat("a", 43) + "-"},
+		{"trailing dash", strings.Repeat("a", 42), "", "0123456789abcdef", "gitopsconfig-" + strings.Repeat("a", 42) + "-"},
+	}
+	for _, tt := range tests {
+		mergedata := fullconfig
+		mergedata.Config.Name = tt.config
+		mergedata.Config.Spec.JobNameTemplate = tt.template
+		mergedata.Commit = tt.commit
+		name, err := jobName(&mergedata, now)
+		if assert.NoError(t, err, tt.name) {
+			assert.True(t, strings.HasPrefix(name, tt.prefix), "%s: %s", tt.name, name)
+			assert.Len(t, name, len(tt.prefix)+nonceLength, tt.name)
+			assert.True(t, len(name) <= 63, tt.name)
+		}
+	}
+
+	// the random suffix keeps the names of the jobs of a same commit apart
+	first, _ := jobName(&fullconfig, now)
+	second, _ := jobName(&fullconfig, now)
+	assert.NotEqual(t, first, second)
+}
+
+func TestJobNameInvalid(t *testing.T) {
+	for _, text := range []string{"{{ .Name", "{{ .Branch }}", "Job_{{ .Name }}"} {
+		mergedata := fullconfig
+		mergedata.Config.Spec.JobNameTemplate = text
+		_, err := jobName(&mergedata, time.Now())
+		assert.Error(t, err, text)
+	}
+}
+
+func TestJobNameReachesJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	mergedata.Commit = "0123456789abcdef"
+	job, err := CreateJob(mergedata)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^gitopsconfig-"+fullconfig.Config.Name+"-0123456-[a-z0-9]{6}$", job.Name)
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// JobNamespace returns the namespace where the jobs and the cronjob of config are created
+func JobNamespace(config v1alpha1.GitOpsConfig) string {
+	if config.Spec.JobNamespace == "" {
+		return config.GetNamespace()
+	}
+	return config.Spec.JobNamespace
+}
+
+// CronJobName returns the name of the cronjob of config. The cronjobs created in another namespace than the one of
+// config are prefixed with its namespace, so that the GitOpsConfigs of the same name sharing a jobNamespace don't
+// share their cronjob.
+func CronJobName(config v1alpha1.GitOpsConfig) string {
+	if JobNamespace(config) == config.GetNamespace() {
+		return "gitopsconfig-" + config.GetName()
+	}
+	return "gitopsconfig-" + config.GetNamespace() + "-" + config.GetName()
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// defaultBackoffLimit is the backoffLimit of the jobs of the GitOpsConfigs not setting one
+const defaultBackoffLimit int32 = 4
+
+// getBackoffLimit returns the backoffLimit of the jobs of config. The jobs that the operator relaunches itself,
+// on a retryable exit code or an unreachable API server, are never retried by the job controller.
+func getBackoffLimit(config v1alpha1.GitOpsConfig) int32 {
+	if len(config.Spec.RetryableExitCodes) > 0 || config.Spec.RetryClusterUnavailable {
+		return 0
+	}
+	if config.Spec.JobTemplate != nil && config.Spec.JobTemplate.BackoffLimit != nil {
+		return *config.Spec.JobTemplate.BackoffLimit
+	}
+	return defaultBackoffLimit
+}
+
+// getActiveDeadlineSeconds returns the activeDeadlineSeconds of the jobs of config, 0 when they have no deadline
+func getActiveDeadlineSeconds(config v1alpha1.GitOpsConfig) int64 {
+	if config.Spec.JobTemplate != nil && config.Spec.JobTemplate.ActiveDeadlineSeconds != nil {
+		return *config.Spec.JobTemplate.ActiveDeadlineSeconds
+	}
+	return 0
+}
+
+// getShardCount returns the number of shards the resources of config are split into, one per completion of its jobs
+func getShardCount(config v1alpha1.GitOpsConfig) int32 {
+	if config.Spec.JobTemplate != nil && config.Spec.JobTemplate.Completions != nil {
+		return *config.Spec.JobTemplate.Completions
+	}
+	return 1
+}
+
+// defaultJobResources are the requests and limits of the template processors of the GitOpsConfigs not setting them
+var defaultJobResources corev1.ResourceRequirements
+
+// SetDefaultJobResources configures the requests and limits of the template processors of the GitOpsConfigs not
+// setting them, each a comma separated list of name=quantity, e.g. cpu=100m,memory=256Mi. Empty lists keep the
+// template processors unbounded.
+func SetDefaultJobResources(requests, limits string) error {
+	resources := corev1.ResourceRequirements{}
+	var err error
+	if resources.Requests, err = ParseResourceList(requests); err != nil {
+		return fmt.Errorf("invalid job requests: %s", err)
+	}
+	if resources.Limits, err = ParseResourceList(limits); err != nil {
+		return fmt.Errorf("invalid job limits: %s", err)
+	}
+	for name, request := range resources.Requests {
+		if limit, found := resources.Limits[name]; found && request.Cmp(limit) > 0 {
+			return fmt.Errorf("job request %s=%s is greater than its limit %s", name, request.String(), limit.String())
+		}
+	}
+	defaultJobResources = resources
+	return nil
+}
+
+// ParseResourceList parses a comma separated list of name=quantity, e.g. cpu=100m,memory=256Mi, nil when s is empty
+func ParseResourceList(s string) (corev1.ResourceList, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	list := corev1.ResourceList{}
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%q is not a name=quantity pair", item)
+		}
+		quantity, err := resource.ParseQuantity(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity of %s: %s", parts[0], err)
+		}
+		list[corev1.ResourceName(parts[0])] = quantity
+	}
+	return list, nil
+}
+
+// jobResources returns the requests and limits of the template processor of config: the ones of its jobTemplate,
+// the operator defaults filling the resources it doesn't name
+func jobResources(config v1alpha1.GitOpsConfig) corev1.ResourceRequirements {
+	resources := corev1.ResourceRequirements{}
+	if config.Spec.JobTemplate != nil && config.Spec.JobTemplate.Resources != nil {
+		resources = *config.Spec.JobTemplate.Resources.DeepCopy()
+	}
+	requests := resources.Requests
+	resources.Requests = withDefaultQuantities(resources.Requests, defaultJobResources.Requests)
+	resources.Limits = withDefaultQuantities(resources.Limits, defaultJobResources.Limits)
+	// a default request above the limit set by the configuration would make the pod invalid, it is lowered to it
+	for name, request := range resources.Requests {
+		if _, set := requests[name]; set {
+			continue
+		}
+		if limit, found := resources.Limits[name]; found && request.Cmp(limit) > 0 {
+			resources.Requests[name] = limit
+		}
+	}
+	return resources
+}
+
+// withDefaultQuantities returns a copy of list with the quantities of defaults it doesn't name, nil when both are empty
+func withDefaultQuantities(list, defaults corev1.ResourceList) corev1.ResourceList {
+	if len(list) == 0 && len(defaults) == 0 {
+		return nil
+	}
+	merged := corev1.ResourceList{}
+	for name, quantity := range defaults {
+		merged[name] = quantity
+	}
+	for name, quantity := range list {
+		merged[name] = quantity
+	}
+	return merged
+}
+
+// getJobResources returns the requests and limits of the template processor of config in JSON, empty when it is
+// unbounded
+func getJobResources(config v1alpha1.GitOpsConfig) (string, error) {
+	resources := jobResources(config)
+	if len(resources.Requests) == 0 && len(resources.Limits) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(resources)
+	return string(b), err
+}
+
+// toJSON returns v in JSON, a valid YAML flow value to render a field of the job templates verbatim
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
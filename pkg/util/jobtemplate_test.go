@@ -0,0 +1,182 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// resourceList parses list, failing the test if it is invalid
+func resourceList(t *testing.T, list string) corev1.ResourceList {
+	parsed, err := ParseResourceList(list)
+	assert.NoError(t, err, list)
+	return parsed
+}
+
+func TestJobResources(t *testing.T) {
+	defer SetDefaultJobResources("", "")
+	tests := []struct {
+		name             string
+		requests, limits string
+		resources        *corev1.ResourceRequirements
+		wantRequests     string
+		wantLimits       string
+	}{
+		{name: "unbounded"},
+		{name: "operator defaults", requests: "cpu=100m,memory=256Mi", limits: "memory=1Gi",
+			wantRequests: "cpu=100m,memory=256Mi", wantLimits: "memory=1Gi"},
+		{name: "configuration", resources: &corev1.ResourceRequirements{Limits: resourceList(t, "cpu=2")},
+			wantLimits: "cpu=2"},
+		{name: "configuration over defaults", requests: "cpu=100m,memory=256Mi", limits: "memory=1Gi",
+			resources:    &corev1.ResourceRequirements{Requests: resourceList(t, "memory=512Mi"), Limits: resourceList(t, "cpu=2")},
+			wantRequests: "cpu=100m,memory=512Mi", wantLimits: "cpu=2,memory=1Gi"},
+		// the default request is lowered to the limit of the configuration
+		{name: "limit below the default request", requests: "cpu=500m,memory=256Mi",
+			resources:    &corev1.ResourceRequirements{Limits: resourceList(t, "cpu=200m")},
+			wantRequests: "cpu=200m,memory=256Mi", wantLimits: "cpu=200m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, SetDefaultJobResources(tt.requests, tt.limits))
+			config := fullconfig.Config
+			if tt.resources != nil {
+				config.Spec.JobTemplate = &gitopsv1alpha1.JobTemplate{Resources: tt.resources}
+			}
+			resources := jobResources(config)
+			assert.Equal(t, resourceList(t, tt.wantRequests), resources.Requests)
+			assert.Equal(t, resourceList(t, tt.wantLimits), resources.Limits)
+		})
+	}
+}
+
+func TestJobResourcesReachJob(t *testing.T) {
+	defer SetDefaultJobResources("", "")
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	job, err := CreateJob(mergedata)
+	assert.NoError(t, err)
+	assert.Equal(t, corev1.ResourceRequirements{}, job.Spec.Template.Spec.Containers[0].Resources, "existing configurations stay unbounded")
+
+	assert.NoError(t, SetDefaultJobResources("memory=256Mi", "memory=1Gi"))
+	mergedata.Config.Spec.JobTemplate = &gitopsv1alpha1.JobTemplate{
+		Resources: &corev1.ResourceRequirements{Requests: resourceList(t, "cpu=250m")},
+	}
+	want := corev1.ResourceRequirements{Requests: resourceList(t, "cpu=250m,memory=256Mi"), Limits: resourceList(t, "memory=1Gi")}
+	job, err = CreateJob(mergedata)
+	assert.NoError(t, err)
+	assert.Equal(t, want, job.Spec.Template.Spec.Containers[0].Resources)
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	assert.Equal(t, want, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Resources)
+}
+
+func TestSetDefaultJobResources(t *testing.T) {
+	defer SetDefaultJobResources("", "")
+	assert.NoError(t, SetDefaultJobResources(" cpu=100m, memory=256Mi", "cpu=1"))
+	assert.EqualError(t, SetDefaultJobResources("cpu", ""), `invalid job requests: "cpu" is not a name=quantity pair`)
+	assert.Error(t, SetDefaultJobResources("", "memory=lots"))
+	assert.EqualError(t, SetDefaultJobResources("cpu=2", "cpu=1"), "job request cpu=2 is greater than its limit 1")
+	// an invalid setting keeps the previous one
+	assert.Equal(t, resourceList(t, "cpu=100m,memory=256Mi"), defaultJobResources.Requests)
+}
+
+func TestJobSchedulingReachesJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	job, err := CreateJob(mergedata)
+	assert.NoError(t, err)
+	assert.Nil(t, job.Spec.Template.Spec.NodeSelector)
+	assert.Nil(t, job.Spec.Template.Spec.Tolerations)
+	assert.Nil(t, job.Spec.Template.Spec.Affinity)
+
+	toleration := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "operators", Effect: corev1.TaintEffectNoSchedule}
+	affinity := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{"amd64"}},
+			}}},
+		},
+	}}
+	mergedata.Config.Spec.JobTemplate = &gitopsv1alpha1.JobTemplate{
+		NodeSelector: map[string]string{"node-role.kubernetes.io/operators": ""},
+		Tolerations:  []corev1.Toleration{toleration},
+		Affinity:     affinity,
+	}
+	job, err = CreateJob(mergedata)
+	assert.NoError(t, err)
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	for _, spec := range []corev1.PodSpec{job.Spec.Template.Spec, cronjob.Spec.JobTemplate.Spec.Template.Spec} {
+		assert.Equal(t, map[string]string{"node-role.kubernetes.io/operators": ""}, spec.NodeSelector)
+		assert.Equal(t, []corev1.Toleration{toleration}, spec.Tolerations)
+		assert.Equal(t, affinity, spec.Affinity)
+	}
+}
+
+func TestJobShardingReachesJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	hasEnv := func(env []corev1.EnvVar, name string) bool {
+		for _, e := range env {
+			if e.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	mergedata := fullconfig
+	job, err := CreateJob(mergedata)
+	assert.NoError(t, err)
+	assert.Nil(t, job.Spec.Parallelism)
+	assert.Nil(t, job.Spec.Completions)
+	assert.False(t, hasEnv(job.Spec.Template.Spec.Containers[0].Env, "SHARD_COUNT"))
+
+	parallelism, completions := int32(2), int32(4)
+	mergedata.Config.Spec.JobTemplate = &gitopsv1alpha1.JobTemplate{Parallelism: &parallelism, Completions: &completions}
+	job, err = CreateJob(mergedata)
+	assert.NoError(t, err)
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	for _, spec := range []batchv1.JobSpec{job.Spec, cronjob.Spec.JobTemplate.Spec} {
+		assert.Equal(t, &parallelism, spec.Parallelism)
+		assert.Equal(t, &completions, spec.Completions)
+		env := spec.Template.Spec.Containers[0].Env
+		assert.Contains(t, env, corev1.EnvVar{Name: "SHARD_COUNT", Value: "4"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "JOB_UID", ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels['controller-uid']"},
+		}})
+		assert.True(t, hasEnv(env, "POD_NAME"))
+		assert.True(t, hasEnv(env, "JOB_NAME"))
+	}
+
+	// a single completion applies all the resources in one pod
+	completions = 1
+	job, err = CreateJob(mergedata)
+	assert.NoError(t, err)
+	assert.Equal(t, &completions, job.Spec.Completions)
+	assert.False(t, hasEnv(job.Spec.Template.Spec.Containers[0].Env, "SHARD_COUNT"))
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonnetScript = "../../template-processors/jsonnet/bin/processTemplates.sh"
+
+// jsonnetMock logs its arguments in $HOME/jsonnet.log, one per line, and evaluates to a List, an object of objects and
+// an object, nested in an array
+const jsonnetMock = `printf '%s\n' "$@" > $HOME/jsonnet.log
+echo '[{"kind": "List", "items": [{"kind": "ConfigMap", "metadata": {"name": "a"}}, {"kind": "ConfigMap", "metadata": {"name": "b"}}]},
+  {"service": {"kind": "Service", "metadata": {"name": "web"}}}, {"kind": "Deployment", "metadata": {"name": "web"}}]'
+`
+
+// jbMock logs the directories it installs the dependencies of in $HOME/jb.log
+const jbMock = `pwd >> $HOME/jb.log
+`
+
+// runJsonnet runs the processTemplates.sh of the jsonnet image in tmp, with mocks of jsonnet and jb, and the
+// parameter file values. It returns the arguments of jsonnet, one per line.
+func runJsonnet(t *testing.T, tmp string, values string, env ...string) string {
+	for _, tool := range []string{"bash", "envsubst", "jq", "yq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run processTemplates.sh", tool)
+		}
+	}
+	bin := filepath.Join(tmp, "bin")
+	manifests := filepath.Join(tmp, "manifests")
+	for _, dir := range []string{bin, filepath.Join(tmp, "templates"), filepath.Join(tmp, "parameters"), manifests} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(bin, "jsonnet"):                       "#!/usr/bin/env bash\n" + jsonnetMock,
+		filepath.Join(bin, "jb"):                            "#!/usr/bin/env bash\n" + jbMock,
+		filepath.Join(tmp, "templates", "jsonnetfile.json"): `{"version": 1, "dependencies": []}`,
+		filepath.Join(tmp, "parameters", "values.yaml"):     values,
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("bash", jsonnetScript)
+	cmd.Env = append(os.Environ(),
+		"PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"HOME="+tmp,
+		"CLONED_TEMPLATE_GIT_DIR="+filepath.Join(tmp, "templates"),
+		"CLONED_PARAMETER_GIT_DIR="+filepath.Join(tmp, "parameters"),
+		"MANIFEST_DIR="+manifests,
+		"NAMESPACE=team-a",
+		"REPLICAS=3",
+	)
+	cmd.Env = append(cmd.Env, env...)
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	return readFile(filepath.Join(tmp, "jsonnet.log"))
+}
+
+func TestJsonnetEvaluate(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+	templates := filepath.Join(tmp, "templates")
+
+	values := "name: web\nreplicas: ${REPLICAS}\nlabels:\n  tier: frontend\n"
+	assert.Equal(t, strings.Join([]string{"--jpath", filepath.Join(templates, "vendor"),
+		"--ext-str", "namespace=team-a", "--ext-str", "name=web", "--ext-code", "replicas=3",
+		"--ext-code", `labels={"tier":"frontend"}`, filepath.Join(templates, "main.jsonnet")}, "\n")+"\n",
+		runJsonnet(t, tmp, values))
+	// every object is written to its own file
+	assert.Equal(t, `{"kind":"ConfigMap","metadata":{"name":"a"}}`+"\n", readFile(filepath.Join(tmp, "manifests", "jsonnet-000.json")))
+	assert.Equal(t, `{"kind":"ConfigMap","metadata":{"name":"b"}}`+"\n", readFile(filepath.Join(tmp, "manifests", "jsonnet-001.json")))
+	assert.Equal(t, `{"kind":"Service","metadata":{"name":"web"}}`+"\n", readFile(filepath.Join(tmp, "manifests", "jsonnet-002.json")))
+	assert.Equal(t, `{"kind":"Deployment","metadata":{"name":"web"}}`+"\n", readFile(filepath.Join(tmp, "manifests", "jsonnet-003.json")))
+
+	// the parameters are top-level arguments, without the namespace, and the dependencies are installed once
+	assert.Equal(t, strings.Join([]string{"--jpath", filepath.Join(templates, "vendor"),
+		"--tla-str", "name=web", filepath.Join(templates, "app.jsonnet")}, "\n")+"\n",
+		runJsonnet(t, tmp, "name: web\n", "JSONNET_VARIABLES=TopLevel", "JSONNET_ENTRYPOINT=app.jsonnet"))
+	assert.Equal(t, templates+"\n", readFile(filepath.Join(tmp, "jb.log")))
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const kustomizeScript = "../../template-processors/kustomize/bin/processTemplates.sh"
+
+// kustomizeMock prints the directory it builds and its kustomization
+const kustomizeMock = `echo "# $*"
+cat $2/kustomization.yaml
+`
+
+// runKustomize runs the processTemplates.sh of the kustomize image in tmp, with a mock of kustomize, and returns the
+// manifests it renders
+func runKustomize(t *testing.T, tmp string, env ...string) string {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is needed to run processTemplates.sh")
+	}
+	bin := filepath.Join(tmp, "bin")
+	overlay := filepath.Join(tmp, "templates", "overlays", "prod")
+	for _, dir := range []string{bin, overlay, filepath.Join(tmp, "manifests")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(bin, "kustomize"), []byte("#!/usr/bin/env bash\n"+kustomizeMock), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(overlay, "kustomization.yaml"), []byte("namespace: prod\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", kustomizeScript)
+	cmd.Env = append(os.Environ(),
+		"PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"HOME="+tmp,
+		"CLONED_TEMPLATE_GIT_DIR="+filepath.Join(tmp, "templates"),
+		"MANIFEST_DIR="+filepath.Join(tmp, "manifests"),
+		"KUSTOMIZE_OVERLAY=overlays/prod",
+		"NAMESPACE=team-a",
+	)
+	cmd.Env = append(cmd.Env, env...)
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	return readFile(filepath.Join(tmp, "manifests", "kustomize.yaml"))
+}
+
+func TestKustomizeBuild(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	// the namespace of the overlay is kept
+	overlay := filepath.Join(tmp, "templates", "overlays", "prod")
+	assert.Equal(t, "# build "+overlay+"\nnamespace: prod\n", runKustomize(t, tmp))
+
+	// every target namespace replaces it
+	build := filepath.Join(tmp, "kustomize", "team-a")
+	assert.Equal(t, "# build "+build+"\nnamespace: team-a\nresources:\n- "+overlay+"\n", runKustomize(t, tmp, "TARGET_NAMESPACES=team-a team-b"))
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import "fmt"
+
+// ownershipConflictPolicy is what the jobs do with the resources already applied by another GitOpsConfig: Warn applies
+// them anyway and reports the conflict, Refuse fails the run before applying anything
+var ownershipConflictPolicy = "Warn"
+
+// SetOwnershipConflictPolicy configures what the jobs do when a resource they apply is managed by another
+// GitOpsConfig, so that two GitOpsConfigs don't overwrite each other's resources on every run
+func SetOwnershipConflictPolicy(policy string) error {
+	switch policy {
+	case "Warn", "Refuse":
+		ownershipConflictPolicy = policy
+		return nil
+	}
+	return fmt.Errorf("invalid ownership conflict policy %q, must be one of Warn, Refuse", policy)
+}
+
+// getConflictPolicy returns the ownership conflict policy of the jobs
+func getConflictPolicy() string {
+	return ownershipConflictPolicy
+}
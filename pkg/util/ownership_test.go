@@ -0,0 +1,99 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ownershipKubectlMock logs its calls in $HOME/kubectl.log. The live web deployment is applied by team-b/web, the
+// settings configmap by team-a/app and the data secret by no GitOpsConfig, only the ones in the manifests are found.
+const ownershipKubectlMock = `echo "$*" >> $HOME/kubectl.log
+case " $* " in
+*" config "*) ;;
+*" get --ignore-not-found -R -f "*)
+  names=$(find $HOME/manifests -type f | xargs yq -r 'select(. != null) | (.kind | ascii_downcase) + "/" + .metadata.name')
+  echo '{"kind": "List", "items": [
+    {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "annotations": {"gitopsconfig.eunomia.kohls.io/owner": "team-b/web"}}},
+    {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "settings", "annotations": {"gitopsconfig.eunomia.kohls.io/owner": "team-a/app"}}},
+    {"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "data"}}]}' | \
+    jq --arg names "$names" '.items |= map(select(((.kind | ascii_downcase) + "/" + .metadata.name) as $name | any($names | split("\n")[]; . == $name)))' ;;
+*" diff "*|*" apply "*) ;;
+*) exit 2 ;;
+esac
+`
+
+func TestSetOwnershipConflictPolicy(t *testing.T) {
+	defer SetOwnershipConflictPolicy("Warn")
+	assert.NoError(t, SetOwnershipConflictPolicy("Refuse"))
+	assert.Equal(t, "Refuse", getConflictPolicy())
+	assert.EqualError(t, SetOwnershipConflictPolicy("Ignore"), `invalid ownership conflict policy "Ignore", must be one of Warn, Refuse`)
+	assert.Equal(t, "Refuse", getConflictPolicy())
+}
+
+func TestOwnershipConflicts(t *testing.T) {
+	app := map[string]string{"app.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`}
+	data := map[string]string{"data.yaml": "apiVersion: v1\nkind: Secret\nmetadata:\n  name: data\n"}
+	tests := []struct {
+		name         string
+		manifests    map[string]string
+		gitopsconfig string
+		policy       string
+		fails        bool
+		conflicts    string
+	}{
+		{name: "warn", manifests: app, gitopsconfig: "team-a/app", conflicts: "deployment/web team-b/web\n"},
+		{name: "refuse", manifests: app, gitopsconfig: "team-a/app", policy: "Refuse", fails: true, conflicts: "deployment/web team-b/web\n"},
+		{name: "every other owner", manifests: app, gitopsconfig: "team-c/app", conflicts: "deployment/web team-b/web\nconfigmap/settings team-a/app\n"},
+		// the resources without owner are taken over
+		{name: "no conflict", manifests: data, gitopsconfig: "team-a/app", policy: "Refuse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "ownership")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, ownershipKubectlMock, tt.manifests, "Fail",
+				"GITOPSCONFIG="+tt.gitopsconfig, "OWNERSHIP_CONFLICT_POLICY="+tt.policy)
+			assert.Equal(t, tt.fails, err != nil, output)
+			assert.Equal(t, tt.conflicts, readFile(filepath.Join(tmp, "ownership-conflicts")))
+			if tt.conflicts != "" {
+				assert.Contains(t, output, "deployment/web is managed by the GitOpsConfig team-b/web too")
+			}
+			// nothing is applied when the conflicts are refused
+			assert.Equal(t, !tt.fails, strings.Contains(readFile(filepath.Join(tmp, "kubectl.log")), " apply "))
+		})
+	}
+}
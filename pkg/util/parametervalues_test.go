@@ -0,0 +1,149 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+const mergeParameterValuesScript = "../../template-processors/base/bin/mergeParameterValues.sh"
+
+// runMergeParameterValues runs mergeParameterValues.sh in tmp, with the parameter file values.yaml of the git
+// source, unless it is empty, and the keys of each valuesFrom mounted in order. It returns the merged parameters.
+func runMergeParameterValues(t *testing.T, tmp string, parameters string, valuesFrom []map[string]string, env ...string) (map[string]interface{}, string, error) {
+	for _, tool := range []string{"bash", "jq", "yq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run mergeParameterValues.sh", tool)
+		}
+	}
+	parameterDir := filepath.Join(tmp, "parameters")
+	if err := os.MkdirAll(parameterDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if parameters != "" {
+		if err := ioutil.WriteFile(filepath.Join(parameterDir, "values.yaml"), []byte(parameters), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, keys := range valuesFrom {
+		dir := filepath.Join(tmp, "parameter-values", strconv.Itoa(i))
+		if err := os.MkdirAll(filepath.Join(dir, "..data"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range keys {
+			if err := ioutil.WriteFile(filepath.Join(dir, key), []byte(value), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cmd := exec.Command("bash", mergeParameterValuesScript)
+	cmd.Env = append(os.Environ(),
+		"HOME="+tmp,
+		"CLONED_PARAMETER_GIT_DIR="+parameterDir,
+		"PARAMETER_VALUES_DIR="+filepath.Join(tmp, "parameter-values"),
+	)
+	cmd.Env = append(cmd.Env, env...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, string(output), err
+	}
+	merged := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(readFile(filepath.Join(parameterDir, "values.yaml"))), &merged); err != nil {
+		t.Fatal(err)
+	}
+	return merged, string(output), nil
+}
+
+func TestMergeParameterValuesPrecedence(t *testing.T) {
+	parameters := "replicas: 1\nimage:\n  tag: v1\nenvironment: prod\n"
+	valuesFrom := []map[string]string{
+		{"values.yaml": "replicas: 3\nimage:\n  tag: v2\n  pullPolicy: Always\n"},
+		{"password": "s3cret"},
+	}
+	tests := []struct {
+		name       string
+		precedence string
+		replicas   float64
+		tag        string
+	}{
+		{"git by default", "", 1, "v1"},
+		{"git", "Git", 1, "v1"},
+		{"values from", "ValuesFrom", 3, "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			merged, output, err := runMergeParameterValues(t, tmp, parameters, valuesFrom, "PARAMETER_VALUES_PRECEDENCE="+tt.precedence)
+			if !assert.NoError(t, err, output) {
+				return
+			}
+			assert.Equal(t, tt.replicas, merged["replicas"])
+			// the maps are merged key by key
+			assert.Equal(t, map[string]interface{}{"tag": tt.tag, "pullPolicy": "Always"}, merged["image"])
+			assert.Equal(t, "prod", merged["environment"])
+			// the keys that aren't YAML files are values
+			assert.Equal(t, "s3cret", merged["password"])
+		})
+	}
+}
+
+func TestMergeParameterValuesOrder(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	// the later valuesFrom win, there is no parameter file in git
+	valuesFrom := []map[string]string{
+		{"team.yaml": "replicas: 2\nregion: east\n"},
+		{"override.yml": "replicas: 5\n"},
+	}
+	merged, output, err := runMergeParameterValues(t, tmp, "", valuesFrom)
+	if assert.NoError(t, err, output) {
+		assert.Equal(t, map[string]interface{}{"replicas": float64(5), "region": "east"}, merged)
+	}
+}
+
+func TestMergeParameterValuesInvalid(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	_, output, err := runMergeParameterValues(t, tmp, "replicas: 1\n", []map[string]string{{"values.yaml": "- not\n- a map\n"}})
+	assert.Error(t, err)
+	assert.Contains(t, output, "parameter values must be YAML maps")
+}
+
+func TestMergeParameterValuesDisabled(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	// without valuesFrom the parameter file is left as is
+	cmd := exec.Command("bash", mergeParameterValuesScript)
+	cmd.Env = append(os.Environ(), "HOME="+tmp, "CLONED_PARAMETER_GIT_DIR="+tmp, "PARAMETER_VALUES_DIR=")
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	_, err = os.Stat(filepath.Join(tmp, "values.yaml"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"strings"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// Proxy holds the proxies the git servers are reached through, and the comma separated hosts reached directly
+type Proxy struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NOProxy    string
+}
+
+// jobProxy is the proxy of the job pods, used by the sources that don't set their own
+var jobProxy Proxy
+
+// inClusterNoProxy are the hosts never reached through a proxy: the API server and the git servers of the cluster
+var inClusterNoProxy = []string{"localhost", "127.0.0.1", ".svc", ".cluster.local"}
+
+// SetJobProxy configures the proxies set in the environment of the job pods, e.g. from the environment of the
+// operator behind a corporate proxy. The sources setting their own proxies keep them. Empty proxies leave the
+// environment of the pods unchanged.
+func SetJobProxy(proxy Proxy) {
+	jobProxy = proxy
+}
+
+// WithInClusterNoProxy returns noProxy with the hosts of the cluster appended, so that the API server and the
+// in-cluster git servers aren't reached through a proxy
+func WithInClusterNoProxy(noProxy string) string {
+	hosts := []string{}
+	for _, host := range strings.Split(noProxy, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	inCluster := append([]string{}, inClusterNoProxy...)
+	if apiServer := os.Getenv("KUBERNETES_SERVICE_HOST"); apiServer != "" {
+		inCluster = append(inCluster, apiServer)
+	}
+	for _, host := range inCluster {
+		if !containsHost(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return strings.Join(hosts, ",")
+}
+
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceProxy returns the proxies the repository of source is reached through, like its jobs do: the ones of
+// source if it sets any, the ones of the job pods otherwise. The hosts of the cluster are always reached directly.
+func SourceProxy(source v1alpha1.GitConfig) Proxy {
+	proxy := Proxy{HTTPProxy: source.HTTPProxy, HTTPSProxy: source.HTTPSProxy, NOProxy: source.NOProxy}
+	if proxy.HTTPProxy == "" && proxy.HTTPSProxy == "" {
+		proxy = jobProxy
+	}
+	if proxy.HTTPProxy == "" && proxy.HTTPSProxy == "" {
+		return proxy
+	}
+	proxy.NOProxy = WithInClusterNoProxy(proxy.NOProxy)
+	return proxy
+}
+
+// getJobProxy returns the proxies of the job pods, nil when none is set
+func getJobProxy() *Proxy {
+	if jobProxy.HTTPProxy == "" && jobProxy.HTTPSProxy == "" {
+		return nil
+	}
+	proxy := jobProxy
+	proxy.NOProxy = WithInClusterNoProxy(proxy.NOProxy)
+	return &proxy
+}
+
+// getSourceNoProxy returns the hosts the jobs clone source from without its proxies, empty when it sets neither
+// proxies nor hosts
+func getSourceNoProxy(source v1alpha1.GitConfig) string {
+	if source.HTTPProxy == "" && source.HTTPSProxy == "" && source.NOProxy == "" {
+		return ""
+	}
+	return WithInClusterNoProxy(source.NOProxy)
+}
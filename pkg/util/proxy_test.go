@@ -0,0 +1,118 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestWithInClusterNoProxy(t *testing.T) {
+	defer os.Setenv("KUBERNETES_SERVICE_HOST", os.Getenv("KUBERNETES_SERVICE_HOST"))
+	os.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+
+	tests := []struct {
+		name    string
+		noProxy string
+		want    string
+	}{
+		{"empty", "", "localhost,127.0.0.1,.svc,.cluster.local,10.0.0.1"},
+		{"hosts kept first", "mygit.com, example.com", "mygit.com,example.com,localhost,127.0.0.1,.svc,.cluster.local,10.0.0.1"},
+		{"no duplicates", ".svc,mygit.com", ".svc,mygit.com,localhost,127.0.0.1,.cluster.local,10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, WithInClusterNoProxy(tt.noProxy))
+		})
+	}
+}
+
+func TestSourceProxy(t *testing.T) {
+	defer SetJobProxy(Proxy{})
+	os.Unsetenv("KUBERNETES_SERVICE_HOST")
+
+	source := gitopsv1alpha1.GitConfig{URI: "https://mygit.com/repo"}
+	assert.Equal(t, Proxy{}, SourceProxy(source), "no proxy is set")
+
+	SetJobProxy(Proxy{HTTPSProxy: "http://corporate:3128", NOProxy: "intranet.com"})
+	assert.Equal(t, Proxy{HTTPSProxy: "http://corporate:3128", NOProxy: "intranet.com,localhost,127.0.0.1,.svc,.cluster.local"}, SourceProxy(source))
+
+	source.HTTPProxy = "http://proxy.com:8080"
+	assert.Equal(t, Proxy{HTTPProxy: "http://proxy.com:8080", NOProxy: "localhost,127.0.0.1,.svc,.cluster.local"}, SourceProxy(source), "the proxies of the source are kept")
+}
+
+// The proxies of the operator reach the environment of every job pod, the in-cluster hosts being reached directly
+func TestJobProxyReachesJob(t *testing.T) {
+	defer SetJobProxy(Proxy{})
+	os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	mergedata.Config.Spec.ParameterSource = gitopsv1alpha1.GitConfig{}
+	mergedata.Config.Spec.TemplateSource = gitopsv1alpha1.GitConfig{URI: "https://mygit.com/repo", Ref: "master"}
+
+	job, err := CreateJob(mergedata)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+		assert.NotContains(t, []string{"http_proxy", "https_proxy", "no_proxy", "HTTPS_PROXY", "TEMPLATE_GIT_NO_PROXY"}, e.Name, "no proxy is set")
+	}
+
+	SetJobProxy(Proxy{HTTPSProxy: "http://corporate:3128", NOProxy: "intranet.com"})
+	job, err = CreateJob(mergedata)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cronjob, err := CreateCronJob(mergedata)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, env := range [][]corev1.EnvVar{job.Spec.Template.Spec.Containers[0].Env, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env} {
+		assert.Contains(t, env, corev1.EnvVar{Name: "https_proxy", Value: "http://corporate:3128"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "HTTPS_PROXY", Value: "http://corporate:3128"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "no_proxy", Value: "intranet.com,localhost,127.0.0.1,.svc,.cluster.local"})
+		for _, e := range env {
+			assert.NotEqual(t, "http_proxy", e.Name)
+		}
+	}
+}
+
+// The in-cluster hosts are added to the hosts the sources setting their own proxies are cloned from directly
+func TestSourceNoProxyReachesJob(t *testing.T) {
+	os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	job, err := CreateJob(fullconfig)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cronjob, err := CreateCronJob(fullconfig)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, env := range [][]corev1.EnvVar{job.Spec.Template.Spec.Containers[0].Env, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env} {
+		assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_GIT_NO_PROXY", Value: "mygit.com,localhost,127.0.0.1,.svc,.cluster.local"})
+		assert.Contains(t, env, corev1.EnvVar{Name: "PARAMETER_GIT_NO_PROXY", Value: "mygit.com,localhost,127.0.0.1,.svc,.cluster.local"})
+	}
+}
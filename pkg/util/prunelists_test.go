@@ -0,0 +1,122 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneLists(t *testing.T) {
+	// the resources rendered for a namespace that isn't targeted anymore, deleted with the delete action
+	removed := map[string]string{
+		"web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+`,
+		"db.json": `{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": {"name": "db"}},
+  {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "db-config"}}]}`,
+	}
+	empty := map[string]string{"empty.yaml": "---\n"}
+	tests := []struct {
+		name      string
+		manifests map[string]string
+		action    string
+		blocklist string
+		allowlist string
+		pruned    string
+		skipped   string
+	}{
+		{
+			name:      "delete without lists",
+			manifests: removed,
+			action:    "delete",
+			pruned:    "statefulset/db\nconfigmap/db-config\ndeployment/web\npersistentvolumeclaim/data\n",
+		},
+		{
+			name:      "delete with a blocklist",
+			manifests: removed,
+			action:    "delete",
+			blocklist: "persistentvolumeclaim StatefulSet.apps",
+			pruned:    "configmap/db-config\ndeployment/web\n",
+			skipped:   "statefulset/db\npersistentvolumeclaim/data\n",
+		},
+		{
+			name:      "delete with an allowlist",
+			manifests: removed,
+			action:    "delete",
+			allowlist: "Deployment.apps ConfigMap StatefulSet.extensions",
+			pruned:    "configmap/db-config\ndeployment/web\n",
+			skipped:   "statefulset/db\npersistentvolumeclaim/data\n",
+		},
+		{
+			name:      "blocklist takes precedence",
+			manifests: removed,
+			action:    "delete",
+			blocklist: "ConfigMap",
+			allowlist: "ConfigMap Deployment",
+			pruned:    "deployment/web\n",
+			skipped:   "statefulset/db\nconfigmap/db-config\npersistentvolumeclaim/data\n",
+		},
+		{
+			// the web deployment applied by a previous run isn't in the manifests anymore
+			name:      "nothing allowed",
+			manifests: map[string]string{"web.yaml": "apiVersion: v1\nkind: PersistentVolumeClaim\nmetadata:\n  name: data\n"},
+			action:    "delete",
+			blocklist: "PersistentVolumeClaim",
+			pruned:    "deployment/web\n",
+			skipped:   "persistentvolumeclaim/data\n",
+		},
+		{
+			name:      "prune of an empty render",
+			manifests: empty,
+			action:    "create",
+			blocklist: "PersistentVolumeClaim",
+			pruned:    "deployment/web\n",
+			skipped:   "persistentvolumeclaim/data\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "prunelists")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManager(t, tmp, tt.manifests, "Prune",
+				"ACTION="+tt.action, "PRUNE_BLOCKLIST="+tt.blocklist, "PRUNE_ALLOWLIST="+tt.allowlist)
+			assert.NoError(t, err, output)
+			assert.Equal(t, tt.pruned, readFile(filepath.Join(tmp, "pruned")))
+			assert.Equal(t, tt.skipped, readFile(filepath.Join(tmp, "prune-skipped")))
+			if tt.skipped != "" {
+				assert.Contains(t, output, "Not deleting the resources blocked by the prune lists")
+			}
+		})
+	}
+}
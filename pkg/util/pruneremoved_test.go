@@ -0,0 +1,129 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pruneKubectlMock logs its calls in $HOME/kubectl.log. The live resources labeled as managed by eunomia are the web
+// deployment, the old configmap and the web and reader clusterroles of team-a/app, and the settings configmap of
+// team-a/other. Deleting a resource prints its name.
+const pruneKubectlMock = `echo "$*" >> $HOME/kubectl.log
+args=("$@")
+owned='"annotations": {"gitopsconfig.eunomia.kohls.io/owner": "team-a/app"}'
+case " $* " in
+*" config "*|*" diff "*|*" apply "*) ;;
+*" api-resources --namespaced=true "*) printf "deployments.apps\nconfigmaps\n" ;;
+*" api-resources --namespaced=false "*) printf "clusterroles.rbac.authorization.k8s.io\n" ;;
+*" get deployments.apps,configmaps -l app.kubernetes.io/managed-by=eunomia "*)
+  echo '{"kind": "List", "items": [
+    {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", '"$owned"'}},
+    {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "old", '"$owned"'}},
+    {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "settings", "annotations": {"gitopsconfig.eunomia.kohls.io/owner": "team-a/other"}}}]}' ;;
+*" get clusterroles.rbac.authorization.k8s.io -l app.kubernetes.io/managed-by=eunomia "*)
+  echo '{"kind": "List", "items": [
+    {"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": {"name": "web", '"$owned"'}},
+    {"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": {"name": "reader", '"$owned"'}}]}' ;;
+*" delete "*) for ((i = 0; i < $#; i++)); do if [ "${args[$i]}" == delete ]; then echo ${args[$i + 1]}; fi; done ;;
+*) exit 2 ;;
+esac
+`
+
+// pruneManifests are the web deployment and clusterrole, the old configmap and the reader clusterrole having been
+// removed from git
+var pruneManifests = map[string]string{
+	"web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: web
+`,
+}
+
+func TestPruneRemovedResources(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     []string
+		pruned  string
+		skipped string
+	}{
+		{name: "delete mode", env: []string{"DELETE_MODE=Delete"}},
+		{name: "prune", env: []string{"DELETE_MODE=Prune"}, pruned: "configmap/old\n"},
+		{name: "prune cluster resources", env: []string{"DELETE_MODE=Prune", "PRUNE_CLUSTER_RESOURCES=true"}, pruned: "configmap/old\nclusterrole/reader\n"},
+		{name: "prune blocklist", env: []string{"DELETE_MODE=Prune", "PRUNE_BLOCKLIST=ConfigMap"}, skipped: "configmap/old\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, pruneKubectlMock, pruneManifests, "", tt.env...)
+			assert.NoError(t, err, output)
+			assert.Contains(t, readFile(filepath.Join(tmp, "kubectl.log")), " apply ")
+			assert.Equal(t, tt.pruned, readFile(filepath.Join(tmp, "pruned")))
+			assert.Equal(t, tt.skipped, readFile(filepath.Join(tmp, "prune-skipped")))
+			if tt.pruned != "" {
+				assert.Equal(t, "true\n", readFile(filepath.Join(tmp, "changed")))
+				assert.Equal(t, "Prune\n", readFile(filepath.Join(tmp, "phase")))
+			}
+		})
+	}
+}
+
+func TestDeleteRemainingResources(t *testing.T) {
+	// the manifests are deleted first, the web deployment deleted with them isn't deleted twice
+	mock := strings.Replace(pruneKubectlMock, `*" delete "*)`, `*" delete -R "*) echo deployment.apps/web; echo clusterrole.rbac.authorization.k8s.io/web ;;
+*" delete "*)`, 1)
+	tests := []struct {
+		name   string
+		env    []string
+		pruned []string
+		kept   []string
+	}{
+		{name: "namespace", pruned: []string{"configmap/old"}, kept: []string{"configmap/settings", "clusterrole/reader"}},
+		{name: "cluster resources", env: []string{"PRUNE_CLUSTER_RESOURCES=true"}, pruned: []string{"configmap/old", "clusterrole/reader"}, kept: []string{"configmap/settings"}},
+		{name: "no gitopsconfig", env: []string{"GITOPSCONFIG="}, kept: []string{"configmap/old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			env := append([]string{"ACTION=delete"}, tt.env...)
+			output, err := runResourceManagerWithMock(t, tmp, mock, pruneManifests, "", env...)
+			assert.NoError(t, err, output)
+			pruned := readFile(filepath.Join(tmp, "pruned"))
+			assert.Contains(t, pruned, "deployment.apps/web\n")
+			for _, resource := range tt.pruned {
+				assert.Contains(t, pruned, resource+"\n")
+			}
+			for _, resource := range tt.kept {
+				assert.NotContains(t, pruned, resource+"\n")
+			}
+		})
+	}
+}
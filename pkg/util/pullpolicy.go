@@ -0,0 +1,69 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultImagePullPolicy is the pull policy of the template processors of the GitOpsConfigs not setting one, empty derives it from the image tag
+var defaultImagePullPolicy corev1.PullPolicy
+
+// SetDefaultImagePullPolicy configures the pull policy of the template processors of the GitOpsConfigs not setting one.
+// An empty policy derives it from the tag of the image.
+func SetDefaultImagePullPolicy(policy corev1.PullPolicy) error {
+	switch policy {
+	case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+		defaultImagePullPolicy = policy
+		return nil
+	}
+	return fmt.Errorf("invalid image pull policy %q, must be one of Always, IfNotPresent, Never", policy)
+}
+
+// getImagePullPolicy returns the pull policy of the template processor of config
+func getImagePullPolicy(config v1alpha1.GitOpsConfig) corev1.PullPolicy {
+	if config.Spec.ImagePullPolicy != "" {
+		return config.Spec.ImagePullPolicy
+	}
+	if defaultImagePullPolicy != "" {
+		return defaultImagePullPolicy
+	}
+	return imagePullPolicyForTag(config.Spec.TemplateProcessorImage)
+}
+
+// imagePullPolicyForTag returns Always for the images whose tag can move, i.e. latest or no tag,
+// and IfNotPresent for the images pinned to a tag or a digest, as Kubernetes defaults it
+func imagePullPolicyForTag(image string) corev1.PullPolicy {
+	if IsPinnedImage(image) {
+		return corev1.PullIfNotPresent
+	}
+	return corev1.PullAlways
+}
+
+// IsPinnedImage returns true if image is pinned to a digest or to a tag other than latest
+func IsPinnedImage(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+	return i >= 0 && name[i+1:] != "latest"
+}
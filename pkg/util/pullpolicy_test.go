@@ -0,0 +1,85 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestImagePullPolicyForTag(t *testing.T) {
+	tests := []struct {
+		image string
+		want  corev1.PullPolicy
+	}{
+		{"myimage", corev1.PullAlways},
+		{"myimage:latest", corev1.PullAlways},
+		{"quay.io/kohlstechnology/eunomia-helm", corev1.PullAlways},
+		{"quay.io/kohlstechnology/eunomia-helm:latest", corev1.PullAlways},
+		{"registry.local:5000/eunomia-helm", corev1.PullAlways},
+		{"registry.local:5000/eunomia-helm:latest", corev1.PullAlways},
+		{"quay.io/kohlstechnology/eunomia-helm:v0.0.3", corev1.PullIfNotPresent},
+		{"registry.local:5000/eunomia-helm:v0.0.3", corev1.PullIfNotPresent},
+		{"quay.io/kohlstechnology/eunomia-helm@sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2", corev1.PullIfNotPresent},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, imagePullPolicyForTag(tt.image), tt.image)
+	}
+}
+
+func TestImagePullPolicyReachesJob(t *testing.T) {
+	defer SetDefaultImagePullPolicy("")
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		image    string
+		policy   corev1.PullPolicy
+		operator corev1.PullPolicy
+		want     corev1.PullPolicy
+	}{
+		{"mutable tag", "myimage:latest", "", "", corev1.PullAlways},
+		{"pinned tag", "myimage:v1", "", "", corev1.PullIfNotPresent},
+		{"operator default", "myimage:v1", "", corev1.PullAlways, corev1.PullAlways},
+		{"configuration", "myimage:latest", corev1.PullNever, corev1.PullAlways, corev1.PullNever},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, SetDefaultImagePullPolicy(tt.operator))
+			mergedata := fullconfig
+			mergedata.Config.Spec.TemplateProcessorImage = tt.image
+			mergedata.Config.Spec.ImagePullPolicy = tt.policy
+			job, err := CreateJob(mergedata)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, job.Spec.Template.Spec.Containers[0].ImagePullPolicy)
+			cronjob, err := CreateCronJob(mergedata)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].ImagePullPolicy)
+		})
+	}
+}
+
+func TestSetDefaultImagePullPolicy(t *testing.T) {
+	defer SetDefaultImagePullPolicy("")
+	assert.NoError(t, SetDefaultImagePullPolicy(corev1.PullIfNotPresent))
+	assert.Error(t, SetDefaultImagePullPolicy("Sometimes"))
+	// an invalid policy keeps the previous one
+	assert.Equal(t, corev1.PullIfNotPresent, defaultImagePullPolicy)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const quotaPreflightScript = "../../template-processors/base/bin/quotaPreflight.sh"
+
+// quota is a ResourceQuota of the team-a namespace allowing 2 cores, 4Gi and 10 pods, with 1 core, 1Gi and 2 pods used
+const quota = `{"kind": "List", "items": [{"kind": "ResourceQuota", "metadata": {"name": "compute", "namespace": "team-a"},
+  "status": {"hard": {"requests.cpu": "2", "requests.memory": "4Gi", "pods": "10"}, "used": {"requests.cpu": "1", "requests.memory": "1Gi", "pods": "2"}}}]}`
+
+// deployment returns the manifest of a deployment of replicas pods, each requesting cpu
+func deployment(replicas int, cpu string) string {
+	return fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  replicas: %d
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: nginx
+        resources:
+          requests:
+            cpu: %s
+            memory: 256Mi
+      - name: sidecar
+        image: envoy
+        resources:
+          limits:
+            cpu: 100m
+`, replicas, cpu)
+}
+
+// runQuotaPreflight runs quotaPreflight.sh on the manifest in tmp, with a mock of kubectl
+// returning quotas and the live objects, returning the output
+func runQuotaPreflight(t *testing.T, tmp, manifest, quotas, live string) (string, error) {
+	for _, tool := range []string{"bash", "jq", "yq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run quotaPreflight.sh", tool)
+		}
+	}
+	manifests := filepath.Join(tmp, "manifests")
+	err := os.Mkdir(manifests, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(manifests, "frontend.yaml"), []byte(manifest), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubectl := filepath.Join(tmp, "kubectl")
+	mock := `#!/usr/bin/env bash
+case "$*" in
+  *"get resourcequota -n team-a -o json"*) echo '` + quotas + `' ;;
+  *"get -R -f ` + manifests + ` -n team-a -o json --ignore-not-found"*) echo '` + live + `' ;;
+  *) exit 2 ;;
+esac`
+	err = ioutil.WriteFile(kubectl, []byte(mock), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("bash", quotaPreflightScript)
+	cmd.Env = append(os.Environ(), "kubectl="+kubectl, "HOME="+tmp, "MANIFEST_DIR="+manifests, "NAMESPACE=team-a")
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestQuotaPreflight(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		quotas   string
+		live     string
+		exceeded []string
+	}{
+		{name: "fits", manifest: deployment(3, "200m"), quotas: quota},
+		{
+			name:     "exceeds",
+			manifest: deployment(4, "250m"),
+			quotas:   quota,
+			exceeded: []string{"ResourceQuota compute: requests.cpu would reach 2400m over its hard limit of 2"},
+		},
+		{
+			name:     "exceeds several",
+			manifest: deployment(13, "1m"),
+			quotas:   quota,
+			exceeded: []string{
+				"ResourceQuota compute: requests.cpu would reach 2313m over its hard limit of 2",
+				"ResourceQuota compute: requests.memory would reach 4563402752 over its hard limit of 4Gi",
+				"ResourceQuota compute: pods would reach 15 over its hard limit of 10",
+			},
+		},
+		{
+			// the 4 pods of 250m replace the 2 live pods of 500m, which the quota already counts
+			name:     "replaces live objects",
+			manifest: deployment(4, "150m"),
+			quotas:   quota,
+			live:     `{"kind": "Deployment", "spec": {"replicas": 2, "template": {"spec": {"containers": [{"resources": {"requests": {"cpu": "400m", "memory": "256Mi"}, "limits": {"cpu": "100m"}}}]}}}}`,
+		},
+		{name: "no quota", manifest: deployment(100, "1"), quotas: `{"kind": "List", "items": []}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+			output, err := runQuotaPreflight(t, tmp, tt.manifest, tt.quotas, tt.live)
+			if len(tt.exceeded) == 0 {
+				assert.NoError(t, err, output)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, output, "nothing is applied")
+			for _, exceeded := range tt.exceeded {
+				assert.Contains(t, output, exceeded)
+			}
+		})
+	}
+}
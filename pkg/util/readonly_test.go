@@ -0,0 +1,77 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readOnlyMock is a mock of kubectl logging each of its calls in $HOME/kubectl.log, reporting web as drifted
+const readOnlyMock = `echo "$*" >> $HOME/kubectl.log
+case " $* " in
+*" diff "*)
+  echo "diff -u -N /tmp/LIVE-1/apps.v1.Deployment.team-a.web /tmp/MERGED-1/apps.v1.Deployment.team-a.web"
+  exit 1 ;;
+esac
+`
+
+func TestReadOnlyVerbs(t *testing.T) {
+	manifests := map[string]string{
+		"a-web.yaml":    modeManifest("Deployment", "web", ""),
+		"b-config.yaml": modeManifest("ConfigMap", "config", "CreateOrUpdate"),
+	}
+	tests := []struct {
+		name  string
+		env   []string
+		diffs bool
+	}{
+		{name: "CreateOrMerge", env: []string{"CREATE_MODE=CreateOrMerge"}, diffs: true},
+		{name: "CreateOrUpdate", env: []string{"CREATE_MODE=CreateOrUpdate"}, diffs: true},
+		{name: "Patch", env: []string{"CREATE_MODE=Patch"}, diffs: true},
+		{name: "ServerSideApply", env: []string{"CREATE_MODE=ServerSideApply"}, diffs: true},
+		{name: "Prune", env: []string{"DELETE_MODE=Prune"}, diffs: true},
+		{name: "delete action", env: []string{"ACTION=delete"}},
+		{name: "delete action with Prune", env: []string{"ACTION=delete", "DELETE_MODE=Prune"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, readOnlyMock, manifests, "Fail", append(tt.env, "READ_ONLY=true")...)
+			assert.NoError(t, err, output)
+
+			calls := strings.Split(strings.TrimSpace(readFile(filepath.Join(tmp, "kubectl.log"))), "\n")
+			diffed := false
+			for _, call := range calls {
+				for _, verb := range []string{"apply", "create", "replace", "delete", "patch", "update", "label", "annotate", "scale"} {
+					assert.NotContains(t, " "+call+" ", " "+verb+" ", "READ_ONLY must not modify the resources")
+				}
+				diffed = diffed || strings.Contains(" "+call+" ", " diff ")
+			}
+			assert.Equal(t, tt.diffs, diffed, calls)
+			if tt.diffs {
+				assert.Contains(t, readFile(filepath.Join(tmp, "drifted")), "apps.v1.Deployment.team-a.web")
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// immutableApplyMock is a mock of kubectl failing with APPLY_ERROR to apply the files named in FAILING until they are
+// deleted, the manifest directory applied at once failing like them, and logging the applies and deletions in
+// $HOME/calls
+const immutableApplyMock = `file=""
+previous=""
+for arg in "$@"; do
+  if [ "$previous" == "-f" ]; then
+    file=$arg
+  fi
+  previous=$arg
+done
+name=$(basename "$file" .yaml)
+if [ -d "$file" ]; then
+  name=$FAILING
+fi
+case " $* " in
+*" apply "*)
+  if [[ " $FAILING " == *" $name "* ]] && [ ! -f $HOME/deleted-$name ]; then
+    echo "$APPLY_ERROR" >&2
+    exit 1
+  fi
+  echo "apply $name" >> $HOME/calls ;;
+*" delete "*)
+  touch $HOME/deleted-$name
+  echo "delete $name" >> $HOME/calls ;;
+*" get "*)
+  if [ -n "$file" ]; then
+    echo "service/$name"
+  fi ;;
+esac
+`
+
+func TestRecreateImmutableResources(t *testing.T) {
+	const (
+		clusterIP   = `The Service "web" is invalid: spec.clusterIP: Invalid value: "": field is immutable`
+		statefulSet = `The StatefulSet "db" is invalid: spec: Forbidden: updates to statefulset spec for fields other than 'replicas', 'template', 'updateStrategy' and 'minReadySeconds' are forbidden`
+		claim       = `The PersistentVolumeClaim "data" is invalid: spec: Forbidden: is immutable after creation except resources.requests for bound claims`
+		conflict    = `Error from server (Conflict): error when applying patch: Operation cannot be fulfilled on services "web": the object has been modified; please apply your changes to the latest version and try again`
+		invalid     = `The Service "web" is invalid: spec.ports[0].port: Invalid value: 0: must be between 1 and 65535, inclusive`
+		mentioned   = `Error from server (NotFound): configmaps "immutable-settings" not found`
+	)
+	annotated := "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  annotations:\n    gitopsconfig.eunomia.kohls.io/allow-recreate: \"true\"\n"
+	plain := "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"
+	tests := []struct {
+		name      string
+		manifest  string
+		env       []string
+		fails     bool
+		recreated string
+	}{
+		{"allowRecreate", plain, []string{"ALLOW_RECREATE=true", "APPLY_ERROR=" + clusterIP}, false, "service/web\n"},
+		{"statefulset", plain, []string{"ALLOW_RECREATE=true", "APPLY_ERROR=" + statefulSet}, false, "service/web\n"},
+		{"persistent volume claim", plain, []string{"ALLOW_RECREATE=true", "APPLY_ERROR=" + claim}, false, "service/web\n"},
+		{"annotation", annotated, []string{"APPLY_ERROR=" + clusterIP}, false, "service/web\n"},
+		{"not allowed", plain, []string{"APPLY_ERROR=" + clusterIP}, true, ""},
+		{"annotation set to false", "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  annotations:\n    gitopsconfig.eunomia.kohls.io/allow-recreate: \"false\"\n",
+			[]string{"APPLY_ERROR=" + clusterIP}, true, ""},
+		// all the objects of the file must have the annotation
+		{"partially annotated file", annotated + "---\n" + waveManifest("ConfigMap", "web-config", ""), []string{"APPLY_ERROR=" + clusterIP}, true, ""},
+		// the other failures never recreate the resources
+		{"conflict", plain, []string{"ALLOW_RECREATE=true", "APPLY_ERROR=" + conflict}, true, ""},
+		{"invalid value", annotated, []string{"APPLY_ERROR=" + invalid}, true, ""},
+		{"immutable in a name", plain, []string{"ALLOW_RECREATE=true", "APPLY_ERROR=" + mentioned}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "recreate")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			manifests := map[string]string{"web.yaml": tt.manifest, "db.yaml": waveManifest("Deployment", "db", "")}
+			output, err := runResourceManagerWithMock(t, tmp, immutableApplyMock, manifests, "Fail", append(tt.env, "FAILING=web")...)
+			assert.Equal(t, tt.fails, err != nil, output)
+			recreated, _ := ioutil.ReadFile(filepath.Join(tmp, "recreated"))
+			assert.Equal(t, tt.recreated, string(recreated))
+			calls := readFile(filepath.Join(tmp, "calls"))
+			if tt.recreated != "" {
+				assert.Contains(t, output, "Recreating")
+				// the resources are recreated once the other files are applied
+				assert.Regexp(t, "apply db\n(.*\n)*delete web\napply web\n", calls)
+			} else {
+				assert.NotContains(t, calls, "delete")
+			}
+		})
+	}
+}
+
+func TestAllowRecreateReachesScript(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	clusterIP := `The Service "web" is invalid: spec.clusterIP: Invalid value: "": field is immutable`
+	for _, allowRecreate := range []bool{false, true} {
+		mergedata := fullconfig
+		mergedata.Config.Spec.AllowRecreate = allowRecreate
+		job, err := CreateJob(mergedata)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var env []string
+		for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+			if e.Name == "ALLOW_RECREATE" {
+				env = append(env, e.Name+"="+e.Value)
+			}
+		}
+		assert.Len(t, env, 1)
+
+		tmp := tempDir(t)
+		defer os.RemoveAll(tmp)
+		manifests := map[string]string{"web.yaml": waveManifest("Service", "web", ""), "db.yaml": waveManifest("Deployment", "db", "")}
+		output, err := runResourceManagerWithMock(t, tmp, immutableApplyMock, manifests, "Fail", append(env, "FAILING=web", "APPLY_ERROR="+clusterIP)...)
+		calls := readFile(filepath.Join(tmp, "calls"))
+		if allowRecreate {
+			// the immutable change is recreated under the flag, once the other files are applied
+			assert.NoError(t, err, output)
+			assert.Equal(t, "service/web\n", readFile(filepath.Join(tmp, "recreated")))
+			assert.Regexp(t, "apply db\n(.*\n)*delete web\napply web\n", calls)
+		} else {
+			// and fails without it, leaving the resource in place
+			assert.Error(t, err, output)
+			assert.Contains(t, output, "field is immutable")
+			assert.NotContains(t, calls, "delete")
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"strings"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// clusterDeniedKinds are the kinds of resources no GitOpsConfig may apply, e.g. ClusterRoleBinding.rbac.authorization.k8s.io
+var clusterDeniedKinds []string
+
+// SetDeniedResourceKinds configures the kinds of resources, optionally qualified by their group, that the jobs of
+// every GitOpsConfig skip, on top of the deniedResourceKinds of the GitOpsConfig
+func SetDeniedResourceKinds(kinds []string) {
+	clusterDeniedKinds = []string{}
+	for _, kind := range kinds {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			clusterDeniedKinds = append(clusterDeniedKinds, kind)
+		}
+	}
+}
+
+// HasClusterDeniedKinds returns true if the operator denies kinds to every GitOpsConfig
+func HasClusterDeniedKinds() bool {
+	return len(clusterDeniedKinds) > 0
+}
+
+// ClusterDeniedKind returns the kind denied by the operator that kind, optionally qualified by its group, may match,
+// empty if there is none. An unqualified kind matches the kind in every group.
+func ClusterDeniedKind(kind string) string {
+	for _, denied := range clusterDeniedKinds {
+		if kindsOverlap(kind, denied) {
+			return denied
+		}
+	}
+	return ""
+}
+
+// kindsOverlap returns true if the kinds a and b, optionally qualified by their group, may match the same resources,
+// ignoring the case
+func kindsOverlap(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	aKind, aGroup := splitKind(a)
+	bKind, bGroup := splitKind(b)
+	if aKind != bKind {
+		return false
+	}
+	return aGroup == "" || bGroup == "" || aGroup == bGroup
+}
+
+// splitKind splits a kind qualified by its group, e.g. StatefulSet.apps, into the kind and the group
+func splitKind(kind string) (string, string) {
+	if i := strings.Index(kind, "."); i >= 0 {
+		return kind[:i], kind[i+1:]
+	}
+	return kind, ""
+}
+
+// getDeniedResourceKinds returns the kinds of resources the jobs of config skip: its deniedResourceKinds and the ones
+// denied by the operator
+func getDeniedResourceKinds(config v1alpha1.GitOpsConfig) []string {
+	kinds := append([]string{}, config.Spec.DeniedResourceKinds...)
+	for _, denied := range clusterDeniedKinds {
+		listed := false
+		for _, kind := range kinds {
+			listed = listed || strings.EqualFold(kind, denied)
+		}
+		if !listed {
+			kinds = append(kinds, denied)
+		}
+	}
+	return kinds
+}
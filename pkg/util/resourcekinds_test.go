@@ -0,0 +1,154 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceKinds(t *testing.T) {
+	manifests := map[string]string{
+		"web.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: token
+`,
+		"db.json": `{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": {"name": "db"}},
+  {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "db-config"}}]}`,
+		"rbac.yaml": `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: admin
+`,
+	}
+	tests := []struct {
+		name     string
+		allowed  string
+		denied   string
+		applied  string
+		skipped  string
+		noFileOf string
+	}{
+		{
+			name:    "without lists",
+			applied: "clusterrolebinding/admin configmap/db-config deployment/web secret/token statefulset/db",
+		},
+		{
+			name:     "allowed kinds",
+			allowed:  "Deployment.apps configmap StatefulSet.extensions",
+			applied:  "configmap/db-config deployment/web",
+			skipped:  "statefulset/db\nclusterrolebinding/admin\nsecret/token\n",
+			noFileOf: "rbac.yaml",
+		},
+		{
+			name:    "denied kinds",
+			denied:  "Secret StatefulSet.apps",
+			applied: "clusterrolebinding/admin configmap/db-config deployment/web",
+			skipped: "statefulset/db\nsecret/token\n",
+		},
+		{
+			name:     "denied kinds take precedence",
+			allowed:  "Deployment ConfigMap Secret",
+			denied:   "secret",
+			applied:  "configmap/db-config deployment/web",
+			skipped:  "statefulset/db\nclusterrolebinding/admin\nsecret/token\n",
+			noFileOf: "rbac.yaml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "resourcekinds")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManager(t, tmp, manifests, "Fail",
+				"ALLOWED_RESOURCE_KINDS="+tt.allowed, "DENIED_RESOURCE_KINDS="+tt.denied)
+			assert.NoError(t, err, output)
+			assert.Equal(t, tt.skipped, readFile(filepath.Join(tmp, "kinds-skipped")))
+			if tt.skipped != "" {
+				assert.Contains(t, output, "its kind is not allowed")
+			}
+			assert.Equal(t, tt.applied, renderedObjects(t, filepath.Join(tmp, "manifests")))
+			if tt.noFileOf != "" {
+				_, err = os.Stat(filepath.Join(tmp, "manifests", tt.noFileOf))
+				assert.True(t, os.IsNotExist(err), "the file left empty is removed")
+			}
+		})
+	}
+}
+
+func TestResourceKindsNotPruned(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "resourcekinds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// the data persistentvolumeclaim applied by a previous run isn't rendered anymore, its kind is denied since
+	web := map[string]string{"web.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n"}
+	output, err := runResourceManager(t, tmp, web, "Fail", "DELETE_MODE=Prune", "DENIED_RESOURCE_KINDS=PersistentVolumeClaim")
+	assert.NoError(t, err, output)
+	assert.Equal(t, "", readFile(filepath.Join(tmp, "pruned")))
+	assert.Equal(t, "persistentvolumeclaim/data\n", readFile(filepath.Join(tmp, "prune-skipped")))
+}
+
+// renderedObjects returns the sorted kind/name of the objects left in the manifests of dir
+func renderedObjects(t *testing.T, dir string) string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := append([]string{"-r", `select(. != null) | if .kind == "List" then .items[] else . end | (.kind | ascii_downcase) + "/" + .metadata.name`}, files...)
+	output, err := exec.Command("yq", args...).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := strings.Fields(string(output))
+	sort.Strings(objects)
+	return strings.Join(objects, " ")
+}
+
+func TestDeniedResourceKinds(t *testing.T) {
+	defer SetDeniedResourceKinds(nil)
+	config := v1alpha1.GitOpsConfig{Spec: v1alpha1.GitOpsConfigSpec{DeniedResourceKinds: []string{"Secret"}}}
+	assert.Equal(t, []string{"Secret"}, getDeniedResourceKinds(config))
+
+	SetDeniedResourceKinds([]string{" secret", "ClusterRoleBinding.rbac.authorization.k8s.io", ""})
+	assert.Equal(t, []string{"Secret", "ClusterRoleBinding.rbac.authorization.k8s.io"}, getDeniedResourceKinds(config))
+	assert.Equal(t, "ClusterRoleBinding.rbac.authorization.k8s.io", ClusterDeniedKind("clusterrolebinding"))
+	assert.Equal(t, "ClusterRoleBinding.rbac.authorization.k8s.io", ClusterDeniedKind("ClusterRoleBinding.rbac.authorization.k8s.io"))
+	assert.Equal(t, "", ClusterDeniedKind("ClusterRoleBinding.other.io"))
+	assert.Equal(t, "secret", ClusterDeniedKind("Secret.core"))
+	assert.Equal(t, "", ClusterDeniedKind("ConfigMap"))
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// IsScheduledTrigger returns true if the triggers of type triggerType run the configuration on a schedule, with
+// a CronJob
+func IsScheduledTrigger(triggerType string) bool {
+	return triggerType == "Periodic" || triggerType == "Time"
+}
+
+// ScheduleTrigger returns the first trigger of config running it on a schedule, nil if it has none
+func ScheduleTrigger(config v1alpha1.GitOpsConfig) *v1alpha1.GitOpsTrigger {
+	for i, trigger := range config.Spec.Triggers {
+		if IsScheduledTrigger(trigger.Type) {
+			return &config.Spec.Triggers[i]
+		}
+	}
+	return nil
+}
+
+// CronSchedule returns the cron expression of the CronJob of a scheduled trigger: its cron, or its interval
+// converted to a cron expression
+func CronSchedule(trigger v1alpha1.GitOpsTrigger) (string, error) {
+	if trigger.Interval == nil {
+		if trigger.Cron == "" {
+			return "", fmt.Errorf("the %s trigger must set a cron or an interval", trigger.Type)
+		}
+		return trigger.Cron, nil
+	}
+	if trigger.Cron != "" {
+		return "", fmt.Errorf("the %s trigger can't set both a cron and an interval", trigger.Type)
+	}
+	interval := trigger.Interval.Duration
+	if interval <= 0 || interval%time.Minute != 0 {
+		return "", fmt.Errorf("the interval %s of the %s trigger must be a positive number of minutes", interval, trigger.Type)
+	}
+	minutes := int(interval / time.Minute)
+	hours := minutes / 60
+	switch {
+	case minutes == 1:
+		return "* * * * *", nil
+	case minutes < 60 && 60%minutes == 0:
+		return fmt.Sprintf("*/%d * * * *", minutes), nil
+	case minutes%60 != 0:
+	case hours == 1:
+		return "0 * * * *", nil
+	case hours < 24 && 24%hours == 0:
+		return fmt.Sprintf("0 */%d * * *", hours), nil
+	case hours == 24:
+		return "0 0 * * *", nil
+	}
+	return "", fmt.Errorf("the interval %s of the %s trigger must divide an hour or a day", interval, trigger.Type)
+}
+
+// getCron returns the schedule of the CronJob of config, empty if it has no valid scheduled trigger
+func getCron(config v1alpha1.GitOpsConfig) string {
+	trigger := ScheduleTrigger(config)
+	if trigger == nil {
+		return ""
+	}
+	schedule, err := CronSchedule(*trigger)
+	if err != nil {
+		log.Error(err, "invalid schedule", "config", config.GetName())
+		return ""
+	}
+	return schedule
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCronSchedule(t *testing.T) {
+	interval := func(d time.Duration) *metav1.Duration {
+		return &metav1.Duration{Duration: d}
+	}
+	tests := []struct {
+		name     string
+		trigger  gitopsv1alpha1.GitOpsTrigger
+		schedule string
+		wantErr  bool
+	}{
+		{"cron", gitopsv1alpha1.GitOpsTrigger{Type: "Periodic", Cron: "0 * * * *"}, "0 * * * *", false},
+		{"every minute", gitopsv1alpha1.GitOpsTrigger{Type: "Time", Interval: interval(time.Minute)}, "* * * * *", false},
+		{"minutes", gitopsv1alpha1.GitOpsTrigger{Type: "Time", Interval: interval(15 * time.Minute)}, "*/15 * * * *", false},
+		{"hourly", gitopsv1alpha1.GitOpsTrigger{Type: "Time", Interval: interval(time.Hour)}, "0 * * * *", false},
+		{"hours", gitopsv1alpha1.GitOpsTrigger{Type: "Time", Interval: interval(6 * time.Hour)}, "0 */6 * * *", false},
+		{"daily", gitopsv1alpha1.GitOpsTrigger{Type: "Periodic", Interval: interval(24 * time.Hour)}, "0 0 * * *", false},
+		{"minutes not dividing an hour", gitopsv1alpha1.GitOpsTrigger{Type: "Time", Interval: interval(45 * time.Minute)}, "", true},
+		{"hours not dividing a day", gitopsv1alpha1.GitOpsTrigger{Type: "Time", Interval: interval(5 * time.Hour)}, "", true},
+		{"not whole minutes", gitopsv1alpha1.GitOpsTrigger{Type: "Time", Interval: interval(90 * time.Second)}, "", true},
+		{"cron and interval", gitopsv1alpha1.GitOpsTrigger{Type: "Time", Cron: "0 * * * *", Interval: interval(time.Hour)}, "", true},
+		{"no schedule", gitopsv1alpha1.GitOpsTrigger{Type: "Time"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := CronSchedule(tt.trigger)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.schedule, schedule)
+		})
+	}
+}
+
+func TestScheduleTrigger(t *testing.T) {
+	config := gitopsv1alpha1.GitOpsConfig{}
+	assert.Nil(t, ScheduleTrigger(config))
+	config.Spec.Triggers = []gitopsv1alpha1.GitOpsTrigger{{Type: "Webhook"}, {Type: "Time", Cron: "*/5 * * * *"}}
+	if assert.NotNil(t, ScheduleTrigger(config)) {
+		assert.Equal(t, "Time", ScheduleTrigger(config).Type)
+	}
+	assert.Equal(t, "*/5 * * * *", getCron(config))
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// secretKubectlMock logs its calls in $HOME/kubectl.log. The web-db Secret has a user and a password, the api Secret a
+// multi-line token, and the other Secrets don't exist. Its apply echoes the values it was given, like an error would.
+const secretKubectlMock = `echo "$*" >> $HOME/kubectl.log
+case " $* " in
+*" get secret web-db "*) echo '{"kind": "Secret", "data": {"user": "YWRtaW4=", "password": "cEBzcyJ3OnJk"}}' ;;
+*" get secret api "*) echo '{"kind": "Secret", "data": {"token": "bGluZSAxCmxpbmUgMg=="}}' ;;
+*" get secret "*) echo 'Error from server (NotFound): secrets not found' >&2; exit 1 ;;
+*" apply "*) cat $HOME/manifests/*; cat $HOME/manifests/* >&2 ;;
+*" config "*|*" diff "*) ;;
+*) exit 2 ;;
+esac
+`
+
+// secretManifests reference the keys of the web-db and api Secrets
+var secretManifests = map[string]string{
+	"web.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  url: postgres://${secret:web-db/user}:${secret:web-db/password}@db:5432/web
+  motd: no secret here
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: api
+stringData:
+  token: ${secret:api/token}
+`,
+}
+
+// readManifests decodes the objects of the manifest file
+func readManifests(t *testing.T, path string) []unstructured.Unstructured {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	objects := []unstructured.Unstructured{}
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		object := unstructured.Unstructured{}
+		if err := decoder.Decode(&object.Object); err == io.EOF {
+			return objects
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if object.Object != nil {
+			objects = append(objects, object)
+		}
+	}
+}
+
+func TestInjectSecrets(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	output, err := runResourceManagerWithMock(t, tmp, secretKubectlMock, secretManifests, "")
+	assert.NoError(t, err, output)
+	objects := readManifests(t, filepath.Join(tmp, "manifests", "web.yaml"))
+	if assert.Len(t, objects, 2) {
+		data, _, _ := unstructured.NestedStringMap(objects[0].Object, "data")
+		assert.Equal(t, map[string]string{"url": `postgres://admin:p@ss"w:rd@db:5432/web`, "motd": "no secret here"}, data)
+		token, _, _ := unstructured.NestedString(objects[1].Object, "stringData", "token")
+		assert.Equal(t, "line 1\nline 2", token)
+	}
+	// the Secrets are read from the namespace the resources are applied into
+	assert.Contains(t, readFile(filepath.Join(tmp, "kubectl.log")), "get secret api -o json")
+	assert.Contains(t, output, "Injected the values of 3 secret keys into the manifests")
+
+	// the values never reach the logs, whether printed on the standard output or error
+	for _, value := range []string{"admin", `p@ss"w:rd`, "line 1", "line 2"} {
+		assert.NotContains(t, output, value)
+	}
+	assert.Contains(t, output, "postgres://***:***@db:5432/web")
+}
+
+func TestInjectSecretsMissing(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	manifests := map[string]string{
+		"web.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  user: ${secret:web-db/user}
+  replica: ${secret:web-db/replica-password}
+  cache: ${secret:cache/password}
+`,
+	}
+	output, err := runResourceManagerWithMock(t, tmp, secretKubectlMock, manifests, "")
+	assert.Error(t, err)
+	assert.Contains(t, output, "Unable to inject the secret placeholders of the manifests, missing in team-a: Secret cache, key replica-password of Secret web-db")
+	assert.NotContains(t, output, "admin")
+	assert.Equal(t, "Secrets\n", readFile(filepath.Join(tmp, "phase")))
+	// nothing is applied, the manifests keep their placeholders
+	assert.NotContains(t, readFile(filepath.Join(tmp, "kubectl.log")), " apply ")
+	assert.Contains(t, readFile(filepath.Join(tmp, "manifests", "web.yaml")), "${secret:web-db/user}")
+}
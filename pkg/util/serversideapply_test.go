@@ -0,0 +1,181 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fieldConflictMock is a mock of kubectl whose server-side applies of the files named in CONFLICTING fail on CONFLICTS
+// fields owned by the horizontal pod autoscaler unless they force the conflicts, the manifest directory applied at once
+// failing like them, and logging the applies in $HOME/applies. The applies of the files named in INVALID fail on an
+// invalid value, forced or not.
+const fieldConflictMock = `file=""
+previous=""
+for arg in "$@"; do
+  if [ "$previous" == "-f" ]; then
+    file=$arg
+  fi
+  previous=$arg
+done
+name=$(basename "$file" .yaml)
+if [ -d "$file" ]; then
+  name=${CONFLICTING:-}
+fi
+case " $* " in
+*" apply "*)
+  echo "$*" >> $HOME/applies
+  if [[ " $* " == *" --server-side "* ]] && [[ " $* " != *" --force-conflicts "* ]] && [ -n "$name" ] && [[ " ${CONFLICTING:-} " == *" $name "* ]]; then
+    if [ "${CONFLICTS:-1}" -gt 1 ]; then
+      echo "error: Apply failed with $CONFLICTS conflicts: conflicts with \"horizontal-pod-autoscaler\" using apps/v1:" >&2
+    else
+      echo 'error: Apply failed with 1 conflict: conflict with "horizontal-pod-autoscaler" using apps/v1: .spec.replicas' >&2
+    fi
+    exit 1
+  fi
+  if [ -n "$name" ] && [[ " ${INVALID:-} " == *" $name "* ]]; then
+    echo "The Deployment \"$name\" is invalid: spec.template.spec.containers[0].ports[1].containerPort: Duplicate value: conflicting port 8080" >&2
+    exit 1
+  fi ;;
+*" get "*)
+  if [ -n "$file" ]; then
+    echo "deployment.apps/$name"
+  fi ;;
+esac
+`
+
+func TestServerSideApplyConflicts(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          []string
+		fails        bool
+		serverSide   bool
+		forceApplied string
+	}{
+		{"client-side apply", []string{"CREATE_MODE=CreateOrMerge", "CONFLICTING=web"}, false, false, ""},
+		{"mode", []string{"CREATE_MODE=ServerSideApply"}, false, true, ""},
+		{"flag", []string{"CREATE_MODE=CreateOrMerge", "SERVER_SIDE_APPLY=true"}, false, true, ""},
+		// the fields owned by other controllers aren't taken over
+		{"conflict", []string{"CREATE_MODE=ServerSideApply", "CONFLICTING=web"}, true, true, ""},
+		{"forced conflict", []string{"CREATE_MODE=ServerSideApply", "CONFLICTING=web", "FORCE_CONFLICTS=true"}, false, true, "deployment.apps/web\n"},
+		{"forced conflict with the flag", []string{"CREATE_MODE=CreateOrMerge", "SERVER_SIDE_APPLY=true", "CONFLICTING=web", "FORCE_CONFLICTS=true"}, false, true, "deployment.apps/web\n"},
+		{"several conflicts", []string{"CREATE_MODE=ServerSideApply", "CONFLICTING=web", "CONFLICTS=2", "FORCE_CONFLICTS=true"}, false, true, "deployment.apps/web\n"},
+		// only the field conflicts are forced
+		{"other failure", []string{"CREATE_MODE=ServerSideApply", "INVALID=web", "FORCE_CONFLICTS=true"}, true, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			manifests := map[string]string{"web.yaml": waveManifest("Deployment", "web", ""), "db.yaml": waveManifest("Deployment", "db", "")}
+			output, err := runResourceManagerWithMock(t, tmp, fieldConflictMock, manifests, "Fail", tt.env...)
+			assert.Equal(t, tt.fails, err != nil, output)
+			applies := readFile(filepath.Join(tmp, "applies"))
+			if tt.serverSide {
+				assert.Contains(t, applies, "apply --server-side")
+			} else {
+				assert.NotContains(t, applies, "--server-side")
+			}
+			assert.Contains(t, applies, "--field-manager=eunomia")
+			if tt.fails {
+				assert.Regexp(t, `conflict with "horizontal-pod-autoscaler"|is invalid`, output)
+				assert.NotContains(t, applies, "--force-conflicts")
+			}
+			assert.Equal(t, tt.forceApplied, readFile(filepath.Join(tmp, "force-applied")))
+		})
+	}
+}
+
+// serverSideApplyMock is a mock of kubectl keeping the applied objects in $LIVE, with the last-applied-configuration
+// annotation unless they are applied server-side. Its diff reports the objects of the manifests differing from their
+// live state, ignoring that annotation.
+const serverSideApplyMock = `lastApplied='.metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]'
+case " $* " in
+*" apply "*)
+  for file in $(find ${@: -1} -type f | sort); do
+    yq -c 'select(. != null)' $file | while read -r object; do
+      if [[ " $* " != *" --server-side "* ]]; then
+        object=$(echo "$object" | jq -c "$lastApplied = tojson")
+      fi
+      echo "$object" > $LIVE/$(echo "$object" | jq -r .metadata.name)
+    done
+  done ;;
+*" diff "*)
+  rc=0
+  for file in $(find ${@: -1} -type f | sort); do
+    while read -r object; do
+      name=$(echo "$object" | jq -r .metadata.name)
+      if [ ! -f $LIVE/$name ] || [ "$(jq -cS "del($lastApplied) | del(.metadata.annotations | select(. == {}))" $LIVE/$name)" != "$(echo "$object" | jq -cS .)" ]; then
+        echo "diff -u -N /tmp/LIVE-1/v1.ConfigMap.team-a.$name /tmp/MERGED-1/v1.ConfigMap.team-a.$name"
+        rc=1
+      fi
+    done < <(yq -c 'select(. != null)' $file)
+  done
+  exit $rc ;;
+esac
+`
+
+// ssaConfigMap returns the manifest of the ConfigMap web with the given value
+func ssaConfigMap(value string) map[string]string {
+	return map[string]string{"web.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  value: " + value + "\n"}
+}
+
+func TestServerSideApplyScript(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         []string
+		lastApplied bool
+	}{
+		{name: "client-side apply", lastApplied: true},
+		{name: "SERVER_SIDE_APPLY", env: []string{"SERVER_SIDE_APPLY=true"}},
+		{name: "ServerSideApply mode", env: []string{"CREATE_MODE=ServerSideApply"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := tempDir(t)
+			defer os.RemoveAll(live)
+			env := append(tt.env, "LIVE="+live)
+			run := func(value string) string {
+				tmp := tempDir(t)
+				defer os.RemoveAll(tmp)
+				output, err := runResourceManagerWithMock(t, tmp, serverSideApplyMock, ssaConfigMap(value), "Fail", env...)
+				assert.NoError(t, err, output)
+				return strings.TrimSpace(readFile(filepath.Join(tmp, "drifted"))) + " changed=" + strings.TrimSpace(readFile(filepath.Join(tmp, "changed")))
+			}
+
+			assert.Equal(t, "v1.ConfigMap.team-a.web changed=true", run("a"), "the new resource is in the diff")
+			object := readFile(filepath.Join(live, "web"))
+			assert.Contains(t, object, `"value":"a"`)
+			if tt.lastApplied {
+				assert.Contains(t, object, "kubectl.kubernetes.io/last-applied-configuration")
+			} else {
+				assert.NotContains(t, object, "kubectl.kubernetes.io/last-applied-configuration")
+			}
+
+			// the diff still tells the unchanged resources from the changed ones
+			assert.Equal(t, " changed=false", run("a"))
+			assert.Equal(t, "v1.ConfigMap.team-a.web changed=true", run("b"))
+			assert.Contains(t, readFile(filepath.Join(live, "web")), `"value":"b"`)
+		})
+	}
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// claimShardScript is the script claiming the shards of the pods of a sharded job
+const claimShardScript = "../../template-processors/base/bin/claimShard.sh"
+
+// shardingMock is a mock of kubectl logging in $HOME/applied.log the names of the objects applied and in
+// $HOME/deleted.log the resources deleted. The cluster holds the ConfigMaps cm-0 to cm-11, which are in the manifests,
+// and old-0 to old-5, which were removed from them, all applied by team-a/app.
+const shardingMock = `args=("$@")
+case " $* " in
+*" apply "*" -R "*)
+  find ${@: -1} -type f | sort | xargs -r yq -r 'select(. != null) | .metadata.name' >> $HOME/applied.log ;;
+*" api-resources --namespaced=true "*) echo configmaps ;;
+*" api-resources --namespaced=false "*) ;;
+*" get configmaps -l app.kubernetes.io/managed-by=eunomia "*)
+  for name in cm-{0..11} old-{0..5}; do
+    echo '{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "'$name'", "annotations": {"gitopsconfig.eunomia.kohls.io/owner": "team-a/app"}}}'
+  done | jq -s '{kind: "List", items: .}' ;;
+*" delete "*) for ((i = 0; i < $#; i++)); do if [ "${args[$i]}" == delete ]; then echo ${args[$i + 1]} | tee -a $HOME/deleted.log; fi; done ;;
+esac
+`
+
+// shardManifests are the ConfigMaps cm-0 to cm-11, some of them in a List and in a JSON file
+func shardManifests() map[string]string {
+	manifests := map[string]string{}
+	for i := 0; i < 8; i++ {
+		manifests[fmt.Sprintf("cm-%d.yaml", i)] = fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm-%d\n", i)
+	}
+	manifests["list.yaml"] = "apiVersion: v1\nkind: List\nitems:\n"
+	for i := 8; i < 11; i++ {
+		manifests["list.yaml"] += fmt.Sprintf("- apiVersion: v1\n  kind: ConfigMap\n  metadata:\n    name: cm-%d\n", i)
+	}
+	manifests["cm-11.json"] = `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "cm-11"}}`
+	return manifests
+}
+
+// shardOf returns the shard of the ConfigMap name of the team-a namespace among count shards, as computed by
+// resourceManager.sh from its group, kind, namespace and name
+func shardOf(name string, count int) int {
+	h := uint32(0)
+	for _, b := range []byte("/ConfigMap/team-a/" + name) {
+		h = h*31 + uint32(b)
+	}
+	return int(h % uint32(count))
+}
+
+// readLines returns the lines of the file at path, sorted
+func readLines(path string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(readFile(path), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestShardSelection(t *testing.T) {
+	const count = 3
+	var names, removed []string
+	for i := 0; i < 12; i++ {
+		names = append(names, fmt.Sprintf("cm-%d", i))
+	}
+	for i := 0; i < 6; i++ {
+		removed = append(removed, fmt.Sprintf("old-%d", i))
+	}
+
+	applied, deleted := map[string]int{}, map[string]int{}
+	for shard := 0; shard < count; shard++ {
+		// every shard is applied twice, by a pod and the one replacing it, which apply the same resources
+		var runs [][]string
+		for run := 0; run < 2; run++ {
+			tmp, err := ioutil.TempDir("", "sharding")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, shardingMock, shardManifests(), "Fail",
+				"DELETE_MODE=Prune", fmt.Sprintf("SHARD_COUNT=%d", count), fmt.Sprintf("SHARD_INDEX=%d", shard))
+			if !assert.NoError(t, err, output) {
+				return
+			}
+			assert.Contains(t, output, fmt.Sprintf("of shard %d of the %d shards", shard, count))
+			assert.Contains(t, readFile(filepath.Join(tmp, "inventory-unknown")), "the resources of the other shards were applied by the other pods of the job")
+			runs = append(runs, append(readLines(filepath.Join(tmp, "applied.log")), readLines(filepath.Join(tmp, "deleted.log"))...))
+			if run > 0 {
+				continue
+			}
+			for _, name := range readLines(filepath.Join(tmp, "applied.log")) {
+				applied[name]++
+				assert.Equal(t, shard, shardOf(name, count), name)
+			}
+			for _, resource := range readLines(filepath.Join(tmp, "deleted.log")) {
+				name := strings.TrimPrefix(resource, "configmap/")
+				deleted[name]++
+				assert.Equal(t, shard, shardOf(name, count), name)
+			}
+		}
+		assert.Equal(t, runs[0], runs[1])
+	}
+	// the shards are disjoint and cover all the resources
+	for _, name := range names {
+		assert.Equal(t, 1, applied[name], name)
+	}
+	assert.Len(t, applied, len(names))
+	for _, name := range removed {
+		assert.Equal(t, 1, deleted[name], name)
+	}
+	assert.Len(t, deleted, len(removed))
+}
+
+func TestShardSelectionEmptyRender(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "sharding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// a shard without any resource isn't an empty render, unless no shard has any
+	one := map[string]string{"cm-0.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm-0\n"}
+	other := (shardOf("cm-0", 2) + 1) % 2
+	output, err := runResourceManagerWithMock(t, tmp, shardingMock, one, "Fail", "SHARD_COUNT=2", fmt.Sprintf("SHARD_INDEX=%d", other))
+	assert.NoError(t, err, output)
+	assert.Contains(t, output, fmt.Sprintf("Managing the 0 resources of shard %d of the 2 shards", other))
+	assert.Empty(t, readFile(filepath.Join(tmp, "applied.log")))
+
+	tmp2, err := ioutil.TempDir("", "sharding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp2)
+	empty := map[string]string{"empty.yaml": "---\n# nothing to deploy\n---\n"}
+	output, err = runResourceManagerWithMock(t, tmp2, shardingMock, empty, "Fail", "SHARD_COUNT=2", "SHARD_INDEX=0")
+	assert.Error(t, err, output)
+	assert.Contains(t, output, "The templates rendered no resource")
+}
+
+// claimMock is a mock of kubectl keeping the ConfigMaps created and replaced in $HOME/configmaps/<name>, failing to
+// replace a ConfigMap whose resourceVersion changed, and reading the phases of the pods in $HOME/pods/<name>
+const claimMock = `mkdir -p $HOME/configmaps
+case " $* " in
+*" create -f - "*)
+  cat > $HOME/claim
+  name=$(jq -r .metadata.name $HOME/claim)
+  if [ -f $HOME/configmaps/$name ]; then
+    echo "Error from server (AlreadyExists): configmaps \"$name\" already exists" >&2
+    exit 1
+  fi
+  jq '.metadata.resourceVersion = "1"' $HOME/claim > $HOME/configmaps/$name ;;
+*" replace -f - "*)
+  cat > $HOME/claim
+  name=$(jq -r .metadata.name $HOME/claim)
+  version=$(jq -r .metadata.resourceVersion $HOME/configmaps/$name)
+  if [ "$(jq -r '.metadata.resourceVersion // ""' $HOME/claim)" != "$version" ] && [ "$(jq -r .data.state $HOME/claim)" != applied ]; then
+    echo "Error from server (Conflict): the object has been modified" >&2
+    exit 1
+  fi
+  jq --arg version $((version + 1)) '.metadata.resourceVersion = $version' $HOME/claim > $HOME/configmaps/$name ;;
+*" get configmap "*) cat $HOME/configmaps/$(echo " $* " | sed 's/.* get configmap \([^ ]*\) .*/\1/') ;;
+*" get pod "*) cat $HOME/pods/$(echo " $* " | sed 's/.* get pod \([^ ]*\) .*/\1/') 2> /dev/null || true ;;
+*) exit 2 ;;
+esac
+`
+
+func TestClaimShard(t *testing.T) {
+	for _, tool := range []string{"bash", "jq"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is needed to run claimShard.sh", tool)
+		}
+	}
+	tmp, err := ioutil.TempDir("", "claimshard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	kubectl := filepath.Join(tmp, "kubectl")
+	err = ioutil.WriteFile(kubectl, []byte("#!/usr/bin/env bash\n"+claimMock), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(tmp, "pods"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPhase := func(pod, phase string) {
+		err := ioutil.WriteFile(filepath.Join(tmp, "pods", pod), []byte(phase), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	claim := func(pod string, args ...string) (string, error) {
+		cmd := exec.Command("bash", append([]string{claimShardScript}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"kubectl="+kubectl,
+			"HOME="+tmp,
+			"SHARD_COUNT=3",
+			"NAMESPACE=eunomia-operator",
+			"JOB_NAME=gitopsconfig-app-abcde",
+			"JOB_UID=1234",
+			"POD_NAME="+pod,
+		)
+		output, err := cmd.Output()
+		return strings.TrimSpace(string(output)), err
+	}
+
+	for i, pod := range []string{"pod-a", "pod-b", "pod-c"} {
+		setPhase(pod, "Running")
+		shard, err := claim(pod)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(i), shard)
+	}
+	claimed := readFile(filepath.Join(tmp, "configmaps", "gitopsconfig-app-abcde-shard-1"))
+	assert.Contains(t, claimed, `"pod": "pod-b"`)
+	assert.Contains(t, claimed, `"state": "claimed"`)
+	assert.Contains(t, claimed, `"uid": "1234"`)
+
+	// the restarted container of a pod claims its shard again
+	shard, err := claim("pod-b")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", shard)
+
+	// no shard is left while their pods run
+	setPhase("pod-d", "Running")
+	_, err = claim("pod-d")
+	assert.Error(t, err)
+
+	// the shards of the pods that failed or were deleted are taken over, unless they were applied
+	_, err = claim("pod-a", "complete")
+	assert.Error(t, err, "SHARD_INDEX isn't set")
+	cmd := exec.Command("bash", claimShardScript, "complete")
+	cmd.Env = append(os.Environ(), "kubectl="+kubectl, "HOME="+tmp, "SHARD_COUNT=3", "SHARD_INDEX=0",
+		"NAMESPACE=eunomia-operator", "JOB_NAME=gitopsconfig-app-abcde", "JOB_UID=1234", "POD_NAME=pod-a")
+	output, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	assert.Contains(t, readFile(filepath.Join(tmp, "configmaps", "gitopsconfig-app-abcde-shard-0")), `"state": "applied"`)
+	setPhase("pod-a", "Failed")
+	os.Remove(filepath.Join(tmp, "pods", "pod-c"))
+	shard, err = claim("pod-d")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", shard)
+	assert.Contains(t, readFile(filepath.Join(tmp, "configmaps", "gitopsconfig-app-abcde-shard-2")), `"pod": "pod-d"`)
+}
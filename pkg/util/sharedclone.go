@@ -0,0 +1,57 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// sharesClone returns true if the template and parameter sources of config are
+// cloned from the same repository and ref with the same settings, so that a
+// single clone can be used for both. Their context directories may differ.
+func sharesClone(config v1alpha1.GitOpsConfig) bool {
+	template := config.Spec.TemplateSource
+	parameter := config.Spec.ParameterSource
+	if parameter.URI == "" {
+		parameter.URI = template.URI
+	}
+	return strings.TrimSuffix(template.URI, "/") == strings.TrimSuffix(parameter.URI, "/") &&
+		gitRef(template.Ref) == gitRef(parameter.Ref) &&
+		template.SecretRef == parameter.SecretRef &&
+		reflect.DeepEqual(template.ExternalSecretRef, parameter.ExternalSecretRef) &&
+		template.HTTPProxy == parameter.HTTPProxy &&
+		template.HTTPSProxy == parameter.HTTPSProxy &&
+		template.NOProxy == parameter.NOProxy &&
+		strings.Join(template.Mirrors, " ") == strings.Join(parameter.Mirrors, " ") &&
+		reflect.DeepEqual(template.MirrorSecretRefs, parameter.MirrorSecretRefs) &&
+		strings.Join(template.InsecureSkipTLSVerifyHosts, " ") == strings.Join(parameter.InsecureSkipTLSVerifyHosts, " ") &&
+		strings.Join(template.KnownHosts, "\n") == strings.Join(parameter.KnownHosts, "\n") &&
+		template.InsecureIgnoreHostKey == parameter.InsecureIgnoreHostKey &&
+		getCloneDepth(template) == getCloneDepth(parameter) &&
+		isSingleBranch(template) == isSingleBranch(parameter)
+}
+
+// gitRef returns ref, defaulted to master as the sources are
+func gitRef(ref string) string {
+	if ref == "" {
+		return "master"
+	}
+	return ref
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSharesClone(t *testing.T) {
+	source := gitopsv1alpha1.GitConfig{
+		URI:        "https://github.com/KohlsTechnology/eunomia",
+		Ref:        "master",
+		ContextDir: "templates",
+		SecretRef:  "gitconfig",
+	}
+	shallow, full, allBranches := int32(1), int32(0), false
+	tests := []struct {
+		name      string
+		parameter func(*gitopsv1alpha1.GitConfig)
+		shared    bool
+	}{
+		{"same source", func(p *gitopsv1alpha1.GitConfig) {}, true},
+		{"other context dir", func(p *gitopsv1alpha1.GitConfig) { p.ContextDir = "parameters" }, true},
+		{"defaulted uri", func(p *gitopsv1alpha1.GitConfig) { p.URI = "" }, true},
+		{"trailing slash", func(p *gitopsv1alpha1.GitConfig) { p.URI += "/" }, true},
+		{"other repository", func(p *gitopsv1alpha1.GitConfig) { p.URI = "https://github.com/KohlsTechnology/eunomia-params" }, false},
+		{"other ref", func(p *gitopsv1alpha1.GitConfig) { p.Ref = "v1.0.0" }, false},
+		{"other secret", func(p *gitopsv1alpha1.GitConfig) { p.SecretRef = "parameter-gitconfig" }, false},
+		{"external secret", func(p *gitopsv1alpha1.GitConfig) {
+			p.SecretRef = ""
+			p.ExternalSecretRef = &gitopsv1alpha1.ExternalSecretRef{Provider: "AWS", Path: "gitconfig"}
+		}, false},
+		{"other proxy", func(p *gitopsv1alpha1.GitConfig) { p.HTTPSProxy = "http://proxy.com:8080" }, false},
+		{"other mirrors", func(p *gitopsv1alpha1.GitConfig) {
+			p.Mirrors = []string{"https://mirror.internal/KohlsTechnology/eunomia"}
+		}, false},
+		{"other mirror secrets", func(p *gitopsv1alpha1.GitConfig) {
+			p.MirrorSecretRefs = []gitopsv1alpha1.MirrorSecretRef{{Mirror: "https://mirror.internal/KohlsTechnology/eunomia", SecretRef: "mirror-gitconfig"}}
+		}, false},
+		{"other insecure hosts", func(p *gitopsv1alpha1.GitConfig) { p.InsecureSkipTLSVerifyHosts = []string{"github.com"} }, false},
+		{"other known hosts", func(p *gitopsv1alpha1.GitConfig) { p.KnownHosts = []string{"github.com ssh-rsa AAAA"} }, false},
+		{"host key ignored", func(p *gitopsv1alpha1.GitConfig) { p.InsecureIgnoreHostKey = true }, false},
+		{"default clone depth", func(p *gitopsv1alpha1.GitConfig) { p.CloneDepth = &shallow }, true},
+		{"full clone", func(p *gitopsv1alpha1.GitConfig) { p.CloneDepth = &full }, false},
+		{"all branches", func(p *gitopsv1alpha1.GitConfig) { p.SingleBranch = &allBranches }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := gitopsv1alpha1.GitOpsConfig{}
+			config.Spec.TemplateSource = source
+			config.Spec.ParameterSource = source
+			tt.parameter(&config.Spec.ParameterSource)
+			assert.Equal(t, tt.shared, sharesClone(config))
+		})
+	}
+}
+
+func TestSharedCloneReachesJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	// the sources of fullconfig are different repositories
+	job, err := CreateJob(fullconfig)
+	assert.NoError(t, err)
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "SHARED_GIT_CLONE", Value: "false"})
+
+	mergedata := fullconfig
+	mergedata.Config.Spec.ParameterSource = mergedata.Config.Spec.TemplateSource
+	mergedata.Config.Spec.ParameterSource.ContextDir = "test/parameters"
+	job, err = CreateJob(mergedata)
+	assert.NoError(t, err)
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "SHARED_GIT_CLONE", Value: "true"})
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	assert.Contains(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "SHARED_GIT_CLONE", Value: "true"})
+}
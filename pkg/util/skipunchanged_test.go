@@ -0,0 +1,198 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clusterMock is a mock of kubectl keeping the objects applied in $HOME/cluster, one JSON per line, and logging their
+// names in $HOME/applied.log. The live objects are read from $HOME/cluster. The password of the web-db Secret is
+// DB_PASSWORD.
+const clusterMock = `case " $* " in
+*" get secret web-db "*) echo "{\"kind\": \"Secret\", \"data\": {\"password\": \"$(printf %s "$DB_PASSWORD" | base64)\"}}" ;;
+*" apply "*" -R "*)
+  find ${@: -1} -type f | sort | xargs -r yq -c 'select(. != null) | if .kind == "List" then .items[] else . end' | \
+    tee -a $HOME/cluster | jq -r .metadata.name >> $HOME/applied.log ;;
+*" get "*" -o json "*)
+  touch $HOME/cluster
+  jq -s '{apiVersion: "v1", kind: "List", items: .}' $HOME/cluster ;;
+esac
+`
+
+// configMaps returns the manifests of the ConfigMaps a to d, some of them in a List and in a JSON file, with the
+// given values
+func configMaps(values map[string]string) map[string]string {
+	configMap := func(name string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\ndata:\n  value: " + values[name] + "\n"
+	}
+	return map[string]string{
+		"a.yaml":    configMap("a"),
+		"list.yaml": "apiVersion: v1\nkind: List\nitems:\n- " + strings.Replace(strings.TrimSuffix(configMap("b"), "\n"), "\n", "\n  ", -1) + "\n- " + strings.Replace(strings.TrimSuffix(configMap("c"), "\n"), "\n", "\n  ", -1) + "\n",
+		"d.json":    `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "d"}, "data": {"value": "` + values["d"] + `"}}`,
+	}
+}
+
+// applyToCluster runs resourceManager.sh on manifests with clusterMock, the cluster holding the objects of cluster,
+// and returns the output, the names of the objects applied and the objects of the cluster afterwards
+func applyToCluster(t *testing.T, cluster string, manifests map[string]string, env ...string) (string, []string, string) {
+	tmp, err := ioutil.TempDir("", "skipunchanged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	err = ioutil.WriteFile(filepath.Join(tmp, "cluster"), []byte(cluster), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := runResourceManagerWithMock(t, tmp, clusterMock, manifests, "Fail", env...)
+	assert.NoError(t, err, output)
+	return output, readLines(filepath.Join(tmp, "applied.log")), readFile(filepath.Join(tmp, "cluster"))
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	values := map[string]string{"a": "1", "b": "1", "c": "1", "d": "1"}
+
+	// the first run applies all the objects, with the hash of their content
+	_, applied, cluster := applyToCluster(t, "", configMaps(values), "SKIP_UNCHANGED=true")
+	assert.Equal(t, []string{"a", "b", "c", "d"}, applied)
+	hashes := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(cluster), "\n") {
+		var object struct {
+			Metadata struct {
+				Name        string
+				Annotations map[string]string
+			}
+		}
+		if !assert.NoError(t, json.Unmarshal([]byte(line), &object)) {
+			return
+		}
+		hashes[object.Metadata.Name] = object.Metadata.Annotations["gitopsconfig.eunomia.kohls.io/applied-hash"]
+		assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{64}$"), hashes[object.Metadata.Name])
+	}
+	assert.Len(t, hashes, 4)
+	assert.NotEqual(t, hashes["a"], hashes["b"])
+
+	// only the changed and new objects are applied again
+	values["b"], values["d"] = "2", "2"
+	manifests := configMaps(values)
+	manifests["e.yaml"] = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: e\n"
+	output, applied, updated := applyToCluster(t, cluster, manifests, "SKIP_UNCHANGED=true")
+	assert.Equal(t, []string{"b", "d", "e"}, applied)
+	assert.Contains(t, output, "Skipping the 2 resources unchanged since they were last applied")
+
+	// nothing is applied when nothing changed
+	_, applied, _ = applyToCluster(t, updated, manifests, "SKIP_UNCHANGED=true")
+	assert.Empty(t, applied)
+
+	// a live object changed by another tool keeps its hash, the object is only applied again once its manifest changes
+	_, applied, _ = applyToCluster(t, strings.Replace(updated, `"value":"1"`, `"value":"manual"`, -1), manifests, "SKIP_UNCHANGED=true")
+	assert.Empty(t, applied)
+
+	// without skipUnchanged, all the objects are applied, without hash
+	_, applied, cluster = applyToCluster(t, updated, manifests)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, applied)
+	assert.NotContains(t, strings.TrimPrefix(cluster, updated), "applied-hash")
+}
+
+func TestSkipUnchangedApplyDebug(t *testing.T) {
+	values := map[string]string{"a": "1", "b": "1", "c": "1", "d": "1"}
+	_, _, cluster := applyToCluster(t, "", configMaps(values), "SKIP_UNCHANGED=true")
+
+	tmp, err := ioutil.TempDir("", "skipunchanged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	err = ioutil.WriteFile(filepath.Join(tmp, "cluster"), []byte(cluster), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values["a"] = "2"
+	output, err := runResourceManagerWithMock(t, tmp, clusterMock, configMaps(values), "Fail", "SKIP_UNCHANGED=true", "APPLY_DEBUG=true")
+	if !assert.NoError(t, err, output) {
+		return
+	}
+	// the skipped objects are reported as unchanged
+	assert.Equal(t, []string{"configmap/b unchanged", "configmap/c unchanged", "configmap/d unchanged"}, readLines(filepath.Join(tmp, "applied")))
+	assert.Equal(t, []string{"a"}, readLines(filepath.Join(tmp, "applied.log")))
+}
+
+func TestSkipUnchangedNamespaces(t *testing.T) {
+	settings := func(namespace, value string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: " + namespace + "\ndata:\n  value: " + value + "\n"
+	}
+	manifests := map[string]string{"a.yaml": settings("a", "1"), "b.yaml": settings("b", "1")}
+	_, applied, cluster := applyToCluster(t, "", manifests, "SKIP_UNCHANGED=true")
+	assert.Equal(t, []string{"settings", "settings"}, applied)
+
+	// the objects of the same kind and name are told apart by their namespace, only the changed one is applied
+	manifests["a.yaml"] = settings("a", "2")
+	output, applied, updated := applyToCluster(t, cluster, manifests, "SKIP_UNCHANGED=true")
+	assert.Equal(t, []string{"settings"}, applied)
+	assert.Contains(t, output, "Skipping the 1 resources unchanged since they were last applied")
+	assert.Contains(t, strings.TrimPrefix(updated, cluster), `"namespace":"a"`)
+	assert.NotContains(t, strings.TrimPrefix(updated, cluster), `"namespace":"b"`)
+}
+
+// appliedHashes returns the applied hash annotations of the objects of cluster by name
+func appliedHashes(t *testing.T, cluster string) map[string]string {
+	hashes := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(cluster), "\n") {
+		var object struct {
+			Metadata struct {
+				Name        string
+				Annotations map[string]string
+			}
+		}
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			t.Fatal(err)
+		}
+		hashes[object.Metadata.Name] = object.Metadata.Annotations["gitopsconfig.eunomia.kohls.io/applied-hash"]
+	}
+	return hashes
+}
+
+func TestSkipUnchangedSecrets(t *testing.T) {
+	manifests := map[string]string{
+		"web.yaml":   "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  url: postgres://admin:${secret:web-db/password}@db:5432/web\n",
+		"plain.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: plain\ndata:\n  value: \"1\"\n",
+	}
+	_, applied, cluster := applyToCluster(t, "", manifests, "SKIP_UNCHANGED=true", "DB_PASSWORD=p@ss")
+	assert.Equal(t, []string{"plain", "web"}, applied)
+	assert.Contains(t, cluster, "postgres://admin:p@ss@db:5432/web")
+
+	// the hash is the one of the manifest before the secret values are injected, it doesn't tell anything about them
+	_, _, other := applyToCluster(t, "", manifests, "SKIP_UNCHANGED=true", "DB_PASSWORD=other")
+	hashes := appliedHashes(t, cluster)
+	assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{64}$"), hashes["web"])
+	assert.Equal(t, hashes["web"], appliedHashes(t, other)["web"])
+
+	// the objects holding secret values are always applied, with the values of the Secrets at the time of the run
+	output, applied, updated := applyToCluster(t, cluster, manifests, "SKIP_UNCHANGED=true", "DB_PASSWORD=rotated")
+	assert.Equal(t, []string{"web"}, applied)
+	assert.Contains(t, output, "Skipping the 1 resources unchanged since they were last applied")
+	assert.Contains(t, strings.TrimPrefix(updated, cluster), "postgres://admin:rotated@db:5432/web")
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"path"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// DefaultSourceMountPath is where the sources are cloned and the manifests rendered in the job pods by default
+const DefaultSourceMountPath = "/git"
+
+// getSourceMountPath returns the path where the sources of config are cloned in its job pods
+func getSourceMountPath(config v1alpha1.GitOpsConfig) string {
+	if config.Spec.SourceMountPath == "" {
+		return DefaultSourceMountPath
+	}
+	return path.Clean(config.Spec.SourceMountPath)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSourceMountPath(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+	tests := []struct {
+		name       string
+		mountPath  string
+		workingDir string
+		source     string
+	}{
+		{"defaults", "", "", "/git"},
+		{"custom paths", "/workspace/src/", "/workspace", "/workspace/src"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergedata := fullconfig
+			mergedata.Config.Spec.SourceMountPath = tt.mountPath
+			mergedata.Config.Spec.WorkingDir = tt.workingDir
+			job, err := CreateJob(mergedata)
+			if !assert.NoError(t, err) {
+				return
+			}
+			cronjob, err := CreateCronJob(mergedata)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, container := range []corev1.Container{job.Spec.Template.Spec.Containers[0], cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0]} {
+				// the sources are cloned and the manifests rendered into the mounted volume
+				assert.Equal(t, tt.workingDir, container.WorkingDir)
+				assert.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "workspace", MountPath: tt.source})
+				assert.Contains(t, container.Env, corev1.EnvVar{Name: "TEMPLATE_GIT_DIR", Value: tt.source + "/templates"})
+				assert.Contains(t, container.Env, corev1.EnvVar{Name: "PARAMETER_GIT_DIR", Value: tt.source + "/parameters"})
+				assert.Contains(t, container.Env, corev1.EnvVar{Name: "CLONED_TEMPLATE_GIT_DIR", Value: tt.source + "/templates/" + mergedata.Config.Spec.TemplateSource.ContextDir})
+				assert.Contains(t, container.Env, corev1.EnvVar{Name: "CLONED_PARAMETER_GIT_DIR", Value: tt.source + "/parameters/" + mergedata.Config.Spec.ParameterSource.ContextDir})
+				assert.Contains(t, container.Env, corev1.EnvVar{Name: "MANIFEST_DIR", Value: tt.source + "/manifests"})
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncWaveMock is a mock of kubectl logging in $HOME/waves.log the names of the objects of each directory it applies,
+// and the resources it waits for. The rollouts fail with ROLLOUT_FAILS.
+const syncWaveMock = `case " $* " in
+*" apply "*" -R "*)
+  dir=${@: -1}
+  if [ "$dir" == "$HOME/manifests" ]; then
+    echo "apply all" >> $HOME/waves.log
+  else
+    echo "apply $(cat $dir/*.json | jq -r .metadata.name | tr '\n' ' ')" >> $HOME/waves.log
+  fi ;;
+*" rollout status "*)
+  echo "wait $(printf '%s\n' "$@" | grep -E '^[a-z]+/[a-z-]+$')" >> $HOME/waves.log
+  [ -z "${ROLLOUT_FAILS:-}" ] ;;
+*" wait "*)
+  echo "wait $(printf '%s\n' "$@" | grep -E '^[a-z]+/[a-z-]+$')" >> $HOME/waves.log ;;
+esac
+`
+
+// waveManifest returns a manifest of the given kind and name, in the given sync wave if any
+func waveManifest(kind, name, wave string) string {
+	manifest := "apiVersion: v1\nkind: " + kind + "\nmetadata:\n  name: " + name + "\n"
+	if wave != "" {
+		manifest += "  annotations:\n    gitopsconfig.eunomia.kohls.io/sync-wave: \"" + wave + "\"\n"
+	}
+	return manifest
+}
+
+func TestSyncWaves(t *testing.T) {
+	waves := map[string]string{
+		"a-web.yaml":     waveManifest("Deployment", "web", "1") + "---\n" + waveManifest("ConfigMap", "web-config", "1"),
+		"b-db.yaml":      waveManifest("Deployment", "db", "-1"),
+		"c-migrate.yaml": waveManifest("Job", "migrate", "0"),
+		"d-service.yaml": waveManifest("Service", "web", ""),
+	}
+	tests := []struct {
+		name      string
+		manifests map[string]string
+		env       []string
+		fails     bool
+		calls     []string
+		output    string
+		phase     string
+	}{
+		{
+			name:      "without sync waves",
+			manifests: map[string]string{"web.yaml": waveManifest("Deployment", "web", ""), "db.yaml": waveManifest("Deployment", "db", "")},
+			calls:     []string{"apply all"},
+		},
+		{
+			name:      "single sync wave",
+			manifests: map[string]string{"web.yaml": waveManifest("Deployment", "web", "2"), "db.yaml": waveManifest("Deployment", "db", "2")},
+			calls:     []string{"apply db web"},
+			output:    "Applying sync wave 2 (1/1)",
+		},
+		{
+			name:      "ascending waves, the unannotated objects in wave 0",
+			manifests: waves,
+			calls:     []string{"apply db", "wait deployment/db", "apply migrate web", "wait job/migrate", "apply web web-config"},
+			output:    "Applying sync wave 1 (3/3)",
+		},
+		{
+			name:      "wave not ready",
+			manifests: waves,
+			env:       []string{"ROLLOUT_FAILS=true"},
+			fails:     true,
+			calls:     []string{"apply db", "wait deployment/db"},
+			output:    "deployment/db isn't ready, the next sync waves aren't applied",
+			phase:     "HealthCheck",
+		},
+		{
+			name:      "invalid sync wave",
+			manifests: map[string]string{"web.yaml": waveManifest("Deployment", "web", "first")},
+			fails:     true,
+			output:    `invalid sync wave "first" of Deployment/web, it must be an integer`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "syncwave")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			output, err := runResourceManagerWithMock(t, tmp, syncWaveMock, tt.manifests, "Fail", tt.env...)
+			assert.Equal(t, tt.fails, err != nil, output)
+			assert.Contains(t, output, tt.output)
+
+			var calls []string
+			if log := strings.TrimSpace(readFile(filepath.Join(tmp, "waves.log"))); log != "" {
+				for _, call := range strings.Split(log, "\n") {
+					calls = append(calls, strings.TrimSpace(call))
+				}
+			}
+			assert.Equal(t, tt.calls, calls)
+			assert.Equal(t, tt.phase, strings.TrimSpace(readFile(filepath.Join(tmp, "phase"))))
+		})
+	}
+}
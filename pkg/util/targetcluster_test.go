@@ -0,0 +1,76 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTargetClusterMounted(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+	mergedata := fullconfig
+	mergedata.Config.Spec.TargetCluster = &gitopsv1alpha1.TargetClusterReference{SecretRef: "remote"}
+	job, err := CreateJob(mergedata)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cronjob, err := CreateCronJob(mergedata)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, spec := range []corev1.PodSpec{job.Spec.Template.Spec, cronjob.Spec.JobTemplate.Spec.Template.Spec} {
+		assert.Contains(t, spec.Volumes, corev1.Volume{Name: "target-kubeconfig", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+			SecretName: "remote",
+			Items:      []corev1.KeyToPath{{Key: "kubeconfig", Path: "kubeconfig"}},
+		}}})
+		container := spec.Containers[0]
+		assert.Contains(t, container.VolumeMounts, corev1.VolumeMount{Name: "target-kubeconfig", MountPath: "/target-kubeconfig", ReadOnly: true})
+		assert.Contains(t, container.Env, corev1.EnvVar{Name: "TARGET_KUBECONFIG", Value: "/target-kubeconfig/kubeconfig"})
+	}
+
+	// without a target cluster the jobs apply into their own cluster
+	job, err = CreateJob(fullconfig)
+	if assert.NoError(t, err) {
+		for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+			assert.NotEqual(t, "TARGET_KUBECONFIG", env.Name)
+		}
+	}
+}
+
+func TestTargetClusterApply(t *testing.T) {
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+
+	output, err := runResourceManagerWithMock(t, tmp, pruneKubectlMock, pruneManifests, "", "TARGET_KUBECONFIG="+filepath.Join(tmp, "target-kubeconfig"))
+	assert.NoError(t, err, output)
+	log := readFile(filepath.Join(tmp, "kubectl.log"))
+	assert.Contains(t, log, "--kubeconfig="+filepath.Join(tmp, "target-kubeconfig")+" config set-context --current --namespace=team-a\n")
+	// every call reaches the remote cluster, none the one of the job
+	for _, line := range strings.Split(strings.TrimSpace(log), "\n") {
+		assert.Contains(t, line, "--kubeconfig="+filepath.Join(tmp, "target-kubeconfig"))
+		assert.NotContains(t, line, "kubernetes.default.svc")
+	}
+	assert.Contains(t, log, " apply ")
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// pruneNamespaces returns the namespaces in the inventory of config that
+// aren't target namespaces anymore, whose resources must be deleted
+func pruneNamespaces(config v1alpha1.GitOpsConfig) []string {
+	targets := map[string]bool{}
+	for _, namespace := range config.Spec.TargetNamespaces {
+		targets[namespace] = true
+	}
+	prune := []string{}
+	for _, inventory := range config.Status.Inventory {
+		if !targets[inventory.Namespace] {
+			prune = append(prune, inventory.Namespace)
+		}
+	}
+	return prune
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPruneNamespaces(t *testing.T) {
+	config := gitopsv1alpha1.GitOpsConfig{}
+	assert.Empty(t, pruneNamespaces(config))
+
+	config.Spec.TargetNamespaces = []string{"tenant-a", "tenant-b"}
+	config.Status.Inventory = []gitopsv1alpha1.NamespaceInventory{{Namespace: "tenant-a"}, {Namespace: "tenant-b"}}
+	assert.Empty(t, pruneNamespaces(config))
+
+	config.Spec.TargetNamespaces = []string{"tenant-b", "tenant-d"}
+	config.Status.Inventory = append(config.Status.Inventory, gitopsv1alpha1.NamespaceInventory{Namespace: "tenant-c"})
+	assert.Equal(t, []string{"tenant-a", "tenant-c"}, pruneNamespaces(config))
+
+	config.Spec.TargetNamespaces = nil
+	assert.Equal(t, []string{"tenant-a", "tenant-b", "tenant-c"}, pruneNamespaces(config))
+}
+
+func TestTargetNamespacesReachJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	job, err := CreateJob(fullconfig)
+	assert.NoError(t, err)
+	for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+		assert.NotEqual(t, "TARGET_NAMESPACES", env.Name)
+		assert.NotEqual(t, "PRUNE_NAMESPACES", env.Name)
+	}
+
+	mergedata := fullconfig
+	mergedata.Config.Spec.TargetNamespaces = []string{"tenant-a", "tenant-b", "tenant-c"}
+	mergedata.Config.Status.Inventory = []gitopsv1alpha1.NamespaceInventory{{Namespace: "tenant-a"}, {Namespace: "tenant-z"}}
+	job, err = CreateJob(mergedata)
+	assert.NoError(t, err)
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "TARGET_NAMESPACES", Value: "tenant-a tenant-b tenant-c"})
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "PRUNE_NAMESPACES", Value: "tenant-z"})
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	assert.Contains(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "TARGET_NAMESPACES", Value: "tenant-a tenant-b tenant-c"})
+	assert.Contains(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "PRUNE_NAMESPACES", Value: "tenant-z"})
+}
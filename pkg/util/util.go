@@ -19,6 +19,7 @@ package util
 import (
 	"bytes"
 	"io/ioutil"
+	"strings"
 	"text/template"
 
 	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
@@ -33,12 +34,34 @@ var jobTemplate *template.Template
 var cronJobTemplate *template.Template
 var log = logf.Log.WithName("util")
 
+// readOnly makes the jobs of all the GitOpsConfigs only render and diff their manifests
+var readOnly bool
+
+// SetReadOnly configures whether the jobs must leave the resources untouched, regardless of the settings of the GitOpsConfigs
+func SetReadOnly(enabled bool) {
+	readOnly = enabled
+}
+
+// IsReadOnly returns true if the jobs must leave the resources untouched
+func IsReadOnly() bool {
+	return readOnly
+}
+
 // JobMergeData is the structs that will be used to merge with the job template
 type JobMergeData struct {
 	Config v1alpha1.GitOpsConfig `json:"config,omitempty"`
 
 	// Action can be create, delete
 	Action string `json:"action,omitempty"`
+
+	// ParameterFile is the parameter file resolved from the fileName of the parameter source, if any
+	ParameterFile string `json:"parameterFile,omitempty"`
+
+	// Commit is the hash of the pushed commit that triggered the job, if known
+	Commit string `json:"commit,omitempty"`
+
+	// TraceParent is the W3C traceparent of the span of the run, empty when tracing is disabled
+	TraceParent string `json:"traceParent,omitempty"`
 }
 
 // InitializeTemplates initializes the temolates needed by this controller, it must be called at controller boot time
@@ -52,6 +75,31 @@ func InitializeTemplates(jobTempateFileName string, cronJobTemplateFilename stri
 		"getID": func() string {
 			return uniuri.NewLenChars(6, []byte("abcdefghijklmnopqrstuvwxyz0123456789"))
 		},
+		"getRequestTimeout":        getRequestTimeout,
+		"getKubeAPIQPS":            getKubeAPIQPS,
+		"getKubeAPIBurst":          getKubeAPIBurst,
+		"join":                     strings.Join,
+		"isReadOnly":               IsReadOnly,
+		"getImagePullPolicy":       getImagePullPolicy,
+		"sharesClone":              sharesClone,
+		"getCloneDepth":            getCloneDepth,
+		"isSingleBranch":           isSingleBranch,
+		"getSourceMountPath":       getSourceMountPath,
+		"getJobNamespace":          JobNamespace,
+		"pruneNamespaces":          pruneNamespaces,
+		"getDeniedResourceKinds":   getDeniedResourceKinds,
+		"getConflictPolicy":        getConflictPolicy,
+		"getJobProxy":              getJobProxy,
+		"getSourceNoProxy":         getSourceNoProxy,
+		"getBackoffLimit":          getBackoffLimit,
+		"getActiveDeadlineSeconds": getActiveDeadlineSeconds,
+		"getShardCount":            getShardCount,
+		"getJobResources":          getJobResources,
+		"toJSON":                   toJSON,
+		"getVaultValues":           getVaultValues,
+		"getCABundleKey":           GetCABundleKey,
+		"getTargetKubeconfigKey":   GetTargetKubeconfigKey,
+		"getJobName":               getJobName,
 	})
 
 	jobTemplate, err = jobTemplate.Parse(string(text))
@@ -66,14 +114,32 @@ func InitializeTemplates(jobTempateFileName string, cronJobTemplateFilename stri
 		return err
 	}
 	cronJobTemplate = template.New("Job").Funcs(template.FuncMap{
-		"getCron": func(config v1alpha1.GitOpsConfig) string {
-			for _, trigger := range config.Spec.Triggers {
-				if trigger.Type == "Periodic" {
-					return trigger.Cron
-				}
-			}
-			return ""
-		},
+		"getCron":                  getCron,
+		"getCronJobName":           CronJobName,
+		"getRequestTimeout":        getRequestTimeout,
+		"getKubeAPIQPS":            getKubeAPIQPS,
+		"getKubeAPIBurst":          getKubeAPIBurst,
+		"join":                     strings.Join,
+		"isReadOnly":               IsReadOnly,
+		"getImagePullPolicy":       getImagePullPolicy,
+		"sharesClone":              sharesClone,
+		"getCloneDepth":            getCloneDepth,
+		"isSingleBranch":           isSingleBranch,
+		"getSourceMountPath":       getSourceMountPath,
+		"getJobNamespace":          JobNamespace,
+		"pruneNamespaces":          pruneNamespaces,
+		"getDeniedResourceKinds":   getDeniedResourceKinds,
+		"getConflictPolicy":        getConflictPolicy,
+		"getJobProxy":              getJobProxy,
+		"getSourceNoProxy":         getSourceNoProxy,
+		"getBackoffLimit":          getBackoffLimit,
+		"getActiveDeadlineSeconds": getActiveDeadlineSeconds,
+		"getShardCount":            getShardCount,
+		"getJobResources":          getJobResources,
+		"toJSON":                   toJSON,
+		"getVaultValues":           getVaultValues,
+		"getCABundleKey":           GetCABundleKey,
+		"getTargetKubeconfigKey":   GetTargetKubeconfigKey,
 	})
 
 	cronJobTemplate, err = cronJobTemplate.Parse(string(text))
@@ -19,11 +19,15 @@ package util
 import (
 	"bytes"
 	"io/ioutil"
+	"strings"
 	"testing"
 	"text/template"
 
 	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
 	"github.com/dchest/uniuri"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -83,6 +87,31 @@ func TestFullConfig(t *testing.T) {
 		"getID": func() string {
 			return uniuri.NewLenChars(6, []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"))
 		},
+		"getRequestTimeout":        getRequestTimeout,
+		"getKubeAPIQPS":            getKubeAPIQPS,
+		"getKubeAPIBurst":          getKubeAPIBurst,
+		"join":                     strings.Join,
+		"isReadOnly":               IsReadOnly,
+		"getImagePullPolicy":       getImagePullPolicy,
+		"sharesClone":              sharesClone,
+		"getCloneDepth":            getCloneDepth,
+		"isSingleBranch":           isSingleBranch,
+		"getSourceMountPath":       getSourceMountPath,
+		"getJobNamespace":          JobNamespace,
+		"pruneNamespaces":          pruneNamespaces,
+		"getDeniedResourceKinds":   getDeniedResourceKinds,
+		"getConflictPolicy":        getConflictPolicy,
+		"getJobProxy":              getJobProxy,
+		"getSourceNoProxy":         getSourceNoProxy,
+		"getBackoffLimit":          getBackoffLimit,
+		"getActiveDeadlineSeconds": getActiveDeadlineSeconds,
+		"getShardCount":            getShardCount,
+		"getJobResources":          getJobResources,
+		"toJSON":                   toJSON,
+		"getVaultValues":           getVaultValues,
+		"getCABundleKey":           GetCABundleKey,
+		"getTargetKubeconfigKey":   GetTargetKubeconfigKey,
+		"getJobName":               getJobName,
 	})
 
 	template, err = template.Parse(string(text))
@@ -99,3 +128,132 @@ func TestFullConfig(t *testing.T) {
 
 	t.Logf("resulting manifest: %v", b.String())
 }
+
+func TestExternalSecretReachesJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	mergedata.Config.Spec.TemplateSource.SecretRef = ""
+	mergedata.Config.Spec.TemplateSource.ExternalSecretRef = &gitopsv1alpha1.ExternalSecretRef{Provider: "GCP", Path: "projects/gitops/secrets/git-creds"}
+	job, err := CreateJob(mergedata)
+	assert.NoError(t, err)
+	env := job.Spec.Template.Spec.Containers[0].Env
+	assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_GIT_SECRET_PROVIDER", Value: "GCP"})
+	assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_GIT_SECRET_PATH", Value: "projects/gitops/secrets/git-creds"})
+	for _, e := range env {
+		assert.NotEqual(t, "TEMPLATE_GITCONFIG", e.Name)
+		assert.NotEqual(t, "PARAMETER_GIT_SECRET_PROVIDER", e.Name)
+	}
+	for _, volume := range job.Spec.Template.Spec.Volumes {
+		assert.NotEqual(t, "template-gitconfig", volume.Name)
+	}
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	assert.Contains(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "TEMPLATE_GIT_SECRET_PROVIDER", Value: "GCP"})
+}
+
+func TestContextDirsReachJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	job, err := CreateJob(mergedata)
+	assert.NoError(t, err)
+	for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+		assert.NotEqual(t, "TEMPLATE_CONTEXT_DIRS", e.Name)
+	}
+
+	mergedata.Config.Spec.TemplateSource.ContextDir = ""
+	mergedata.Config.Spec.TemplateSource.ContextDirs = []string{"apps/frontend", "apps/backend"}
+	mergedata.Config.Spec.TemplateSource.ContinueOnError = true
+	job, err = CreateJob(mergedata)
+	assert.NoError(t, err)
+	env := job.Spec.Template.Spec.Containers[0].Env
+	assert.Contains(t, env, corev1.EnvVar{Name: "TEMPLATE_CONTEXT_DIRS", Value: "apps/frontend apps/backend"})
+	assert.Contains(t, env, corev1.EnvVar{Name: "CONTINUE_ON_ERROR", Value: "true"})
+	cronjob, err := CreateCronJob(mergedata)
+	assert.NoError(t, err)
+	assert.Contains(t, cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "TEMPLATE_CONTEXT_DIRS", Value: "apps/frontend apps/backend"})
+}
+
+// The credentials of a source are never copied by the operator: every job pod, including the ones of the cronjob,
+// mounts the secret by name, so the next clone after a rotation uses the rotated credentials
+func TestSecretRefMountedByName(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	mergedata := fullconfig
+	mergedata.Config.Spec.ParameterSource.SecretRef = "parameter-creds"
+	job, err := CreateJob(mergedata)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cronjob, err := CreateCronJob(mergedata)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, spec := range []corev1.PodSpec{job.Spec.Template.Spec, cronjob.Spec.JobTemplate.Spec.Template.Spec} {
+		secrets := map[string]string{}
+		for _, volume := range spec.Volumes {
+			if volume.Secret != nil {
+				secrets[volume.Name] = volume.Secret.SecretName
+			}
+		}
+		assert.Equal(t, map[string]string{"template-gitconfig": "pio", "parameter-gitconfig": "parameter-creds"}, secrets)
+		for _, container := range append(spec.InitContainers, spec.Containers...) {
+			for _, env := range container.Env {
+				if env.ValueFrom != nil {
+					assert.Nil(t, env.ValueFrom.SecretKeyRef, "%s is read from the secret when the pod starts instead of when it clones", env.Name)
+				}
+			}
+			assert.Empty(t, container.EnvFrom)
+		}
+	}
+}
+
+func TestJobTemplateReachesJob(t *testing.T) {
+	err := InitializeTemplates(templateFile, "../../deploy/helm/operator/eunomia-templates/cronjob.yaml")
+	assert.NoError(t, err)
+
+	deadline := int64(600)
+	backoffLimit := int32(1)
+	ttl := int32(0)
+	tests := []struct {
+		name         string
+		jobTemplate  *gitopsv1alpha1.JobTemplate
+		retryable    []int32
+		deadline     *int64
+		backoffLimit int32
+	}{
+		{"defaults", nil, nil, nil, 4},
+		{"deadline, backoffLimit and ttl", &gitopsv1alpha1.JobTemplate{ActiveDeadlineSeconds: &deadline, BackoffLimit: &backoffLimit, TTLSecondsAfterFinished: &ttl}, nil, &deadline, 1},
+		{"relaunched by the operator", &gitopsv1alpha1.JobTemplate{ActiveDeadlineSeconds: &deadline, BackoffLimit: &backoffLimit}, []int32{2}, &deadline, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mergedata := fullconfig
+			mergedata.Config.Spec.JobTemplate = tt.jobTemplate
+			mergedata.Config.Spec.RetryableExitCodes = tt.retryable
+			job, err := CreateJob(mergedata)
+			if !assert.NoError(t, err) {
+				return
+			}
+			cronjob, err := CreateCronJob(mergedata)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, spec := range []batchv1.JobSpec{job.Spec, cronjob.Spec.JobTemplate.Spec} {
+				assert.Equal(t, tt.deadline, spec.ActiveDeadlineSeconds)
+				if tt.jobTemplate != nil {
+					assert.Equal(t, tt.jobTemplate.TTLSecondsAfterFinished, spec.TTLSecondsAfterFinished)
+				} else {
+					assert.Nil(t, spec.TTLSecondsAfterFinished)
+				}
+				if assert.NotNil(t, spec.BackoffLimit) {
+					assert.Equal(t, tt.backoffLimit, *spec.BackoffLimit)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+)
+
+// vaultValues is a Vault secret of the valuesFrom of a parameter source, as read by mergeParameterValues.sh
+type vaultValues struct {
+	// Index is the position of the secret in the valuesFrom, which are merged in order
+	Index     int    `json:"index"`
+	Address   string `json:"address"`
+	Role      string `json:"role"`
+	AuthMount string `json:"authMount"`
+	Mount     string `json:"mount"`
+	Path      string `json:"path"`
+	KVVersion int    `json:"kvVersion"`
+	Key       string `json:"key,omitempty"`
+}
+
+// getVaultValues returns in JSON the Vault secrets of the valuesFrom of the parameter source of config, defaulted,
+// empty when there is none
+func getVaultValues(config v1alpha1.GitOpsConfig) (string, error) {
+	secrets := []vaultValues{}
+	for i, values := range config.Spec.ParameterSource.ValuesFrom {
+		if values.Kind != "Vault" || values.Vault == nil {
+			continue
+		}
+		secret := vaultValues{
+			Index:     i,
+			Address:   strings.TrimRight(values.Vault.Address, "/"),
+			Role:      values.Vault.Role,
+			AuthMount: strings.Trim(values.Vault.AuthMount, "/"),
+			Mount:     strings.Trim(values.Vault.Mount, "/"),
+			Path:      strings.Trim(values.Vault.Path, "/"),
+			KVVersion: values.Vault.KVVersion,
+			Key:       values.Key,
+		}
+		if secret.AuthMount == "" {
+			secret.AuthMount = "kubernetes"
+		}
+		if secret.Mount == "" {
+			secret.Mount = "secret"
+		}
+		if secret.KVVersion == 0 {
+			secret.KVVersion = 2
+		}
+		secrets = append(secrets, secret)
+	}
+	if len(secrets) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(secrets)
+	return string(b), err
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetVaultValues(t *testing.T) {
+	config := v1alpha1.GitOpsConfig{}
+	values, err := getVaultValues(config)
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	config.Spec.ParameterSource.ValuesFrom = []v1alpha1.ValuesReference{
+		{Kind: "ConfigMap", Name: "env-values"},
+		{Kind: "Vault", Key: "replicas", Vault: &v1alpha1.VaultValues{Address: "https://vault.example.com/", Role: "web", Path: "/web/prod/"}},
+		{Kind: "Vault", Vault: &v1alpha1.VaultValues{Address: "http://vault:8200", Role: "web", AuthMount: "/k8s-east/", Mount: "kv", Path: "web", KVVersion: 1}},
+	}
+	values, err = getVaultValues(config)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"index":1,"address":"https://vault.example.com","role":"web","authMount":"kubernetes","mount":"secret","path":"web/prod","kvVersion":2,"key":"replicas"},
+		{"index":2,"address":"http://vault:8200","role":"web","authMount":"k8s-east","mount":"kv","path":"web","kvVersion":1}
+	]`, values)
+}
+
+// newMockVault returns a Vault server accepting the role web with the service account token jwt, serving the
+// secret web/prod in the KV v2 mount secret and in the KV v1 mount kv
+func newMockVault(t *testing.T) *httptest.Server {
+	secret := map[string]interface{}{"replicas": 4, "password": "s3cret"}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond := func(code int, body interface{}) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			assert.NoError(t, json.NewEncoder(w).Encode(body))
+		}
+		if r.URL.Path == "/v1/auth/kubernetes/login" {
+			login := map[string]string{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&login))
+			if r.Method != http.MethodPost || login["role"] != "web" || login["jwt"] != "jwt" {
+				respond(http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+				return
+			}
+			respond(http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{"client_token": "token"}})
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "token" {
+			respond(http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/web/prod":
+			respond(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"data": secret, "metadata": map[string]interface{}{"version": 3}}})
+		case "/v1/kv/web/prod":
+			respond(http.StatusOK, map[string]interface{}{"data": secret})
+		default:
+			respond(http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+		}
+	}))
+}
+
+// runMergeVaultValues runs mergeParameterValues.sh in tmp with the ConfigMap values valuesFrom followed by the
+// Vault secret vault, as listed by getVaultValues, logging in with the service account token jwt
+func runMergeVaultValues(t *testing.T, tmp string, valuesFrom []map[string]string, vault string, jwt string) (map[string]interface{}, string, error) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl is needed to read the Vault secrets")
+	}
+	token := filepath.Join(tmp, "token")
+	if err := ioutil.WriteFile(token, []byte(jwt), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vaultValues := fmt.Sprintf(`[{"index":%d,%s}]`, len(valuesFrom), vault)
+	return runMergeParameterValues(t, tmp, "environment: prod\n", valuesFrom,
+		"PARAMETER_VALUES_VAULT="+vaultValues,
+		"VAULT_SERVICE_ACCOUNT_TOKEN="+token,
+	)
+}
+
+func TestMergeVaultValues(t *testing.T) {
+	server := newMockVault(t)
+	defer server.Close()
+	tests := []struct {
+		name       string
+		valuesFrom []map[string]string
+		vault      string
+		expected   map[string]interface{}
+	}{
+		{"kv v2", nil, `"mount":"secret","path":"web/prod","kvVersion":2`,
+			map[string]interface{}{"environment": "prod", "replicas": float64(4), "password": "s3cret"}},
+		{"kv v1", nil, `"mount":"kv","path":"web/prod","kvVersion":1`,
+			map[string]interface{}{"environment": "prod", "replicas": float64(4), "password": "s3cret"}},
+		{"key", nil, `"mount":"secret","path":"web/prod","kvVersion":2,"key":"password"`,
+			map[string]interface{}{"environment": "prod", "password": "s3cret"}},
+		// the Vault secret comes after the ConfigMap in the valuesFrom, it wins
+		{"after a ConfigMap", []map[string]string{{"values.yaml": "replicas: 2\nregion: east\n"}}, `"mount":"secret","path":"web/prod","kvVersion":2`,
+			map[string]interface{}{"environment": "prod", "replicas": float64(4), "password": "s3cret", "region": "east"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			vault := fmt.Sprintf(`"address":%q,"role":"web","authMount":"kubernetes",%s`, server.URL, tt.vault)
+			merged, output, err := runMergeVaultValues(t, tmp, tt.valuesFrom, vault, "jwt")
+			if assert.NoError(t, err, output) {
+				assert.Equal(t, tt.expected, merged)
+			}
+			// the values are only written to the parameter file
+			_, err = os.Stat(filepath.Join(tmp, "vault-response"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestMergeVaultValuesFailures(t *testing.T) {
+	server := newMockVault(t)
+	defer server.Close()
+	tests := []struct {
+		name   string
+		role   string
+		jwt    string
+		vault  string
+		errMsg string
+	}{
+		{"authentication", "web", "expired", `"mount":"secret","path":"web/prod","kvVersion":2`,
+			fmt.Sprintf("Vault authentication at %s with the role web failed: HTTP 403 permission denied", server.URL)},
+		{"role", "ops", "jwt", `"mount":"secret","path":"web/prod","kvVersion":2`,
+			fmt.Sprintf("Vault authentication at %s with the role ops failed: HTTP 403", server.URL)},
+		{"path", "web", "jwt", `"mount":"secret","path":"web/staging","kvVersion":2`,
+			fmt.Sprintf("Vault secret web/staging not found in the secret mount of %s", server.URL)},
+		{"kv version", "web", "jwt", `"mount":"secret","path":"web/prod","kvVersion":1`,
+			fmt.Sprintf("Vault secret web/prod not found in the secret mount of %s", server.URL)},
+		{"key", "web", "jwt", `"mount":"secret","path":"web/prod","kvVersion":2,"key":"token"`,
+			"Vault secret web/prod has no key token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := tempDir(t)
+			defer os.RemoveAll(tmp)
+
+			vault := fmt.Sprintf(`"address":%q,"role":%q,"authMount":"kubernetes",%s`, server.URL, tt.role, tt.vault)
+			_, output, err := runMergeVaultValues(t, tmp, nil, vault, tt.jwt)
+			assert.Error(t, err)
+			assert.Contains(t, output, tt.errMsg)
+			// the failure is reported as a Vault failure
+			assert.Equal(t, "Vault", strings.TrimSpace(readFile(filepath.Join(tmp, "phase"))))
+		})
+	}
+
+	// Vault can't be reached
+	tmp := tempDir(t)
+	defer os.RemoveAll(tmp)
+	_, output, err := runMergeVaultValues(t, tmp, nil, `"address":"http://127.0.0.1:1","role":"web","authMount":"kubernetes","mount":"secret","path":"web","kvVersion":2`, "jwt")
+	assert.Error(t, err)
+	assert.Contains(t, output, "Unable to reach Vault at http://127.0.0.1:1")
+}
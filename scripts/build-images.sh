@@ -35,6 +35,14 @@ docker push ${REPOSITORY}/eunomia-base:${IMAGE_TAG}
 docker build template-processors/helm -t ${REPOSITORY}/eunomia-helm:${IMAGE_TAG}
 docker push ${REPOSITORY}/eunomia-helm:${IMAGE_TAG}
 
+# building and pushing kustomize template processor images
+docker build template-processors/kustomize -t ${REPOSITORY}/eunomia-kustomize:${IMAGE_TAG}
+docker push ${REPOSITORY}/eunomia-kustomize:${IMAGE_TAG}
+
+# building and pushing jsonnet template processor images
+docker build template-processors/jsonnet -t ${REPOSITORY}/eunomia-jsonnet:${IMAGE_TAG}
+docker push ${REPOSITORY}/eunomia-jsonnet:${IMAGE_TAG}
+
 # building and pushing OCP template processor images
 docker build template-processors/ocp-template -t ${REPOSITORY}/eunomia-ocp-templates:${IMAGE_TAG}
 docker push ${REPOSITORY}/eunomia-ocp-templates:${IMAGE_TAG}
@@ -42,3 +50,7 @@ docker push ${REPOSITORY}/eunomia-ocp-templates:${IMAGE_TAG}
 # building and pushing jinja template processor images
 docker build template-processors/jinja -t ${REPOSITORY}/eunomia-jinja:${IMAGE_TAG}
 docker push ${REPOSITORY}/eunomia-jinja:${IMAGE_TAG}
+
+# building and pushing Go template processor images, the renderer is built from the repository
+docker build . -f template-processors/gotemplate/Dockerfile -t ${REPOSITORY}/eunomia-gotemplate:${IMAGE_TAG}
+docker push ${REPOSITORY}/eunomia-gotemplate:${IMAGE_TAG}
@@ -0,0 +1,42 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+set -o pipefail
+
+# bounds the report of the run, read as JSON from stdin, to REPORT_MAX_SIZE bytes, 4096 by default, the size of the
+# termination message beyond which kubernetes truncates it into invalid JSON. The last entry of the longest list of
+# strings, e.g. the applied or the pruned resources, is dropped until the report fits, their counts are kept. Then the
+# lists of objects, e.g. the phases, are cut the same way, and as a last resort only the commits, whether the run
+# changed any resource, the summary of the inventory and when the run finished are reported.
+
+jq -c --argjson max ${REPORT_MAX_SIZE:-4096} '
+  def lists($scalars):
+    [paths(type == "array" and length > 0 and (if $scalars then all(.[]; type != "object" and type != "array") else true end))];
+  def bound:
+    if (tojson | utf8bytelength) <= $max then .
+    else . as $report
+      | (lists(true) | if length > 0 then . else ($report | lists(false)) end) as $lists
+      | if ($lists | length) == 0 then
+          {commit, parameterCommit, changed, managedResources, finished} | with_entries(select(.value != null))
+        else
+          ($lists | max_by(. as $path | $report | getpath($path) | tojson | utf8bytelength)) as $longest
+          | delpaths([$longest + [($report | getpath($longest) | length) - 1]])
+          | bound
+        end
+    end;
+  bound'
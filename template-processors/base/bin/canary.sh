@@ -0,0 +1,113 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+set -o pipefail
+
+# applies the canary before the other resources: the objects of MANIFEST_DIR labeled as CANARY_SELECTOR requires, in
+# the CANARY_NAMESPACES of the TARGET_NAMESPACES, all of them when either is unset. Once the Deployments, StatefulSets
+# and DaemonSets of the canary are rolled out within CANARY_HEALTH_TIMEOUT seconds, all the resources are applied.
+# Otherwise the run fails in the HealthCheck phase, the other resources being left as they are.
+
+bin=$(dirname $0)
+
+# the flags connecting kubectl to the cluster of the job, or to the remote cluster of TARGET_KUBECONFIG if any
+function clusterFlags {
+  if [ -n "${TARGET_KUBECONFIG:-}" ]; then
+    echo --kubeconfig=$TARGET_KUBECONFIG
+  else
+    echo -s https://kubernetes.default.svc:443 --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token 2> /dev/null) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+  fi
+}
+
+function kube {
+  $kubectl $(clusterFlags) --request-timeout=${REQUEST_TIMEOUT:-0} "$@"
+}
+
+# writes in the given file the objects of the manifest directory that CANARY_SELECTOR selects, as a List
+# Arguments: manifest-directory file
+function selectCanary {
+  local selector
+  selector=$(echo "${CANARY_SELECTOR:-}" | jq -R -c 'split(",") | map(select(. != "") | split("=") | {(.[0]): (.[1:] | join("="))}) | add // {}')
+  find $1 -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+    xargs -r yq -c --argjson selector "$selector" 'select(. != null) | if .kind == "List" then .items[] else . end
+      | (.metadata.labels // {}) as $labels | select(all($selector | to_entries[]; $labels[.key] == .value))' | \
+    jq -s '{apiVersion: "v1", kind: "List", items: .}' > $2
+}
+
+# waits until the workloads of the canary file are rolled out, until the deadline
+# Arguments: file namespace deadline
+function waitForCanary {
+  local namespace=()
+  if [ -n "$2" ]; then
+    namespace=(-n $2)
+  fi
+  for workload in $(jq -r '.items[] | select(.kind == "Deployment" or .kind == "StatefulSet" or .kind == "DaemonSet")
+      | (.kind | ascii_downcase) + "/" + .metadata.name' $1); do
+    local remaining=$(($3 - $(date +%s)))
+    if [ $remaining -le 0 ] || ! kube rollout status $workload ${namespace[@]+"${namespace[@]}"} --timeout=${remaining}s; then
+      echo "The canary $workload${2:+ of namespace $2} isn't healthy, the rollout is aborted" >&2
+      return 1
+    fi
+  done
+}
+
+# applies the resources of a namespace, or of the only namespace without TARGET_NAMESPACES
+# Arguments: manifest-directory namespace
+function applyNamespace {
+  if [ -n "$2" ]; then
+    NAMESPACE=$2 TARGET_NAMESPACE=$2 MANIFEST_DIR=$1 $bin/resourceManager.sh
+  else
+    MANIFEST_DIR=$1 $bin/resourceManager.sh
+  fi
+}
+
+namespaces=${CANARY_NAMESPACES:-${TARGET_NAMESPACES:-}}
+if [ -z "${TARGET_NAMESPACES:-}" ]; then
+  namespaces=.
+fi
+rm -rf $HOME/canary
+mkdir -p $HOME/canary
+deadline=$(($(date +%s) + ${CANARY_HEALTH_TIMEOUT:-300}))
+for namespace in $namespaces; do
+  dir=$MANIFEST_DIR/$namespace
+  namespace=${namespace#.}
+  mkdir -p $HOME/canary/$namespace
+  selectCanary $dir $HOME/canary/$namespace/canary.json
+  if [ "$(jq '.items | length' $HOME/canary/$namespace/canary.json)" == "0" ]; then
+    echo "No resource of the canary${namespace:+ in namespace $namespace}"
+    continue
+  fi
+  echo "Applying the canary${namespace:+ of namespace $namespace}"
+  applyNamespace $HOME/canary/$namespace "$namespace"
+done
+echo HealthCheck > $HOME/phase
+for namespace in $namespaces; do
+  namespace=${namespace#.}
+  if [ -s $HOME/canary/$namespace/canary.json ]; then
+    waitForCanary $HOME/canary/$namespace/canary.json "$namespace" $deadline
+  fi
+done
+echo "The canary is healthy, applying all the resources"
+echo Apply > $HOME/phase
+if [ -z "${TARGET_NAMESPACES:-}" ]; then
+  applyNamespace $MANIFEST_DIR ""
+fi
+for namespace in ${TARGET_NAMESPACES:-}; do
+  echo "Managing the resources of namespace $namespace"
+  applyNamespace $MANIFEST_DIR/$namespace $namespace
+done
@@ -0,0 +1,84 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+set -o pipefail
+
+## claims a shard of the manifests for the pod POD_NAME of the job JOB_NAME, whose SHARD_COUNT completions each apply one
+## shard, and prints its index. The claims are the ConfigMaps <JOB_NAME>-shard-<index> of the NAMESPACE of the job, owned
+## by the job through JOB_UID so that they are deleted with it. A pod claims the first shard that is neither applied nor
+## claimed by a pod still running, the pods replacing the failed ones taking over their shards. With "complete", the shard
+## SHARD_INDEX is recorded as applied instead, so that it isn't claimed again.
+
+function kube {
+  $kubectl -s https://kubernetes.default.svc:443 --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token 2> /dev/null) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt --request-timeout=${REQUEST_TIMEOUT:-0} "$@"
+}
+
+# prints the ConfigMap of the shard $1 claimed by POD_NAME, in the state $2, claimed or applied, with the
+# resourceVersion $3 when it replaces a claim, so that two pods can't take it over at once
+function claimManifest {
+  jq -n --arg name $JOB_NAME-shard-$1 --arg namespace $NAMESPACE --arg job $JOB_NAME --arg uid $JOB_UID \
+    --arg pod $POD_NAME --arg state $2 --arg version "${3:-}" \
+    '{apiVersion: "v1", kind: "ConfigMap",
+      metadata: ({name: $name, namespace: $namespace, labels: {"job-name": $job},
+        ownerReferences: [{apiVersion: "batch/v1", kind: "Job", name: $job, uid: $uid}]}
+        + if $version == "" then {} else {resourceVersion: $version} end),
+      data: {pod: $pod, state: $state}}'
+}
+
+# claims the shard $1, unless it is applied or claimed by another pod that didn't fail
+function claim {
+  local pod phase
+  if claimManifest $1 claimed | kube create -f - > /dev/null 2> $HOME/claim-error; then
+    return 0
+  fi
+  if ! grep -q "AlreadyExists" $HOME/claim-error; then
+    cat $HOME/claim-error >&2
+    echo "Unable to claim a shard, the service account of the job must be allowed to create, get and update the ConfigMaps and get the pods of namespace $NAMESPACE" >&2
+    exit 1
+  fi
+  kube get configmap $JOB_NAME-shard-$1 -o json > $HOME/claim.json
+  if [ "$(jq -r .data.state $HOME/claim.json)" == "applied" ]; then
+    return 1
+  fi
+  pod=$(jq -r .data.pod $HOME/claim.json)
+  if [ "$pod" != "$POD_NAME" ]; then
+    # a pod that can't be read is considered running
+    phase=$(kube get pod $pod --ignore-not-found -o jsonpath='{.status.phase}') || return 1
+    if [ -n "$phase" ] && [ "$phase" != "Failed" ]; then
+      return 1
+    fi
+    echo "Taking over shard $1 from pod $pod, ${phase:-deleted}" >&2
+  fi
+  claimManifest $1 claimed $(jq -r .metadata.resourceVersion $HOME/claim.json) | kube replace -f - > /dev/null 2>&1
+}
+
+if [ "${1:-claim}" == "complete" ]; then
+  claimManifest $SHARD_INDEX applied | kube replace -f - > /dev/null
+  echo "Shard $SHARD_INDEX of $SHARD_COUNT applied" >&2
+  exit 0
+fi
+
+for ((shard = 0; shard < SHARD_COUNT; shard++)); do
+  if claim $shard; then
+    echo "Claimed shard $shard of $SHARD_COUNT" >&2
+    echo $shard
+    exit 0
+  fi
+done
+echo "No shard is left to apply, the $SHARD_COUNT shards are applied or claimed by running pods" >&2
+exit 1
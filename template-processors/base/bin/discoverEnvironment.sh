@@ -18,12 +18,25 @@ set -o nounset
 set -o errexit
 
 function setContext {
+  if [ -n "${TARGET_KUBECONFIG:-}" ]; then
+    $kubectl --kubeconfig=$TARGET_KUBECONFIG config set-context --current --namespace=$(cat /var/run/secrets/kubernetes.io/serviceaccount/namespace)
+    return
+  fi
   $kubectl config set-context current --namespace=$(cat /var/run/secrets/kubernetes.io/serviceaccount/namespace)
   $kubectl config use-context current
 }
 
+# like in resourceManager.sh, the flags connecting kubectl to the cluster of the job, or to the remote cluster of TARGET_KUBECONFIG if any
+function clusterFlags {
+  if [ -n "${TARGET_KUBECONFIG:-}" ]; then
+    echo --kubeconfig=$TARGET_KUBECONFIG
+  else
+    echo -s https://kubernetes.default.svc:443 --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token 2> /dev/null) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+  fi
+}
+
 function kube {
-  $kubectl -s https://kubernetes.default.svc:443  --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt $@
+  $kubectl $(clusterFlags) $@
 }
 
 function getClusterCAs {
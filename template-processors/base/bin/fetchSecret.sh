@@ -0,0 +1,87 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+set -o pipefail
+
+# writes the git credentials kept in a cloud secret manager into a directory, as the files of a kubernetes secret
+# would be mounted. The secret is read with the workload identity of the pod, it is a JSON object mapping the file
+# names, e.g. .gitconfig or .git-credentials, to their content.
+# Arguments: provider path directory
+provider=$1
+path=$2
+dir=$3
+
+function fail {
+  echo "Unable to read the git credentials $path from the $provider secret manager: $1" >&2
+  exit 1
+}
+
+# reads a secret of AWS Secrets Manager, with the credentials of the pod, e.g. from IRSA
+function readAWSSecret {
+  local output
+  if ! output=$(aws secretsmanager get-secret-value --secret-id "$path" --query SecretString --output text 2>&1); then
+    fail "$output"
+  fi
+  echo "$output"
+}
+
+# reads a secret of Google Secret Manager, with the token of the service account of the pod from the metadata server
+function readGCPSecret {
+  local name=$path response token
+  if [[ $name != */versions/* ]]; then
+    name=$name/versions/latest
+  fi
+  if ! response=$(curl -sS -H "Metadata-Flavor: Google" "http://${GCE_METADATA_HOST:-metadata.google.internal}/computeMetadata/v1/instance/service-accounts/default/token" 2>&1); then
+    fail "no token from the metadata server: $response"
+  fi
+  token=$(echo "$response" | jq -r '.access_token // empty' 2>/dev/null || true)
+  if [ -z "$token" ]; then
+    fail "no token from the metadata server: $response"
+  fi
+  if ! response=$(curl -sS -H "Authorization: Bearer $token" "https://secretmanager.googleapis.com/v1/$name:access" 2>&1); then
+    fail "$response"
+  fi
+  # errors are returned as {"error": {"code": 403, "message": "...", "status": "PERMISSION_DENIED"}}
+  if echo "$response" | jq -e '.error' >/dev/null 2>&1; then
+    fail "$(echo "$response" | jq -r '"\(.error.status): \(.error.message)"')"
+  fi
+  echo "$response" | jq -r '.payload.data' | base64 -d
+}
+
+case $provider in
+  AWS)
+    secret=$(readAWSSecret)
+    ;;
+  GCP)
+    secret=$(readGCPSecret)
+    ;;
+  *)
+    fail "unknown provider"
+    ;;
+esac
+
+if ! echo "$secret" | jq -e 'type == "object"' >/dev/null 2>&1; then
+  fail "the secret is not a JSON object mapping file names to their content"
+fi
+mkdir -p $dir
+while IFS= read -r file; do
+  if [[ $file == */* ]] || [ "$file" == "." ] || [ "$file" == ".." ]; then
+    fail "$file is not a file name"
+  fi
+  echo "$secret" | jq -j --arg file "$file" '.[$file]' > "$dir/$file"
+done < <(echo "$secret" | jq -r 'keys[]')
@@ -0,0 +1,111 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+
+## removes the files of the template directory, or of each of TEMPLATE_CONTEXT_DIRS, that aren't rendered: the files
+## matching one of TEMPLATE_EXCLUDE_PATTERNS are removed first, then, with TEMPLATE_INCLUDE_PATTERNS, the files matching
+## none of them. The patterns are matched against the path of the files relative to their directory: * and ? don't match
+## a /, ** matches any number of directories, a pattern without a / matches a file or directory name at any depth, and a
+## pattern matching a directory matches all the files below it.
+
+if [ -z "${TEMPLATE_EXCLUDE_PATTERNS:-}" ] && [ -z "${TEMPLATE_INCLUDE_PATTERNS:-}" ]; then
+  exit 0
+fi
+# the patterns are split on spaces without being expanded against the files of the current directory
+set -o noglob
+
+# globRegex prints the extended regular expression matching the paths matched by the glob pattern $1
+function globRegex {
+  local glob=${1%/} regex="" anchored=false i c
+  if [[ $glob == */* ]]; then
+    anchored=true
+    glob=${glob#/}
+  fi
+  for ((i = 0; i < ${#glob}; i++)); do
+    c=${glob:i:1}
+    case "$c" in
+    '*')
+      if [ "${glob:i:3}" == "**/" ]; then
+        regex+="(.*/)?"
+        i=$((i + 2))
+      elif [ "${glob:i:2}" == "**" ]; then
+        regex+=".*"
+        i=$((i + 1))
+      else
+        regex+="[^/]*"
+      fi ;;
+    '?')
+      regex+="[^/]" ;;
+    '[')
+      if [ "${glob:i+1:1}" == "!" ]; then
+        regex+="[^"
+        i=$((i + 1))
+      else
+        regex+="["
+      fi ;;
+    '.'|'+'|'('|')'|'|'|'^'|'$'|'{'|'}'|'\')
+      regex+="\\$c" ;;
+    *)
+      regex+="$c" ;;
+    esac
+  done
+  if $anchored; then
+    echo "^$regex(/|\$)"
+  else
+    echo "(^|/)$regex(/|\$)"
+  fi
+}
+
+# patternFile writes the regular expressions of the glob patterns $1 in a file, and prints its name
+function patternFile {
+  local file=$(mktemp) pattern
+  for pattern in $1; do
+    globRegex "$pattern" >> $file
+  done
+  echo $file
+}
+
+# filterDir removes the files of the directory $1 that aren't rendered, its .git directory excepted
+function filterDir {
+  local dir=$1 files kept removed
+  files=$(mktemp)
+  kept=$(mktemp)
+  (cd $dir && find . -path ./.git -prune -o -type f -print | sed 's|^\./||' | LC_ALL=C sort) > $files
+  cp $files $kept
+  if [ -n "${TEMPLATE_EXCLUDE_PATTERNS:-}" ]; then
+    grep -vE -f $(patternFile "$TEMPLATE_EXCLUDE_PATTERNS") $files > $kept || true
+  fi
+  if [ -n "${TEMPLATE_INCLUDE_PATTERNS:-}" ]; then
+    grep -E -f $(patternFile "$TEMPLATE_INCLUDE_PATTERNS") $kept > $kept.included || true
+    mv $kept.included $kept
+  fi
+  removed=0
+  while IFS= read -r file; do
+    rm -f "$dir/$file"
+    removed=$((removed + 1))
+  done < <(LC_ALL=C comm -23 $files $kept)
+  echo "Excluded $removed of the $(wc -l < $files | tr -d ' ') files of $dir from the render"
+}
+
+if [ -z "${TEMPLATE_CONTEXT_DIRS:-}" ]; then
+  filterDir $CLONED_TEMPLATE_GIT_DIR
+else
+  for dir in $TEMPLATE_CONTEXT_DIRS; do
+    filterDir $TEMPLATE_GIT_DIR/$dir
+  done
+fi
@@ -17,67 +17,155 @@
 set -o nounset
 set -o errexit
 
-function pullFromTemplatesRepo {
-  set +u
-  if [ ! -z "$TEMPLATE_GIT_HTTP_PROXY" ] 
+# clones a git repository with its own proxies and gitconfig, so that the template and parameter
+# sources don't share their ref, credentials or proxies. The TLS certificates of the insecure hosts
+# are not verified, when there are none the certificates are only verified with a gitconfig or a CA bundle.
+# A depth above 0 fetches that many commits of the ref only, a shallow clone still resolving the commit it checks out.
+# Arguments: uri ref directory gitconfig-directory http-proxy https-proxy no-proxy insecure-hosts known-hosts insecure-host-key
+# depth single-branch
+function cloneRepo {
+  local uri=$1 ref=$2 dir=$3 gitconfig=$4 insecure=${8:-} knownHosts=${9:-} insecureHostKey=${10:-} depth=${11:-0} singleBranch=${12:-}
+  # the gitconfig and credentials files of the secret are used from a home of their own
+  local home=$(mktemp -d)
+  local env=(HOME=$home http_proxy=${5:-${http_proxy:-}} https_proxy=${6:-${https_proxy:-}} no_proxy=${7:-${no_proxy:-}})
+  local config=()
+  if [ -n "$gitconfig" ] && [ -d "$gitconfig" ]
   then
-    http_proxy=$TEMPLATE_GIT_HTTP_PROXY
+    for file in $gitconfig/* $gitconfig/.git*; do
+      if [ -f "$file" ]; then
+        cp -f $file $home/$(basename $file)
+      fi
+    done
+  elif [ -z "$insecure" ] && [ -z "${CA_BUNDLE:-}" ]; then
+    env+=(GIT_SSL_NO_VERIFY=true)
   fi
-  if [ ! -z "$TEMPLATE_GIT_HTTPS_PROXY" ] 
-  then
-    https_proxy=$TEMPLATE_GIT_HTTPS_PROXY
-  fi 
-  if [ ! -z "$TEMPLATE_GIT_NO_PROXY" ] 
-  then
-    no_proxy=$TEMPLATE_GIT_NO_PROXY
+  # the deploy key of a kubernetes.io/ssh-auth secret clones the SSH URIs. The host keys are verified against
+  # the known_hosts of the secret and of the source, unless they are ignored for an air-gapped git server
+  if [ -f "$home/ssh-privatekey" ]; then
+    chmod 600 $home/ssh-privatekey
+    local ssh="ssh -i $home/ssh-privatekey -o IdentitiesOnly=yes"
+    if [ "$insecureHostKey" == "true" ]; then
+      ssh+=" -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null"
+    else
+      touch $home/known_hosts
+      if [ -n "$knownHosts" ]; then
+        echo "$knownHosts" >> $home/known_hosts
+      fi
+      ssh+=" -o StrictHostKeyChecking=yes -o UserKnownHostsFile=$home/known_hosts"
+    fi
+    env+=(GIT_SSH_COMMAND="$ssh")
   fi
-  if [ -z "$TEMPLATE_GITCONFIG" ] && [ -d "$TEMPLATE_GITCONFIG" ]
-  then
-    for file in $TEMPLATE_GITCONFIG/*; do
-      cp -f $file ~/$(basename $file)
-    done
-    for file in $TEMPLATE_GITCONFIG/.git*; do
-      cp -f $file ~/$(basename $file)
-    done      
-  else
-   export GIT_SSL_NO_VERIFY=true
-  fi 
-  set -u
-  mkdir -p $TEMPLATE_GIT_DIR
-  git clone -b $TEMPLATE_GIT_REF $TEMPLATE_GIT_URI $TEMPLATE_GIT_DIR
+  for host in $insecure; do
+    config+=(-c "http.https://$host/.sslVerify=false")
+  done
+  local options=()
+  if [ "$depth" -gt 0 ]; then
+    options+=(--depth $depth)
+  fi
+  # a shallow clone fetches the ref alone unless told otherwise
+  if [ "$singleBranch" == "true" ]; then
+    options+=(--single-branch)
+  elif [ "$singleBranch" == "false" ]; then
+    options+=(--no-single-branch)
+  fi
+  mkdir -p $dir
+  env "${env[@]}" git ${config[@]+"${config[@]}"} clone ${options[@]+"${options[@]}"} -b $ref $uri $dir
 }
 
-function pullFromParametersRepo {
-  set +u
-  if [ ! -z "$PARAMETER_GIT_HTTP_PROXY" ] 
-  then
-    http_proxy=$PARAMETER_GIT_HTTP_PROXY
-  fi
-  if [ ! -z "$PARAMETER_GIT_HTTPS_PROXY" ] 
-  then
-    https_proxy=$PARAMETER_GIT_HTTPS_PROXY
-  fi 
-  if [ ! -z "$PARAMETER_GIT_NO_PROXY" ] 
-  then
-    no_proxy=$PARAMETER_GIT_NO_PROXY
+# the errors of git telling that the host of a repository can't be reached. Authentication failures and missing
+# repositories or refs aren't among them, a mirror wouldn't fix them
+networkErrors="Could not resolve host|Could not resolve hostname|Temporary failure in name resolution|Failed to connect|Connection refused|Connection timed out|Operation timed out|Network is unreachable|No route to host|Connection reset|Recv failure|The requested URL returned error: 50[0-9]|ssh: connect to host"
+
+# prints the gitconfig directory of mirror among the mirror=directory pairs of the mirrors with their own secret, or
+# the default one of the source
+# Arguments: mirror mirror-gitconfigs default-gitconfig
+function mirrorGitconfig {
+  local mirror=$1 pairs=$2 gitconfig=$3
+  for pair in $pairs; do
+    if [ "${pair%=*}" == "$mirror" ]; then
+      gitconfig=${pair##*=}
+    fi
+  done
+  echo "$gitconfig"
+}
+
+# clones a repository from its uri or, when its host can't be reached, from the first of its mirrors that can be
+# cloned, in order. The mirrors listed in mirror-gitconfigs, as mirror=directory pairs, are cloned with the gitconfig
+# of their own secret instead of the one of the source. The mirror that was cloned, if any, is written in the mirror file.
+# Arguments: uri mirrors mirror-gitconfigs mirror-file ref directory, followed by the other arguments of cloneRepo
+function cloneWithMirrors {
+  local uri=$1 mirrors=$2 gitconfigs=$3 record=$4 errors=$(mktemp) rc=0
+  shift 4
+  cloneRepo $uri "$@" 2> $errors || rc=$?
+  cat $errors >&2
+  local args
+  for mirror in $mirrors; do
+    if [ $rc -eq 0 ] || ! grep -qE "$networkErrors" $errors; then
+      break
+    fi
+    echo "$uri can't be reached, cloning its mirror $mirror"
+    rm -rf $2
+    rc=0
+    args=("$@")
+    args[2]=$(mirrorGitconfig $mirror "$gitconfigs" "$3")
+    cloneRepo $mirror "${args[@]}" 2> $errors || rc=$?
+    cat $errors >&2
+    if [ $rc -eq 0 ]; then
+      echo $mirror > $record
+    fi
+  done
+  return $rc
+}
+
+# prints the directory holding the gitconfig and credentials files of a source: the mounted kubernetes
+# secret, or a new directory where the secret of a cloud secret manager is written
+# Arguments: gitconfig-directory secret-provider secret-path
+function gitconfigDir {
+  local gitconfig=$1 provider=$2 path=$3
+  if [ -n "$provider" ]; then
+    gitconfig=$(mktemp -d)
+    /usr/local/bin/fetchSecret.sh $provider "$path" $gitconfig >&2 || exit 1
   fi
-  if [ -z "$PARAMETER_GITCONFIG" ] && [ -d "$PARAMETER_GITCONFIG" ]
-  then 
-    for file in $TEMPLATE_GITCONFIG/*; do
-      cp -f $file ~/$(basename $file)
-    done
-    for file in $TEMPLATE_GITCONFIG/.git*; do
-      cp -f $file ~/$(basename $file)
-    done    
-  else
-   export GIT_SSL_NO_VERIFY=true
-  fi    
-  set -u
-  mkdir -p $PARAMETER_GIT_DIR
-  git clone -b $PARAMETER_GIT_REF $PARAMETER_GIT_URI $PARAMETER_GIT_DIR
+  echo "$gitconfig"
+}
+
+function pullFromTemplatesRepo {
+  local gitconfig
+  gitconfig=$(gitconfigDir "${TEMPLATE_GITCONFIG:-}" "${TEMPLATE_GIT_SECRET_PROVIDER:-}" "${TEMPLATE_GIT_SECRET_PATH:-}")
+  cloneWithMirrors $TEMPLATE_GIT_URI "${TEMPLATE_GIT_MIRRORS:-}" "${TEMPLATE_GIT_MIRROR_GITCONFIGS:-}" $HOME/template-mirror $TEMPLATE_GIT_REF $TEMPLATE_GIT_DIR "$gitconfig" \
+    "${TEMPLATE_GIT_HTTP_PROXY:-}" "${TEMPLATE_GIT_HTTPS_PROXY:-}" "${TEMPLATE_GIT_NO_PROXY:-}" "${TEMPLATE_GIT_INSECURE_HOSTS:-}" \
+    "${TEMPLATE_GIT_KNOWN_HOSTS:-}" "${TEMPLATE_GIT_INSECURE_HOST_KEY:-}" "${TEMPLATE_GIT_CLONE_DEPTH:-0}" "${TEMPLATE_GIT_SINGLE_BRANCH:-}"
+}
+
+function pullFromParametersRepo {
+  local gitconfig
+  gitconfig=$(gitconfigDir "${PARAMETER_GITCONFIG:-}" "${PARAMETER_GIT_SECRET_PROVIDER:-}" "${PARAMETER_GIT_SECRET_PATH:-}")
+  cloneWithMirrors $PARAMETER_GIT_URI "${PARAMETER_GIT_MIRRORS:-}" "${PARAMETER_GIT_MIRROR_GITCONFIGS:-}" $HOME/parameter-mirror $PARAMETER_GIT_REF $PARAMETER_GIT_DIR "$gitconfig" \
+    "${PARAMETER_GIT_HTTP_PROXY:-}" "${PARAMETER_GIT_HTTPS_PROXY:-}" "${PARAMETER_GIT_NO_PROXY:-}" "${PARAMETER_GIT_INSECURE_HOSTS:-}" \
+    "${PARAMETER_GIT_KNOWN_HOSTS:-}" "${PARAMETER_GIT_INSECURE_HOST_KEY:-}" "${PARAMETER_GIT_CLONE_DEPTH:-0}" "${PARAMETER_GIT_SINGLE_BRANCH:-}"
 }
 
 echo Cloning Repositories
 pullFromTemplatesRepo
-pullFromParametersRepo
+# the operator tells when both sources are the same repository and ref, the parameters are then copied from the
+# template clone instead of being cloned again. The copy keeps the files written by the processors in one of them apart
+if [ "${SHARED_GIT_CLONE:-false}" == "true" ]; then
+  echo "The parameter source is the template source, reusing its clone"
+  mkdir -p $(dirname $PARAMETER_GIT_DIR)
+  cp -a $TEMPLATE_GIT_DIR $PARAMETER_GIT_DIR
+  if [ -f $HOME/template-mirror ]; then
+    cp $HOME/template-mirror $HOME/parameter-mirror
+  fi
+else
+  pullFromParametersRepo
+fi
+# the parameter file resolved by the operator replaces the default one of the template processor
+if [ -n "${PARAMETER_FILE:-}" ] && [ ! -f "$CLONED_PARAMETER_GIT_DIR/$PARAMETER_FILE" ]; then
+  echo "Parameter file $PARAMETER_FILE not found in the parameter source" >&2
+  exit 1
+fi
 mkdir -p $MANIFEST_DIR
+# keep the subject of the applied commit, so that it can be reported to the operator
+git -C $TEMPLATE_GIT_DIR log -1 --format=%s | cut -c1-200 > $HOME/commit-message
+git -C $TEMPLATE_GIT_DIR rev-parse HEAD > $HOME/commit
+git -C $PARAMETER_GIT_DIR rev-parse HEAD > $HOME/parameter-commit
@@ -0,0 +1,68 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+set -o pipefail
+
+# prints the namespaces to prune: the ones of PRUNE_NAMESPACES, from the inventory in the status of the GitOpsConfig,
+# and the namespaces of the resources in the inventory ConfigMap written by storeInventory.sh that aren't in
+# TARGET_NAMESPACES anymore. The status only has the inventory reported by the last job, which can be cut to fit in
+# its termination message, while the ConfigMap keeps all the resources of the last run that stored it. Without the
+# ConfigMap, e.g. before the first run or when the job can't read it, only PRUNE_NAMESPACES are pruned. The service
+# account of the job must be allowed to get the namespaces too.
+
+function kube {
+  $kubectl -s https://kubernetes.default.svc:443 --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token 2> /dev/null) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt --request-timeout=${REQUEST_TIMEOUT:-0} "$@"
+}
+
+function inventoryResources {
+  if [ -z "${GITOPSCONFIG:-}" ]; then
+    return
+  fi
+  local namespace=${GITOPSCONFIG%%/*}
+  local name=gitopsconfig-${GITOPSCONFIG#*/}-inventory
+  if ! kube get configmap $name -n $namespace -o json > $HOME/previous-inventory.json 2> $HOME/previous-inventory.err; then
+    if ! grep -q NotFound $HOME/previous-inventory.err; then
+      echo "Unable to read the inventory in ConfigMap $namespace/$name, only the namespaces in the status of the GitOpsConfig are pruned" >&2
+    fi
+    return
+  fi
+  if [ "$(jq -r '.binaryData["resources.gz"] // ""' $HOME/previous-inventory.json)" != "" ]; then
+    jq -r '.binaryData["resources.gz"]' $HOME/previous-inventory.json | base64 -d | gunzip
+  else
+    jq -r '.data.resources // empty' $HOME/previous-inventory.json
+  fi
+}
+
+# the namespaces deleted since, whose resources went away with them, are forgotten like the operator does for the status
+function existingNamespaces {
+  while read namespace; do
+    if kube get namespace $namespace -o name > /dev/null 2> $HOME/namespace.err || ! grep -q NotFound $HOME/namespace.err; then
+      echo $namespace
+    fi
+  done
+}
+
+# the lines are <apiVersion>/<kind> <namespace>/<name>, the cluster-scoped resources have no namespace
+{
+  echo ${PRUNE_NAMESPACES:-} | tr ' ' '\n'
+  inventoryResources | awk '$2 ~ /\// { split($2, parts, "/"); print parts[1] }' | sort -u | awk -v known="${PRUNE_NAMESPACES:-}" '
+    BEGIN { split(known, list, " "); for (i in list) { prune[list[i]] = 1 } }
+    !prune[$0]' | existingNamespaces
+} | awk -v targets="${TARGET_NAMESPACES:-}" '
+  BEGIN { split(targets, list, " "); for (i in list) { target[list[i]] = 1 } }
+  $0 != "" && !target[$0] && !seen[$0]++' | paste -sd' ' -
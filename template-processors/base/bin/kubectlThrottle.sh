@@ -0,0 +1,42 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+
+# runs KUBECTL with the arguments it is given, at most KUBE_API_QPS times per second with bursts of KUBE_API_BURST
+# calls, the client side rate limits of the operator. kubectl doesn't expose its own limits, so the calls are paced
+# instead of their requests. The token bucket, the time of the last call and the tokens left, is shared by all the
+# steps of the job in $HOME/kube-api-tokens.
+
+bucket=$HOME/kube-api-tokens
+read wait last tokens <<< $(awk -v now=$(date +%s.%N) -v qps=$KUBE_API_QPS -v burst=${KUBE_API_BURST:-0} \
+  -v state="$(cat $bucket 2> /dev/null || true)" 'BEGIN {
+    if (burst < 1) burst = 1
+    last = now; tokens = burst
+    if (split(state, s, " ") == 2) { last = s[1]; tokens = s[2] }
+    # the previous calls may be waiting for their turn
+    start = now > last ? now : last
+    tokens += (start - last) * qps
+    if (tokens > burst) tokens = burst
+    if (tokens < 1) { start += (1 - tokens) / qps; tokens = 1 }
+    printf "%.3f %.6f %.6f\n", start - now, start, tokens - 1
+  }')
+echo "$last $tokens" > $bucket
+if [ "$wait" != "0.000" ]; then
+  sleep $wait
+fi
+exec $KUBECTL "$@"
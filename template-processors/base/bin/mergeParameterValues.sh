@@ -0,0 +1,129 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+
+## the ConfigMaps and Secrets of the valuesFrom of the parameter source are mounted in $PARAMETER_VALUES_DIR/<n>, in order.
+## The Vault secrets are listed in PARAMETER_VALUES_VAULT with their position <n>, and read when the job starts.
+## Their values are merged, the later ones winning, then merged into the parameter file, which wins unless
+## PARAMETER_VALUES_PRECEDENCE is ValuesFrom. The keys ending in .yaml or .yml are YAML maps, the other keys are values.
+
+if [ -z "${PARAMETER_VALUES_DIR:-}" ]; then
+  exit 0
+fi
+
+echo Merging parameter values
+
+# valuesOf prints as JSON the values of the key mounted in the file $1
+function valuesOf {
+  case "$1" in
+  *.yaml|*.yml)
+    yq . "$1" ;;
+  *)
+    jq -n --arg key "$(basename "$1")" --rawfile value "$1" '{($key): $value}' ;;
+  esac
+}
+
+# vaultErrors prints the errors of the Vault response in $HOME/vault-response
+function vaultErrors {
+  jq -r '(.errors // []) | join(", ")' $HOME/vault-response 2>/dev/null || true
+}
+
+# readVault prints as JSON the values of the Vault secret described by the JSON object $1, after logging in with the
+# Kubernetes auth method and the token of the service account of the pod. The values are never written to the cluster.
+function readVault {
+  local address role authMount mount path kvVersion key jwt code token url filter
+  address=$(jq -r .address <<< "$1")
+  role=$(jq -r .role <<< "$1")
+  authMount=$(jq -r .authMount <<< "$1")
+  mount=$(jq -r .mount <<< "$1")
+  path=$(jq -r .path <<< "$1")
+  kvVersion=$(jq -r .kvVersion <<< "$1")
+  key=$(jq -r '.key // ""' <<< "$1")
+  jwt=$(cat "${VAULT_SERVICE_ACCOUNT_TOKEN:-/var/run/secrets/kubernetes.io/serviceaccount/token}")
+  code=$(jq -n --arg role "$role" --arg jwt "$jwt" '{role: $role, jwt: $jwt}' |
+    curl -sS -o $HOME/vault-response -w '%{http_code}' -X POST --data @- "$address/v1/auth/$authMount/login") || {
+    echo "Unable to reach Vault at $address" >&2
+    return 1
+  }
+  if [ "$code" != "200" ]; then
+    echo "Vault authentication at $address with the role $role failed: HTTP $code $(vaultErrors)" >&2
+    return 1
+  fi
+  token=$(jq -r .auth.client_token $HOME/vault-response)
+  if [ "$kvVersion" == "1" ]; then
+    url="$address/v1/$mount/$path"
+    filter=.data
+  else
+    url="$address/v1/$mount/data/$path"
+    filter=.data.data
+  fi
+  code=$(curl -sS -o $HOME/vault-response -w '%{http_code}' -H "X-Vault-Token: $token" "$url") || {
+    echo "Unable to reach Vault at $address" >&2
+    return 1
+  }
+  case "$code" in
+  200) ;;
+  404)
+    echo "Vault secret $path not found in the $mount mount of $address" >&2
+    rm -f $HOME/vault-response
+    return 1 ;;
+  *)
+    echo "Unable to read the Vault secret $path in the $mount mount of $address: HTTP $code $(vaultErrors)" >&2
+    rm -f $HOME/vault-response
+    return 1 ;;
+  esac
+  if [ -n "$key" ]; then
+    filter="$filter | if has(\$key) then {(\$key): .[\$key]} else error(\"Vault secret $path has no key \(\$key)\") end"
+  fi
+  jq --arg key "$key" "$filter" $HOME/vault-response || {
+    rm -f $HOME/vault-response
+    return 1
+  }
+  rm -f $HOME/vault-response
+}
+
+# the keys are the files of the mounted directories, the hidden ..data entries being the internals of the volume
+vaultValues="${PARAMETER_VALUES_VAULT:-[]}"
+: > $HOME/parameter-values.json
+for index in $({ ls -1 $PARAMETER_VALUES_DIR 2>/dev/null || true; jq -r '.[].index' <<< "$vaultValues"; } | sort -n); do
+  vault=$(jq -c --argjson index "$index" '.[] | select(.index == $index)' <<< "$vaultValues")
+  if [ -n "$vault" ]; then
+    echo Vault > $HOME/phase
+    readVault "$vault" >> $HOME/parameter-values.json
+    echo Render > $HOME/phase
+    continue
+  fi
+  for key in $(ls -1 $PARAMETER_VALUES_DIR/$index | sort); do
+    valuesOf "$PARAMETER_VALUES_DIR/$index/$key" >> $HOME/parameter-values.json
+  done
+done
+
+parameterFile="$CLONED_PARAMETER_GIT_DIR/${PARAMETER_FILE:-values.yaml}"
+: > $HOME/git-parameters.json
+if [ -f "$parameterFile" ]; then
+  yq . "$parameterFile" > $HOME/git-parameters.json
+fi
+
+merge='reduce .[] as $values ({}; if $values == null then . elif ($values | type) == "object" then . * $values else error("parameter values must be YAML maps") end)'
+if [ "${PARAMETER_VALUES_PRECEDENCE:-Git}" == "ValuesFrom" ]; then
+  jq -s "$merge" $HOME/git-parameters.json $HOME/parameter-values.json > $HOME/parameters.json
+else
+  jq -s "$merge" $HOME/parameter-values.json $HOME/git-parameters.json > $HOME/parameters.json
+fi
+mkdir -p "$(dirname "$parameterFile")"
+yq -y . $HOME/parameters.json > "$parameterFile"
@@ -0,0 +1,102 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+set -o pipefail
+
+# checks, before anything is applied, that the manifests of MANIFEST_DIR fit in the ResourceQuotas of NAMESPACE. The
+# compute resources of the pods of the workloads, scaled by their replicas, and the storage of the claims are compared
+# with the ones of the live objects they replace: the difference must fit in what the quotas have left. The exceeded
+# quotas are listed and the script fails.
+
+# the flags connecting kubectl to the cluster of the job, or to the remote cluster of TARGET_KUBECONFIG if any
+function clusterFlags {
+  if [ -n "${TARGET_KUBECONFIG:-}" ]; then
+    echo --kubeconfig=$TARGET_KUBECONFIG
+  else
+    echo -s https://kubernetes.default.svc:443 --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token 2> /dev/null) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+  fi
+}
+
+function kube {
+  $kubectl $(clusterFlags) --request-timeout=${REQUEST_TIMEOUT:-0} "$@"
+}
+
+# the jq functions computing the quota usage of objects
+read -r -d '' usage <<'EOF' || true
+# the value of a quantity, e.g. 500m or 1Gi, in thousandths to stay exact on the millicores
+def quantity:
+  tostring | capture("^(?<n>[0-9.]+(e[0-9]+)?)(?<s>[a-zA-Z]*)$") as $q
+  | ($q.n | tonumber) * 1000 * {"": 1, "m": 0.001, "k": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15, "E": 1e18,
+      "Ki": 1024, "Mi": 1048576, "Gi": 1073741824, "Ti": 1099511627776, "Pi": 1125899906842624, "Ei": 1152921504606846976}[$q.s]
+  | round;
+# a quantity in thousandths printed back in its unit
+def display: if . % 1000 == 0 then . / 1000 | tostring else tostring + "m" end;
+# the requests default to the limits, like the API server does
+def amount($kind; $resource):
+  (.resources[$kind][$resource] // (if $kind == "requests" then .resources.limits[$resource] else null end) // 0) | quantity;
+# the compute resources of a pod, the largest init container is counted when it needs more than the containers
+def pod:
+  . as $spec
+  | reduce ("requests", "limits") as $kind ({pods: 1000};
+      reduce ("cpu", "memory") as $resource (.;
+        .[$kind + "." + $resource] = ([([$spec.containers[]? | amount($kind; $resource)] | add // 0), ($spec.initContainers[]? | amount($kind; $resource))] | max)));
+def scale($n): map_values(. * $n);
+def usage:
+  if .kind == "Pod" then .spec | pod
+  elif .kind == "Deployment" or .kind == "ReplicaSet" or .kind == "StatefulSet" or .kind == "ReplicationController" then
+    .spec.replicas as $n | .spec.template.spec | pod | scale($n // 1)
+  elif .kind == "Job" then .spec.parallelism as $n | .spec.template.spec | pod | scale($n // 1)
+  elif .kind == "PersistentVolumeClaim" then {"requests.storage": (.spec.resources.requests.storage // 0 | quantity), persistentvolumeclaims: 1000}
+  else {} end;
+def total: reduce (.[] | usage | to_entries[]) as $e ({}; .[$e.key] += $e.value);
+EOF
+
+# the rendered objects that are applied into NAMESPACE
+rendered=$(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+  xargs -r yq -c --arg namespace $NAMESPACE 'select(. != null) | if .kind == "List" then .items[] else . end | select((.metadata.namespace // $namespace) == $namespace)' | \
+  jq -s -c .)
+if [ "$rendered" == "[]" ]; then
+  exit 0
+fi
+quotas=$(kube get resourcequota -n $NAMESPACE -o json)
+if [ "$(echo "$quotas" | jq '.items | length')" == "0" ]; then
+  echo "No ResourceQuota in namespace $NAMESPACE"
+  exit 0
+fi
+# the live objects replaced by the manifests, whose usage is already counted by the quotas
+if ! live=$(kube get -R -f $MANIFEST_DIR -n $NAMESPACE -o json --ignore-not-found 2> $HOME/quota-errors); then
+  echo "Unable to look up the live resources, checking the quotas as if none existed: $(cat $HOME/quota-errors)" >&2
+  live=""
+fi
+live=$(echo "$live" | jq -s -c '[.[] | if .kind == "List" then .items[] else . end]')
+
+exceeded=$(echo "$quotas" | jq -r --argjson rendered "$rendered" --argjson live "$live" "$usage"'
+  ($rendered | total) as $new | ($live | total) as $old
+  | .items[] | . as $quota
+  | (.status.hard // {}) | to_entries[]
+  | (.key | if . == "cpu" or . == "memory" then "requests." + . else . end) as $key
+  | select($new[$key] != null or $old[$key] != null)
+  | (($quota.status.used[.key] // 0 | quantity) + ($new[$key] // 0) - ($old[$key] // 0)) as $needed
+  | select($needed > (.value | quantity))
+  | "ResourceQuota \($quota.metadata.name): \(.key) would reach \($needed | display) over its hard limit of \(.value)"')
+if [ -n "$exceeded" ]; then
+  echo "The resources don't fit in the ResourceQuotas of namespace $NAMESPACE, nothing is applied:" >&2
+  echo "$exceeded" >&2
+  exit 1
+fi
+echo "The resources fit in the ResourceQuotas of namespace $NAMESPACE"
@@ -0,0 +1,71 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+
+## renders the templates of the cloned template source into $MANIFEST_DIR with the processTemplates.sh of the image,
+## for the runs of the operator and for kubectl eunomia render, which runs it locally
+
+bin=$(dirname $0)
+
+# with TEMPLATE_CONTEXT_DIRS, the directories of the template repository are rendered in order, each into its own
+# directory of $MANIFEST_DIR, and applied together. A directory that fails to render fails the run before anything is
+# applied, unless CONTINUE_ON_ERROR is set: its partial manifests are then discarded and it is listed in
+# $HOME/failed-context-dirs, to be reported to the operator. The run fails if none of them renders.
+function renderTemplates {
+  if [ -z "${TEMPLATE_CONTEXT_DIRS:-}" ]; then
+    $bin/processTemplates.sh
+    return
+  fi
+  local dir output index=0 rendered=0
+  for dir in $TEMPLATE_CONTEXT_DIRS; do
+    index=$((index + 1))
+    output=$MANIFEST_DIR/$(printf %03d $index)
+    mkdir -p $output
+    echo "Rendering the template directory $dir"
+    if CLONED_TEMPLATE_GIT_DIR=$TEMPLATE_GIT_DIR/$dir MANIFEST_DIR=$output $bin/processTemplates.sh; then
+      rendered=$((rendered + 1))
+      continue
+    fi
+    if [ "${CONTINUE_ON_ERROR:-false}" != "true" ]; then
+      echo "The template directory $dir failed to render, nothing is applied" >&2
+      return 1
+    fi
+    echo "The template directory $dir failed to render, continuing with the other directories" >&2
+    rm -rf $output
+    echo $dir >> $HOME/failed-context-dirs
+  done
+  if [ $rendered -eq 0 ]; then
+    echo "None of the template directories rendered, nothing is applied" >&2
+    return 1
+  fi
+}
+
+# with TARGET_NAMESPACES the templates are rendered for each target namespace, which they get as $NAMESPACE, into its own
+# directory of $MANIFEST_DIR. The namespaces that aren't targeted anymore, in PRUNE_NAMESPACES, are rendered too, into
+# $HOME/prune, to delete their resources. All are rendered before any is applied.
+if [ -z "${TARGET_NAMESPACES:-}" ]; then
+  renderTemplates
+fi
+for namespace in ${TARGET_NAMESPACES:-}; do
+  mkdir -p $MANIFEST_DIR/$namespace
+  NAMESPACE=$namespace MANIFEST_DIR=$MANIFEST_DIR/$namespace renderTemplates
+done
+for namespace in ${PRUNE_NAMESPACES:-}; do
+  mkdir -p $HOME/prune/$namespace
+  NAMESPACE=$namespace MANIFEST_DIR=$HOME/prune/$namespace renderTemplates
+done
@@ -18,13 +18,154 @@ set -o nounset
 set -o errexit
 
 # this is needed becasue we want the current namespace to be set as default if a namespace is not specified.
+# It is the TARGET_NAMESPACE the resources are applied into, if any, the namespace of the job otherwise.
 function setContext {
-  $kubectl config set-context current --namespace=$(cat /var/run/secrets/kubernetes.io/serviceaccount/namespace)
+  if [ -n "${TARGET_KUBECONFIG:-}" ]; then
+    $kubectl --kubeconfig=$TARGET_KUBECONFIG config set-context --current --namespace=${TARGET_NAMESPACE:-$(cat /var/run/secrets/kubernetes.io/serviceaccount/namespace)}
+    return
+  fi
+  $kubectl config set-context current --namespace=${TARGET_NAMESPACE:-$(cat /var/run/secrets/kubernetes.io/serviceaccount/namespace)}
   $kubectl config use-context current
 }
 
+# the flags connecting kubectl to the cluster of the job, or to the remote cluster of TARGET_KUBECONFIG if any
+function clusterFlags {
+  if [ -n "${TARGET_KUBECONFIG:-}" ]; then
+    echo --kubeconfig=$TARGET_KUBECONFIG
+  else
+    echo -s https://kubernetes.default.svc:443 --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token 2> /dev/null) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+  fi
+}
+
+# the errors of kubectl are also kept in $HOME/kube-errors, to tell the phase of a failure
 function kube {
-  $kubectl -s https://kubernetes.default.svc:443  --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt $@
+  { $kubectl $(clusterFlags) --request-timeout=${REQUEST_TIMEOUT:-0} $@ 2>&1 1>&3 | tee -a $HOME/kube-errors >&2; return ${PIPESTATUS[0]}; } 3>&1
+}
+
+# a failure caused by invalid manifests is reported in the Validation phase instead of the Apply one
+function recordFailurePhase {
+  # the warnings, e.g. of the unknown fields with FIELD_VALIDATION=Warn, didn't fail the run
+  if grep -v '^Warning:' $HOME/kube-errors 2> /dev/null | grep -qE "error validating|strict decoding error|unknown field"; then
+    echo Validation > $HOME/phase
+  fi
+}
+trap 'rc=$?; if [ $rc -ne 0 ]; then recordFailurePhase; fi; exit $rc' EXIT
+
+# like in wrapper.sh, the phases are also listed in $HOME/phase-times with when they started
+function enterPhase {
+  echo $1 > $HOME/phase
+  echo "$1 ${EPOCHREALTIME:-$(date +%s)}" >> $HOME/phase-times
+}
+
+# the jq definitions of listed, true for the objects whose kind is in $list, and name. The lists hold kinds, e.g.
+# PersistentVolumeClaim, optionally qualified by their group, e.g. StatefulSet.apps, the objects being matched
+# ignoring the case.
+LISTED='
+  def listed($list): (.kind // "" | ascii_downcase) as $kind
+    | (.apiVersion // "" | if contains("/") then split("/")[0] else "" end | ascii_downcase) as $group
+    | any($list[]; ascii_downcase as $entry | $entry == $kind or $entry == $kind + "." + $group);
+  def name: (.kind | ascii_downcase) + "/" + .metadata.name;'
+
+# the jq definition of managed, true for the objects the ALLOWED_RESOURCE_KINDS and DENIED_RESOURCE_KINDS allow to
+# apply, the denied kinds taking precedence
+MANAGED="$LISTED"'
+  def managed: (($allowedKinds | length) == 0 or listed($allowedKinds)) and (listed($deniedKinds) | not);'
+
+# the jq definition of prunable, true for the objects the PRUNE_BLOCKLIST and PRUNE_ALLOWLIST allow to delete, the
+# blocklist taking precedence. The objects of the kinds that aren't managed are never deleted either.
+PRUNABLE="$MANAGED"'
+  def prunable: (($allow | length) == 0 or listed($allow)) and (listed($block) | not) and managed;'
+
+# prints the space separated list as a JSON array
+function jsonList {
+  echo ${1:-} | jq -R -c 'split(" ") | map(select(. != ""))'
+}
+
+# runs jq with the PRUNABLE definitions, the prune lists as $block and $allow and the kind lists as $allowedKinds and
+# $deniedKinds
+function pruneJq {
+  jq --argjson block "$(jsonList "${PRUNE_BLOCKLIST:-}")" --argjson allow "$(jsonList "${PRUNE_ALLOWLIST:-}")" \
+    --argjson allowedKinds "$(jsonList "${ALLOWED_RESOURCE_KINDS:-}")" \
+    --argjson deniedKinds "$(jsonList "${DENIED_RESOURCE_KINDS:-}")" "$@"
+}
+
+# returns true if a prune list is set
+function hasPruneLists {
+  [ -n "${PRUNE_BLOCKLIST:-}${PRUNE_ALLOWLIST:-}" ]
+}
+
+# returns true if a kind list is set
+function hasKindLists {
+  [ -n "${ALLOWED_RESOURCE_KINDS:-}${DENIED_RESOURCE_KINDS:-}" ]
+}
+
+# removes from the manifests the objects of the kinds the kind lists don't allow to apply, before they are compared,
+# applied or deleted. They are listed in $HOME/kinds-skipped, to be reported to the operator. The files left empty are
+# removed.
+function skipUnmanagedKinds {
+  if ! hasKindLists; then
+    return
+  fi
+  local allowedKinds=$(jsonList "${ALLOWED_RESOURCE_KINDS:-}") deniedKinds=$(jsonList "${DENIED_RESOURCE_KINDS:-}")
+  for file in $(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort); do
+    local format=-y
+    if [[ $file == *.json ]]; then
+      format=-c
+    fi
+    yq -r --argjson allowedKinds "$allowedKinds" --argjson deniedKinds "$deniedKinds" \
+      "$MANAGED"' select(. != null) | if .kind == "List" then .items[] else . end | select(managed | not) | name' $file | \
+      tee -a $HOME/kinds-skipped | sed 's/^/Skipping /; s/$/, its kind is not allowed/'
+    yq $format --argjson allowedKinds "$allowedKinds" --argjson deniedKinds "$deniedKinds" \
+      "$MANAGED"' select(. != null) | if .kind == "List" then .items |= map(select(managed)) else select(managed) end' $file > $file.managed
+    if [ -s $file.managed ]; then
+      mv $file.managed $file
+    else
+      rm $file $file.managed
+    fi
+  done
+}
+
+# returns true if the pod applies the shard SHARD_INDEX of the SHARD_COUNT shards of the manifests, claimed by
+# claimShard.sh, the other pods of the job applying the other ones
+function isSharded {
+  [ "${SHARD_COUNT:-1}" -gt 1 ] && [ -n "${SHARD_INDEX:-}" ]
+}
+
+# prints the shard of each key read, one per line: its polynomial hash modulo SHARD_COUNT. The hash only depends on the
+# bytes of the key, so that all the pods of a job split the resources alike.
+function shardsOf {
+  LC_ALL=C awk -v count=$SHARD_COUNT 'BEGIN { for (i = 1; i < 256; i++) ord[sprintf("%c", i)] = i }
+    { h = 0; for (i = 1; i <= length($0); i++) h = (h * 31 + ord[substr($0, i, 1)]) % 4294967296; print h % count }'
+}
+
+# keeps the objects read, one JSON per line, of the shard SHARD_INDEX
+function inShard {
+  cat > $HOME/shard-objects
+  jq -r "$KEY"' key' $HOME/shard-objects | shardsOf | paste -d' ' - $HOME/shard-objects | \
+    awk -v shard=$SHARD_INDEX '$1 == shard { print substr($0, length($1) + 2) }'
+}
+
+# keeps in the manifests the objects of the shard SHARD_INDEX, before they are compared, applied or deleted. The files
+# left empty are removed. The number of objects of all the shards is kept in $HOME/rendered-count for isEmptyRender.
+function selectShard {
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+    xargs -r yq -r "$KEY"' select(. != null) | if .kind == "List" then .items[] else . end | key' > $HOME/shard-keys
+  wc -l < $HOME/shard-keys | tr -d ' ' > $HOME/rendered-count
+  shardsOf < $HOME/shard-keys | paste -d' ' - $HOME/shard-keys | awk -v shard=$SHARD_INDEX '$1 == shard { print $2 }' > $HOME/shard-selected
+  for file in $(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort); do
+    local format=-y
+    if [[ $file == *.json ]]; then
+      format=-c
+    fi
+    yq $format --arg keys "$(cat $HOME/shard-selected)" "$KEY"' select(. != null) | if .kind == "List" then .items[] else . end
+      | select(key as $k | $keys | split("\n") | any(. == $k))' $file > $file.shard
+    if [ -s $file.shard ]; then
+      mv $file.shard $file
+    else
+      rm $file $file.shard
+    fi
+  done
+  echo "Managing the $(wc -l < $HOME/shard-selected | tr -d ' ') resources of shard $SHARD_INDEX of the $SHARD_COUNT shards"
 }
 
 function deleteResources {
@@ -33,26 +174,899 @@ function deleteResources {
       cat $file | yq 'select(.kind == "GitOpsConfig")' | kube delete -f - --wait=true
     done
     set +u
-    kube delete -R -f $MANIFEST_DIR
+    # the deleted resources are listed in $HOME/pruned, to be reported to the operator
+    if hasPruneLists; then
+      # the objects the prune lists don't allow to delete are listed in $HOME/prune-skipped, to be reported too
+      find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+        xargs -r yq -c 'select(. != null) | if .kind == "List" then .items[] else . end' > $HOME/prune-candidates
+      pruneJq -r "$PRUNABLE"' select(prunable | not) | name' $HOME/prune-candidates >> $HOME/prune-skipped
+      pruneJq -s "$PRUNABLE"' {apiVersion: "v1", kind: "List", items: map(select(prunable))}' $HOME/prune-candidates > $HOME/prunable.json
+      touch $HOME/pruned
+      if [ "$(jq '.items | length' $HOME/prunable.json)" -gt 0 ]; then
+        kube delete -f $HOME/prunable.json -o name >> $HOME/pruned
+      fi
+    else
+      kube delete -R -f $MANIFEST_DIR -o name >> $HOME/pruned
+    fi
+    if [ -n "${GITOPSCONFIG:-}" ]; then
+      deleteRemainingResources
+    fi
+    cat $HOME/pruned
+    reportPruneSkipped
     set -u
 }
 
-function createUpdateResources {
-  if [ $CREATE_MODE == "CreateOrMerge" ]; then
-    kube apply -R -f $MANIFEST_DIR
+# deletes the resources labelManifests recorded as applied by the GITOPSCONFIG that are left once its manifests are
+# deleted, e.g. the ones removed from git without the Prune DELETE_MODE: the ones of the namespace and, with
+# PRUNE_CLUSTER_RESOURCES, the cluster-scoped ones. The ones already deleted or skipped aren't listed twice, the prune
+# lists apply.
+function deleteRemainingResources {
+  listManagedResources true > $HOME/managed
+  if [ "${PRUNE_CLUSTER_RESOURCES:-false}" == "true" ]; then
+    listManagedResources false >> $HOME/managed
+  fi
+  touch $HOME/prune-skipped
+  cat $HOME/pruned $HOME/prune-skipped | sed 's#^\([^./]*\)\.[^/]*/#\1/#' > $HOME/handled
+  pruneJq -c --rawfile handled $HOME/handled "$PRUNABLE"' ($handled | split("\n")) as $names | select(name as $n | any($names[]; . == $n) | not)' \
+    $HOME/managed > $HOME/prune-candidates
+  pruneJq -r "$PRUNABLE"' select(prunable) | name' $HOME/prune-candidates > $HOME/to-prune
+  pruneJq -r "$PRUNABLE"' select(prunable | not) | name' $HOME/prune-candidates >> $HOME/prune-skipped
+  for resource in $(cat $HOME/to-prune); do
+    echo "Deleting $resource, applied by a previous run"
+    kube delete $resource --wait=true -o name >> $HOME/pruned
+  done
+}
+
+# logs the resources the prune lists kept
+function reportPruneSkipped {
+  if [ -s $HOME/prune-skipped ]; then
+    echo "Not deleting the resources blocked by the prune lists:"
+    cat $HOME/prune-skipped
+  fi
+}
+
+# translates the FIELD_VALIDATION level (Ignore, Warn or Strict) into the kubectl --validate flag, Warn is the default
+function fieldValidation {
+  echo "--validate=$(echo ${FIELD_VALIDATION:-Warn} | tr '[:upper:]' '[:lower:]')"
+}
+
+# each GitOpsConfig owns its fields under its own field manager, so that configs sharing an object don't fight over it.
+# Only server-side apply partitions the fields by manager, a client-side apply merges the manifest with the
+# last-applied-configuration annotation, shared by all the configs applying the object.
+function fieldManager {
+  echo "--field-manager=${FIELD_MANAGER:-eunomia}"
+}
+
+# the ServerSideApply CREATE_MODE is the CreateOrMerge apply, always done with server-side apply
+function isServerSide {
+  [ "${SERVER_SIDE_APPLY:-false}" == "true" ] || [ "${CREATE_MODE:-}" == "ServerSideApply" ]
+}
+
+# server-side apply doesn't store the last-applied-configuration annotation on the resources
+function applyMode {
+  if isServerSide; then
+    echo "--server-side"
+  fi
+}
+
+# the errors of kubectl worth retrying: the API server throttling the requests, a conflict with a concurrent update of
+# a resource, and the timeouts
+TRANSIENT_ERRORS='Too many requests|TooManyRequests|the object has been modified|\(Timeout\)|i/o timeout|TLS handshake timeout|Client\.Timeout exceeded|context deadline exceeded|the time allotted|request timed out'
+
+# runs kube with the given arguments, running it again up to APPLY_RETRIES times while it fails with a transient error.
+# The first retry waits APPLY_RETRY_DELAY seconds, 1 if unset, the delay doubling before each of the next ones. Other
+# failures, e.g. invalid manifests, aren't retried.
+function kubeRetrying {
+  local attempt=0 delay=${APPLY_RETRY_DELAY:-1} rc
+  while true; do
+    rc=0
+    kube "$@" 2> $HOME/retry-error || rc=$?
+    cat $HOME/retry-error >&2
+    if [ $rc -eq 0 ]; then
+      return 0
+    fi
+    if [ $attempt -ge ${APPLY_RETRIES:-0} ] || ! grep -qE "$TRANSIENT_ERRORS" $HOME/retry-error; then
+      return $rc
+    fi
+    attempt=$((attempt + 1))
+    echo "kubectl ${1} failed on a transient error, retrying in ${delay}s ($attempt/$APPLY_RETRIES)"
+    sleep $delay
+    delay=$(awk -v delay=$delay 'BEGIN { print delay * 2 }')
+  done
+}
+
+# the errors of the API server rejecting the changes of immutable fields, e.g. the clusterIP of a Service, the selector
+# of a Job, the volumeClaimTemplates of a StatefulSet or the spec of a bound PersistentVolumeClaim. Only these failures
+# recreate the resources, the conflicts with concurrent updates or the other invalid values never do.
+IMMUTABLE_ERRORS='is invalid: .*(field is immutable|updates to statefulset spec for fields other than|is immutable after creation|pod updates may not change fields other than)'
+
+# the errors of the server-side applies conflicting with the fields owned by other managers, e.g. "Apply failed with 1
+# conflict: conflict with "kubectl-edit"". Only these failures are forced, the other ones fail the run.
+FIELD_CONFLICT_ERRORS='Apply failed with [0-9]+ conflicts?: conflicts? with'
+
+# the annotation allowing a resource to be recreated when ALLOW_RECREATE isn't set
+RECREATE_ANNOTATION=gitopsconfig.eunomia.kohls.io/allow-recreate
+
+# prints the objects of the manifest file $1, one per line
+function objectsOf {
+  yq -c 'select(. != null) | if .kind == "List" then .items[] else . end' "$1"
+}
+
+# recreatable succeeds if the resources of the manifest file $1 may be recreated: with ALLOW_RECREATE, or when all its
+# objects have the RECREATE_ANNOTATION set to true
+function recreatable {
+  if [ "${ALLOW_RECREATE:-false}" == "true" ]; then
+    return 0
+  fi
+  [ "$(objectsOf "$1" | jq -s --arg annotation $RECREATE_ANNOTATION 'length > 0 and all(.metadata.annotations[$annotation] == "true")')" == "true" ]
+}
+
+# annotatedRecreate succeeds if an object of the manifests has the RECREATE_ANNOTATION set to true
+function annotatedRecreate {
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | xargs -r yq -c 'select(. != null) | if .kind == "List" then .items[] else . end' | \
+    jq -e -s --arg annotation $RECREATE_ANNOTATION 'any(.metadata.annotations[$annotation] == "true")' > /dev/null
+}
+
+# applies the manifests one file at a time. With FORCE_CONFLICTS, the files failing because of conflicts are applied
+# again forcing them, they are listed in $HOME/force-applied. The files failing because they change immutable fields,
+# with ALLOW_RECREATE or when all their objects have the RECREATE_ANNOTATION, have their resources deleted and applied
+# again once all the other files are applied, so that the disruption is as short as possible. They are listed in
+# $HOME/recreated. Both lists are reported to the operator.
+function applyEachFile {
+  : > $HOME/to-recreate
+  for file in $(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)'); do
+    if ! kubeRetrying apply $(applyMode) $(fieldValidation) $(fieldManager) -f $file 2> $HOME/apply-error; then
+      cat $HOME/apply-error >&2
+      if isServerSide && [ "${FORCE_CONFLICTS:-false}" == "true" ] && grep -qE "$FIELD_CONFLICT_ERRORS" $HOME/apply-error; then
+        echo "Apply of $file failed, forcing conflicts"
+        kubeRetrying apply --server-side --force-conflicts $(fieldValidation) $(fieldManager) -f $file
+        kube get -f $file -o name >> $HOME/force-applied
+      elif grep -qE "$IMMUTABLE_ERRORS" $HOME/apply-error && recreatable $file; then
+        echo "Apply of $file failed on immutable fields, it will be recreated"
+        echo $file >> $HOME/to-recreate
+      else
+        return 1
+      fi
+    fi
+  done
+  for file in $(cat $HOME/to-recreate); do
+    echo "Recreating $file"
+    kube get -f $file -o name >> $HOME/recreated
+    kube delete -f $file --wait=true
+    kubeRetrying apply $(applyMode) $(fieldValidation) $(fieldManager) -f $file
+  done
+}
+
+# applies the manifests in batches of APPLY_BATCH_SIZE objects, keeping the order of the files and of the objects within
+# them, so that the memory used by kubectl and the size of its requests stay bounded. The batches are applied one after
+# the other and all of them are applied even if some fail, the run fails at the end if any did.
+function applyInBatches {
+  local batches=$HOME/batches
+  rm -rf $batches
+  mkdir -p $batches
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | xargs -r yq -c 'select(. != null)' | \
+    awk -v size=$APPLY_BATCH_SIZE -v dir=$batches '{ print > sprintf("%s/batch-%06d", dir, int((NR - 1) / size)) }'
+  local total=0 failed=0
+  for batch in $(ls $batches | sort); do
+    total=$((total + 1))
+    jq -s '{apiVersion: "v1", kind: "List", items: .}' $batches/$batch > $batches/$batch.json
+    if ! kubeRetrying apply $(applyMode) $(fieldValidation) $(fieldManager) -f $batches/$batch.json; then
+      echo "Apply of batch $total failed"
+      failed=$((failed + 1))
+    fi
+  done
+  echo "Applied $total batches of up to $APPLY_BATCH_SIZE objects, $failed failed"
+  [ $failed -eq 0 ]
+}
+
+# applies the CustomResourceDefinitions of the manifests before the other resources, and waits until they are
+# Established and CRD_GRACE_PERIOD seconds more, so that the API server serves their kinds when the custom resources are
+# applied
+function applyCRDsFirst {
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+    xargs -r yq -c 'select(. != null) | if .kind == "List" then .items[] else . end | select(.kind == "CustomResourceDefinition")' \
+    > $HOME/crds
+  if [ ! -s $HOME/crds ]; then
+    return
+  fi
+  echo "Applying the CustomResourceDefinitions first"
+  jq -s '{apiVersion: "v1", kind: "List", items: .}' $HOME/crds > $HOME/crds.json
+  kubeRetrying apply $(applyMode) $(fieldValidation) $(fieldManager) -f $HOME/crds.json
+  kube wait --for condition=established --timeout=60s -f $HOME/crds.json
+  if [ "${CRD_GRACE_PERIOD:-0}" != "0" ]; then
+    echo "Waiting ${CRD_GRACE_PERIOD}s for the CustomResourceDefinitions to be served"
+    sleep $CRD_GRACE_PERIOD
+  fi
+}
+
+# applies the manifests of MANIFEST_DIR in CreateOrMerge mode. Without server-side apply and FORCE_CONFLICTS, or
+# ALLOW_RECREATE or objects with the RECREATE_ANNOTATION, they are applied in batches of APPLY_BATCH_SIZE objects if
+# set, all at once otherwise.
+function applyManifests {
+  if isServerSide && [ "${FORCE_CONFLICTS:-false}" == "true" ] || [ "${ALLOW_RECREATE:-false}" == "true" ] || annotatedRecreate; then
+    applyEachFile
+  elif [ "${APPLY_BATCH_SIZE:-0}" -gt 0 ]; then
+    applyInBatches
+  else
+    kubeRetrying apply $(applyMode) $(fieldValidation) $(fieldManager) -R -f $MANIFEST_DIR
+  fi
+}
+
+# the jq definition of wave, the sync wave of an object set by its gitopsconfig.eunomia.kohls.io/sync-wave annotation,
+# 0 without it. The run fails on an annotation that isn't an integer.
+SYNC_WAVE='
+  def wave: (.metadata.annotations["gitopsconfig.eunomia.kohls.io/sync-wave"] // "0") as $wave
+    | ($wave | tonumber? | select(. == floor))
+      // error("invalid sync wave \($wave | tojson) of \(.kind)/\(.metadata.name), it must be an integer");'
+
+# writes the objects of the manifest directory in the given file, one per line, in the order of the files
+# Arguments: file
+function listObjects {
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+    xargs -r yq -c 'select(. != null) | if .kind == "List" then .items[] else . end' > $1
+}
+
+# splits the objects of the given file, one per line, in a directory per sync wave, named after the order of the wave,
+# each object in its own file. The waves are listed in ascending order in the waves file of the directory.
+# Arguments: objects-file directory
+function groupWaves {
+  local waves index=0
+  rm -rf $2
+  mkdir -p $2
+  waves=$(jq -r "$SYNC_WAVE wave" $1)
+  echo "$waves" | sort -n -u > $2/waves
+  for wave in $(cat $2/waves); do
+    index=$((index + 1))
+    mkdir -p $2/$index
+    jq -c --argjson wave $wave "$SYNC_WAVE select(wave == \$wave)" $1 | \
+      awk -v dir=$2/$index '{ print > sprintf("%s/object-%06d.json", dir, NR) }'
+  done
+}
+
+# waits until the resources of the given directory are ready, until the deadline: the Deployments, StatefulSets and
+# DaemonSets rolled out, the Jobs complete and the CustomResourceDefinitions Established
+# Arguments: directory deadline
+function waitForWave {
+  for resource in $(cat $1/*.json | jq -r 'select(.kind == "Deployment" or .kind == "StatefulSet" or .kind == "DaemonSet"
+      or .kind == "Job" or .kind == "CustomResourceDefinition")
+      | (.kind | ascii_downcase) + "/" + .metadata.name + "," + (.metadata.namespace // "")'); do
+    local name=${resource%,*} namespace=() remaining=$(($2 - $(date +%s)))
+    if [ -n "${resource#*,}" ]; then
+      namespace=(-n ${resource#*,})
+    fi
+    if [ $remaining -le 0 ]; then
+      echo "$name isn't ready, the next sync waves aren't applied" >&2
+      return 1
+    fi
+    case ${name%%/*} in
+      job)
+        kube wait --for condition=complete $name ${namespace[@]+"${namespace[@]}"} --timeout=${remaining}s ;;
+      customresourcedefinition)
+        kube wait --for condition=established $name --timeout=${remaining}s ;;
+      *)
+        kube rollout status $name ${namespace[@]+"${namespace[@]}"} --timeout=${remaining}s ;;
+    esac || { echo "$name isn't ready, the next sync waves aren't applied" >&2; return 1; }
+  done
+}
+
+# applies the manifests in sync waves, in ascending order of the gitopsconfig.eunomia.kohls.io/sync-wave annotation of
+# the objects, those without it being in wave 0. Each wave is applied like the whole manifests would be, and its
+# resources have SYNC_WAVE_TIMEOUT seconds, 300 if unset, to be ready before the next wave is applied. Otherwise the run
+# fails in the HealthCheck phase, the next waves being left as they are.
+function applyInWaves {
+  local waves=$HOME/waves index=0
+  listObjects $HOME/objects
+  groupWaves $HOME/objects $waves
+  local count=$(wc -l < $waves/waves)
+  for wave in $(cat $waves/waves); do
+    index=$((index + 1))
+    echo "Applying sync wave $wave ($index/$count)"
+    MANIFEST_DIR=$waves/$index applyManifests
+    if [ $index -lt $count ]; then
+      if ! waitForWave $waves/$index $(($(date +%s) + ${SYNC_WAVE_TIMEOUT:-300})); then
+        echo HealthCheck > $HOME/phase
+        return 1
+      fi
+    fi
+  done
+}
+
+# returns true if an object of the manifests has a sync wave annotation
+function hasSyncWaves {
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | xargs -r grep -q "gitopsconfig.eunomia.kohls.io/sync-wave"
+}
+
+# applies the manifests in CreateOrMerge mode, in sync waves if any object has a sync wave annotation, all together
+# otherwise
+function applyCreateOrMerge {
+  if hasSyncWaves; then
+    applyInWaves
+  else
+    applyManifests
+  fi
+}
+
+# applies the manifests in CreateOrMerge mode, applying them again up to CRD_APPLY_RETRIES times while the apply fails
+# because the kinds of custom resources aren't served yet. The attempts are CRD_GRACE_PERIOD seconds apart, 5 if unset.
+function applyRetryingUnknownKinds {
+  local attempt=0 rc
+  while true; do
+    set +e
+    ( set -e; applyCreateOrMerge ) 2> $HOME/unknown-kinds-error
+    rc=$?
+    set -e
+    cat $HOME/unknown-kinds-error >&2
+    if [ $rc -eq 0 ]; then
+      return 0
+    fi
+    if [ $attempt -ge ${CRD_APPLY_RETRIES:-0} ] || ! grep -q -e "no matches for kind" -e "could not find the requested resource" $HOME/unknown-kinds-error; then
+      return $rc
+    fi
+    attempt=$((attempt + 1))
+    echo "Apply failed on kinds not served yet, retrying ($attempt/$CRD_APPLY_RETRIES)"
+    sleep $([ "${CRD_GRACE_PERIOD:-0}" != "0" ] && echo $CRD_GRACE_PERIOD || echo 5)
+  done
+}
+
+# labels the resources as managed by eunomia and annotates them with the GITOPSCONFIG applying them, so that the
+# resources no GitOpsConfig claims anymore can be found. With SKIP_UNCHANGED, they are then annotated with their hash
+# by hashManifests. The manifests are rewritten in place, before being compared with the live resources.
+function labelManifests {
+  if [ -n "${GITOPSCONFIG:-}" ]; then
+    for file in $(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)'); do
+      local format=-y
+      if [[ $file == *.json ]]; then
+        format=-c
+      fi
+      yq $format --arg owner $GITOPSCONFIG '
+        def own: .metadata.labels["app.kubernetes.io/managed-by"] = "eunomia"
+          | .metadata.annotations["gitopsconfig.eunomia.kohls.io/owner"] = $owner;
+        select(. != null) | if .kind == "List" then .items[] |= own else own end' $file > $file.labeled
+      mv $file.labeled $file
+    done
+  fi
+  if [ "${SKIP_UNCHANGED:-false}" == "true" ]; then
+    hashManifests
+  fi
+}
+
+# the namespace of the current context set by setContext, the one of the objects that don't set theirs
+CONTEXT_NAMESPACE=${TARGET_NAMESPACE:-$(cat /var/run/secrets/kubernetes.io/serviceaccount/namespace 2> /dev/null || true)}
+
+# the jq definition of key, the group, kind, namespace and name of the objects, which tells them apart in the manifests
+# and in the cluster alike. The objects without namespace, in the manifests or cluster-scoped, get the CONTEXT_NAMESPACE
+# on both sides.
+KEY='def key: (.apiVersion // "" | if contains("/") then split("/")[0] else "" end) + "/" + .kind + "/"
+  + (.metadata.namespace // "'$CONTEXT_NAMESPACE'") + "/" + .metadata.name;'
+
+# the annotation holding the hash of the rendered content of an object when it was last applied, with SKIP_UNCHANGED
+APPLIED_HASH_ANNOTATION=gitopsconfig.eunomia.kohls.io/applied-hash
+
+# annotates the objects of the manifests with the APPLIED_HASH_ANNOTATION, the sha256 of their JSON with sorted keys
+# and without the annotation. They are told apart by their key, the hashes being listed in $HOME/manifest-hashes as
+# <key> <hash>. The annotation is part of the manifests, so that it is stored on the resources when they are applied and
+# isn't reported as drift. The values injected by injectSecrets are replaced by their placeholders again before hashing,
+# so that the annotation can't be used to guess them, and the objects holding them are listed in $HOME/secret-holders.
+function hashManifests {
+  local objects=$HOME/hash-objects
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+    xargs -r yq -cS --arg annotation $APPLIED_HASH_ANNOTATION 'select(. != null) | if .kind == "List" then .items[] else . end
+      | del(.metadata.annotations[$annotation])' > $objects
+  : > $HOME/secret-holders
+  if [ -s $HOME/secret-values.json ]; then
+    jq -cS --slurpfile secrets $HOME/secret-values.json 'walk(if type == "string" then
+        reduce ($secrets[0] | to_entries[] | select(.value != "")) as $secret (.; split($secret.value) | join("${secret:\($secret.key)}"))
+      else . end)' $objects > $HOME/hash-objects-uninjected
+    objects=$HOME/hash-objects-uninjected
+    jq -r --arg placeholder "$SECRET_PLACEHOLDER" "$KEY"' select(tostring | test($placeholder)) | key' $objects > $HOME/secret-holders
+  fi
+  jq -r "$KEY"' key' $objects | paste -d' ' - <(
+    while IFS= read -r object; do
+      printf '%s' "$object" | sha256sum | cut -d' ' -f1
+    done < $objects) > $HOME/manifest-hashes
+  jq -R 'split(" ") | {(.[0]): .[1]}' $HOME/manifest-hashes | jq -s add > $HOME/manifest-hashes.json
+  for file in $(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)'); do
+    local format=-y
+    if [[ $file == *.json ]]; then
+      format=-c
+    fi
+    yq $format --arg annotation $APPLIED_HASH_ANNOTATION --slurpfile hashes $HOME/manifest-hashes.json "$KEY"'
+      def hash: .metadata.annotations[$annotation] = $hashes[0][key];
+      select(. != null) | if .kind == "List" then .items[] |= hash else hash end' $file > $file.hashed
+    mv $file.hashed $file
+  done
+}
+
+# copies in $HOME/changed-manifests the objects of the manifests whose hash differs from the APPLIED_HASH_ANNOTATION of
+# their live resource, keeping the paths of their files, so that only the new and changed objects are applied.
+# MANIFEST_DIR itself is left unchanged, for the prune and the inventory. The skipped objects are listed in
+# $HOME/unchanged, and with APPLY_DEBUG in $HOME/applied. When the live resources can't be read, e.g. because their kinds
+# aren't served yet, all the objects are applied. The objects holding secret values are always applied, so that the
+# values changed in their Secrets are applied too.
+function selectChangedManifests {
+  local changed=$HOME/changed-manifests file format
+  rm -rf $changed
+  if kube get -R -f $MANIFEST_DIR --ignore-not-found -o json > $HOME/live-objects 2> $HOME/live-objects-error; then
+    jq -r --arg annotation $APPLIED_HASH_ANNOTATION "$KEY"' if .kind == "List" then .items[] else . end
+      | select(.metadata.annotations[$annotation] != null) | key + " " + .metadata.annotations[$annotation]' \
+      $HOME/live-objects > $HOME/live-hashes
+  else
+    echo "Unable to read the live resources, applying all of them: $(cat $HOME/live-objects-error)"
+    touch $HOME/live-hashes
+  fi
+  grep -Fx -f $HOME/live-hashes $HOME/manifest-hashes | cut -d' ' -f1 | grep -vFx -f $HOME/secret-holders > $HOME/unchanged || true
+  for file in $(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort); do
+    format=-y
+    if [[ $file == *.json ]]; then
+      format=-c
+    fi
+    mkdir -p $(dirname $changed/${file#$MANIFEST_DIR/})
+    yq $format --rawfile unchanged $HOME/unchanged "$KEY"' select(. != null) | if .kind == "List" then .items[] else . end
+      | select(key as $k | $unchanged | split("\n") | any(. == $k) | not)' $file > $changed/${file#$MANIFEST_DIR/}
+    if [ ! -s $changed/${file#$MANIFEST_DIR/} ]; then
+      rm $changed/${file#$MANIFEST_DIR/}
+    fi
+  done
+  if [ "${APPLY_DEBUG:-false}" == "true" ]; then
+    find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+      xargs -r yq -r --rawfile unchanged $HOME/unchanged "$KEY"' select(. != null) | if .kind == "List" then .items[] else . end
+        | select(key as $k | $unchanged | split("\n") | any(. == $k))
+        | (.kind | ascii_downcase) + (.apiVersion | if contains("/") then "." + split("/")[0] else "" end) + "/" + .metadata.name + " unchanged"' \
+      >> $HOME/applied
+  fi
+  echo "Skipping the $(wc -l < $HOME/unchanged | tr -d ' ') resources unchanged since they were last applied"
+}
+
+# returns true if there are manifests left in $MANIFEST_DIR
+function hasManifests {
+  [ -n "$(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | head -n 1)" ]
+}
+
+# lists in $HOME/ownership-conflicts the live resources of the manifests annotated by labelManifests as applied by
+# another GitOpsConfig, as <kind>/<name> <namespace>/<gitopsconfig>, before they are applied, to be reported to the
+# operator. With the Refuse OWNERSHIP_CONFLICT_POLICY the run fails before the resources of the namespace are applied,
+# the Warn one applies them anyway. The resources that can't be read, e.g. of kinds not served yet, aren't checked.
+function detectOwnershipConflicts {
+  if [ -z "${GITOPSCONFIG:-}" ]; then
+    return
+  fi
+  kube get --ignore-not-found -R -f $MANIFEST_DIR -o json > $HOME/live 2> /dev/null || true
+  jq -r --arg owner $GITOPSCONFIG '
+    if .kind == "List" then .items[] else . end
+    | (.metadata.annotations["gitopsconfig.eunomia.kohls.io/owner"] // "") as $other
+    | select($other != "" and $other != $owner)
+    | (.kind | ascii_downcase) + "/" + .metadata.name + " " + $other' $HOME/live > $HOME/conflicts 2> /dev/null || true
+  if [ ! -s $HOME/conflicts ]; then
+    return
+  fi
+  cat $HOME/conflicts >> $HOME/ownership-conflicts
+  while read -r resource other; do
+    echo "$resource is managed by the GitOpsConfig $other too"
+  done < $HOME/conflicts
+  if [ "${OWNERSHIP_CONFLICT_POLICY:-Warn}" == "Refuse" ]; then
+    echo "Refusing to apply resources managed by other GitOpsConfigs" >&2
+    return 1
+  fi
+}
+
+# lists in $HOME/drifted the resources whose live state differs from the manifests, before they are applied.
+# The operator reports them as drifted only when the same commit was already applied.
+# kubectl diff exits with 0 without differences and 1 with differences, $HOME/changed tells the operator whether the
+# run changes any resource. It isn't written when the diff fails, and stays true once a target namespace changed.
+function detectDrift {
+  local rc=0
+  kube diff $(applyMode) $(fieldManager) -R -f $MANIFEST_DIR > $HOME/diff || rc=$?
+  grep '^diff ' $HOME/diff | awk '{print $NF}' | xargs -r -n1 basename >> $HOME/drifted || true
+  if [ $rc -eq 0 ] && ! grep -q true $HOME/changed 2> /dev/null; then
+    echo false > $HOME/changed
+  elif [ $rc -eq 1 ]; then
+    echo true > $HOME/changed
+  fi
+}
+
+# in read-only mode the manifests are only compared with the live resources, the resources differing from them are
+# listed in $HOME/drifted and reported to the operator. kubectl diff exits with 1 when there are differences.
+function diffResources {
+  local rc=0
+  labelManifests
+  kube diff $(applyMode) $(fieldManager) -R -f $MANIFEST_DIR > $HOME/diff || rc=$?
+  if [ $rc -gt 1 ]; then
+    return $rc
+  fi
+  cat $HOME/diff
+  grep '^diff ' $HOME/diff | awk '{print $NF}' | xargs -r -n1 basename >> $HOME/drifted || true
+}
+
+# with DRY_RUN the manifests are compared with the live resources without modifying them, and the diff is written in
+# the logs. The numbers of resources a real run would create and update are appended to $HOME/dry-run-created and
+# $HOME/dry-run-updated, and with the Prune DELETE_MODE the resources it would delete to $HOME/dry-run-deleted, to be
+# reported to the operator. kubectl diff exits with 1 when there are differences, every changed or new object having
+# its own diff.
+function dryRunResources {
+  local rc=0 rendered existing changed created updated
+  labelManifests
+  kube diff $(applyMode) $(fieldManager) -R -f $MANIFEST_DIR > $HOME/diff || rc=$?
+  if [ $rc -gt 1 ]; then
+    return $rc
+  fi
+  cat $HOME/diff
+  rendered=$(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | \
+    xargs -r yq -c 'select(. != null) | if .kind == "List" then .items[] else . end' | wc -l)
+  existing=$(kube get --ignore-not-found -R -f $MANIFEST_DIR -o name | wc -l)
+  changed=$(grep -c '^diff ' $HOME/diff || true)
+  created=$((rendered - existing))
+  updated=$((changed > created ? changed - created : 0))
+  echo $created >> $HOME/dry-run-created
+  echo $updated >> $HOME/dry-run-updated
+  echo "The run would create $created and update $updated resources"
+  if [ $DELETE_MODE == "Prune" ]; then
+    pruneRemovedResources
+  fi
+}
+
+# lists in $HOME/inventory/<namespace> the resources applied into the TARGET_NAMESPACE, reported to the operator
+function recordInventory {
+  mkdir -p $HOME/inventory
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+    xargs -r yq -r 'select(. != null) | if .kind == "List" then .items[] else . end | (.kind | ascii_downcase) + "/" + .metadata.name' \
+    > $HOME/inventory/$TARGET_NAMESPACE
+}
+
+# appends to $HOME/managed-resources the live resources of the manifests once applied, one <apiVersion>/<kind>
+# <namespace>/<name>, or <apiVersion>/<kind> <name> for the cluster-scoped ones, per line, to be kept by
+# storeInventory.sh. When the resources applied aren't all known, the reason is appended to $HOME/inventory-unknown
+# and the previous inventory is kept, as it is when the pod only applied its shard of the resources.
+function recordManagedResources {
+  local columns=API:.apiVersion,KIND:.kind,NAMESPACE:.metadata.namespace,NAME:.metadata.name
+  if isSharded; then
+    echo "the resources of the other shards were applied by the other pods of the job" >> $HOME/inventory-unknown
+    return
+  fi
+  if hasFailedContextDirs; then
+    echo "template directories failed to render, their resources weren't applied" >> $HOME/inventory-unknown
+  fi
+  if ! kube get -R -f $MANIFEST_DIR -o custom-columns=$columns --no-headers > $HOME/applied-resources; then
+    echo "Unable to list the applied resources, the inventory isn't updated" >&2
+    echo "the applied resources${TARGET_NAMESPACE:+ of namespace $TARGET_NAMESPACE} couldn't be listed" >> $HOME/inventory-unknown
+    return
+  fi
+  awk '{ print $1 "/" $2 " " ($3 == "<none>" ? "" : $3 "/") $4 }' $HOME/applied-resources >> $HOME/managed-resources
+}
+
+# returns true if the templates rendered no object into $MANIFEST_DIR, into any shard when it is sharded
+function isEmptyRender {
+  local count
+  if isSharded; then
+    [ "$(cat $HOME/rendered-count)" -eq 0 ]
+    return
+  fi
+  count=$(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | \
+    xargs -r yq -c 'select(. != null) | if .kind == "List" then .items[] else . end' | wc -l)
+  [ $count -eq 0 ]
+}
+
+# lists the resources labeled and annotated by labelManifests as applied by the GITOPSCONFIG, the ones of the namespace
+# when $1 is true, the cluster-scoped ones otherwise. When sharded, only the ones of the shard are listed.
+function listManagedResources {
+  local kinds
+  kinds=$(kube api-resources --namespaced=$1 --verbs=list,delete -o name | paste -sd, -)
+  kube get $kinds -l app.kubernetes.io/managed-by=eunomia -o json | \
+    jq -c --arg owner $GITOPSCONFIG '.items[] | select(.metadata.annotations["gitopsconfig.eunomia.kohls.io/owner"] == $owner)' > $HOME/listed
+  if isSharded; then
+    inShard < $HOME/listed
+  else
+    cat $HOME/listed
+  fi
+}
+
+# returns true if template directories failed to render with CONTINUE_ON_ERROR, their resources aren't in the manifests
+function hasFailedContextDirs {
+  [ -s $HOME/failed-context-dirs ]
+}
+
+# deletes the resources of the namespace labeled and annotated by labelManifests as applied by the GITOPSCONFIG, they
+# are listed in $HOME/pruned to be reported to the operator
+function pruneManagedResources {
+  if [ -z "${GITOPSCONFIG:-}" ]; then
+    echo "GITOPSCONFIG is not set, the resources it manages can't be found" >&2
+    return 1
+  fi
+  if hasFailedContextDirs; then
+    echo "Not deleting any resource, template directories failed to render: $(sort -u $HOME/failed-context-dirs | paste -sd' ' -)"
+    return
+  fi
+  listManagedResources true > $HOME/prune-candidates
+  pruneJq -r "$PRUNABLE"' select(prunable) | name' $HOME/prune-candidates > $HOME/to-prune
+  pruneJq -r "$PRUNABLE"' select(prunable | not) | name' $HOME/prune-candidates >> $HOME/prune-skipped
+  for resource in $(cat $HOME/to-prune); do
+    kube delete $resource --wait=true -o name >> $HOME/pruned
+  done
+  reportPruneSkipped
+  if [ -s $HOME/to-prune ]; then
+    echo true > $HOME/changed
+  fi
+}
+
+# with the Prune DELETE_MODE, deletes the resources applied by the previous runs of the GITOPSCONFIG that aren't in the
+# manifests anymore: the ones of the namespace and, with PRUNE_CLUSTER_RESOURCES, the cluster-scoped ones. They are
+# found by the label and annotation of labelManifests, matched with the manifests by group, kind and name, and listed
+# in $HOME/pruned to be reported to the operator. The prune lists apply. Nothing is deleted when template directories
+# failed to render, their resources not being in the manifests.
+function pruneRemovedResources {
+  if [ -z "${GITOPSCONFIG:-}" ]; then
+    echo "GITOPSCONFIG is not set, the resources it manages can't be found" >&2
+    return 1
+  fi
+  if hasFailedContextDirs; then
+    echo "Not deleting the resources removed from the manifests, template directories failed to render: $(sort -u $HOME/failed-context-dirs | paste -sd' ' -)"
+    return
+  fi
+  enterPhase Prune
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+    xargs -r yq -r "$KEY"' select(. != null) | if .kind == "List" then .items[] else . end | key' > $HOME/rendered
+  listManagedResources true > $HOME/managed
+  if [ "${PRUNE_CLUSTER_RESOURCES:-false}" == "true" ]; then
+    listManagedResources false >> $HOME/managed
+  fi
+  jq -c --rawfile rendered $HOME/rendered "$KEY"' ($rendered | split("\n")) as $keys | select(key as $k | any($keys[]; . == $k) | not)' \
+    $HOME/managed > $HOME/prune-candidates
+  pruneJq -r "$PRUNABLE"' select(prunable) | name' $HOME/prune-candidates > $HOME/to-prune
+  pruneJq -r "$PRUNABLE"' select(prunable | not) | name' $HOME/prune-candidates >> $HOME/prune-skipped
+  if [ "${DRY_RUN:-false}" == "true" ]; then
+    sed 's/^/Would delete /' $HOME/to-prune
+    cat $HOME/to-prune >> $HOME/dry-run-deleted
+    reportPruneSkipped
+    return
+  fi
+  for resource in $(cat $HOME/to-prune); do
+    echo "Deleting $resource, not in the manifests anymore"
+    kube delete $resource --wait=true -o name >> $HOME/pruned
+  done
+  reportPruneSkipped
+  if [ -s $HOME/to-prune ]; then
+    echo true > $HOME/changed
+  fi
+}
+
+# EMPTY_RENDER_POLICY is what a run does when the templates render no object: Fail, the default, fails it in the Render
+# phase so that a broken render doesn't delete anything, Ignore leaves the resources as they are and Prune deletes all
+# the resources applied by the GITOPSCONFIG, for an intentional teardown
+function emptyRender {
+  case ${EMPTY_RENDER_POLICY:-Fail} in
+    Ignore)
+      echo "The templates rendered no resource, leaving the resources as they are"
+      echo false > $HOME/changed
+      echo "the resources${TARGET_NAMESPACE:+ of namespace $TARGET_NAMESPACE} were left as they are by the Ignore emptyRenderPolicy" >> $HOME/inventory-unknown
+      ;;
+    Prune)
+      echo "The templates rendered no resource, deleting the resources of $GITOPSCONFIG"
+      enterPhase Prune
+      pruneManagedResources
+      ;;
+    *)
+      echo "The templates rendered no resource, set the emptyRenderPolicy to Ignore or Prune to allow it" >&2
+      echo Render > $HOME/phase
+      return 1
+      ;;
+  esac
+}
+
+# applies the manifests of MANIFEST_DIR in CREATE_MODE
+function applyInMode {
+  if [ $CREATE_MODE == "CreateOrMerge" ] || [ $CREATE_MODE == "ServerSideApply" ]; then
+    applyCRDsFirst
+    applyRetryingUnknownKinds
   fi
   if [ $CREATE_MODE == "CreateOrUpdate" ]; then
     set +u
-    kube create -R -f $MANIFEST_DIR
+    kube create $(fieldValidation) $(fieldManager) -R -f $MANIFEST_DIR
     set -u
-    kube update -R -f $MANIFEST_DIR
+    kubeRetrying update $(fieldValidation) $(fieldManager) -R -f $MANIFEST_DIR
   fi
   if [ $CREATE_MODE == "Patch" ]; then
-    kube patch -R -f $MANIFEST_DIR
+    kubeRetrying patch $(fieldManager) -R -f $MANIFEST_DIR
+  fi
+}
+
+# the annotation overriding the CREATE_MODE for a single resource
+HANDLING_MODE_ANNOTATION=gitopsconfig.eunomia.kohls.io/handling-mode
+
+# returns true if an object of the manifests has the HANDLING_MODE_ANNOTATION
+function hasHandlingModes {
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | xargs -r grep -q "$HANDLING_MODE_ANNOTATION"
+}
+
+# splits the manifests by handling mode, the one of their HANDLING_MODE_ANNOTATION or the CREATE_MODE, into
+# $HOME/handling-modes/<mode>, keeping the paths of their files. MANIFEST_DIR itself is left unchanged, for the prune.
+# The run fails in the Validation phase on a mode that can't be applied to a single resource.
+function splitHandlingModes {
+  local modes=$HOME/handling-modes file mode format
+  rm -rf $modes
+  find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+    xargs -r yq -r --arg annotation $HANDLING_MODE_ANNOTATION 'select(. != null) | if .kind == "List" then .items[] else . end
+      | select(.metadata.annotations[$annotation] != null)
+      | "\(.kind)/\(.metadata.name) \(.metadata.annotations[$annotation])"' > $HOME/handling-mode-annotations
+  if grep -vE ' (CreateOrMerge|ServerSideApply|CreateOrUpdate|Patch)$' $HOME/handling-mode-annotations > $HOME/invalid-handling-modes; then
+    echo "The $HANDLING_MODE_ANNOTATION annotation must be one of CreateOrMerge, ServerSideApply, CreateOrUpdate, Patch: $(paste -sd, $HOME/invalid-handling-modes | sed 's/,/, /g')" >&2
+    echo Validation > $HOME/phase
+    return 1
   fi
+  for file in $(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort); do
+    format=-y
+    if [[ $file == *.json ]]; then
+      format=-c
+    fi
+    for mode in $(yq -r --arg annotation $HANDLING_MODE_ANNOTATION --arg default $CREATE_MODE \
+      'select(. != null) | if .kind == "List" then .items[] else . end | .metadata.annotations[$annotation] // $default' $file | sort -u); do
+      mkdir -p $(dirname $modes/$mode/${file#$MANIFEST_DIR/})
+      yq $format --arg annotation $HANDLING_MODE_ANNOTATION --arg default $CREATE_MODE --arg mode $mode \
+        'select(. != null) | if .kind == "List" then .items[] else . end
+          | select((.metadata.annotations[$annotation] // $default) == $mode)' $file > $modes/$mode/${file#$MANIFEST_DIR/}
+    done
+  done
+}
+
+# applies the manifests in CREATE_MODE, except the resources whose HANDLING_MODE_ANNOTATION overrides it, which are
+# applied in their own mode once the others are. With SKIP_UNCHANGED, only the objects selected by
+# selectChangedManifests are applied.
+function createUpdateResources {
+  detectOwnershipConflicts
+  labelManifests
+  detectDrift
+  if [ "${SKIP_UNCHANGED:-false}" == "true" ]; then
+    selectChangedManifests
+    local MANIFEST_DIR=$HOME/changed-manifests
+    if ! hasManifests; then
+      return
+    fi
+  fi
+  if ! hasHandlingModes; then
+    applyInMode
+    return
+  fi
+  splitHandlingModes
+  local mode
+  for mode in $CREATE_MODE $(ls $HOME/handling-modes | grep -vx $CREATE_MODE || true); do
+    if [ ! -d $HOME/handling-modes/$mode ]; then
+      continue
+    fi
+    echo "Applying the resources in the $mode handling mode"
+    MANIFEST_DIR=$HOME/handling-modes/$mode CREATE_MODE=$mode applyInMode
+  done
+}
+
+# lists in $HOME/applied the result of the apply of every object, read from the output of kubectl, e.g.
+# "deployment.apps/web updated" or "service/web error"
+function recordApplyResults {
+  sed -nE \
+    -e 's/^([^ ]+\/[^ ]+) (created|unchanged)$/\1 \2/p' \
+    -e 's/^([^ ]+\/[^ ]+) configured$/\1 updated/p' \
+    -e 's/^([^ ]+\/[^ ]+) serverside-applied$/\1 applied/p' \
+    -e 's/.*error when [^"]*"[^"]*": ([A-Za-z0-9.]+) "([^"]+)".*/\L\1\E\/\2 error/p' \
+    -e 's/^The ([A-Za-z0-9.]+) "([^"]+)" is invalid.*/\L\1\E\/\2 error/p' >> $HOME/applied
+}
+
+# with APPLY_DEBUG, the results of the apply of every object are recorded to be reported to the operator, whether the
+# apply succeeds or not
+function createUpdateResourcesWithResults {
+  local rc
+  set +e
+  ( set -e; createUpdateResources ) 2>&1 | tee $HOME/apply-output
+  rc=$?
+  set -e
+  recordApplyResults < $HOME/apply-output
+  return $rc
+}
+
+# the ${secret:<name>/<key>} placeholders of the string values of the manifests, e.g. a password in an env var
+SECRET_PLACEHOLDER='\$\{secret:([a-z0-9]([-a-z0-9.]*[a-z0-9])?)/([-._a-zA-Z0-9]+)\}'
 
+# prints its input with every line of the injected secret values, listed in $HOME/secret-mask, replaced by ***
+function maskSecrets {
+  awk 'NR == FNR { if ($0 != "") masks[++n] = $0; next }
+    { for (i = 1; i <= n; i++) { out = ""; while ((p = index($0, masks[i])) > 0) {
+        out = out substr($0, 1, p - 1) "***"; $0 = substr($0, p + length(masks[i])) }; $0 = out $0 }
+      print; fflush() }' $HOME/secret-mask -
 }
 
+# replaces the secret placeholders of the manifests by the values of the keys of the Secrets of the namespace the
+# resources are applied into, just before they are compared or applied, so that the values are never rendered nor kept
+# in git. The run fails in the Secrets phase when a Secret or key is missing, naming them but not the values. Once the
+# values are injected, all the output of the script is masked by maskSecrets.
+function injectSecrets {
+  local refs missing=()
+  refs=$(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' -print0 | xargs -0 -r grep -ohE "$SECRET_PLACEHOLDER" | sort -u || true)
+  if [ -z "$refs" ]; then
+    return
+  fi
+  echo '{}' > $HOME/secret-values.json
+  for secret in $(echo "$refs" | sed -E 's/^\$\{secret:([^/]+)\/.*$/\1/' | sort -u); do
+    if ! kube get secret $secret -o json > $HOME/secret.json 2> /dev/null; then
+      missing+=("Secret $secret")
+      continue
+    fi
+    for ref in $(echo "$refs" | grep -F "{secret:$secret/"); do
+      local key=${ref#*/}
+      key=${key%\}}
+      if ! jq -e --arg key "$key" '.data[$key] != null' $HOME/secret.json > /dev/null; then
+        missing+=("key $key of Secret $secret")
+        continue
+      fi
+      jq --arg ref "$secret/$key" --slurpfile secret $HOME/secret.json --arg key "$key" \
+        '.[$ref] = ($secret[0].data[$key] | @base64d)' $HOME/secret-values.json > $HOME/secret-values.next
+      mv $HOME/secret-values.next $HOME/secret-values.json
+    done
+  done
+  rm -f $HOME/secret.json
+  if [ ${#missing[@]} -gt 0 ]; then
+    echo "Unable to inject the secret placeholders of the manifests, missing in ${TARGET_NAMESPACE:-the namespace of the job}: $(printf '%s, ' "${missing[@]}" | sed 's/, $//')" >&2
+    echo Secrets > $HOME/phase
+    return 1
+  fi
+  jq -r '.[] | split("\n")[]' $HOME/secret-values.json >> $HOME/secret-mask
+  exec > >(maskSecrets) 2> >(maskSecrets >&2)
+  for file in $(find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)'); do
+    if ! grep -qE "$SECRET_PLACEHOLDER" $file; then
+      continue
+    fi
+    local format=-y
+    if [[ $file == *.json ]]; then
+      format=-c
+    fi
+    yq $format --slurpfile secrets $HOME/secret-values.json \
+      'select(. != null) | walk(if type == "string" then gsub("\\$\\{secret:(?<ref>[^}]+)\\}"; $secrets[0][.ref]) else . end)' \
+      $file > $file.injected
+    mv $file.injected $file
+  done
+  echo "Injected the values of $(echo "$refs" | wc -l) secret keys into the manifests"
+}
+
+# the objects of the kinds the GitOpsConfig may not manage are neither compared, applied nor deleted
+skipUnmanagedKinds
+
+# with SHARD_COUNT, the pod only compares, applies and deletes the objects of its shard. Without any in its shard, it
+# only deletes the resources of its shard removed from the manifests, unless the templates rendered no object at all.
+if isSharded; then
+  selectShard
+  if ! hasManifests && ! isEmptyRender; then
+    if [ "${READ_ONLY:-false}" == "true" ] || [ $CREATE_MODE == "None" ] || [ $DELETE_MODE == "None" ]; then
+      exit 0
+    fi
+    setContext
+    if [ $ACTION == "create" ] && [ $DELETE_MODE == "Prune" ]; then
+      pruneRemovedResources
+    elif [ $ACTION == "delete" ] && [ -n "${GITOPSCONFIG:-}" ]; then
+      touch $HOME/pruned
+      deleteRemainingResources
+    fi
+    exit 0
+  fi
+fi
+
+if [ "${READ_ONLY:-false}" == "true" ]; then
+  echo "READ_ONLY is set; comparing the resources with the manifests without modifying them."
+  setContext
+  if [ $ACTION == "create" ]; then
+    injectSecrets
+    diffResources
+  fi
+  exit 0
+fi
+
+if [ "${DRY_RUN:-false}" == "true" ]; then
+  echo "DRY_RUN is set; comparing the resources with the manifests without modifying them."
+  setContext
+  if [ $ACTION == "create" ]; then
+    injectSecrets
+    dryRunResources
+  else
+    find $MANIFEST_DIR -iregex '.*\.\(yaml\|yml\|json\)' | sort | \
+      xargs -r yq -r 'select(. != null) | if .kind == "List" then .items[] else . end | (.kind | ascii_downcase) + "/" + .metadata.name' | \
+      tee -a $HOME/dry-run-deleted | sed 's/^/Would delete /'
+  fi
+  exit 0
+fi
+
 if [ $CREATE_MODE == "None" ] || [ $DELETE_MODE == "None" ]; then
   echo "CREATE_MODE and/or DELETE_MODE is set to None; This means that the template processor already applied the resources. Skipping the Manage Resources step."
   exit 0
@@ -61,12 +1075,37 @@ fi
 echo "Managing Resources"
 setContext
 
-if [ $ACTION == "create" ]
+if [ $ACTION == "create" ] && isEmptyRender
 then
-  createUpdateResources
+  emptyRender
+  if [ "${EMPTY_RENDER_POLICY:-Fail}" == "Prune" ] && [ -n "${TARGET_NAMESPACE:-}" ]; then
+    recordInventory
+  fi
+elif [ $ACTION == "create" ]
+then
+  injectSecrets
+  # with the PruneThenApply PRUNE_POLICY, the resources removed or renamed in the manifests are deleted before the new
+  # ones are applied, so that a renamed resource can reuse what its old name held, e.g. a cluster-wide name or a host
+  if [ $DELETE_MODE == "Prune" ] && [ "${PRUNE_POLICY:-ApplyThenPrune}" == "PruneThenApply" ]; then
+    pruneRemovedResources
+    enterPhase Apply
+  fi
+  if [ "${APPLY_DEBUG:-false}" == "true" ]; then
+    createUpdateResourcesWithResults
+  else
+    createUpdateResources
+  fi
+  if [ $DELETE_MODE == "Prune" ] && [ "${PRUNE_POLICY:-ApplyThenPrune}" != "PruneThenApply" ]; then
+    pruneRemovedResources
+  fi
+  recordManagedResources
+  if [ -n "${TARGET_NAMESPACE:-}" ]; then
+    recordInventory
+  fi
 fi
 
 if [ $ACTION == "delete" ]
 then
+  enterPhase Prune
   deleteResources
 fi
@@ -0,0 +1,71 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+set -o pipefail
+
+# keeps the inventory of the run, the resources listed in $HOME/managed-resources by resourceManager.sh, sorted, in the
+# ConfigMap gitopsconfig-<name>-inventory of the namespace of the GITOPSCONFIG, owned by it through GITOPSCONFIG_UID so
+# that it is deleted with it. The list is gzipped into the resources.gz binary key when it is larger than
+# INVENTORY_MAX_SIZE bytes, to stay within the size of a ConfigMap. The count and the hash of the inventory, and the
+# ConfigMap once written, are left in $HOME/inventory-count, $HOME/inventory-hash and $HOME/inventory-configmap to be
+# reported to the operator. The resources are applied already, a ConfigMap that can't be written doesn't fail the run.
+
+function kube {
+  $kubectl -s https://kubernetes.default.svc:443 --token $(cat /var/run/secrets/kubernetes.io/serviceaccount/token 2> /dev/null) --certificate-authority=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt --request-timeout=${REQUEST_TIMEOUT:-0} "$@"
+}
+
+if [ -s $HOME/inventory-unknown ]; then
+  echo "Keeping the previous inventory, $(awk '!seen[$0]++' $HOME/inventory-unknown | paste -sd';' - | sed 's/;/; /g')"
+  exit 0
+fi
+
+touch $HOME/managed-resources
+sort -u $HOME/managed-resources > $HOME/inventory-resources
+wc -l < $HOME/inventory-resources | tr -d ' ' > $HOME/inventory-count
+sha256sum $HOME/inventory-resources | cut -d' ' -f1 > $HOME/inventory-hash
+
+if [ -z "${GITOPSCONFIG:-}" ]; then
+  echo "GITOPSCONFIG is not set, the inventory isn't kept in a ConfigMap" >&2
+  exit 0
+fi
+namespace=${GITOPSCONFIG%%/*}
+config=${GITOPSCONFIG#*/}
+name=gitopsconfig-$config-inventory
+
+if [ $(wc -c < $HOME/inventory-resources) -le ${INVENTORY_MAX_SIZE:-524288} ]; then
+  cp $HOME/inventory-resources $HOME/inventory-data
+  content='{data: {resources: $data}}'
+else
+  gzip -9 -c $HOME/inventory-resources | base64 -w 0 > $HOME/inventory-data
+  content='{binaryData: {"resources.gz": $data}}'
+fi
+jq -n --arg name $name --arg namespace $namespace --arg config $config --arg uid "${GITOPSCONFIG_UID:-}" \
+  --arg hash "$(cat $HOME/inventory-hash)" --rawfile data $HOME/inventory-data \
+  '{apiVersion: "v1", kind: "ConfigMap",
+    metadata: {name: $name, namespace: $namespace, annotations: {"gitopsconfig.eunomia.kohls.io/inventory-hash": $hash},
+      ownerReferences: (if $uid == "" then [] else
+        [{apiVersion: "eunomia.kohls.io/v1alpha1", kind: "GitOpsConfig", name: $config, uid: $uid, controller: true}] end)}}
+  + '"$content" > $HOME/inventory-configmap.json
+
+# applied server-side, the list doesn't have to fit in the last-applied-configuration annotation
+if kube apply --server-side --force-conflicts --field-manager=eunomia-inventory -f $HOME/inventory-configmap.json > /dev/null; then
+  echo $name > $HOME/inventory-configmap
+  echo "Kept the inventory of the $(cat $HOME/inventory-count) applied resources in ConfigMap $namespace/$name"
+else
+  echo "Unable to keep the inventory in ConfigMap $namespace/$name, the service account of the job must be allowed to apply it" >&2
+fi
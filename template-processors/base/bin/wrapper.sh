@@ -18,8 +18,222 @@ set -o nounset
 set -o errexit
 
 export HOME=/tmp
+# the phase of a failed run is printed as the last line of its logs, which the operator reads to report why it failed.
+# Every step sets the phase in $HOME/phase, the scripts can refine it, e.g. to Validation, Prune or HealthCheck
+# With APPLY_DEBUG, the results of the apply of every object, listed in $HOME/applied, are printed before it.
+function failedApplyResults {
+  if [ -s $HOME/applied ]; then
+    head -n 30 $HOME/applied | sed 's/^/eunomia-applied: /'
+  fi
+}
+# the requests the service account of the job isn't allowed to make, found in the errors of kubectl, are printed
+# before the phase too, so that the operator reports the missing permissions instead of a bare failure
+function failedPermissions {
+  if [ -s $HOME/kube-errors ]; then
+    { grep -oE 'User "[^"]+" cannot [a-z]+ resource "[^"]+"( in API group "[^"]*")?( in the namespace "[^"]+"| at the cluster scope)?' $HOME/kube-errors || true; } | sort -u | head -n 10 | sed 's/^/eunomia-forbidden: /'
+  fi
+}
+# with TARGET_NAMESPACES, the result of the apply in each namespace, listed in $HOME/namespace-results, is printed too
+function namespaceResults {
+  if [ -s $HOME/namespace-results ]; then
+    sed 's/^/eunomia-namespace: /' $HOME/namespace-results
+  fi
+}
+# the resources managed by other GitOpsConfigs, listed in $HOME/ownership-conflicts, are printed too
+function ownershipConflicts {
+  if [ -s $HOME/ownership-conflicts ]; then
+    awk '!seen[$0]++' $HOME/ownership-conflicts | head -n 10 | sed 's/^/eunomia-conflict: /'
+  fi
+}
+trap 'rc=$?; if [ $rc -ne 0 ] && [ -s $HOME/phase ]; then failedApplyResults; failedPermissions; namespaceResults; ownershipConflicts; echo "eunomia-phase: $(cat $HOME/phase)"; fi; exit $rc' EXIT
+# the phases are also listed in $HOME/phase-times with when they started, for the operator to trace them
+function enterPhase {
+  echo $1 > $HOME/phase
+  echo "$1 ${EPOCHREALTIME:-$(date +%s)}" >> $HOME/phase-times
+}
+# the certificate authorities of CA_BUNDLE are trusted along with the ones of the system by git, curl, the AWS CLI and
+# the Go tools, e.g. helm, which all replace the system bundle by the file they are given
+if [ -n "${CA_BUNDLE:-}" ]; then
+  cat /etc/ssl/certs/ca-certificates.crt $CA_BUNDLE > $HOME/ca-certificates.crt 2> /dev/null || cat $CA_BUNDLE > $HOME/ca-certificates.crt
+  export GIT_SSL_CAINFO=$HOME/ca-certificates.crt CURL_CA_BUNDLE=$HOME/ca-certificates.crt AWS_CA_BUNDLE=$HOME/ca-certificates.crt SSL_CERT_FILE=$HOME/ca-certificates.crt
+fi
+# the kubeconfig of the remote cluster of the GitOpsConfig is mounted read-only, while kubectl writes the namespace of
+# its context into it
+if [ -n "${TARGET_KUBECONFIG:-}" ]; then
+  cp $TARGET_KUBECONFIG $HOME/target-kubeconfig
+  export TARGET_KUBECONFIG=$HOME/target-kubeconfig
+fi
+# with KUBE_API_QPS, the kubectl calls of all the steps share the client side rate limits of the operator
+if [ "${KUBE_API_QPS:-0}" != "0" ]; then
+  export KUBECTL=$kubectl kubectl=/usr/local/bin/kubectlThrottle.sh
+fi
+enterPhase Clone
 /usr/local/bin/gitClone.sh
+enterPhase Render
+/usr/local/bin/filterTemplates.sh
+/usr/local/bin/mergeParameterValues.sh
 /usr/local/bin/discoverEnvironment.sh
 source $HOME/envs.sh
-/usr/local/bin/processTemplates.sh
-/usr/local/bin/resourceManager.sh
+
+# the namespaces removed from TARGET_NAMESPACES are found in the inventory ConfigMap of the previous runs too, the
+# inventory in the status of the GitOpsConfig being cut to fit in the report of the job
+if [ -n "${TARGET_NAMESPACES:-}" ] && [ "${ACTION:-create}" == "create" ]; then
+  PRUNE_NAMESPACES=$(/usr/local/bin/inventoryNamespaces.sh)
+  export PRUNE_NAMESPACES
+fi
+
+/usr/local/bin/renderTemplates.sh
+
+# with QUOTA_PREFLIGHT, the resources rendered for every namespace must fit in its ResourceQuotas before any is applied,
+# so that an apply doesn't fail partway on a quota
+function checkQuotas {
+  if [ "${QUOTA_PREFLIGHT:-false}" != "true" ] || [ "${ACTION:-create}" != "create" ] || [ "${READ_ONLY:-false}" == "true" ] || [ "${CREATE_MODE:-}" == "None" ]; then
+    return
+  fi
+  enterPhase Quota
+  if [ -z "${TARGET_NAMESPACES:-}" ]; then
+    /usr/local/bin/quotaPreflight.sh
+  fi
+  for namespace in ${TARGET_NAMESPACES:-}; do
+    NAMESPACE=$namespace MANIFEST_DIR=$MANIFEST_DIR/$namespace /usr/local/bin/quotaPreflight.sh
+  done
+}
+
+# with CANARY_NAMESPACES or CANARY_SELECTOR, the canary is applied first and the other resources once it is healthy.
+# The dry runs don't apply anything, there is no canary to wait for.
+function hasCanary {
+  [ -n "${CANARY_NAMESPACES:-}${CANARY_SELECTOR:-}" ] && [ "${ACTION:-create}" == "create" ] && [ "${READ_ONLY:-false}" != "true" ] && [ "${DRY_RUN:-false}" != "true" ] && [ "${CREATE_MODE:-}" != "None" ]
+}
+
+function applyResources {
+  enterPhase Apply
+  if hasCanary; then
+    /usr/local/bin/canary.sh
+    return
+  fi
+  if [ -z "${TARGET_NAMESPACES:-}" ]; then
+    /usr/local/bin/resourceManager.sh
+  fi
+  # a namespace failing doesn't stop the resources from being applied into the other ones, the run fails at the end
+  local failed=0
+  for namespace in ${TARGET_NAMESPACES:-}; do
+    echo "Managing the resources of namespace $namespace"
+    if NAMESPACE=$namespace TARGET_NAMESPACE=$namespace MANIFEST_DIR=$MANIFEST_DIR/$namespace /usr/local/bin/resourceManager.sh; then
+      echo "$namespace Success" >> $HOME/namespace-results
+    else
+      echo "Failed to manage the resources of namespace $namespace" >&2
+      echo "$namespace Failed" >> $HOME/namespace-results
+      failed=1
+    fi
+  done
+  return $failed
+}
+
+# like when the GitOpsConfig is deleted, the resources are kept with the Retain DELETE_MODE
+function pruneNamespaces {
+  if [ "${DELETE_MODE:-Delete}" == "Retain" ]; then
+    return
+  fi
+  for namespace in ${PRUNE_NAMESPACES:-}; do
+    echo "Deleting the resources of namespace $namespace, which isn't targeted anymore"
+    NAMESPACE=$namespace TARGET_NAMESPACE=$namespace MANIFEST_DIR=$HOME/prune/$namespace ACTION=delete /usr/local/bin/resourceManager.sh
+  done
+}
+
+# with SHARD_COUNT, the resources are split into shards, each pod of the job claiming the one it applies
+if [ "${SHARD_COUNT:-1}" -gt 1 ]; then
+  enterPhase Apply
+  SHARD_INDEX=$(/usr/local/bin/claimShard.sh)
+  export SHARD_INDEX
+fi
+
+# ApplyThenPrune, the default, only deletes the old resources once the new ones are applied: a failed apply leaves the
+# old ones running and the service is never without resources, but the old and new resources coexist for a while, which
+# fails when they conflict, e.g. on a cluster-wide name or an ingress host. PruneThenApply deletes the old resources
+# first so that the new ones can take their place, at the cost of an outage until they are applied, which lasts if the
+# apply fails. The policy orders both the namespaces no longer targeted here and, in resourceManager.sh, the resources
+# removed or renamed in the manifests.
+checkQuotas
+if [ "${PRUNE_POLICY:-ApplyThenPrune}" == "PruneThenApply" ]; then
+  pruneNamespaces
+  applyResources
+else
+  applyResources
+  pruneNamespaces
+fi
+
+# the inventory of all the resources applied by the run is kept for the audits, the runs that don't apply anything keep
+# the previous one
+if [ "${ACTION:-create}" == "create" ] && [ "${READ_ONLY:-false}" != "true" ] && [ "${DRY_RUN:-false}" != "true" ] && [ "${CREATE_MODE:-}" != "None" ]; then
+  /usr/local/bin/storeInventory.sh
+fi
+
+# the shard is applied, the pods replacing the failed ones don't claim it again
+if [ -n "${SHARD_INDEX:-}" ]; then
+  /usr/local/bin/claimShard.sh complete || true
+fi
+
+# the inventory of each target namespace, as listed by resourceManager.sh in $HOME/inventory/<namespace>
+function inventory {
+  mkdir -p $HOME/inventory
+  for file in $(find $HOME/inventory -type f | sort); do
+    jq -R -s -c --arg namespace $(basename $file) '{namespace: $namespace,
+      resources: (split("\n") | map(select(. != "")) | .[0:10]),
+      resourceCount: (split("\n") | map(select(. != "")) | length)}' $file
+  done | jq -s -c .
+}
+
+# the termination message is read by the operator to report the applied commits, the force applied, the recreated,
+# the drifted and the pruned resources, the resources kept by the prune lists, the resources of kinds the
+# GitOpsConfig may not manage, the resources managed by other GitOpsConfigs, whether the run changed any resource
+# when it is known, the inventory of the target namespaces, the count and hash of the inventory of all the resources
+# and its ConfigMap, the mirrors the sources were cloned from, if any, with
+# APPLY_DEBUG, the result of the apply of every object, with CONTINUE_ON_ERROR, the template directories that failed to
+# render, with TARGET_NAMESPACES, the result in each namespace, with DRY_RUN, what the run would have changed and the
+# phases of the run with when they started and when it finished. The report is cut to fit in a termination message.
+if [ -w /dev/termination-log ]; then
+  touch $HOME/phase-times
+  touch $HOME/commit-message $HOME/commit $HOME/parameter-commit $HOME/force-applied $HOME/recreated $HOME/drifted $HOME/pruned $HOME/changed $HOME/applied
+  touch $HOME/prune-skipped $HOME/kinds-skipped $HOME/ownership-conflicts
+  touch $HOME/template-mirror $HOME/parameter-mirror $HOME/inventory-count $HOME/inventory-hash $HOME/inventory-configmap
+  touch $HOME/dry-run-created $HOME/dry-run-updated $HOME/dry-run-deleted $HOME/failed-context-dirs $HOME/namespace-results
+  jq -n -c --arg message "$(cat $HOME/commit-message)" --arg commit "$(cat $HOME/commit)" \
+    --arg forced "$(cat $HOME/force-applied)" --arg recreated "$(cat $HOME/recreated)" --arg drifted "$(cat $HOME/drifted)" \
+    --arg pruned "$(cat $HOME/pruned)" --arg changed "$(cat $HOME/changed)" --argjson inventory "$(inventory)" \
+    --arg applied "$(cat $HOME/applied)" --arg templateMirror "$(cat $HOME/template-mirror)" \
+    --arg parameterMirror "$(cat $HOME/parameter-mirror)" --arg parameterCommit "$(cat $HOME/parameter-commit)" \
+    --arg pruneSkipped "$(cat $HOME/prune-skipped)" --arg dryRun "${DRY_RUN:-false}" \
+    --arg resourcesSkipped "$(awk '!seen[$0]++' $HOME/kinds-skipped)" \
+    --arg ownershipConflicts "$(awk '!seen[$0]++' $HOME/ownership-conflicts)" \
+    --arg dryRunCreated "$(cat $HOME/dry-run-created)" --arg dryRunUpdated "$(cat $HOME/dry-run-updated)" \
+    --arg dryRunDeleted "$(cat $HOME/dry-run-deleted)" --arg failedContextDirs "$(awk '!seen[$0]++' $HOME/failed-context-dirs)" \
+    --argjson contextDirCount "$(echo ${TEMPLATE_CONTEXT_DIRS:-} | wc -w)" --arg namespaceResults "$(cat $HOME/namespace-results)" \
+    --arg phaseTimes "$(cat $HOME/phase-times)" --arg finished "${EPOCHREALTIME:-$(date +%s)}" \
+    --arg inventoryCount "$(cat $HOME/inventory-count)" --arg inventoryHash "$(cat $HOME/inventory-hash)" \
+    --arg inventoryConfigMap "$(cat $HOME/inventory-configmap)" \
+    '{commitMessage: ($message | .[0:200]), commit: $commit, parameterCommit: $parameterCommit,
+      forceApplied: ($forced | split("\n") | map(select(. != "")) | .[0:50]),
+      recreated: ($recreated | split("\n") | map(select(. != "")) | .[0:20]),
+      drifted: ($drifted | split("\n") | map(select(. != "")) | .[0:20]),
+      driftedCount: ($drifted | split("\n") | map(select(. != "")) | length),
+      pruned: ($pruned | split("\n") | map(select(. != "")) | .[0:50]),
+      prunedCount: ($pruned | split("\n") | map(select(. != "")) | length),
+      pruneSkipped: ($pruneSkipped | split("\n") | map(select(. != "")) | .[0:20]),
+      resourcesSkipped: ($resourcesSkipped | split("\n") | map(select(. != "")) | .[0:20]),
+      ownershipConflicts: ($ownershipConflicts | split("\n") | map(select(. != "")) | .[0:20]),
+      changed: (if $changed == "" then null else ($changed | startswith("true")) end),
+      inventory: $inventory,
+      managedResources: (if $inventoryHash == "" then null else
+        {count: ($inventoryCount | tonumber), hash: $inventoryHash, configMap: $inventoryConfigMap} end),
+      namespaces: ($namespaceResults | split("\n") | map(select(. != "") | split(" ") | {namespace: .[0], result: .[1]})),
+      applied: ($applied | split("\n") | map(select(. != "")) | .[0:30]),
+      templateMirror: $templateMirror, parameterMirror: $parameterMirror,
+      failedContextDirs: ($failedContextDirs | split("\n") | map(select(. != ""))), contextDirCount: $contextDirCount,
+      phases: ($phaseTimes | split("\n") | map(select(. != "") | split(" ") | {name: .[0], start: (.[1] | tonumber)}) | .[0:20]),
+      finished: ($finished | tonumber),
+      dryRun: (if $dryRun == "true" then {
+        created: ($dryRunCreated | split("\n") | map(select(. != "") | tonumber) | add // 0),
+        updated: ($dryRunUpdated | split("\n") | map(select(. != "") | tonumber) | add // 0),
+        deleted: ($dryRunDeleted | split("\n") | map(select(. != "")) | length)} else null end)}' | \
+    /usr/local/bin/boundReport.sh > /dev/termination-log
+fi
@@ -0,0 +1,26 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+
+## every file in $CLONED_TEMPLATE_GIT_DIR is a Go template, rendered into the same path in $MANIFEST_DIR
+## the parameters are read from $PARAMETER_FILE in $CLONED_PARAMETER_GIT_DIR, or merged from all its .yaml and .yml files
+
+echo Processing Templates
+
+gotemplate --templates $CLONED_TEMPLATE_GIT_DIR --parameters $CLONED_PARAMETER_GIT_DIR \
+  --parameter-file "${PARAMETER_FILE:-}" --output $MANIFEST_DIR
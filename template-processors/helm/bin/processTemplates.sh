@@ -17,10 +17,56 @@
 set -o nounset
 set -o errexit
 
-## we assume in $CLONED_TEMPLATE_GIT_DIR there is a helm chart
-## the helm chart may need updating
+## we assume in $CLONED_TEMPLATE_GIT_DIR there is a helm v3 chart, rendered with every line of $TEMPLATE_VALUES_FILES
+## as a values file of the chart, then the parameter file as its values, and every line of $HELM_SET as a --set value
 
-envsubst < $CLONED_PARAMETER_GIT_DIR/values.yaml > $CLONED_PARAMETER_GIT_DIR/values_subst.yaml
-helm init --client-only
-helm repo update $CLONED_TEMPLATE_GIT_DIR
-helm template -f $CLONED_PARAMETER_GIT_DIR/values_subst.yaml --output-dir $MANIFEST_DIR --namespace $NAMESPACE $CLONED_TEMPLATE_GIT_DIR
+args=()
+# the values files are merged by helm in order, the ones given after them override them
+missing=()
+while IFS= read -r file; do
+  if [ -z "$file" ]; then
+    continue
+  fi
+  if [ ! -f "$CLONED_TEMPLATE_GIT_DIR/$file" ]; then
+    missing+=("$file")
+  fi
+  args+=(--values "$CLONED_TEMPLATE_GIT_DIR/$file")
+done <<< "${TEMPLATE_VALUES_FILES:-}"
+if [ ${#missing[@]} -gt 0 ]; then
+  echo "The valuesFiles ${missing[*]} of the template source don't exist in $CLONED_TEMPLATE_GIT_DIR" >&2
+  exit 1
+fi
+if [ -f "$CLONED_PARAMETER_GIT_DIR/${PARAMETER_FILE:-values.yaml}" ]; then
+  envsubst < "$CLONED_PARAMETER_GIT_DIR/${PARAMETER_FILE:-values.yaml}" > $HOME/values_subst.yaml
+  args+=(--values $HOME/values_subst.yaml)
+fi
+while IFS= read -r value; do
+  if [ -n "$value" ]; then
+    args+=(--set "$value")
+  fi
+done <<< "${HELM_SET:-}"
+
+# the dependencies are built once, the script running once per target namespace
+if [ ! -f $HOME/helm-dependencies ]; then
+  i=0
+  for file in Chart.yaml requirements.yaml; do
+    if [ -f "$CLONED_TEMPLATE_GIT_DIR/$file" ]; then
+      for repository in $(yq -r '.dependencies[]?.repository // empty' "$CLONED_TEMPLATE_GIT_DIR/$file" | grep -E '^https?://' || true); do
+        helm repo add dependency-$i "$repository"
+        i=$((i+1))
+      done
+    fi
+  done
+  if [ $i -gt 0 ] || [ -d "$CLONED_TEMPLATE_GIT_DIR/charts" ]; then
+    helm dependency build "$CLONED_TEMPLATE_GIT_DIR"
+  fi
+  touch $HOME/helm-dependencies
+fi
+
+# the CRDs of the crds directory of the chart are rendered with the other manifests, the hooks are left out
+helm template "${HELM_RELEASE_NAME:-release-name}" "$CLONED_TEMPLATE_GIT_DIR" \
+  --namespace "${HELM_RELEASE_NAMESPACE:-$NAMESPACE}" \
+  --include-crds \
+  --no-hooks \
+  --output-dir $MANIFEST_DIR \
+  ${args[@]+"${args[@]}"}
@@ -10,7 +10,7 @@ set -o errexit
 for file in $CLONED_TEMPLATE_GIT_DIR/*.j2 ; do
   shortfile=$(basename -- "$file")
   # TODO consider improving by adding this filter: lib/ansible/plugins/filters/core.py
-  j2 $file $CLONED_PARAMETER_GIT_DIR/var.yaml  \
+  j2 $file "$CLONED_PARAMETER_GIT_DIR/${PARAMETER_FILE:-var.yaml}"  \
     --import-env env \
     > $MANIFEST_DIR/"${shortfile%.*}";
 done  
\ No newline at end of file
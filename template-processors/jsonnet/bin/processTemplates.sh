@@ -0,0 +1,74 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+
+## we assume in $CLONED_TEMPLATE_GIT_DIR there is a jsonnet program, $JSONNET_ENTRYPOINT or main.jsonnet, evaluated
+## with the parameters of the parameter file as external variables, or as top-level arguments when $JSONNET_VARIABLES
+## is TopLevel
+
+entrypoint=$CLONED_TEMPLATE_GIT_DIR/${JSONNET_ENTRYPOINT:-main.jsonnet}
+
+# the dependencies of jsonnetfile.json are installed into its vendor directory once, the script running once per
+# target namespace
+touch $HOME/jsonnet-dependencies
+if [ -f "$CLONED_TEMPLATE_GIT_DIR/jsonnetfile.json" ] && ! grep -qxF "$CLONED_TEMPLATE_GIT_DIR" $HOME/jsonnet-dependencies; then
+  (cd "$CLONED_TEMPLATE_GIT_DIR" && jb install)
+  echo "$CLONED_TEMPLATE_GIT_DIR" >> $HOME/jsonnet-dependencies
+fi
+
+parameters='{}'
+if [ -f "$CLONED_PARAMETER_GIT_DIR/${PARAMETER_FILE:-values.yaml}" ]; then
+  parameters=$(envsubst < "$CLONED_PARAMETER_GIT_DIR/${PARAMETER_FILE:-values.yaml}" | yq -c '. // {}')
+fi
+if [ "${JSONNET_VARIABLES:-External}" == "TopLevel" ]; then
+  kind=tla
+else
+  # the namespace the resources are applied into is an external variable too, unless the parameters set it
+  kind=ext
+  parameters=$(jq -c --arg namespace "$NAMESPACE" '{namespace: $namespace} + .' <<< "$parameters")
+fi
+
+# the string parameters are passed with --ext-str or --tla-str, the others as jsonnet code, with --ext-code or
+# --tla-code
+args=(--jpath "$CLONED_TEMPLATE_GIT_DIR/vendor")
+while IFS= read -r parameter; do
+  name=$(jq -r '.key' <<< "$parameter")
+  if [ "$(jq -r '.value | type' <<< "$parameter")" == "string" ]; then
+    args+=(--$kind-str "$name=$(jq -r '.value' <<< "$parameter")")
+  else
+    args+=(--$kind-code "$name=$(jq -c '.value' <<< "$parameter")")
+  fi
+done < <(jq -c 'to_entries[]' <<< "$parameters")
+
+jsonnet "${args[@]}" "$entrypoint" > $HOME/jsonnet.json
+
+# the program may evaluate to an object, a List, an array of objects or an object whose fields are objects, e.g. the
+# ones of kube-prometheus, nested at will. Every object is written to its own file.
+index=0
+while IFS= read -r document; do
+  echo "$document" > $MANIFEST_DIR/jsonnet-$(printf %03d $index).json
+  index=$((index+1))
+done < <(jq -c '
+  def documents:
+    if type == "array" then .[] | documents
+    elif type != "object" then empty
+    elif .kind == "List" then .items[] | documents
+    elif has("kind") then .
+    else .[] | documents
+    end;
+  documents' $HOME/jsonnet.json)
@@ -0,0 +1,42 @@
+#!/usr/bin/env bash
+
+# Copyright 2019 Kohl's Department Stores, Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#       http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -o nounset
+set -o errexit
+
+## we assume in $CLONED_TEMPLATE_GIT_DIR, or its $KUSTOMIZE_OVERLAY directory, there is a kustomization
+
+overlay=$CLONED_TEMPLATE_GIT_DIR/${KUSTOMIZE_OVERLAY:-}
+
+# without target namespaces the namespace set by the kustomization, if any, is kept, its other resources being applied
+# into the namespace of the job. With target namespaces, the kustomization is built for every target namespace, which
+# replaces the namespace it sets
+if [ -n "${TARGET_NAMESPACES:-}" ]; then
+  mkdir -p $HOME/kustomize/$NAMESPACE
+  cat > $HOME/kustomize/$NAMESPACE/kustomization.yaml <<EOT
+namespace: $NAMESPACE
+resources:
+- $overlay
+EOT
+  overlay=$HOME/kustomize/$NAMESPACE
+fi
+
+# the kustomize of the image is used, the one embedded in kubectl otherwise
+if command -v kustomize > /dev/null; then
+  kustomize build "$overlay" > $MANIFEST_DIR/kustomize.yaml
+else
+  $kubectl kustomize "$overlay" > $MANIFEST_DIR/kustomize.yaml
+fi
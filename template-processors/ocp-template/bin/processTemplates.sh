@@ -20,5 +20,5 @@ set -o errexit
 ## we assume in $CLONED_TEMPLATE_GIT_DIR there is a template called template.yaml
 ## we assume that in $CLONED_PARAMETER_GIT_DIR there is a parameter file called parameters.ini
 
-envsubst < $CLONED_PARAMETER_GIT_DIR/parameters.ini > $CLONED_PARAMETER_GIT_DIR/parameters_subst.ini
+envsubst < "$CLONED_PARAMETER_GIT_DIR/${PARAMETER_FILE:-parameters.ini}" > $CLONED_PARAMETER_GIT_DIR/parameters_subst.ini
 oc process -f $CLONED_TEMPLATE_GIT_DIR/template.yaml --param-file=$CLONED_PARAMETER_GIT_DIR/parameters_subst.ini > $MANIFEST_DIR/manifests.yaml
@@ -0,0 +1,344 @@
+/*
+Copyright 2019 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	goctx "context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	gitopsv1alpha1 "github.com/KohlsTechnology/eunomia/pkg/apis/eunomia/v1alpha1"
+	test "github.com/KohlsTechnology/eunomia/test"
+	framework "github.com/operator-framework/operator-sdk/pkg/test"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestTargetNamespaces(t *testing.T) {
+	ctx := framework.NewTestCtx(t)
+	defer ctx.Cleanup()
+	test.AddToFrameworkSchemeForTests(t, ctx)
+	if err := targetNamespacesTestDeploy(t, framework.Global, ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrunePolicy(t *testing.T) {
+	for _, policy := range []string{"ApplyThenPrune", "PruneThenApply"} {
+		t.Run(policy, func(t *testing.T) {
+			ctx := framework.NewTestCtx(t)
+			defer ctx.Cleanup()
+			test.AddToFrameworkSchemeForTests(t, ctx)
+			if err := prunePolicyTestDeploy(t, framework.Global, ctx, policy); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestPrunePolicyRename(t *testing.T) {
+	for _, policy := range []string{"ApplyThenPrune", "PruneThenApply"} {
+		t.Run(policy, func(t *testing.T) {
+			ctx := framework.NewTestCtx(t)
+			defer ctx.Cleanup()
+			test.AddToFrameworkSchemeForTests(t, ctx)
+			if err := prunePolicyRenameTestDeploy(t, framework.Global, ctx, policy); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// createTargetNamespaces creates the namespaces, deleted when ctx is cleaned up
+func createTargetNamespaces(f *framework.Framework, ctx *framework.TestCtx, namespaces ...string) error {
+	for _, namespace := range namespaces {
+		_, err := f.KubeClient.CoreV1().Namespaces().Create(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+		if err != nil {
+			return err
+		}
+		namespace := namespace
+		ctx.AddCleanupFn(func() error {
+			return f.KubeClient.CoreV1().Namespaces().Delete(namespace, &metav1.DeleteOptions{})
+		})
+	}
+	return nil
+}
+
+// newTargetNamespacesConfig returns a GitOpsConfig applying the hello-world example into targets
+func newTargetNamespacesConfig(name, namespace string, targets []string) *gitopsv1alpha1.GitOpsConfig {
+	eunomiaURI, found := os.LookupEnv("EUNOMIA_URI")
+	if !found {
+		eunomiaURI = "https://github.com/kohlstechnology/eunomia"
+	}
+
+	eunomiaRef, found := os.LookupEnv("EUNOMIA_REF")
+	if !found {
+		eunomiaRef = "master"
+	}
+
+	gitops := &gitopsv1alpha1.GitOpsConfig{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "GitOpsConfig",
+			APIVersion: "eunomia.kohls.io/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: gitopsv1alpha1.GitOpsConfigSpec{
+			TemplateSource: gitopsv1alpha1.GitConfig{
+				URI:        eunomiaURI,
+				Ref:        eunomiaRef,
+				ContextDir: "examples/hello-world-yaml/template1",
+			},
+			ParameterSource: gitopsv1alpha1.GitConfig{
+				URI:        eunomiaURI,
+				Ref:        eunomiaRef,
+				ContextDir: "examples/hello-world-yaml/template1",
+			},
+			Triggers: []gitopsv1alpha1.GitOpsTrigger{
+				{
+					Type: "Change",
+				},
+			},
+			TargetNamespaces:       targets,
+			ResourceDeletionMode:   "Delete",
+			TemplateProcessorImage: "quay.io/kohlstechnology/eunomia-base:latest",
+			ResourceHandlingMode:   "CreateOrMerge",
+			ServiceAccountRef:      "eunomia-operator",
+		},
+	}
+	gitops.Annotations = map[string]string{"gitopsconfig.eunomia.kohls.io/initialized": "true"}
+	return gitops
+}
+
+func targetNamespacesTestDeploy(t *testing.T, f *framework.Framework, ctx *framework.TestCtx) error {
+	namespace, err := ctx.GetNamespace()
+	if err != nil {
+		return fmt.Errorf("could not get namespace: %v", err)
+	}
+
+	targets := []string{namespace + "-tenant-a", namespace + "-tenant-b", namespace + "-tenant-c"}
+	if err = createTargetNamespaces(f, ctx, targets...); err != nil {
+		return err
+	}
+
+	gitops := newTargetNamespacesConfig("gitops-target-namespaces", namespace, targets)
+	err = f.Client.Create(goctx.TODO(), gitops, &framework.CleanupOptions{TestContext: ctx, Timeout: timeout, RetryInterval: retryInterval})
+	if err != nil {
+		return err
+	}
+
+	// the resources are applied into each target namespace, none into the namespace of the configuration
+	for _, target := range targets {
+		err = WaitForPodWithImage(t, f, ctx, target, "hello-world", "hello-app", retryInterval, timeout)
+		if err != nil {
+			return err
+		}
+	}
+	assert.Empty(t, GetPod(namespace, "hello-world", "hello-app", f.KubeClient).Name)
+
+	// the inventory of each target namespace is in the status
+	err = wait.Poll(retryInterval, timeout, func() (bool, error) {
+		err := f.Client.Get(goctx.TODO(), types.NamespacedName{Name: gitops.Name, Namespace: namespace}, gitops)
+		if err != nil {
+			return false, err
+		}
+		return len(gitops.Status.Inventory) == len(targets), nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, inventory := range gitops.Status.Inventory {
+		assert.Equal(t, targets[i], inventory.Namespace)
+		assert.Equal(t, []string{"deployment/hello-world", "service/hello-world"}, inventory.Resources)
+		assert.Equal(t, 2, inventory.ResourceCount)
+	}
+	return nil
+}
+
+// prunePolicyTestDeploy renames the target namespace of a configuration, checking
+// that the old and new resources are applied and deleted in the order of policy
+func prunePolicyTestDeploy(t *testing.T, f *framework.Framework, ctx *framework.TestCtx, policy string) error {
+	namespace, err := ctx.GetNamespace()
+	if err != nil {
+		return fmt.Errorf("could not get namespace: %v", err)
+	}
+
+	oldTarget, newTarget := namespace+"-old", namespace+"-new"
+	if err = createTargetNamespaces(f, ctx, oldTarget, newTarget); err != nil {
+		return err
+	}
+
+	gitops := newTargetNamespacesConfig("gitops-prune-policy", namespace, []string{oldTarget})
+	gitops.Spec.PrunePolicy = policy
+	err = f.Client.Create(goctx.TODO(), gitops, &framework.CleanupOptions{TestContext: ctx, Timeout: timeout, RetryInterval: retryInterval})
+	if err != nil {
+		return err
+	}
+	err = WaitForPodWithImage(t, f, ctx, oldTarget, "hello-world", "hello-app", retryInterval, timeout)
+	if err != nil {
+		return err
+	}
+
+	// rename the target namespace, once the old one is in the inventory for its resources to be deleted
+	err = wait.Poll(retryInterval, timeout, func() (bool, error) {
+		err := f.Client.Get(goctx.TODO(), types.NamespacedName{Name: gitops.Name, Namespace: namespace}, gitops)
+		if err != nil {
+			return false, err
+		}
+		return len(gitops.Status.Inventory) == 1, nil
+	})
+	if err != nil {
+		return err
+	}
+	gitops.Spec.TargetNamespaces = []string{newTarget}
+	err = f.Client.Update(goctx.TODO(), gitops)
+	if err != nil {
+		return err
+	}
+
+	deploymentExists := func(namespace string) (bool, error) {
+		_, err := f.KubeClient.AppsV1().Deployments(namespace).Get("hello-world", metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	// every intermediate state must follow the policy, until only the new deployment is left
+	return wait.Poll(time.Second, timeout, func() (bool, error) {
+		inOld, err := deploymentExists(oldTarget)
+		if err != nil {
+			return false, err
+		}
+		inNew, err := deploymentExists(newTarget)
+		if err != nil {
+			return false, err
+		}
+		switch policy {
+		case "ApplyThenPrune":
+			assert.False(t, !inOld && !inNew, "the old deployment was deleted before the new one was applied")
+		case "PruneThenApply":
+			assert.False(t, inOld && inNew, "the new deployment was applied before the old one was deleted")
+		}
+		return !inOld && inNew, nil
+	})
+}
+
+// prunePolicyRenameTestDeploy renames the service of the hello-world example, keeping its node port, which is unique in
+// the cluster. The renamed service can only be applied once the old one is pruned, which PruneThenApply does first,
+// while ApplyThenPrune fails the run and keeps the old service
+func prunePolicyRenameTestDeploy(t *testing.T, f *framework.Framework, ctx *framework.TestCtx, policy string) error {
+	namespace, err := ctx.GetNamespace()
+	if err != nil {
+		return fmt.Errorf("could not get namespace: %v", err)
+	}
+
+	target := namespace + "-rename"
+	if err = createTargetNamespaces(f, ctx, target); err != nil {
+		return err
+	}
+
+	gitops := newTargetNamespacesConfig("gitops-prune-policy-rename", namespace, []string{target})
+	gitops.Spec.PrunePolicy = policy
+	gitops.Spec.ResourceDeletionMode = "Prune"
+	err = f.Client.Create(goctx.TODO(), gitops, &framework.CleanupOptions{TestContext: ctx, Timeout: timeout, RetryInterval: retryInterval})
+	if err != nil {
+		return err
+	}
+	err = WaitForPodWithImage(t, f, ctx, target, "hello-world", "hello-app", retryInterval, timeout)
+	if err != nil {
+		return err
+	}
+
+	// rename the service once the first run succeeded
+	err = wait.Poll(retryInterval, timeout, func() (bool, error) {
+		err := f.Client.Get(goctx.TODO(), types.NamespacedName{Name: gitops.Name, Namespace: namespace}, gitops)
+		if err != nil {
+			return false, err
+		}
+		return len(gitops.Status.Inventory) == 1, nil
+	})
+	if err != nil {
+		return err
+	}
+	gitops.Spec.TemplateSource.ContextDir = "examples/hello-world-yaml/template4"
+	gitops.Spec.ParameterSource.ContextDir = "examples/hello-world-yaml/template4"
+	err = f.Client.Update(goctx.TODO(), gitops)
+	if err != nil {
+		return err
+	}
+
+	serviceExists := func(name string) (bool, error) {
+		_, err := f.KubeClient.CoreV1().Services(target).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	switch policy {
+	case "ApplyThenPrune":
+		// the node port is still allocated to the old service when the renamed one is applied
+		err = wait.Poll(retryInterval, timeout, func() (bool, error) {
+			err := f.Client.Get(goctx.TODO(), types.NamespacedName{Name: gitops.Name, Namespace: namespace}, gitops)
+			if err != nil {
+				return false, err
+			}
+			return gitops.Status.ConsecutiveFailures > 0, nil
+		})
+		if err != nil {
+			return err
+		}
+		oldExists, err := serviceExists("hello-world")
+		if err != nil {
+			return err
+		}
+		assert.True(t, oldExists, "the old service was deleted although the renamed one failed to apply")
+		newExists, err := serviceExists("hello-world-renamed")
+		if err != nil {
+			return err
+		}
+		assert.False(t, newExists, "the renamed service was applied with the node port of the old one")
+	case "PruneThenApply":
+		err = wait.Poll(retryInterval, timeout, func() (bool, error) {
+			oldExists, err := serviceExists("hello-world")
+			if err != nil {
+				return false, err
+			}
+			newExists, err := serviceExists("hello-world-renamed")
+			if err != nil {
+				return false, err
+			}
+			return !oldExists && newExists, nil
+		})
+		if err != nil {
+			return err
+		}
+		service, err := f.KubeClient.CoreV1().Services(target).Get("hello-world-renamed", metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, int32(30168), service.Spec.Ports[0].NodePort)
+	}
+	return nil
+}